@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/serisow/lesocle/content_filter"
 	"github.com/serisow/lesocle/services/action_service"
 	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/rate_limiter"
 )
 
 type ActionStepImpl struct {
@@ -24,15 +26,25 @@ func (s *ActionStepImpl) Execute(ctx context.Context, pipelineContext *pipeline_
         }
     }
 
+    // Cheap brand-safety pre-check of everything the action is about to publish
+    if err := s.checkOutboundContent(pipelineContext); err != nil {
+        return err
+    }
+
     // For Drupal-side actions, just prepare the context and return
     if s.PipelineStep.ActionDetails.ExecutionLocation == "drupal" {
         if s.PipelineStep.StepOutputKey != "" {
-            pipelineContext.SetStepOutput(s.PipelineStep.StepOutputKey, map[string]interface{}{
+            output := map[string]interface{}{
                 "action_config":      s.PipelineStep.ActionConfig,
                 "execution_location": "drupal",
                 "configuration":      s.PipelineStep.ActionDetails.Configuration,
                 "action_service":     s.PipelineStep.ActionDetails.ActionService,
-            })
+            }
+            // Drupal must not perform the action of a rehearsal
+            if pipelineContext.Sandbox {
+                output["sandbox"] = true
+            }
+            pipelineContext.SetStepOutput(s.PipelineStep.StepOutputKey, output)
         }
         return nil
     }
@@ -42,11 +54,29 @@ func (s *ActionStepImpl) Execute(ctx context.Context, pipelineContext *pipeline_
         return fmt.Errorf("ActionService is not initialized for step %s", s.PipelineStep.ID)
     }
 
-    result, err := s.ActionServiceInstance.Execute(ctx, s.PipelineStep.ActionConfig, pipelineContext, &s.PipelineStep)
+    var result string
+    var err error
+    if pipelineContext.Sandbox {
+        result, err = s.executeSandbox(ctx, pipelineContext)
+    } else {
+        if err := rate_limiter.Wait(ctx, s.PipelineStep.ActionDetails.ActionService); err != nil {
+            return fmt.Errorf("rate limit wait for step %s: %w", s.PipelineStep.ID, err)
+        }
+        result, err = s.ActionServiceInstance.Execute(ctx, s.PipelineStep.ActionConfig, pipelineContext, &s.PipelineStep)
+    }
     if err != nil {
         return fmt.Errorf("error executing action service for step %s: %w", s.PipelineStep.ID, err)
     }
 
+    // Tell the reviewer what went out
+    if published := s.PipelineStep.RequiredStepKeys(); len(published) > 0 {
+        pipelineContext.Annotate(s.PipelineStep.ID, pipeline_type.Annotation{
+            Kind:    pipeline_type.AnnotationSource,
+            Message: fmt.Sprintf("Outputs published by %s", s.PipelineStep.ActionDetails.ActionService),
+            Sources: published,
+        })
+    }
+
     if s.PipelineStep.StepOutputKey != "" {
         pipelineContext.SetStepOutput(s.PipelineStep.StepOutputKey, result)
     }
@@ -54,6 +84,54 @@ func (s *ActionStepImpl) Execute(ctx context.Context, pipelineContext *pipeline_
     return nil
 }
 
+// executeSandbox runs the action in sandbox mode: services supporting it use
+// their test endpoint, the others are simulated.
+func (s *ActionStepImpl) executeSandbox(ctx context.Context, pipelineContext *pipeline_type.Context) (string, error) {
+    service := s.PipelineStep.ActionDetails.ActionService
+    sandboxed, ok := s.ActionServiceInstance.(action_service.SandboxService)
+    if !ok {
+        pipelineContext.Annotate(s.PipelineStep.ID, pipeline_type.Annotation{
+            Kind:    pipeline_type.AnnotationWarning,
+            Message: fmt.Sprintf("Sandbox: %s was simulated, nothing was sent", service),
+        })
+        return action_service.SimulatedResult(&s.PipelineStep)
+    }
+
+    if err := rate_limiter.Wait(ctx, service); err != nil {
+        return "", fmt.Errorf("rate limit wait for step %s: %w", s.PipelineStep.ID, err)
+    }
+    pipelineContext.Annotate(s.PipelineStep.ID, pipeline_type.Annotation{
+        Kind:    pipeline_type.AnnotationWarning,
+        Message: fmt.Sprintf("Sandbox: %s ran without publishing", service),
+    })
+    return sandboxed.ExecuteSandbox(ctx, s.PipelineStep.ActionConfig, pipelineContext, &s.PipelineStep)
+}
+
+// checkOutboundContent runs the pipeline content filter over the outputs the
+// action consumes and the texts its configuration fills from the context.
+func (s *ActionStepImpl) checkOutboundContent(pipelineContext *pipeline_type.Context) error {
+    filter := content_filter.New(pipelineContext.ContentFilter)
+    if filter == nil {
+        return nil
+    }
+
+    for _, key := range s.PipelineStep.RequiredStepKeys() {
+        output, err := pipelineContext.GetString(key)
+        if err != nil {
+            continue
+        }
+        if err := filter.Validate(output); err != nil {
+            return fmt.Errorf("outbound content of step %s rejected: %w", s.PipelineStep.ID, err)
+        }
+    }
+    for _, text := range action_service.OutboundContent(s.PipelineStep.ActionDetails.Configuration, pipelineContext) {
+        if err := filter.Validate(text); err != nil {
+            return fmt.Errorf("outbound content of step %s rejected: %w", s.PipelineStep.ID, err)
+        }
+    }
+    return nil
+}
+
 func (s *ActionStepImpl) GetType() string {
     return "action_step"
 }
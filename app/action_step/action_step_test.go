@@ -232,3 +232,117 @@ func compareConfigMaps(t *testing.T, expected, actual map[string]interface{}, pa
         }
     }
 }
+
+// sandboxTestService runs against a test endpoint in sandbox mode.
+type sandboxTestService struct {
+	action_service.MockActionService
+}
+
+func (s *sandboxTestService) ExecuteSandbox(ctx context.Context, actionConfig string, pipelineContext *pipeline_type.Context, step *pipeline_type.PipelineStep) (string, error) {
+	return `{"status":"test"}`, nil
+}
+
+func TestActionStepSandbox(t *testing.T) {
+	called := false
+	published := &action_service.MockActionService{
+		Response: func(context.Context, string, *pipeline_type.Context, *pipeline_type.PipelineStep) string {
+			called = true
+			return "posted"
+		},
+	}
+	step := pipeline_type.PipelineStep{
+		ID:            "post",
+		StepOutputKey: "post_result",
+		ActionDetails: &pipeline_type.ActionDetails{ActionService: "post_tweet", ExecutionLocation: "go"},
+	}
+
+	ctx := pipeline_type.NewContext()
+	ctx.Sandbox = true
+	impl := &ActionStepImpl{PipelineStep: step, ActionServiceInstance: published}
+	if err := impl.Execute(context.Background(), ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if called {
+		t.Error("expected the action to be simulated in sandbox mode")
+	}
+	var simulated map[string]interface{}
+	if err := ctx.GetJSON("post_result", &simulated); err != nil || simulated["simulated"] != true || simulated["sandbox"] != true {
+		t.Errorf("expected a simulated result labeled sandbox, got %v (%v)", simulated, err)
+	}
+	if notes := ctx.Annotations("post"); len(notes) != 1 || notes[0].Kind != pipeline_type.AnnotationWarning {
+		t.Errorf("expected a sandbox warning for the reviewer, got %v", notes)
+	}
+
+	// Services with a test mode run it instead
+	ctx = pipeline_type.NewContext()
+	ctx.Sandbox = true
+	impl = &ActionStepImpl{PipelineStep: step, ActionServiceInstance: &sandboxTestService{}}
+	if err := impl.Execute(context.Background(), ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if output, _ := ctx.GetString("post_result"); output != `{"status":"test"}` {
+		t.Errorf("expected the test mode result, got %q", output)
+	}
+
+	// Drupal is told not to perform the action
+	ctx = pipeline_type.NewContext()
+	ctx.Sandbox = true
+	drupalStep := step
+	drupalStep.ActionDetails = &pipeline_type.ActionDetails{ActionService: "create_article_action", ExecutionLocation: "drupal"}
+	impl = &ActionStepImpl{PipelineStep: drupalStep}
+	if err := impl.Execute(context.Background(), ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	output, _ := ctx.GetRawStepOutput("post_result")
+	if fields, ok := output.(map[string]interface{}); !ok || fields["sandbox"] != true {
+		t.Errorf("expected the Drupal action flagged sandbox, got %v", output)
+	}
+}
+
+func TestActionStepOutboundContentFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  map[string]interface{}
+		wantErr bool
+	}{
+		{"clean template", map[string]interface{}{"message_template": "News: {draft}"}, false},
+		{"template filled from an output", map[string]interface{}{"message_template": "News: {rant}"}, true},
+		{"nested template", map[string]interface{}{"body": map[string]interface{}{"text": "{rant.0}"}}, true},
+		{"literal setting", map[string]interface{}{"subject": "What the f.u.c.k"}, true},
+		{"recipients_from content", map[string]interface{}{"recipients_from": "contacts"}, true},
+		{"unknown path", map[string]interface{}{"events_from": "missing"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			service := &action_service.MockActionService{
+				Response: func(context.Context, string, *pipeline_type.Context, *pipeline_type.PipelineStep) string {
+					called = true
+					return "sent"
+				},
+			}
+			ctx := pipeline_type.NewContext()
+			ctx.ContentFilter = &pipeline_type.ContentFilterConfig{Enabled: true, UseDefaultList: true}
+			ctx.SetStepOutput("draft", "Our release ships today")
+			ctx.SetStepOutput("rant", `["this is sh1t"]`)
+			ctx.SetStepOutput("contacts", `[{"phone":"+15550100","name":"shiiiit"}]`)
+			impl := &ActionStepImpl{
+				PipelineStep: pipeline_type.PipelineStep{
+					ID:            "notify",
+					StepOutputKey: "notified",
+					ActionDetails: &pipeline_type.ActionDetails{ActionService: "send_sms", ExecutionLocation: "go", Configuration: tt.config},
+				},
+				ActionServiceInstance: service,
+			}
+
+			err := impl.Execute(context.Background(), ctx)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Execute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if called == tt.wantErr {
+				t.Errorf("expected the action sent only when the content passes, sent: %v", called)
+			}
+		})
+	}
+}
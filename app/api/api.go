@@ -0,0 +1,169 @@
+// Package api holds the request and response bodies of the HTTP API, shared by
+// the handlers, the OpenAPI document and the client.
+package api
+
+import "github.com/serisow/lesocle/artifact"
+
+// ExecuteRequest starts an on-demand execution.
+type ExecuteRequest struct {
+	UserInput   string `json:"user_input"`
+	CallbackURL string `json:"callback_url,omitempty"`
+	// Rehearse without publishing
+	Sandbox bool `json:"sandbox,omitempty"`
+}
+
+// ExecutionAccepted is the answer to the requests starting an execution.
+type ExecutionAccepted struct {
+	ExecutionID string `json:"execution_id"`
+	PipelineID  string `json:"pipeline_id"`
+	Status      string `json:"status"`
+	SubmittedAt string `json:"submitted_at"`
+	UserInput   string `json:"user_input"`
+	Sandbox     bool   `json:"sandbox"`
+	// Set for artifact regenerations
+	RegeneratedFrom *artifact.Origin `json:"regenerated_from,omitempty"`
+	RerunSteps      []string         `json:"rerun_steps,omitempty"`
+	// Set for reruns, single step runs and re-drives of dead letters
+	RerunOf    string   `json:"rerun_of,omitempty"`
+	SkipSteps  []string `json:"skip_steps,omitempty"`
+	StepID     string   `json:"step_id,omitempty"`
+	SnapshotOf string   `json:"snapshot_of,omitempty"`
+	RedriveOf  string   `json:"redrive_of,omitempty"`
+	// Links to the status and results of the execution
+	Links map[string]string `json:"links"`
+}
+
+// ExecutionStatus is the status of an execution.
+type ExecutionStatus struct {
+	ExecutionID string `json:"execution_id"`
+	Status      string `json:"status"`
+	SubmittedAt string `json:"submitted_at"`
+	CompletedAt string `json:"completed_at"`
+	// Set once the execution finished
+	Cost *ExecutionCost `json:"cost,omitempty"`
+}
+
+// ExecutionResults are the step results of a completed execution, keyed by
+// step UUID.
+type ExecutionResults struct {
+	ExecutionID string                 `json:"execution_id"`
+	Status      string                 `json:"status"`
+	Results     map[string]interface{} `json:"results"`
+	CompletedAt string                 `json:"completed_at"`
+	Cost        *ExecutionCost         `json:"cost,omitempty"`
+}
+
+// ExecutionCost is the estimated LLM cost of an execution, from the tokens
+// of its steps and the price table.
+type ExecutionCost struct {
+	Total    float64 `json:"total"`
+	Currency string  `json:"currency"`
+	// Cost per step UUID
+	Steps map[string]float64 `json:"steps"`
+	// Models of the steps left out of the total as they have no price
+	UnpricedModels []string `json:"unpriced_models,omitempty"`
+}
+
+// BulkExecuteRequest starts one execution per item. Each item is the payload
+// of a trigger: its user_input field is the user input, the whole item is
+// available to the steps as the "trigger_payload" output.
+type BulkExecuteRequest struct {
+	Items []map[string]interface{} `json:"items"`
+}
+
+// BatchItem is the execution of one item of a bulk request.
+type BatchItem struct {
+	Index        int               `json:"index"`
+	ExecutionID  string            `json:"execution_id"`
+	Status       string            `json:"status"`
+	ErrorMessage string            `json:"error_message,omitempty"`
+	Links        map[string]string `json:"links"`
+}
+
+// BatchStatus is the status of the executions of a bulk request: pending
+// until one started, running until all finished, then completed or failed
+// when any failed.
+type BatchStatus struct {
+	BatchID    string         `json:"batch_id"`
+	PipelineID string         `json:"pipeline_id"`
+	Status     string         `json:"status"`
+	CreatedAt  string         `json:"created_at"`
+	Counts     map[string]int `json:"counts"`
+	Items      []BatchItem    `json:"items"`
+}
+
+// ExecutionEvent is the status of an execution, then its execution and step
+// events, as streamed by the progress WebSocket and the gRPC API. Type is
+// "status" for the status, the event type otherwise.
+type ExecutionEvent struct {
+	Type        string  `json:"type"`
+	PipelineID  string  `json:"pipeline_id,omitempty"`
+	ExecutionID string  `json:"execution_id"`
+	Status      string  `json:"status,omitempty"`
+	StepID      string  `json:"step_id,omitempty"`
+	StepType    string  `json:"step_type,omitempty"`
+	Percent     float64 `json:"percent,omitempty"`
+	Tokens      int     `json:"tokens,omitempty"`
+	Message     string  `json:"message,omitempty"`
+	Error       string  `json:"error,omitempty"`
+	Time        int64   `json:"time"`
+}
+
+// RerunRequest reruns an execution, reusing the outputs of the skipped steps
+// and with pinned outputs replacing step outputs.
+type RerunRequest struct {
+	SkipSteps     []string               `json:"skip_steps"`
+	PinnedOutputs map[string]interface{} `json:"pinned_outputs"`
+	// The user input of the rerun execution when set
+	UserInput *string `json:"user_input,omitempty"`
+}
+
+// StepRequest runs a single step on the context of a past execution, with
+// step outputs overriding the context.
+type StepRequest struct {
+	StepOutputs map[string]interface{} `json:"step_outputs"`
+}
+
+// RedriveRequest starts a dead letter again, from its first step or resuming
+// after its completed steps.
+type RedriveRequest struct {
+	Resume bool `json:"resume"`
+}
+
+// RegenerateRequest regenerates an artifact, with parameters overriding the
+// configuration of the step producing it.
+type RegenerateRequest struct {
+	Parameters map[string]interface{} `json:"parameters"`
+}
+
+// SwitchRequest turns maintenance mode or a pipeline on or off.
+type SwitchRequest struct {
+	Enabled *bool  `json:"enabled"`
+	Reason  string `json:"reason"`
+}
+
+// Switch is the state of maintenance mode.
+type Switch struct {
+	Enabled   bool   `json:"enabled"`
+	Reason    string `json:"reason,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+// PipelineSwitch is the state of the kill switch of a pipeline.
+type PipelineSwitch struct {
+	PipelineID string `json:"pipeline_id"`
+	Enabled    bool   `json:"enabled"`
+	Reason     string `json:"reason"`
+}
+
+// ScheduleRequest optionally gives the reason of pausing or resuming a schedule.
+type ScheduleRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ScheduleState is whether the schedule of a pipeline is paused.
+type ScheduleState struct {
+	PipelineID string `json:"pipeline_id"`
+	Paused     bool   `json:"paused"`
+	Reason     string `json:"reason"`
+}
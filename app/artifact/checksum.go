@@ -0,0 +1,70 @@
+package artifact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrChecksumMismatch is returned when a file no longer matches its recorded checksum.
+var ErrChecksumMismatch = errors.New("artifact checksum mismatch")
+
+// checksumSuffix is the extension of the sidecar file holding the SHA-256 of an artifact.
+const checksumSuffix = ".sha256"
+
+// ChecksumFile computes the hex encoded SHA-256 of a file.
+func ChecksumFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("error hashing file: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// RecordChecksum computes the SHA-256 of an artifact and stores it in a sidecar
+// file next to it, so downloads can be verified later. When the producing
+// service already reported a checksum it must match the file on disk.
+func RecordChecksum(a Artifact) (string, error) {
+	sum, err := ChecksumFile(a.URI)
+	if err != nil {
+		return "", err
+	}
+	if a.SHA256 != "" && !strings.EqualFold(a.SHA256, sum) {
+		return "", fmt.Errorf("%w: %s was reported as %s but is %s", ErrChecksumMismatch, a.URI, a.SHA256, sum)
+	}
+	if err := os.WriteFile(a.URI+checksumSuffix, []byte(sum+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("failed to write checksum file: %w", err)
+	}
+	return sum, nil
+}
+
+// VerifyFile checks a file against its recorded checksum and returns the
+// checksum. Files without a recorded checksum are hashed but not rejected.
+func VerifyFile(path string) (string, error) {
+	sum, err := ChecksumFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	recorded, err := os.ReadFile(path + checksumSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return sum, nil
+		}
+		return "", fmt.Errorf("failed to read checksum file: %w", err)
+	}
+	if !strings.EqualFold(strings.TrimSpace(string(recorded)), sum) {
+		return "", fmt.Errorf("%w: %s", ErrChecksumMismatch, path)
+	}
+	return sum, nil
+}
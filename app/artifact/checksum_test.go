@@ -0,0 +1,65 @@
+package artifact
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordAndVerifyChecksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tts_1.mp3")
+	if err := os.WriteFile(path, []byte("audio data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sum, err := RecordChecksum(Artifact{URI: path, MimeType: "audio/mpeg"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	verified, err := VerifyFile(path)
+	if err != nil || verified != sum {
+		t.Fatalf("expected file to verify with %s, got %s (%v)", sum, verified, err)
+	}
+
+	if err := os.WriteFile(path, []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyFile(path); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected checksum mismatch, got %v", err)
+	}
+
+	if _, err := RecordChecksum(Artifact{URI: path, MimeType: "audio/mpeg", SHA256: sum}); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected mismatch with reported checksum, got %v", err)
+	}
+}
+
+func TestManifestSignature(t *testing.T) {
+	seed := make([]byte, ed25519.SeedSize)
+	key, err := ParseSigningKey(base64.StdEncoding.EncodeToString(seed))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	manifest := &Manifest{
+		ExecutionID: "exec-1",
+		PipelineID:  "pipeline-1",
+		Artifacts:   []ManifestEntry{{StepID: "tts", URI: "storage/a.mp3", SHA256: "abc"}},
+	}
+	if err := manifest.Sign(key); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	publicKey := key.Public().(ed25519.PublicKey)
+	if !manifest.Verify(publicKey) {
+		t.Fatal("expected signature to verify")
+	}
+
+	manifest.Artifacts[0].SHA256 = "def"
+	if manifest.Verify(publicKey) {
+		t.Error("expected signature to fail after the manifest was altered")
+	}
+}
@@ -0,0 +1,189 @@
+package artifact
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+// EncoderSettings tune how much of the host ffmpeg may use, so rendering
+// previews doesn't starve the API on shared hosts.
+type EncoderSettings struct {
+	// Threads caps the ffmpeg threads, 0 lets ffmpeg decide.
+	Threads int
+	// Preset and Tune are the x264 preset and tune of encoded clips.
+	Preset string
+	Tune   string
+	// CPUAffinity pins ffmpeg to a CPU list in taskset format, e.g. "2-3,6".
+	CPUAffinity string
+}
+
+// Encoder holds the encoder settings applied to every ffmpeg run.
+var Encoder = EncoderSettings{Preset: "veryfast"}
+
+var (
+	x264Presets   = []string{"ultrafast", "superfast", "veryfast", "faster", "fast", "medium", "slow", "slower", "veryslow", "placebo"}
+	x264Tunes     = []string{"film", "animation", "grain", "stillimage", "fastdecode", "zerolatency"}
+	cpuListFormat = regexp.MustCompile(`^\d+(-\d+)?(,\d+(-\d+)?)*$`)
+)
+
+// Validate checks the settings against what ffmpeg and taskset accept.
+func (e EncoderSettings) Validate() error {
+	if e.Threads < 0 {
+		return fmt.Errorf("invalid ffmpeg thread count: %d", e.Threads)
+	}
+	if e.Preset != "" && !contains(x264Presets, e.Preset) {
+		return fmt.Errorf("unknown x264 preset: %s", e.Preset)
+	}
+	if e.Tune != "" && !contains(x264Tunes, e.Tune) {
+		return fmt.Errorf("unknown x264 tune: %s", e.Tune)
+	}
+	if e.CPUAffinity != "" && !cpuListFormat.MatchString(e.CPUAffinity) {
+		return fmt.Errorf("invalid CPU affinity %q, expected a list such as \"0-3,6\"", e.CPUAffinity)
+	}
+	return nil
+}
+
+// x264Args returns the libx264 options of the settings.
+func (e EncoderSettings) x264Args() []string {
+	preset := e.Preset
+	if preset == "" {
+		preset = "veryfast"
+	}
+	args := []string{"-c:v", "libx264", "-preset", preset}
+	if e.Tune != "" {
+		args = append(args, "-tune", e.Tune)
+	}
+	return args
+}
+
+// command builds the ffmpeg command. The thread cap goes right before the
+// output file, the last argument, so it applies to the encoder. With a CPU
+// affinity ffmpeg is started through taskset, when it is installed.
+func (e EncoderSettings) command(ctx context.Context, args []string) *exec.Cmd {
+	if e.Threads > 0 && len(args) > 0 {
+		output := args[len(args)-1]
+		args = append(append(args[:len(args)-1:len(args)-1], "-threads", strconv.Itoa(e.Threads)), output)
+	}
+	if e.CPUAffinity != "" {
+		if _, err := exec.LookPath("taskset"); err == nil {
+			return exec.CommandContext(ctx, "taskset", append([]string{"-c", e.CPUAffinity, "ffmpeg"}, args...)...)
+		}
+		log.Printf("taskset not found, ignoring ffmpeg CPU affinity %s", e.CPUAffinity)
+	}
+	return exec.CommandContext(ctx, "ffmpeg", args...)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Quality describes how a video is encoded: a constant quality (CRF) or a
+// two-pass encode hitting a target bitrate, at an optional output size.
+type Quality struct {
+	// CRF is the x264 constant rate factor, lower is better, 23 by default.
+	CRF int `json:"crf,omitempty"`
+	// TargetBitrate switches to a two-pass encode, e.g. "4M".
+	TargetBitrate string `json:"target_bitrate,omitempty"`
+	// Width and Height scale and pad the video to a fixed frame.
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// AudioBitrate of the AAC track, no audio when empty.
+	AudioBitrate string `json:"audio_bitrate,omitempty"`
+}
+
+// QualityPresets are the encodings expected by the publishing platforms.
+var QualityPresets = map[string]Quality{
+	"youtube_1080p": {CRF: 20, Width: 1920, Height: 1080, AudioBitrate: "192k"},
+	"youtube_720p":  {CRF: 21, Width: 1280, Height: 720, AudioBitrate: "128k"},
+	"reels_9x16":    {CRF: 22, Width: 1080, Height: 1920, AudioBitrate: "128k"},
+	"square_1x1":    {CRF: 22, Width: 1080, Height: 1080, AudioBitrate: "128k"},
+	"twitter_720p":  {TargetBitrate: "5M", Width: 1280, Height: 720, AudioBitrate: "128k"},
+}
+
+// QualityPreset returns a platform preset by name.
+func QualityPreset(name string) (Quality, error) {
+	q, ok := QualityPresets[name]
+	if !ok {
+		return Quality{}, fmt.Errorf("unknown quality preset: %s", name)
+	}
+	return q, nil
+}
+
+var bitrateFormat = regexp.MustCompile(`^\d+(\.\d+)?[kKM]?$`)
+
+// Validate checks the quality settings.
+func (q Quality) Validate() error {
+	if q.CRF < 0 || q.CRF > 51 {
+		return fmt.Errorf("crf must be between 0 and 51, got %d", q.CRF)
+	}
+	if q.CRF > 0 && q.TargetBitrate != "" {
+		return fmt.Errorf("crf and target bitrate are mutually exclusive")
+	}
+	for _, bitrate := range []string{q.TargetBitrate, q.AudioBitrate} {
+		if bitrate != "" && !bitrateFormat.MatchString(bitrate) {
+			return fmt.Errorf("invalid bitrate: %s", bitrate)
+		}
+	}
+	if (q.Width > 0) != (q.Height > 0) {
+		return fmt.Errorf("width and height must be set together")
+	}
+	return nil
+}
+
+// filterArgs scales the video to fit the frame and pads the rest.
+func (q Quality) filterArgs() []string {
+	if q.Width <= 0 || q.Height <= 0 {
+		return nil
+	}
+	return []string{"-vf", fmt.Sprintf("scale=%[1]d:%[2]d:force_original_aspect_ratio=decrease,pad=%[1]d:%[2]d:(ow-iw)/2:(oh-ih)/2,setsar=1", q.Width, q.Height)}
+}
+
+func (q Quality) audioArgs() []string {
+	if q.AudioBitrate == "" {
+		return []string{"-an"}
+	}
+	return []string{"-c:a", "aac", "-b:a", q.AudioBitrate}
+}
+
+// EncodeVideo encodes src to an H.264 MP4 at dst with DefaultRenderer.
+func EncodeVideo(ctx context.Context, src, dst string, q Quality) error {
+	if err := q.Validate(); err != nil {
+		return err
+	}
+
+	args := append([]string{"-y", "-i", InputRef(0)}, q.filterArgs()...)
+	args = append(args, Encoder.x264Args()...)
+	args = append(args, "-pix_fmt", "yuv420p", "-movflags", "+faststart")
+	job := RenderJob{Inputs: []string{src}, Outputs: []string{dst}}
+
+	if q.TargetBitrate == "" {
+		crf := q.CRF
+		if crf == 0 {
+			crf = 23
+		}
+		args = append(args, "-crf", strconv.Itoa(crf))
+		args = append(args, q.audioArgs()...)
+		job.Commands = [][]string{append(args, OutputRef(0))}
+	} else {
+		// The statistics of the first pass stay in the scratch directory
+		args = append(args, "-b:v", q.TargetBitrate, "-passlogfile", WorkDirPlaceholder+"/2pass")
+		firstPass := append(append([]string{}, args...), "-pass", "1", "-an", "-f", "mp4", os.DevNull)
+		secondPass := append(append(args, "-pass", "2"), q.audioArgs()...)
+		job.Commands = [][]string{firstPass, append(secondPass, OutputRef(0))}
+	}
+
+	if err := DefaultRenderer.Render(ctx, job); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", src, err)
+	}
+	return nil
+}
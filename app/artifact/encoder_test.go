@@ -0,0 +1,58 @@
+package artifact
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestEncoderSettingsValidate(t *testing.T) {
+	valid := EncoderSettings{Threads: 2, Preset: "medium", Tune: "film", CPUAffinity: "0-3,6"}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, e := range []EncoderSettings{
+		{Threads: -1},
+		{Preset: "turbo"},
+		{Tune: "music"},
+		{CPUAffinity: "0 1"},
+	} {
+		if err := e.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", e)
+		}
+	}
+}
+
+func TestEncoderCommandAddsThreadsBeforeOutput(t *testing.T) {
+	args := []string{"-i", "in.mp4", "out.mp4"}
+	cmd := EncoderSettings{Threads: 2}.command(context.Background(), args)
+
+	got := strings.Join(cmd.Args[1:], " ")
+	if got != "-i in.mp4 -threads 2 out.mp4" {
+		t.Errorf("unexpected arguments: %s", got)
+	}
+	if strings.Join(args, " ") != "-i in.mp4 out.mp4" {
+		t.Errorf("caller arguments were modified: %v", args)
+	}
+}
+
+func TestQualityValidate(t *testing.T) {
+	for name, q := range QualityPresets {
+		if err := q.Validate(); err != nil {
+			t.Errorf("preset %s is invalid: %v", name, err)
+		}
+	}
+	if _, err := QualityPreset("vhs_480i"); err == nil {
+		t.Error("expected an error for an unknown preset")
+	}
+	for _, q := range []Quality{
+		{CRF: 60},
+		{CRF: 20, TargetBitrate: "4M"},
+		{TargetBitrate: "fast"},
+		{Width: 1080},
+	} {
+		if err := q.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", q)
+		}
+	}
+}
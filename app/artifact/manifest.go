@@ -0,0 +1,149 @@
+package artifact
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ManifestDir is where the artifact manifests of executions are written.
+var ManifestDir = filepath.Join("storage", "pipeline", "manifests")
+
+// ManifestEntry describes one artifact produced by an execution.
+type ManifestEntry struct {
+	StepID   string `json:"step_id"`
+	StepUUID string `json:"step_uuid"`
+	URI      string `json:"uri"`
+	MimeType string `json:"mime_type"`
+	SHA256   string `json:"sha256"`
+}
+
+// Origin links the artifacts of a regeneration run to the execution whose
+// artifact was regenerated.
+type Origin struct {
+	// ExecutionID is the execution the artifact was regenerated from
+	ExecutionID string `json:"execution_id"`
+	// OriginalExecutionID is the execution that produced the first version
+	OriginalExecutionID string `json:"original_execution_id"`
+	// ArtifactID is the step ID of the producing step
+	ArtifactID string `json:"artifact_id"`
+	Version    int    `json:"version"`
+}
+
+// NextVersion returns the origin of a new version of an artifact of m.
+func (m Manifest) NextVersion(artifactID string) Origin {
+	origin := Origin{ExecutionID: m.ExecutionID, OriginalExecutionID: m.ExecutionID, ArtifactID: artifactID, Version: 2}
+	if m.RegeneratedFrom != nil && m.RegeneratedFrom.ArtifactID == artifactID {
+		origin.OriginalExecutionID = m.RegeneratedFrom.OriginalExecutionID
+		origin.Version = m.RegeneratedFrom.Version + 1
+	}
+	return origin
+}
+
+// Entry returns the entry of the artifact produced by the step with the given
+// ID or UUID.
+func (m Manifest) Entry(artifactID string) (ManifestEntry, bool) {
+	for _, entry := range m.Artifacts {
+		if entry.StepID == artifactID || entry.StepUUID == artifactID {
+			return entry, true
+		}
+	}
+	return ManifestEntry{}, false
+}
+
+// Manifest lists the artifacts of an execution with their checksums. When a
+// signing key is configured it carries an Ed25519 signature over the unsigned
+// manifest, letting downstream consumers prove an artifact came from a given
+// execution.
+type Manifest struct {
+	ExecutionID    string          `json:"execution_id"`
+	PipelineID     string          `json:"pipeline_id"`
+	DefinitionHash string          `json:"definition_hash,omitempty"`
+	CreatedAt      string          `json:"created_at"`
+	Artifacts      []ManifestEntry `json:"artifacts"`
+	// RegeneratedFrom is set on the manifests of regeneration runs
+	RegeneratedFrom *Origin `json:"regenerated_from,omitempty"`
+	Signature       string  `json:"signature,omitempty"`
+	PublicKey       string  `json:"public_key,omitempty"`
+}
+
+// SigningPayload returns the canonical bytes that are signed: the JSON encoding
+// of the manifest without its signature fields.
+func (m Manifest) SigningPayload() ([]byte, error) {
+	m.Signature = ""
+	m.PublicKey = ""
+	return json.Marshal(m)
+}
+
+// Sign signs the manifest with an Ed25519 key.
+func (m *Manifest) Sign(key ed25519.PrivateKey) error {
+	payload, err := m.SigningPayload()
+	if err != nil {
+		return fmt.Errorf("error marshaling manifest: %w", err)
+	}
+	m.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload))
+	m.PublicKey = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	return nil
+}
+
+// Verify checks the manifest signature against a public key.
+func (m Manifest) Verify(publicKey ed25519.PublicKey) bool {
+	signature, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return false
+	}
+	payload, err := m.SigningPayload()
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(publicKey, payload, signature)
+}
+
+// ParseSigningKey decodes a base64 encoded Ed25519 seed (32 bytes) or private
+// key (64 bytes).
+func ParseSigningKey(encoded string) (ed25519.PrivateKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key encoding: %w", err)
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	default:
+		return nil, fmt.Errorf("invalid signing key length: %d bytes", len(raw))
+	}
+}
+
+// SaveManifest writes the manifest to ManifestDir.
+func SaveManifest(m *Manifest) error {
+	if err := os.MkdirAll(ManifestDir, 0755); err != nil {
+		return fmt.Errorf("failed to create manifest directory: %w", err)
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling manifest: %w", err)
+	}
+	path := filepath.Join(ManifestDir, filepath.Base(m.ExecutionID)+".json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// LoadManifest reads the manifest of an execution.
+func LoadManifest(executionID string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(ManifestDir, filepath.Base(executionID)+".json"))
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("error decoding manifest: %w", err)
+	}
+	return &m, nil
+}
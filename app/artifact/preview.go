@@ -0,0 +1,247 @@
+package artifact
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/serisow/lesocle/logging"
+	"github.com/serisow/lesocle/metrics"
+)
+
+const (
+	// ThumbnailMaxSize is the longest side, in pixels, of image and video thumbnails.
+	ThumbnailMaxSize = 320
+	// ClipDurationSeconds is the length of the low-res video preview clip.
+	ClipDurationSeconds = 5
+	waveformSize        = "640x120"
+)
+
+// Artifact is a media file produced by a step, as described by the JSON output
+// of the image and audio services ({"uri": ..., "mime_type": ...}).
+type Artifact struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mime_type"`
+	// SHA256 is the checksum reported by the producing service, if any.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// Preview is a small derived file stored alongside its artifact.
+type Preview struct {
+	URI      string `json:"uri"`
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+}
+
+// FromOutput extracts an image, video or audio artifact from a step output.
+func FromOutput(output interface{}) (Artifact, bool) {
+	var a Artifact
+	switch v := output.(type) {
+	case string:
+		if !strings.HasPrefix(strings.TrimSpace(v), "{") {
+			return a, false
+		}
+		if err := json.Unmarshal([]byte(v), &a); err != nil {
+			return a, false
+		}
+	case map[string]interface{}:
+		a.URI, _ = v["uri"].(string)
+		a.MimeType, _ = v["mime_type"].(string)
+		a.SHA256, _ = v["sha256"].(string)
+	default:
+		return a, false
+	}
+
+	if a.URI == "" || strings.Contains(a.URI, "://") {
+		return a, false
+	}
+	return a, a.Kind() != ""
+}
+
+// Kind returns "image", "video" or "audio", or "" for other artifacts.
+func (a Artifact) Kind() string {
+	for _, kind := range []string{"image", "video", "audio"} {
+		if strings.HasPrefix(a.MimeType, kind+"/") {
+			return kind
+		}
+	}
+	return ""
+}
+
+// GeneratePreviews creates the previews of an artifact next to the original file:
+// a JPEG thumbnail for images and videos, a 5 second low-res clip for videos and
+// a waveform PNG for audio. Image thumbnails are generated natively, the other
+// previews need ffmpeg on the PATH and are skipped without it.
+func GeneratePreviews(ctx context.Context, a Artifact) (map[string]Preview, error) {
+	previews := make(map[string]Preview)
+	base := strings.TrimSuffix(a.URI, filepath.Ext(a.URI))
+
+	switch a.Kind() {
+	case "image":
+		thumbnail := base + "_thumb.jpg"
+		if err := generateImageThumbnail(a.URI, thumbnail); err != nil {
+			return nil, fmt.Errorf("failed to generate thumbnail: %w", err)
+		}
+		previews["thumbnail"] = newPreview(thumbnail, "image/jpeg")
+
+	case "video":
+		if !FFmpegAvailable() {
+			return previews, nil
+		}
+		thumbnail := base + "_thumb.jpg"
+		err := runFFmpeg(ctx, "-y", "-i", a.URI, "-frames:v", "1",
+			"-vf", fmt.Sprintf("scale=%d:-2", ThumbnailMaxSize), thumbnail)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate thumbnail: %w", err)
+		}
+		previews["thumbnail"] = newPreview(thumbnail, "image/jpeg")
+
+		clip := base + "_preview.mp4"
+		args := []string{"-y", "-i", a.URI, "-t", fmt.Sprint(ClipDurationSeconds),
+			"-vf", fmt.Sprintf("scale=%d:-2", ThumbnailMaxSize)}
+		args = append(args, Encoder.x264Args()...)
+		err = runFFmpeg(ctx, append(args, "-crf", "32", "-an", clip)...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate preview clip: %w", err)
+		}
+		previews["clip"] = newPreview(clip, "video/mp4")
+
+	case "audio":
+		if !FFmpegAvailable() {
+			return previews, nil
+		}
+		waveform := base + "_waveform.png"
+		err := runFFmpeg(ctx, "-y", "-i", a.URI,
+			"-filter_complex", fmt.Sprintf("showwavespic=s=%s:colors=0x3b82f6", waveformSize),
+			"-frames:v", "1", waveform)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate waveform: %w", err)
+		}
+		previews["waveform"] = newPreview(waveform, "image/png")
+	}
+
+	return previews, nil
+}
+
+// FFmpegAvailable reports whether the ffmpeg binary can be found on the PATH.
+func FFmpegAvailable() bool {
+	_, err := exec.LookPath("ffmpeg")
+	return err == nil
+}
+
+func newPreview(path, mimeType string) Preview {
+	return Preview{
+		URI:      path,
+		URL:      "/" + filepath.ToSlash(path),
+		MimeType: mimeType,
+	}
+}
+
+var ffmpegRenderSeconds = metrics.NewHistogram("lesocle_ffmpeg_render_seconds",
+	"Duration of the ffmpeg runs.", nil, "status")
+
+// runFFmpeg runs ffmpeg, forwarding its progress to the live execution log when
+// ctx carries an execution scope.
+func runFFmpeg(ctx context.Context, args ...string) error {
+	cmd := Encoder.command(ctx, append([]string{"-hide_banner", "-loglevel", "error", "-stats"}, args...))
+
+	var stderr strings.Builder
+	var output io.Writer = &stderr
+	if executionID, stepID, ok := logging.ExecutionLogScope(ctx); ok {
+		output = io.MultiWriter(&stderr, logging.NewExecutionLogWriter(executionID, stepID, logging.FFmpegProgressFilter))
+	}
+	cmd.Stderr = output
+
+	started := time.Now()
+	err := cmd.Run()
+	status := "completed"
+	if err != nil {
+		status = "failed"
+	}
+	ffmpegRenderSeconds.Observe(time.Since(started).Seconds(), status)
+	if err != nil {
+		return fmt.Errorf("ffmpeg: %w: %s", err, lastLine(stderr.String()))
+	}
+	return nil
+}
+
+func lastLine(s string) string {
+	lines := strings.FieldsFunc(s, func(r rune) bool { return r == '\r' || r == '\n' })
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+func generateImageThumbnail(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	img, _, err := image.Decode(in)
+	if err != nil {
+		return fmt.Errorf("error decoding image: %w", err)
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if err := jpeg.Encode(out, resize(img, ThumbnailMaxSize), &jpeg.Options{Quality: 80}); err != nil {
+		os.Remove(dst)
+		return fmt.Errorf("error encoding thumbnail: %w", err)
+	}
+	return nil
+}
+
+// resize scales img down so its longest side is at most maxSize, averaging the
+// source pixels covered by each destination pixel.
+func resize(img image.Image, maxSize int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxSize && height <= maxSize {
+		return img
+	}
+
+	dstWidth, dstHeight := maxSize, height*maxSize/width
+	if height > width {
+		dstWidth, dstHeight = width*maxSize/height, maxSize
+	}
+	dstWidth, dstHeight = max(dstWidth, 1), max(dstHeight, 1)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		y0 := bounds.Min.Y + y*height/dstHeight
+		y1 := max(bounds.Min.Y+(y+1)*height/dstHeight, y0+1)
+		for x := 0; x < dstWidth; x++ {
+			x0 := bounds.Min.X + x*width/dstWidth
+			x1 := max(bounds.Min.X+(x+1)*width/dstWidth, x0+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(b / n), uint16(a / n)})
+		}
+	}
+	return dst
+}
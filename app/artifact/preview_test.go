@@ -0,0 +1,124 @@
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFromOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		output interface{}
+		want   bool
+	}{
+		{"image json", `{"uri":"storage/pipeline/images/2024-01/img.png","mime_type":"image/png"}`, true},
+		{"audio map", map[string]interface{}{"uri": "storage/a.mp3", "mime_type": "audio/mpeg"}, true},
+		{"remote uri", `{"uri":"https://example.com/img.png","mime_type":"image/png"}`, false},
+		{"text output", "Hello world", false},
+		{"not media", `{"uri":"storage/doc.pdf","mime_type":"application/pdf"}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, got := FromOutput(tt.output); got != tt.want {
+				t.Errorf("FromOutput() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeneratePreviewsImageThumbnail(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "gemini_img_1.png")
+	img := image.NewRGBA(image.Rect(0, 0, 1024, 512))
+	for x := 0; x < 1024; x++ {
+		for y := 0; y < 512; y++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	output := fmt.Sprintf(`{"uri":%q,"mime_type":"image/png"}`, src)
+	a, ok := FromOutput(output)
+	if !ok {
+		t.Fatal("expected image artifact")
+	}
+
+	previews, err := GeneratePreviews(context.Background(), a)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	thumbnail, ok := previews["thumbnail"]
+	if !ok {
+		t.Fatalf("expected thumbnail preview, got %+v", previews)
+	}
+
+	tf, err := os.Open(thumbnail.URI)
+	if err != nil {
+		t.Fatalf("thumbnail not written: %v", err)
+	}
+	defer tf.Close()
+
+	cfg, err := jpeg.DecodeConfig(tf)
+	if err != nil {
+		t.Fatalf("thumbnail is not a JPEG: %v", err)
+	}
+	if cfg.Width != ThumbnailMaxSize || cfg.Height != ThumbnailMaxSize/2 {
+		t.Errorf("expected %dx%d thumbnail, got %dx%d", ThumbnailMaxSize, ThumbnailMaxSize/2, cfg.Width, cfg.Height)
+	}
+}
+
+func TestEmbedProvenanceKeepsImagesDecodable(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	dir := t.TempDir()
+
+	var pngData, jpegData bytes.Buffer
+	png.Encode(&pngData, img)
+	jpeg.Encode(&jpegData, img, nil)
+
+	files := map[string][]byte{
+		"image/png":  pngData.Bytes(),
+		"image/jpeg": jpegData.Bytes(),
+	}
+
+	for mimeType, data := range files {
+		path := filepath.Join(dir, "img_"+filepath.Base(mimeType))
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		embedded, err := EmbedProvenance(context.Background(), Artifact{URI: path, MimeType: mimeType}, Provenance{
+			Generator:   Generator,
+			Model:       "gpt-image-1",
+			ExecutionID: "exec-1",
+			CreatedAt:   time.Now(),
+		})
+		if err != nil || !embedded {
+			t.Fatalf("%s: expected provenance to be embedded, got %v", mimeType, err)
+		}
+
+		updated, _ := os.ReadFile(path)
+		if !bytes.Contains(updated, []byte(iptcTrainedAlgorithmicMedia)) {
+			t.Errorf("%s: digital source type not found in file", mimeType)
+		}
+		if _, _, err := image.Decode(bytes.NewReader(updated)); err != nil {
+			t.Errorf("%s: image no longer decodes: %v", mimeType, err)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"html"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Generator identifies this service in the provenance metadata.
+const Generator = "lesocle"
+
+// iptcTrainedAlgorithmicMedia is the IPTC digital source type platforms look
+// for to label fully AI-generated media.
+const iptcTrainedAlgorithmicMedia = "http://cv.iptc.org/newscodes/digitalsourcetype/trainedAlgorithmicMedia"
+
+// Provenance describes how an artifact was produced.
+type Provenance struct {
+	Generator   string    `json:"generator"`
+	Service     string    `json:"service,omitempty"`
+	Model       string    `json:"model,omitempty"`
+	PipelineID  string    `json:"pipeline_id"`
+	ExecutionID string    `json:"execution_id"`
+	StepID      string    `json:"step_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// EmbedProvenance writes the provenance into the artifact file, as XMP for PNG
+// and JPEG images (with the IPTC "trainedAlgorithmicMedia" source type) and as
+// container metadata for videos, which needs ffmpeg. Other formats are left
+// untouched. A full C2PA manifest requires a certificate chain we don't have,
+// so the XMP labelling is what platforms get for now.
+func EmbedProvenance(ctx context.Context, a Artifact, p Provenance) (bool, error) {
+	switch {
+	case a.MimeType == "image/png":
+		return true, rewriteFile(a.URI, func(data []byte) ([]byte, error) {
+			return embedPNGXMP(data, provenanceXMP(p))
+		})
+	case a.MimeType == "image/jpeg":
+		return true, rewriteFile(a.URI, func(data []byte) ([]byte, error) {
+			return embedJPEGXMP(data, provenanceXMP(p))
+		})
+	case a.Kind() == "video":
+		if !FFmpegAvailable() {
+			return false, nil
+		}
+		return true, embedVideoMetadata(ctx, a.URI, p)
+	}
+	return false, nil
+}
+
+func rewriteFile(path string, transform func([]byte) ([]byte, error)) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	updated, err := transform(data)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, updated, 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+func provenanceXMP(p Provenance) string {
+	description, _ := json.Marshal(p)
+	return `<?xpacket begin="` + "\ufeff" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>` +
+		`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+		`<rdf:Description rdf:about="" xmlns:Iptc4xmpExt="http://iptc.org/std/Iptc4xmpExt/2008-02-29/"` +
+		` xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/">` +
+		`<Iptc4xmpExt:DigitalSourceType>` + iptcTrainedAlgorithmicMedia + `</Iptc4xmpExt:DigitalSourceType>` +
+		`<xmp:CreatorTool>` + html.EscapeString(strings.TrimSpace(p.Generator+" "+p.Model)) + `</xmp:CreatorTool>` +
+		`<xmp:CreateDate>` + p.CreatedAt.UTC().Format(time.RFC3339) + `</xmp:CreateDate>` +
+		`<dc:description><rdf:Alt><rdf:li xml:lang="x-default">` + html.EscapeString(string(description)) + `</rdf:li></rdf:Alt></dc:description>` +
+		`</rdf:Description></rdf:RDF></x:xmpmeta><?xpacket end="w"?>`
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// embedPNGXMP inserts an iTXt chunk carrying the XMP packet right after IHDR.
+func embedPNGXMP(data []byte, xmp string) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) || len(data) < len(pngSignature)+8 {
+		return nil, errors.New("not a PNG file")
+	}
+	ihdrLength := binary.BigEndian.Uint32(data[8:12])
+	ihdrEnd := len(pngSignature) + 12 + int(ihdrLength)
+	if string(data[12:16]) != "IHDR" || ihdrEnd > len(data) {
+		return nil, errors.New("invalid PNG header")
+	}
+
+	// keyword, null separator, compression flag and method, empty language tag and translated keyword
+	var payload bytes.Buffer
+	payload.WriteString("XML:com.adobe.xmp")
+	payload.Write([]byte{0, 0, 0, 0, 0})
+	payload.WriteString(xmp)
+
+	chunk := make([]byte, 0, payload.Len()+12)
+	chunk = binary.BigEndian.AppendUint32(chunk, uint32(payload.Len()))
+	chunk = append(chunk, "iTXt"...)
+	chunk = append(chunk, payload.Bytes()...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	out := make([]byte, 0, len(data)+len(chunk))
+	out = append(out, data[:ihdrEnd]...)
+	out = append(out, chunk...)
+	return append(out, data[ihdrEnd:]...), nil
+}
+
+const jpegXMPNamespace = "http://ns.adobe.com/xap/1.0/\x00"
+
+// embedJPEGXMP inserts an APP1 XMP segment after the SOI and JFIF markers.
+func embedJPEGXMP(data []byte, xmp string) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, errors.New("not a JPEG file")
+	}
+
+	segmentLength := 2 + len(jpegXMPNamespace) + len(xmp)
+	if segmentLength > 0xFFFF {
+		return nil, errors.New("XMP packet too large for a JPEG segment")
+	}
+
+	insertAt := 2
+	if data[2] == 0xFF && data[3] == 0xE0 && len(data) >= 6 {
+		insertAt = 4 + int(binary.BigEndian.Uint16(data[4:6]))
+		if insertAt > len(data) {
+			return nil, errors.New("invalid JPEG APP0 segment")
+		}
+	}
+
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(segmentLength))
+	segment = append(segment, jpegXMPNamespace...)
+	segment = append(segment, xmp...)
+
+	out := make([]byte, 0, len(data)+len(segment))
+	out = append(out, data[:insertAt]...)
+	out = append(out, segment...)
+	return append(out, data[insertAt:]...), nil
+}
+
+func embedVideoMetadata(ctx context.Context, path string, p Provenance) error {
+	description, _ := json.Marshal(p)
+	tmp := strings.TrimSuffix(path, filepath.Ext(path)) + ".provenance" + filepath.Ext(path)
+
+	args := []string{"-y", "-i", path, "-map", "0", "-c", "copy",
+		"-metadata", "comment=" + string(description),
+		"-metadata", "encoded_by=" + strings.TrimSpace(p.Generator+" "+p.Model),
+		"-metadata", "creation_time=" + p.CreatedAt.UTC().Format(time.RFC3339)}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp4", ".mov", ".m4v":
+		// Keep custom tags in MP4/MOV containers
+		args = append(args, "-movflags", "use_metadata_tags")
+	}
+
+	if err := runFFmpeg(ctx, append(args, tmp)...); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,242 @@
+package artifact
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Placeholders of the files of a RenderJob in its commands. They are replaced
+// by paths on the machine running ffmpeg.
+const (
+	inputPlaceholder  = "{input:%d}"
+	outputPlaceholder = "{output:%d}"
+	// WorkDirPlaceholder is a scratch directory shared by the commands of a
+	// job, e.g. for the statistics of a two-pass encode.
+	WorkDirPlaceholder = "{workdir}"
+)
+
+// ErrRemoteRender is returned when the render worker rejected or failed a job.
+var ErrRemoteRender = errors.New("remote render failed")
+
+// RenderJob is a sequence of ffmpeg commands reading Inputs and writing
+// Outputs, local files referred to in the commands as InputRef(i) and
+// OutputRef(i).
+type RenderJob struct {
+	Commands [][]string
+	Inputs   []string
+	Outputs  []string
+}
+
+// InputRef is the placeholder of the i-th input of a job.
+func InputRef(i int) string {
+	return fmt.Sprintf(inputPlaceholder, i)
+}
+
+// OutputRef is the placeholder of the i-th output of a job.
+func OutputRef(i int) string {
+	return fmt.Sprintf(outputPlaceholder, i)
+}
+
+// resolve replaces the placeholders of the commands with actual paths.
+func (j RenderJob) resolve(inputs, outputs []string, workDir string) [][]string {
+	replacements := []string{WorkDirPlaceholder, workDir}
+	for i, path := range inputs {
+		replacements = append(replacements, InputRef(i), path)
+	}
+	for i, path := range outputs {
+		replacements = append(replacements, OutputRef(i), path)
+	}
+	replacer := strings.NewReplacer(replacements...)
+
+	commands := make([][]string, len(j.Commands))
+	for i, command := range j.Commands {
+		commands[i] = make([]string, len(command))
+		for k, arg := range command {
+			commands[i][k] = replacer.Replace(arg)
+		}
+	}
+	return commands
+}
+
+// Renderer runs the heavy ffmpeg jobs, the encodes, locally or on a render
+// worker.
+type Renderer interface {
+	Render(ctx context.Context, job RenderJob) error
+}
+
+// DefaultRenderer runs the encodes of the service. main replaces it with a
+// RemoteRenderer when a render worker is configured.
+var DefaultRenderer Renderer = LocalRenderer{}
+
+// LocalRenderer runs ffmpeg on this machine with the Encoder settings.
+type LocalRenderer struct{}
+
+// Render implements Renderer.
+func (LocalRenderer) Render(ctx context.Context, job RenderJob) error {
+	if !FFmpegAvailable() {
+		return fmt.Errorf("ffmpeg is not available")
+	}
+	workDir, err := os.MkdirTemp("", "render")
+	if err != nil {
+		return fmt.Errorf("failed to create render directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	for i, command := range job.resolve(job.Inputs, job.Outputs, workDir) {
+		if err := runFFmpeg(ctx, command...); err != nil {
+			return fmt.Errorf("command %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// RemoteRenderer ships the inputs of a job to a render worker and downloads
+// the outputs, so API nodes don't need the CPU or GPU for the encodes.
+//
+// The job is a multipart POST to URL with a "job" field, the JSON
+// {"commands": [[...]], "outputs": n} with the placeholders kept, and an
+// "input_<i>" file per input. The worker answers once done with
+// {"outputs": ["<url>", ...]}, URLs possibly relative to URL.
+type RemoteRenderer struct {
+	URL    string
+	Token  string
+	Client *http.Client
+}
+
+// Render implements Renderer.
+func (r *RemoteRenderer) Render(ctx context.Context, job RenderJob) error {
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	spec, err := json.Marshal(map[string]interface{}{
+		"commands": job.Commands,
+		"outputs":  len(job.Outputs),
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling render job: %w", err)
+	}
+
+	// Stream the inputs, they can be large videos
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		writer.CloseWithError(writeRenderForm(form, spec, job.Inputs))
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL, body)
+	if err != nil {
+		body.Close()
+		return fmt.Errorf("error creating render request: %w", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	r.authorize(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRemoteRender, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%w: status %d: %s", ErrRemoteRender, resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	var result struct {
+		Outputs []string `json:"outputs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("%w: invalid response: %v", ErrRemoteRender, err)
+	}
+	if len(result.Outputs) != len(job.Outputs) {
+		return fmt.Errorf("%w: expected %d outputs, got %d", ErrRemoteRender, len(job.Outputs), len(result.Outputs))
+	}
+
+	for i, output := range result.Outputs {
+		if err := r.download(ctx, client, output, job.Outputs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeRenderForm(form *multipart.Writer, spec []byte, inputs []string) error {
+	if err := form.WriteField("job", string(spec)); err != nil {
+		return err
+	}
+	for i, path := range inputs {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open render input: %w", err)
+		}
+		part, err := form.CreateFormFile("input_"+strconv.Itoa(i), filepath.Base(path))
+		if err == nil {
+			_, err = io.Copy(part, file)
+		}
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("failed to send render input %s: %w", path, err)
+		}
+	}
+	return form.Close()
+}
+
+// download fetches an output of the worker to path, replacing it only once
+// complete.
+func (r *RemoteRenderer) download(ctx context.Context, client *http.Client, output, path string) error {
+	base, err := url.Parse(r.URL)
+	if err != nil {
+		return fmt.Errorf("invalid render worker URL: %w", err)
+	}
+	ref, err := url.Parse(output)
+	if err != nil {
+		return fmt.Errorf("%w: invalid output URL %q", ErrRemoteRender, output)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base.ResolveReference(ref).String(), nil)
+	if err != nil {
+		return fmt.Errorf("error creating download request: %w", err)
+	}
+	r.authorize(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: downloading output: %v", ErrRemoteRender, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: downloading output: status %d", ErrRemoteRender, resp.StatusCode)
+	}
+
+	tmp := path + ".part"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create render output: %w", err)
+	}
+	_, err = io.Copy(file, resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to download render output: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+func (r *RemoteRenderer) authorize(req *http.Request) {
+	if r.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.Token)
+	}
+}
@@ -0,0 +1,84 @@
+package artifact
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRenderJobResolve(t *testing.T) {
+	job := RenderJob{Commands: [][]string{
+		{"-i", InputRef(0), "-passlogfile", WorkDirPlaceholder + "/2pass", OutputRef(0)},
+	}}
+	got := job.resolve([]string{"in.mp4"}, []string{"out.mp4"}, "/tmp/work")
+	expected := [][]string{{"-i", "in.mp4", "-passlogfile", "/tmp/work/2pass", "out.mp4"}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestRemoteRenderer(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "in.mp4")
+	dst := filepath.Join(dir, "out.mp4")
+	os.WriteFile(src, []byte("source video"), 0644)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/render", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var spec struct {
+			Commands [][]string `json:"commands"`
+			Outputs  int        `json:"outputs"`
+		}
+		if err := json.Unmarshal([]byte(r.FormValue("job")), &spec); err != nil || spec.Outputs != 1 {
+			http.Error(w, "bad job", http.StatusBadRequest)
+			return
+		}
+		if spec.Commands[0][1] != InputRef(0) {
+			t.Errorf("expected placeholders to be sent, got %v", spec.Commands)
+		}
+		file, _, err := r.FormFile("input_0")
+		if err != nil {
+			http.Error(w, "missing input", http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(file)
+		if string(data) != "source video" {
+			t.Errorf("unexpected input %q", data)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"outputs": []string{"outputs/1.mp4"}})
+	})
+	mux.HandleFunc("/outputs/1.mp4", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("encoded video"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	renderer := &RemoteRenderer{URL: server.URL + "/render", Token: "secret"}
+	job := RenderJob{
+		Commands: [][]string{{"-i", InputRef(0), OutputRef(0)}},
+		Inputs:   []string{src},
+		Outputs:  []string{dst},
+	}
+	if err := renderer.Render(context.Background(), job); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "encoded video" {
+		t.Errorf("expected the output to be downloaded, got %q", data)
+	}
+
+	renderer.Token = "wrong"
+	if err := renderer.Render(context.Background(), job); !errors.Is(err, ErrRemoteRender) {
+		t.Errorf("expected ErrRemoteRender, got %v", err)
+	}
+}
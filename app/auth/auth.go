@@ -0,0 +1,156 @@
+// Package auth authenticates the requests of the HTTP API, with API keys or
+// JWT bearer tokens.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// APIKeyHeader carries the API key of a request.
+const APIKeyHeader = "X-API-Key"
+
+// Config holds the accepted credentials. Authentication is disabled when
+// neither API keys nor a JWT secret are set.
+type Config struct {
+	APIKeys []string
+	// HMAC secret of the HS256 tokens
+	JWTSecret string
+	// Audience the tokens must be issued for, not checked when empty
+	JWTAudience string
+}
+
+// ParseAPIKeys reads a comma separated list of keys.
+func ParseAPIKeys(value string) []string {
+	var keys []string
+	for _, key := range strings.Split(value, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Middleware is a Negroni middleware rejecting the requests without valid
+// credentials, except the ones to public routes.
+type Middleware struct {
+	apiKeys   [][sha256.Size]byte
+	jwtSecret []byte
+	audience  string
+	isPublic  func(*http.Request) bool
+	now       func() time.Time
+}
+
+// New creates the middleware. isPublic reports whether a request is to a
+// route reachable without credentials, it may be nil.
+func New(cfg Config, isPublic func(*http.Request) bool) *Middleware {
+	m := &Middleware{
+		jwtSecret: []byte(cfg.JWTSecret),
+		audience:  cfg.JWTAudience,
+		isPublic:  isPublic,
+		now:       time.Now,
+	}
+	// Comparing digests keeps the comparison constant time whatever the key lengths
+	for _, key := range cfg.APIKeys {
+		m.apiKeys = append(m.apiKeys, sha256.Sum256([]byte(key)))
+	}
+	return m
+}
+
+// Enabled reports whether credentials are configured.
+func (m *Middleware) Enabled() bool {
+	return len(m.apiKeys) > 0 || len(m.jwtSecret) > 0
+}
+
+// ServeHTTP implements negroni.Handler.
+func (m *Middleware) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if !m.Enabled() || (m.isPublic != nil && m.isPublic(r)) {
+		next(w, r)
+		return
+	}
+
+	principal, ok := m.authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="lesocle"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	next(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+}
+
+// authenticate returns who the request is from, "api-key" for API keys and
+// the subject of the token for JWTs.
+func (m *Middleware) authenticate(r *http.Request) (string, bool) {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return "api-key", m.validAPIKey(key)
+	}
+
+	token := bearerToken(r)
+	if token == "" {
+		return "", false
+	}
+	// Browsers' EventSource and WebSocket can't send headers, so the streams
+	// take the token as a query parameter, it may be an API key as well
+	if m.validAPIKey(token) {
+		return "api-key", true
+	}
+	if len(m.jwtSecret) == 0 {
+		return "", false
+	}
+	claims, err := verifyJWT(token, m.jwtSecret, m.audience, m.now())
+	if err != nil {
+		return "", false
+	}
+	return claims.Subject, true
+}
+
+func (m *Middleware) validAPIKey(key string) bool {
+	digest := sha256.Sum256([]byte(key))
+	valid := 0
+	for _, accepted := range m.apiKeys {
+		valid |= subtle.ConstantTimeCompare(digest[:], accepted[:])
+	}
+	return valid == 1
+}
+
+// streamPathSuffixes end the paths of the log and progress streams, the only
+// routes taking the token as a query parameter: URLs end up in proxy and
+// access logs.
+var streamPathSuffixes = []string{"/logs/ws", "/logs/stream", "/progress/ws"}
+
+func isStreamRequest(r *http.Request) bool {
+	for _, suffix := range streamPathSuffixes {
+		if strings.HasSuffix(r.URL.Path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// bearerToken returns the token of the Authorization header or, for the
+// streams, of the access_token query parameter.
+func bearerToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return ""
+		}
+		return strings.TrimSpace(token)
+	}
+	if !isStreamRequest(r) {
+		return ""
+	}
+	return r.URL.Query().Get("access_token")
+}
+
+type principalKey struct{}
+
+// Principal returns who an authenticated request is from.
+func Principal(ctx context.Context) (string, bool) {
+	principal, ok := ctx.Value(principalKey{}).(string)
+	return principal, ok
+}
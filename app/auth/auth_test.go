@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func signJWT(t *testing.T, secret string, claims map[string]interface{}) string {
+	t.Helper()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestMiddleware(t *testing.T) {
+	m := New(Config{APIKeys: []string{"key-1", "key-2"}, JWTSecret: "secret", JWTAudience: "lesocle"},
+		func(r *http.Request) bool { return r.URL.Path == "/healthz" })
+	exp := time.Now().Add(time.Hour).Unix()
+
+	tests := []struct {
+		name      string
+		path      string
+		headers   map[string]string
+		wantCode  int
+		principal string
+	}{
+		{name: "public route", path: "/healthz", wantCode: http.StatusOK},
+		{name: "no credentials", path: "/pipelines/sla", wantCode: http.StatusUnauthorized},
+		{name: "api key", path: "/pipelines/sla", headers: map[string]string{APIKeyHeader: "key-2"}, wantCode: http.StatusOK, principal: "api-key"},
+		{name: "wrong api key", path: "/pipelines/sla", headers: map[string]string{APIKeyHeader: "key-3"}, wantCode: http.StatusUnauthorized},
+		{name: "jwt", path: "/pipelines/sla", headers: map[string]string{
+			"Authorization": "Bearer " + signJWT(t, "secret", map[string]interface{}{"sub": "drupal", "aud": "lesocle", "exp": exp}),
+		}, wantCode: http.StatusOK, principal: "drupal"},
+		{name: "jwt in query", path: "/executions/1/logs/stream?access_token=" + signJWT(t, "secret", map[string]interface{}{"sub": "ui", "aud": []string{"lesocle"}, "exp": exp}),
+			wantCode: http.StatusOK, principal: "ui"},
+		{name: "jwt in query of a progress stream", path: "/executions/1/progress/ws?access_token=" + signJWT(t, "secret", map[string]interface{}{"sub": "ui", "aud": "lesocle", "exp": exp}),
+			wantCode: http.StatusOK, principal: "ui"},
+		{name: "api key in query of a log socket", path: "/pipeline/p/execution/1/logs/ws?access_token=key-1", wantCode: http.StatusOK, principal: "api-key"},
+		{name: "jwt in query of another route", path: "/pipelines/sla?access_token=" + signJWT(t, "secret", map[string]interface{}{"sub": "ui", "aud": "lesocle", "exp": exp}),
+			wantCode: http.StatusUnauthorized},
+		{name: "api key in query of another route", path: "/pipeline/p/execute?access_token=key-1", wantCode: http.StatusUnauthorized},
+		{name: "jwt badly signed", path: "/pipelines/sla", headers: map[string]string{
+			"Authorization": "Bearer " + signJWT(t, "other", map[string]interface{}{"sub": "drupal", "aud": "lesocle", "exp": exp}),
+		}, wantCode: http.StatusUnauthorized},
+		{name: "jwt expired", path: "/pipelines/sla", headers: map[string]string{
+			"Authorization": "Bearer " + signJWT(t, "secret", map[string]interface{}{"sub": "drupal", "aud": "lesocle", "exp": time.Now().Add(-time.Minute).Unix()}),
+		}, wantCode: http.StatusUnauthorized},
+		{name: "jwt wrong audience", path: "/pipelines/sla", headers: map[string]string{
+			"Authorization": "Bearer " + signJWT(t, "secret", map[string]interface{}{"sub": "drupal", "aud": "other", "exp": exp}),
+		}, wantCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			var principal string
+			m.ServeHTTP(rec, req, func(w http.ResponseWriter, r *http.Request) {
+				principal, _ = Principal(r.Context())
+			})
+			if rec.Code != tt.wantCode {
+				t.Fatalf("expected status %d, got %d", tt.wantCode, rec.Code)
+			}
+			if principal != tt.principal {
+				t.Errorf("expected principal %q, got %q", tt.principal, principal)
+			}
+		})
+	}
+}
+
+func TestMiddlewareDisabledWithoutCredentials(t *testing.T) {
+	m := New(Config{APIKeys: ParseAPIKeys(" , ")}, nil)
+	if m.Enabled() {
+		t.Fatal("expected the middleware disabled")
+	}
+	called := false
+	m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/pipelines/sla", nil), func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+	if !called {
+		t.Error("expected the request to go through")
+	}
+}
@@ -0,0 +1,173 @@
+// Package client calls the HTTP API of the pipeline service, with the request
+// and response types the server uses, for the dashboards and the tools
+// written in Go. The TypeScript client, ts/lesocle.ts, is generated from the
+// OpenAPI document, other languages can generate theirs from /openapi.json.
+package client
+
+//go:generate go run ts/generate.go ts/lesocle.ts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/serisow/lesocle/api"
+	"github.com/serisow/lesocle/artifact"
+)
+
+// Client calls one service instance.
+type Client struct {
+	BaseURL string
+	// Sent in X-API-Key when set
+	APIKey string
+	// Sent as a bearer token when set, instead of the API key
+	Token      string
+	HTTPClient *http.Client
+}
+
+// New creates a client of the service at baseURL, authenticated with an API key.
+func New(baseURL, apiKey string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), APIKey: apiKey, HTTPClient: http.DefaultClient}
+}
+
+// Error is a response with an error status.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("lesocle API error %d: %s", e.StatusCode, e.Message)
+}
+
+// ExecutePipeline starts an on-demand execution of a pipeline.
+func (c *Client) ExecutePipeline(ctx context.Context, pipelineID string, req api.ExecuteRequest) (api.ExecutionAccepted, error) {
+	var accepted api.ExecutionAccepted
+	err := c.do(ctx, http.MethodPost, "/pipeline/"+url.PathEscape(pipelineID)+"/execute", req, &accepted)
+	return accepted, err
+}
+
+// ExecutionStatus returns the status of an execution.
+func (c *Client) ExecutionStatus(ctx context.Context, pipelineID, executionID string) (api.ExecutionStatus, error) {
+	var status api.ExecutionStatus
+	err := c.do(ctx, http.MethodGet, executionPath(pipelineID, executionID)+"/status", nil, &status)
+	return status, err
+}
+
+// ExecutionResults returns the results of a completed execution. An execution
+// still running answers an *Error with status 202.
+func (c *Client) ExecutionResults(ctx context.Context, pipelineID, executionID string) (api.ExecutionResults, error) {
+	var results api.ExecutionResults
+	err := c.do(ctx, http.MethodGet, executionPath(pipelineID, executionID)+"/results", nil, &results)
+	return results, err
+}
+
+// ArtifactManifest returns the artifact manifest of an execution.
+func (c *Client) ArtifactManifest(ctx context.Context, pipelineID, executionID string) (artifact.Manifest, error) {
+	var manifest artifact.Manifest
+	err := c.do(ctx, http.MethodGet, executionPath(pipelineID, executionID)+"/manifest", nil, &manifest)
+	return manifest, err
+}
+
+// RegenerateArtifact produces a new version of an artifact of an execution.
+func (c *Client) RegenerateArtifact(ctx context.Context, executionID, artifactID string, parameters map[string]interface{}) (api.ExecutionAccepted, error) {
+	var accepted api.ExecutionAccepted
+	path := "/executions/" + url.PathEscape(executionID) + "/artifacts/" + url.PathEscape(artifactID) + "/regenerate"
+	err := c.do(ctx, http.MethodPost, path, api.RegenerateRequest{Parameters: parameters}, &accepted)
+	return accepted, err
+}
+
+// RunPipelineNow runs a scheduled pipeline outside of its schedule.
+func (c *Client) RunPipelineNow(ctx context.Context, pipelineID string) (api.ExecutionAccepted, error) {
+	var accepted api.ExecutionAccepted
+	err := c.do(ctx, http.MethodPost, "/pipelines/"+url.PathEscape(pipelineID)+"/run", nil, &accepted)
+	return accepted, err
+}
+
+// SetMaintenance turns maintenance mode on or off.
+func (c *Client) SetMaintenance(ctx context.Context, enabled bool, reason string) (api.Switch, error) {
+	var state api.Switch
+	err := c.do(ctx, http.MethodPut, "/maintenance", api.SwitchRequest{Enabled: &enabled, Reason: reason}, &state)
+	return state, err
+}
+
+// SetPipelineEnabled switches a pipeline on or off.
+func (c *Client) SetPipelineEnabled(ctx context.Context, pipelineID string, enabled bool, reason string) (api.PipelineSwitch, error) {
+	var state api.PipelineSwitch
+	err := c.do(ctx, http.MethodPut, "/pipeline/"+url.PathEscape(pipelineID)+"/enabled", api.SwitchRequest{Enabled: &enabled, Reason: reason}, &state)
+	return state, err
+}
+
+// PauseSchedule stops the scheduler from starting a pipeline.
+func (c *Client) PauseSchedule(ctx context.Context, pipelineID, reason string) (api.ScheduleState, error) {
+	var state api.ScheduleState
+	err := c.do(ctx, http.MethodPost, "/pipeline/"+url.PathEscape(pipelineID)+"/schedule/pause", api.ScheduleRequest{Reason: reason}, &state)
+	return state, err
+}
+
+// ResumeSchedule lets the scheduler start a pipeline again.
+func (c *Client) ResumeSchedule(ctx context.Context, pipelineID, reason string) (api.ScheduleState, error) {
+	var state api.ScheduleState
+	err := c.do(ctx, http.MethodPost, "/pipeline/"+url.PathEscape(pipelineID)+"/schedule/resume", api.ScheduleRequest{Reason: reason}, &state)
+	return state, err
+}
+
+func executionPath(pipelineID, executionID string) string {
+	return "/pipeline/" + url.PathEscape(pipelineID) + "/execution/" + url.PathEscape(executionID)
+}
+
+// do sends body as JSON, when not nil, and decodes the response into out.
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	switch {
+	case c.Token != "":
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	case c.APIKey != "":
+		req.Header.Set("X-API-Key", c.APIKey)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Handlers answer errors with http.Error, as plain text, and "not
+	// completed yet" results with a 202
+	if resp.StatusCode >= 300 || (resp.StatusCode == http.StatusAccepted && resp.Header.Get("Content-Type") != "application/json") {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding %s %s response: %w", method, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/serisow/lesocle/api"
+)
+
+func TestExecutePipeline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/pipeline/daily/execute" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("X-API-Key") != "key" {
+			t.Errorf("expected the API key sent, got %q", r.Header.Get("X-API-Key"))
+		}
+		var req api.ExecuteRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(api.ExecutionAccepted{ExecutionID: "exec-1", PipelineID: "daily", Status: "started", UserInput: req.UserInput})
+	}))
+	defer srv.Close()
+
+	accepted, err := New(srv.URL+"/", "key").ExecutePipeline(context.Background(), "daily", api.ExecuteRequest{UserInput: "hello"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if accepted.ExecutionID != "exec-1" || accepted.UserInput != "hello" {
+		t.Errorf("unexpected response %+v", accepted)
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/pipeline/daily/execution/exec-1/results" {
+			http.Error(w, "Execution not completed yet", http.StatusAccepted)
+			return
+		}
+		http.Error(w, "Execution ID not found", http.StatusNotFound)
+	}))
+	defer srv.Close()
+	c := New(srv.URL, "")
+
+	var apiErr *Error
+	_, err := c.ExecutionStatus(context.Background(), "daily", "missing")
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "Execution ID not found" {
+		t.Errorf("expected a 404 error, got %v", err)
+	}
+	_, err = c.ExecutionResults(context.Background(), "daily", "exec-1")
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusAccepted {
+		t.Errorf("expected the running execution reported, got %v", err)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build ignore
+
+// generate writes the TypeScript client of the API, for the dashboards and the
+// Drupal module front end, from the OpenAPI document of the routes.
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/serisow/lesocle/openapi"
+	"github.com/serisow/lesocle/plugin_registry"
+	"github.com/serisow/lesocle/server"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("usage: go run generate.go <output file>")
+	}
+	router := server.SetupRoutes("", "", plugin_registry.NewPluginRegistry())
+	if err := os.WriteFile(os.Args[1], openapi.TypeScript(server.Document(router)), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
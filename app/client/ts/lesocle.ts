@@ -0,0 +1,776 @@
+// Code generated from the OpenAPI document of Lesocle pipeline API 1.0.0. DO NOT EDIT.
+
+export interface ApiBatchItem {
+  error_message?: string;
+  execution_id: string;
+  index: number;
+  links: Record<string, string>;
+  status: string;
+}
+
+export interface ApiBatchStatus {
+  batch_id: string;
+  counts: Record<string, number>;
+  created_at: string;
+  items: ApiBatchItem[];
+  pipeline_id: string;
+  status: string;
+}
+
+export interface ApiBulkExecuteRequest {
+  items: Array<Record<string, unknown>>;
+}
+
+export interface ApiExecuteRequest {
+  callback_url?: string;
+  sandbox?: boolean;
+  user_input: string;
+}
+
+export interface ApiExecutionAccepted {
+  execution_id: string;
+  links: Record<string, string>;
+  pipeline_id: string;
+  redrive_of?: string;
+  regenerated_from?: ArtifactOrigin;
+  rerun_of?: string;
+  rerun_steps?: string[];
+  sandbox: boolean;
+  skip_steps?: string[];
+  snapshot_of?: string;
+  status: string;
+  step_id?: string;
+  submitted_at: string;
+  user_input: string;
+}
+
+export interface ApiExecutionCost {
+  currency: string;
+  steps: Record<string, number>;
+  total: number;
+  unpriced_models?: string[];
+}
+
+export interface ApiExecutionResults {
+  completed_at: string;
+  cost?: ApiExecutionCost;
+  execution_id: string;
+  results: Record<string, unknown>;
+  status: string;
+}
+
+export interface ApiExecutionStatus {
+  completed_at: string;
+  cost?: ApiExecutionCost;
+  execution_id: string;
+  status: string;
+  submitted_at: string;
+}
+
+export interface ApiPipelineSwitch {
+  enabled: boolean;
+  pipeline_id: string;
+  reason: string;
+}
+
+export interface ApiRedriveRequest {
+  resume: boolean;
+}
+
+export interface ApiRegenerateRequest {
+  parameters: Record<string, unknown>;
+}
+
+export interface ApiRerunRequest {
+  pinned_outputs: Record<string, unknown>;
+  skip_steps: string[];
+  user_input?: string | null;
+}
+
+export interface ApiScheduleRequest {
+  reason: string;
+}
+
+export interface ApiScheduleState {
+  paused: boolean;
+  pipeline_id: string;
+  reason: string;
+}
+
+export interface ApiStepRequest {
+  step_outputs: Record<string, unknown>;
+}
+
+export interface ApiSwitch {
+  enabled: boolean;
+  reason?: string;
+  updated_at?: string;
+}
+
+export interface ApiSwitchRequest {
+  enabled?: boolean | null;
+  reason: string;
+}
+
+export interface ArtifactManifest {
+  artifacts: ArtifactManifestEntry[];
+  created_at: string;
+  definition_hash?: string;
+  execution_id: string;
+  pipeline_id: string;
+  public_key?: string;
+  regenerated_from?: ArtifactOrigin;
+  signature?: string;
+}
+
+export interface ArtifactManifestEntry {
+  mime_type: string;
+  sha256: string;
+  step_id: string;
+  step_uuid: string;
+  uri: string;
+}
+
+export interface ArtifactOrigin {
+  artifact_id: string;
+  execution_id: string;
+  original_execution_id: string;
+  version: number;
+}
+
+export interface HealthComponent {
+  error?: string;
+  latency_ms: number;
+  name: string;
+  pipelines?: string[];
+  status: string;
+}
+
+export interface PipelineAsset {
+  filename: string;
+  key: string;
+  mime_type: string;
+  received_at: string;
+  sha256: string;
+  size: number;
+  tag?: string;
+  uri: string;
+}
+
+export interface PipelineContextSnapshot {
+  created_at: string;
+  data?: Record<string, unknown>;
+  definition_hash?: string;
+  execution_id: string;
+  pipeline_id: string;
+  step_hashes?: Record<string, string>;
+  step_outputs: Record<string, unknown>;
+  steps?: PipelineSnapshotStep[];
+  user_input: string;
+}
+
+export interface PipelineDeadLetter {
+  definition_hash?: string;
+  diagnosis?: PipelineDiagnosis;
+  error_message: string;
+  execution_failures: number;
+  execution_id: string;
+  failed_at: string;
+  pipeline_id: string;
+  pipeline_label?: string;
+  redrive_execution_id?: string;
+  redriven_at?: string;
+  results?: Record<string, unknown>;
+  step_outputs?: Record<string, unknown>;
+  user_input?: string;
+}
+
+export interface PipelineDiagnosis {
+  error_class: string;
+  error_message: string;
+  provider?: string;
+  provider_response?: string;
+  remediation: string;
+  step_description?: string;
+  step_id?: string;
+  step_type?: string;
+  step_uuid?: string;
+}
+
+export interface PipelineDisabledPipeline {
+  disabled_at: string;
+  reason?: string;
+}
+
+export interface PipelineEstimate {
+  cost_max: number;
+  cost_min: number;
+  currency: string;
+  duration_max: number;
+  duration_min: number;
+  pipeline_id: string;
+  steps: PipelineStepEstimate[];
+  warnings?: string[];
+}
+
+export interface PipelineEstimateRequest {
+  outputs?: Record<string, string>;
+  user_input: string;
+}
+
+export interface PipelineExecutionDefinition {
+  created_at: string;
+  definition: Record<string, unknown>;
+  definition_hash: string;
+  execution_id: string;
+  label?: string;
+  pipeline_id: string;
+}
+
+export interface PipelineOutputCacheStats {
+  entries: number;
+  hit_rate: number;
+  hits: number;
+  misses: number;
+}
+
+export interface PipelinePausedSchedule {
+  paused_at: string;
+  reason?: string;
+}
+
+export interface PipelineSnapshotStep {
+  id: string;
+  output_key?: string;
+}
+
+export interface PipelineStepEstimate {
+  cost_max: number;
+  cost_min: number;
+  duration_max: number;
+  duration_min: number;
+  duration_samples: number;
+  input_tokens?: number;
+  model?: string;
+  output_tokens_max?: number;
+  output_tokens_min?: number;
+  service?: string;
+  step_id: string;
+  step_type: string;
+}
+
+export interface PipelineSwitch {
+  enabled: boolean;
+  reason?: string;
+  updated_at?: string;
+}
+
+export interface PipelineTypeActionDetails {
+  action_service: string;
+  configuration: Record<string, unknown>;
+  execution_location: string;
+  id: string;
+  label: string;
+}
+
+export interface PipelineTypeContentFilterConfig {
+  allow_list: string[];
+  deny_list: string[];
+  enabled: boolean;
+  use_default_list: boolean;
+}
+
+export interface PipelineTypeExecutionQuota {
+  daily_cost: number;
+  daily_executions: number;
+  monthly_cost: number;
+  monthly_executions: number;
+}
+
+export interface PipelineTypeGoogleSearchConfig {
+  advanced_params: PipelineTypeGoogleSearchParams;
+  category: string;
+  query: string;
+}
+
+export interface PipelineTypeGoogleSearchParams {
+  country: string;
+  date_restrict: string;
+  file_type: string;
+  language: string;
+  num_results: string;
+  safe_search: string;
+  site_search: string;
+  sort: string;
+}
+
+export interface PipelineTypeNewsAPIAdvancedParams {
+  date_range: PipelineTypeNewsAPIDateRange;
+  language: string;
+  page_size: string;
+  sort_by: string;
+}
+
+export interface PipelineTypeNewsAPIConfig {
+  advanced_params: PipelineTypeNewsAPIAdvancedParams;
+  query: string;
+}
+
+export interface PipelineTypeNewsAPIDateRange {
+  from: string;
+  to: string;
+}
+
+export interface PipelineTypePipeline {
+  after_steps?: PipelineTypePipelineStep[];
+  before_steps?: PipelineTypePipelineStep[];
+  content_filter?: PipelineTypeContentFilterConfig;
+  execution_failures: number;
+  execution_quota?: PipelineTypeExecutionQuota;
+  id: string;
+  label: string;
+  locales?: string[];
+  post_run_hooks?: PipelineTypePostRunHook[];
+  result_webhooks?: PipelineTypeResultWebhook[];
+  sandbox?: boolean;
+  scheduled_time: number;
+  sla?: PipelineTypeSLAConfig;
+  steps: PipelineTypePipelineStep[];
+}
+
+export interface PipelineTypePipelineStep {
+  action_config?: string;
+  action_details?: PipelineTypeActionDetails;
+  article_data?: Record<string, unknown>;
+  cache_ttl?: number;
+  google_search_config?: PipelineTypeGoogleSearchConfig;
+  id: string;
+  llm_config?: string;
+  llm_service?: Record<string, unknown>;
+  max_tool_rounds?: number;
+  messages?: PipelineTypeStepMessage[];
+  news_api_config?: PipelineTypeNewsAPIConfig;
+  output_type: string;
+  per_locale?: boolean;
+  prompt?: string;
+  prompt_assembly?: PipelineTypePromptAssembly;
+  required_steps: string;
+  response?: string;
+  response_schema?: Record<string, unknown>;
+  rollout?: PipelineTypeStepRollout;
+  search_input?: string;
+  step_description: string;
+  step_output_key: string;
+  tools?: PipelineTypeStepTool[];
+  type: string;
+  upload_image_config?: PipelineTypeUploadImageConfig;
+  uuid: string;
+  weight: number;
+}
+
+export interface PipelineTypePostRunHook {
+  fields?: Record<string, string>;
+  timeout?: number;
+  type: string;
+  url?: string;
+}
+
+export interface PipelineTypePromptAssembly {
+  max_tokens?: number;
+  overflow?: string;
+  reserve_tokens?: number;
+  sources?: PipelineTypePromptSource[];
+}
+
+export interface PipelineTypePromptSource {
+  key: string;
+  max_tokens?: number;
+  priority?: number;
+}
+
+export interface PipelineTypeResultWebhook {
+  secret?: string;
+  url: string;
+}
+
+export interface PipelineTypeSLAConfig {
+  max_duration: number;
+  start_window: number;
+}
+
+export interface PipelineTypeStepMessage {
+  content?: string;
+  from?: string;
+  role: string;
+}
+
+export interface PipelineTypeStepRollout {
+  llm_service?: Record<string, unknown>;
+  max_failure_rate_increase: number;
+  min_executions: number;
+  percentage: number;
+  prompt?: string;
+  version: string;
+}
+
+export interface PipelineTypeStepTool {
+  action_service?: string;
+  allowed_arguments?: string[];
+  configuration?: Record<string, unknown>;
+  description: string;
+  name: string;
+  parameters?: Record<string, unknown>;
+  step?: PipelineTypePipelineStep;
+}
+
+export interface PipelineTypeUploadImageConfig {
+  image_file_id: number;
+  image_file_mime: string;
+  image_file_name: string;
+  image_file_size: number;
+  image_file_uri: string;
+  image_file_url: string;
+}
+
+export interface SchedulerFailureState {
+  count: number;
+  last_failure?: number;
+  retry_after?: number;
+}
+
+export interface ServerAssetList {
+  assets: PipelineAsset[];
+}
+
+export interface ServerAssetUpload {
+  file: Blob;
+  key: string;
+  tag?: string;
+}
+
+export interface ServerDeadLetterList {
+  dead_letters: ServerDeadLetterSummary[];
+}
+
+export interface ServerDeadLetterSummary {
+  error_message: string;
+  execution_id: string;
+  failed_at: string;
+  pipeline_id: string;
+  pipeline_label: string;
+  redrive_execution_id: string;
+  redriven_at: string;
+}
+
+export interface ServerPausedSchedules {
+  paused_schedules: Record<string, PipelinePausedSchedule>;
+}
+
+export interface ServerPipelineFailures {
+  failures: SchedulerFailureState;
+  pipeline_id: string;
+  tracked: boolean;
+}
+
+export interface ServerProvidersHealth {
+  breakers: Record<string, string>;
+  components: HealthComponent[];
+  status: string;
+}
+
+export interface ServerServiceHealth {
+  components: HealthComponent[];
+  disabled_pipelines: Record<string, PipelineDisabledPipeline>;
+  maintenance: PipelineSwitch;
+  paused_schedules: Record<string, PipelinePausedSchedule>;
+  running_executions: number;
+  status: string;
+}
+
+export interface ServerSlaReport {
+  pipelines: SlaCompliance[];
+}
+
+export interface SlaCompliance {
+  compliance_rate: number;
+  last_breach?: string;
+  late: number;
+  missed_starts: number;
+  on_time: number;
+  pipeline_id: string;
+  runs: number;
+}
+
+export interface ClientOptions {
+  /** Sent in X-API-Key when set */
+  apiKey?: string;
+  /** Sent as a bearer token when set, instead of the API key */
+  token?: string;
+  fetch?: typeof fetch;
+}
+
+/** A response with an error status. */
+export class APIError extends Error {
+  constructor(readonly status: number, message: string) {
+    super(message);
+  }
+}
+
+/** Calls one service instance. */
+export class Client {
+  private readonly baseURL: string;
+
+  constructor(baseURL: string, private readonly options: ClientOptions = {}) {
+    this.baseURL = baseURL.replace(/\/+$/, "");
+  }
+
+  /** Get a generated image with its signed URL */
+  getApiImagesFileId(fileId: string, query: { expires?: string; signature?: string } = {}): Promise<Response> {
+    return this.request("GET", `/api/images/${encodeURIComponent(fileId)}`, { query });
+  }
+
+  /** Get a step output too large to be sent inline with its signed URL */
+  getApiOutputsFilename(filename: string, query: { expires?: string; signature?: string } = {}): Promise<Response> {
+    return this.request("GET", `/api/outputs/${encodeURIComponent(filename)}`, { query });
+  }
+
+  /** Get the status of the executions of a bulk request */
+  async getBatchesBatchId(batchId: string): Promise<ApiBatchStatus> {
+    return (await this.request("GET", `/batches/${encodeURIComponent(batchId)}`)).json();
+  }
+
+  /** Get the statistics of the shared step output cache */
+  async getCacheOutputs(): Promise<PipelineOutputCacheStats> {
+    return (await this.request("GET", `/cache/outputs`)).json();
+  }
+
+  /** Purge the shared step output cache */
+  async deleteCacheOutputs(): Promise<void> {
+    await this.request("DELETE", `/cache/outputs`);
+  }
+
+  /** List the executions that exhausted their retries */
+  async getDeadLetters(query: { pipeline_id?: string } = {}): Promise<ServerDeadLetterList> {
+    return (await this.request("GET", `/dead-letters`, { query })).json();
+  }
+
+  /** Get a dead letter */
+  async getDeadLettersExecutionId(executionId: string): Promise<PipelineDeadLetter> {
+    return (await this.request("GET", `/dead-letters/${encodeURIComponent(executionId)}`)).json();
+  }
+
+  /** Delete a dead letter */
+  async deleteDeadLettersExecutionId(executionId: string): Promise<void> {
+    await this.request("DELETE", `/dead-letters/${encodeURIComponent(executionId)}`);
+  }
+
+  /** Start a dead letter again */
+  async postDeadLettersExecutionIdRedrive(executionId: string, body: ApiRedriveRequest): Promise<ApiExecutionAccepted> {
+    return (await this.request("POST", `/dead-letters/${encodeURIComponent(executionId)}/redrive`, { body })).json();
+  }
+
+  /** Run a pipeline from its definition, without it existing in Drupal */
+  async postExecutions(body: PipelineTypePipeline): Promise<ApiExecutionAccepted> {
+    return (await this.request("POST", `/executions`, { body })).json();
+  }
+
+  /** Regenerate an artifact of an execution */
+  async postExecutionsExecutionIdArtifactsArtifactIdRegenerate(executionId: string, artifactId: string, body: ApiRegenerateRequest): Promise<ApiExecutionAccepted> {
+    return (await this.request("POST", `/executions/${encodeURIComponent(executionId)}/artifacts/${encodeURIComponent(artifactId)}/regenerate`, { body })).json();
+  }
+
+  /** Get the context of a past execution, secrets redacted */
+  async getExecutionsExecutionIdContext(executionId: string, query: { at_step?: string } = {}): Promise<PipelineContextSnapshot> {
+    return (await this.request("GET", `/executions/${encodeURIComponent(executionId)}/context`, { query })).json();
+  }
+
+  /** Get the pipeline definition a past execution ran */
+  async getExecutionsExecutionIdDefinition(executionId: string): Promise<PipelineExecutionDefinition> {
+    return (await this.request("GET", `/executions/${encodeURIComponent(executionId)}/definition`)).json();
+  }
+
+  /** Stream the log lines of an execution as server-sent events */
+  getExecutionsExecutionIdLogsStream(executionId: string, query: { backfill?: string } = {}): Promise<Response> {
+    return this.request("GET", `/executions/${encodeURIComponent(executionId)}/logs/stream`, { query });
+  }
+
+  /** Stream the status and the events of an execution over a WebSocket */
+  getExecutionsExecutionIdProgressWsURL(executionId: string): string {
+    return this.url(`/executions/${encodeURIComponent(executionId)}/progress/ws`).replace(/^http/, "ws");
+  }
+
+  /** Check the service is alive */
+  async getHealthz(): Promise<ServerServiceHealth> {
+    return (await this.request("GET", `/healthz`)).json();
+  }
+
+  /** Turn maintenance mode on or off */
+  async putMaintenance(body: ApiSwitchRequest): Promise<ApiSwitch> {
+    return (await this.request("PUT", `/maintenance`, { body })).json();
+  }
+
+  /** Get the Prometheus metrics */
+  getMetrics(): Promise<Response> {
+    return this.request("GET", `/metrics`);
+  }
+
+  /** Get this OpenAPI document */
+  async getOpenapiJson(): Promise<Record<string, unknown>> {
+    return (await this.request("GET", `/openapi.json`)).json();
+  }
+
+  /** List the files waiting for the next execution of a pipeline */
+  async getPipelineIdAssets(id: string): Promise<ServerAssetList> {
+    return (await this.request("GET", `/pipeline/${encodeURIComponent(id)}/assets`)).json();
+  }
+
+  /** Push a file for the next execution of a pipeline */
+  async postPipelineIdAssets(id: string, form: FormData): Promise<PipelineAsset> {
+    return (await this.request("POST", `/pipeline/${encodeURIComponent(id)}/assets`, { form })).json();
+  }
+
+  /** Delete a waiting file */
+  async deletePipelineIdAssetsKey(id: string, key: string): Promise<void> {
+    await this.request("DELETE", `/pipeline/${encodeURIComponent(id)}/assets/${encodeURIComponent(key)}`);
+  }
+
+  /** Switch a pipeline on or off */
+  async putPipelineIdEnabled(id: string, body: ApiSwitchRequest): Promise<ApiPipelineSwitch> {
+    return (await this.request("PUT", `/pipeline/${encodeURIComponent(id)}/enabled`, { body })).json();
+  }
+
+  /** Start an on-demand execution */
+  async postPipelineIdExecute(id: string, body: ApiExecuteRequest): Promise<ApiExecutionAccepted> {
+    return (await this.request("POST", `/pipeline/${encodeURIComponent(id)}/execute`, { body })).json();
+  }
+
+  /** Stream the log lines of an execution over a WebSocket */
+  getPipelineIdExecutionExecutionIdLogsWsURL(id: string, executionId: string, query: { backfill?: string } = {}): string {
+    return this.url(`/pipeline/${encodeURIComponent(id)}/execution/${encodeURIComponent(executionId)}/logs/ws`, query).replace(/^http/, "ws");
+  }
+
+  /** Get the artifact manifest of an execution */
+  async getPipelineIdExecutionExecutionIdManifest(id: string, executionId: string): Promise<ArtifactManifest> {
+    return (await this.request("GET", `/pipeline/${encodeURIComponent(id)}/execution/${encodeURIComponent(executionId)}/manifest`)).json();
+  }
+
+  /** Rerun an execution, reusing the outputs of the skipped steps */
+  async postPipelineIdExecutionExecutionIdRerun(id: string, executionId: string, body: ApiRerunRequest): Promise<ApiExecutionAccepted> {
+    return (await this.request("POST", `/pipeline/${encodeURIComponent(id)}/execution/${encodeURIComponent(executionId)}/rerun`, { body })).json();
+  }
+
+  /** Get the results of a completed execution */
+  async getPipelineIdExecutionExecutionIdResults(id: string, executionId: string): Promise<ApiExecutionResults> {
+    return (await this.request("GET", `/pipeline/${encodeURIComponent(id)}/execution/${encodeURIComponent(executionId)}/results`)).json();
+  }
+
+  /** Get the status of an execution */
+  async getPipelineIdExecutionExecutionIdStatus(id: string, executionId: string): Promise<ApiExecutionStatus> {
+    return (await this.request("GET", `/pipeline/${encodeURIComponent(id)}/execution/${encodeURIComponent(executionId)}/status`)).json();
+  }
+
+  /** Run a single step on the context of a past execution */
+  async postPipelineIdExecutionExecutionIdStepsStepIdExecute(id: string, executionId: string, stepId: string, body: ApiStepRequest): Promise<ApiExecutionAccepted> {
+    return (await this.request("POST", `/pipeline/${encodeURIComponent(id)}/execution/${encodeURIComponent(executionId)}/steps/${encodeURIComponent(stepId)}/execute`, { body })).json();
+  }
+
+  /** Get the consecutive failures of a scheduled pipeline */
+  async getPipelineIdFailures(id: string): Promise<ServerPipelineFailures> {
+    return (await this.request("GET", `/pipeline/${encodeURIComponent(id)}/failures`)).json();
+  }
+
+  /** Clear the failures of a pipeline, lifting its backoff */
+  async deletePipelineIdFailures(id: string): Promise<void> {
+    await this.request("DELETE", `/pipeline/${encodeURIComponent(id)}/failures`);
+  }
+
+  /** Pause the schedule of a pipeline */
+  async postPipelineIdSchedulePause(id: string, body: ApiScheduleRequest): Promise<ApiScheduleState> {
+    return (await this.request("POST", `/pipeline/${encodeURIComponent(id)}/schedule/pause`, { body })).json();
+  }
+
+  /** Resume the schedule of a pipeline */
+  async postPipelineIdScheduleResume(id: string, body: ApiScheduleRequest): Promise<ApiScheduleState> {
+    return (await this.request("POST", `/pipeline/${encodeURIComponent(id)}/schedule/resume`, { body })).json();
+  }
+
+  /** Get the coming runs of the scheduled pipelines as an iCalendar feed */
+  getPipelinesScheduleIcs(query: { days?: string; pipeline_id?: string } = {}): Promise<Response> {
+    return this.request("GET", `/pipelines/schedule.ics`, { query });
+  }
+
+  /** Get the schedule compliance of the pipelines */
+  async getPipelinesSla(): Promise<ServerSlaReport> {
+    return (await this.request("GET", `/pipelines/sla`)).json();
+  }
+
+  /** Estimate the tokens and the cost of an execution */
+  async postPipelinesIdEstimate(id: string, body: PipelineEstimateRequest): Promise<PipelineEstimate> {
+    return (await this.request("POST", `/pipelines/${encodeURIComponent(id)}/estimate`, { body })).json();
+  }
+
+  /** Enqueue one execution per parameter set, sharing a batch ID */
+  async postPipelinesIdExecuteBulk(id: string, body: ApiBulkExecuteRequest): Promise<ApiBatchStatus> {
+    return (await this.request("POST", `/pipelines/${encodeURIComponent(id)}/execute/bulk`, { body })).json();
+  }
+
+  /** Run a scheduled pipeline now */
+  async postPipelinesIdRun(id: string): Promise<ApiExecutionAccepted> {
+    return (await this.request("POST", `/pipelines/${encodeURIComponent(id)}/run`)).json();
+  }
+
+  /** Check the provider credentials of the scheduled pipelines */
+  async getProvidersHealth(): Promise<ServerProvidersHealth> {
+    return (await this.request("GET", `/providers/health`)).json();
+  }
+
+  /** Check the service is ready to run executions */
+  async getReadyz(): Promise<ServerServiceHealth> {
+    return (await this.request("GET", `/readyz`)).json();
+  }
+
+  /** List the paused schedules */
+  async getSchedulesPaused(): Promise<ServerPausedSchedules> {
+    return (await this.request("GET", `/schedules/paused`)).json();
+  }
+
+  /** Start a pipeline from an external event, signed with the trigger secret */
+  async postTriggersPipelineId(pipelineId: string, body: Record<string, unknown>): Promise<ApiExecutionAccepted> {
+    return (await this.request("POST", `/triggers/${encodeURIComponent(pipelineId)}`, { body })).json();
+  }
+
+  private url(path: string, query: Record<string, string | undefined> = {}): string {
+    const params = new URLSearchParams();
+    for (const [name, value] of Object.entries(query)) {
+      if (value !== undefined) {
+        params.set(name, value);
+      }
+    }
+    const search = params.toString();
+    return this.baseURL + path + (search ? "?" + search : "");
+  }
+
+  private async request(
+    method: string,
+    path: string,
+    init: { body?: unknown; form?: FormData; query?: Record<string, string | undefined> } = {},
+  ): Promise<Response> {
+    const headers: Record<string, string> = {};
+    if (this.options.token) {
+      headers["Authorization"] = "Bearer " + this.options.token;
+    } else if (this.options.apiKey) {
+      headers["X-API-Key"] = this.options.apiKey;
+    }
+    let body: BodyInit | undefined = init.form;
+    if (init.body !== undefined) {
+      headers["Content-Type"] = "application/json";
+      body = JSON.stringify(init.body);
+    }
+    const response = await (this.options.fetch ?? fetch)(this.url(path, init.query), { method, headers, body });
+    if (!response.ok) {
+      const message = (await response.text()).trim();
+      throw new APIError(response.status, message || response.statusText);
+    }
+    return response;
+  }
+}
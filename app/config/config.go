@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -17,8 +18,12 @@ type Config struct {
 	CheckInterval              time.Duration
 	Domains                    []string
 	CertCacheDir               string
+	ACMEEmail                  string
+	TLSCertFile                string
+	TLSKeyFile                 string
 	HTTPPort                   string
 	HTTPSPort                  string
+	GRPCPort                   string
 	DrupalUsername             string
 	DrupalPassword             string
 	GoogleCustomSearchAPIKey   string
@@ -26,6 +31,58 @@ type Config struct {
 	NewsAPIKey                 string
 	CronURL                    string
 	CronInterval               time.Duration
+	ArtifactSigningKey         string
+	OutputSpillThreshold       int
+	EmbedProvenance            bool
+	AIDisclosureText           string
+	AIDisclosureHashtags       string
+	RateLimits                 string
+	SLAAlertWebhookURL         string
+	ExecutionRetention         time.Duration
+	ExecutionCleanupInterval   time.Duration
+	ExecutionArchiveLocation   string
+	ContainerImageDigest       string
+	FFmpegThreads              int
+	X264Preset                 string
+	X264Tune                   string
+	FFmpegCPUAffinity          string
+	ScheduleJitter             time.Duration
+	SchedulerMaxConcurrent     int
+	SchedulerQueueSize         int
+	SchedulerStatePath         string
+	TriggerSecret              string
+	DistributedScheduler       bool
+	InstanceID                 string
+	JobQueueDir                string
+	JobQueueWorkers            int
+	FailureBackoffBase         time.Duration
+	FailureBackoffMax          time.Duration
+	FailureCooldown            time.Duration
+	FailureStatePath           string
+	RenderWorkerURL            string
+	RenderWorkerToken          string
+	PriceTablePath             string
+	TokenizerDir               string
+	LLMHTTPRetries             int
+	LLMHTTPTimeout             time.Duration
+	LLMHTTPMaxBackoff          time.Duration
+	LLMBreakerThreshold        int
+	LLMBreakerCooldown         time.Duration
+	PipelineDir                string
+	MessageTriggerSQSURL       string
+	MessageTriggerPipelineID   string
+	SandboxMode                bool
+	ExecutionMaxDuration       time.Duration
+	APIKeys                    string
+	JWTSecret                  string
+	JWTAudience                string
+	ClientRateLimit            int
+	ClientRateBurst            int
+	ClientRateLimits           string
+	TrustProxyHeaders          bool
+	FileURLSecret              string
+	FileURLTTL                 time.Duration
+	WebSocketOrigins           []string
 }
 
 var isTest bool
@@ -48,17 +105,73 @@ func Load() Config {
 		APIHost:                    getEnv("API_HOST", "lesocle-dev.sa"),
 		ServiceBaseURL:             getEnv("SERVICE_BASE_URL", "http://localhost:8086"), // Default to localhost
 		CheckInterval:              time.Duration(getEnvAsInt("CHECK_INTERVAL", 1200)) * time.Second,
-		Domains:                    []string{getEnv("DOMAIN", "example.com")},
-		CertCacheDir:               getEnv("CERT_CACHE_DIR", "/etc/letsencrypt/live/example.com"),
+		Domains:                    getEnvAsList("DOMAINS", getEnv("DOMAIN", "serisow.com,www.serisow.com")), // Hosts Let's Encrypt certificates are requested for in production
+		CertCacheDir:               getEnv("CERT_CACHE_DIR", "../serisow_certs"),                             // Where the Let's Encrypt certificates are kept
+		ACMEEmail:                  getEnv("ACME_EMAIL", ""),                                                 // Contact for expiry notices from Let's Encrypt
+		TLSCertFile:                getEnv("TLS_CERT_FILE", ""),                                              // Serve these certificate files instead of Let's Encrypt ones
+		TLSKeyFile:                 getEnv("TLS_KEY_FILE", ""),
 		HTTPPort:                   getEnv("HTTP_PORT", "8086"),
 		HTTPSPort:                  getEnv("HTTPS_PORT", "443"),
+		GRPCPort:                   getEnv("GRPC_PORT", ""), // Plaintext HTTP/2 port of the gRPC API for internal services, disabled when empty
 		DrupalUsername:             getEnv("DRUPAL_USERNAME", ""),
 		DrupalPassword:             getEnv("DRUPAL_PASSWORD", ""),
 		GoogleCustomSearchAPIKey:   getEnv("GoogleCustomSearchAPIKey", ""),
 		GoogleCustomSearchEngineID: getEnv("GoogleCustomSearchEngineID", ""),
 		NewsAPIKey:                 getEnv("NEWS_API_KEY", ""),
 		CronURL:                    getEnv("DRUPAL_CRON_URL", ""),
-		CronInterval:               time.Duration(getEnvAsInt("CRON_INTERVAL", 300)) * time.Second, // Default 5 minutes
+		CronInterval:               time.Duration(getEnvAsInt("CRON_INTERVAL", 300)) * time.Second,               // Default 5 minutes
+		ArtifactSigningKey:         getEnv("ARTIFACT_SIGNING_KEY", ""),                                           // Base64 Ed25519 seed, signing disabled when empty
+		OutputSpillThreshold:       getEnvAsInt("OUTPUT_SPILL_THRESHOLD", 1024*1024),                             // Outputs above 1 MiB are kept on disk, 0 disables
+		EmbedProvenance:            getEnv("EMBED_PROVENANCE", "true") == "true",                                 // Label AI-generated media with provenance metadata
+		AIDisclosureText:           getEnv("AI_DISCLOSURE_TEXT", ""),                                             // Appended to LLM-written social posts
+		AIDisclosureHashtags:       getEnv("AI_DISCLOSURE_HASHTAGS", ""),                                         // Space separated, e.g. "#AIGenerated"
+		RateLimits:                 getEnv("RATE_LIMITS", "openai_image=5"),                                      // Requests per minute per provider, e.g. "openai=60,twitter=50"
+		SLAAlertWebhookURL:         getEnv("SLA_ALERT_WEBHOOK_URL", ""),                                          // SLA alerts are only logged when empty
+		ExecutionRetention:         time.Duration(getEnvAsInt("EXECUTION_RETENTION", 86400)) * time.Second,       // Default 24 hours
+		ExecutionCleanupInterval:   time.Duration(getEnvAsInt("EXECUTION_CLEANUP_INTERVAL", 3600)) * time.Second, // Default 1 hour
+		ExecutionArchiveLocation:   getEnv("EXECUTION_ARCHIVE_LOCATION", ""),                                     // Directory or s3://bucket/prefix, expired results are discarded when empty
+		ContainerImageDigest:       getEnv("CONTAINER_IMAGE_DIGEST", ""),                                         // Set by the deployment, recorded in execution results
+		FFmpegThreads:              getEnvAsInt("FFMPEG_THREADS", 0),                                             // 0 lets ffmpeg use every core
+		X264Preset:                 getEnv("X264_PRESET", "veryfast"),
+		X264Tune:                   getEnv("X264_TUNE", ""),
+		FFmpegCPUAffinity:          getEnv("FFMPEG_CPU_AFFINITY", ""),                                       // CPU list such as "2-3", keeps ffmpeg off the cores serving the API
+		ScheduleJitter:             time.Duration(getEnvAsInt("SCHEDULE_JITTER", 0)) * time.Second,          // Maximum random delay of recurring runs, 0 disables
+		SchedulerMaxConcurrent:     getEnvAsInt("SCHEDULER_MAX_CONCURRENT", 4),                              // Scheduled pipelines running at once, 0 for no limit
+		SchedulerQueueSize:         getEnvAsInt("SCHEDULER_QUEUE_SIZE", 50),                                 // Due pipelines waiting for a worker
+		SchedulerStatePath:         getEnv("SCHEDULER_STATE_PATH", "storage/pipeline/scheduler_state.json"), // Last runs and in-flight executions, kept across restarts
+		TriggerSecret:              getEnv("TRIGGER_SECRET", ""),                                            // HMAC key of POST /triggers/{pipeline_id}, triggers are disabled when empty
+		DistributedScheduler:       getEnv("DISTRIBUTED_SCHEDULER", "false") == "true",                      // Claim scheduled runs in Postgres (DATABASE_URL) when several instances run
+		InstanceID:                 getEnv("INSTANCE_ID", ""),                                               // Owner of the claims, defaults to the hostname
+		JobQueueDir:                getEnv("JOB_QUEUE_DIR", "storage/pipeline/queue"),                       // Accepted triggers waiting to run, kept across restarts
+		JobQueueWorkers:            getEnvAsInt("JOB_QUEUE_WORKERS", 2),                                     // Queued triggers running at once
+		FailureBackoffBase:         time.Duration(getEnvAsInt("FAILURE_BACKOFF_BASE", 300)) * time.Second,   // Wait after a failed scheduled run, doubled on each failure
+		FailureBackoffMax:          time.Duration(getEnvAsInt("FAILURE_BACKOFF_MAX", 21600)) * time.Second,  // Default 6 hours
+		FailureCooldown:            time.Duration(getEnvAsInt("FAILURE_COOLDOWN", 86400)) * time.Second,     // Failures are forgotten after this long without a new one
+		FailureStatePath:           getEnv("FAILURE_STATE_PATH", "storage/pipeline/failures.json"),
+		RenderWorkerURL:            getEnv("RENDER_WORKER_URL", ""), // Encodes run on this render worker, locally when empty
+		RenderWorkerToken:          getEnv("RENDER_WORKER_TOKEN", ""),
+		PriceTablePath:             getEnv("PRICE_TABLE_PATH", ""),                                           // JSON of model prices overriding the built-in ones
+		TokenizerDir:               getEnv("TOKENIZER_DIR", "storage/tokenizers"),                            // cl100k_base.tiktoken and o200k_base.tiktoken, token counts are estimated without them
+		LLMHTTPRetries:             getEnvAsInt("LLM_HTTP_RETRIES", 3),                                       // Retries of the LLM calls failing with a network error, 429 or 5xx
+		LLMHTTPTimeout:             time.Duration(getEnvAsInt("LLM_HTTP_TIMEOUT", 120)) * time.Second,        // Per attempt, image generation allows longer
+		LLMHTTPMaxBackoff:          time.Duration(getEnvAsInt("LLM_HTTP_MAX_BACKOFF", 60)) * time.Second,     // Longest wait between retries, longer Retry-After fail the call
+		LLMBreakerThreshold:        getEnvAsInt("LLM_BREAKER_THRESHOLD", 5),                                  // Consecutive failures stopping the calls to a provider, 0 disables
+		LLMBreakerCooldown:         time.Duration(getEnvAsInt("LLM_BREAKER_COOLDOWN", 60)) * time.Second,     // Before a call probes the provider again
+		PipelineDir:                getEnv("PIPELINE_DIR", ""),                                               // Read the pipelines from this directory instead of Drupal
+		MessageTriggerSQSURL:       getEnv("MESSAGE_TRIGGER_SQS_URL", ""),                                    // Start pipelines from the messages of this SQS queue
+		MessageTriggerPipelineID:   getEnv("MESSAGE_TRIGGER_PIPELINE_ID", ""),                                // Pipeline of the messages naming none
+		SandboxMode:                getEnv("SANDBOX_MODE", "false") == "true",                                // Every execution simulates the actions instead of publishing
+		ExecutionMaxDuration:       time.Duration(getEnvAsInt("EXECUTION_MAX_DURATION", 7200)) * time.Second, // Scheduled executions running longer are cancelled, 0 disables the watchdog
+		APIKeys:                    getEnv("API_KEYS", ""),                                                   // Comma separated keys accepted in X-API-Key, the API is open when neither keys nor JWT_SECRET are set
+		JWTSecret:                  getEnv("JWT_SECRET", ""),                                                 // HS256 secret of the bearer tokens
+		JWTAudience:                getEnv("JWT_AUDIENCE", ""),                                               // Audience the bearer tokens must be issued for, not checked when empty
+		ClientRateLimit:            getEnvAsInt("CLIENT_RATE_LIMIT", 60),                                     // Requests per minute per client on the trigger, asset and artifact routes, 0 disables
+		ClientRateBurst:            getEnvAsInt("CLIENT_RATE_BURST", 20),
+		ClientRateLimits:           getEnv("CLIENT_RATE_LIMITS", ""),                                 // Per client overrides, e.g. "ip:203.0.113.7=600,sub:partner-a=300"
+		TrustProxyHeaders:          getEnv("TRUST_PROXY_HEADERS", "false") == "true",                 // Take the client address from X-Forwarded-For
+		FileURLSecret:              getEnv("FILE_URL_SECRET", ""),                                    // HMAC key of the image and output URLs, random per process when the API is authenticated and it is empty
+		FileURLTTL:                 time.Duration(getEnvAsInt("FILE_URL_TTL", 604800)) * time.Second, // How long the image and output URLs can be fetched, default 7 days
+		WebSocketOrigins:           getEnvAsList("WEBSOCKET_ORIGINS", ""),                            // Hosts of the pages allowed to open the WebSockets besides this one and API_HOST
 	}
 }
 
@@ -76,3 +189,14 @@ func getEnvAsInt(key string, fallback int) int {
 	}
 	return fallback
 }
+
+// getEnvAsList reads a comma separated list, empty entries are dropped.
+func getEnvAsList(key, fallback string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, fallback), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,186 @@
+package content_filter
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+// defaultDenyList is used when a pipeline enables use_default_list. It only
+// covers the most common English profanity, brand-specific terms belong in the
+// pipeline's own deny list.
+var defaultDenyList = []string{
+	"asshole", "bastard", "bitch", "bullshit", "cunt", "dick", "fuck", "fucker",
+	"fucking", "motherfucker", "nigger", "faggot", "retard", "shit", "slut", "whore",
+}
+
+// leetspeak maps the usual character substitutions back to letters.
+var leetspeak = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b',
+	'@': 'a', '$': 's', '!': 'i', '+': 't', '|': 'l',
+}
+
+// Filter is a lexical deny list check. Matching is done on whole words after
+// lowercasing and leetspeak normalization, so "Scunthorpe" doesn't match
+// "cunt" while "sh1t" and "shiiit" match "shit".
+type Filter struct {
+	deny  map[string]string
+	allow map[string]bool
+	// phrases are multi-word deny entries, matched on the normalized text
+	phrases map[string]string
+}
+
+// New builds a filter from a pipeline configuration. It returns nil when the
+// filter is disabled.
+func New(cfg *pipeline_type.ContentFilterConfig) *Filter {
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+
+	f := &Filter{
+		deny:    make(map[string]string),
+		allow:   make(map[string]bool),
+		phrases: make(map[string]string),
+	}
+
+	terms := cfg.DenyList
+	if cfg.UseDefaultList {
+		terms = append(append([]string{}, defaultDenyList...), terms...)
+	}
+	for _, term := range terms {
+		words := normalizeWords(term)
+		switch len(words) {
+		case 0:
+		case 1:
+			f.deny[words[0]] = term
+			f.deny[collapseRepeats(words[0])] = term
+		default:
+			f.phrases[strings.Join(words, " ")] = term
+		}
+	}
+	for _, term := range cfg.AllowList {
+		for _, word := range normalizeWords(term) {
+			f.allow[word] = true
+		}
+	}
+	return f
+}
+
+// Check returns the deny list terms found in text.
+func (f *Filter) Check(text string) []string {
+	if f == nil {
+		return nil
+	}
+
+	words := normalizeWords(text)
+	seen := make(map[string]bool)
+	var matches []string
+	add := func(term string) {
+		if !seen[term] {
+			seen[term] = true
+			matches = append(matches, term)
+		}
+	}
+
+	for _, word := range words {
+		if f.allow[word] {
+			continue
+		}
+		if term, ok := f.deny[word]; ok {
+			add(term)
+		} else if term, ok := f.deny[collapseRepeats(word)]; ok {
+			add(term)
+		}
+	}
+
+	if len(f.phrases) > 0 {
+		joined := " " + strings.Join(words, " ") + " "
+		for phrase, term := range f.phrases {
+			if strings.Contains(joined, " "+phrase+" ") {
+				add(term)
+			}
+		}
+	}
+
+	return matches
+}
+
+// Validate returns an error listing the denied terms found in text.
+func (f *Filter) Validate(text string) error {
+	if matches := f.Check(text); len(matches) > 0 {
+		return fmt.Errorf("content filter blocked text containing: %s", strings.Join(matches, ", "))
+	}
+	return nil
+}
+
+// normalizeWords lowercases text, undoes leetspeak and splits it into words.
+func normalizeWords(text string) []string {
+	var words []string
+	var current []rune
+	flush := func() {
+		if len(current) > 0 {
+			words = append(words, string(current))
+			current = current[:0]
+		}
+	}
+
+	runes := []rune(strings.ToLower(text))
+	for i, r := range runes {
+		if mapped, ok := leetspeak[r]; ok {
+			// Symbols only stand for letters inside a word, "great!" is not "greati"
+			if unicode.IsDigit(r) || (len(current) > 0 && i+1 < len(runes) && unicode.IsLetter(runes[i+1])) {
+				r = mapped
+			}
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			current = append(current, r)
+		} else {
+			flush()
+		}
+	}
+	flush()
+
+	return joinSpelledOut(words)
+}
+
+// joinSpelledOut merges runs of single letters ("s h i t") into one word.
+func joinSpelledOut(words []string) []string {
+	var out []string
+	var run strings.Builder
+	runLength := 0
+	flushRun := func() {
+		if runLength > 0 {
+			out = append(out, run.String())
+		}
+		run.Reset()
+		runLength = 0
+	}
+
+	for _, word := range words {
+		if len([]rune(word)) == 1 {
+			run.WriteString(word)
+			runLength++
+			continue
+		}
+		flushRun()
+		out = append(out, word)
+	}
+	flushRun()
+	return out
+}
+
+// collapseRepeats reduces runs of the same letter to a single one.
+func collapseRepeats(word string) string {
+	var b strings.Builder
+	var last rune
+	for i, r := range word {
+		if i > 0 && r == last {
+			continue
+		}
+		b.WriteRune(r)
+		last = r
+	}
+	return b.String()
+}
@@ -0,0 +1,46 @@
+package content_filter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+func TestFilterCheck(t *testing.T) {
+	filter := New(&pipeline_type.ContentFilterConfig{
+		Enabled:        true,
+		UseDefaultList: true,
+		DenyList:       []string{"CompetitorCorp", "cheap knockoff"},
+		AllowList:      []string{"dick"}, // e.g. Philip K. Dick
+	})
+
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"clean text", "Our new release ships today in Scunthorpe", nil},
+		{"leetspeak", "This is sh1t", []string{"shit"}},
+		{"repeated letters", "shiiiit happens", []string{"shit"}},
+		{"spelled out", "what the f.u.c.k", []string{"fuck"}},
+		{"custom term", "Better than c0mpetitorcorp!", []string{"CompetitorCorp"}},
+		{"phrase", "Not a Cheap  Knockoff at all", []string{"cheap knockoff"}},
+		{"allow list", "A novel by Philip K. Dick", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filter.Check(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisabledFilterAcceptsEverything(t *testing.T) {
+	filter := New(&pipeline_type.ContentFilterConfig{Enabled: false, UseDefaultList: true})
+	if err := filter.Validate("shit"); err != nil {
+		t.Errorf("expected disabled filter to accept text, got %v", err)
+	}
+}
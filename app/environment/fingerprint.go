@@ -0,0 +1,125 @@
+package environment
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/serisow/lesocle/config"
+)
+
+// Fingerprint describes the host an execution ran on, so output differences
+// across hosts can be traced to environment drift.
+type Fingerprint struct {
+	Hash        string              `json:"hash"`
+	Hostname    string              `json:"hostname,omitempty"`
+	GoVersion   string              `json:"go_version"`
+	Platform    string              `json:"platform"`
+	ImageDigest string              `json:"image_digest,omitempty"`
+	Build       Build               `json:"build"`
+	FFmpeg      *FFmpeg             `json:"ffmpeg,omitempty"`
+	Plugins     map[string][]string `json:"plugins,omitempty"`
+}
+
+// Build identifies the service binary. Plugins are compiled in, so this is
+// also the version of every registered plugin.
+type Build struct {
+	Version  string `json:"version,omitempty"`
+	Revision string `json:"revision,omitempty"`
+	Time     string `json:"time,omitempty"`
+	Modified bool   `json:"modified,omitempty"`
+}
+
+// FFmpeg is the ffmpeg binary found on the PATH.
+type FFmpeg struct {
+	Version       string `json:"version"`
+	Configuration string `json:"configuration,omitempty"`
+}
+
+var (
+	hostOnce sync.Once
+	host     Fingerprint
+)
+
+// Collect returns the fingerprint of this host with the given registered
+// plugins. Host details are probed once per process.
+func Collect(plugins map[string][]string) Fingerprint {
+	hostOnce.Do(func() {
+		host = probeHost()
+	})
+
+	fp := host
+	fp.Plugins = plugins
+	fp.Hash = ""
+	data, _ := json.Marshal(fp)
+	sum := sha256.Sum256(data)
+	fp.Hash = hex.EncodeToString(sum[:])[:16]
+	return fp
+}
+
+func probeHost() Fingerprint {
+	fp := Fingerprint{
+		GoVersion:   runtime.Version(),
+		Platform:    runtime.GOOS + "/" + runtime.GOARCH,
+		ImageDigest: config.Load().ContainerImageDigest,
+	}
+	fp.Hostname, _ = os.Hostname()
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		fp.Build.Version = info.Main.Version
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				fp.Build.Revision = setting.Value
+			case "vcs.time":
+				fp.Build.Time = setting.Value
+			case "vcs.modified":
+				fp.Build.Modified = setting.Value == "true"
+			}
+		}
+	}
+
+	fp.FFmpeg = probeFFmpeg()
+	return fp
+}
+
+// probeFFmpeg reads the version and build configuration of ffmpeg, nil when
+// it isn't installed.
+func probeFFmpeg() *FFmpeg {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-version").Output()
+	if err != nil {
+		return nil
+	}
+	return parseFFmpegVersion(output)
+}
+
+func parseFFmpegVersion(output []byte) *FFmpeg {
+	info := &FFmpeg{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "ffmpeg version "):
+			info.Version = strings.Fields(strings.TrimPrefix(line, "ffmpeg version "))[0]
+		case strings.HasPrefix(line, "configuration:"):
+			info.Configuration = strings.TrimSpace(strings.TrimPrefix(line, "configuration:"))
+		}
+	}
+	if info.Version == "" {
+		return nil
+	}
+	return info
+}
@@ -0,0 +1,35 @@
+package environment
+
+import (
+	"testing"
+)
+
+func TestParseFFmpegVersion(t *testing.T) {
+	output := []byte("ffmpeg version 6.1.1-3ubuntu5 Copyright (c) 2000-2023 the FFmpeg developers\n" +
+		"built with gcc 13 (Ubuntu 13.2.0-23ubuntu3)\n" +
+		"configuration: --prefix=/usr --enable-libx264 --enable-gpl\n" +
+		"libavutil      58. 29.100 / 58. 29.100\n")
+
+	info := parseFFmpegVersion(output)
+	if info == nil {
+		t.Fatal("expected ffmpeg info")
+	}
+	if info.Version != "6.1.1-3ubuntu5" {
+		t.Errorf("unexpected version %q", info.Version)
+	}
+	if info.Configuration != "--prefix=/usr --enable-libx264 --enable-gpl" {
+		t.Errorf("unexpected configuration %q", info.Configuration)
+	}
+}
+
+func TestCollectHashChangesWithPlugins(t *testing.T) {
+	a := Collect(map[string][]string{"step_types": {"llm_step"}})
+	b := Collect(map[string][]string{"step_types": {"llm_step", "action_step"}})
+
+	if a.GoVersion == "" || a.Hash == "" {
+		t.Fatalf("incomplete fingerprint: %+v", a)
+	}
+	if a.Hash == b.Hash {
+		t.Error("expected different hashes for different plugin sets")
+	}
+}
@@ -0,0 +1,279 @@
+// Package grpcapi serves the gRPC API described in lesoclepb/lesocle.proto,
+// for the internal services preferring typed contracts and streams to the
+// REST API and its WebSocket. Clients generated from the proto file use the
+// protobuf codec, the JSON codec (content-type application/grpc+json) is
+// accepted as well.
+//
+// The unary calls go through the REST handler stack, so they are
+// authenticated, rate limited and validated the same way: the credentials
+// are sent as the authorization or x-api-key metadata.
+package grpcapi
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative lesoclepb/lesocle.proto
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/serisow/lesocle/api"
+	"github.com/serisow/lesocle/grpcapi/lesoclepb"
+	"github.com/serisow/lesocle/pipeline"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxMessageSize bounds the request messages.
+const maxMessageSize = 4 << 20
+
+// forwardedMetadata are the metadata passed on to the REST handlers as
+// headers.
+var forwardedMetadata = []string{"authorization", "x-api-key", "x-request-id", "x-forwarded-for"}
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// jsonCodec is the application/grpc+json codec, with the JSON mapping of
+// proto3: the field names are the ones of the REST API.
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	message, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a proto message", v)
+	}
+	return protojson.Marshal(message)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	message, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%T is not a proto message", v)
+	}
+	return protojson.Unmarshal(data, message)
+}
+
+// Server implements the Lesocle service.
+type Server struct {
+	lesoclepb.UnimplementedLesocleServer
+	rest http.Handler
+}
+
+// New creates the gRPC server, forwarding the unary calls to rest, the
+// handler stack of the REST API.
+func New(rest http.Handler) *grpc.Server {
+	srv := grpc.NewServer(grpc.MaxRecvMsgSize(maxMessageSize))
+	lesoclepb.RegisterLesocleServer(srv, &Server{rest: rest})
+	return srv
+}
+
+// ExecutePipeline starts an on-demand execution.
+func (s *Server) ExecutePipeline(ctx context.Context, req *lesoclepb.ExecuteRequest) (*lesoclepb.ExecutionAccepted, error) {
+	if req.PipelineId == "" {
+		return nil, status.Error(codes.InvalidArgument, "pipeline_id is required")
+	}
+	accepted := &lesoclepb.ExecutionAccepted{}
+	err := s.forward(ctx, http.MethodPost, "/pipeline/"+url.PathEscape(req.PipelineId)+"/execute",
+		api.ExecuteRequest{UserInput: req.UserInput, Sandbox: req.Sandbox}, accepted)
+	if err != nil {
+		return nil, err
+	}
+	return accepted, nil
+}
+
+// GetExecutionStatus returns the status of an execution.
+func (s *Server) GetExecutionStatus(ctx context.Context, ref *lesoclepb.ExecutionRef) (*lesoclepb.ExecutionStatus, error) {
+	executionStatus := &lesoclepb.ExecutionStatus{}
+	if err := s.forward(ctx, http.MethodGet, executionPath(ref)+"/status", nil, executionStatus); err != nil {
+		return nil, err
+	}
+	return executionStatus, nil
+}
+
+// GetArtifactManifest returns the artifact manifest of an execution.
+func (s *Server) GetArtifactManifest(ctx context.Context, ref *lesoclepb.ExecutionRef) (*lesoclepb.Manifest, error) {
+	manifest := &lesoclepb.Manifest{}
+	if err := s.forward(ctx, http.MethodGet, executionPath(ref)+"/manifest", nil, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// WatchExecution streams the status of an execution, then its events until
+// it completes or fails.
+func (s *Server) WatchExecution(ref *lesoclepb.ExecutionRef, stream lesoclepb.Lesocle_WatchExecutionServer) error {
+	ctx := stream.Context()
+	// The status request authenticates the client and checks the execution exists
+	if err := s.forward(ctx, http.MethodGet, executionPath(ref)+"/status", nil, &lesoclepb.ExecutionStatus{}); err != nil {
+		return err
+	}
+
+	// Subscribe before the status so the completion can't be missed. Events
+	// are dropped when the client lags, but for the terminal one that has its
+	// own slot, so the stream always ends.
+	events := make(chan pipeline.Event, 64)
+	terminal := make(chan pipeline.Event, 1)
+	unsubscribe := pipeline.Events.Subscribe(func(event pipeline.Event) {
+		if event.ExecutionID != ref.ExecutionId {
+			return
+		}
+		queue := events
+		if terminalEvent(event) {
+			queue = terminal
+		}
+		select {
+		case queue <- event:
+		default:
+		}
+	})
+	defer unsubscribe()
+
+	current, finished := pipeline.StatusEvent(ref.ExecutionId)
+	if err := stream.Send(eventMessage(current)); err != nil || finished {
+		return err
+	}
+
+	for {
+		select {
+		case event := <-events:
+			if err := stream.Send(eventMessage(event.Message())); err != nil {
+				return err
+			}
+		case end := <-terminal:
+			// The events published before the end go first
+			for {
+				select {
+				case event := <-events:
+					if err := stream.Send(eventMessage(event.Message())); err != nil {
+						return err
+					}
+				default:
+					return stream.Send(eventMessage(end.Message()))
+				}
+			}
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// terminalEvent tells the events ending an execution.
+func terminalEvent(event pipeline.Event) bool {
+	return event.Type == pipeline.EventExecutionCompleted || event.Type == pipeline.EventExecutionFailed
+}
+
+func eventMessage(event api.ExecutionEvent) *lesoclepb.ExecutionEvent {
+	return &lesoclepb.ExecutionEvent{
+		Type:        event.Type,
+		PipelineId:  event.PipelineID,
+		ExecutionId: event.ExecutionID,
+		Status:      event.Status,
+		StepId:      event.StepID,
+		StepType:    event.StepType,
+		Percent:     event.Percent,
+		Tokens:      int64(event.Tokens),
+		Message:     event.Message,
+		Error:       event.Error,
+		Time:        event.Time,
+	}
+}
+
+// forward performs a REST request with the credentials of the call and
+// decodes its JSON answer into out, the JSON names of the messages being
+// the ones of the REST API.
+func (s *Server) forward(ctx context.Context, method, path string, body interface{}, out proto.Message) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, path, reader)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		req.RemoteAddr = p.Addr.String()
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, key := range forwardedMetadata {
+		if values := md.Get(key); len(values) > 0 {
+			req.Header.Set(key, values[0])
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := &recorder{header: make(http.Header)}
+	s.rest.ServeHTTP(rec, req)
+	if rec.status >= 300 {
+		return status.Error(codeFromHTTP(rec.status), strings.TrimSpace(rec.body.String()))
+	}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(rec.body.Bytes(), out); err != nil {
+		return status.Errorf(codes.Internal, "invalid answer: %v", err)
+	}
+	return nil
+}
+
+func executionPath(ref *lesoclepb.ExecutionRef) string {
+	return "/pipeline/" + url.PathEscape(ref.PipelineId) + "/execution/" + url.PathEscape(ref.ExecutionId)
+}
+
+func codeFromHTTP(httpStatus int) codes.Code {
+	switch {
+	case httpStatus == http.StatusBadRequest || httpStatus == http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case httpStatus == http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case httpStatus == http.StatusForbidden:
+		return codes.PermissionDenied
+	case httpStatus == http.StatusNotFound:
+		return codes.NotFound
+	case httpStatus == http.StatusConflict:
+		return codes.FailedPrecondition
+	case httpStatus == http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case httpStatus == http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case httpStatus < 500:
+		return codes.FailedPrecondition
+	}
+	return codes.Internal
+}
+
+// recorder captures the answer of a forwarded REST request.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header { return r.header }
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *recorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(data)
+}
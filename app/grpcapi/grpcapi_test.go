@@ -0,0 +1,174 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/serisow/lesocle/api"
+	"github.com/serisow/lesocle/grpcapi/lesoclepb"
+	"github.com/serisow/lesocle/pipeline"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dial serves the API over an in-memory listener and returns a client with
+// the credentials in its metadata.
+func dial(t *testing.T, rest http.Handler) (lesoclepb.LesocleClient, context.Context) {
+	listener := bufconn.Listen(1 << 20)
+	srv := New(rest)
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return lesoclepb.NewLesocleClient(conn), metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer token")
+}
+
+func TestUnaryCallsGoThroughTheRESTHandlers(t *testing.T) {
+	rest := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/pipeline/daily/execute":
+			var req api.ExecuteRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(api.ExecutionAccepted{ExecutionID: "exec-1", PipelineID: "daily", UserInput: req.UserInput, Sandbox: req.Sandbox})
+		default:
+			http.Error(w, "Execution ID not found", http.StatusNotFound)
+		}
+	})
+	client, ctx := dial(t, rest)
+
+	for _, options := range [][]grpc.CallOption{nil, {grpc.CallContentSubtype("json")}} {
+		accepted, err := client.ExecutePipeline(ctx, &lesoclepb.ExecuteRequest{PipelineId: "daily", UserInput: "hello", Sandbox: true}, options...)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if accepted.ExecutionId != "exec-1" || accepted.UserInput != "hello" || !accepted.Sandbox {
+			t.Errorf("unexpected answer %v", accepted)
+		}
+	}
+
+	_, err := client.GetExecutionStatus(ctx, &lesoclepb.ExecutionRef{PipelineId: "daily", ExecutionId: "missing"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected NOT_FOUND, got %v", err)
+	}
+	_, err = client.ExecutePipeline(context.Background(), &lesoclepb.ExecuteRequest{PipelineId: "daily"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected UNAUTHENTICATED without credentials, got %v", err)
+	}
+	_, err = client.ExecutePipeline(ctx, &lesoclepb.ExecuteRequest{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected INVALID_ARGUMENT without pipeline, got %v", err)
+	}
+}
+
+func TestWatchExecutionStreamsEventsUntilTheEnd(t *testing.T) {
+	rest := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(api.ExecutionStatus{ExecutionID: "exec-watch", Status: "started"})
+	})
+	client, ctx := dial(t, rest)
+
+	pipeline.ExecutionStore.Lock()
+	pipeline.ExecutionStore.Executions["exec-watch"] = &pipeline.ExecutionResult{PipelineID: "daily", ExecutionID: "exec-watch", Status: pipeline.StatusStarted}
+	pipeline.ExecutionStore.Unlock()
+	defer func() {
+		pipeline.ExecutionStore.Lock()
+		delete(pipeline.ExecutionStore.Executions, "exec-watch")
+		pipeline.ExecutionStore.Unlock()
+	}()
+
+	go func() {
+		// Give the call time to subscribe
+		time.Sleep(100 * time.Millisecond)
+		pipeline.Events.Publish(pipeline.Event{Type: pipeline.EventStepStarted, ExecutionID: "exec-watch", StepID: "write"})
+		pipeline.Events.Publish(pipeline.Event{Type: pipeline.EventExecutionCompleted, ExecutionID: "exec-watch"})
+	}()
+
+	stream, err := client.WatchExecution(ctx, &lesoclepb.ExecutionRef{PipelineId: "daily", ExecutionId: "exec-watch"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var events []*lesoclepb.ExecutionEvent
+	for {
+		event, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		events = append(events, event)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected the status and two events, got %v", events)
+	}
+	if events[1].StepId != "write" || events[2].Type != string(pipeline.EventExecutionCompleted) {
+		t.Errorf("expected the stream to end with the completion, got %v", events)
+	}
+}
+
+func TestWatchExecutionEndsAfterABurst(t *testing.T) {
+	rest := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(api.ExecutionStatus{ExecutionID: "exec-burst", Status: "started"})
+	})
+	client, ctx := dial(t, rest)
+
+	pipeline.ExecutionStore.Lock()
+	pipeline.ExecutionStore.Executions["exec-burst"] = &pipeline.ExecutionResult{PipelineID: "daily", ExecutionID: "exec-burst", Status: pipeline.StatusStarted}
+	pipeline.ExecutionStore.Unlock()
+	defer func() {
+		pipeline.ExecutionStore.Lock()
+		delete(pipeline.ExecutionStore.Executions, "exec-burst")
+		pipeline.ExecutionStore.Unlock()
+	}()
+
+	stream, err := client.WatchExecution(ctx, &lesoclepb.ExecutionRef{PipelineId: "daily", ExecutionId: "exec-burst"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The status is sent once the call subscribed
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// More events than the stream buffers, published faster than it sends
+	for i := 0; i < 1000; i++ {
+		pipeline.Events.Publish(pipeline.Event{Type: pipeline.EventStepProgress, ExecutionID: "exec-burst", StepID: "render"})
+	}
+	pipeline.Events.Publish(pipeline.Event{Type: pipeline.EventExecutionFailed, ExecutionID: "exec-burst"})
+
+	var last *lesoclepb.ExecutionEvent
+	for {
+		event, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("expected the stream to end, got %v", err)
+		}
+		last = event
+	}
+	if last == nil || last.Type != string(pipeline.EventExecutionFailed) {
+		t.Errorf("expected the stream to end with the failure, got %v", last)
+	}
+}
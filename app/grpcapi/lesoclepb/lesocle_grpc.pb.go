@@ -0,0 +1,253 @@
+// The gRPC API of the pipeline service. Clients generated from this file use
+// the protobuf codec, the JSON codec (content-type application/grpc+json) is
+// accepted as well, the JSON names below being the ones of the REST API.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: lesoclepb/lesocle.proto
+
+package lesoclepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Lesocle_ExecutePipeline_FullMethodName     = "/lesocle.v1.Lesocle/ExecutePipeline"
+	Lesocle_GetExecutionStatus_FullMethodName  = "/lesocle.v1.Lesocle/GetExecutionStatus"
+	Lesocle_WatchExecution_FullMethodName      = "/lesocle.v1.Lesocle/WatchExecution"
+	Lesocle_GetArtifactManifest_FullMethodName = "/lesocle.v1.Lesocle/GetArtifactManifest"
+)
+
+// LesocleClient is the client API for Lesocle service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type LesocleClient interface {
+	// Starts an on-demand execution, like POST /pipeline/{id}/execute.
+	ExecutePipeline(ctx context.Context, in *ExecuteRequest, opts ...grpc.CallOption) (*ExecutionAccepted, error)
+	// Returns the status of an execution.
+	GetExecutionStatus(ctx context.Context, in *ExecutionRef, opts ...grpc.CallOption) (*ExecutionStatus, error)
+	// Streams the status, then the execution and step events until the
+	// execution ends.
+	WatchExecution(ctx context.Context, in *ExecutionRef, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ExecutionEvent], error)
+	// Returns the artifact manifest of an execution.
+	GetArtifactManifest(ctx context.Context, in *ExecutionRef, opts ...grpc.CallOption) (*Manifest, error)
+}
+
+type lesocleClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLesocleClient(cc grpc.ClientConnInterface) LesocleClient {
+	return &lesocleClient{cc}
+}
+
+func (c *lesocleClient) ExecutePipeline(ctx context.Context, in *ExecuteRequest, opts ...grpc.CallOption) (*ExecutionAccepted, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExecutionAccepted)
+	err := c.cc.Invoke(ctx, Lesocle_ExecutePipeline_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lesocleClient) GetExecutionStatus(ctx context.Context, in *ExecutionRef, opts ...grpc.CallOption) (*ExecutionStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExecutionStatus)
+	err := c.cc.Invoke(ctx, Lesocle_GetExecutionStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lesocleClient) WatchExecution(ctx context.Context, in *ExecutionRef, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ExecutionEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Lesocle_ServiceDesc.Streams[0], Lesocle_WatchExecution_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ExecutionRef, ExecutionEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Lesocle_WatchExecutionClient = grpc.ServerStreamingClient[ExecutionEvent]
+
+func (c *lesocleClient) GetArtifactManifest(ctx context.Context, in *ExecutionRef, opts ...grpc.CallOption) (*Manifest, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Manifest)
+	err := c.cc.Invoke(ctx, Lesocle_GetArtifactManifest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LesocleServer is the server API for Lesocle service.
+// All implementations must embed UnimplementedLesocleServer
+// for forward compatibility.
+type LesocleServer interface {
+	// Starts an on-demand execution, like POST /pipeline/{id}/execute.
+	ExecutePipeline(context.Context, *ExecuteRequest) (*ExecutionAccepted, error)
+	// Returns the status of an execution.
+	GetExecutionStatus(context.Context, *ExecutionRef) (*ExecutionStatus, error)
+	// Streams the status, then the execution and step events until the
+	// execution ends.
+	WatchExecution(*ExecutionRef, grpc.ServerStreamingServer[ExecutionEvent]) error
+	// Returns the artifact manifest of an execution.
+	GetArtifactManifest(context.Context, *ExecutionRef) (*Manifest, error)
+	mustEmbedUnimplementedLesocleServer()
+}
+
+// UnimplementedLesocleServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedLesocleServer struct{}
+
+func (UnimplementedLesocleServer) ExecutePipeline(context.Context, *ExecuteRequest) (*ExecutionAccepted, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExecutePipeline not implemented")
+}
+func (UnimplementedLesocleServer) GetExecutionStatus(context.Context, *ExecutionRef) (*ExecutionStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetExecutionStatus not implemented")
+}
+func (UnimplementedLesocleServer) WatchExecution(*ExecutionRef, grpc.ServerStreamingServer[ExecutionEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchExecution not implemented")
+}
+func (UnimplementedLesocleServer) GetArtifactManifest(context.Context, *ExecutionRef) (*Manifest, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetArtifactManifest not implemented")
+}
+func (UnimplementedLesocleServer) mustEmbedUnimplementedLesocleServer() {}
+func (UnimplementedLesocleServer) testEmbeddedByValue()                 {}
+
+// UnsafeLesocleServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to LesocleServer will
+// result in compilation errors.
+type UnsafeLesocleServer interface {
+	mustEmbedUnimplementedLesocleServer()
+}
+
+func RegisterLesocleServer(s grpc.ServiceRegistrar, srv LesocleServer) {
+	// If the following call pancis, it indicates UnimplementedLesocleServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Lesocle_ServiceDesc, srv)
+}
+
+func _Lesocle_ExecutePipeline_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExecuteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LesocleServer).ExecutePipeline(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Lesocle_ExecutePipeline_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LesocleServer).ExecutePipeline(ctx, req.(*ExecuteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Lesocle_GetExecutionStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExecutionRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LesocleServer).GetExecutionStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Lesocle_GetExecutionStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LesocleServer).GetExecutionStatus(ctx, req.(*ExecutionRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Lesocle_WatchExecution_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExecutionRef)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LesocleServer).WatchExecution(m, &grpc.GenericServerStream[ExecutionRef, ExecutionEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Lesocle_WatchExecutionServer = grpc.ServerStreamingServer[ExecutionEvent]
+
+func _Lesocle_GetArtifactManifest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExecutionRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LesocleServer).GetArtifactManifest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Lesocle_GetArtifactManifest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LesocleServer).GetArtifactManifest(ctx, req.(*ExecutionRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Lesocle_ServiceDesc is the grpc.ServiceDesc for Lesocle service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Lesocle_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "lesocle.v1.Lesocle",
+	HandlerType: (*LesocleServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ExecutePipeline",
+			Handler:    _Lesocle_ExecutePipeline_Handler,
+		},
+		{
+			MethodName: "GetExecutionStatus",
+			Handler:    _Lesocle_GetExecutionStatus_Handler,
+		},
+		{
+			MethodName: "GetArtifactManifest",
+			Handler:    _Lesocle_GetArtifactManifest_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchExecution",
+			Handler:       _Lesocle_WatchExecution_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "lesoclepb/lesocle.proto",
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/serisow/lesocle/api"
+	"github.com/serisow/lesocle/artifact"
+	"github.com/serisow/lesocle/pipeline"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/requestid"
+	"github.com/serisow/lesocle/scheduler"
+)
+
+// GetArtifactManifest returns the artifact manifest of an execution: the
+// checksum of every media file it produced and, when signing is configured,
+// the Ed25519 signature and public key to verify it.
+func (h *PipelineHandler) GetArtifactManifest(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	pipelineID := vars["id"]
+	executionID := vars["execution_id"]
+
+	manifest, err := artifact.LoadManifest(executionID)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "Manifest not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load manifest", http.StatusInternalServerError)
+		return
+	}
+	if manifest.PipelineID != pipelineID {
+		http.Error(w, "Manifest not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(manifest)
+}
+
+// RegenerateArtifact produces a new version of one artifact of an execution.
+// Only the step that produced it and the steps depending on its output run
+// again, with the parameters of the body applied to the producing step; the
+// other steps reuse their output from the execution. The manifest of the new
+// execution links the artifact to the original one.
+func (h *PipelineHandler) RegenerateArtifact(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sourceExecutionID := vars["execution_id"]
+	artifactID := vars["artifact_id"]
+
+	var requestBody api.RegenerateRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	manifest, err := artifact.LoadManifest(sourceExecutionID)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "Manifest not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load manifest", http.StatusInternalServerError)
+		return
+	}
+	pipelineID := manifest.PipelineID
+
+	if rejectIfStopped(w, pipelineID) {
+		return
+	}
+
+	previous, exists := pipeline.GetExecution(sourceExecutionID)
+	if !exists {
+		http.Error(w, "Execution results are no longer available", http.StatusNotFound)
+		return
+	}
+
+	fullPipeline, err := scheduler.FetchFullPipeline(pipelineID, h.APIHost, h.APIEndpoint)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch pipeline: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	pipeline.ExecutionStore.RLock()
+	plan, err := pipeline.PlanRegeneration(previous, manifest, fullPipeline.Steps, artifactID, requestBody.Parameters)
+	userInput := previous.UserInput
+	pipeline.ExecutionStore.RUnlock()
+	if err != nil {
+		if errors.Is(err, pipeline.ErrArtifactNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	executionID := uuid.New().String()
+
+	if fullPipeline.Context == nil {
+		fullPipeline.Context = pipeline_type.NewContext()
+	}
+	fullPipeline.Context.SetStepOutput("user_input", userInput)
+	fullPipeline.Context.SetUserInput(userInput)
+	fullPipeline.Steps = plan.Steps
+	fullPipeline.StepOverrides = plan.Overrides
+	fullPipeline.ArtifactOrigin = &plan.Origin
+	fullPipeline.RequestID = requestid.FromContext(r.Context())
+
+	go func() {
+		err := pipeline.ExecutePipeline(executionID, &fullPipeline, h.Registry)
+		if err != nil {
+			fmt.Printf("Error regenerating artifact %s of execution %s: %v\n", artifactID, sourceExecutionID, err)
+		}
+	}()
+
+	response := api.ExecutionAccepted{
+		ExecutionID:     executionID,
+		PipelineID:      pipelineID,
+		RegeneratedFrom: &plan.Origin,
+		RerunSteps:      plan.RerunSteps,
+		Status:          "started",
+		SubmittedAt:     time.Now().UTC().Format(time.RFC3339),
+		UserInput:       userInput,
+		Links: map[string]string{
+			"status":   fmt.Sprintf("/pipeline/%s/execution/%s/status", pipelineID, executionID),
+			"results":  fmt.Sprintf("/pipeline/%s/execution/%s/results", pipelineID, executionID),
+			"manifest": fmt.Sprintf("/pipeline/%s/execution/%s/manifest", pipelineID, executionID),
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
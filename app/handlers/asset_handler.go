@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/serisow/lesocle/pipeline"
+)
+
+// maxAssetSize bounds the files pushed as assets.
+const maxAssetSize = 200 << 20
+
+// UploadAsset receives a file for the next execution of a pipeline, as a
+// multipart form with the "file", its "key" and an optional "tag". Steps see
+// it as the "asset_<key>" output. Like triggers, it needs the trigger secret
+// in "X-Trigger-Secret"; the body isn't signed as it may be large.
+func (h *PipelineHandler) UploadAsset(w http.ResponseWriter, r *http.Request) {
+	pipelineID := mux.Vars(r)["id"]
+	if !authorizeAssetRequest(w, r) {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAssetSize)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Expected a multipart form with a file, up to 200 MiB", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	mimeType := header.Header.Get("Content-Type")
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	asset, err := pipeline.SaveAsset(pipelineID, r.FormValue("key"), r.FormValue("tag"), header.Filename, mimeType, file)
+	if err != nil {
+		if errors.Is(err, pipeline.ErrInvalidAssetKey) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Error saving asset for pipeline %s: %v", pipelineID, err)
+		http.Error(w, "Failed to save asset", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(asset)
+}
+
+// ListAssets returns the assets waiting for the next execution of a pipeline.
+func (h *PipelineHandler) ListAssets(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAssetRequest(w, r) {
+		return
+	}
+	assets, err := pipeline.PendingAssets(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if assets == nil {
+		assets = []pipeline.Asset{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"assets": assets})
+}
+
+// DeleteAsset withdraws a pending asset.
+func (h *PipelineHandler) DeleteAsset(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAssetRequest(w, r) {
+		return
+	}
+	vars := mux.Vars(r)
+	if err := pipeline.RemoveAsset(vars["id"], vars["key"]); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func authorizeAssetRequest(w http.ResponseWriter, r *http.Request) bool {
+	if TriggerSecret == "" {
+		http.Error(w, "Asset ingestion is not enabled", http.StatusNotFound)
+		return false
+	}
+	if r.Header.Get("X-Trigger-Secret") == "" || !validTriggerRequest(r, mux.Vars(r)["id"], nil, TriggerSecret, time.Now()) {
+		http.Error(w, "Invalid secret", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
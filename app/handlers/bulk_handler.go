@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/serisow/lesocle/api"
+	"github.com/serisow/lesocle/pipeline"
+	"github.com/serisow/lesocle/requestid"
+	"github.com/serisow/lesocle/scheduler"
+)
+
+// maxBulkItems bounds the executions of a bulk request.
+const maxBulkItems = 100
+
+// BulkJobKind is the kind of the queued executions of bulk requests.
+const BulkJobKind = "bulk"
+
+// ExecutePipelineBulk enqueues one execution of the pipeline per item, the
+// items being trigger payloads. The executions share a batch ID, their
+// batch_id and batch_index fields are added to the payloads.
+func (h *PipelineHandler) ExecutePipelineBulk(w http.ResponseWriter, r *http.Request) {
+	pipelineID := mux.Vars(r)["id"]
+
+	if TriggerQueue == nil {
+		http.Error(w, "Bulk executions require the job queue", http.StatusServiceUnavailable)
+		return
+	}
+
+	var requestBody api.BulkExecuteRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxTriggerPayload)).Decode(&requestBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(requestBody.Items) == 0 || len(requestBody.Items) > maxBulkItems {
+		http.Error(w, fmt.Sprintf("Between 1 and %d items are required", maxBulkItems), http.StatusBadRequest)
+		return
+	}
+
+	if rejectIfStopped(w, pipelineID) {
+		return
+	}
+
+	fullPipeline, err := scheduler.FetchFullPipeline(pipelineID, h.APIHost, h.APIEndpoint)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch pipeline: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if !isPipelineExecutableOnDemand(fullPipeline) {
+		http.Error(w, "This pipeline is not configured for on-demand execution", http.StatusForbidden)
+		return
+	}
+
+	batchID := uuid.New().String()
+	executionIDs := make([]string, len(requestBody.Items))
+	payloads := make([][]byte, len(requestBody.Items))
+	for i, item := range requestBody.Items {
+		item["batch_id"] = batchID
+		item["batch_index"] = i
+		if payloads[i], err = json.Marshal(item); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid item %d: %v", i, err), http.StatusBadRequest)
+			return
+		}
+		executionIDs[i] = uuid.New().String()
+	}
+
+	// Save the batch first so its status is known as soon as a job runs
+	batch := pipeline.NewBatch(batchID, pipelineID, executionIDs)
+	if err := pipeline.SaveBatch(batch); err != nil {
+		log.Printf("Error saving batch %s of pipeline %s: %v", batchID, pipelineID, err)
+		http.Error(w, "Failed to accept the batch", http.StatusInternalServerError)
+		return
+	}
+	// The executions of the items are all correlated with the request
+	requestID := requestid.FromContext(r.Context())
+	for i, payload := range payloads {
+		if _, err := TriggerQueue.Enqueue(BulkJobKind, pipelineID, executionIDs[i], requestID, payload); err != nil {
+			log.Printf("Error enqueuing item %d of batch %s: %v", i, batchID, err)
+			http.Error(w, fmt.Sprintf("Failed to enqueue item %d, the previous ones were accepted in batch %s", i, batchID), http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/batches/"+batchID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(batch.Status())
+}
+
+// GetBatchStatus returns the status of the executions of a bulk request.
+func (h *PipelineHandler) GetBatchStatus(w http.ResponseWriter, r *http.Request) {
+	batch, err := pipeline.LoadBatch(mux.Vars(r)["batch_id"])
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "Batch not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(batch.Status())
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/serisow/lesocle/pipeline"
+)
+
+// GetOutputCacheStats returns the size and hit rate of the step output cache.
+func (h *PipelineHandler) GetOutputCacheStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pipeline.StepOutputCache.Stats())
+}
+
+// PurgeOutputCache empties the step output cache, e.g. after a provider
+// returned bad results that shouldn't be reused.
+func (h *PipelineHandler) PurgeOutputCache(w http.ResponseWriter, r *http.Request) {
+	pipeline.StepOutputCache.Purge()
+	w.WriteHeader(http.StatusNoContent)
+}
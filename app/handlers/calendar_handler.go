@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline"
+	"github.com/serisow/lesocle/scheduler"
+)
+
+const (
+	defaultCalendarDays = 30
+	maxCalendarDays     = 366
+)
+
+// GetScheduleCalendar returns an iCalendar feed of the upcoming scheduled runs,
+// to subscribe to from Outlook or Google Calendar. The "days" query parameter
+// sets the horizon, 30 days by default, and "pipeline_id", comma separated,
+// restricts the feed to some pipelines. Paused and disabled pipelines are
+// left out, they won't run.
+func (h *PipelineHandler) GetScheduleCalendar(w http.ResponseWriter, r *http.Request) {
+	days := defaultCalendarDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > maxCalendarDays {
+			http.Error(w, "days must be between 1 and 366", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	var only map[string]bool
+	if value := r.URL.Query().Get("pipeline_id"); value != "" {
+		only = make(map[string]bool)
+		for _, id := range strings.Split(value, ",") {
+			only[strings.TrimSpace(id)] = true
+		}
+	}
+
+	scheduled, err := scheduler.FetchScheduledPipelines(h.APIHost, h.APIEndpoint)
+	if err != nil {
+		http.Error(w, "Failed to fetch scheduled pipelines", http.StatusBadGateway)
+		return
+	}
+
+	var pipelines []*scheduler.ScheduledPipeline
+	for _, sp := range scheduled {
+		if only != nil && !only[sp.ID] {
+			continue
+		}
+		err := pipeline.Controls.CanSchedule(sp.ID)
+		if errors.Is(err, pipeline.ErrSchedulePaused) || errors.Is(err, pipeline.ErrPipelineDisabled) {
+			continue
+		}
+		pipelines = append(pipelines, sp)
+	}
+
+	now := time.Now()
+	runs := scheduler.ProjectRuns(pipelines, now, now.AddDate(0, 0, days))
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="schedule.ics"`)
+	scheduler.WriteICS(w, runs, now)
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/serisow/lesocle/pipeline"
+)
+
+// GetExecutionContext returns the redacted context of an execution, as
+// persisted in its snapshot. With the at_step query parameter the context is
+// the one right after that step ran, to see what the next step received.
+func (h *PipelineHandler) GetExecutionContext(w http.ResponseWriter, r *http.Request) {
+	snapshot, err := pipeline.LoadContextSnapshot(mux.Vars(r)["execution_id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if stepID := r.URL.Query().Get("at_step"); stepID != "" {
+		snapshot, err = snapshot.AtStep(stepID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot.Redacted())
+}
+
+// GetExecutionDefinition returns the pipeline definition an execution ran, as
+// captured when it started, with secrets redacted.
+func (h *PipelineHandler) GetExecutionDefinition(w http.ResponseWriter, r *http.Request) {
+	definition, err := pipeline.LoadExecutionDefinition(mux.Vars(r)["execution_id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(definition)
+}
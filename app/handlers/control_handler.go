@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/serisow/lesocle/api"
+	"github.com/serisow/lesocle/health"
+	"github.com/serisow/lesocle/pipeline"
+	"github.com/serisow/lesocle/scheduler"
+)
+
+func decodeSwitchRequest(w http.ResponseWriter, r *http.Request) (api.SwitchRequest, bool) {
+	var req api.SwitchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		http.Error(w, `Invalid request body, expected {"enabled": true|false, "reason": "..."}`, http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+// SetMaintenance turns maintenance mode on or off. While it is on no new
+// execution starts, scheduled or on demand, and in-flight ones finish.
+func (h *PipelineHandler) SetMaintenance(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeSwitchRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := pipeline.Controls.SetMaintenance(*req.Enabled, req.Reason); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.Switch(pipeline.Controls.Maintenance()))
+}
+
+// SetPipelineEnabled is the kill switch of a single pipeline.
+func (h *PipelineHandler) SetPipelineEnabled(w http.ResponseWriter, r *http.Request) {
+	pipelineID := mux.Vars(r)["id"]
+	req, ok := decodeSwitchRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := pipeline.Controls.SetPipelineDisabled(pipelineID, !*req.Enabled, req.Reason); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.PipelineSwitch{
+		PipelineID: pipelineID,
+		Enabled:    *req.Enabled,
+		Reason:     req.Reason,
+	})
+}
+
+// PauseSchedule stops the scheduler from starting the pipeline, e.g. during an
+// incident, without editing the pipeline in Drupal. An optional JSON body
+// gives the reason.
+func (h *PipelineHandler) PauseSchedule(w http.ResponseWriter, r *http.Request) {
+	h.setSchedulePaused(w, r, true)
+}
+
+// ResumeSchedule lets the scheduler start the pipeline again.
+func (h *PipelineHandler) ResumeSchedule(w http.ResponseWriter, r *http.Request) {
+	h.setSchedulePaused(w, r, false)
+}
+
+func (h *PipelineHandler) setSchedulePaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	pipelineID := mux.Vars(r)["id"]
+	var req api.ScheduleRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if err := pipeline.Controls.SetSchedulePaused(pipelineID, paused, req.Reason); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.ScheduleState{
+		PipelineID: pipelineID,
+		Paused:     paused,
+		Reason:     req.Reason,
+	})
+}
+
+// ListPausedSchedules returns the paused schedules keyed by pipeline ID.
+func (h *PipelineHandler) ListPausedSchedules(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"paused_schedules": pipeline.Controls.PausedSchedules()})
+}
+
+// Failures is the failure backoff of the scheduler, nil when the scheduler
+// skips failing pipelines for good.
+var Failures *scheduler.FailureTracker
+
+// GetPipelineFailures returns the consecutive failures of a pipeline and when
+// the scheduler will try it again.
+func (h *PipelineHandler) GetPipelineFailures(w http.ResponseWriter, r *http.Request) {
+	if Failures == nil {
+		http.Error(w, "Failure backoff is not enabled", http.StatusNotFound)
+		return
+	}
+	pipelineID := mux.Vars(r)["id"]
+	state, tracked := Failures.Get(pipelineID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"pipeline_id": pipelineID,
+		"tracked":     tracked,
+		"failures":    state,
+	})
+}
+
+// ClearPipelineFailures resets the failures of a pipeline so the scheduler
+// runs it at its next schedule, whatever count Drupal reports.
+func (h *PipelineHandler) ClearPipelineFailures(w http.ResponseWriter, r *http.Request) {
+	if Failures == nil {
+		http.Error(w, "Failure backoff is not enabled", http.StatusNotFound)
+		return
+	}
+	Failures.Clear(mux.Vars(r)["id"])
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LivenessChecks are the local dependencies checked by /healthz, and
+// ReadinessChecks the remote ones /readyz checks on top of them. Set by main.
+var (
+	LivenessChecks  []health.Check
+	ReadinessChecks []health.Check
+)
+
+const healthCheckTimeout = 5 * time.Second
+
+// Healthz reports whether the service accepts new executions, with the report
+// of the local checks such as ffmpeg and storage. Maintenance mode and failed
+// checks answer 503 so load balancers and monitors see it.
+func (h *PipelineHandler) Healthz(w http.ResponseWriter, r *http.Request) {
+	report := health.Run(r.Context(), LivenessChecks, healthCheckTimeout)
+	h.writeHealth(w, report)
+}
+
+// Readyz also checks Drupal is reachable and the LLM keys in use are still
+// accepted, for the probes deciding whether to route executions here.
+func (h *PipelineHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	checks := append(append([]health.Check{}, LivenessChecks...), ReadinessChecks...)
+	if h.Registry != nil {
+		checks = append(checks, health.LLMCredentials(h.Registry.GetLLMService)...)
+	}
+	report := health.Run(r.Context(), checks, healthCheckTimeout)
+	h.writeHealth(w, report)
+}
+
+func (h *PipelineHandler) writeHealth(w http.ResponseWriter, report health.Report) {
+	maintenance := pipeline.Controls.Maintenance()
+	response := map[string]interface{}{
+		"status":             "ok",
+		"maintenance":        maintenance,
+		"disabled_pipelines": pipeline.Controls.DisabledPipelines(),
+		"paused_schedules":   pipeline.Controls.PausedSchedules(),
+		"running_executions": pipeline.RunningExecutions(),
+		"components":         report.Components,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case maintenance.Enabled:
+		response["status"] = "maintenance"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	case !report.Healthy():
+		response["status"] = "unhealthy"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// rejectIfStopped answers the request and returns true when new executions of
+// the pipeline are currently refused.
+func rejectIfStopped(w http.ResponseWriter, pipelineID string) bool {
+	err := pipeline.Controls.CanStart(pipelineID)
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, pipeline.ErrMaintenance):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		http.Error(w, err.Error(), http.StatusConflict)
+	}
+	return true
+}
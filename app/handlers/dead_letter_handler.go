@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/serisow/lesocle/api"
+	"github.com/serisow/lesocle/pipeline"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/requestid"
+	"github.com/serisow/lesocle/scheduler"
+)
+
+// ListDeadLetters returns the executions that exhausted their retries. The
+// optional pipeline_id query parameter restricts the list to one pipeline.
+func (h *PipelineHandler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	deadLetters, err := pipeline.ListDeadLetters(r.URL.Query().Get("pipeline_id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	summaries := make([]map[string]interface{}, 0, len(deadLetters))
+	for _, dl := range deadLetters {
+		summaries = append(summaries, map[string]interface{}{
+			"execution_id":         dl.ExecutionID,
+			"pipeline_id":          dl.PipelineID,
+			"pipeline_label":       dl.PipelineLabel,
+			"error_message":        dl.ErrorMessage,
+			"failed_at":            dl.FailedAt,
+			"redriven_at":          dl.RedrivenAt,
+			"redrive_execution_id": dl.RedriveExecutionID,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"dead_letters": summaries})
+}
+
+// GetDeadLetter returns a dead letter with its context and step results.
+func (h *PipelineHandler) GetDeadLetter(w http.ResponseWriter, r *http.Request) {
+	dl, ok := loadDeadLetter(w, mux.Vars(r)["execution_id"])
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dl)
+}
+
+// DeleteDeadLetter purges a dead letter.
+func (h *PipelineHandler) DeleteDeadLetter(w http.ResponseWriter, r *http.Request) {
+	if err := pipeline.RemoveDeadLetter(mux.Vars(r)["execution_id"]); err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "Dead letter not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RedriveDeadLetter executes the pipeline again with the user input of the
+// failed execution. With "resume": true the steps that completed are not run
+// again, which requires the pipeline definition to be unchanged.
+func (h *PipelineHandler) RedriveDeadLetter(w http.ResponseWriter, r *http.Request) {
+	dl, ok := loadDeadLetter(w, mux.Vars(r)["execution_id"])
+	if !ok {
+		return
+	}
+	if rejectIfStopped(w, dl.PipelineID) {
+		return
+	}
+
+	var requestBody api.RedriveRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	fullPipeline, err := scheduler.FetchFullPipeline(dl.PipelineID, h.APIHost, h.APIEndpoint)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch pipeline: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if requestBody.Resume {
+		if fullPipeline.DefinitionHash() != dl.DefinitionHash {
+			http.Error(w, "Pipeline definition changed since the failure, re-drive without resume", http.StatusConflict)
+			return
+		}
+		overrides, err := dl.CompletedStepOverrides(fullPipeline.Steps)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fullPipeline.StepOverrides = overrides
+	}
+
+	if fullPipeline.Context == nil {
+		fullPipeline.Context = pipeline_type.NewContext()
+	}
+	fullPipeline.Context.SetStepOutput("user_input", dl.UserInput)
+	fullPipeline.Context.SetUserInput(dl.UserInput)
+
+	executionID := uuid.New().String()
+	dl.RedrivenAt = time.Now().UTC().Format(time.RFC3339)
+	dl.RedriveExecutionID = executionID
+	if err := pipeline.SaveDeadLetter(dl); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fullPipeline.RequestID = requestid.FromContext(r.Context())
+
+	go func() {
+		err := pipeline.ExecutePipeline(executionID, &fullPipeline, h.Registry)
+		if err != nil {
+			fmt.Printf("Error re-driving execution %s of pipeline %s: %v\n", dl.ExecutionID, dl.PipelineID, err)
+		}
+	}()
+
+	response := api.ExecutionAccepted{
+		ExecutionID: executionID,
+		PipelineID:  dl.PipelineID,
+		RedriveOf:   dl.ExecutionID,
+		Status:      "started",
+		SubmittedAt: dl.RedrivenAt,
+		UserInput:   dl.UserInput,
+		Links: map[string]string{
+			"status":  fmt.Sprintf("/pipeline/%s/execution/%s/status", dl.PipelineID, executionID),
+			"results": fmt.Sprintf("/pipeline/%s/execution/%s/results", dl.PipelineID, executionID),
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
+func loadDeadLetter(w http.ResponseWriter, executionID string) (*pipeline.DeadLetter, bool) {
+	dl, err := pipeline.LoadDeadLetter(executionID)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "Dead letter not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, "Failed to load dead letter", http.StatusInternalServerError)
+		return nil, false
+	}
+	return dl, true
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/serisow/lesocle/pipeline"
+	"github.com/serisow/lesocle/scheduler"
+)
+
+// EstimateExecution returns the estimated cost and duration range of a run of
+// the pipeline with the user input and step outputs given in the body, so
+// Drupal can check a budget before triggering it.
+func (h *PipelineHandler) EstimateExecution(w http.ResponseWriter, r *http.Request) {
+	pipelineID := mux.Vars(r)["id"]
+
+	var req pipeline.EstimateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	fullPipeline, err := scheduler.FetchFullPipeline(pipelineID, h.APIHost, h.APIEndpoint)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch pipeline: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	estimate, err := pipeline.EstimateExecution(&fullPipeline, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(estimate)
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/serisow/lesocle/logging"
+	"github.com/serisow/lesocle/pipeline"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	defaultLogBackfill = 100
+	logWriteTimeout    = 10 * time.Second
+	// Comments sent while no line is produced keep proxies from closing the stream
+	sseKeepAlive = 15 * time.Second
+)
+
+// StreamExecutionLogsWS tails the raw step logs of an execution over a WebSocket.
+// The last N lines (?backfill=N, default 100) are sent on connect, then new lines
+// are pushed as they are produced until the execution finishes.
+func (h *PipelineHandler) StreamExecutionLogsWS(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	executionID := vars["execution_id"]
+
+	if _, exists := pipeline.GetExecution(executionID); !exists {
+		http.Error(w, "Execution ID not found", http.StatusNotFound)
+		return
+	}
+
+	backfill, err := logBackfill(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	wsServer := websocket.Server{Handshake: checkWebSocketOrigin, Handler: func(ws *websocket.Conn) {
+		defer ws.Close()
+
+		// The HTTP server timeouts would otherwise kill long tails.
+		ws.SetDeadline(time.Time{})
+
+		history, lines, cancel := logging.ExecutionLogs.Subscribe(executionID, backfill)
+		defer cancel()
+
+		// Stop streaming as soon as the client goes away.
+		clientGone := make(chan struct{})
+		go func() {
+			defer close(clientGone)
+			var discard string
+			for {
+				if err := websocket.Message.Receive(ws, &discard); err != nil {
+					return
+				}
+			}
+		}()
+
+		for _, line := range history {
+			if err := sendLogLine(ws, line); err != nil {
+				return
+			}
+		}
+
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					sendLogLine(ws, logging.ExecutionLogLine{
+						ExecutionID: executionID,
+						Level:       "INFO",
+						Message:     "end of stream",
+					})
+					return
+				}
+				if err := sendLogLine(ws, line); err != nil {
+					return
+				}
+			case <-clientGone:
+				return
+			}
+		}
+	}}
+	wsServer.ServeHTTP(w, r)
+}
+
+func sendLogLine(ws *websocket.Conn, line logging.ExecutionLogLine) error {
+	ws.SetWriteDeadline(time.Now().Add(logWriteTimeout))
+	return websocket.JSON.Send(ws, line)
+}
+
+// StreamExecutionLogs tails the step logs of an execution as Server-Sent
+// Events, for clients that can't open a WebSocket such as browsers' EventSource.
+// Lines are sent as "log" events, FFmpeg progress lines as "progress" events,
+// and an "end" event closes the stream once the execution finishes. Backfill
+// works as for the WebSocket tail.
+func (h *PipelineHandler) StreamExecutionLogs(w http.ResponseWriter, r *http.Request) {
+	executionID := mux.Vars(r)["execution_id"]
+
+	if _, exists := pipeline.GetExecution(executionID); !exists {
+		http.Error(w, "Execution ID not found", http.StatusNotFound)
+		return
+	}
+
+	backfill, err := logBackfill(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The HTTP server timeouts would otherwise kill long tails.
+	if err := clearWriteDeadline(w, r); err != nil {
+		log.Printf("Log stream of execution %s keeps the server write timeout: %v", executionID, err)
+	}
+	controller := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	history, lines, cancel := logging.ExecutionLogs.Subscribe(executionID, backfill)
+	defer cancel()
+
+	for _, line := range history {
+		if err := writeLogEvent(w, line); err != nil {
+			return
+		}
+	}
+	if err := controller.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				fmt.Fprintf(w, "event: end\ndata: {\"execution_id\":%q}\n\n", executionID)
+				controller.Flush()
+				return
+			}
+			if err := writeLogEvent(w, line); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeLogEvent writes a log line as a Server-Sent Event.
+func writeLogEvent(w io.Writer, line logging.ExecutionLogLine) error {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	event := "log"
+	if logging.IsFFmpegProgress(line.Message) {
+		event = "progress"
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
+
+// logBackfill returns the number of past lines requested with ?backfill=N.
+func logBackfill(r *http.Request) (int, error) {
+	raw := r.URL.Query().Get("backfill")
+	if raw == "" {
+		return defaultLogBackfill, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("Invalid backfill value")
+	}
+	return value, nil
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/serisow/lesocle/api"
+	"github.com/serisow/lesocle/pipeline"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/requestid"
+)
+
+// maxInlinePipelineSize bounds the pipeline documents posted to ExecuteInlinePipeline.
+const maxInlinePipelineSize = 5 << 20
+
+// ExecuteInlinePipeline runs a pipeline from the definition in the request
+// body, in the format Drupal serves the full pipelines, without the pipeline
+// existing in Drupal. The body may also carry the user_input and sandbox
+// fields of an on-demand execution. The results stay on this service.
+func (h *PipelineHandler) ExecuteInlinePipeline(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxInlinePipelineSize))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	var p pipeline_type.Pipeline
+	var requestBody api.ExecuteRequest
+	if err := json.Unmarshal(body, &p); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid pipeline definition: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(body, &requestBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if p.ID == "" {
+		p.ID = pipeline.InlinePipelinePrefix + uuid.New().String()
+	}
+	p.Inline = true
+
+	if rejectIfStopped(w, p.ID) {
+		return
+	}
+	if err := pipeline.ValidateInline(&p, h.Registry, map[string]interface{}{"user_input": requestBody.UserInput}); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	executionID := uuid.New().String()
+	p.Context = pipeline_type.NewContext()
+	p.Context.SetStepOutput("user_input", requestBody.UserInput)
+	p.Context.SetUserInput(requestBody.UserInput)
+	if requestBody.Sandbox {
+		p.Sandbox = true
+	}
+	p.RequestID = requestid.FromContext(r.Context())
+
+	go func() {
+		if err := pipeline.ExecutePipeline(executionID, &p, h.Registry); err != nil {
+			fmt.Printf("Error executing inline pipeline %s: %v\n", p.ID, err)
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(api.ExecutionAccepted{
+		ExecutionID: executionID,
+		PipelineID:  p.ID,
+		Status:      "started",
+		SubmittedAt: time.Now().UTC().Format(time.RFC3339),
+		UserInput:   requestBody.UserInput,
+		Sandbox:     p.Sandbox,
+		Links: map[string]string{
+			"status":  fmt.Sprintf("/pipeline/%s/execution/%s/status", p.ID, executionID),
+			"results": fmt.Sprintf("/pipeline/%s/execution/%s/results", p.ID, executionID),
+		},
+	})
+}
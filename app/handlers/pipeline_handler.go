@@ -2,18 +2,24 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/serisow/lesocle/api"
+	"github.com/serisow/lesocle/artifact"
 	"github.com/serisow/lesocle/pipeline"
 	"github.com/serisow/lesocle/pipeline_type"
 	"github.com/serisow/lesocle/plugin_registry"
+	"github.com/serisow/lesocle/requestid"
 	"github.com/serisow/lesocle/scheduler"
+	"github.com/serisow/lesocle/signedurl"
 )
 
 type PipelineHandler struct {
@@ -34,12 +40,12 @@ func (h *PipelineHandler) ExecutePipeline(w http.ResponseWriter, r *http.Request
 	vars := mux.Vars(r)
 	pipelineID := vars["id"]
 
-	// Parse user input from request body
-	// Parse user input from request body
-	var requestBody struct {
-		UserInput   string `json:"user_input"`
-		CallbackURL string `json:"callback_url,omitempty"` // Optional
+	if rejectIfStopped(w, pipelineID) {
+		return
 	}
+
+	// Parse user input from request body
+	var requestBody api.ExecuteRequest
 	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
@@ -67,6 +73,11 @@ func (h *PipelineHandler) ExecutePipeline(w http.ResponseWriter, r *http.Request
 	}
 	fullPipeline.Context.SetStepOutput("user_input", requestBody.UserInput)
 	fullPipeline.Context.SetUserInput(requestBody.UserInput)
+	if requestBody.Sandbox {
+		fullPipeline.Sandbox = true
+	}
+
+	fullPipeline.RequestID = requestid.FromContext(r.Context())
 
 	// Execute the pipeline with user input
 	go func() {
@@ -77,13 +88,14 @@ func (h *PipelineHandler) ExecutePipeline(w http.ResponseWriter, r *http.Request
 	}()
 
 	// Build response with execution details
-	response := map[string]interface{}{
-		"execution_id": executionID,
-		"pipeline_id":  pipelineID,
-		"status":       "started",
-		"submitted_at": time.Now().UTC().Format(time.RFC3339),
-		"user_input":   requestBody.UserInput,
-		"links": map[string]string{
+	response := api.ExecutionAccepted{
+		ExecutionID: executionID,
+		PipelineID:  pipelineID,
+		Status:      "started",
+		SubmittedAt: time.Now().UTC().Format(time.RFC3339),
+		UserInput:   requestBody.UserInput,
+		Sandbox:     requestBody.Sandbox,
+		Links: map[string]string{
 			"self":    fmt.Sprintf("/pipeline/%s/execution/%s", pipelineID, executionID),
 			"status":  fmt.Sprintf("/pipeline/%s/execution/%s/status", pipelineID, executionID),
 			"results": fmt.Sprintf("/pipeline/%s/execution/%s/results", pipelineID, executionID),
@@ -109,11 +121,12 @@ func (h *PipelineHandler) GetExecutionStatus(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	response := map[string]interface{}{
-		"execution_id": execResult.ExecutionID,
-		"status":       execResult.Status,
-		"submitted_at": execResult.SubmittedAt,
-		"completed_at": execResult.CompletedAt,
+	response := api.ExecutionStatus{
+		ExecutionID: execResult.ExecutionID,
+		Status:      string(execResult.Status),
+		SubmittedAt: execResult.SubmittedAt,
+		CompletedAt: execResult.CompletedAt,
+		Cost:        execResult.Cost,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -138,22 +151,198 @@ func (h *PipelineHandler) GetExecutionResults(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	response := map[string]interface{}{
-		"execution_id": execResult.ExecutionID,
-		"status":       execResult.Status,
-		"results":      execResult.Results,
-		"completed_at": execResult.CompletedAt,
+	response := api.ExecutionResults{
+		ExecutionID: execResult.ExecutionID,
+		Status:      string(execResult.Status),
+		Results:     execResult.Results,
+		CompletedAt: execResult.CompletedAt,
+		Cost:        execResult.Cost,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// RerunExecution re-executes a pipeline reusing outputs of a previous execution.
+// Steps listed in skip_steps get the output they produced in that execution and
+// steps listed in pinned_outputs get the supplied value, so only the remaining
+// steps actually run.
+func (h *PipelineHandler) RerunExecution(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	pipelineID := vars["id"]
+	previousExecutionID := vars["execution_id"]
+
+	if rejectIfStopped(w, pipelineID) {
+		return
+	}
+
+	var requestBody api.RerunRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	previous, exists := pipeline.GetExecution(previousExecutionID)
+	if !exists {
+		http.Error(w, "Execution ID not found", http.StatusNotFound)
+		return
+	}
+	if previous.PipelineID != pipelineID {
+		http.Error(w, "Execution does not belong to this pipeline", http.StatusBadRequest)
+		return
+	}
+
+	fullPipeline, err := scheduler.FetchFullPipeline(pipelineID, h.APIHost, h.APIEndpoint)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch pipeline: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	pipeline.ExecutionStore.RLock()
+	overrides, err := pipeline.BuildRerunOverrides(previous, fullPipeline.Steps, requestBody.SkipSteps, requestBody.PinnedOutputs)
+	userInput := previous.UserInput
+	pipeline.ExecutionStore.RUnlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if requestBody.UserInput != nil {
+		userInput = *requestBody.UserInput
+	}
+
+	executionID := uuid.New().String()
+
+	if fullPipeline.Context == nil {
+		fullPipeline.Context = pipeline_type.NewContext()
+	}
+	fullPipeline.Context.SetStepOutput("user_input", userInput)
+	fullPipeline.Context.SetUserInput(userInput)
+	fullPipeline.StepOverrides = overrides
+	fullPipeline.RequestID = requestid.FromContext(r.Context())
+
+	go func() {
+		err := pipeline.ExecutePipeline(executionID, &fullPipeline, h.Registry)
+		if err != nil {
+			fmt.Printf("Error executing pipeline rerun %s: %v\n", pipelineID, err)
+		}
+	}()
+
+	response := api.ExecutionAccepted{
+		ExecutionID: executionID,
+		PipelineID:  pipelineID,
+		RerunOf:     previousExecutionID,
+		Status:      "started",
+		SubmittedAt: time.Now().UTC().Format(time.RFC3339),
+		UserInput:   userInput,
+		SkipSteps:   requestBody.SkipSteps,
+		Links: map[string]string{
+			"status":  fmt.Sprintf("/pipeline/%s/execution/%s/status", pipelineID, executionID),
+			"results": fmt.Sprintf("/pipeline/%s/execution/%s/results", pipelineID, executionID),
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ExecuteSingleStep runs one step of the pipeline against the context snapshot
+// of a previous execution, with the current step configuration from Drupal.
+// The optional step_outputs body field replaces values of the snapshot.
+func (h *PipelineHandler) ExecuteSingleStep(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	pipelineID := vars["id"]
+	sourceExecutionID := vars["execution_id"]
+	stepID := vars["step_id"]
+
+	if rejectIfStopped(w, pipelineID) {
+		return
+	}
+
+	var requestBody api.StepRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	snapshot, err := pipeline.LoadContextSnapshot(sourceExecutionID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if snapshot.PipelineID != pipelineID {
+		http.Error(w, "Execution does not belong to this pipeline", http.StatusBadRequest)
+		return
+	}
+
+	fullPipeline, err := scheduler.FetchFullPipeline(pipelineID, h.APIHost, h.APIEndpoint)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch pipeline: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	stepFound := false
+	for _, s := range fullPipeline.Steps {
+		if s.ID == stepID {
+			stepFound = true
+			break
+		}
+	}
+	if !stepFound {
+		http.Error(w, fmt.Sprintf("Step %s not found in pipeline", stepID), http.StatusNotFound)
+		return
+	}
+
+	// Outputs of the snapshot are only meaningful for the definition that produced them
+	if err := snapshot.CheckDefinition(&fullPipeline, stepID); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	fullPipeline.Context = snapshot.Context()
+	for key, value := range requestBody.StepOutputs {
+		fullPipeline.Context.SetStepOutput(key, value)
+	}
+
+	executionID := uuid.New().String()
+
+	go func() {
+		err := pipeline.ExecuteStep(executionID, &fullPipeline, stepID, h.Registry)
+		if err != nil {
+			fmt.Printf("Error executing step %s of pipeline %s: %v\n", stepID, pipelineID, err)
+		}
+	}()
+
+	response := api.ExecutionAccepted{
+		ExecutionID: executionID,
+		PipelineID:  pipelineID,
+		StepID:      stepID,
+		SnapshotOf:  sourceExecutionID,
+		Status:      "started",
+		SubmittedAt: time.Now().UTC().Format(time.RFC3339),
+		Links: map[string]string{
+			"status":  fmt.Sprintf("/pipeline/%s/execution/%s/status", pipelineID, executionID),
+			"results": fmt.Sprintf("/pipeline/%s/execution/%s/results", pipelineID, executionID),
+			"logs":    fmt.Sprintf("/pipeline/%s/execution/%s/logs/ws", pipelineID, executionID),
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
 // ServeImageFile serves image files generated by pipelines (including Gemini)
 func (h *PipelineHandler) ServeImageFile(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	fileID := vars["file_id"]
 
+	if !signedurl.Valid(r) {
+		http.Error(w, "Invalid or expired file URL", http.StatusForbidden)
+		return
+	}
 	if fileID == "" {
 		http.Error(w, "File ID is required", http.StatusBadRequest)
 		return
@@ -210,6 +399,18 @@ func (h *PipelineHandler) ServeImageFile(w http.ResponseWriter, r *http.Request)
 
 	filePath := matches[0]
 
+	// Refuse to serve files that changed since the pipeline produced them
+	checksum, err := artifact.VerifyFile(filePath)
+	if err != nil {
+		if errors.Is(err, artifact.ErrChecksumMismatch) {
+			http.Error(w, "Image integrity check failed", http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "Failed to read image", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("X-Checksum-SHA256", checksum)
+
 	// Set appropriate headers
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filepath.Base(filePath)))
 
@@ -241,3 +442,22 @@ func isPipelineExecutableOnDemand(p pipeline_type.Pipeline) bool {
 	// This should be replaced with actual logic when the Drupal side is updated
 	return true
 }
+
+// ServeSpilledOutput serves a step output that was too large to be sent inline
+// with the execution results.
+func (h *PipelineHandler) ServeSpilledOutput(w http.ResponseWriter, r *http.Request) {
+	if !signedurl.Valid(r) {
+		http.Error(w, "Invalid or expired file URL", http.StatusForbidden)
+		return
+	}
+	filename := filepath.Base(mux.Vars(r)["filename"])
+
+	output := pipeline_type.SpilledOutput{Filename: filename}
+	if _, err := os.Stat(output.Path()); err != nil {
+		http.Error(w, "Output not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	http.ServeFile(w, r, output.Path())
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/serisow/lesocle/api"
+	"github.com/serisow/lesocle/pipeline"
+	"golang.org/x/net/websocket"
+)
+
+// Events buffered per client, progress is dropped for clients falling behind
+const progressBuffer = 64
+
+// progressCommand is a message sent by a WebSocket client.
+type progressCommand struct {
+	Type string `json:"type"`
+}
+
+// StreamExecutionProgress publishes the progress of an execution over a
+// WebSocket: a "status" snapshot on connect, then the execution and step
+// events, including "step.progress" ones with the render percent or the LLM
+// tokens. The stream closes after the execution completes or fails. Clients
+// can send {"type":"cancel"} to cancel the execution.
+func (h *PipelineHandler) StreamExecutionProgress(w http.ResponseWriter, r *http.Request) {
+	executionID := mux.Vars(r)["execution_id"]
+
+	if _, exists := pipeline.GetExecution(executionID); !exists {
+		http.Error(w, "Execution ID not found", http.StatusNotFound)
+		return
+	}
+
+	wsServer := websocket.Server{Handshake: checkWebSocketOrigin, Handler: func(ws *websocket.Conn) {
+		defer ws.Close()
+
+		// The HTTP server timeouts would otherwise kill long executions.
+		ws.SetDeadline(time.Time{})
+
+		// Subscribe before the snapshot so the completion can't be missed
+		events := make(chan pipeline.Event, progressBuffer)
+		unsubscribe := pipeline.Events.Subscribe(func(event pipeline.Event) {
+			if event.ExecutionID != executionID {
+				return
+			}
+			select {
+			case events <- event:
+			default:
+			}
+		})
+		defer unsubscribe()
+
+		clientGone := make(chan struct{})
+		go func() {
+			defer close(clientGone)
+			for {
+				var command progressCommand
+				if err := websocket.JSON.Receive(ws, &command); err != nil {
+					return
+				}
+				if command.Type == "cancel" {
+					if pipeline.CancelExecution(executionID, pipeline.ErrExecutionCancelled) {
+						log.Printf("Execution %s cancelled from its progress channel", executionID)
+					}
+				}
+			}
+		}()
+
+		snapshot, finished := pipeline.StatusEvent(executionID)
+		if err := sendProgress(ws, snapshot); err != nil || finished {
+			return
+		}
+
+		for {
+			select {
+			case event := <-events:
+				if err := sendProgress(ws, event.Message()); err != nil {
+					return
+				}
+				if event.Type == pipeline.EventExecutionCompleted || event.Type == pipeline.EventExecutionFailed {
+					return
+				}
+			case <-clientGone:
+				return
+			}
+		}
+	}}
+	wsServer.ServeHTTP(w, r)
+}
+
+func sendProgress(ws *websocket.Conn, message api.ExecutionEvent) error {
+	ws.SetWriteDeadline(time.Now().Add(logWriteTimeout))
+	return websocket.JSON.Send(ws, message)
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/serisow/lesocle/health"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/scheduler"
+	"github.com/serisow/lesocle/services/action_service"
+	"github.com/serisow/lesocle/services/llm_service"
+)
+
+// ProvidersHealth validates the LLM and social credentials of every scheduled
+// pipeline with a cheap call of each provider, such as listing the models, so
+// a rotated key shows up before the scheduled runs fail. The results are
+// cached for health.CredentialTTL, the circuit breaker of each provider
+// called so far is reported too.
+func (h *PipelineHandler) ProvidersHealth(w http.ResponseWriter, r *http.Request) {
+	scheduled, err := scheduler.FetchScheduledPipelines(h.APIHost, h.APIEndpoint)
+	if err != nil {
+		http.Error(w, "Failed to fetch scheduled pipelines", http.StatusBadGateway)
+		return
+	}
+
+	var pipelines []pipeline_type.Pipeline
+	var checks []health.Check
+	for _, sp := range scheduled {
+		fullPipeline, err := scheduler.FetchFullPipeline(sp.ID, h.APIHost, h.APIEndpoint)
+		if err != nil {
+			// Its credentials are unknown, which is a failure of its own
+			fetchErr := fmt.Errorf("failed to fetch the pipeline: %w", err)
+			checks = append(checks, health.Check{Name: "pipeline:" + sp.ID, Pipelines: []string{sp.ID}, Run: func(ctx context.Context) error {
+				return fetchErr
+			}})
+			continue
+		}
+		pipelines = append(pipelines, fullPipeline)
+	}
+
+	llmLookup := func(string) (llm_service.LLMService, bool) { return nil, false }
+	actionLookup := func(string) (action_service.ActionService, bool) { return nil, false }
+	if h.Registry != nil {
+		llmLookup, actionLookup = h.Registry.GetLLMService, h.Registry.GetActionService
+	}
+	checks = append(checks, health.ProviderChecks(health.PipelineCredentials(pipelines), llmLookup, actionLookup)...)
+	report := health.Run(r.Context(), checks, healthCheckTimeout)
+
+	w.Header().Set("Content-Type", "application/json")
+	if !report.Healthy() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     report.Status,
+		"components": report.Components,
+		"breakers":   llm_service.BreakerStates(),
+	})
+}
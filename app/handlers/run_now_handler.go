@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/serisow/lesocle/api"
+	"github.com/serisow/lesocle/pipeline"
+	"github.com/serisow/lesocle/scheduler"
+)
+
+// Scheduler runs the pipelines started with RunPipelineNow, set by main.
+var Scheduler *scheduler.Scheduler
+
+// RunPipelineNow executes a scheduled pipeline immediately, outside of its
+// schedule. It goes through the scheduler so a pipeline already running,
+// scheduled or not, isn't started twice.
+func (h *PipelineHandler) RunPipelineNow(w http.ResponseWriter, r *http.Request) {
+	pipelineID := mux.Vars(r)["id"]
+	if Scheduler == nil {
+		http.Error(w, "Scheduler is not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	executionID, err := Scheduler.RunNow(pipelineID)
+	switch {
+	case errors.Is(err, pipeline.ErrMaintenance):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	case errors.Is(err, pipeline.ErrPipelineDisabled), errors.Is(err, scheduler.ErrAlreadyRunning):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(api.ExecutionAccepted{
+		ExecutionID: executionID,
+		PipelineID:  pipelineID,
+		Status:      "started",
+		SubmittedAt: time.Now().UTC().Format(time.RFC3339),
+		Links: map[string]string{
+			"status":  fmt.Sprintf("/pipeline/%s/execution/%s/status", pipelineID, executionID),
+			"results": fmt.Sprintf("/pipeline/%s/execution/%s/results", pipelineID, executionID),
+		},
+	})
+}
@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/serisow/lesocle/sla"
+)
+
+// GetSLAReport returns the SLA compliance of the pipelines run by the
+// scheduler since the service started.
+func (h *PipelineHandler) GetSLAReport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"pipelines": sla.Default.Report(),
+	})
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// WebSocketOrigins are the hosts, besides the one serving the request, of
+// the pages allowed to open the WebSockets, set from the configuration.
+var WebSocketOrigins []string
+
+type serverWriterKey struct{}
+
+// KeepStreamsOpen wraps the server handler so the streaming endpoints can lift
+// the server write timeout, which would otherwise close them after a few
+// seconds. The middlewares in between wrap the response writer in a way that
+// hides the deadline control of the connection.
+func KeepStreamsOpen(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), serverWriterKey{}, w)))
+	})
+}
+
+// clearWriteDeadline removes the write deadline of the response, for streams.
+func clearWriteDeadline(w http.ResponseWriter, r *http.Request) error {
+	if serverWriter, ok := r.Context().Value(serverWriterKey{}).(http.ResponseWriter); ok {
+		w = serverWriter
+	}
+	return http.NewResponseController(w).SetWriteDeadline(time.Time{})
+}
+
+// checkWebSocketOrigin is the handshake of the WebSockets. Clients sending no
+// Origin, which aren't browsers, are accepted; browsers only from the host
+// serving the request or WebSocketOrigins, so a page of another site can't
+// read the streams with the credentials of its visitor.
+func checkWebSocketOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid origin %q", origin)
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return nil
+	}
+	for _, host := range WebSocketOrigins {
+		if strings.EqualFold(u.Host, host) {
+			return nil
+		}
+	}
+	return fmt.Errorf("origin %s is not allowed", origin)
+}
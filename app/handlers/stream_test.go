@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/serisow/lesocle/pipeline"
+	"golang.org/x/net/websocket"
+)
+
+func TestCheckWebSocketOrigin(t *testing.T) {
+	previous := WebSocketOrigins
+	WebSocketOrigins = []string{"dashboard.example.com"}
+	defer func() { WebSocketOrigins = previous }()
+
+	tests := []struct {
+		name    string
+		origin  string
+		allowed bool
+	}{
+		{"no origin", "", true},
+		{"same host", "https://api.example.com", true},
+		{"allowed host", "https://Dashboard.example.com", true},
+		{"other site", "https://evil.example", false},
+		{"other port", "https://api.example.com:8443", false},
+		{"opaque origin", "null", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://api.example.com/pipeline/p1/execution/e1/progress", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if err := checkWebSocketOrigin(&websocket.Config{}, r); (err == nil) != tt.allowed {
+				t.Errorf("origin %q: got %v, allowed %v", tt.origin, err, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestProgressWebSocketRejectsOtherSites(t *testing.T) {
+	pipeline.AddExecution("exec-origin", &pipeline.ExecutionResult{ExecutionID: "exec-origin", Status: pipeline.StatusCompleted})
+	defer func() {
+		pipeline.ExecutionStore.Lock()
+		delete(pipeline.ExecutionStore.Executions, "exec-origin")
+		pipeline.ExecutionStore.Unlock()
+	}()
+
+	h := &PipelineHandler{}
+	router := mux.NewRouter()
+	router.HandleFunc("/pipeline/{pipeline_id}/execution/{execution_id}/progress", h.StreamExecutionProgress)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/pipeline/p1/execution/exec-origin/progress"
+
+	if _, err := websocket.Dial(wsURL, "", "https://evil.example"); err == nil {
+		t.Error("expected a page of another site to be rejected")
+	}
+	ws, err := websocket.Dial(wsURL, "", srv.URL)
+	if err != nil {
+		t.Fatalf("expected the same host accepted, got %v", err)
+	}
+	ws.Close()
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/serisow/lesocle/api"
+	"github.com/serisow/lesocle/job_queue"
+	"github.com/serisow/lesocle/pipeline"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/plugin_registry"
+	"github.com/serisow/lesocle/requestid"
+	"github.com/serisow/lesocle/scheduler"
+)
+
+// TriggerSecret authenticates inbound triggers. Triggers are disabled while
+// it is empty.
+var TriggerSecret string
+
+// TriggerQueue persists accepted triggers until they ran. Without it they are
+// executed right away and lost if the service stops first.
+var TriggerQueue *job_queue.Queue
+
+// TriggerJobKind is the kind of the queued trigger jobs.
+const TriggerJobKind = "trigger"
+
+// maxTriggerPayload bounds the body of a trigger request.
+const maxTriggerPayload = 1 << 20
+
+// triggerSignatureTolerance is how far the timestamp of a signed trigger may
+// be from now, so a captured request can't be replayed later.
+const triggerSignatureTolerance = 5 * time.Minute
+
+// TriggerPipeline starts a pipeline from an external event (form submission,
+// CMS publish...). The request is authenticated either with an
+// "X-Signature-256: sha256=<hex HMAC-SHA256 of timestamp.pipeline_id.body>"
+// header, the Unix timestamp being sent in "X-Trigger-Timestamp", or with the
+// secret itself in "X-Trigger-Secret". The payload is available to the steps
+// as the "trigger_payload" output, and its "user_input" field, if any, as the
+// user input.
+func (h *PipelineHandler) TriggerPipeline(w http.ResponseWriter, r *http.Request) {
+	pipelineID := mux.Vars(r)["pipeline_id"]
+
+	if TriggerSecret == "" {
+		http.Error(w, "Triggers are not enabled", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxTriggerPayload))
+	if err != nil {
+		http.Error(w, "Payload too large or unreadable", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if !validTriggerRequest(r, pipelineID, body, TriggerSecret, time.Now()) {
+		log.Printf("Rejected trigger for pipeline %s from %s: invalid signature", pipelineID, r.RemoteAddr)
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	if rejectIfStopped(w, pipelineID) {
+		return
+	}
+
+	fullPipeline, err := scheduler.FetchFullPipeline(pipelineID, h.APIHost, h.APIEndpoint)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch pipeline: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if !isPipelineExecutableOnDemand(fullPipeline) {
+		http.Error(w, "This pipeline is not configured for on-demand execution", http.StatusForbidden)
+		return
+	}
+
+	if fullPipeline.Context == nil {
+		fullPipeline.Context = pipeline_type.NewContext()
+	}
+	userInput := applyTriggerPayload(fullPipeline.Context, body)
+
+	executionID := uuid.New().String()
+	requestID := requestid.FromContext(r.Context())
+	status := "started"
+	if TriggerQueue != nil {
+		// Acknowledge only once the request is on disk, the worker runs it
+		if _, err := TriggerQueue.Enqueue(TriggerJobKind, pipelineID, executionID, requestID, body); err != nil {
+			log.Printf("Error enqueuing trigger for pipeline %s: %v", pipelineID, err)
+			http.Error(w, "Failed to accept the trigger", http.StatusServiceUnavailable)
+			return
+		}
+		status = "queued"
+	} else {
+		fullPipeline.RequestID = requestID
+		go func() {
+			if err := pipeline.ExecutePipeline(executionID, &fullPipeline, h.Registry); err != nil {
+				log.Printf("Error executing triggered pipeline %s: %v", pipelineID, err)
+			}
+		}()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(api.ExecutionAccepted{
+		ExecutionID: executionID,
+		PipelineID:  pipelineID,
+		Status:      status,
+		SubmittedAt: time.Now().UTC().Format(time.RFC3339),
+		UserInput:   userInput,
+		Links: map[string]string{
+			"status":  fmt.Sprintf("/pipeline/%s/execution/%s/status", pipelineID, executionID),
+			"results": fmt.Sprintf("/pipeline/%s/execution/%s/results", pipelineID, executionID),
+		},
+	})
+}
+
+// TriggerJobHandler runs the queued triggers. The pipeline is fetched again
+// so a retried job runs the current definition, correlated with the request
+// that queued the job. Failures to start are retried, the outcome of the
+// execution itself is reported as usual.
+func TriggerJobHandler(apiHost, apiEndpoint string, registry *plugin_registry.PluginRegistry) job_queue.HandlerFunc {
+	return func(_ context.Context, job *job_queue.Job) error {
+		if err := pipeline.Controls.CanStart(job.PipelineID); err != nil {
+			if errors.Is(err, pipeline.ErrMaintenance) {
+				return err
+			}
+			log.Printf("Dropping trigger %s of pipeline %s: %v", job.ID, job.PipelineID, err)
+			return nil
+		}
+
+		fullPipeline, err := scheduler.FetchFullPipeline(job.PipelineID, apiHost, apiEndpoint)
+		if err != nil {
+			return fmt.Errorf("failed to fetch pipeline: %w", err)
+		}
+		if !isPipelineExecutableOnDemand(fullPipeline) {
+			log.Printf("Dropping trigger %s: pipeline %s is no longer executable on demand", job.ID, job.PipelineID)
+			return nil
+		}
+		if fullPipeline.Context == nil {
+			fullPipeline.Context = pipeline_type.NewContext()
+		}
+		applyTriggerPayload(fullPipeline.Context, job.Payload)
+		fullPipeline.RequestID = job.RequestID
+
+		if err := pipeline.ExecutePipeline(job.ExecutionID, &fullPipeline, registry); err != nil {
+			log.Printf("Error executing triggered pipeline %s: %v", job.PipelineID, err)
+		}
+		return nil
+	}
+}
+
+// EnqueueTrigger queues a trigger of the pipeline with the payload, for the
+// triggers that don't come through HTTP such as queue messages. Each trigger
+// gets its own request ID, and the checks of TriggerJobHandler apply when it
+// runs.
+func EnqueueTrigger(pipelineID string, payload []byte) error {
+	if TriggerQueue == nil {
+		return errors.New("trigger queue is not configured")
+	}
+	_, err := TriggerQueue.Enqueue(TriggerJobKind, pipelineID, uuid.New().String(), uuid.New().String(), payload)
+	return err
+}
+
+// validTriggerRequest checks the HMAC signature of the timestamp, pipeline
+// and body, made within the tolerance of now, or the shared secret, in
+// constant time.
+func validTriggerRequest(r *http.Request, pipelineID string, body []byte, secret string, now time.Time) bool {
+	if signature := r.Header.Get(pipeline.SignatureHeader); signature != "" {
+		timestamp := r.Header.Get(pipeline.TimestampHeader)
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return false
+		}
+		if age := now.Sub(time.Unix(seconds, 0)); age > triggerSignatureTolerance || age < -triggerSignatureTolerance {
+			return false
+		}
+		got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+		if err != nil {
+			return false
+		}
+		return hmac.Equal(got, pipeline.TriggerSignature(secret, timestamp, pipelineID, body))
+	}
+	if provided := r.Header.Get("X-Trigger-Secret"); provided != "" {
+		return subtle.ConstantTimeCompare([]byte(provided), []byte(secret)) == 1
+	}
+	return false
+}
+
+// applyTriggerPayload stores the payload in the context and returns the user
+// input taken from it.
+func applyTriggerPayload(c *pipeline_type.Context, body []byte) string {
+	c.SetStepOutput("trigger_payload", string(body))
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err == nil {
+		c.Set("trigger", payload)
+		if userInput, ok := payload["user_input"].(string); ok {
+			c.SetStepOutput("user_input", userInput)
+			c.SetUserInput(userInput)
+			return userInput
+		}
+	}
+	return ""
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/serisow/lesocle/action_step"
+	"github.com/serisow/lesocle/job_queue"
+	"github.com/serisow/lesocle/pipeline"
+	"github.com/serisow/lesocle/pipeline/step"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/plugin_registry"
+	"github.com/serisow/lesocle/requestid"
+	"github.com/serisow/lesocle/scheduler"
+	"github.com/serisow/lesocle/services/action_service"
+)
+
+func signedTrigger(pipelineID, body, secret string, at time.Time) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/triggers/"+pipelineID, strings.NewReader(body))
+	pipeline.SignRequest(req, secret, pipelineID, []byte(body), at)
+	return mux.SetURLVars(req, map[string]string{"pipeline_id": pipelineID})
+}
+
+func TestTriggerPipelineSignature(t *testing.T) {
+	previous := TriggerSecret
+	TriggerSecret = "s3cret"
+	defer func() { TriggerSecret = previous }()
+
+	// Past authentication, the handler fetches the pipeline from Drupal
+	drupal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer drupal.Close()
+	h := NewPipelineHandler(drupal.URL, "/api", plugin_registry.NewPluginRegistry())
+
+	body := `{"user_input":"hello"}`
+	now := time.Now()
+
+	tampered := signedTrigger("p1", body, "s3cret", now)
+	tampered.Body = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"user_input":"bye"}`)).Body
+
+	missing := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/triggers/p1", strings.NewReader(body)), map[string]string{"pipeline_id": "p1"})
+
+	noTimestamp := signedTrigger("p1", body, "s3cret", now)
+	noTimestamp.Header.Del(pipeline.TimestampHeader)
+
+	// A signature made for another pipeline can't trigger this one
+	otherPipeline := signedTrigger("p2", body, "s3cret", now)
+	otherPipeline = mux.SetURLVars(otherPipeline, map[string]string{"pipeline_id": "p1"})
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{"valid", signedTrigger("p1", body, "s3cret", now), http.StatusInternalServerError},
+		{"tampered body", tampered, http.StatusUnauthorized},
+		{"wrong secret", signedTrigger("p1", body, "other", now), http.StatusUnauthorized},
+		{"missing signature", missing, http.StatusUnauthorized},
+		{"missing timestamp", noTimestamp, http.StatusUnauthorized},
+		{"stale", signedTrigger("p1", body, "s3cret", now.Add(-10*time.Minute)), http.StatusUnauthorized},
+		{"future", signedTrigger("p1", body, "s3cret", now.Add(10*time.Minute)), http.StatusUnauthorized},
+		{"other pipeline", otherPipeline, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.TriggerPipeline(rec, tt.req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d (%s)", tt.name, rec.Code, tt.want, strings.TrimSpace(rec.Body.String()))
+		}
+	}
+}
+
+func TestValidTriggerRequestSecretHeader(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/triggers/p1", nil)
+	req.Header.Set("X-Trigger-Secret", "s3cret")
+	if !validTriggerRequest(req, "p1", nil, "s3cret", time.Now()) {
+		t.Error("expected the shared secret to be accepted")
+	}
+	req.Header.Set("X-Trigger-Secret", "guess")
+	if validTriggerRequest(req, "p1", nil, "s3cret", time.Now()) {
+		t.Error("expected a wrong secret to be rejected")
+	}
+}
+
+func TestResultWebhookIsAValidTrigger(t *testing.T) {
+	originalSend := pipeline.SendExecutionResultsFunc
+	snapshotDir, definitionDir, durations := pipeline.SnapshotDir, pipeline.DefinitionDir, pipeline.StepDurations
+	defer func() {
+		pipeline.SendExecutionResultsFunc = originalSend
+		pipeline.SnapshotDir, pipeline.DefinitionDir, pipeline.StepDurations = snapshotDir, definitionDir, durations
+	}()
+	pipeline.SendExecutionResultsFunc = func(pipelineID string, results map[string]interface{}, startTime, endTime int64) error { return nil }
+	// Keep the files of the execution out of the source tree
+	dir := t.TempDir()
+	pipeline.SnapshotDir = filepath.Join(dir, "snapshots")
+	pipeline.DefinitionDir = filepath.Join(dir, "definitions")
+	pipeline.StepDurations = pipeline.NewStepDurationStore(filepath.Join(dir, "step_durations.json"))
+
+	valid := make(chan bool, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		valid <- validTriggerRequest(r, "chained", body, "s3cret", time.Now())
+	}))
+	defer srv.Close()
+
+	registry := plugin_registry.NewPluginRegistry()
+	registry.RegisterActionService("echo", &action_service.MockActionService{
+		Response: func(ctx context.Context, actionConfig string, c *pipeline_type.Context, s *pipeline_type.PipelineStep) string {
+			return "done"
+		},
+	})
+	registry.RegisterStepType("action_step", func() step.Step { return &action_step.ActionStepImpl{} })
+	p := &pipeline_type.Pipeline{
+		ID: "chained",
+		Steps: []pipeline_type.PipelineStep{
+			{ID: "echo", UUID: "uuid-echo", Type: "action_step", StepOutputKey: "echoed",
+				ActionDetails: &pipeline_type.ActionDetails{ActionService: "echo", ExecutionLocation: "go"}},
+		},
+		ResultWebhooks: []pipeline_type.ResultWebhook{{URL: srv.URL, Secret: "s3cret"}},
+	}
+	if err := pipeline.ExecutePipeline("exec-chained", p, registry); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	select {
+	case ok := <-valid:
+		if !ok {
+			t.Error("expected the result webhook to pass the trigger signature check")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the results delivered")
+	}
+}
+
+// staticSource serves a single pipeline in place of Drupal.
+type staticSource struct {
+	pipeline pipeline_type.Pipeline
+}
+
+func (s staticSource) ScheduledPipelines() ([]*scheduler.ScheduledPipeline, error) {
+	return nil, nil
+}
+
+func (s staticSource) Pipeline(id string) (pipeline_type.Pipeline, error) {
+	p := s.pipeline
+	p.Context = pipeline_type.NewContext()
+	return p, nil
+}
+
+func TestQueuedTriggerKeepsRequestID(t *testing.T) {
+	originalSend, originalQueue, originalSource, originalSecret := pipeline.SendExecutionResultsFunc, TriggerQueue, scheduler.Source, TriggerSecret
+	snapshotDir, definitionDir, durations := pipeline.SnapshotDir, pipeline.DefinitionDir, pipeline.StepDurations
+	defer func() {
+		pipeline.SendExecutionResultsFunc, TriggerQueue, scheduler.Source, TriggerSecret = originalSend, originalQueue, originalSource, originalSecret
+		pipeline.SnapshotDir, pipeline.DefinitionDir, pipeline.StepDurations = snapshotDir, definitionDir, durations
+	}()
+	pipeline.SendExecutionResultsFunc = func(pipelineID string, results map[string]interface{}, startTime, endTime int64) error { return nil }
+	dir := t.TempDir()
+	pipeline.SnapshotDir = filepath.Join(dir, "snapshots")
+	pipeline.DefinitionDir = filepath.Join(dir, "definitions")
+	pipeline.StepDurations = pipeline.NewStepDurationStore(filepath.Join(dir, "step_durations.json"))
+	queue, err := job_queue.New(filepath.Join(dir, "queue"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	TriggerQueue = queue
+	TriggerSecret = "s3cret"
+
+	var seenRequestID string
+	registry := plugin_registry.NewPluginRegistry()
+	registry.RegisterActionService("echo", &action_service.MockActionService{
+		Response: func(ctx context.Context, actionConfig string, c *pipeline_type.Context, s *pipeline_type.PipelineStep) string {
+			seenRequestID = requestid.FromContext(ctx)
+			return "done"
+		},
+	})
+	registry.RegisterStepType("action_step", func() step.Step { return &action_step.ActionStepImpl{} })
+	scheduler.Source = staticSource{pipeline: pipeline_type.Pipeline{
+		ID: "queued",
+		Steps: []pipeline_type.PipelineStep{
+			{ID: "echo", UUID: "uuid-echo", Type: "action_step", StepOutputKey: "echoed",
+				ActionDetails: &pipeline_type.ActionDetails{ActionService: "echo", ExecutionLocation: "go"}},
+		},
+	}}
+
+	req := signedTrigger("queued", `{"user_input":"hello"}`, "s3cret", time.Now())
+	req = req.WithContext(requestid.WithID(req.Context(), "req-42"))
+	rec := httptest.NewRecorder()
+	NewPipelineHandler("", "", registry).TriggerPipeline(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected the trigger accepted, got %d (%s)", rec.Code, rec.Body.String())
+	}
+
+	job, err := queue.Lease(time.Now())
+	if err != nil || job == nil {
+		t.Fatalf("expected the queued job, got %v %v", job, err)
+	}
+	if job.RequestID != "req-42" {
+		t.Errorf("expected the job to keep the request ID, got %q", job.RequestID)
+	}
+	if err := TriggerJobHandler("", "", registry)(context.Background(), job); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pipeline.ExecutionStore.RLock()
+	execResult := pipeline.ExecutionStore.Executions[job.ExecutionID]
+	pipeline.ExecutionStore.RUnlock()
+	if execResult == nil || execResult.RequestID != "req-42" || seenRequestID != "req-42" {
+		t.Errorf("expected the execution correlated with req-42, got %+v and %q in the step", execResult, seenRequestID)
+	}
+
+	// Message triggers have no request, they get an ID of their own
+	if err := EnqueueTrigger("queued", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if job, _ := queue.Lease(time.Now()); job == nil || job.RequestID == "" {
+		t.Errorf("expected a request ID for the message trigger, got %+v", job)
+	}
+}
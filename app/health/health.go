@@ -0,0 +1,122 @@
+// Package health checks the dependencies of the service for the liveness and
+// readiness probes.
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Component statuses.
+const (
+	StatusOK     = "ok"
+	StatusFailed = "failed"
+)
+
+// Check verifies one dependency.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+	// The pipelines depending on the checked dependency, if known
+	Pipelines []string
+}
+
+// Component is the outcome of a check.
+type Component struct {
+	Name      string   `json:"name"`
+	Status    string   `json:"status"`
+	Error     string   `json:"error,omitempty"`
+	LatencyMS int64    `json:"latency_ms"`
+	Pipelines []string `json:"pipelines,omitempty"`
+}
+
+// Report is the outcome of a set of checks, failed when any check failed.
+type Report struct {
+	Status     string      `json:"status"`
+	Components []Component `json:"components"`
+}
+
+// Healthy reports whether every check passed.
+func (r Report) Healthy() bool {
+	return r.Status == StatusOK
+}
+
+// Run runs the checks concurrently, each with the timeout.
+func Run(ctx context.Context, checks []Check, timeout time.Duration) Report {
+	components := make([]Component, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			started := time.Now()
+			err := check.Run(checkCtx)
+			components[i] = Component{Name: check.Name, Status: StatusOK, LatencyMS: time.Since(started).Milliseconds(), Pipelines: check.Pipelines}
+			if err != nil {
+				components[i].Status = StatusFailed
+				components[i].Error = err.Error()
+			}
+		}(i, check)
+	}
+	wg.Wait()
+
+	sort.Slice(components, func(i, j int) bool { return components[i].Name < components[j].Name })
+	report := Report{Status: StatusOK, Components: components}
+	for _, component := range components {
+		if component.Status != StatusOK {
+			report.Status = StatusFailed
+		}
+	}
+	return report
+}
+
+// FFmpeg checks ffmpeg is on the PATH.
+func FFmpeg() Check {
+	return Check{Name: "ffmpeg", Run: func(ctx context.Context) error {
+		_, err := exec.LookPath("ffmpeg")
+		return err
+	}}
+}
+
+// WritableDir checks a file can be created in dir, creating it if needed.
+func WritableDir(dir string) Check {
+	return Check{Name: "storage:" + dir, Run: func(ctx context.Context) error {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		f, err := os.CreateTemp(dir, ".healthcheck-*")
+		if err != nil {
+			return err
+		}
+		f.Close()
+		return os.Remove(f.Name())
+	}}
+}
+
+// Reachable checks url answers without a server error. Client errors are
+// fine, the check is about the network path and the server being up.
+func Reachable(name, url string, client *http.Client) Check {
+	return Check{Name: name, Run: func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			return fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return nil
+	}}
+}
@@ -0,0 +1,87 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/serisow/lesocle/services/llm_service"
+)
+
+func TestRunReportsFailedComponents(t *testing.T) {
+	drupal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Not found", http.StatusNotFound)
+	}))
+	defer drupal.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Down", http.StatusBadGateway)
+	}))
+	defer broken.Close()
+
+	readOnly := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(readOnly, nil, 0644)
+
+	storage := filepath.Join(t.TempDir(), "storage")
+	report := Run(context.Background(), []Check{
+		WritableDir(storage),
+		WritableDir(readOnly),
+		Reachable("drupal", drupal.URL, http.DefaultClient),
+		Reachable("broken", broken.URL, http.DefaultClient),
+		{Name: "slow", Run: func(ctx context.Context) error { <-ctx.Done(); return ctx.Err() }},
+	}, 50*time.Millisecond)
+
+	if report.Healthy() {
+		t.Fatal("expected the report failed")
+	}
+	statuses := make(map[string]string)
+	for _, c := range report.Components {
+		statuses[c.Name] = c.Status
+	}
+	for name, status := range map[string]string{"drupal": StatusOK, "broken": StatusFailed, "slow": StatusFailed} {
+		if statuses[name] != status {
+			t.Errorf("expected %s %s, got %q", name, status, statuses[name])
+		}
+	}
+	if statuses["storage:"+storage] != StatusOK {
+		t.Errorf("expected the storage directory created and writable, got %v", statuses)
+	}
+	if statuses["storage:"+readOnly] != StatusFailed {
+		t.Errorf("expected a file in place of the directory to fail, got %v", statuses)
+	}
+}
+
+type validatorService struct {
+	llm_service.MockLLMService
+	calls int
+	err   error
+}
+
+func (s *validatorService) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	s.calls++
+	return s.err
+}
+
+func TestLLMCredentialsAreCached(t *testing.T) {
+	service := &validatorService{err: llm_service.ErrInvalidCredentials}
+	llm_service.Credentials.Remember("health_test_llm", map[string]interface{}{"api_key": "sk-test"})
+	lookup := func(name string) (llm_service.LLMService, bool) {
+		if name == "health_test_llm" {
+			return service, true
+		}
+		return nil, false
+	}
+
+	for i := 0; i < 2; i++ {
+		report := Run(context.Background(), LLMCredentials(lookup), time.Second)
+		if len(report.Components) != 1 || report.Components[0].Name != "llm:health_test_llm" || report.Healthy() {
+			t.Fatalf("expected the rejected key reported, got %+v", report)
+		}
+	}
+	if service.calls != 1 {
+		t.Errorf("expected the provider called once, got %d", service.calls)
+	}
+}
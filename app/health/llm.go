@@ -0,0 +1,93 @@
+package health
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/serisow/lesocle/services/llm_service"
+)
+
+// CredentialTTL is how long a validated key isn't checked again, so frequent
+// probes don't call the providers each time.
+var CredentialTTL = 10 * time.Minute
+
+type credentialResult struct {
+	err       error
+	checkedAt time.Time
+}
+
+var credentialResults = struct {
+	sync.Mutex
+	byKey map[string]credentialResult
+}{byKey: make(map[string]credentialResult)}
+
+// LLMCredentials returns a check per LLM service that was called with an API
+// key and can validate it. Services not called since startup aren't checked,
+// their keys come with the pipelines.
+func LLMCredentials(lookup func(name string) (llm_service.LLMService, bool)) []Check {
+	configs := llm_service.Credentials.Configs()
+	services := make([]string, 0, len(configs))
+	for service := range configs {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	var checks []Check
+	for _, service := range services {
+		instance, ok := lookup(service)
+		if !ok {
+			continue
+		}
+		validator, ok := instance.(llm_service.CredentialValidator)
+		if !ok {
+			continue
+		}
+		config := configs[service]
+		checks = append(checks, Check{Name: "llm:" + service, Run: func(ctx context.Context) error {
+			return validateCached(ctx, service, config, validator)
+		}})
+	}
+	return checks
+}
+
+// credentialFields are the config keys holding the credentials of the LLM
+// and action services, other keys don't change what a check validates.
+var credentialFields = []string{
+	"api_key", "api_url", "access_token", "access_token_secret", "consumer_key",
+	"consumer_secret", "account_sid", "auth_token", "page_id", "instagram_account_id", "api_version", "smtp_host", "username", "password", "provider", "domain", "access_key_id", "secret_access_key", "bucket", "endpoint", "dsn", "dsn_env", "repository", "api_secret", "refresh_token", "client_id", "client_secret", "service_account", "subject", "calendar_id",
+}
+
+// credentialDigest identifies the credentials of a config without keeping
+// them.
+func credentialDigest(config map[string]interface{}) string {
+	hash := sha256.New()
+	for _, field := range credentialFields {
+		value, _ := config[field].(string)
+		hash.Write([]byte(field + "=" + value + "\n"))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func validateCached(ctx context.Context, service string, config map[string]interface{}, validator llm_service.CredentialValidator) error {
+	key := service + ":" + credentialDigest(config)
+
+	credentialResults.Lock()
+	cached, ok := credentialResults.byKey[key]
+	credentialResults.Unlock()
+	if ok && time.Since(cached.checkedAt) < CredentialTTL {
+		return cached.err
+	}
+
+	err := validator.ValidateCredentials(ctx, config)
+	// A probe timing out says nothing about the key
+	if ctx.Err() == nil {
+		credentialResults.Lock()
+		credentialResults.byKey[key] = credentialResult{err: err, checkedAt: time.Now()}
+		credentialResults.Unlock()
+	}
+	return err
+}
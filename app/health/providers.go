@@ -0,0 +1,131 @@
+package health
+
+import (
+	"context"
+	"sort"
+
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/services/action_service"
+	"github.com/serisow/lesocle/services/llm_service"
+)
+
+// Credential kinds.
+const (
+	CredentialLLM    = "llm"
+	CredentialAction = "action"
+)
+
+// Credential is a distinct credential of a service and the pipelines using it.
+type Credential struct {
+	Kind      string
+	Service   string
+	Config    map[string]interface{}
+	Pipelines []string
+}
+
+// PipelineCredentials returns the distinct credentials of the LLM and action
+// steps of the pipelines, and those the LLM services were called with since
+// startup, which pipelines also run inline may have used.
+func PipelineCredentials(pipelines []pipeline_type.Pipeline) []Credential {
+	byDigest := make(map[string]*Credential)
+	var order []string
+	add := func(kind, service string, config map[string]interface{}, pipelineID string) {
+		if service == "" || len(config) == 0 {
+			return
+		}
+		key := kind + ":" + service + ":" + credentialDigest(config)
+		credential, ok := byDigest[key]
+		if !ok {
+			credential = &Credential{Kind: kind, Service: service, Config: config}
+			byDigest[key] = credential
+			order = append(order, key)
+		}
+		if pipelineID != "" && !contains(credential.Pipelines, pipelineID) {
+			credential.Pipelines = append(credential.Pipelines, pipelineID)
+		}
+	}
+
+	for _, p := range pipelines {
+		steps := append(append(append([]pipeline_type.PipelineStep{}, p.BeforeSteps...), p.Steps...), p.AfterSteps...)
+		for _, step := range steps {
+			if service, _ := step.LLMServiceConfig["service_name"].(string); service != "" {
+				add(CredentialLLM, service, step.LLMServiceConfig, p.ID)
+			}
+			if step.ActionDetails != nil {
+				add(CredentialAction, step.ActionDetails.ActionService, step.ActionDetails.Configuration, p.ID)
+			}
+		}
+	}
+	remembered := llm_service.Credentials.Configs()
+	services := make([]string, 0, len(remembered))
+	for service := range remembered {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	for _, service := range services {
+		add(CredentialLLM, service, remembered[service], "")
+	}
+
+	credentials := make([]Credential, 0, len(order))
+	for _, key := range order {
+		credentials = append(credentials, *byDigest[key])
+	}
+	return credentials
+}
+
+// ProviderChecks returns a check per credential whose service can validate
+// it, with the cheapest call of its provider such as listing the models. The
+// checks of a service with several credentials are told apart by the end of
+// their key.
+func ProviderChecks(credentials []Credential, llmLookup func(name string) (llm_service.LLMService, bool), actionLookup func(name string) (action_service.ActionService, bool)) []Check {
+	perService := make(map[string]int)
+	for _, credential := range credentials {
+		perService[credential.Kind+":"+credential.Service]++
+	}
+
+	var checks []Check
+	for _, credential := range credentials {
+		var validator llm_service.CredentialValidator
+		switch credential.Kind {
+		case CredentialLLM:
+			if instance, ok := llmLookup(credential.Service); ok {
+				validator, _ = instance.(llm_service.CredentialValidator)
+			}
+		case CredentialAction:
+			if instance, ok := actionLookup(credential.Service); ok {
+				validator, _ = instance.(action_service.CredentialValidator)
+			}
+		}
+		if validator == nil {
+			continue
+		}
+		name := credential.Kind + ":" + credential.Service
+		if perService[name] > 1 {
+			name += " …" + keyHint(credential.Config)
+		}
+		credential := credential
+		checks = append(checks, Check{Name: name, Pipelines: credential.Pipelines, Run: func(ctx context.Context) error {
+			return validateCached(ctx, credential.Service, credential.Config, validator)
+		}})
+	}
+	return checks
+}
+
+// keyHint returns the last characters of the main secret of a config.
+func keyHint(config map[string]interface{}) string {
+	for _, field := range []string{"api_key", "access_token", "account_sid"} {
+		if value, _ := config[field].(string); len(value) >= 8 {
+			return value[len(value)-4:]
+		}
+	}
+	return "????"
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package health
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/services/action_service"
+	"github.com/serisow/lesocle/services/llm_service"
+)
+
+type keyValidator struct {
+	llm_service.MockLLMService
+	valid string
+}
+
+func (s *keyValidator) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	if config["api_key"] != s.valid {
+		return llm_service.ErrInvalidCredentials
+	}
+	return nil
+}
+
+type validatorAction struct {
+	action_service.MockActionService
+	err error
+}
+
+func (s *validatorAction) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	return s.err
+}
+
+func TestProviderChecks(t *testing.T) {
+	llmStep := func(key string) pipeline_type.PipelineStep {
+		return pipeline_type.PipelineStep{LLMServiceConfig: map[string]interface{}{"service_name": "providers_test_llm", "api_key": key, "model_name": "m"}}
+	}
+	shareStep := pipeline_type.PipelineStep{ActionDetails: &pipeline_type.ActionDetails{
+		ActionService: "providers_test_share",
+		Configuration: map[string]interface{}{"access_token": "expired-token", "page_id": "1"},
+	}}
+	pipelines := []pipeline_type.Pipeline{
+		{ID: "news", Steps: []pipeline_type.PipelineStep{llmStep("sk-good-1234"), shareStep}},
+		{ID: "digest", Steps: []pipeline_type.PipelineStep{llmStep("sk-good-1234")}, AfterSteps: []pipeline_type.PipelineStep{llmStep("sk-old-9876")}},
+	}
+
+	llm := &keyValidator{valid: "sk-good-1234"}
+	llmLookup := func(name string) (llm_service.LLMService, bool) {
+		return llm, name == "providers_test_llm"
+	}
+	actionLookup := func(name string) (action_service.ActionService, bool) {
+		return &validatorAction{err: llm_service.ErrInvalidCredentials}, name == "providers_test_share"
+	}
+
+	credentials := PipelineCredentials(pipelines)
+	checks := ProviderChecks(credentials, llmLookup, actionLookup)
+	if len(checks) != 3 {
+		t.Fatalf("expected 2 LLM keys and 1 share token checked, got %+v", checks)
+	}
+
+	report := Run(context.Background(), checks, time.Second)
+	components := make(map[string]Component)
+	for _, c := range report.Components {
+		components[c.Name] = c
+	}
+	if c := components["llm:providers_test_llm …1234"]; c.Status != StatusOK || len(c.Pipelines) != 2 {
+		t.Errorf("expected the shared key valid and used by both pipelines, got %+v", c)
+	}
+	if c := components["llm:providers_test_llm …9876"]; c.Status != StatusFailed || len(c.Pipelines) != 1 || c.Pipelines[0] != "digest" {
+		t.Errorf("expected the old key failed for digest, got %+v", c)
+	}
+	if c := components["action:providers_test_share"]; c.Status != StatusFailed {
+		t.Errorf("expected the share token rejected, got %+v", c)
+	}
+	if report.Healthy() {
+		t.Error("expected the report failed")
+	}
+}
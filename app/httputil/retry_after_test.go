@@ -0,0 +1,30 @@
+package httputil
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"", false, 0, 0},
+		{"0", true, 0, 0},
+		{"120", true, 2 * time.Minute, 2 * time.Minute},
+		{"-1", false, 0, 0},
+		{"soon", false, 0, 0},
+		{time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), true, 58 * time.Second, time.Minute},
+		{time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), true, 0, 0},
+	}
+	for _, tt := range tests {
+		wait, ok := ParseRetryAfter(tt.value)
+		if ok != tt.ok || wait < tt.min || wait > tt.max {
+			t.Errorf("ParseRetryAfter(%q) = %s, %v, want %s to %s, %v", tt.value, wait, ok, tt.min, tt.max, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+// Package job_queue keeps accepted execution requests on disk until they are
+// processed, so a restart between the acknowledgment and the execution doesn't
+// lose them. Delivery is at least once: a job leased by a worker that
+// crashed is handed out again.
+//
+// The queue is a directory of JSON files rather than a SQLite database: the
+// module has no SQLite driver, the common one needs cgo and a C toolchain in
+// every build, and the service already keeps its state as JSON files under
+// storage/. Each job is its own file, written with fsync and an atomic
+// rename, which is as durable as a SQLite commit for the few jobs a minute
+// the service accepts, and leasing a job is a single rewrite.
+package job_queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultMaxAttempts is the number of times a job is tried before it is
+	// moved to the failed jobs.
+	DefaultMaxAttempts = 5
+	// DefaultLeaseDuration is how long a worker owns a job without renewing
+	// its lease.
+	DefaultLeaseDuration = 2 * time.Minute
+
+	failedDir = "failed"
+)
+
+// ErrJobNotFound is returned for a job that is not in the queue.
+var ErrJobNotFound = errors.New("job not found")
+
+// retryBaseDelay is the wait before the first retry of a failed job, it
+// doubles on each attempt.
+var retryBaseDelay = 5 * time.Second
+
+// Job is an accepted request waiting to be processed.
+type Job struct {
+	ID          string `json:"id"`
+	Kind        string `json:"kind"`
+	PipelineID  string `json:"pipeline_id"`
+	ExecutionID string `json:"execution_id"`
+	// RequestID is the ID of the request the job was accepted for, the
+	// execution is correlated with it
+	RequestID   string `json:"request_id,omitempty"`
+	Payload     []byte `json:"payload,omitempty"`
+	EnqueuedAt  int64  `json:"enqueued_at"`
+	Attempts    int    `json:"attempts"`
+	MaxAttempts int    `json:"max_attempts"`
+	// NotBefore delays the next attempt after a failure
+	NotBefore      int64  `json:"not_before,omitempty"`
+	LeaseExpiresAt int64  `json:"lease_expires_at,omitempty"`
+	LastError      string `json:"last_error,omitempty"`
+}
+
+// Queue is a directory of jobs, one JSON file each, written with fsync and an
+// atomic rename before Enqueue returns.
+type Queue struct {
+	sync.Mutex
+	dir           string
+	leaseDuration time.Duration
+}
+
+// New opens the queue stored in dir. The process owns the queue alone, so the
+// leases of a previous run are released: their workers are gone.
+func New(dir string) (*Queue, error) {
+	if err := os.MkdirAll(filepath.Join(dir, failedDir), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create job queue directory: %w", err)
+	}
+	q := &Queue{dir: dir, leaseDuration: DefaultLeaseDuration}
+
+	jobs, err := q.jobs()
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		if job.LeaseExpiresAt != 0 {
+			log.Printf("Job %s of pipeline %s was interrupted, it will be retried", job.ID, job.PipelineID)
+			job.LeaseExpiresAt = 0
+			if err := q.write(job); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return q, nil
+}
+
+// Enqueue stores a new job for the request requestID. Once it returns the job
+// survives a crash.
+func (q *Queue) Enqueue(kind, pipelineID, executionID, requestID string, payload []byte) (*Job, error) {
+	job := &Job{
+		ID:          uuid.New().String(),
+		Kind:        kind,
+		PipelineID:  pipelineID,
+		ExecutionID: executionID,
+		RequestID:   requestID,
+		EnqueuedAt:  time.Now().UnixNano(),
+		MaxAttempts: DefaultMaxAttempts,
+	}
+	if len(payload) > 0 {
+		job.Payload = payload
+	}
+
+	q.Lock()
+	defer q.Unlock()
+	if err := q.write(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Lease hands out the oldest job ready to run and not leased, nil when there
+// is none. The lease must be renewed before it expires, or the job is handed
+// out again.
+func (q *Queue) Lease(now time.Time) (*Job, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	jobs, err := q.jobs()
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		if job.LeaseExpiresAt > now.Unix() || job.NotBefore > now.Unix() {
+			continue
+		}
+		job.Attempts++
+		job.LeaseExpiresAt = now.Add(q.leaseDuration).Unix()
+		if err := q.write(job); err != nil {
+			return nil, err
+		}
+		return job, nil
+	}
+	return nil, nil
+}
+
+// Renew extends the lease of a job being processed.
+func (q *Queue) Renew(id string, now time.Time) error {
+	q.Lock()
+	defer q.Unlock()
+	job, err := q.read(id)
+	if err != nil {
+		return err
+	}
+	job.LeaseExpiresAt = now.Add(q.leaseDuration).Unix()
+	return q.write(job)
+}
+
+// Complete removes a processed job.
+func (q *Queue) Complete(id string) error {
+	q.Lock()
+	defer q.Unlock()
+	if err := os.Remove(q.path(id)); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", ErrJobNotFound, id)
+		}
+		return fmt.Errorf("failed to remove job %s: %w", id, err)
+	}
+	return nil
+}
+
+// Fail releases a job after a failed attempt. It is retried with exponential
+// backoff, or moved to the failed jobs once its attempts are exhausted.
+func (q *Queue) Fail(id string, jobErr error, now time.Time) error {
+	q.Lock()
+	defer q.Unlock()
+	job, err := q.read(id)
+	if err != nil {
+		return err
+	}
+	job.LastError = jobErr.Error()
+	job.LeaseExpiresAt = 0
+
+	if job.Attempts >= job.MaxAttempts {
+		log.Printf("Job %s of pipeline %s failed %d times, giving up: %v", job.ID, job.PipelineID, job.Attempts, jobErr)
+		data, err := json.MarshalIndent(job, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling job: %w", err)
+		}
+		if err := writeFileSync(filepath.Join(q.dir, failedDir, job.ID+".json"), data); err != nil {
+			return err
+		}
+		return os.Remove(q.path(id))
+	}
+
+	job.NotBefore = now.Add(retryBaseDelay * time.Duration(1<<(job.Attempts-1))).Unix()
+	return q.write(job)
+}
+
+// Len returns the number of jobs waiting or being processed.
+func (q *Queue) Len() int {
+	q.Lock()
+	defer q.Unlock()
+	jobs, err := q.jobs()
+	if err != nil {
+		return 0
+	}
+	return len(jobs)
+}
+
+func (q *Queue) path(id string) string {
+	return filepath.Join(q.dir, filepath.Base(id)+".json")
+}
+
+// jobs returns the queued jobs, oldest first. Callers must hold the lock.
+func (q *Queue) jobs() ([]*Job, error) {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job queue: %w", err)
+	}
+	var jobs []*Job
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		job, err := q.read(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			log.Printf("Skipping unreadable job %s: %v", name, err)
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].EnqueuedAt < jobs[j].EnqueuedAt })
+	return jobs, nil
+}
+
+// read loads a job. Callers must hold the lock.
+func (q *Queue) read(id string) (*Job, error) {
+	data, err := os.ReadFile(q.path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+		}
+		return nil, fmt.Errorf("failed to read job %s: %w", id, err)
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("error decoding job %s: %w", id, err)
+	}
+	return &job, nil
+}
+
+// write persists a job. Callers must hold the lock.
+func (q *Queue) write(job *Job) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling job: %w", err)
+	}
+	return writeFileSync(q.path(job.ID), data)
+}
+
+// writeFileSync replaces path with data, durably: the data is flushed to disk
+// before the rename, and the rename before returning.
+func writeFileSync(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".job-*")
+	if err != nil {
+		return fmt.Errorf("failed to create job file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write job file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync job file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write job file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save job file: %w", err)
+	}
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package job_queue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestQueueRedeliversInterruptedJobs(t *testing.T) {
+	dir := t.TempDir()
+	q, err := New(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	first, err := q.Enqueue("trigger", "p1", "exec-1", "req-1", []byte(`{"user_input":"a"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := q.Enqueue("trigger", "p2", "exec-2", "", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	now := time.Now()
+	leased, err := q.Lease(now)
+	if err != nil || leased == nil || leased.ID != first.ID {
+		t.Fatalf("expected the oldest job to be leased, got %+v, %v", leased, err)
+	}
+	if string(leased.Payload) != `{"user_input":"a"}` {
+		t.Errorf("expected the payload to be kept, got %q", leased.Payload)
+	}
+
+	// A restart releases the leases of the crashed workers
+	reopened, err := New(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reopened.Len() != 2 {
+		t.Fatalf("expected 2 jobs after restart, got %d", reopened.Len())
+	}
+	again, _ := reopened.Lease(now)
+	if again == nil || again.ID != first.ID || again.Attempts != 2 {
+		t.Fatalf("expected the interrupted job to be leased again, got %+v", again)
+	}
+
+	if err := reopened.Complete(again.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reopened.Len() != 1 {
+		t.Errorf("expected 1 job left, got %d", reopened.Len())
+	}
+}
+
+func TestQueueFailRetriesThenGivesUp(t *testing.T) {
+	dir := t.TempDir()
+	q, _ := New(dir)
+	job, _ := q.Enqueue("trigger", "p1", "exec-1", "", nil)
+
+	now := time.Now()
+	for attempt := 1; attempt <= DefaultMaxAttempts; attempt++ {
+		leased, _ := q.Lease(now)
+		if leased == nil {
+			t.Fatalf("expected the job to be leased on attempt %d", attempt)
+		}
+		if err := q.Fail(leased.ID, errors.New("drupal unavailable"), now); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if attempt < DefaultMaxAttempts {
+			if retry, _ := q.Lease(now); retry != nil {
+				t.Fatal("expected the retry to wait for its backoff")
+			}
+			now = now.Add(retryBaseDelay * time.Duration(1<<(attempt-1)))
+		}
+	}
+
+	if q.Len() != 0 {
+		t.Errorf("expected the job to leave the queue, got %d jobs", q.Len())
+	}
+	if _, err := os.Stat(filepath.Join(dir, failedDir, job.ID+".json")); err != nil {
+		t.Errorf("expected the job in the failed jobs: %v", err)
+	}
+}
+
+func TestWorkCompletesJobs(t *testing.T) {
+	defer func(d time.Duration) { pollInterval = d }(pollInterval)
+	pollInterval = 10 * time.Millisecond
+
+	q, _ := New(t.TempDir())
+	q.Enqueue("trigger", "p1", "exec-1", "", nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	processed := make(chan string, 1)
+	stopped := make(chan struct{})
+	go func() {
+		q.Work(ctx, 1, func(ctx context.Context, job *Job) error {
+			processed <- job.ExecutionID
+			return nil
+		})
+		close(stopped)
+	}()
+
+	select {
+	case id := <-processed:
+		if id != "exec-1" {
+			t.Errorf("expected exec-1, got %s", id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("job was not processed")
+	}
+	cancel()
+	<-stopped
+
+	if q.Len() != 0 {
+		t.Error("expected the processed job to be completed")
+	}
+}
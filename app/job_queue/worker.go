@@ -0,0 +1,84 @@
+package job_queue
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// pollInterval is how often idle workers look for new jobs.
+var pollInterval = 1 * time.Second
+
+// HandlerFunc processes a job. A nil error completes it, an error schedules
+// a retry.
+type HandlerFunc func(ctx context.Context, job *Job) error
+
+// Work runs workers processing the jobs of the queue until ctx is done. Jobs
+// being processed when ctx is done keep their lease and are retried after a
+// restart.
+func (q *Queue) Work(ctx context.Context, workers int, handler HandlerFunc) {
+	if workers <= 0 {
+		workers = 1
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx, handler)
+		}()
+	}
+	wg.Wait()
+}
+
+func (q *Queue) work(ctx context.Context, handler HandlerFunc) {
+	for {
+		job, err := q.Lease(time.Now())
+		if err != nil {
+			log.Printf("Error leasing job: %v", err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(pollInterval):
+			}
+			continue
+		}
+		q.process(ctx, job, handler)
+	}
+}
+
+// process runs the handler, renewing the lease of the job meanwhile.
+func (q *Queue) process(ctx context.Context, job *Job, handler HandlerFunc) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(q.leaseDuration / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := q.Renew(job.ID, time.Now()); err != nil {
+					log.Printf("Error renewing lease of job %s: %v", job.ID, err)
+				}
+			}
+		}
+	}()
+
+	err := handler(ctx, job)
+	close(done)
+
+	if err != nil {
+		log.Printf("Job %s of pipeline %s failed (attempt %d/%d): %v", job.ID, job.PipelineID, job.Attempts, job.MaxAttempts, err)
+		if err := q.Fail(job.ID, err, time.Now()); err != nil {
+			log.Printf("Error releasing job %s: %v", job.ID, err)
+		}
+		return
+	}
+	if err := q.Complete(job.ID); err != nil {
+		log.Printf("Error completing job %s: %v", job.ID, err)
+	}
+}
@@ -0,0 +1,215 @@
+// Package jsonschema validates decoded JSON values against the subset of JSON
+// schema the steps use to describe structured LLM answers: type, enum, const,
+// properties, required, additionalProperties, items, the length, size and
+// range bounds, and anyOf.
+package jsonschema
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidationError lists the problems of a value, one per offending path.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "value does not match the schema: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks a value decoded by encoding/json against the schema and
+// returns a *ValidationError listing every problem found.
+func Validate(schema map[string]interface{}, value interface{}) error {
+	var problems []string
+	validate(schema, value, "$", &problems)
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func validate(schema map[string]interface{}, value interface{}, path string, problems *[]string) {
+	report := func(format string, args ...interface{}) {
+		*problems = append(*problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if hasType(value, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			report("expected %s, got %s", strings.Join(types, " or "), typeOf(value))
+			return
+		}
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && !contains(enum, value) {
+		report("%s is not one of the allowed values", describe(value))
+	}
+	if constant, ok := schema["const"]; ok && !equal(constant, value) {
+		report("expected %s", describe(constant))
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok && len(anyOf) > 0 {
+		matched := false
+		for _, option := range anyOf {
+			sub, _ := option.(map[string]interface{})
+			var optionProblems []string
+			validate(sub, value, path, &optionProblems)
+			if len(optionProblems) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			report("matches none of the anyOf schemas")
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, r := range required {
+				name, _ := r.(string)
+				if _, present := v[name]; !present {
+					report("missing required property %q", name)
+				}
+			}
+		}
+		for _, name := range sortedKeys(v) {
+			if sub, ok := properties[name].(map[string]interface{}); ok {
+				validate(sub, v[name], path+"."+name, problems)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					report("unexpected property %q", name)
+				}
+			case map[string]interface{}:
+				validate(additional, v[name], path+"."+name, problems)
+			}
+		}
+	case []interface{}:
+		if n, ok := number(schema["minItems"]); ok && float64(len(v)) < n {
+			report("expected at least %v items, got %d", n, len(v))
+		}
+		if n, ok := number(schema["maxItems"]); ok && float64(len(v)) > n {
+			report("expected at most %v items, got %d", n, len(v))
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				validate(items, item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if n, ok := number(schema["minLength"]); ok && length < n {
+			report("expected at least %v characters, got %v", n, length)
+		}
+		if n, ok := number(schema["maxLength"]); ok && length > n {
+			report("expected at most %v characters, got %v", n, length)
+		}
+	case float64:
+		if n, ok := number(schema["minimum"]); ok && v < n {
+			report("%v is below the minimum %v", v, n)
+		}
+		if n, ok := number(schema["maximum"]); ok && v > n {
+			report("%v is above the maximum %v", v, n)
+		}
+	}
+}
+
+// schemaTypes reads the type keyword, a name or a list of names.
+func schemaTypes(t interface{}) []string {
+	switch v := t.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		types := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func hasType(value interface{}, t string) bool {
+	switch t {
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == math.Trunc(f)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	}
+	return typeOf(value) == t
+}
+
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func contains(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if equal(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// equal compares scalar values, the only ones enum and const are used with.
+func equal(a, b interface{}) bool {
+	return fmt.Sprintf("%T %v", a, a) == fmt.Sprintf("%T %v", b, b)
+}
+
+func describe(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
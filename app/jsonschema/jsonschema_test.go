@@ -0,0 +1,60 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(`{
+		"type": "object",
+		"required": ["title", "tags"],
+		"additionalProperties": false,
+		"properties": {
+			"title": {"type": "string", "minLength": 3},
+			"tags": {"type": "array", "maxItems": 2, "items": {"type": "string"}},
+			"score": {"type": "integer", "minimum": 0, "maximum": 10},
+			"tone": {"enum": ["neutral", "playful"]}
+		}
+	}`), &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		value    string
+		problems int
+	}{
+		{"valid", `{"title": "Breaking", "tags": ["a"], "score": 3, "tone": "neutral"}`, 0},
+		{"missing required", `{"title": "Breaking"}`, 1},
+		{"wrong types", `{"title": 3, "tags": "a"}`, 2},
+		{"bounds", `{"title": "Hi", "tags": ["a", "b", "c"], "score": 11}`, 3},
+		{"not an integer", `{"title": "Breaking", "tags": [], "score": 2.5}`, 1},
+		{"enum and extra property", `{"title": "Breaking", "tags": [], "tone": "angry", "extra": true}`, 2},
+		{"not an object", `["title"]`, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value interface{}
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatal(err)
+			}
+			err := Validate(schema, value)
+			if tt.problems == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("expected a ValidationError, got %v", err)
+			}
+			if len(validationErr.Problems) != tt.problems {
+				t.Errorf("expected %d problems, got %v", tt.problems, validationErr.Problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package llm_step
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/rate_limiter"
+	"github.com/serisow/lesocle/tokenizer"
+)
+
+// defaultReserveTokens are kept for the answer when the budget of the prompt
+// is the context window of the model.
+const defaultReserveTokens = 4096
+
+// minSummaryTokens is the smallest share a source is summarized to, the
+// sources left a smaller share are dropped.
+const minSummaryTokens = 64
+
+// maxSummaryRounds bounds the reduce rounds of a summarization.
+const maxSummaryRounds = 3
+
+// promptSource is a required step output filling placeholders of the prompt.
+type promptSource struct {
+	key      string
+	value    string
+	tokens   int
+	priority int
+	max      int
+}
+
+// assemblePrompt fills the placeholders of the prompt with the required step
+// outputs, fitted in the budget of the prompt assembly of the step. The
+// usage of the summarization calls is returned with the prompt.
+func (s *LLMStepImpl) assemblePrompt(ctx context.Context, pipelineContext *pipeline_type.Context, serviceName, modelName string, tok tokenizer.Tokenizer) (string, pipeline_type.TokenUsage, error) {
+	assembly := s.PipelineStep.PromptAssembly
+	var usage pipeline_type.TokenUsage
+
+	settings := make(map[string]pipeline_type.PromptSource, len(assembly.Sources))
+	for _, source := range assembly.Sources {
+		settings[source.Key] = source
+	}
+	template := s.PipelineStep.Prompt
+	var sources []*promptSource
+	for _, key := range s.PipelineStep.RequiredStepKeys() {
+		value, err := pipelineContext.GetString(key)
+		if err != nil {
+			return "", usage, fmt.Errorf("required step output '%s' not found in context: %w", key, err)
+		}
+		placeholder := fmt.Sprintf("{%s}", key)
+		if !strings.Contains(template, placeholder) {
+			continue
+		}
+		sources = append(sources, &promptSource{
+			key:      key,
+			value:    value,
+			tokens:   tok.Count(value),
+			priority: settings[key].Priority,
+			max:      settings[key].MaxTokens,
+		})
+	}
+
+	budget := assembly.MaxTokens
+	if budget <= 0 {
+		window := tokenizer.ContextWindow(modelName)
+		reserve := assembly.ReserveTokens
+		if reserve <= 0 {
+			reserve = defaultReserveTokens
+		}
+		if window > reserve {
+			budget = window - reserve
+		}
+	}
+	remaining := -1 // unknown window, only the per-source limits apply
+	if budget > 0 {
+		base := template
+		for _, source := range sources {
+			base = strings.ReplaceAll(base, fmt.Sprintf("{%s}", source.key), "")
+		}
+		remaining = budget - tok.Count(base)
+		if remaining < 0 {
+			remaining = 0
+		}
+	}
+
+	// The sources share what the template leaves by priority, in the order
+	// of the required steps for equal priorities
+	ordered := append([]*promptSource(nil), sources...)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].priority > ordered[j].priority })
+	for _, source := range ordered {
+		share := source.tokens
+		if source.max > 0 && share > source.max {
+			share = source.max
+		}
+		if remaining >= 0 && share > remaining {
+			share = remaining
+		}
+		if share < source.tokens {
+			fitted, err := s.fitSource(ctx, pipelineContext, serviceName, source, share, budget, tok, &usage)
+			if err != nil {
+				return "", usage, err
+			}
+			source.value = fitted
+		}
+		if remaining >= 0 {
+			remaining -= tok.Count(source.value)
+			if remaining < 0 {
+				remaining = 0
+			}
+		}
+	}
+
+	prompt := template
+	for _, source := range sources {
+		prompt = strings.ReplaceAll(prompt, fmt.Sprintf("{%s}", source.key), source.value)
+	}
+	return prompt, usage, nil
+}
+
+// fitSource cuts a source to share tokens, by truncation or summarization,
+// and annotates it.
+func (s *LLMStepImpl) fitSource(ctx context.Context, pipelineContext *pipeline_type.Context, serviceName string, source *promptSource, share, budget int, tok tokenizer.Tokenizer, usage *pipeline_type.TokenUsage) (string, error) {
+	var fitted, how string
+	switch {
+	case share == 0 || (s.PipelineStep.PromptAssembly.Overflow == pipeline_type.OverflowSummarize && share < minSummaryTokens):
+		fitted, how = "", "dropped"
+	case s.PipelineStep.PromptAssembly.Overflow == pipeline_type.OverflowSummarize:
+		summary, err := s.summarize(ctx, serviceName, source.value, share, budget, tok, usage)
+		if err != nil {
+			return "", fmt.Errorf("error summarizing output %s for step %s: %w", source.key, s.PipelineStep.ID, err)
+		}
+		fitted, how = summary, "summarized"
+	default:
+		fitted, how = tok.Truncate(source.value, share), "truncated"
+	}
+	pipelineContext.Annotate(s.PipelineStep.ID, pipeline_type.Annotation{
+		Kind:    pipeline_type.AnnotationWarning,
+		Message: fmt.Sprintf("Output %s %s from %d to %d tokens to fit the prompt", source.key, how, source.tokens, tok.Count(fitted)),
+		Sources: []string{source.key},
+	})
+	return fitted, nil
+}
+
+// summarize map-reduces text to target tokens: it is cut in chunks fitting
+// the prompt budget, each summarized by the model, until the summaries fit.
+// What still doesn't fit after maxSummaryRounds is truncated.
+func (s *LLMStepImpl) summarize(ctx context.Context, serviceName, text string, target, budget int, tok tokenizer.Tokenizer, usage *pipeline_type.TokenUsage) (string, error) {
+	chunkTokens := budget - 200 // room for the instruction
+	if budget <= 0 || chunkTokens < 1000 {
+		chunkTokens = 1000
+	}
+	for round := 0; round < maxSummaryRounds && tok.Count(text) > target; round++ {
+		chunks := splitTokens(text, chunkTokens, tok)
+		perChunk := target / len(chunks)
+		if perChunk < minSummaryTokens {
+			perChunk = minSummaryTokens
+		}
+		summaries := make([]string, 0, len(chunks))
+		for _, chunk := range chunks {
+			prompt := fmt.Sprintf("Summarize the following text in at most %d words, keeping the names, figures and facts. Answer with the summary only.\n\n%s", perChunk*3/4, chunk)
+			if err := rate_limiter.Wait(ctx, serviceName); err != nil {
+				return "", err
+			}
+			summary, err := s.LLMServiceInstance.CallLLM(ctx, s.PipelineStep.LLMServiceConfig, prompt)
+			if err != nil {
+				return "", err
+			}
+			usage.Requests++
+			usage.PromptTokens += tok.Count(prompt)
+			usage.CompletionTokens += tok.Count(summary)
+			summaries = append(summaries, strings.TrimSpace(summary))
+		}
+		text = strings.Join(summaries, "\n\n")
+	}
+	if tok.Count(text) > target {
+		text = tok.Truncate(text, target)
+	}
+	return text, nil
+}
+
+// splitTokens cuts text in pieces of at most size tokens.
+func splitTokens(text string, size int, tok tokenizer.Tokenizer) []string {
+	var pieces []string
+	for text != "" {
+		piece := tok.Truncate(text, size)
+		if piece == "" {
+			piece = text
+		}
+		pieces = append(pieces, piece)
+		text = text[len(piece):]
+	}
+	return pieces
+}
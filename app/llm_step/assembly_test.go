@@ -0,0 +1,80 @@
+package llm_step_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/serisow/lesocle/llm_step"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/services/llm_service"
+)
+
+func TestPromptAssembly(t *testing.T) {
+	newStep := func(overflow string, maxTokens int, calls *[]string) *llm_step.LLMStepImpl {
+		return &llm_step.LLMStepImpl{
+			PipelineStep: pipeline_type.PipelineStep{
+				ID:               "brief",
+				Prompt:           "Brief: {headline} {article}",
+				RequiredSteps:    "article\r\nheadline",
+				StepOutputKey:    "brief",
+				LLMServiceConfig: map[string]interface{}{"service_name": "anthropic", "model_name": "claude-3-haiku"},
+				PromptAssembly: &pipeline_type.PromptAssembly{
+					MaxTokens: maxTokens,
+					Overflow:  overflow,
+					Sources:   []pipeline_type.PromptSource{{Key: "headline", Priority: 1}},
+				},
+			},
+			LLMServiceInstance: &llm_service.MockLLMService{
+				CallLLMFunc: func(ctx context.Context, config map[string]interface{}, prompt string) (string, error) {
+					*calls = append(*calls, prompt)
+					if strings.HasPrefix(prompt, "Summarize") {
+						return "Rain floods", nil
+					}
+					return "done", nil
+				},
+			},
+		}
+	}
+	newContext := func() *pipeline_type.Context {
+		c := pipeline_type.NewContext()
+		c.SetStepOutput("headline", "Rain in Dakar")
+		c.SetStepOutput("article", strings.Repeat("word ", 400))
+		return c
+	}
+
+	// The headline has the priority, the article gets what is left
+	var calls []string
+	c := newContext()
+	if err := newStep("", 10, &calls).Execute(context.Background(), c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(calls) != 1 || !strings.HasPrefix(calls[0], "Brief: Rain in Dakar word") || len(calls[0]) > 60 {
+		t.Errorf("expected the article truncated after the headline, got %q", calls)
+	}
+	if annotations := c.Annotations("brief"); len(annotations) == 0 || !strings.Contains(annotations[0].Message, "article truncated") {
+		t.Errorf("expected the truncation annotated, got %v", annotations)
+	}
+
+	// The summarize overflow asks the model for a summary first
+	calls = nil
+	c = newContext()
+	if err := newStep(pipeline_type.OverflowSummarize, 300, &calls).Execute(context.Background(), c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(calls) != 2 || !strings.HasPrefix(calls[0], "Summarize") || calls[1] != "Brief: Rain in Dakar Rain floods" {
+		t.Errorf("expected the article summarized, got %q", calls)
+	}
+	if usage, _ := c.TokenUsage("brief"); usage.Requests != 2 {
+		t.Errorf("expected the summary counted, got %d requests", usage.Requests)
+	}
+
+	// Too small a share isn't worth a summary, the article is dropped
+	calls = nil
+	if err := newStep(pipeline_type.OverflowSummarize, 10, &calls).Execute(context.Background(), newContext()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(calls) != 1 || calls[0] != "Brief: Rain in Dakar " {
+		t.Errorf("expected the article dropped, got %q", calls)
+	}
+}
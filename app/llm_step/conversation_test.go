@@ -0,0 +1,72 @@
+package llm_step_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/serisow/lesocle/llm_step"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/services/llm_service"
+)
+
+// chatService records the conversations it is sent.
+type chatService struct {
+	llm_service.MockLLMService
+	messages []llm_service.Message
+}
+
+func (s *chatService) CallChat(ctx context.Context, config map[string]interface{}, messages []llm_service.Message) (string, error) {
+	s.messages = messages
+	return "Sure, here is a shorter one.", nil
+}
+
+func TestLLMStepConversation(t *testing.T) {
+	step := pipeline_type.PipelineStep{
+		ID:            "rewrite",
+		Prompt:        "Make it shorter than {limit} words.",
+		RequiredSteps: "limit",
+		StepOutputKey: "rewrite",
+		Messages: []pipeline_type.StepMessage{
+			{Role: "system", Content: "You write headlines."},
+			{From: "history"},
+			{Role: "assistant", From: "draft"},
+		},
+	}
+	c := pipeline_type.NewContext()
+	c.SetStepOutput("limit", "8")
+	c.SetStepOutput("history", `[{"role": "user", "content": "Write a headline"}]`)
+	c.SetStepOutput("draft", "A very long headline about the rain in Dakar this week")
+
+	service := &chatService{}
+	impl := &llm_step.LLMStepImpl{PipelineStep: step, LLMServiceInstance: service}
+	if err := impl.Execute(context.Background(), c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	roles := make([]string, 0, len(service.messages))
+	for _, m := range service.messages {
+		roles = append(roles, m.Role)
+	}
+	if got := strings.Join(roles, ","); got != "system,user,assistant,user" {
+		t.Fatalf("unexpected roles %s", got)
+	}
+	if last := service.messages[3].Content; last != "Make it shorter than 8 words." {
+		t.Errorf("unexpected prompt %q", last)
+	}
+
+	// The services without chat messages get the conversation flattened
+	var sent string
+	flat := &llm_service.MockLLMService{
+		CallLLMFunc: func(ctx context.Context, config map[string]interface{}, prompt string) (string, error) {
+			sent = prompt
+			return "ok", nil
+		},
+	}
+	impl = &llm_step.LLMStepImpl{PipelineStep: step, LLMServiceInstance: flat}
+	if err := impl.Execute(context.Background(), c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(sent, "System: You write headlines.\n\nUser: Write a headline\n\nAssistant: A very long") {
+		t.Errorf("unexpected flattened prompt %q", sent)
+	}
+}
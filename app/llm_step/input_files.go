@@ -0,0 +1,71 @@
+package llm_step
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/services/llm_service"
+)
+
+// inputFileParameters map the parameters naming the step output a service
+// reads a file from to the config key the service finds its location at.
+var inputFileParameters = map[string]string{
+	"image_from": llm_service.InputImageKey,
+	"mask_from":  llm_service.InputMaskKey,
+}
+
+// inputFiles returns the config with the locations of the files its
+// parameters take from step outputs, the config itself when there are none.
+func inputFiles(pipelineContext *pipeline_type.Context, config map[string]interface{}) (map[string]interface{}, error) {
+	params, _ := config["parameters"].(map[string]interface{})
+	copied := false
+	for param, configKey := range inputFileParameters {
+		key, _ := params[param].(string)
+		if key == "" {
+			continue
+		}
+		location, err := fileLocation(pipelineContext, key)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", param, err)
+		}
+		if !copied {
+			copied = true
+			withFiles := make(map[string]interface{}, len(config)+len(inputFileParameters))
+			for k, v := range config {
+				withFiles[k] = v
+			}
+			config = withFiles
+		}
+		config[configKey] = location
+	}
+	return config, nil
+}
+
+// fileLocation returns where the file of a step output is: its local path
+// when the file is on this host, else its URL. A plain URL output is taken
+// as it is.
+func fileLocation(pipelineContext *pipeline_type.Context, key string) (string, error) {
+	info, err := pipelineContext.GetFileInfo(key)
+	if err == nil {
+		if info.URI != "" {
+			if _, statErr := os.Stat(info.URI); statErr == nil {
+				return info.URI, nil
+			}
+		}
+		if info.URL != "" {
+			return info.URL, nil
+		}
+		return "", fmt.Errorf("file %s of step output %s is neither local nor has a URL", info.URI, key)
+	}
+	value, stringErr := pipelineContext.GetString(key)
+	if stringErr != nil {
+		return "", stringErr
+	}
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://") {
+		return value, nil
+	}
+	return "", err
+}
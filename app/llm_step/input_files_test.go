@@ -0,0 +1,71 @@
+package llm_step_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/serisow/lesocle/llm_step"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/services/llm_service"
+)
+
+func TestInputFiles(t *testing.T) {
+	local := filepath.Join(t.TempDir(), "scene.png")
+	if err := os.WriteFile(local, []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var config map[string]interface{}
+	step := &llm_step.LLMStepImpl{
+		PipelineStep: pipeline_type.PipelineStep{
+			ID:            "retouch",
+			Prompt:        "Remove the text",
+			StepOutputKey: "retouched",
+			LLMServiceConfig: map[string]interface{}{
+				"service_name": "openai_image",
+				"parameters": map[string]interface{}{
+					"mode":       "edit",
+					"image_from": "scene",
+					"mask_from":  "mask",
+				},
+			},
+		},
+		LLMServiceInstance: &llm_service.MockLLMService{
+			CallLLMFunc: func(ctx context.Context, c map[string]interface{}, prompt string) (string, error) {
+				config = c
+				return "https://example.com/edited.png", nil
+			},
+		},
+	}
+
+	c := pipeline_type.NewContext()
+	c.SetStepOutput("scene", `{"file_id": 1, "uri": "`+local+`", "url": "https://example.com/scene.png", "mime_type": "image/png"}`)
+	c.SetStepOutput("mask", "https://example.com/mask.png")
+	if err := step.Execute(context.Background(), c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config[llm_service.InputImageKey] != local {
+		t.Errorf("expected the local file, got %v", config[llm_service.InputImageKey])
+	}
+	if config[llm_service.InputMaskKey] != "https://example.com/mask.png" {
+		t.Errorf("expected the mask URL, got %v", config[llm_service.InputMaskKey])
+	}
+	if _, ok := step.PipelineStep.LLMServiceConfig[llm_service.InputImageKey]; ok {
+		t.Error("expected the step config to be left alone")
+	}
+
+	// A file of another host is read from its URL
+	c.SetStepOutput("scene", `{"uri": "/elsewhere/scene.png", "url": "https://example.com/scene.png", "mime_type": "image/png"}`)
+	if err := step.Execute(context.Background(), c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config[llm_service.InputImageKey] != "https://example.com/scene.png" {
+		t.Errorf("expected the file URL, got %v", config[llm_service.InputImageKey])
+	}
+
+	if err := step.Execute(context.Background(), pipeline_type.NewContext()); err == nil {
+		t.Error("expected an error for a missing input image")
+	}
+}
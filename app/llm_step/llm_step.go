@@ -2,53 +2,440 @@ package llm_step
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 
+	"github.com/serisow/lesocle/jsonschema"
+	"github.com/serisow/lesocle/logging"
+	"github.com/serisow/lesocle/metrics"
 	"github.com/serisow/lesocle/services/llm_service"
 	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/rate_limiter"
+	"github.com/serisow/lesocle/tokenizer"
 )
 
+// ErrPromptOverBudget is returned when the prompt exceeds the
+// max_prompt_tokens parameter of the step and prompt_overflow isn't
+// "truncate".
+var ErrPromptOverBudget = errors.New("prompt over its token budget")
+
+// llmTokensTotal counts the tokens sent to and received from the LLMs,
+// counted with the tokenizer of the model as the services don't return usage.
+var llmTokensTotal = metrics.NewCounter("lesocle_llm_tokens_total",
+	"Approximate tokens of the LLM prompts and answers.", "service", "model", "type")
+
+// ErrToolRounds is returned when the model still calls tools after the
+// max_tool_rounds of the step.
+var ErrToolRounds = errors.New("too many rounds of tool calls")
+
+// defaultMaxToolRounds bounds the tool calls of the steps setting no limit.
+const defaultMaxToolRounds = 5
+
+// ErrResponseSchema is returned when the answer still doesn't match the
+// response_schema of the step after maxSchemaRepairs repair prompts.
+var ErrResponseSchema = errors.New("answer does not match the response schema")
+
+// maxSchemaRepairs bounds the prompts asking the model to fix its answer.
+const maxSchemaRepairs = 2
+
+// ToolRunner runs a call of a tool of the step and returns its result.
+type ToolRunner func(ctx context.Context, tool pipeline_type.StepTool, arguments map[string]interface{}, pipelineContext *pipeline_type.Context) (string, error)
+
 type LLMStepImpl struct {
     PipelineStep       pipeline_type.PipelineStep
 	LLMServiceInstance llm_service.LLMService
+	// RunTool runs the tool calls of the model, required by steps with tools
+	RunTool ToolRunner
 }
 
 func (s *LLMStepImpl) Execute(ctx context.Context, pipelineContext *pipeline_type.Context) error {
-    // Split required steps
-    requiredSteps := strings.Split(s.PipelineStep.RequiredSteps, "\r\n")
-
-    // Replace placeholders in the prompt with previous step outputs
-    prompt := s.PipelineStep.Prompt
-    for _, requiredStep := range requiredSteps {
-        requiredStep = strings.TrimSpace(requiredStep)
-        if requiredStep == "" {
-            continue
-        }
-        if value, ok := pipelineContext.GetStepOutput(requiredStep); ok {
-            placeholder := fmt.Sprintf("{%s}", requiredStep)
-            prompt = strings.Replace(prompt, placeholder, fmt.Sprintf("%v", value), -1)
-        } else {
-            return fmt.Errorf("required step output '%s' not found in context", requiredStep)
-        }
-    }
 	// Ensure LLMService is not nil
 	if s.LLMServiceInstance == nil {
 		return fmt.Errorf("LLMService is not initialized for step %s", s.PipelineStep.ID)
 	}
+	serviceName, _ := s.PipelineStep.LLMServiceConfig["service_name"].(string)
+	modelName, _ := s.PipelineStep.LLMServiceConfig["model_name"].(string)
+	tok := tokenizer.ForModel(serviceName, modelName)
 
-	// Call the LLM service
-	result, err := s.LLMServiceInstance.CallLLM(ctx, s.PipelineStep.LLMServiceConfig, prompt)
+	// Replace placeholders in the prompt with previous step outputs, fitted
+	// in the context window with a prompt assembly
+	var prompt string
+	var assemblyUsage pipeline_type.TokenUsage
+	var err error
+	if s.PipelineStep.PromptAssembly != nil {
+		prompt, assemblyUsage, err = s.assemblePrompt(ctx, pipelineContext, serviceName, modelName, tok)
+	} else {
+		prompt, err = s.fillPlaceholders(s.PipelineStep.Prompt, pipelineContext)
+	}
+	if err != nil {
+		return err
+	}
+	conversation, err := s.conversation(pipelineContext)
+	if err != nil {
+		return err
+	}
+
+	prompt, usage, err := s.applyTokenBudget(tok, prompt)
+	if err != nil {
+		return err
+	}
+	if usage.Sampling, err = llm_service.SamplingParameters(serviceName, s.PipelineStep.LLMServiceConfig); err != nil {
+		return fmt.Errorf("step %s: %w", s.PipelineStep.ID, err)
+	}
+	config := s.PipelineStep.LLMServiceConfig
+	if schema := s.PipelineStep.ResponseSchema; schema != nil {
+		// The instruction comes after the budget, truncation would cut it
+		instruction, err := schemaInstruction(schema)
+		if err != nil {
+			return fmt.Errorf("invalid response_schema for step %s: %w", s.PipelineStep.ID, err)
+		}
+		prompt += instruction
+		usage.PromptTokens += tok.Count(instruction)
+		// The services supporting it are asked for JSON output
+		config = make(map[string]interface{}, len(s.PipelineStep.LLMServiceConfig)+1)
+		for k, v := range s.PipelineStep.LLMServiceConfig {
+			config[k] = v
+		}
+		config[llm_service.ResponseSchemaKey] = schema
+	}
+	// The files the service reads come from the outputs of earlier steps
+	if config, err = inputFiles(pipelineContext, config); err != nil {
+		return fmt.Errorf("step %s: %w", s.PipelineStep.ID, err)
+	}
+	// The prior turns are sent as they are, only the prompt is budgeted
+	for _, m := range conversation {
+		usage.PromptTokens += tok.Count(m.Content)
+	}
+
+	// Wait for our turn with the provider instead of tripping its 429s
+	if err := rate_limiter.Wait(ctx, serviceName); err != nil {
+		return fmt.Errorf("rate limit wait for step %s: %w", s.PipelineStep.ID, err)
+	}
+
+	// Call the LLM service, the readiness probe checks the key is still valid
+	llm_service.Credentials.Remember(serviceName, s.PipelineStep.LLMServiceConfig)
+	var result string
+	switch {
+	case len(s.PipelineStep.Tools) > 0:
+		result, err = s.callWithTools(ctx, pipelineContext, config, serviceName, conversation, prompt, tok, &usage)
+	case len(conversation) > 0:
+		result, err = s.chat(ctx, config, conversation, prompt)
+	default:
+		result, err = s.LLMServiceInstance.CallLLM(ctx, config, prompt)
+	}
 	if err != nil {
 		return fmt.Errorf("error calling LLM service for step %s: %w", s.PipelineStep.ID, err)
 	}
 
+	// The services don't stream, the tokens are reported once the answer is in
+	usage.CompletionTokens += tok.Count(result)
+	// The summarization calls of the assembly, the tool calls recount the
+	// usage of the conversation
+	usage.Requests += assemblyUsage.Requests
+	usage.PromptTokens += assemblyUsage.PromptTokens
+	usage.CompletionTokens += assemblyUsage.CompletionTokens
+	if s.PipelineStep.ResponseSchema != nil {
+		result, err = s.conformToSchema(ctx, pipelineContext, config, serviceName, conversation, prompt, result, tok, &usage)
+		if err != nil {
+			pipelineContext.RecordTokenUsage(s.PipelineStep.ID, usage)
+			return err
+		}
+	}
+	pipelineContext.RecordTokenUsage(s.PipelineStep.ID, usage)
+	logging.ReportProgress(ctx, logging.Progress{
+		Percent: -1,
+		Tokens:  usage.CompletionTokens,
+		Message: "LLM response received",
+	})
+	llmTokensTotal.Add(float64(usage.PromptTokens), serviceName, modelName, "input")
+	llmTokensTotal.Add(float64(usage.CompletionTokens), serviceName, modelName, "output")
+
+    // Notes the prompt asked the model to leave for the reviewer
+    result, annotations := pipeline_type.ExtractAnnotations(result)
+    if sources := s.PipelineStep.RequiredStepKeys(); len(sources) > 0 {
+        annotations = append(annotations, pipeline_type.Annotation{
+            Kind:    pipeline_type.AnnotationSource,
+            Message: "Outputs included in the prompt",
+            Sources: sources,
+        })
+    }
+    if strings.TrimSpace(result) == "" {
+        annotations = append(annotations, pipeline_type.Annotation{
+            Kind:    pipeline_type.AnnotationWarning,
+            Message: "The model returned an empty answer",
+        })
+    }
+    pipelineContext.Annotate(s.PipelineStep.ID, annotations...)
+
     if s.PipelineStep.StepOutputKey != "" {
         pipelineContext.SetStepOutput(s.PipelineStep.StepOutputKey, result)
     }
 	return nil
 }
 
+// callWithTools converses with the model, running the tools it calls, until
+// it answers without calling any. The calls are annotated for the reviewer
+// and the tokens of every round counted in usage.
+func (s *LLMStepImpl) callWithTools(ctx context.Context, pipelineContext *pipeline_type.Context, config map[string]interface{}, serviceName string, conversation []llm_service.Message, prompt string, tok tokenizer.Tokenizer, usage *pipeline_type.TokenUsage) (string, error) {
+	caller, ok := s.LLMServiceInstance.(llm_service.ToolCaller)
+	if !ok {
+		return "", fmt.Errorf("LLM service %s does not support tool calling", serviceName)
+	}
+	if s.RunTool == nil {
+		return "", fmt.Errorf("no tool runner for step %s", s.PipelineStep.ID)
+	}
+
+	tools := make([]llm_service.Tool, 0, len(s.PipelineStep.Tools))
+	byName := make(map[string]pipeline_type.StepTool, len(s.PipelineStep.Tools))
+	for _, tool := range s.PipelineStep.Tools {
+		tools = append(tools, llm_service.Tool{Name: tool.Name, Description: tool.Description, Parameters: tool.Parameters})
+		byName[tool.Name] = tool
+	}
+	maxRounds := s.PipelineStep.MaxToolRounds
+	if maxRounds <= 0 {
+		maxRounds = defaultMaxToolRounds
+	}
+
+	messages := append(conversation, llm_service.Message{Role: llm_service.RoleUser, Content: prompt})
+	// The first round is counted with the prompt
+	usage.Requests = 0
+	usage.PromptTokens = 0
+	for round := 0; round <= maxRounds; round++ {
+		if round > 0 {
+			if err := rate_limiter.Wait(ctx, serviceName); err != nil {
+				return "", fmt.Errorf("rate limit wait for step %s: %w", s.PipelineStep.ID, err)
+			}
+		}
+		// Each round sends the whole conversation again
+		for _, m := range messages {
+			usage.PromptTokens += tok.Count(m.Content)
+		}
+		usage.Requests++
+
+		response, err := caller.CallWithTools(ctx, config, messages, tools)
+		if err != nil {
+			return "", err
+		}
+		if len(response.ToolCalls) == 0 {
+			return response.Content, nil
+		}
+		if round == maxRounds {
+			break
+		}
+
+		messages = append(messages, llm_service.Message{Role: llm_service.RoleAssistant, Content: response.Content, ToolCalls: response.ToolCalls})
+		usage.CompletionTokens += tok.Count(response.Content)
+		for _, call := range response.ToolCalls {
+			arguments, _ := json.Marshal(call.Arguments)
+			usage.CompletionTokens += tok.Count(string(arguments))
+
+			var output string
+			tool, ok := byName[call.Name]
+			if !ok {
+				output = fmt.Sprintf("Error: unknown tool %q", call.Name)
+			} else if output, err = s.RunTool(ctx, tool, call.Arguments, pipelineContext); err != nil {
+				// The model may recover, with other arguments or another tool
+				output = fmt.Sprintf("Error: %v", err)
+			}
+			pipelineContext.Annotate(s.PipelineStep.ID, pipeline_type.Annotation{
+				Kind:    pipeline_type.AnnotationNote,
+				Message: fmt.Sprintf("Called tool %s with %s", call.Name, arguments),
+			})
+			messages = append(messages, llm_service.Message{Role: llm_service.RoleTool, Content: output, ToolCallID: call.ID})
+		}
+	}
+	return "", fmt.Errorf("%w: step %s allows %d", ErrToolRounds, s.PipelineStep.ID, maxRounds)
+}
+
+// fillPlaceholders replaces the "{step_output_key}" placeholders of the
+// required steps in text with their outputs.
+func (s *LLMStepImpl) fillPlaceholders(text string, pipelineContext *pipeline_type.Context) (string, error) {
+	for _, requiredStep := range strings.Split(s.PipelineStep.RequiredSteps, "\r\n") {
+		requiredStep = strings.TrimSpace(requiredStep)
+		if requiredStep == "" {
+			continue
+		}
+		value, err := pipelineContext.GetString(requiredStep)
+		if err != nil {
+			return "", fmt.Errorf("required step output '%s' not found in context: %w", requiredStep, err)
+		}
+		text = strings.Replace(text, fmt.Sprintf("{%s}", requiredStep), value, -1)
+	}
+	return text, nil
+}
+
+// conversation builds the turns the step sends before its prompt from its
+// messages.
+func (s *LLMStepImpl) conversation(pipelineContext *pipeline_type.Context) ([]llm_service.Message, error) {
+	var messages []llm_service.Message
+	for i, m := range s.PipelineStep.Messages {
+		if m.From == "" {
+			if !validRole(m.Role) {
+				return nil, fmt.Errorf("message %d of step %s has an invalid role %q", i, s.PipelineStep.ID, m.Role)
+			}
+			content, err := s.fillPlaceholders(m.Content, pipelineContext)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, llm_service.Message{Role: m.Role, Content: content})
+			continue
+		}
+
+		value, err := pipelineContext.GetString(m.From)
+		if err != nil {
+			return nil, fmt.Errorf("message %d of step %s: %w", i, s.PipelineStep.ID, err)
+		}
+		// An output holding a conversation brings all its turns
+		var turns []llm_service.Message
+		if err := json.Unmarshal([]byte(pipeline_type.StripCodeFence(value)), &turns); err == nil && m.Role == "" {
+			for _, turn := range turns {
+				if !validRole(turn.Role) {
+					return nil, fmt.Errorf("step output %s holds a message with an invalid role %q", m.From, turn.Role)
+				}
+				messages = append(messages, llm_service.Message{Role: turn.Role, Content: turn.Content})
+			}
+			continue
+		}
+		if !validRole(m.Role) {
+			return nil, fmt.Errorf("message %d of step %s has an invalid role %q", i, s.PipelineStep.ID, m.Role)
+		}
+		messages = append(messages, llm_service.Message{Role: m.Role, Content: value})
+	}
+	return messages, nil
+}
+
+func validRole(role string) bool {
+	return role == llm_service.RoleSystem || role == llm_service.RoleUser || role == llm_service.RoleAssistant
+}
+
+// chat sends the conversation and the prompt, flattened into a single prompt
+// for the services without chat messages.
+func (s *LLMStepImpl) chat(ctx context.Context, config map[string]interface{}, conversation []llm_service.Message, prompt string) (string, error) {
+	messages := append(conversation, llm_service.Message{Role: llm_service.RoleUser, Content: prompt})
+	if caller, ok := s.LLMServiceInstance.(llm_service.ChatCaller); ok {
+		return caller.CallChat(ctx, config, messages)
+	}
+	var flattened strings.Builder
+	for _, m := range conversation {
+		fmt.Fprintf(&flattened, "%s%s: %s\n\n", strings.ToUpper(m.Role[:1]), m.Role[1:], m.Content)
+	}
+	flattened.WriteString(prompt)
+	return s.LLMServiceInstance.CallLLM(ctx, config, flattened.String())
+}
+
+// conformToSchema checks the answer is JSON matching the response_schema of
+// the step, code fences and text around the JSON removed, and asks the model
+// to fix it otherwise. The repair resends the conversation and the prompt,
+// then the invalid answer and what is wrong with it. The repair prompts are
+// counted in usage.
+func (s *LLMStepImpl) conformToSchema(ctx context.Context, pipelineContext *pipeline_type.Context, config map[string]interface{}, serviceName string, conversation []llm_service.Message, prompt, answer string, tok tokenizer.Tokenizer, usage *pipeline_type.TokenUsage) (string, error) {
+	for attempt := 0; ; attempt++ {
+		cleaned, err := checkAnswer(s.PipelineStep.ResponseSchema, answer)
+		if err == nil {
+			if attempt > 0 {
+				pipelineContext.Annotate(s.PipelineStep.ID, pipeline_type.Annotation{
+					Kind:    pipeline_type.AnnotationNote,
+					Message: fmt.Sprintf("The answer matched the response schema after %d repair prompt(s)", attempt),
+				})
+			}
+			return cleaned, nil
+		}
+		if attempt == maxSchemaRepairs {
+			return "", fmt.Errorf("%w: step %s: %v", ErrResponseSchema, s.PipelineStep.ID, err)
+		}
+
+		turns := make([]llm_service.Message, 0, len(conversation)+2)
+		turns = append(turns, conversation...)
+		turns = append(turns,
+			llm_service.Message{Role: llm_service.RoleUser, Content: prompt},
+			llm_service.Message{Role: llm_service.RoleAssistant, Content: answer})
+		repair := fmt.Sprintf("Your previous answer is invalid: %v\nAnswer again with the corrected JSON only.", err)
+		if err := rate_limiter.Wait(ctx, serviceName); err != nil {
+			return "", fmt.Errorf("rate limit wait for step %s: %w", s.PipelineStep.ID, err)
+		}
+		usage.Requests++
+		for _, m := range turns {
+			usage.PromptTokens += tok.Count(m.Content)
+		}
+		usage.PromptTokens += tok.Count(repair)
+		answer, err = s.chat(ctx, config, turns, repair)
+		if err != nil {
+			return "", fmt.Errorf("error calling LLM service to repair the answer of step %s: %w", s.PipelineStep.ID, err)
+		}
+		usage.CompletionTokens += tok.Count(answer)
+	}
+}
+
+// checkAnswer returns the JSON of an answer if it matches the schema. The
+// answer may be wrapped in a code fence or surrounded by prose.
+func checkAnswer(schema map[string]interface{}, answer string) (string, error) {
+	cleaned := strings.TrimSpace(pipeline_type.StripCodeFence(answer))
+	var value interface{}
+	if err := json.Unmarshal([]byte(cleaned), &value); err != nil {
+		start := strings.IndexAny(cleaned, "{[")
+		end := strings.LastIndexAny(cleaned, "}]")
+		if start < 0 || end < start {
+			return "", fmt.Errorf("the answer is not JSON: %v", err)
+		}
+		cleaned = cleaned[start : end+1]
+		if err := json.Unmarshal([]byte(cleaned), &value); err != nil {
+			return "", fmt.Errorf("the answer is not valid JSON: %v", err)
+		}
+	}
+	if err := jsonschema.Validate(schema, value); err != nil {
+		return "", err
+	}
+	return cleaned, nil
+}
+
+// schemaInstruction is appended to the prompt of the steps with a response
+// schema, for the services without a JSON output mode.
+func schemaInstruction(schema map[string]interface{}) (string, error) {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return "", err
+	}
+	return "\n\nAnswer with JSON matching this JSON schema, without any other text:\n" + string(data), nil
+}
+
+// applyTokenBudget counts the tokens of the prompt and enforces the
+// max_prompt_tokens parameter, truncating the prompt when prompt_overflow is
+// "truncate".
+func (s *LLMStepImpl) applyTokenBudget(tok tokenizer.Tokenizer, prompt string) (string, pipeline_type.TokenUsage, error) {
+	modelName, _ := s.PipelineStep.LLMServiceConfig["model_name"].(string)
+	usage := pipeline_type.TokenUsage{Model: modelName, Requests: 1, PromptTokens: tok.Count(prompt), Tokenizer: tok.Name()}
+	params, _ := s.PipelineStep.LLMServiceConfig["parameters"].(map[string]interface{})
+	budget := intParameter(params["max_prompt_tokens"])
+	if budget <= 0 || usage.PromptTokens <= budget {
+		return prompt, usage, nil
+	}
+	if overflow, _ := params["prompt_overflow"].(string); overflow != "truncate" {
+		return "", usage, fmt.Errorf("%w: the prompt of step %s is %d tokens (%s), max_prompt_tokens is %d",
+			ErrPromptOverBudget, s.PipelineStep.ID, usage.PromptTokens, tok.Name(), budget)
+	}
+	prompt = tok.Truncate(prompt, budget)
+	usage.PromptTokens = tok.Count(prompt)
+	usage.Truncated = true
+	return prompt, usage, nil
+}
+
+// intParameter reads a numeric parameter, configured as a number or a string.
+func intParameter(value interface{}) int {
+	switch v := value.(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	case string:
+		var n int
+		fmt.Sscanf(strings.TrimSpace(v), "%d", &n)
+		return n
+	}
+	return 0
+}
+
 func (s *LLMStepImpl) GetType() string {
 	return "llm_step"
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/serisow/lesocle/action_step"
@@ -181,6 +182,12 @@ func TestPipelineWithLLMStep(t *testing.T) {
         Context: ctx,
     }
 
+    // Keep the context snapshot, definition and step durations out of the source tree
+    dir := t.TempDir()
+    pipeline.SnapshotDir = dir
+    pipeline.DefinitionDir = filepath.Join(dir, "definitions")
+    pipeline.StepDurations = pipeline.NewStepDurationStore(filepath.Join(dir, "step_durations.json"))
+
     // Execute pipeline
     err := pipeline.ExecutePipeline("test-execution-id", p, registry)
     if err != nil {
@@ -0,0 +1,124 @@
+package llm_step_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/serisow/lesocle/llm_step"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/services/llm_service"
+)
+
+func TestResponseSchemaRepair(t *testing.T) {
+	newStep := func(answers ...string) (*llm_step.LLMStepImpl, *[]string) {
+		var prompts []string
+		mock := &llm_service.MockLLMService{
+			CallLLMFunc: func(ctx context.Context, config map[string]interface{}, prompt string) (string, error) {
+				if _, ok := config[llm_service.ResponseSchemaKey]; !ok {
+					t.Error("expected the response schema in the service config")
+				}
+				prompts = append(prompts, prompt)
+				answer := answers[0]
+				if len(answers) > 1 {
+					answers = answers[1:]
+				}
+				return answer, nil
+			},
+		}
+		return &llm_step.LLMStepImpl{
+			PipelineStep: pipeline_type.PipelineStep{
+				ID:               "headline",
+				Prompt:           "Write a headline",
+				StepOutputKey:    "headline",
+				LLMServiceConfig: map[string]interface{}{"service_name": "openai"},
+				ResponseSchema: map[string]interface{}{
+					"type":     "object",
+					"required": []interface{}{"title"},
+					"properties": map[string]interface{}{
+						"title": map[string]interface{}{"type": "string"},
+					},
+				},
+			},
+			LLMServiceInstance: mock,
+		}, &prompts
+	}
+
+	step, prompts := newStep("```json\n{\"headline\": \"Rain\"}\n```", "Here it is: {\"title\": \"Rain\"}")
+	c := pipeline_type.NewContext()
+	if err := step.Execute(context.Background(), c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if output, _ := c.GetString("headline"); output != `{"title": "Rain"}` {
+		t.Errorf("expected the repaired JSON alone, got %q", output)
+	}
+	if len(*prompts) != 2 || !strings.Contains((*prompts)[1], `missing required property "title"`) {
+		t.Errorf("expected a repair prompt naming the problem, got %q", *prompts)
+	}
+
+	step, prompts = newStep("not JSON")
+	err := step.Execute(context.Background(), pipeline_type.NewContext())
+	if !errors.Is(err, llm_step.ErrResponseSchema) {
+		t.Fatalf("expected ErrResponseSchema, got %v", err)
+	}
+	if len(*prompts) != 3 {
+		t.Errorf("expected the prompt and 2 repairs, got %d calls", len(*prompts))
+	}
+}
+
+// answeringChatService answers the conversations it is sent in turn.
+type answeringChatService struct {
+	llm_service.MockLLMService
+	answers []string
+	calls   [][]llm_service.Message
+}
+
+func (s *answeringChatService) CallChat(ctx context.Context, config map[string]interface{}, messages []llm_service.Message) (string, error) {
+	s.calls = append(s.calls, messages)
+	answer := s.answers[0]
+	s.answers = s.answers[1:]
+	return answer, nil
+}
+
+func TestResponseSchemaRepairResendsConversation(t *testing.T) {
+	service := &answeringChatService{answers: []string{`{"headline": "Rain"}`, `{"title": "Rain"}`}}
+	step := &llm_step.LLMStepImpl{
+		PipelineStep: pipeline_type.PipelineStep{
+			ID:               "headline",
+			Prompt:           "Write a headline",
+			StepOutputKey:    "headline",
+			LLMServiceConfig: map[string]interface{}{"service_name": "openai"},
+			Messages:         []pipeline_type.StepMessage{{Role: "system", Content: "You write headlines."}},
+			ResponseSchema: map[string]interface{}{
+				"type":     "object",
+				"required": []interface{}{"title"},
+			},
+		},
+		LLMServiceInstance: service,
+	}
+	c := pipeline_type.NewContext()
+	if err := step.Execute(context.Background(), c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if output, _ := c.GetString("headline"); output != `{"title": "Rain"}` {
+		t.Errorf("expected the repaired JSON, got %q", output)
+	}
+	if len(service.calls) != 2 {
+		t.Fatalf("expected the prompt and a repair, got %d calls", len(service.calls))
+	}
+
+	// The repair keeps the system message, the prompt and the invalid answer
+	repair := service.calls[1]
+	var roles []string
+	for _, m := range repair {
+		roles = append(roles, m.Role)
+	}
+	if got := strings.Join(roles, ","); got != "system,user,assistant,user" {
+		t.Fatalf("unexpected roles %s", got)
+	}
+	if repair[0].Content != "You write headlines." || !strings.HasPrefix(repair[1].Content, "Write a headline") ||
+		repair[2].Content != `{"headline": "Rain"}` || !strings.Contains(repair[3].Content, `missing required property "title"`) {
+		t.Errorf("unexpected repair conversation %+v", repair)
+	}
+}
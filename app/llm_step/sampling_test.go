@@ -0,0 +1,80 @@
+package llm_step_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/serisow/lesocle/llm_step"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/services/llm_service"
+)
+
+func TestSamplingParametersRecorded(t *testing.T) {
+	tests := []struct {
+		name    string
+		service string
+		params  map[string]interface{}
+		want    map[string]interface{}
+	}{
+		{
+			name:    "deterministic preset",
+			service: "openai",
+			params:  map[string]interface{}{"preset": "deterministic"},
+			want:    map[string]interface{}{"preset": "deterministic", "temperature": 0.0, "top_p": 1.0, "seed": float64(llm_service.DeterministicSeed)},
+		},
+		{
+			name:    "explicit values win over the preset",
+			service: "openai",
+			params:  map[string]interface{}{"preset": "deterministic", "seed": "7"},
+			want:    map[string]interface{}{"preset": "deterministic", "temperature": 0.0, "top_p": 1.0, "seed": 7.0},
+		},
+		{
+			name:    "no seed for anthropic",
+			service: "anthropic",
+			params:  map[string]interface{}{"preset": "deterministic"},
+			want:    map[string]interface{}{"preset": "deterministic", "temperature": 0.0, "top_k": 1.0},
+		},
+		{
+			name:    "gemini defaults",
+			service: "gemini",
+			params:  map[string]interface{}{"seed": 3.0},
+			want:    map[string]interface{}{"temperature": 1.0, "top_k": 40.0, "top_p": 0.95, "seed": 3.0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step := &llm_step.LLMStepImpl{
+				PipelineStep: pipeline_type.PipelineStep{
+					ID:               "draft",
+					Prompt:           "Write",
+					LLMServiceConfig: map[string]interface{}{"service_name": tt.service, "parameters": tt.params},
+				},
+				LLMServiceInstance: &llm_service.MockLLMService{
+					CallLLMFunc: func(ctx context.Context, config map[string]interface{}, prompt string) (string, error) {
+						return "draft", nil
+					},
+				},
+			}
+			c := pipeline_type.NewContext()
+			if err := step.Execute(context.Background(), c); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			usage, _ := c.TokenUsage("draft")
+			if !reflect.DeepEqual(usage.Sampling, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, usage.Sampling)
+			}
+		})
+	}
+
+	step := &llm_step.LLMStepImpl{
+		PipelineStep: pipeline_type.PipelineStep{
+			ID:               "draft",
+			LLMServiceConfig: map[string]interface{}{"service_name": "openai", "parameters": map[string]interface{}{"preset": "wild"}},
+		},
+		LLMServiceInstance: &llm_service.MockLLMService{},
+	}
+	if err := step.Execute(context.Background(), pipeline_type.NewContext()); err == nil {
+		t.Error("expected an error for an unknown preset")
+	}
+}
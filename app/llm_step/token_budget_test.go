@@ -0,0 +1,65 @@
+package llm_step_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/serisow/lesocle/llm_step"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/services/llm_service"
+)
+
+func TestPromptTokenBudget(t *testing.T) {
+	var sent string
+	mock := &llm_service.MockLLMService{
+		CallLLMFunc: func(ctx context.Context, config map[string]interface{}, prompt string) (string, error) {
+			sent = prompt
+			return "short answer", nil
+		},
+	}
+	newStep := func(overflow string) *llm_step.LLMStepImpl {
+		return &llm_step.LLMStepImpl{
+			PipelineStep: pipeline_type.PipelineStep{
+				ID:            "summarize",
+				Prompt:        "Summarize: {article}",
+				RequiredSteps: "article",
+				StepOutputKey: "summary",
+				LLMServiceConfig: map[string]interface{}{
+					"service_name": "anthropic",
+					"parameters": map[string]interface{}{
+						"max_prompt_tokens": float64(5),
+						"prompt_overflow":   overflow,
+					},
+				},
+			},
+			LLMServiceInstance: mock,
+		}
+	}
+	newContext := func() *pipeline_type.Context {
+		c := pipeline_type.NewContext()
+		c.SetStepOutput("article", "one two three four five six seven eight")
+		return c
+	}
+
+	c := newContext()
+	err := newStep("").Execute(context.Background(), c)
+	if !errors.Is(err, llm_step.ErrPromptOverBudget) {
+		t.Fatalf("expected ErrPromptOverBudget, got %v", err)
+	}
+	if sent != "" {
+		t.Errorf("an over budget prompt should not be sent, got %q", sent)
+	}
+
+	c = newContext()
+	if err := newStep("truncate").Execute(context.Background(), c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sent != "Summarize: one two" {
+		t.Errorf("expected the prompt truncated to 5 tokens, got %q", sent)
+	}
+	usage, ok := c.TokenUsage("summarize")
+	if !ok || usage.PromptTokens != 5 || usage.CompletionTokens != 2 || !usage.Truncated || usage.Tokenizer != "heuristic" {
+		t.Errorf("unexpected token usage %+v", usage)
+	}
+}
@@ -0,0 +1,71 @@
+package llm_step_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/serisow/lesocle/llm_step"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/services/llm_service"
+)
+
+// toolCallingService calls the weather tool once then answers with its result.
+type toolCallingService struct {
+	llm_service.MockLLMService
+	rounds int
+	always bool
+}
+
+func (s *toolCallingService) CallWithTools(ctx context.Context, config map[string]interface{}, messages []llm_service.Message, tools []llm_service.Tool) (*llm_service.ToolResponse, error) {
+	s.rounds++
+	last := messages[len(messages)-1]
+	if last.Role == llm_service.RoleTool && !s.always {
+		return &llm_service.ToolResponse{Content: "It is " + last.Content}, nil
+	}
+	return &llm_service.ToolResponse{ToolCalls: []llm_service.ToolCall{{
+		ID:        "call_1",
+		Name:      tools[0].Name,
+		Arguments: map[string]interface{}{"city": "Dakar"},
+	}}}, nil
+}
+
+func TestLLMStepCallsTools(t *testing.T) {
+	newStep := func(service *toolCallingService) *llm_step.LLMStepImpl {
+		return &llm_step.LLMStepImpl{
+			PipelineStep: pipeline_type.PipelineStep{
+				ID:               "forecast",
+				Prompt:           "What is the weather in Dakar?",
+				StepOutputKey:    "forecast",
+				LLMServiceConfig: map[string]interface{}{"service_name": "openai"},
+				Tools:            []pipeline_type.StepTool{{Name: "weather", ActionService: "weather"}},
+				MaxToolRounds:    2,
+			},
+			LLMServiceInstance: service,
+			RunTool: func(ctx context.Context, tool pipeline_type.StepTool, arguments map[string]interface{}, c *pipeline_type.Context) (string, error) {
+				return "sunny in " + arguments["city"].(string), nil
+			},
+		}
+	}
+
+	service := &toolCallingService{}
+	c := pipeline_type.NewContext()
+	if err := newStep(service).Execute(context.Background(), c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if output, _ := c.GetString("forecast"); output != "It is sunny in Dakar" {
+		t.Errorf("unexpected output %q", output)
+	}
+	if usage, _ := c.TokenUsage("forecast"); usage.Requests != 2 {
+		t.Errorf("expected 2 requests, got %d", usage.Requests)
+	}
+
+	service = &toolCallingService{always: true}
+	err := newStep(service).Execute(context.Background(), pipeline_type.NewContext())
+	if !errors.Is(err, llm_step.ErrToolRounds) {
+		t.Fatalf("expected ErrToolRounds, got %v", err)
+	}
+	if service.rounds != 3 {
+		t.Errorf("expected the first call and 2 tool rounds, got %d", service.rounds)
+	}
+}
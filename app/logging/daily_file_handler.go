@@ -14,7 +14,7 @@ type DailyFileHandler struct {
     currentFile     *os.File
     currentFileName string
     logDir         string
-    mutex          sync.Mutex
+    mutex          *sync.Mutex
     defaultHandler slog.Handler
 }
 
@@ -26,6 +26,7 @@ func NewDailyFileHandler(logDir string, opts *slog.HandlerOptions) (*DailyFileHa
 
     h := &DailyFileHandler{
         logDir:         logDir,
+        mutex:          &sync.Mutex{},
         defaultHandler: slog.NewTextHandler(os.Stdout, opts),
     }
 
@@ -83,6 +84,17 @@ func (h *DailyFileHandler) Handle(ctx context.Context, r slog.Record) error {
     // Format the log line
     logLine := fmt.Sprintf("[%s] %-5s %s%s\n", timeStr, level, r.Message, attrs)
 
+    // Mirror the line into the execution log when the record belongs to a run
+    if executionID, stepID, ok := ExecutionLogScope(ctx); ok {
+        ExecutionLogs.Append(ExecutionLogLine{
+            ExecutionID: executionID,
+            StepID:      stepID,
+            Level:       level,
+            Message:     r.Message + attrs,
+            Timestamp:   r.Time.UnixMilli(),
+        })
+    }
+
     // Write to file
     h.mutex.Lock()
     _, err := h.currentFile.WriteString(logLine)
@@ -0,0 +1,267 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultExecutionLogBufferSize is the number of lines kept per execution for backfill.
+const DefaultExecutionLogBufferSize = 500
+
+// ExecutionLogLine is a single raw log line captured for an execution.
+type ExecutionLogLine struct {
+	ExecutionID string `json:"execution_id"`
+	StepID      string `json:"step_id,omitempty"`
+	Level       string `json:"level"`
+	Message     string `json:"message"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+type executionLogBuffer struct {
+	lines       []ExecutionLogLine
+	subscribers map[chan ExecutionLogLine]struct{}
+	finished    bool
+}
+
+// ExecutionLogStore keeps the last lines of every execution in memory and fans
+// new lines out to live subscribers (WebSocket tails, etc.).
+type ExecutionLogStore struct {
+	mutex      sync.Mutex
+	bufferSize int
+	buffers    map[string]*executionLogBuffer
+}
+
+// ExecutionLogs is the process wide execution log store.
+var ExecutionLogs = NewExecutionLogStore(DefaultExecutionLogBufferSize)
+
+func NewExecutionLogStore(bufferSize int) *ExecutionLogStore {
+	if bufferSize <= 0 {
+		bufferSize = DefaultExecutionLogBufferSize
+	}
+	return &ExecutionLogStore{
+		bufferSize: bufferSize,
+		buffers:    make(map[string]*executionLogBuffer),
+	}
+}
+
+func (s *ExecutionLogStore) buffer(executionID string) *executionLogBuffer {
+	b, ok := s.buffers[executionID]
+	if !ok {
+		b = &executionLogBuffer{subscribers: make(map[chan ExecutionLogLine]struct{})}
+		s.buffers[executionID] = b
+	}
+	return b
+}
+
+// Append records a line for the execution and forwards it to subscribers.
+// Slow subscribers miss lines rather than blocking the pipeline.
+func (s *ExecutionLogStore) Append(line ExecutionLogLine) {
+	if line.ExecutionID == "" {
+		return
+	}
+	if line.Timestamp == 0 {
+		line.Timestamp = time.Now().UnixMilli()
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	b := s.buffer(line.ExecutionID)
+	b.lines = append(b.lines, line)
+	if len(b.lines) > s.bufferSize {
+		b.lines = b.lines[len(b.lines)-s.bufferSize:]
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+}
+
+// Subscribe returns up to backfill buffered lines and a channel receiving new
+// lines. The channel is closed once the execution finishes or the returned
+// cancel function is called.
+func (s *ExecutionLogStore) Subscribe(executionID string, backfill int) ([]ExecutionLogLine, <-chan ExecutionLogLine, func()) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	b := s.buffer(executionID)
+
+	start := 0
+	if backfill >= 0 && len(b.lines) > backfill {
+		start = len(b.lines) - backfill
+	}
+	history := make([]ExecutionLogLine, len(b.lines)-start)
+	copy(history, b.lines[start:])
+
+	ch := make(chan ExecutionLogLine, 64)
+	if b.finished {
+		close(ch)
+		return history, ch, func() {}
+	}
+	b.subscribers[ch] = struct{}{}
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			if _, ok := b.subscribers[ch]; ok {
+				delete(b.subscribers, ch)
+				close(ch)
+			}
+		})
+	}
+	return history, ch, cancel
+}
+
+// Finish marks the execution as done and closes all subscriber channels.
+func (s *ExecutionLogStore) Finish(executionID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	b := s.buffer(executionID)
+	b.finished = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Remove drops the buffered lines of an execution.
+func (s *ExecutionLogStore) Remove(executionID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if b, ok := s.buffers[executionID]; ok {
+		for ch := range b.subscribers {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+		delete(s.buffers, executionID)
+	}
+}
+
+type executionLogKey struct{}
+
+type executionLogScope struct {
+	executionID string
+	stepID      string
+}
+
+// WithExecutionLog tags ctx so that log records emitted with it are also
+// captured in the execution log store.
+func WithExecutionLog(ctx context.Context, executionID, stepID string) context.Context {
+	return context.WithValue(ctx, executionLogKey{}, executionLogScope{executionID: executionID, stepID: stepID})
+}
+
+// ExecutionLogScope returns the execution and step IDs attached to ctx, if any.
+func ExecutionLogScope(ctx context.Context) (string, string, bool) {
+	if ctx == nil {
+		return "", "", false
+	}
+	scope, ok := ctx.Value(executionLogKey{}).(executionLogScope)
+	if !ok {
+		return "", "", false
+	}
+	return scope.executionID, scope.stepID, true
+}
+
+// NewExecutionLogWriter returns a writer that splits raw process output into
+// lines and appends them to the execution log. Lines rejected by filter are
+// dropped; a nil filter keeps everything.
+func NewExecutionLogWriter(executionID, stepID string, filter func(string) bool) io.Writer {
+	return &executionLogWriter{
+		store:       ExecutionLogs,
+		executionID: executionID,
+		stepID:      stepID,
+		filter:      filter,
+	}
+}
+
+type executionLogWriter struct {
+	mutex       sync.Mutex
+	store       *ExecutionLogStore
+	executionID string
+	stepID      string
+	filter      func(string) bool
+	pending     bytes.Buffer
+	// Longest input duration announced by ffmpeg, for its percent complete
+	duration time.Duration
+}
+
+func (w *executionLogWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.pending.Write(p)
+	for {
+		data := w.pending.Bytes()
+		// FFmpeg rewrites its progress line with \r, so treat it as a line break too.
+		idx := bytes.IndexAny(data, "\r\n")
+		if idx < 0 {
+			break
+		}
+		line := strings.TrimSpace(string(data[:idx]))
+		w.pending.Next(idx + 1)
+		if line == "" {
+			continue
+		}
+		w.trackProgress(line)
+		if w.filter != nil && !w.filter(line) {
+			continue
+		}
+		w.store.Append(ExecutionLogLine{
+			ExecutionID: w.executionID,
+			StepID:      w.stepID,
+			Level:       "INFO",
+			Message:     line,
+		})
+	}
+	return len(p), nil
+}
+
+// FFmpegProgressFilter keeps FFmpeg progress and error lines and drops the
+// banner, build configuration and stream mapping noise.
+func FFmpegProgressFilter(line string) bool {
+	if IsFFmpegProgress(line) {
+		return true
+	}
+	lower := strings.ToLower(line)
+	return strings.Contains(lower, "error") || strings.Contains(lower, "invalid")
+}
+
+// IsFFmpegProgress reports whether line is an FFmpeg progress line, such as
+// "frame=  120 fps= 30 ... time=00:00:04.00 ... speed=1.2x".
+func IsFFmpegProgress(line string) bool {
+	return strings.HasPrefix(line, "frame=") || strings.HasPrefix(line, "size=") ||
+		(strings.Contains(line, "time=") && strings.Contains(line, "speed="))
+}
+
+// trackProgress reports the percent complete of ffmpeg from its progress
+// lines, relative to the longest input.
+func (w *executionLogWriter) trackProgress(line string) {
+	if duration, ok := ffmpegClock(ffmpegDuration, line); ok {
+		w.duration = max(w.duration, duration)
+		return
+	}
+	if w.duration <= 0 || !IsFFmpegProgress(line) {
+		return
+	}
+	elapsed, ok := ffmpegClock(ffmpegTime, line)
+	if !ok {
+		return
+	}
+	reportProgress(Progress{
+		ExecutionID: w.executionID,
+		StepID:      w.stepID,
+		Percent:     min(100, float64(elapsed)/float64(w.duration)*100),
+		Message:     "Rendering",
+	})
+}
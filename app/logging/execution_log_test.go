@@ -0,0 +1,69 @@
+package logging
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestExecutionLogBackfillAndLiveLines(t *testing.T) {
+	store := NewExecutionLogStore(3)
+
+	for i := 0; i < 5; i++ {
+		store.Append(ExecutionLogLine{ExecutionID: "exec-1", Message: fmt.Sprintf("line %d", i)})
+	}
+
+	history, lines, cancel := store.Subscribe("exec-1", 2)
+	defer cancel()
+
+	if len(history) != 2 || history[0].Message != "line 3" || history[1].Message != "line 4" {
+		t.Fatalf("unexpected backfill: %+v", history)
+	}
+
+	store.Append(ExecutionLogLine{ExecutionID: "exec-1", Message: "live"})
+	if got := <-lines; got.Message != "live" {
+		t.Errorf("expected live line, got %q", got.Message)
+	}
+
+	store.Finish("exec-1")
+	if _, ok := <-lines; ok {
+		t.Error("expected channel to be closed after Finish")
+	}
+}
+
+func TestExecutionLogWriterFiltersFFmpegNoise(t *testing.T) {
+	previous := ExecutionLogs
+	ExecutionLogs = NewExecutionLogStore(10)
+	t.Cleanup(func() { ExecutionLogs = previous })
+
+	w := NewExecutionLogWriter("exec-2", "render", FFmpegProgressFilter)
+	fmt.Fprint(w, "ffmpeg version 6.0 Copyright (c) 2000-2023\n  configuration: --enable-gpl\n")
+	fmt.Fprint(w, "frame=  120 fps= 30 q=28.0 size=512kB time=00:00:04.00 bitrate=1048.6kbits/s speed=1.0x\r")
+	fmt.Fprint(w, "frame=  240 fps= 30 q=28.0 size=1024kB time=00:00:08.00 bitrate=1048.6kbits/s speed=1.0x\r")
+
+	history, _, cancel := ExecutionLogs.Subscribe("exec-2", -1)
+	defer cancel()
+
+	if len(history) != 2 {
+		t.Fatalf("expected 2 progress lines, got %d: %+v", len(history), history)
+	}
+	if history[0].StepID != "render" {
+		t.Errorf("expected step ID 'render', got %q", history[0].StepID)
+	}
+}
+
+func TestIsFFmpegProgress(t *testing.T) {
+	progress := []string{
+		"frame=  120 fps= 30 q=28.0 size=512kB time=00:00:04.00 bitrate=1048.6kbits/s speed=1.0x",
+		"size=    1024kB time=00:00:08.00 bitrate=1048.6kbits/s speed=2.1x",
+	}
+	for _, line := range progress {
+		if !IsFFmpegProgress(line) {
+			t.Errorf("expected %q to be a progress line", line)
+		}
+	}
+	for _, line := range []string{"Step started: render (llm_step)", "Error opening input file clip.mp4"} {
+		if IsFFmpegProgress(line) {
+			t.Errorf("expected %q not to be a progress line", line)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Progress is a structured progress update of a running step, reported from
+// code that can't reach the executor, such as services or ffmpeg wrappers.
+type Progress struct {
+	ExecutionID string `json:"execution_id"`
+	StepID      string `json:"step_id,omitempty"`
+	// Percent complete, negative when unknown
+	Percent float64 `json:"percent"`
+	// Tokens produced so far by an LLM
+	Tokens  int    `json:"tokens,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+var progressHandler = struct {
+	sync.RWMutex
+	handle func(Progress)
+}{}
+
+// SetProgressHandler sets the function receiving the progress reports, the
+// executor forwards them to its event bus.
+func SetProgressHandler(handle func(Progress)) {
+	progressHandler.Lock()
+	progressHandler.handle = handle
+	progressHandler.Unlock()
+}
+
+// ReportProgress reports progress of the step running with ctx. Reports
+// outside of an execution are dropped.
+func ReportProgress(ctx context.Context, p Progress) {
+	executionID, stepID, ok := ExecutionLogScope(ctx)
+	if !ok {
+		return
+	}
+	p.ExecutionID, p.StepID = executionID, stepID
+	reportProgress(p)
+}
+
+func reportProgress(p Progress) {
+	progressHandler.RLock()
+	handle := progressHandler.handle
+	progressHandler.RUnlock()
+	if handle != nil && p.ExecutionID != "" {
+		handle(p)
+	}
+}
+
+var (
+	ffmpegDuration = regexp.MustCompile(`Duration: (\d+):(\d{2}):(\d{2}(?:\.\d+)?)`)
+	ffmpegTime     = regexp.MustCompile(`time=(\d+):(\d{2}):(\d{2}(?:\.\d+)?)`)
+)
+
+// ffmpegClock parses the hours, minutes and seconds matched in line by re.
+func ffmpegClock(re *regexp.Regexp, line string) (time.Duration, bool) {
+	m := re.FindStringSubmatch(line)
+	if m == nil {
+		return 0, false
+	}
+	hours, _ := strconv.Atoi(m[1])
+	minutes, _ := strconv.Atoi(m[2])
+	seconds, _ := strconv.ParseFloat(m[3], 64)
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds*float64(time.Second)), true
+}
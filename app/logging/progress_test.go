@@ -0,0 +1,45 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestExecutionLogWriterReportsRenderPercent(t *testing.T) {
+	previous := ExecutionLogs
+	ExecutionLogs = NewExecutionLogStore(10)
+	t.Cleanup(func() { ExecutionLogs = previous })
+	var reported []Progress
+	SetProgressHandler(func(p Progress) { reported = append(reported, p) })
+	defer SetProgressHandler(nil)
+
+	w := NewExecutionLogWriter("exec-3", "render", FFmpegProgressFilter)
+	fmt.Fprint(w, "  Duration: 00:00:05.00, start: 0.000000, bitrate: 128 kb/s\n")
+	fmt.Fprint(w, "  Duration: 00:00:10.00, start: 0.000000, bitrate: 1200 kb/s\n")
+	fmt.Fprint(w, "frame=  120 fps= 30 q=28.0 size=512kB time=00:00:04.00 bitrate=1048.6kbits/s speed=1.0x\r")
+	fmt.Fprint(w, "frame=  330 fps= 30 q=28.0 size=2048kB time=00:00:11.00 bitrate=1048.6kbits/s speed=1.0x\r")
+
+	if len(reported) != 2 {
+		t.Fatalf("expected 2 progress reports, got %+v", reported)
+	}
+	if reported[0].Percent != 40 || reported[0].StepID != "render" || reported[0].ExecutionID != "exec-3" {
+		t.Errorf("expected 40%% of the longest input, got %+v", reported[0])
+	}
+	if reported[1].Percent != 100 {
+		t.Errorf("expected the percent capped at 100, got %v", reported[1].Percent)
+	}
+}
+
+func TestReportProgressOutsideExecutionIsDropped(t *testing.T) {
+	var reported []Progress
+	SetProgressHandler(func(p Progress) { reported = append(reported, p) })
+	defer SetProgressHandler(nil)
+
+	ReportProgress(context.Background(), Progress{Tokens: 12})
+	ReportProgress(WithExecutionLog(context.Background(), "exec-4", "summarize"), Progress{Tokens: 42})
+
+	if len(reported) != 1 || reported[0].ExecutionID != "exec-4" || reported[0].StepID != "summarize" || reported[0].Tokens != 42 {
+		t.Errorf("expected only the report of the execution, got %+v", reported)
+	}
+}
@@ -1,24 +1,47 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"flag"
+	"fmt"
 	"log"
 	"log/slog"
+	"net"
 	"net/http"
+	"os"
 	"path/filepath"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/serisow/lesocle/action_step"
+	"github.com/serisow/lesocle/artifact"
+	"github.com/serisow/lesocle/auth"
 	"github.com/serisow/lesocle/config"
+	"github.com/serisow/lesocle/db"
+	"github.com/serisow/lesocle/grpcapi"
+	"github.com/serisow/lesocle/handlers"
+	"github.com/serisow/lesocle/health"
+	"github.com/serisow/lesocle/job_queue"
 	"github.com/serisow/lesocle/llm_step"
 	"github.com/serisow/lesocle/logging"
+	"github.com/serisow/lesocle/message_trigger"
 	"github.com/serisow/lesocle/pipeline"
 	"github.com/serisow/lesocle/pipeline/step"
+	"github.com/serisow/lesocle/pipeline_type"
 	"github.com/serisow/lesocle/plugin_registry"
+	"github.com/serisow/lesocle/pricing"
+	"github.com/serisow/lesocle/rate_limiter"
+	"github.com/serisow/lesocle/requestid"
 	"github.com/serisow/lesocle/scheduler"
 	"github.com/serisow/lesocle/search_step"
 	"github.com/serisow/lesocle/server"
+	"github.com/serisow/lesocle/signedurl"
+	"github.com/serisow/lesocle/sla"
 	"github.com/serisow/lesocle/social_media_step"
+	"github.com/serisow/lesocle/tokenizer"
 	"github.com/serisow/lesocle/upload_step"
 
 	"github.com/serisow/lesocle/services/action_service"
@@ -28,6 +51,11 @@ import (
 )
 
 func main() {
+	// Debug mode: run a single step against the context snapshot of a previous execution
+	runStep := flag.String("run-step", "", "ID of a single step to execute, then exit")
+	fromExecution := flag.String("from-execution", "", "execution whose context snapshot is used with -run-step")
+	flag.Parse()
+
 	cfg := config.Load()
 
 	// Initialize the logger
@@ -36,31 +64,161 @@ func main() {
 		log.Fatalf("Failed to initialize logger: %v", err)
 	}
 
+	// Outbound calls carry the request ID of their context
+	http.DefaultTransport = &requestid.Transport{Base: http.DefaultTransport}
+
+	// Large step outputs are kept on disk instead of in memory
+	pipeline_type.SpillThreshold = cfg.OutputSpillThreshold
+	pipeline_type.SpillBaseURL = cfg.ServiceBaseURL
+	configureFileURLs(cfg)
+	rate_limiter.Limits.Configure(rate_limiter.ParseLimits(cfg.RateLimits))
+	// Provenance labels of the generated media and signature of the manifests
+	pipeline.EmbedProvenance = cfg.EmbedProvenance
+	if cfg.ArtifactSigningKey != "" {
+		key, err := artifact.ParseSigningKey(cfg.ArtifactSigningKey)
+		if err != nil {
+			log.Fatalf("Invalid ARTIFACT_SIGNING_KEY: %v", err)
+		}
+		pipeline.ArtifactSigningKey = key
+	}
+	// Label of the social posts written by LLM steps
+	action_service.Disclosure = action_service.NewDisclosurePolicy(cfg.AIDisclosureText, cfg.AIDisclosureHashtags)
+	encoder := artifact.EncoderSettings{
+		Threads:     cfg.FFmpegThreads,
+		Preset:      cfg.X264Preset,
+		Tune:        cfg.X264Tune,
+		CPUAffinity: cfg.FFmpegCPUAffinity,
+	}
+	if err := encoder.Validate(); err != nil {
+		log.Fatalf("Invalid encoder settings: %v", err)
+	}
+	artifact.Encoder = encoder
+	if cfg.RenderWorkerURL != "" {
+		artifact.DefaultRenderer = &artifact.RemoteRenderer{URL: cfg.RenderWorkerURL, Token: cfg.RenderWorkerToken}
+	}
+	if cfg.PriceTablePath != "" {
+		if err := pricing.Load(cfg.PriceTablePath); err != nil {
+			log.Fatalf("Failed to load price table: %v", err)
+		}
+	}
+	llm_service.ConfigureTransport(llm_service.TransportConfig{
+		MaxRetries:       cfg.LLMHTTPRetries,
+		BaseDelay:        llm_service.DefaultTransportConfig.BaseDelay,
+		MaxDelay:         cfg.LLMHTTPMaxBackoff,
+		Timeout:          cfg.LLMHTTPTimeout,
+		BreakerThreshold: cfg.LLMBreakerThreshold,
+		BreakerCooldown:  cfg.LLMBreakerCooldown,
+	})
+	if loaded, err := tokenizer.Load(cfg.TokenizerDir); err != nil {
+		log.Fatalf("Failed to load tokenizer encodings: %v", err)
+	} else if len(loaded) < len(tokenizer.Encodings) {
+		log.Printf("Tokenizer encodings loaded from %s: %v, the tokens of the other models are estimated", cfg.TokenizerDir, loaded)
+	}
+	if cfg.PipelineDir != "" {
+		// Standalone, there is no Drupal to report the results to
+		log.Printf("Reading pipelines from %s", cfg.PipelineDir)
+		scheduler.Source = scheduler.DirectorySource{Dir: cfg.PipelineDir}
+		pipeline.SendExecutionResultsFunc = func(string, map[string]interface{}, int64, int64) error { return nil }
+	}
+	if cfg.SLAAlertWebhookURL != "" {
+		sla.Default.SetNotifier(sla.WebhookNotifier(cfg.SLAAlertWebhookURL))
+	}
+
 	// Initialize PluginRegistry
 	registry := plugin_registry.NewPluginRegistry()
 	registerStepTypes(registry, logger)
 
+	if *runStep != "" {
+		if err := runSingleStep(cfg, registry, *runStep, *fromExecution); err != nil {
+			log.Fatalf("Single step execution failed: %v", err)
+		}
+		return
+	}
+
 	// Initialize scheduler with PluginRegistry
 	s := scheduler.New(cfg.APIHost, cfg.APIEndpoint, cfg.CheckInterval, registry, cfg.CronURL, cfg.CronInterval)
+	s.SetJitter(cfg.ScheduleJitter)
+	s.SetConcurrency(cfg.SchedulerMaxConcurrent, cfg.SchedulerQueueSize)
+	s.RegisterMetrics()
+	s.SetStateStore(scheduler.NewStateStore(cfg.SchedulerStatePath))
+	failures := scheduler.NewFailureTracker(cfg.FailureStatePath, cfg.FailureBackoffBase, cfg.FailureBackoffMax, cfg.FailureCooldown)
+	s.SetFailureTracker(failures)
+	s.SetWatchdog(cfg.ExecutionMaxDuration)
+	handlers.Failures = failures
+	if cfg.DistributedScheduler {
+		s.SetClaimer(newRunClaimer(cfg))
+	}
 
+	handlers.Scheduler = s
 	go s.Start()
 	go s.StartCronTrigger() // Start cron trigger
+	go s.StartWatchdog()
 
-	// Start the execution store cleanup
-	executionResultRetention := 24 * time.Hour // Retain results for 24 hours
-	cleanupInterval := 1 * time.Hour           // Run cleanup every hour
-	pipeline.StartExecutionStoreCleanup(executionResultRetention, cleanupInterval)
+	// Start the execution store cleanup, archiving expired results when configured
+	archiver, err := pipeline.NewArchiver(cfg.ExecutionArchiveLocation)
+	if err != nil {
+		log.Fatalf("Failed to initialize execution archive: %v", err)
+	}
+	pipeline.ExecutionArchiver = archiver
+	pipeline.StartExecutionStoreCleanup(cfg.ExecutionRetention, cfg.ExecutionCleanupInterval)
 
 	// Initialize server
+	handlers.TriggerSecret = cfg.TriggerSecret
+	handlers.WebSocketOrigins = append(cfg.WebSocketOrigins, cfg.APIHost)
+	handlers.LivenessChecks = []health.Check{
+		health.FFmpeg(),
+		health.WritableDir(filepath.Join("storage", "pipeline")),
+		health.WritableDir(cfg.JobQueueDir),
+	}
+	handlers.ReadinessChecks = []health.Check{
+		health.Reachable("drupal", cfg.APIEndpoint, &http.Client{Timeout: 5 * time.Second}),
+	}
+	triggerQueue, err := job_queue.New(cfg.JobQueueDir)
+	if err != nil {
+		log.Fatalf("Failed to open the job queue: %v", err)
+	}
+	handlers.TriggerQueue = triggerQueue
+	go triggerQueue.Work(context.Background(), cfg.JobQueueWorkers, handlers.TriggerJobHandler(cfg.APIHost, cfg.APIEndpoint, registry))
+	if cfg.MessageTriggerSQSURL != "" {
+		consumer, err := message_trigger.NewSQSConsumer(cfg.MessageTriggerSQSURL)
+		if err != nil {
+			log.Fatalf("Failed to create the SQS trigger consumer: %v", err)
+		}
+		router := message_trigger.Router{Default: cfg.MessageTriggerPipelineID}
+		go message_trigger.Run(context.Background(), consumer, router, handlers.EnqueueTrigger)
+	}
 	r := server.SetupRoutes(cfg.APIHost, cfg.APIEndpoint, registry)
-	n := setupNegroni(r)
+	n := setupNegroni(r, auth.New(auth.Config{
+		APIKeys:     auth.ParseAPIKeys(cfg.APIKeys),
+		JWTSecret:   cfg.JWTSecret,
+		JWTAudience: cfg.JWTAudience,
+	}, server.IsPublic(r)), rate_limiter.NewClientLimiter(rate_limiter.ClientQuota{
+		PerMinute:  cfg.ClientRateLimit,
+		Burst:      cfg.ClientRateBurst,
+		Overrides:  rate_limiter.ParseLimits(cfg.ClientRateLimits),
+		TrustProxy: cfg.TrustProxyHeaders,
+	}, server.IsLimited(r)))
+
+	if cfg.GRPCPort != "" {
+		go serveGRPC(cfg.GRPCPort, n)
+	}
 
 	if cfg.Environment == "production" {
-		server.ServeProduction(n)
+		server.ServeProduction(n, server.Config{
+			Domains:      cfg.Domains,
+			CertCacheDir: cfg.CertCacheDir,
+			ACMEEmail:    cfg.ACMEEmail,
+			CertFile:     cfg.TLSCertFile,
+			KeyFile:      cfg.TLSKeyFile,
+			HTTPSPort:    cfg.HTTPSPort,
+			IdleTimeout:  time.Minute,
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		})
 	} else {
 		srv := &http.Server{
 			Addr:         ":" + cfg.HTTPPort,
-			Handler:      n,
+			Handler:      handlers.KeepStreamsOpen(n),
 			IdleTimeout:  time.Minute,
 			ReadTimeout:  5 * time.Second,
 			WriteTimeout: 10 * time.Second,
@@ -69,14 +227,107 @@ func main() {
 	}
 }
 
-func setupNegroni(r *mux.Router) *negroni.Negroni {
+// configureFileURLs sets the key signing the image and output URLs, which
+// are public routes. Without a configured secret, a random key signs them
+// when the API is authenticated, and they stay open otherwise.
+func configureFileURLs(cfg config.Config) {
+	signedurl.TTL = cfg.FileURLTTL
+	if cfg.FileURLSecret != "" {
+		signedurl.Key = []byte(cfg.FileURLSecret)
+		return
+	}
+	if cfg.APIKeys == "" && cfg.JWTSecret == "" {
+		return
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatalf("Failed to generate the file URL key: %v", err)
+	}
+	signedurl.Key = key
+	log.Println("Warning: FILE_URL_SECRET is not set, the image and output URLs are not valid after a restart or on other instances")
+}
+
+// serveGRPC serves the gRPC API without TLS, it is meant for the internal
+// network.
+func serveGRPC(port string, rest http.Handler) {
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		log.Fatalf("Failed to listen for the gRPC API: %v", err)
+	}
+	log.Printf("gRPC API listening on :%s", port)
+	log.Fatal(grpcapi.New(rest).Serve(listener))
+}
+
+// runSingleStep executes one step with the current definition from Drupal and
+// prints its result.
+func runSingleStep(cfg config.Config, registry *plugin_registry.PluginRegistry, stepID, fromExecution string) error {
+	if fromExecution == "" {
+		return fmt.Errorf("-from-execution is required with -run-step")
+	}
+
+	snapshot, err := pipeline.LoadContextSnapshot(fromExecution)
+	if err != nil {
+		return err
+	}
+
+	fullPipeline, err := scheduler.FetchFullPipeline(snapshot.PipelineID, cfg.APIHost, cfg.APIEndpoint)
+	if err != nil {
+		return fmt.Errorf("failed to fetch pipeline: %w", err)
+	}
+	if err := snapshot.CheckDefinition(&fullPipeline, stepID); err != nil {
+		return err
+	}
+	fullPipeline.Context = snapshot.Context()
+
+	executionID := uuid.New().String()
+	stepErr := pipeline.ExecuteStep(executionID, &fullPipeline, stepID, registry)
+
+	if execResult, ok := pipeline.GetExecution(executionID); ok {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(execResult)
+	}
+	return stepErr
+}
+
+// newRunClaimer connects to the database shared by the instances to claim the
+// scheduled runs.
+func newRunClaimer(cfg config.Config) scheduler.RunClaimer {
+	pool, err := db.Connect()
+	if err != nil {
+		log.Fatalf("Distributed scheduler needs a database: %v", err)
+	}
+	instance := cfg.InstanceID
+	if instance == "" {
+		if instance, err = os.Hostname(); err != nil {
+			log.Fatalf("Failed to get the instance hostname, set INSTANCE_ID: %v", err)
+		}
+	}
+	claimer := scheduler.NewPostgresClaimer(pool, instance)
+	if err := claimer.EnsureSchema(context.Background()); err != nil {
+		log.Fatalf("Failed to initialize the distributed scheduler: %v", err)
+	}
+	log.Printf("Distributed scheduler enabled, instance %s", instance)
+	return claimer
+}
+
+func setupNegroni(r *mux.Router, authMiddleware *auth.Middleware, clientLimiter *rate_limiter.ClientLimiter) *negroni.Negroni {
 	n := negroni.New()
 
 	// Add middleware here
 	n.Use(negroni.NewRecovery())
-	n.Use(negroni.NewLogger())
+	n.Use(requestid.Middleware{})
+	logger := negroni.NewLogger()
+	logger.SetFormat(negroni.LoggerDefaultFormat + ` | {{index .Request.Header "X-Request-Id"}}`)
+	n.Use(logger)
 
 	// Add your custom middleware here if needed
+	if !authMiddleware.Enabled() {
+		log.Println("Warning: API_KEYS and JWT_SECRET are not set, the API is not authenticated")
+	}
+	n.Use(authMiddleware)
+	// After authentication, the quota of authenticated clients is per identity
+	n.Use(clientLimiter)
 
 	n.UseHandler(r)
 	return n
@@ -104,18 +355,27 @@ func registerStepTypes(registry *plugin_registry.PluginRegistry, logger *slog.Lo
 		return &social_media_step.SocialMediaStepImpl{}
 	})
 
-	registry.RegisterStepType("upload_image_step", func() step.Step {
+	registry.RegisterStepType("image_asset_step", func() step.Step {
 		return &upload_step.UploadImageStepImpl{
 			Logger: logger,
 		}
 	})
 
+	// Renamed step types, the pipelines defined in Drupal with the old name
+	// keep working with a deprecation warning
+	registry.RegisterAlias("upload_image_step", "image_asset_step")
+
 	// Register the LLM Services
 	registry.RegisterLLMService("openai", llm_service.NewOpenAIService(logger))
 	registry.RegisterLLMService("openai_image", llm_service.NewOpenAIImageService(logger))
+	registry.RegisterLLMService("stability_image", llm_service.NewStabilityImageService(logger))
+	registry.RegisterLLMService("replicate", llm_service.NewReplicateService(logger))
 	registry.RegisterLLMService("anthropic", llm_service.NewAnthropicService(logger))
 	registry.RegisterLLMService("gemini", llm_service.NewGeminiService(logger))
+	registry.RegisterLLMService("groq", llm_service.NewGroqService(logger))
+	registry.RegisterLLMService("openrouter", llm_service.NewOpenRouterService(logger))
 	registry.RegisterLLMService("elevenlabs", llm_service.NewElevenLabsService(logger))
+	registry.RegisterLLMService("openai_tts", llm_service.NewOpenAITTSService(logger))
 	// This one is not a true LLM but an API, but TTS is expensive for dev environment
 	// so i use for the moment for that.
 	registry.RegisterLLMService("aws_polly", llm_service.NewAWSPollyService(logger))
@@ -126,8 +386,16 @@ func registerStepTypes(registry *plugin_registry.PluginRegistry, logger *slog.Lo
 	registry.RegisterActionService("tweet_data_enricher", action_service.NewTweetDataEnricherService(logger))
 	registry.RegisterActionService("linkedin_share", action_service.NewLinkedInShareActionService(logger))
 	registry.RegisterActionService("facebook_share", action_service.NewFacebookShareActionService(logger))
+	registry.RegisterActionService("instagram_publish", action_service.NewInstagramPublishActionService(logger))
+	registry.RegisterActionService("tiktok_upload", action_service.NewTikTokUploadActionService(logger))
 	registry.RegisterActionService("send_sms", action_service.NewSendSMSActionService(logger))
+	registry.RegisterActionService("send_email", action_service.NewSendEmailActionService(logger))
+	registry.RegisterActionService("email_provider", action_service.NewEmailProviderActionService(logger))
 	registry.RegisterActionService("generic_webhook", action_service.NewGenericWebhookActionService(logger))
+	registry.RegisterActionService("s3_upload", action_service.NewS3UploadActionService(logger))
+	registry.RegisterActionService("db_insert", action_service.NewDBInsertActionService(logger))
+	registry.RegisterActionService("create_issue", action_service.NewCreateIssueActionService(logger))
+	registry.RegisterActionService("create_calendar_event", action_service.NewCreateCalendarEventActionService(logger))
 
 }
 
@@ -147,8 +415,9 @@ func initLogger() (*slog.Logger, error) {
 		return nil, err
 	}
 
-	// Create logger with the custom handler
-	logger := slog.New(fileHandler)
+	// Create logger with the custom handler, records logged with a context
+	// carry its request ID
+	logger := slog.New(requestid.NewLogHandler(fileHandler))
 
 	return logger, nil
 }
@@ -0,0 +1,112 @@
+// Package message_trigger starts pipelines from the messages of a queue, so
+// content can be generated as events happen instead of on schedules only.
+package message_trigger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// PipelineAttribute is the message attribute, or top-level body field, naming
+// the pipeline to run.
+const PipelineAttribute = "pipeline_id"
+
+// ErrNoPipeline is returned for messages that don't name a pipeline when the
+// router has no default.
+var ErrNoPipeline = errors.New("message names no pipeline")
+
+// receiveErrorDelay is the wait after the queue failed to deliver.
+var receiveErrorDelay = 10 * time.Second
+
+// Message is a message received from a queue.
+type Message struct {
+	ID         string
+	Body       []byte
+	Attributes map[string]string
+	// Handle identifies the delivery when acknowledging it
+	Handle string
+}
+
+// Consumer receives messages from a queue. Messages not acknowledged are
+// delivered again by the queue, e.g. after a visibility timeout.
+type Consumer interface {
+	// Receive waits for the next messages, it may return none.
+	Receive(ctx context.Context) ([]Message, error)
+	Ack(ctx context.Context, m Message) error
+}
+
+// Router maps a message to the pipeline it triggers: the pipeline_id
+// attribute, else the pipeline_id field of a JSON body, else Default.
+type Router struct {
+	Default string
+}
+
+// Route returns the pipeline the message triggers.
+func (r Router) Route(m Message) (string, error) {
+	if id := m.Attributes[PipelineAttribute]; id != "" {
+		return id, nil
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(m.Body, &body); err == nil {
+		if id, ok := body[PipelineAttribute].(string); ok && id != "" {
+			return id, nil
+		}
+	}
+	if r.Default != "" {
+		return r.Default, nil
+	}
+	return "", ErrNoPipeline
+}
+
+// DispatchFunc hands a message body over for the execution of a pipeline.
+// Once it returned nil the message is acknowledged, so it should persist the
+// request first.
+type DispatchFunc func(pipelineID string, body []byte) error
+
+// Run consumes the queue until ctx is done. Messages dispatched are
+// acknowledged, messages failing to dispatch are left for redelivery, and
+// messages that can't be routed are acknowledged and dropped.
+func Run(ctx context.Context, consumer Consumer, router Router, dispatch DispatchFunc) {
+	for ctx.Err() == nil {
+		messages, err := consumer.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Error receiving trigger messages: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(receiveErrorDelay):
+			}
+			continue
+		}
+		for _, m := range messages {
+			if err := handle(ctx, consumer, router, dispatch, m); err != nil {
+				log.Printf("Trigger message %s: %v", m.ID, err)
+			}
+		}
+	}
+}
+
+func handle(ctx context.Context, consumer Consumer, router Router, dispatch DispatchFunc, m Message) error {
+	pipelineID, err := router.Route(m)
+	if err != nil {
+		// Redelivering wouldn't help
+		if ackErr := consumer.Ack(ctx, m); ackErr != nil {
+			return fmt.Errorf("%v, and failed to drop it: %w", err, ackErr)
+		}
+		return fmt.Errorf("dropped: %w", err)
+	}
+	if err := dispatch(pipelineID, m.Body); err != nil {
+		return fmt.Errorf("failed to trigger pipeline %s, left for redelivery: %w", pipelineID, err)
+	}
+	if err := consumer.Ack(ctx, m); err != nil {
+		return fmt.Errorf("pipeline %s triggered but the message was not acknowledged: %w", pipelineID, err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package message_trigger
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+type fakeConsumer struct {
+	sync.Mutex
+	batches [][]Message
+	acked   []string
+	cancel  context.CancelFunc
+}
+
+func (f *fakeConsumer) Receive(ctx context.Context) ([]Message, error) {
+	f.Lock()
+	defer f.Unlock()
+	if len(f.batches) == 0 {
+		f.cancel()
+		return nil, ctx.Err()
+	}
+	batch := f.batches[0]
+	f.batches = f.batches[1:]
+	return batch, nil
+}
+
+func (f *fakeConsumer) Ack(ctx context.Context, m Message) error {
+	f.Lock()
+	defer f.Unlock()
+	f.acked = append(f.acked, m.ID)
+	return nil
+}
+
+func TestRunDispatchesAndAcknowledges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	consumer := &fakeConsumer{cancel: cancel, batches: [][]Message{{
+		{ID: "m1", Body: []byte(`{"user_input": "news"}`), Attributes: map[string]string{PipelineAttribute: "from-attribute"}},
+		{ID: "m2", Body: []byte(`{"pipeline_id": "from-body"}`)},
+		{ID: "m3", Body: []byte(`plain text`)},
+		{ID: "m4", Body: []byte(`{"pipeline_id": "unavailable"}`)},
+	}}}
+
+	var dispatched []string
+	dispatch := func(pipelineID string, body []byte) error {
+		if pipelineID == "unavailable" {
+			return errors.New("queue full")
+		}
+		dispatched = append(dispatched, pipelineID)
+		return nil
+	}
+
+	Run(ctx, consumer, Router{Default: "fallback"}, dispatch)
+
+	want := []string{"from-attribute", "from-body", "fallback"}
+	if len(dispatched) != len(want) {
+		t.Fatalf("expected %v, got %v", want, dispatched)
+	}
+	for i := range want {
+		if dispatched[i] != want[i] {
+			t.Errorf("expected %v, got %v", want, dispatched)
+		}
+	}
+	// The failed dispatch is left for redelivery
+	if len(consumer.acked) != 3 || consumer.acked[2] != "m3" {
+		t.Errorf("unexpected acknowledgments %v", consumer.acked)
+	}
+}
+
+func TestRouterWithoutDefaultDropsUnnamedMessages(t *testing.T) {
+	if _, err := (Router{}).Route(Message{Body: []byte(`{}`)}); !errors.Is(err, ErrNoPipeline) {
+		t.Errorf("expected ErrNoPipeline, got %v", err)
+	}
+}
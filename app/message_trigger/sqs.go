@@ -0,0 +1,72 @@
+package message_trigger
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// sqsAPI is the part of the SQS client the consumer uses.
+type sqsAPI interface {
+	ReceiveMessageWithContext(aws.Context, *sqs.ReceiveMessageInput, ...request.Option) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessageWithContext(aws.Context, *sqs.DeleteMessageInput, ...request.Option) (*sqs.DeleteMessageOutput, error)
+}
+
+// SQSConsumer receives the messages of an SQS queue with long polling. A
+// message is deleted once acknowledged, otherwise it comes back after the
+// visibility timeout of the queue.
+type SQSConsumer struct {
+	Client   sqsAPI
+	QueueURL string
+}
+
+// NewSQSConsumer creates a consumer of the queue, with the credentials and
+// region of the environment.
+func NewSQSConsumer(queueURL string) (*SQSConsumer, error) {
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	return &SQSConsumer{Client: sqs.New(sess), QueueURL: queueURL}, nil
+}
+
+// Receive implements Consumer.
+func (c *SQSConsumer) Receive(ctx context.Context) ([]Message, error) {
+	out, err := c.Client.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:              aws.String(c.QueueURL),
+		MaxNumberOfMessages:   aws.Int64(10),
+		WaitTimeSeconds:       aws.Int64(20),
+		MessageAttributeNames: aws.StringSlice([]string{"All"}),
+	})
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]Message, 0, len(out.Messages))
+	for _, m := range out.Messages {
+		attributes := make(map[string]string, len(m.MessageAttributes))
+		for name, value := range m.MessageAttributes {
+			if value.StringValue != nil {
+				attributes[name] = *value.StringValue
+			}
+		}
+		messages = append(messages, Message{
+			ID:         aws.StringValue(m.MessageId),
+			Body:       []byte(aws.StringValue(m.Body)),
+			Attributes: attributes,
+			Handle:     aws.StringValue(m.ReceiptHandle),
+		})
+	}
+	return messages, nil
+}
+
+// Ack implements Consumer.
+func (c *SQSConsumer) Ack(ctx context.Context, m Message) error {
+	_, err := c.Client.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(c.QueueURL),
+		ReceiptHandle: aws.String(m.Handle),
+	})
+	return err
+}
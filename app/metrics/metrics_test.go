@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExposition(t *testing.T) {
+	counter := NewCounter("test_executions_total", "Executions.", "pipeline_id", "status")
+	counter.Inc("daily", "completed")
+	counter.Add(2, "daily", "failed")
+	counter.Add(-1, "daily", "failed")
+	histogram := NewHistogram("test_render_seconds", "Renders.", []float64{1, 10}, "status")
+	histogram.Observe(0.5, "completed")
+	histogram.Observe(4, "completed")
+	NewGaugeFunc("test_queue_depth", "Queue.", func() float64 { return 3 })
+	NewCounter("test_escaped_total", "Escaping.", "name").Inc(`say "hi"`)
+
+	rec := httptest.NewRecorder()
+	Default.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		"# TYPE test_executions_total counter\n",
+		`test_executions_total{pipeline_id="daily",status="completed"} 1` + "\n",
+		`test_executions_total{pipeline_id="daily",status="failed"} 2` + "\n",
+		"# TYPE test_render_seconds histogram\n",
+		`test_render_seconds_bucket{status="completed",le="1"} 1` + "\n",
+		`test_render_seconds_bucket{status="completed",le="10"} 2` + "\n",
+		`test_render_seconds_bucket{status="completed",le="+Inf"} 2` + "\n",
+		`test_render_seconds_sum{status="completed"} 4.5` + "\n",
+		"test_queue_depth 3\n",
+		`test_escaped_total{name="say \"hi\""} 1` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in:\n%s", want, body)
+		}
+	}
+	if strings.Index(body, "test_escaped_total") > strings.Index(body, "test_executions_total") {
+		t.Error("expected the metrics sorted by name")
+	}
+}
+
+func TestLabelValuesCountIsChecked(t *testing.T) {
+	counter := NewCounter("test_labels_total", "Labels.", "a", "b")
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic on missing label values")
+		}
+	}()
+	counter.Inc("only-a")
+}
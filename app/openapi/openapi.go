@@ -0,0 +1,323 @@
+// Package openapi builds an OpenAPI 3 document of the HTTP API from the
+// registered routes and the Go types of their bodies.
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Operation documents a route. Request and Response are zero values of the
+// body types, nil when the route has no JSON body.
+type Operation struct {
+	Method   string
+	Path     string
+	Summary  string
+	Tags     []string
+	Public   bool
+	Request  interface{}
+	Response interface{}
+	// Status of a successful response, 200 when zero
+	Status int
+	// Query lists the optional query parameters
+	Query []string
+	// RequestType is the media type of the request body, JSON when empty
+	RequestType string
+	// ResponseType is the media type of a response body that isn't JSON
+	ResponseType string
+	// WebSocket routes upgrade the connection, they answer 101
+	WebSocket bool
+}
+
+// File is a file field of a multipart request body.
+type File struct{}
+
+// Document is the subset of an OpenAPI 3 document the API needs.
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       Info                            `json:"info"`
+	Paths      map[string]map[string]PathEntry `json:"paths"`
+	Components Components                      `json:"components"`
+	Security   []map[string][]string           `json:"security,omitempty"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type PathEntry struct {
+	OperationID string                 `json:"operationId"`
+	Summary     string                 `json:"summary,omitempty"`
+	Tags        []string               `json:"tags,omitempty"`
+	Parameters  []Parameter            `json:"parameters,omitempty"`
+	RequestBody *Body                  `json:"requestBody,omitempty"`
+	Responses   map[string]Response    `json:"responses"`
+	Security    *[]map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type Body struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+}
+
+// Schema is a JSON schema, named struct types are referenced from the
+// components.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// Build documents the operations. Every operation requires an API key or a
+// bearer token except the public ones.
+func Build(title, version string, operations []Operation) *Document {
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info:    Info{Title: title, Version: version},
+		Paths:   make(map[string]map[string]PathEntry),
+		Components: Components{
+			Schemas: make(map[string]*Schema),
+			SecuritySchemes: map[string]SecurityScheme{
+				"apiKey":     {Type: "apiKey", In: "header", Name: "X-API-Key"},
+				"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			},
+		},
+		Security: []map[string][]string{{"apiKey": {}}, {"bearerAuth": {}}},
+	}
+
+	for _, op := range operations {
+		entry := PathEntry{
+			OperationID: operationID(op.Method, op.Path),
+			Summary:     op.Summary,
+			Tags:        op.Tags,
+			Responses:   make(map[string]Response),
+		}
+		for _, name := range pathParameters(op.Path) {
+			entry.Parameters = append(entry.Parameters, Parameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+		for _, name := range op.Query {
+			entry.Parameters = append(entry.Parameters, Parameter{Name: name, In: "query", Schema: &Schema{Type: "string"}})
+		}
+		if op.Request != nil {
+			requestType := op.RequestType
+			if requestType == "" {
+				requestType = "application/json"
+			}
+			entry.RequestBody = &Body{Required: true, Content: map[string]MediaType{
+				requestType: {Schema: doc.schemaOf(reflect.TypeOf(op.Request))},
+			}}
+		}
+
+		status := op.Status
+		switch {
+		case op.WebSocket:
+			status = http.StatusSwitchingProtocols
+		case status == 0:
+			status = http.StatusOK
+		}
+		response := Response{Description: http.StatusText(status)}
+		switch {
+		case op.Response != nil:
+			response.Content = map[string]MediaType{"application/json": {Schema: doc.schemaOf(reflect.TypeOf(op.Response))}}
+		case op.ResponseType != "":
+			response.Content = map[string]MediaType{op.ResponseType: {Schema: &Schema{Type: "string", Format: "binary"}}}
+		}
+		entry.Responses[strconv.Itoa(status)] = response
+		if op.Public {
+			// An empty requirement overrides the document security
+			entry.Security = &[]map[string][]string{}
+		} else {
+			entry.Responses["401"] = Response{Description: http.StatusText(http.StatusUnauthorized)}
+		}
+
+		path := strings.TrimSuffix(op.Path, "/")
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]PathEntry)
+		}
+		doc.Paths[path][strings.ToLower(op.Method)] = entry
+	}
+	return doc
+}
+
+var pathParameter = regexp.MustCompile(`\{([^}:]+)(?::[^}]*)?\}`)
+
+func pathParameters(path string) []string {
+	var names []string
+	for _, m := range pathParameter.FindAllStringSubmatch(path, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// operationID derives a stable identifier, such as post_pipeline_id_execute.
+func operationID(method, path string) string {
+	words := []string{strings.ToLower(method)}
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_')
+	}) {
+		words = append(words, strings.ToLower(part))
+	}
+	return strings.Join(words, "_")
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	fileType = reflect.TypeOf(File{})
+)
+
+// schemaOf returns the schema of a type, registering named structs in the
+// components.
+func (d *Document) schemaOf(t reflect.Type) *Schema {
+	switch {
+	case t == nil:
+		return &Schema{}
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == fileType:
+		return &Schema{Type: "string", Format: "binary"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := d.schemaOf(t.Elem())
+		if schema.Ref == "" {
+			schema.Nullable = true
+		}
+		return schema
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchema(t)
+		}
+		name := schemaName(t)
+		if _, exists := d.Components.Schemas[name]; !exists {
+			// Registered before the fields so recursive types terminate
+			d.Components.Schemas[name] = &Schema{Type: "object"}
+			d.Components.Schemas[name] = d.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	default:
+		// interface{} and anything else accepts any value
+		return &Schema{}
+	}
+}
+
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, omitempty, skip := jsonName(field)
+		if skip {
+			continue
+		}
+		if field.Anonymous && name == "" && indirect(field.Type).Kind() == reflect.Struct {
+			embedded := d.structSchema(indirect(field.Type))
+			for k, v := range embedded.Properties {
+				schema.Properties[k] = v
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = d.schemaOf(field.Type)
+		if !omitempty && field.Type.Kind() != reflect.Ptr {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	sort.Strings(schema.Required)
+	return schema
+}
+
+func jsonName(field reflect.StructField) (name string, omitempty, skip bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+	name, options, _ := strings.Cut(tag, ",")
+	return name, strings.Contains(options, "omitempty"), false
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// schemaName names a struct after its package and type, e.g. ApiExecuteRequest
+// for api.ExecuteRequest, so types of different packages don't collide.
+func schemaName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	var name strings.Builder
+	for _, part := range strings.Split(pkg, "_") {
+		if part != "" {
+			name.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	name.WriteString(strings.ToUpper(t.Name()[:1]) + t.Name()[1:])
+	return name.String()
+}
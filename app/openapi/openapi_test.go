@@ -0,0 +1,94 @@
+package openapi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type origin struct {
+	ExecutionID string `json:"execution_id"`
+}
+
+type accepted struct {
+	ExecutionID string            `json:"execution_id"`
+	Tags        []string          `json:"tags,omitempty"`
+	Links       map[string]string `json:"links"`
+	Origin      *origin           `json:"origin,omitempty"`
+	Internal    string            `json:"-"`
+}
+
+func TestBuild(t *testing.T) {
+	doc := Build("Test API", "1.0.0", []Operation{
+		{Method: "POST", Path: "/pipeline/{id}/execute", Summary: "Start", Request: struct {
+			UserInput string `json:"user_input"`
+		}{}, Response: accepted{}, Status: 202},
+		{Method: "GET", Path: "/healthz", Public: true},
+	})
+
+	op := doc.Paths["/pipeline/{id}/execute"]["post"]
+	if op.OperationID != "post_pipeline_id_execute" {
+		t.Errorf("unexpected operation ID %q", op.OperationID)
+	}
+	if len(op.Parameters) != 1 || op.Parameters[0].Name != "id" || op.Parameters[0].In != "path" {
+		t.Errorf("expected the id path parameter, got %+v", op.Parameters)
+	}
+	if op.RequestBody.Content["application/json"].Schema.Properties["user_input"].Type != "string" {
+		t.Errorf("unexpected request schema %+v", op.RequestBody.Content["application/json"].Schema)
+	}
+	if ref := op.Responses["202"].Content["application/json"].Schema.Ref; ref != "#/components/schemas/OpenapiAccepted" {
+		t.Fatalf("expected the response to reference its component, got %q", ref)
+	}
+	if _, ok := op.Responses["401"]; !ok {
+		t.Error("expected a 401 response on an authenticated route")
+	}
+
+	schema := doc.Components.Schemas["OpenapiAccepted"]
+	if _, ok := schema.Properties["Internal"]; ok {
+		t.Error("expected fields tagged json:\"-\" skipped")
+	}
+	if schema.Properties["tags"].Items.Type != "string" || schema.Properties["links"].AdditionalProperties.Type != "string" {
+		t.Errorf("unexpected collection schemas %+v", schema.Properties)
+	}
+	if strings.Join(schema.Required, ",") != "execution_id,links" {
+		t.Errorf("expected required fields execution_id and links, got %v", schema.Required)
+	}
+	if schema.Properties["origin"].Ref != "#/components/schemas/OpenapiOrigin" {
+		t.Errorf("expected the nested struct referenced, got %+v", schema.Properties["origin"])
+	}
+
+	data, err := json.Marshal(doc.Paths["/healthz"]["get"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"security":[]`) {
+		t.Errorf("expected public routes to clear the security requirement, got %s", data)
+	}
+}
+
+func TestBuildMediaTypes(t *testing.T) {
+	doc := Build("Test API", "1.0.0", []Operation{
+		{Method: "GET", Path: "/executions/{execution_id}/logs/ws", Query: []string{"backfill"}, WebSocket: true},
+		{Method: "GET", Path: "/schedule.ics", ResponseType: "text/calendar"},
+		{Method: "POST", Path: "/assets", RequestType: "multipart/form-data", Request: struct {
+			File File   `json:"file"`
+			Key  string `json:"key"`
+		}{}},
+		{Method: "DELETE", Path: "/assets/{key}", Status: 204},
+	})
+
+	ws := doc.Paths["/executions/{execution_id}/logs/ws"]["get"]
+	if _, ok := ws.Responses["101"]; !ok || len(ws.Parameters) != 2 || ws.Parameters[1].In != "query" || ws.Parameters[1].Required {
+		t.Errorf("unexpected WebSocket operation %+v", ws)
+	}
+	if schema := doc.Paths["/schedule.ics"]["get"].Responses["200"].Content["text/calendar"].Schema; schema == nil || schema.Format != "binary" {
+		t.Errorf("expected a calendar response, got %+v", doc.Paths["/schedule.ics"]["get"].Responses)
+	}
+	form := doc.Paths["/assets"]["post"].RequestBody.Content["multipart/form-data"].Schema
+	if form == nil || form.Properties["file"].Format != "binary" {
+		t.Errorf("expected a multipart body with a file, got %+v", form)
+	}
+	if response := doc.Paths["/assets/{key}"]["delete"].Responses["204"]; response.Content != nil {
+		t.Errorf("expected no content, got %+v", response)
+	}
+}
@@ -0,0 +1,277 @@
+package openapi
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// methodOrder is the order of the methods of a path in the generated client.
+var methodOrder = []string{"get", "post", "put", "patch", "delete"}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// TypeScript generates a TypeScript client of the document, on fetch: an
+// interface per component schema and a method per operation. The WebSocket
+// operations get a method returning their URL, the operations answering
+// something else than JSON return the fetch Response.
+func TypeScript(doc *Document) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Code generated from the OpenAPI document of %s %s. DO NOT EDIT.\n\n", doc.Info.Title, doc.Info.Version)
+
+	names := make([]string, 0, len(doc.Components.Schemas))
+	for name := range doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		schema := doc.Components.Schemas[name]
+		if len(schema.Properties) == 0 {
+			fmt.Fprintf(&b, "export type %s = %s;\n\n", name, tsType(schema))
+			continue
+		}
+		fmt.Fprintf(&b, "export interface %s {\n", name)
+		for _, property := range tsProperties(schema) {
+			fmt.Fprintf(&b, "  %s;\n", property)
+		}
+		b.WriteString("}\n\n")
+	}
+
+	b.WriteString(tsClientHead)
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		for _, method := range methodOrder {
+			if entry, ok := doc.Paths[path][method]; ok {
+				writeTSMethod(&b, method, path, entry)
+			}
+		}
+	}
+	b.WriteString(tsClientTail)
+	return []byte(b.String())
+}
+
+func writeTSMethod(b *strings.Builder, method, path string, entry PathEntry) {
+	var params, query []string
+	for _, p := range entry.Parameters {
+		if p.In == "path" {
+			params = append(params, camelCase(p.Name)+": string")
+		} else {
+			query = append(query, tsKey(p.Name)+"?: string")
+		}
+	}
+
+	// The body is passed as is, a multipart body as a FormData
+	var options []string
+	if entry.RequestBody != nil {
+		if _, ok := entry.RequestBody.Content["multipart/form-data"]; ok {
+			params = append(params, "form: FormData")
+			options = append(options, "form")
+		} else {
+			params = append(params, "body: "+tsType(entry.RequestBody.Content["application/json"].Schema))
+			options = append(options, "body")
+		}
+	}
+	if len(query) > 0 {
+		params = append(params, "query: { "+strings.Join(query, "; ")+" } = {}")
+		options = append(options, "query")
+	}
+
+	urlPath := "`" + pathParameter.ReplaceAllStringFunc(path, func(m string) string {
+		return "${encodeURIComponent(" + camelCase(pathParameter.FindStringSubmatch(m)[1]) + ")}"
+	}) + "`"
+	name := camelCase(entry.OperationID)
+	if entry.Summary != "" {
+		fmt.Fprintf(b, "  /** %s */\n", entry.Summary)
+	}
+
+	if _, ok := entry.Responses["101"]; ok {
+		queryArg := ""
+		if len(query) > 0 {
+			queryArg = ", query"
+		}
+		fmt.Fprintf(b, "  %sURL(%s): string {\n", name, strings.Join(params, ", "))
+		fmt.Fprintf(b, "    return this.url(%s%s).replace(/^http/, \"ws\");\n  }\n\n", urlPath, queryArg)
+		return
+	}
+
+	call := fmt.Sprintf("this.request(%q, %s", strings.ToUpper(method), urlPath)
+	if len(options) > 0 {
+		call += ", { " + strings.Join(options, ", ") + " }"
+	}
+	call += ")"
+
+	// The first success status gives the return type
+	statuses := make([]string, 0, len(entry.Responses))
+	for status := range entry.Responses {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	var response *Response
+	for _, status := range statuses {
+		if strings.HasPrefix(status, "2") {
+			r := entry.Responses[status]
+			response = &r
+			break
+		}
+	}
+	switch {
+	case response == nil || len(response.Content) == 0:
+		fmt.Fprintf(b, "  async %s(%s): Promise<void> {\n    await %s;\n  }\n\n", name, strings.Join(params, ", "), call)
+	case response.Content["application/json"].Schema != nil:
+		fmt.Fprintf(b, "  async %s(%s): Promise<%s> {\n    return (await %s).json();\n  }\n\n",
+			name, strings.Join(params, ", "), tsType(response.Content["application/json"].Schema), call)
+	default:
+		fmt.Fprintf(b, "  %s(%s): Promise<Response> {\n    return %s;\n  }\n\n", name, strings.Join(params, ", "), call)
+	}
+}
+
+// tsType returns the TypeScript type of a schema.
+func tsType(schema *Schema) string {
+	if schema == nil {
+		return "unknown"
+	}
+	var t string
+	switch {
+	case schema.Ref != "":
+		t = schema.Ref[strings.LastIndex(schema.Ref, "/")+1:]
+	case schema.Type == "string" && schema.Format == "binary":
+		t = "Blob"
+	case schema.Type == "string":
+		t = "string"
+	case schema.Type == "integer" || schema.Type == "number":
+		t = "number"
+	case schema.Type == "boolean":
+		t = "boolean"
+	case schema.Type == "array":
+		item := tsType(schema.Items)
+		if strings.ContainsAny(item, " |") {
+			t = "Array<" + item + ">"
+		} else {
+			t = item + "[]"
+		}
+	case schema.Type == "object" && len(schema.Properties) > 0:
+		t = "{ " + strings.Join(tsProperties(schema), "; ") + " }"
+	case schema.Type == "object":
+		t = "Record<string, " + tsType(schema.AdditionalProperties) + ">"
+	default:
+		t = "unknown"
+	}
+	if schema.Nullable {
+		t += " | null"
+	}
+	return t
+}
+
+// tsProperties returns the properties of an object schema, sorted, the
+// optional ones marked.
+func tsProperties(schema *Schema) []string {
+	required := make(map[string]bool, len(schema.Required))
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	properties := make([]string, 0, len(names))
+	for _, name := range names {
+		optional := "?"
+		if required[name] {
+			optional = ""
+		}
+		properties = append(properties, tsKey(name)+optional+": "+tsType(schema.Properties[name]))
+	}
+	return properties
+}
+
+func tsKey(name string) string {
+	if identifier.MatchString(name) {
+		return name
+	}
+	return fmt.Sprintf("%q", name)
+}
+
+// camelCase turns an operation ID or a path parameter, such as
+// get_pipeline_id_failures, into an identifier, getPipelineIdFailures.
+func camelCase(name string) string {
+	var b strings.Builder
+	for i, word := range strings.Split(name, "_") {
+		if word == "" {
+			continue
+		}
+		if i > 0 {
+			word = strings.ToUpper(word[:1]) + word[1:]
+		}
+		b.WriteString(word)
+	}
+	return b.String()
+}
+
+const tsClientHead = `export interface ClientOptions {
+  /** Sent in X-API-Key when set */
+  apiKey?: string;
+  /** Sent as a bearer token when set, instead of the API key */
+  token?: string;
+  fetch?: typeof fetch;
+}
+
+/** A response with an error status. */
+export class APIError extends Error {
+  constructor(readonly status: number, message: string) {
+    super(message);
+  }
+}
+
+/** Calls one service instance. */
+export class Client {
+  private readonly baseURL: string;
+
+  constructor(baseURL: string, private readonly options: ClientOptions = {}) {
+    this.baseURL = baseURL.replace(/\/+$/, "");
+  }
+
+`
+
+const tsClientTail = `  private url(path: string, query: Record<string, string | undefined> = {}): string {
+    const params = new URLSearchParams();
+    for (const [name, value] of Object.entries(query)) {
+      if (value !== undefined) {
+        params.set(name, value);
+      }
+    }
+    const search = params.toString();
+    return this.baseURL + path + (search ? "?" + search : "");
+  }
+
+  private async request(
+    method: string,
+    path: string,
+    init: { body?: unknown; form?: FormData; query?: Record<string, string | undefined> } = {},
+  ): Promise<Response> {
+    const headers: Record<string, string> = {};
+    if (this.options.token) {
+      headers["Authorization"] = "Bearer " + this.options.token;
+    } else if (this.options.apiKey) {
+      headers["X-API-Key"] = this.options.apiKey;
+    }
+    let body: BodyInit | undefined = init.form;
+    if (init.body !== undefined) {
+      headers["Content-Type"] = "application/json";
+      body = JSON.stringify(init.body);
+    }
+    const response = await (this.options.fetch ?? fetch)(this.url(path, init.query), { method, headers, body });
+    if (!response.ok) {
+      const message = (await response.text()).trim();
+      throw new APIError(response.status, message || response.statusText);
+    }
+    return response;
+  }
+}
+`
@@ -0,0 +1,39 @@
+package openapi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTypeScript(t *testing.T) {
+	doc := Build("Test API", "1.0.0", []Operation{
+		{Method: "POST", Path: "/pipeline/{id}/execute", Summary: "Start", Request: struct {
+			UserInput string `json:"user_input"`
+		}{}, Response: accepted{}, Status: 202},
+		{Method: "GET", Path: "/executions/{execution_id}/logs/ws", Query: []string{"backfill"}, WebSocket: true},
+		{Method: "GET", Path: "/schedule.ics", Query: []string{"days"}, ResponseType: "text/calendar"},
+		{Method: "POST", Path: "/assets", RequestType: "multipart/form-data", Request: struct {
+			File File `json:"file"`
+		}{}, Response: origin{}},
+		{Method: "DELETE", Path: "/assets/{key}", Status: 204},
+	})
+	ts := string(TypeScript(doc))
+
+	for _, want := range []string{
+		"export interface OpenapiAccepted {\n  execution_id: string;\n  links: Record<string, string>;\n  origin?: OpenapiOrigin;\n  tags?: string[];\n}",
+		"  /** Start */\n  async postPipelineIdExecute(id: string, body: { user_input: string }): Promise<OpenapiAccepted> {\n" +
+			"    return (await this.request(\"POST\", `/pipeline/${encodeURIComponent(id)}/execute`, { body })).json();\n  }",
+		"  getExecutionsExecutionIdLogsWsURL(executionId: string, query: { backfill?: string } = {}): string {\n" +
+			"    return this.url(`/executions/${encodeURIComponent(executionId)}/logs/ws`, query).replace(/^http/, \"ws\");\n  }",
+		"  getScheduleIcs(query: { days?: string } = {}): Promise<Response> {\n" +
+			"    return this.request(\"GET\", `/schedule.ics`, { query });\n  }",
+		"  async postAssets(form: FormData): Promise<OpenapiOrigin> {\n" +
+			"    return (await this.request(\"POST\", `/assets`, { form })).json();\n  }",
+		"  async deleteAssetsKey(key: string): Promise<void> {\n" +
+			"    await this.request(\"DELETE\", `/assets/${encodeURIComponent(key)}`);\n  }",
+	} {
+		if !strings.Contains(ts, want) {
+			t.Errorf("expected the client to contain\n%s\ngot\n%s", want, ts)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package pipeline
+
+import (
+	"sort"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+// AnnotationsResultKey is the key of the annotations in step results and in
+// the execution result sent to Drupal, where reviewers see them.
+const AnnotationsResultKey = "annotations"
+
+// addAnnotations copies the annotations the step left to its result.
+func addAnnotations(c *pipeline_type.Context, pipelineStep pipeline_type.PipelineStep, stepResult map[string]interface{}) {
+	if annotations := c.Annotations(pipelineStep.ID); len(annotations) > 0 {
+		stepResult[AnnotationsResultKey] = annotations
+	}
+}
+
+// ReviewNote is an annotation with the step it comes from.
+type ReviewNote struct {
+	StepUUID        string `json:"step_uuid"`
+	StepDescription string `json:"step_description,omitempty"`
+	Sequence        int    `json:"-"`
+	pipeline_type.Annotation
+}
+
+// collectAnnotations gathers the annotations of the step results, in step
+// order, so reviewers get them in one list.
+func collectAnnotations(results map[string]interface{}) []ReviewNote {
+	var notes []ReviewNote
+	for _, result := range results {
+		stepResult, ok := result.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		annotations, ok := stepResult[AnnotationsResultKey].([]pipeline_type.Annotation)
+		if !ok {
+			continue
+		}
+		uuid, _ := stepResult["step_uuid"].(string)
+		description, _ := stepResult["step_description"].(string)
+		sequence, _ := stepResult["sequence"].(int)
+		for _, annotation := range annotations {
+			notes = append(notes, ReviewNote{StepUUID: uuid, StepDescription: description, Sequence: sequence, Annotation: annotation})
+		}
+	}
+	sort.SliceStable(notes, func(i, j int) bool {
+		if notes[i].Sequence != notes[j].Sequence {
+			return notes[i].Sequence < notes[j].Sequence
+		}
+		return notes[i].StepUUID < notes[j].StepUUID
+	})
+	return notes
+}
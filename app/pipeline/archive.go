@@ -0,0 +1,101 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Archiver keeps a copy of an execution result before it expires from the
+// execution store.
+type Archiver interface {
+	Archive(result *ExecutionResult) error
+}
+
+// ExecutionArchiver receives the expired execution results. When nil they are
+// discarded.
+var ExecutionArchiver Archiver
+
+// NewArchiver creates the archiver for a location, either a local directory or
+// an "s3://bucket/prefix" URL. An empty location disables archiving.
+func NewArchiver(location string) (Archiver, error) {
+	if location == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(location, "s3://") {
+		bucket, prefix, _ := strings.Cut(strings.TrimPrefix(location, "s3://"), "/")
+		if bucket == "" {
+			return nil, fmt.Errorf("invalid S3 archive location: %s", location)
+		}
+		sess, err := session.NewSession()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create AWS session: %w", err)
+		}
+		return &S3Archiver{Client: s3.New(sess), Bucket: bucket, Prefix: strings.Trim(prefix, "/")}, nil
+	}
+	return &FileArchiver{Dir: location}, nil
+}
+
+// archiveKey groups archived results by day of completion.
+func archiveKey(result *ExecutionResult) string {
+	day := time.Unix(result.StartTime, 0).UTC().Format("2006-01-02")
+	if completedAt, err := time.Parse(time.RFC3339, result.CompletedAt); err == nil {
+		day = completedAt.UTC().Format("2006-01-02")
+	}
+	return path.Join(day, filepath.Base(result.ExecutionID)+".json")
+}
+
+// FileArchiver writes execution results as JSON files under Dir.
+type FileArchiver struct {
+	Dir string
+}
+
+func (a *FileArchiver) Archive(result *ExecutionResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("error marshaling execution result: %w", err)
+	}
+
+	target := filepath.Join(a.Dir, filepath.FromSlash(archiveKey(result)))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	if err := os.WriteFile(target, data, 0644); err != nil {
+		return fmt.Errorf("failed to write archived execution: %w", err)
+	}
+	return nil
+}
+
+// S3Archiver uploads execution results as JSON objects to an S3 bucket.
+type S3Archiver struct {
+	Client *s3.S3
+	Bucket string
+	Prefix string
+}
+
+func (a *S3Archiver) Archive(result *ExecutionResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("error marshaling execution result: %w", err)
+	}
+
+	_, err = a.Client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(a.Bucket),
+		Key:         aws.String(path.Join(a.Prefix, archiveKey(result))),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload archived execution to S3: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package pipeline
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/serisow/lesocle/artifact"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/plugin_registry"
+)
+
+// EmbedProvenance labels the media generated by LLM steps with their
+// provenance, it is set from the configuration at startup.
+var EmbedProvenance = true
+
+// ArtifactSigningKey signs the artifact manifests when set, it is parsed from
+// the configuration at startup.
+var ArtifactSigningKey ed25519.PrivateKey
+
+// processArtifact checksums and previews the media file a step produced, if
+// any, adding the details to its result. It returns the manifest entry of the
+// artifact.
+func processArtifact(ctx context.Context, pipelineID, executionID string, pipelineStep pipeline_type.PipelineStep, registry *plugin_registry.PluginRegistry, output interface{}, stepResult map[string]interface{}) *artifact.ManifestEntry {
+	media, ok := artifact.FromOutput(output)
+	if !ok {
+		return nil
+	}
+
+	// Label generated media before anything is checksummed or published
+	stepType := pipelineStep.Type
+	if current, ok := registry.ResolveAlias(stepType); ok {
+		stepType = current
+	}
+	if stepType == "llm_step" && EmbedProvenance {
+		serviceName, _ := pipelineStep.LLMServiceConfig["service_name"].(string)
+		modelName, _ := pipelineStep.LLMServiceConfig["model_name"].(string)
+		embedded, err := artifact.EmbedProvenance(ctx, media, artifact.Provenance{
+			Generator:   artifact.Generator,
+			Service:     serviceName,
+			Model:       modelName,
+			PipelineID:  pipelineID,
+			ExecutionID: executionID,
+			StepID:      pipelineStep.ID,
+			CreatedAt:   time.Now(),
+		})
+		if err != nil {
+			logExecution(executionID, pipelineStep.ID, "WARN", fmt.Sprintf("Provenance embedding failed: %v", err))
+		} else if embedded {
+			// The file changed, the checksum reported by the service no longer applies
+			media.SHA256 = ""
+			stepResult["provenance_embedded"] = true
+		}
+	}
+
+	var entry *artifact.ManifestEntry
+	sum, err := artifact.RecordChecksum(media)
+	if err != nil {
+		logExecution(executionID, pipelineStep.ID, "WARN", fmt.Sprintf("Checksum computation failed: %v", err))
+	} else {
+		stepResult["sha256"] = sum
+		entry = &artifact.ManifestEntry{
+			StepID:   pipelineStep.ID,
+			StepUUID: pipelineStep.UUID,
+			URI:      media.URI,
+			MimeType: media.MimeType,
+			SHA256:   sum,
+		}
+	}
+
+	// Small previews let dashboards show media outputs without downloading them
+	previews, err := artifact.GeneratePreviews(ctx, media)
+	if err != nil {
+		logExecution(executionID, pipelineStep.ID, "WARN", fmt.Sprintf("Preview generation failed: %v", err))
+	} else if len(previews) > 0 {
+		stepResult["previews"] = previews
+	}
+
+	return entry
+}
+
+// saveArtifactManifest writes the artifact manifest of an execution, signed
+// with ArtifactSigningKey when set. origin is set for regeneration runs.
+func saveArtifactManifest(executionID, pipelineID, definitionHash string, entries []artifact.ManifestEntry, origin *artifact.Origin) {
+	manifest := &artifact.Manifest{
+		ExecutionID:     executionID,
+		PipelineID:      pipelineID,
+		DefinitionHash:  definitionHash,
+		CreatedAt:       time.Now().UTC().Format(time.RFC3339),
+		Artifacts:       entries,
+		RegeneratedFrom: origin,
+	}
+
+	if ArtifactSigningKey != nil {
+		if err := manifest.Sign(ArtifactSigningKey); err != nil {
+			log.Printf("Error signing artifact manifest for execution %s: %v", executionID, err)
+		}
+	}
+
+	if err := artifact.SaveManifest(manifest); err != nil {
+		log.Printf("Error saving artifact manifest for execution %s: %v", executionID, err)
+	}
+}
@@ -0,0 +1,57 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/plugin_registry"
+)
+
+func TestProcessArtifactLabelsMediaOfRenamedLLMSteps(t *testing.T) {
+	previous := EmbedProvenance
+	defer func() { EmbedProvenance = previous }()
+
+	registry := plugin_registry.NewPluginRegistry()
+	registry.RegisterAlias("llm_generate", "llm_step")
+
+	tests := []struct {
+		name     string
+		stepType string
+		enabled  bool
+		want     bool
+	}{
+		{"llm step", "llm_step", true, true},
+		{"alias of the llm step", "llm_generate", true, true},
+		{"other step", "upload_image_step", true, false},
+		{"disabled", "llm_step", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			EmbedProvenance = tt.enabled
+			var data bytes.Buffer
+			png.Encode(&data, image.NewRGBA(image.Rect(0, 0, 8, 8)))
+			path := filepath.Join(t.TempDir(), "generated.png")
+			if err := os.WriteFile(path, data.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			step := pipeline_type.PipelineStep{ID: "image", UUID: "uuid-image", Type: tt.stepType}
+			stepResult := map[string]interface{}{}
+			output := map[string]interface{}{"uri": path, "mime_type": "image/png"}
+			entry := processArtifact(context.Background(), "p1", "exec-artifact", step, registry, output, stepResult)
+			if entry == nil || entry.SHA256 == "" {
+				t.Fatalf("expected a manifest entry, got %+v", entry)
+			}
+			if embedded := stepResult["provenance_embedded"] == true; embedded != tt.want {
+				t.Errorf("provenance embedded: %v, want %v", embedded, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+// AssetDir is where assets pushed by external systems wait for the next
+// execution of their pipeline.
+var AssetDir = filepath.Join("storage", "pipeline", "assets")
+
+// AssetsOutputKey is the step output listing the assets of an execution by
+// key. Each asset is also the output "asset_<key>".
+const AssetsOutputKey = "assets"
+
+// ErrInvalidAssetKey is returned for asset keys that can't be used as output
+// keys.
+var ErrInvalidAssetKey = errors.New("invalid asset key")
+
+var assetKeyPattern = regexp.MustCompile(`^[a-z0-9_]{1,64}$`)
+
+// assetMetaSuffix names the metadata file of an asset, apart from the asset
+// itself which may be a .json file too.
+const assetMetaSuffix = ".meta.json"
+
+func assetMetaPath(dir, key string) string {
+	return filepath.Join(dir, key+assetMetaSuffix)
+}
+
+// Asset is a file pushed ahead of an execution, e.g. a photo taken by an
+// editor or a CSV export.
+type Asset struct {
+	Key        string `json:"key"`
+	Tag        string `json:"tag,omitempty"`
+	Filename   string `json:"filename"`
+	MimeType   string `json:"mime_type"`
+	URI        string `json:"uri"`
+	Size       int64  `json:"size"`
+	SHA256     string `json:"sha256"`
+	ReceivedAt string `json:"received_at"`
+}
+
+func pendingAssetDir(pipelineID string) string {
+	return filepath.Join(AssetDir, filepath.Base(pipelineID), "pending")
+}
+
+// SaveAsset stores an asset for the next execution of the pipeline, replacing
+// a pending asset with the same key.
+func SaveAsset(pipelineID, key, tag, filename, mimeType string, content io.Reader) (*Asset, error) {
+	if !assetKeyPattern.MatchString(key) {
+		return nil, fmt.Errorf("%w: %q, use lowercase letters, digits and underscores", ErrInvalidAssetKey, key)
+	}
+	dir := pendingAssetDir(pipelineID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create asset directory: %w", err)
+	}
+
+	// Stored under the key, the extension only helps tools guess the type
+	filename = filepath.Base(filename)
+	path := filepath.Join(dir, key+strings.ToLower(filepath.Ext(filename)))
+	tmp, err := os.CreateTemp(dir, ".asset-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create asset file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write asset: %w", err)
+	}
+
+	// A new upload may change the extension, drop the previous file
+	if previous, err := loadAsset(dir, key); err == nil && previous.URI != path {
+		os.Remove(previous.URI)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, fmt.Errorf("failed to save asset: %w", err)
+	}
+
+	asset := &Asset{
+		Key:        key,
+		Tag:        tag,
+		Filename:   filename,
+		MimeType:   mimeType,
+		URI:        path,
+		Size:       size,
+		SHA256:     hex.EncodeToString(hash.Sum(nil)),
+		ReceivedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	data, err := json.MarshalIndent(asset, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling asset: %w", err)
+	}
+	if err := os.WriteFile(assetMetaPath(dir, key), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write asset metadata: %w", err)
+	}
+	return asset, nil
+}
+
+func loadAsset(dir, key string) (*Asset, error) {
+	data, err := os.ReadFile(assetMetaPath(dir, key))
+	if err != nil {
+		return nil, err
+	}
+	var asset Asset
+	if err := json.Unmarshal(data, &asset); err != nil {
+		return nil, fmt.Errorf("error decoding asset %s: %w", key, err)
+	}
+	return &asset, nil
+}
+
+// PendingAssets returns the assets waiting for the next execution of the
+// pipeline, sorted by key.
+func PendingAssets(pipelineID string) ([]Asset, error) {
+	dir := pendingAssetDir(pipelineID)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read assets: %w", err)
+	}
+
+	var assets []Asset
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, assetMetaSuffix) {
+			continue
+		}
+		asset, err := loadAsset(dir, strings.TrimSuffix(name, assetMetaSuffix))
+		if err != nil {
+			log.Printf("Skipping asset %s of pipeline %s: %v", name, pipelineID, err)
+			continue
+		}
+		assets = append(assets, *asset)
+	}
+	sort.Slice(assets, func(i, j int) bool { return assets[i].Key < assets[j].Key })
+	return assets, nil
+}
+
+// RemoveAsset deletes a pending asset.
+func RemoveAsset(pipelineID, key string) error {
+	dir := pendingAssetDir(pipelineID)
+	asset, err := loadAsset(dir, filepath.Base(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no pending asset %s for pipeline %s", key, pipelineID)
+		}
+		return err
+	}
+	os.Remove(asset.URI)
+	return os.Remove(assetMetaPath(dir, asset.Key))
+}
+
+// applyAssets exposes the assets to the steps, as file outputs.
+func applyAssets(c *pipeline_type.Context, assets []Asset) {
+	if len(assets) == 0 {
+		return
+	}
+	all := make(map[string]interface{}, len(assets))
+	for _, asset := range assets {
+		info := map[string]interface{}{
+			"uri":       asset.URI,
+			"mime_type": asset.MimeType,
+			"filename":  asset.Filename,
+			"size":      asset.Size,
+			"sha256":    asset.SHA256,
+			"tag":       asset.Tag,
+		}
+		all[asset.Key] = info
+		c.SetStepOutput("asset_"+asset.Key, info)
+	}
+	c.SetStepOutput(AssetsOutputKey, all)
+}
+
+// consumeAssets moves the assets an execution used out of the pending ones,
+// so the next run doesn't pick them up again. Assets replaced meanwhile stay
+// pending.
+func consumeAssets(pipelineID, executionID string, assets []Asset) {
+	if len(assets) == 0 {
+		return
+	}
+	pending := pendingAssetDir(pipelineID)
+	consumed := filepath.Join(AssetDir, filepath.Base(pipelineID), "consumed", filepath.Base(executionID))
+	if err := os.MkdirAll(consumed, 0755); err != nil {
+		log.Printf("Error creating consumed assets directory: %v", err)
+		return
+	}
+	for _, asset := range assets {
+		current, err := loadAsset(pending, asset.Key)
+		if err != nil || current.SHA256 != asset.SHA256 {
+			continue
+		}
+		if err := os.Rename(current.URI, filepath.Join(consumed, filepath.Base(current.URI))); err != nil {
+			log.Printf("Error consuming asset %s of pipeline %s: %v", asset.Key, pipelineID, err)
+			continue
+		}
+		os.Rename(assetMetaPath(pending, asset.Key), assetMetaPath(consumed, asset.Key))
+	}
+}
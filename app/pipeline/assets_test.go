@@ -0,0 +1,98 @@
+package pipeline
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+func TestAssetsLifecycle(t *testing.T) {
+	if _, err := SaveAsset("p-assets", "Bad Key", "", "a.png", "image/png", strings.NewReader("x")); !errors.Is(err, ErrInvalidAssetKey) {
+		t.Errorf("expected ErrInvalidAssetKey, got %v", err)
+	}
+
+	if _, err := SaveAsset("p-assets", "cover", "", "old.jpg", "image/jpeg", strings.NewReader("old")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// A new upload replaces the pending asset of the same key
+	cover, err := SaveAsset("p-assets", "cover", "issue-42", "photo.png", "image/png", strings.NewReader("png data"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := SaveAsset("p-assets", "prices", "", "prices.csv", "text/csv", strings.NewReader("a,b\n1,2\n")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assets, err := PendingAssets("p-assets")
+	if err != nil || len(assets) != 2 {
+		t.Fatalf("expected 2 pending assets, got %v, %v", assets, err)
+	}
+
+	c := pipeline_type.NewContext()
+	applyAssets(c, assets)
+	info, err := c.GetFileInfo("asset_cover")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.URI != cover.URI || info.Size != int64(len("png data")) {
+		t.Errorf("unexpected asset output %+v", info)
+	}
+	if data, _ := os.ReadFile(info.URI); string(data) != "png data" {
+		t.Errorf("expected the latest upload, got %q", data)
+	}
+	var all map[string]interface{}
+	if err := c.GetJSON(AssetsOutputKey, &all); err != nil || len(all) != 2 {
+		t.Errorf("expected both assets in the %s output, got %v, %v", AssetsOutputKey, all, err)
+	}
+
+	// Replaced during the execution, the new version stays for the next run
+	SaveAsset("p-assets", "prices", "", "prices.csv", "text/csv", strings.NewReader("a,b\n3,4\n"))
+	consumeAssets("p-assets", "exec-assets", assets)
+
+	remaining, _ := PendingAssets("p-assets")
+	if len(remaining) != 1 || remaining[0].Key != "prices" {
+		t.Errorf("expected only the replaced asset to stay pending, got %v", remaining)
+	}
+
+	if err := RemoveAsset("p-assets", "prices"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if remaining, _ := PendingAssets("p-assets"); len(remaining) != 0 {
+		t.Errorf("expected no pending asset, got %v", remaining)
+	}
+}
+
+func TestJSONAssetKeepsItsContent(t *testing.T) {
+	payload := `{"headline":"Launch"}`
+	saved, err := SaveAsset("p-json-assets", "brief", "", "brief.json", "application/json", strings.NewReader(payload))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(saved.URI); string(data) != payload {
+		t.Errorf("expected the uploaded file at %s, got %q", saved.URI, data)
+	}
+
+	assets, err := PendingAssets("p-json-assets")
+	if err != nil || len(assets) != 1 {
+		t.Fatalf("expected 1 pending asset, got %v, %v", assets, err)
+	}
+	if assets[0].URI != saved.URI || assets[0].Filename != "brief.json" {
+		t.Errorf("unexpected pending asset %+v", assets[0])
+	}
+
+	consumeAssets("p-json-assets", "exec-json", assets)
+	consumed := filepath.Join(AssetDir, "p-json-assets", "consumed", "exec-json")
+	if data, _ := os.ReadFile(filepath.Join(consumed, filepath.Base(saved.URI))); string(data) != payload {
+		t.Errorf("expected the consumed asset to keep its content, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(consumed, "brief"+assetMetaSuffix)); err != nil {
+		t.Errorf("expected the metadata next to the consumed asset: %v", err)
+	}
+	if remaining, _ := PendingAssets("p-json-assets"); len(remaining) != 0 {
+		t.Errorf("expected no pending asset, got %v", remaining)
+	}
+}
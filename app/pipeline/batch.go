@@ -0,0 +1,118 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/serisow/lesocle/api"
+)
+
+// BatchDir is where the batches of bulk executions are kept.
+var BatchDir = filepath.Join("storage", "pipeline", "batches")
+
+// Batch statuses, the item statuses are the execution ones plus
+// BatchPending.
+const (
+	// BatchPending is an item whose execution hasn't started yet
+	BatchPending   = "pending"
+	BatchRunning   = "running"
+	BatchCompleted = "completed"
+	// BatchFailed is a finished batch with at least one failed execution
+	BatchFailed = "failed"
+)
+
+// Batch groups the executions of a bulk request, one per parameter set.
+type Batch struct {
+	ID           string   `json:"id"`
+	PipelineID   string   `json:"pipeline_id"`
+	ExecutionIDs []string `json:"execution_ids"`
+	CreatedAt    string   `json:"created_at"`
+}
+
+// NewBatch creates a batch of the executions of a pipeline.
+func NewBatch(id, pipelineID string, executionIDs []string) *Batch {
+	return &Batch{
+		ID:           id,
+		PipelineID:   pipelineID,
+		ExecutionIDs: executionIDs,
+		CreatedAt:    time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+func batchPath(id string) string {
+	return filepath.Join(BatchDir, filepath.Base(id)+".json")
+}
+
+// SaveBatch writes a batch to the store.
+func SaveBatch(b *Batch) error {
+	if err := os.MkdirAll(BatchDir, 0755); err != nil {
+		return fmt.Errorf("failed to create batch directory: %w", err)
+	}
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling batch: %w", err)
+	}
+	if err := os.WriteFile(batchPath(b.ID), data, 0644); err != nil {
+		return fmt.Errorf("failed to write batch: %w", err)
+	}
+	return nil
+}
+
+// LoadBatch reads a batch. The error satisfies os.IsNotExist when there is
+// none.
+func LoadBatch(id string) (*Batch, error) {
+	data, err := os.ReadFile(batchPath(id))
+	if err != nil {
+		return nil, err
+	}
+	var b Batch
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("error decoding batch: %w", err)
+	}
+	return &b, nil
+}
+
+// Status aggregates the status of the executions of the batch. Executions
+// not in the execution store yet are pending.
+func (b *Batch) Status() api.BatchStatus {
+	status := api.BatchStatus{
+		BatchID:    b.ID,
+		PipelineID: b.PipelineID,
+		CreatedAt:  b.CreatedAt,
+		Counts:     map[string]int{},
+		Items:      make([]api.BatchItem, 0, len(b.ExecutionIDs)),
+	}
+	for i, executionID := range b.ExecutionIDs {
+		item := api.BatchItem{Index: i, ExecutionID: executionID, Status: BatchPending, Links: executionLinks(b.PipelineID, executionID)}
+		if execution, ok := GetExecution(executionID); ok {
+			ExecutionStore.RLock()
+			item.Status = string(execution.Status)
+			item.ErrorMessage = execution.ErrorMessage
+			ExecutionStore.RUnlock()
+		}
+		status.Counts[item.Status]++
+		status.Items = append(status.Items, item)
+	}
+
+	switch {
+	case status.Counts[BatchPending] == len(b.ExecutionIDs):
+		status.Status = BatchPending
+	case status.Counts[BatchPending] > 0 || status.Counts[string(StatusStarted)] > 0:
+		status.Status = BatchRunning
+	case status.Counts[string(StatusFailed)] > 0:
+		status.Status = BatchFailed
+	default:
+		status.Status = BatchCompleted
+	}
+	return status
+}
+
+func executionLinks(pipelineID, executionID string) map[string]string {
+	return map[string]string{
+		"status":  fmt.Sprintf("/pipeline/%s/execution/%s/status", pipelineID, executionID),
+		"results": fmt.Sprintf("/pipeline/%s/execution/%s/results", pipelineID, executionID),
+	}
+}
@@ -0,0 +1,49 @@
+package pipeline
+
+import (
+	"os"
+	"testing"
+)
+
+func TestBatchStatus(t *testing.T) {
+	originalDir := BatchDir
+	BatchDir = t.TempDir()
+	defer func() { BatchDir = originalDir }()
+
+	batch := NewBatch("batch-1", "p1", []string{"batch-exec-1", "batch-exec-2"})
+	if err := SaveBatch(batch); err != nil {
+		t.Fatalf("SaveBatch: %v", err)
+	}
+	loaded, err := LoadBatch("batch-1")
+	if err != nil {
+		t.Fatalf("LoadBatch: %v", err)
+	}
+	if status := loaded.Status(); status.Status != BatchPending || status.Counts[BatchPending] != 2 {
+		t.Fatalf("expected a pending batch, got %+v", status)
+	}
+
+	defer func() {
+		ExecutionStore.Lock()
+		delete(ExecutionStore.Executions, "batch-exec-1")
+		delete(ExecutionStore.Executions, "batch-exec-2")
+		ExecutionStore.Unlock()
+	}()
+
+	AddExecution("batch-exec-1", &ExecutionResult{ExecutionID: "batch-exec-1", Status: StatusCompleted})
+	if status := loaded.Status(); status.Status != BatchRunning {
+		t.Fatalf("expected a running batch, got %s", status.Status)
+	}
+
+	AddExecution("batch-exec-2", &ExecutionResult{ExecutionID: "batch-exec-2", Status: StatusFailed, ErrorMessage: "boom"})
+	status := loaded.Status()
+	if status.Status != BatchFailed || status.Items[1].ErrorMessage != "boom" {
+		t.Fatalf("expected a failed batch, got %+v", status)
+	}
+	if status.Items[0].Links["status"] != "/pipeline/p1/execution/batch-exec-1/status" {
+		t.Errorf("unexpected links %v", status.Items[0].Links)
+	}
+
+	if _, err := LoadBatch("missing"); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+}
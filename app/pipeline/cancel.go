@@ -0,0 +1,102 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrExecutionTimedOut is the cause of the executions cancelled for running
+// longer than their maximum duration.
+var ErrExecutionTimedOut = errors.New("execution timed out")
+
+// ErrExecutionCancelled is the cause of the executions cancelled on request.
+var ErrExecutionCancelled = errors.New("execution cancelled")
+
+// WatchdogResultKey is the result reporting an execution timed out.
+const WatchdogResultKey = "watchdog"
+
+// cancels holds the cancel function of every running execution.
+var cancels = struct {
+	sync.Mutex
+	byExecution map[string]context.CancelCauseFunc
+}{byExecution: make(map[string]context.CancelCauseFunc)}
+
+// withCancel returns a context of the execution that CancelExecution cancels,
+// and the function unregistering it once the execution returned.
+func withCancel(parent context.Context, executionID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+	cancels.Lock()
+	cancels.byExecution[executionID] = cancel
+	cancels.Unlock()
+	return ctx, func() {
+		cancels.Lock()
+		delete(cancels.byExecution, executionID)
+		cancels.Unlock()
+		cancel(nil)
+	}
+}
+
+// CancelExecution cancels a running execution: the calls of its steps are
+// aborted and their child processes, such as ffmpeg, killed. It reports
+// whether the execution was running.
+func CancelExecution(executionID string, cause error) bool {
+	cancels.Lock()
+	cancel, ok := cancels.byExecution[executionID]
+	cancels.Unlock()
+	if ok {
+		cancel(cause)
+	}
+	return ok
+}
+
+// TimeOutExecution cancels an execution running longer than maxDuration and
+// reports it failed right away, to the execution store and to Drupal, without
+// waiting for steps that ignore the cancellation. The execution drops its own
+// results whenever it returns.
+func TimeOutExecution(pipelineID, executionID string, startedAt time.Time, maxDuration time.Duration) {
+	CancelExecution(executionID, ErrExecutionTimedOut)
+
+	err := fmt.Errorf("%w after %s", ErrExecutionTimedOut, maxDuration)
+	now := time.Now()
+	results := map[string]interface{}{
+		WatchdogResultKey: map[string]interface{}{
+			"step_description": "Execution watchdog",
+			"status":           "failed",
+			"start_time":       startedAt.Unix(),
+			"end_time":         now.Unix(),
+			"error_message":    err.Error(),
+		},
+		DiagnosisResultKey: &Diagnosis{
+			ErrorClass:   ErrorClassTimeout,
+			ErrorMessage: err.Error(),
+			Remediation:  fmt.Sprintf("The execution ran longer than %s and was cancelled, check the step it was stuck in or raise EXECUTION_MAX_DURATION", maxDuration),
+		},
+	}
+
+	ExecutionStore.Lock()
+	if execResult, ok := ExecutionStore.Executions[executionID]; ok {
+		execResult.Status = StatusFailed
+		execResult.EndTime = now.Unix()
+		execResult.CompletedAt = now.UTC().Format(time.RFC3339)
+		execResult.ErrorMessage = err.Error()
+		execResult.Results = results
+	}
+	ExecutionStore.Unlock()
+
+	logExecution(executionID, "", "ERROR", fmt.Sprintf("Execution failed: %v", err))
+	Events.Publish(Event{Type: EventExecutionFailed, PipelineID: pipelineID, ExecutionID: executionID, Result: results, Error: err})
+
+	if sendErr := SendExecutionResultsFunc(pipelineID, results, startedAt.Unix(), now.Unix()); sendErr != nil {
+		log.Printf("Error sending timeout result of execution %s: %v", executionID, sendErr)
+	}
+}
+
+// timedOut reports whether the execution of ctx was timed out, its results
+// were then already reported.
+func timedOut(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrExecutionTimedOut)
+}
@@ -0,0 +1,73 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/serisow/lesocle/action_step"
+	"github.com/serisow/lesocle/pipeline/step"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/plugin_registry"
+	"github.com/serisow/lesocle/services/action_service"
+)
+
+func TestTimedOutExecutionIsReportedOnce(t *testing.T) {
+	var mu sync.Mutex
+	var sent []map[string]interface{}
+	originalSend := SendExecutionResultsFunc
+	defer func() { SendExecutionResultsFunc = originalSend }()
+	SendExecutionResultsFunc = func(pipelineID string, results map[string]interface{}, startTime, endTime int64) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, results)
+		return nil
+	}
+
+	started := make(chan struct{})
+	stuck := &action_service.MockActionService{
+		Response: func(ctx context.Context, actionConfig string, c *pipeline_type.Context, s *pipeline_type.PipelineStep) string {
+			close(started)
+			<-ctx.Done()
+			return "too late"
+		},
+	}
+	registry := plugin_registry.NewPluginRegistry()
+	registry.RegisterActionService("stuck", stuck)
+	registry.RegisterStepType("action_step", func() step.Step { return &action_step.ActionStepImpl{} })
+
+	p := &pipeline_type.Pipeline{
+		ID: "pipeline-stuck",
+		Steps: []pipeline_type.PipelineStep{
+			{ID: "wait", UUID: "uuid-wait", Type: "action_step", StepOutputKey: "waited",
+				ActionDetails: &pipeline_type.ActionDetails{ActionService: "stuck", ExecutionLocation: "go"}},
+			{ID: "after", UUID: "uuid-after", Type: "action_step", RequiredSteps: "waited",
+				ActionDetails: &pipeline_type.ActionDetails{ActionService: "stuck", ExecutionLocation: "go"}},
+		},
+		Context: pipeline_type.NewContext(),
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- ExecutePipeline("exec-stuck", p, registry) }()
+	<-started
+
+	TimeOutExecution(p.ID, "exec-stuck", time.Now().Add(-time.Hour), time.Minute)
+	if err := <-errc; !errors.Is(err, ErrExecutionTimedOut) {
+		t.Fatalf("expected ErrExecutionTimedOut, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sent) != 1 || sent[0][WatchdogResultKey] == nil {
+		t.Fatalf("expected only the timeout result sent, got %v", sent)
+	}
+	execution, _ := GetExecution("exec-stuck")
+	if execution.Status != StatusFailed || execution.Results[WatchdogResultKey] == nil {
+		t.Errorf("expected the execution marked timed out, got %+v", execution)
+	}
+	if CancelExecution("exec-stuck", nil) {
+		t.Error("expected the execution unregistered once returned")
+	}
+}
@@ -0,0 +1,209 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrMaintenance is returned when new executions are refused because the
+	// service is in maintenance mode.
+	ErrMaintenance = errors.New("service is in maintenance mode")
+	// ErrPipelineDisabled is returned when a pipeline was switched off.
+	ErrPipelineDisabled = errors.New("pipeline is disabled")
+	// ErrSchedulePaused is returned when the schedule of a pipeline is paused,
+	// on demand executions still run.
+	ErrSchedulePaused = errors.New("pipeline schedule is paused")
+)
+
+// Switch is an on/off state with the reason and time it was last changed.
+type Switch struct {
+	Enabled   bool   `json:"enabled"`
+	Reason    string `json:"reason,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+// DisabledPipeline records why and when a pipeline was switched off.
+type DisabledPipeline struct {
+	Reason     string `json:"reason,omitempty"`
+	DisabledAt string `json:"disabled_at"`
+}
+
+// PausedSchedule records why and when the schedule of a pipeline was paused.
+type PausedSchedule struct {
+	Reason   string `json:"reason,omitempty"`
+	PausedAt string `json:"paused_at"`
+}
+
+// ControlStore holds the maintenance flag, the per-pipeline kill switches and
+// the paused schedules.
+// They only gate new executions, the ones in flight finish normally. The state
+// is persisted so a restart during an incident doesn't re-enable everything.
+type ControlStore struct {
+	sync.RWMutex
+	path  string
+	state controlState
+}
+
+type controlState struct {
+	Maintenance Switch                      `json:"maintenance"`
+	Disabled    map[string]DisabledPipeline `json:"disabled_pipelines"`
+	Paused      map[string]PausedSchedule   `json:"paused_schedules,omitempty"`
+}
+
+// Controls is the control store checked before starting executions.
+var Controls = NewControlStore(filepath.Join("storage", "pipeline", "controls.json"))
+
+// NewControlStore creates a control store persisted at path, loading the
+// previous state.
+func NewControlStore(path string) *ControlStore {
+	s := &ControlStore{path: path, state: controlState{
+		Disabled: make(map[string]DisabledPipeline),
+		Paused:   make(map[string]PausedSchedule),
+	}}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &s.state); err != nil {
+			log.Printf("Error loading pipeline controls from %s: %v", path, err)
+		}
+		if s.state.Disabled == nil {
+			s.state.Disabled = make(map[string]DisabledPipeline)
+		}
+		if s.state.Paused == nil {
+			s.state.Paused = make(map[string]PausedSchedule)
+		}
+	}
+	return s
+}
+
+// SetMaintenance turns maintenance mode on or off.
+func (s *ControlStore) SetMaintenance(enabled bool, reason string) error {
+	s.Lock()
+	defer s.Unlock()
+	s.state.Maintenance = Switch{Enabled: enabled, Reason: reason, UpdatedAt: time.Now().UTC().Format(time.RFC3339)}
+	return s.save()
+}
+
+// Maintenance returns the maintenance mode state.
+func (s *ControlStore) Maintenance() Switch {
+	s.RLock()
+	defer s.RUnlock()
+	return s.state.Maintenance
+}
+
+// SetPipelineDisabled switches a pipeline off, or back on.
+func (s *ControlStore) SetPipelineDisabled(pipelineID string, disabled bool, reason string) error {
+	s.Lock()
+	defer s.Unlock()
+	if disabled {
+		s.state.Disabled[pipelineID] = DisabledPipeline{Reason: reason, DisabledAt: time.Now().UTC().Format(time.RFC3339)}
+	} else {
+		delete(s.state.Disabled, pipelineID)
+	}
+	return s.save()
+}
+
+// DisabledPipelines returns the disabled pipelines keyed by pipeline ID.
+func (s *ControlStore) DisabledPipelines() map[string]DisabledPipeline {
+	s.RLock()
+	defer s.RUnlock()
+	disabled := make(map[string]DisabledPipeline, len(s.state.Disabled))
+	for id, d := range s.state.Disabled {
+		disabled[id] = d
+	}
+	return disabled
+}
+
+// SetSchedulePaused pauses the schedule of a pipeline, or resumes it. Only the
+// scheduler honors it, the pipeline can still be executed on demand.
+func (s *ControlStore) SetSchedulePaused(pipelineID string, paused bool, reason string) error {
+	s.Lock()
+	defer s.Unlock()
+	if paused {
+		s.state.Paused[pipelineID] = PausedSchedule{Reason: reason, PausedAt: time.Now().UTC().Format(time.RFC3339)}
+	} else {
+		delete(s.state.Paused, pipelineID)
+	}
+	return s.save()
+}
+
+// PausedSchedules returns the paused schedules keyed by pipeline ID.
+func (s *ControlStore) PausedSchedules() map[string]PausedSchedule {
+	s.RLock()
+	defer s.RUnlock()
+	paused := make(map[string]PausedSchedule, len(s.state.Paused))
+	for id, p := range s.state.Paused {
+		paused[id] = p
+	}
+	return paused
+}
+
+// CanSchedule is CanStart for the runs started by the scheduler, it also
+// returns an error wrapping ErrSchedulePaused when the schedule is paused.
+func (s *ControlStore) CanSchedule(pipelineID string) error {
+	if err := s.CanStart(pipelineID); err != nil {
+		return err
+	}
+	s.RLock()
+	defer s.RUnlock()
+	if p, ok := s.state.Paused[pipelineID]; ok {
+		if p.Reason != "" {
+			return fmt.Errorf("%w: %s", ErrSchedulePaused, p.Reason)
+		}
+		return ErrSchedulePaused
+	}
+	return nil
+}
+
+// CanStart returns an error wrapping ErrMaintenance or ErrPipelineDisabled
+// when a new execution of the pipeline must not start.
+func (s *ControlStore) CanStart(pipelineID string) error {
+	s.RLock()
+	defer s.RUnlock()
+	if m := s.state.Maintenance; m.Enabled {
+		if m.Reason != "" {
+			return fmt.Errorf("%w: %s", ErrMaintenance, m.Reason)
+		}
+		return ErrMaintenance
+	}
+	if d, ok := s.state.Disabled[pipelineID]; ok {
+		if d.Reason != "" {
+			return fmt.Errorf("%w: %s", ErrPipelineDisabled, d.Reason)
+		}
+		return ErrPipelineDisabled
+	}
+	return nil
+}
+
+// save persists the state. Callers must hold the lock.
+func (s *ControlStore) save() error {
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling pipeline controls: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create controls directory: %w", err)
+	}
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to save pipeline controls: %w", err)
+	}
+	return nil
+}
+
+// RunningExecutions counts the executions still in progress.
+func RunningExecutions() int {
+	ExecutionStore.RLock()
+	defer ExecutionStore.RUnlock()
+	running := 0
+	for _, execResult := range ExecutionStore.Executions {
+		if execResult.Status == StatusStarted {
+			running++
+		}
+	}
+	return running
+}
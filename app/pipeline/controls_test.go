@@ -0,0 +1,63 @@
+package pipeline
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestControlStorePersistsSwitches(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "controls.json")
+	store := NewControlStore(path)
+
+	if err := store.SetPipelineDisabled("p1", true, "bad prompt"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.CanStart("p1"); !errors.Is(err, ErrPipelineDisabled) {
+		t.Errorf("expected ErrPipelineDisabled, got %v", err)
+	}
+	if err := store.CanStart("p2"); err != nil {
+		t.Errorf("expected p2 to start, got %v", err)
+	}
+
+	if err := store.SetMaintenance(true, "deploy"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reloaded := NewControlStore(path)
+	if err := reloaded.CanStart("p2"); !errors.Is(err, ErrMaintenance) {
+		t.Errorf("expected maintenance to survive a restart, got %v", err)
+	}
+
+	reloaded.SetMaintenance(false, "")
+	reloaded.SetPipelineDisabled("p1", false, "")
+	if err := reloaded.CanStart("p1"); err != nil {
+		t.Errorf("expected p1 to start again, got %v", err)
+	}
+}
+
+func TestControlStorePausedSchedules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "controls.json")
+	store := NewControlStore(path)
+
+	if err := store.SetSchedulePaused("p1", true, "incident"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.CanSchedule("p1"); !errors.Is(err, ErrSchedulePaused) {
+		t.Errorf("expected ErrSchedulePaused, got %v", err)
+	}
+	// On demand executions are not affected
+	if err := store.CanStart("p1"); err != nil {
+		t.Errorf("expected p1 to start on demand, got %v", err)
+	}
+
+	reloaded := NewControlStore(path)
+	if _, ok := reloaded.PausedSchedules()["p1"]; !ok {
+		t.Error("expected the paused schedule to survive a restart")
+	}
+
+	reloaded.SetSchedulePaused("p1", false, "")
+	if err := reloaded.CanSchedule("p1"); err != nil {
+		t.Errorf("expected p1 to be scheduled again, got %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"sort"
+
+	"github.com/serisow/lesocle/api"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/pricing"
+)
+
+// CostResultKey is the key of the estimated LLM cost in step results and in
+// the execution result sent to Drupal.
+const CostResultKey = "cost"
+
+// StepCost is the estimated cost of the LLM calls of a step.
+type StepCost struct {
+	Model    string  `json:"model"`
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+}
+
+// stepCost prices the usage of a step. It is false when the model has no
+// price.
+func stepCost(usage pipeline_type.TokenUsage) (StepCost, bool) {
+	price, ok := pricing.Lookup(usage.Model)
+	if !ok {
+		return StepCost{}, false
+	}
+	return StepCost{
+		Model:    usage.Model,
+		Amount:   roundCost(price.CallsCost(usage.Requests, usage.PromptTokens, usage.CompletionTokens)),
+		Currency: pricing.Currency,
+	}, true
+}
+
+// executionCost sums the costs of the step results, nil when no step called
+// an LLM.
+func executionCost(results map[string]interface{}) *api.ExecutionCost {
+	var cost *api.ExecutionCost
+	unpriced := make(map[string]bool)
+	for stepUUID, result := range results {
+		stepResult, ok := result.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		usage, ok := stepResult[TokenUsageResultKey].(pipeline_type.TokenUsage)
+		if !ok {
+			continue
+		}
+		if cost == nil {
+			cost = &api.ExecutionCost{Currency: pricing.Currency, Steps: make(map[string]float64)}
+		}
+		usages := []pipeline_type.TokenUsage{usage}
+		if tools, ok := stepResult[ToolTokenUsageResultKey].(map[string]pipeline_type.TokenUsage); ok {
+			for _, toolUsage := range tools {
+				usages = append(usages, toolUsage)
+			}
+		}
+		for _, usage := range usages {
+			if _, ok := pricing.Lookup(usage.Model); !ok && usage.Model != "" {
+				unpriced[usage.Model] = true
+			}
+		}
+		stepCost, ok := stepResult[CostResultKey].(StepCost)
+		if !ok {
+			continue
+		}
+		cost.Steps[stepUUID] = stepCost.Amount
+		cost.Total += stepCost.Amount
+	}
+	if cost == nil {
+		return nil
+	}
+	cost.Total = roundCost(cost.Total)
+	for model := range unpriced {
+		cost.UnpricedModels = append(cost.UnpricedModels, model)
+	}
+	sort.Strings(cost.UnpricedModels)
+	return cost
+}
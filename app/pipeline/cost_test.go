@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+func TestExecutionCostSumsPricedSteps(t *testing.T) {
+	c := pipeline_type.NewContext()
+	c.RecordTokenUsage("write", pipeline_type.TokenUsage{Model: "gpt-4o-mini", Requests: 1, PromptTokens: 1_000_000, CompletionTokens: 500_000})
+	c.RecordTokenUsage("illustrate", pipeline_type.TokenUsage{Model: "dall-e-3", Requests: 1})
+	c.RecordTokenUsage("illustrate", pipeline_type.TokenUsage{Model: "dall-e-3", Requests: 1})
+	c.RecordTokenUsage("local", pipeline_type.TokenUsage{Model: "my-local-model", Requests: 1, PromptTokens: 10})
+
+	results := map[string]interface{}{"uuid-search": map[string]interface{}{"status": "completed"}}
+	for _, id := range []string{"write", "illustrate", "local"} {
+		stepResult := map[string]interface{}{}
+		addTokenUsage(c, pipeline_type.PipelineStep{ID: id}, stepResult)
+		results["uuid-"+id] = stepResult
+	}
+
+	if cost := results["uuid-write"].(map[string]interface{})[CostResultKey].(StepCost); cost.Amount != 0.45 {
+		t.Errorf("expected gpt-4o-mini to cost 0.45, got %v", cost.Amount)
+	}
+	cost := executionCost(results)
+	if cost == nil {
+		t.Fatal("expected an execution cost")
+	}
+	if cost.Total != 0.53 {
+		t.Errorf("expected a total of 0.53, got %v", cost.Total)
+	}
+	if cost.Steps["uuid-illustrate"] != 0.08 {
+		t.Errorf("expected two images at 0.04, got %v", cost.Steps["uuid-illustrate"])
+	}
+	if !reflect.DeepEqual(cost.UnpricedModels, []string{"my-local-model"}) {
+		t.Errorf("unexpected unpriced models %v", cost.UnpricedModels)
+	}
+
+	if executionCost(map[string]interface{}{"uuid-search": map[string]interface{}{}}) != nil {
+		t.Error("executions without LLM calls have no cost")
+	}
+}
+
+func TestStepCostIncludesToolSteps(t *testing.T) {
+	c := pipeline_type.NewContext()
+	c.RecordTokenUsage("write", pipeline_type.TokenUsage{Model: "gpt-4o-mini", Requests: 1, PromptTokens: 1_000_000, CompletionTokens: 500_000})
+	c.RecordTokenUsage(pipeline_type.ToolStepID("write", "illustrate"), pipeline_type.TokenUsage{Model: "dall-e-3", Requests: 1})
+	c.RecordTokenUsage(pipeline_type.ToolStepID("write", "lookup"), pipeline_type.TokenUsage{Model: "my-local-model", Requests: 1})
+	c.RecordTokenUsage("writer", pipeline_type.TokenUsage{Model: "dall-e-3", Requests: 1})
+
+	stepResult := map[string]interface{}{}
+	addTokenUsage(c, pipeline_type.PipelineStep{ID: "write"}, stepResult)
+	if cost := stepResult[CostResultKey].(StepCost); cost.Amount != 0.49 || cost.Model != "gpt-4o-mini" {
+		t.Errorf("expected the step and its image tool to cost 0.49, got %+v", cost)
+	}
+	if tools := stepResult[ToolTokenUsageResultKey].(map[string]pipeline_type.TokenUsage); len(tools) != 2 {
+		t.Errorf("expected the usage of the two tools, got %v", tools)
+	}
+	cost := executionCost(map[string]interface{}{"uuid-write": stepResult})
+	if cost.Total != 0.49 || !reflect.DeepEqual(cost.UnpricedModels, []string{"my-local-model"}) {
+		t.Errorf("unexpected execution cost %+v", cost)
+	}
+}
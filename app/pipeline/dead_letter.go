@@ -0,0 +1,144 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+// DeadLetterDir is where executions that exhausted their retries are kept
+// until they are re-driven or purged.
+var DeadLetterDir = filepath.Join("storage", "pipeline", "dead_letters")
+
+// DeadLetter is a failed execution with everything needed to inspect and
+// re-drive it.
+type DeadLetter struct {
+	ExecutionID        string                 `json:"execution_id"`
+	PipelineID         string                 `json:"pipeline_id"`
+	PipelineLabel      string                 `json:"pipeline_label,omitempty"`
+	DefinitionHash     string                 `json:"definition_hash,omitempty"`
+	ErrorMessage       string                 `json:"error_message"`
+	Diagnosis          *Diagnosis             `json:"diagnosis,omitempty"`
+	ExecutionFailures  int                    `json:"execution_failures"`
+	FailedAt           string                 `json:"failed_at"`
+	UserInput          string                 `json:"user_input,omitempty"`
+	StepOutputs        map[string]interface{} `json:"step_outputs,omitempty"`
+	Results            map[string]interface{} `json:"results,omitempty"`
+	RedrivenAt         string                 `json:"redriven_at,omitempty"`
+	RedriveExecutionID string                 `json:"redrive_execution_id,omitempty"`
+}
+
+// NewDeadLetter captures a failed execution of p.
+func NewDeadLetter(executionID string, p *pipeline_type.Pipeline, executionErr error) *DeadLetter {
+	dl := &DeadLetter{
+		ExecutionID:       executionID,
+		PipelineID:        p.ID,
+		PipelineLabel:     p.Label,
+		DefinitionHash:    p.DefinitionHash(),
+		ExecutionFailures: p.ExecutionFailures + 1,
+		FailedAt:          time.Now().UTC().Format(time.RFC3339),
+	}
+	if executionErr != nil {
+		dl.ErrorMessage = executionErr.Error()
+	}
+	if p.Context != nil {
+		dl.UserInput = p.Context.GetUserInput()
+		dl.StepOutputs = p.Context.StepOutputsCopy()
+	}
+
+	ExecutionStore.RLock()
+	if execResult, ok := ExecutionStore.Executions[executionID]; ok {
+		dl.Results = execResult.Results
+		dl.Diagnosis, _ = execResult.Results[DiagnosisResultKey].(*Diagnosis)
+	}
+	ExecutionStore.RUnlock()
+
+	return dl
+}
+
+func deadLetterPath(executionID string) string {
+	return filepath.Join(DeadLetterDir, filepath.Base(executionID)+".json")
+}
+
+// SaveDeadLetter writes a dead letter to the store.
+func SaveDeadLetter(dl *DeadLetter) error {
+	if err := os.MkdirAll(DeadLetterDir, 0755); err != nil {
+		return fmt.Errorf("failed to create dead letter directory: %w", err)
+	}
+	data, err := json.MarshalIndent(dl, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling dead letter: %w", err)
+	}
+	if err := os.WriteFile(deadLetterPath(dl.ExecutionID), data, 0644); err != nil {
+		return fmt.Errorf("failed to write dead letter: %w", err)
+	}
+	return nil
+}
+
+// LoadDeadLetter reads the dead letter of an execution. The error satisfies
+// os.IsNotExist when there is none.
+func LoadDeadLetter(executionID string) (*DeadLetter, error) {
+	data, err := os.ReadFile(deadLetterPath(executionID))
+	if err != nil {
+		return nil, err
+	}
+	var dl DeadLetter
+	if err := json.Unmarshal(data, &dl); err != nil {
+		return nil, fmt.Errorf("error decoding dead letter: %w", err)
+	}
+	return &dl, nil
+}
+
+// ListDeadLetters returns the dead letters, most recent failure first,
+// optionally restricted to one pipeline.
+func ListDeadLetters(pipelineID string) ([]*DeadLetter, error) {
+	entries, err := os.ReadDir(DeadLetterDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read dead letter directory: %w", err)
+	}
+
+	var deadLetters []*DeadLetter
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		dl, err := LoadDeadLetter(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			continue
+		}
+		if pipelineID == "" || dl.PipelineID == pipelineID {
+			deadLetters = append(deadLetters, dl)
+		}
+	}
+	sort.Slice(deadLetters, func(i, j int) bool { return deadLetters[i].FailedAt > deadLetters[j].FailedAt })
+	return deadLetters, nil
+}
+
+// RemoveDeadLetter deletes a dead letter.
+func RemoveDeadLetter(executionID string) error {
+	return os.Remove(deadLetterPath(executionID))
+}
+
+// CompletedStepOverrides returns overrides reusing the output of the steps
+// that completed before the failure, so a re-drive resumes at the failed step.
+func (dl *DeadLetter) CompletedStepOverrides(steps []pipeline_type.PipelineStep) (map[string]pipeline_type.StepOverride, error) {
+	var completed []string
+	for _, s := range steps {
+		if stepResult, ok := dl.Results[s.UUID].(map[string]interface{}); ok {
+			if status, _ := stepResult["status"].(string); status == "completed" {
+				completed = append(completed, s.ID)
+			}
+		}
+	}
+	previous := &ExecutionResult{ExecutionID: dl.ExecutionID, Results: dl.Results}
+	return BuildRerunOverrides(previous, steps, completed, nil)
+}
@@ -0,0 +1,53 @@
+package pipeline
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+func TestDeadLetterResumeOverrides(t *testing.T) {
+	originalDir := DeadLetterDir
+	DeadLetterDir = t.TempDir()
+	defer func() { DeadLetterDir = originalDir }()
+
+	p := &pipeline_type.Pipeline{
+		ID: "pipeline-dl",
+		Steps: []pipeline_type.PipelineStep{
+			{ID: "search", UUID: "uuid-search", StepOutputKey: "results"},
+			{ID: "write", UUID: "uuid-write", StepOutputKey: "article"},
+		},
+		Context: pipeline_type.NewContext(),
+	}
+	AddExecution("exec-dl", &ExecutionResult{
+		ExecutionID: "exec-dl",
+		Results: map[string]interface{}{
+			"uuid-search": map[string]interface{}{"status": "completed", "data": "search results"},
+			"uuid-write":  map[string]interface{}{"status": "failed", "error_message": "timeout"},
+		},
+	})
+
+	defer func() {
+		ExecutionStore.Lock()
+		delete(ExecutionStore.Executions, "exec-dl")
+		ExecutionStore.Unlock()
+	}()
+
+	if err := SaveDeadLetter(NewDeadLetter("exec-dl", p, errors.New("timeout"))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	list, err := ListDeadLetters("pipeline-dl")
+	if err != nil || len(list) != 1 {
+		t.Fatalf("expected one dead letter, got %d (%v)", len(list), err)
+	}
+
+	overrides, err := list[0].CompletedStepOverrides(p.Steps)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(overrides) != 1 || overrides["search"].Output != "search results" {
+		t.Errorf("expected only the completed search step to be reused, got %v", overrides)
+	}
+}
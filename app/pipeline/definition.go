@@ -0,0 +1,110 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+// DefinitionDir is where the pipeline definition each execution ran is kept,
+// so results stay interpretable after the pipeline is edited in Drupal.
+var DefinitionDir = filepath.Join("storage", "pipeline", "definitions")
+
+// ExecutionDefinition is the resolved pipeline definition of an execution,
+// with secrets redacted.
+type ExecutionDefinition struct {
+	ExecutionID    string                 `json:"execution_id"`
+	PipelineID     string                 `json:"pipeline_id"`
+	Label          string                 `json:"label,omitempty"`
+	DefinitionHash string                 `json:"definition_hash"`
+	Definition     map[string]interface{} `json:"definition"`
+	CreatedAt      string                 `json:"created_at"`
+}
+
+// definitionFields are the parts of a pipeline that make up its definition,
+// runtime state such as the schedule or the context is left out.
+type definitionFields struct {
+	Steps          []pipeline_type.PipelineStep       `json:"steps"`
+	BeforeSteps    []pipeline_type.PipelineStep       `json:"before_steps,omitempty"`
+	AfterSteps     []pipeline_type.PipelineStep       `json:"after_steps,omitempty"`
+	ContentFilter  *pipeline_type.ContentFilterConfig `json:"content_filter,omitempty"`
+	Quota          *pipeline_type.ExecutionQuota      `json:"execution_quota,omitempty"`
+	SLA            *pipeline_type.SLAConfig           `json:"sla,omitempty"`
+	PostRunHooks   []pipeline_type.PostRunHook        `json:"post_run_hooks,omitempty"`
+	Locales        []string                           `json:"locales,omitempty"`
+	ResultWebhooks []pipeline_type.ResultWebhook      `json:"result_webhooks,omitempty"`
+}
+
+func definitionPath(executionID string) string {
+	return filepath.Join(DefinitionDir, filepath.Base(executionID)+".json")
+}
+
+// NewExecutionDefinition captures the definition of p for an execution.
+func NewExecutionDefinition(executionID string, p *pipeline_type.Pipeline) (*ExecutionDefinition, error) {
+	data, err := json.Marshal(definitionFields{
+		Steps:          p.Steps,
+		BeforeSteps:    p.BeforeSteps,
+		AfterSteps:     p.AfterSteps,
+		ContentFilter:  p.ContentFilter,
+		Quota:          p.Quota,
+		SLA:            p.SLA,
+		PostRunHooks:   p.PostRunHooks,
+		Locales:        p.Locales,
+		ResultWebhooks: p.ResultWebhooks,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling pipeline definition: %w", err)
+	}
+	var definition map[string]interface{}
+	if err := json.Unmarshal(data, &definition); err != nil {
+		return nil, fmt.Errorf("error decoding pipeline definition: %w", err)
+	}
+	return &ExecutionDefinition{
+		ExecutionID:    executionID,
+		PipelineID:     p.ID,
+		Label:          p.Label,
+		DefinitionHash: p.DefinitionHash(),
+		Definition:     redactMap(definition),
+		CreatedAt:      time.Now().UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// SaveExecutionDefinition writes the redacted definition of p for an
+// execution. It is kept after the execution results expire.
+func SaveExecutionDefinition(executionID string, p *pipeline_type.Pipeline) error {
+	definition, err := NewExecutionDefinition(executionID, p)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(DefinitionDir, 0755); err != nil {
+		return fmt.Errorf("failed to create definition directory: %w", err)
+	}
+	data, err := json.MarshalIndent(definition, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling execution definition: %w", err)
+	}
+	if err := os.WriteFile(definitionPath(executionID), data, 0644); err != nil {
+		return fmt.Errorf("failed to write execution definition: %w", err)
+	}
+	return nil
+}
+
+// LoadExecutionDefinition reads the definition an execution ran.
+func LoadExecutionDefinition(executionID string) (*ExecutionDefinition, error) {
+	data, err := os.ReadFile(definitionPath(executionID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no definition for execution %s", executionID)
+		}
+		return nil, fmt.Errorf("failed to read execution definition: %w", err)
+	}
+	var definition ExecutionDefinition
+	if err := json.Unmarshal(data, &definition); err != nil {
+		return nil, fmt.Errorf("error decoding execution definition: %w", err)
+	}
+	return &definition, nil
+}
@@ -0,0 +1,55 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+func TestExecutionDefinitionRedactsSecrets(t *testing.T) {
+	p := &pipeline_type.Pipeline{
+		ID:    "pipeline-def",
+		Label: "Daily digest",
+		Steps: []pipeline_type.PipelineStep{
+			{ID: "write", UUID: "uuid-write", Type: "llm_step", Prompt: "Summarize the news",
+				LLMServiceConfig: map[string]interface{}{"model_name": "gpt-4o", "api_key": "sk-secret"}},
+			{ID: "post", UUID: "uuid-post", Type: "action_step", ActionDetails: &pipeline_type.ActionDetails{
+				ActionService: "post_tweet",
+				Configuration: map[string]interface{}{"access_token": "secret", "hashtags": "#news"},
+			}},
+		},
+		Context: pipeline_type.NewContext(),
+	}
+
+	if err := SaveExecutionDefinition("exec-def", p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Editing the pipeline afterwards does not change what the execution ran
+	p.Steps[0].Prompt = "Summarize the sports news"
+
+	definition, err := LoadExecutionDefinition("exec-def")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if definition.PipelineID != "pipeline-def" || definition.DefinitionHash == "" {
+		t.Errorf("unexpected definition header: %+v", definition)
+	}
+
+	steps := definition.Definition["steps"].([]interface{})
+	write := steps[0].(map[string]interface{})
+	if write["prompt"] != "Summarize the news" {
+		t.Errorf("expected the prompt the execution ran, got %v", write["prompt"])
+	}
+	llmService := write["llm_service"].(map[string]interface{})
+	if llmService["api_key"] != RedactedValue || llmService["model_name"] != "gpt-4o" {
+		t.Errorf("expected only the API key redacted, got %v", llmService)
+	}
+	configuration := steps[1].(map[string]interface{})["action_details"].(map[string]interface{})["configuration"].(map[string]interface{})
+	if configuration["access_token"] != RedactedValue || configuration["hashtags"] != "#news" {
+		t.Errorf("expected only the access token redacted, got %v", configuration)
+	}
+
+	if _, err := LoadExecutionDefinition("exec-unknown"); err == nil {
+		t.Error("expected an error for an unknown execution")
+	}
+}
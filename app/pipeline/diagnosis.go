@@ -0,0 +1,223 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/rate_limiter"
+)
+
+// DiagnosisResultKey is the key of the diagnosis of a failed execution in its
+// results and in the execution result sent to Drupal.
+const DiagnosisResultKey = "diagnosis"
+
+// maxProviderResponse bounds the provider response quoted in a diagnosis.
+const maxProviderResponse = 500
+
+// Error classes of a diagnosis.
+const (
+	ErrorClassTokenExpired    = "token_expired"
+	ErrorClassAuthentication  = "authentication"
+	ErrorClassRateLimited     = "rate_limited"
+	ErrorClassProviderQuota   = "provider_quota"
+	ErrorClassTimeout         = "timeout"
+	ErrorClassNetwork         = "network"
+	ErrorClassProviderError   = "provider_error"
+	ErrorClassContentRejected = "content_rejected"
+	ErrorClassMissingInput    = "missing_input"
+	ErrorClassConfiguration   = "configuration"
+	ErrorClassQuotaExceeded   = "quota_exceeded"
+	ErrorClassInvalidPipeline = "invalid_pipeline"
+	ErrorClassUnknown         = "unknown"
+)
+
+// Diagnosis summarizes why an execution failed and what to do about it, for
+// operators reading the execution record or the failure notification.
+type Diagnosis struct {
+	StepID           string `json:"step_id,omitempty"`
+	StepUUID         string `json:"step_uuid,omitempty"`
+	StepDescription  string `json:"step_description,omitempty"`
+	StepType         string `json:"step_type,omitempty"`
+	Provider         string `json:"provider,omitempty"`
+	ErrorClass       string `json:"error_class"`
+	ErrorMessage     string `json:"error_message"`
+	ProviderResponse string `json:"provider_response,omitempty"`
+	Remediation      string `json:"remediation"`
+}
+
+// providerResponder is implemented by errors carrying the raw response of the
+// provider that failed.
+type providerResponder interface {
+	ProviderResponse() string
+}
+
+// errorPatterns classify errors from their message, first match wins.
+var errorPatterns = []struct {
+	class   string
+	pattern *regexp.Regexp
+}{
+	{ErrorClassTokenExpired, regexp.MustCompile(`(?i)(token|session)[^.]*(has )?expired|expired[^.]*token|code: 190\b`)},
+	{ErrorClassRateLimited, regexp.MustCompile(`(?i)rate.?limit|too many requests|\b429\b`)},
+	{ErrorClassProviderQuota, regexp.MustCompile(`(?i)insufficient_quota|quota|billing|credit balance`)},
+	{ErrorClassAuthentication, regexp.MustCompile(`(?i)unauthori[sz]ed|forbidden|invalid.{0,20}(api.?key|token|credentials)|authentication|\b40[13]\b`)},
+	{ErrorClassContentRejected, regexp.MustCompile(`(?i)content filter|content_policy|safety|moderation`)},
+	{ErrorClassTimeout, regexp.MustCompile(`(?i)timeout|timed out|deadline exceeded`)},
+	{ErrorClassNetwork, regexp.MustCompile(`(?i)connection refused|no such host|connection reset|eof\b|network is unreachable`)},
+	{ErrorClassProviderError, regexp.MustCompile(`(?i)\b5\d\d\b|internal server error|bad gateway|service unavailable|overloaded|circuit breaker open`)},
+	{ErrorClassConfiguration, regexp.MustCompile(`(?i)not found in (config|llm_service)|not initialized|not configured|missing .*config|unknown step type`)},
+}
+
+// providerNames are the display names of the rate limit providers.
+var providerNames = map[string]string{
+	"twitter":    "Twitter",
+	"facebook":   "Facebook",
+	"linkedin":   "LinkedIn",
+	"twilio":     "Twilio",
+	"openai":     "OpenAI",
+	"anthropic":  "Anthropic",
+	"gemini":     "Gemini",
+	"groq":       "Groq",
+	"openrouter": "OpenRouter",
+	"elevenlabs": "ElevenLabs",
+}
+
+// classifyError returns the error class of err.
+func classifyError(err error) string {
+	switch {
+	case errors.Is(err, ErrQuotaExceeded):
+		return ErrorClassQuotaExceeded
+	case errors.Is(err, pipeline_type.ErrStepOutputNotFound):
+		return ErrorClassMissingInput
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassTimeout
+	}
+	message := err.Error()
+	for _, p := range errorPatterns {
+		if p.pattern.MatchString(message) {
+			return p.class
+		}
+	}
+	return ErrorClassUnknown
+}
+
+// remediation suggests a fix for an error class.
+func remediation(class, provider string) string {
+	if provider == "" {
+		provider = "the provider"
+	}
+	switch class {
+	case ErrorClassTokenExpired:
+		return fmt.Sprintf("Rotate the %s access token, it has expired", provider)
+	case ErrorClassAuthentication:
+		return fmt.Sprintf("Check the %s credentials configured for the step, they were rejected", provider)
+	case ErrorClassRateLimited:
+		return fmt.Sprintf("%s rate limited the call, lower the RATE_LIMITS of the provider or space out the schedule", provider)
+	case ErrorClassProviderQuota:
+		return fmt.Sprintf("The %s account ran out of quota or credit, check its plan and billing", provider)
+	case ErrorClassTimeout:
+		return "The call timed out, retry the execution or raise the step timeout"
+	case ErrorClassNetwork:
+		return fmt.Sprintf("%s could not be reached, check the network and the API URL", provider)
+	case ErrorClassProviderError:
+		return fmt.Sprintf("%s failed on its side, retry the execution later", provider)
+	case ErrorClassContentRejected:
+		return "The content was rejected by a filter, review the prompt or the content filter lists"
+	case ErrorClassMissingInput:
+		return "A required output was missing, check the required steps and the user input"
+	case ErrorClassConfiguration:
+		return "The step configuration is incomplete, check it in Drupal"
+	case ErrorClassQuotaExceeded:
+		return "The pipeline budget is spent, raise its quota or wait for the next period"
+	case ErrorClassInvalidPipeline:
+		return "The pipeline definition is invalid, fix the step dependencies in Drupal"
+	}
+	return "Check the execution logs of the failing step"
+}
+
+// stepProvider returns the display name of the provider a step calls.
+func stepProvider(step pipeline_type.PipelineStep) string {
+	service, _ := step.LLMServiceConfig["service_name"].(string)
+	if service == "" && step.ActionDetails != nil {
+		service = step.ActionDetails.ActionService
+	}
+	if service == "" {
+		return ""
+	}
+	provider := rate_limiter.Provider(service)
+	if name, ok := providerNames[provider]; ok {
+		return name
+	}
+	return provider
+}
+
+// providerResponse returns what the provider answered, the raw response when
+// the error carries it, its innermost message otherwise.
+func providerResponse(err error) string {
+	var responder providerResponder
+	response := ""
+	if errors.As(err, &responder) {
+		response = responder.ProviderResponse()
+	} else {
+		inner := err
+		for next := errors.Unwrap(inner); next != nil; next = errors.Unwrap(inner) {
+			inner = next
+		}
+		if inner == err {
+			return ""
+		}
+		response = inner.Error()
+	}
+	response = strings.TrimSpace(response)
+	if len(response) > maxProviderResponse {
+		response = response[:maxProviderResponse] + "..."
+	}
+	return response
+}
+
+// Diagnose explains a failed execution from its results. The failing step is
+// the failed step result with the lowest sequence.
+func Diagnose(p *pipeline_type.Pipeline, results map[string]interface{}, executionErr error) *Diagnosis {
+	if executionErr == nil {
+		return nil
+	}
+	d := &Diagnosis{ErrorMessage: executionErr.Error(), ErrorClass: classifyError(executionErr)}
+
+	if _, ok := results["pipeline_validation"]; ok {
+		d.ErrorClass = ErrorClassInvalidPipeline
+	}
+
+	steps := make(map[string]pipeline_type.PipelineStep)
+	for _, list := range [][]pipeline_type.PipelineStep{p.Steps, p.BeforeSteps, p.AfterSteps} {
+		for _, s := range list {
+			steps[s.UUID] = s
+		}
+	}
+	var failed []pipeline_type.PipelineStep
+	for uuid, result := range results {
+		stepResult, ok := result.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if status, _ := stepResult["status"].(string); status != "failed" {
+			continue
+		}
+		if s, ok := steps[uuid]; ok {
+			failed = append(failed, s)
+		}
+	}
+	if len(failed) > 0 {
+		sort.Slice(failed, func(i, j int) bool { return failed[i].Weight < failed[j].Weight })
+		s := failed[0]
+		d.StepID, d.StepUUID, d.StepDescription, d.StepType = s.ID, s.UUID, s.StepDescription, s.Type
+		d.Provider = stepProvider(s)
+	}
+
+	d.ProviderResponse = providerResponse(executionErr)
+	d.Remediation = remediation(d.ErrorClass, d.Provider)
+	return d
+}
@@ -0,0 +1,60 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+func TestDiagnoseExpiredFacebookToken(t *testing.T) {
+	p := &pipeline_type.Pipeline{
+		ID: "p1",
+		Steps: []pipeline_type.PipelineStep{
+			{ID: "write", UUID: "u1", Type: "llm_step", Weight: 1},
+			{ID: "share", UUID: "u2", Type: "action_step", Weight: 2, ActionDetails: &pipeline_type.ActionDetails{ActionService: "facebook_share"}},
+		},
+	}
+	providerErr := errors.New("facebook API error: Error validating access token: Session has expired on Friday (Type: OAuthException, Code: 190)")
+	err := fmt.Errorf("error executing action service for step share: %w", providerErr)
+	results := map[string]interface{}{
+		"u1": map[string]interface{}{"status": "completed"},
+		"u2": map[string]interface{}{"status": "failed", "error_message": err.Error()},
+	}
+
+	d := Diagnose(p, results, err)
+	if d.StepID != "share" || d.Provider != "Facebook" || d.ErrorClass != ErrorClassTokenExpired {
+		t.Errorf("unexpected diagnosis %+v", d)
+	}
+	if d.ProviderResponse != providerErr.Error() {
+		t.Errorf("expected the provider message, got %q", d.ProviderResponse)
+	}
+	if !strings.Contains(d.Remediation, "Rotate the Facebook access token") {
+		t.Errorf("unexpected remediation %q", d.Remediation)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("step: %w", ErrQuotaExceeded), ErrorClassQuotaExceeded},
+		{fmt.Errorf("required step output 'x' not found in context: %w", pipeline_type.ErrStepOutputNotFound), ErrorClassMissingInput},
+		{errors.New("OpenAI API error (HTTP 429): Rate limit reached"), ErrorClassRateLimited},
+		{errors.New("OpenAI API error (HTTP 401): Incorrect API key provided"), ErrorClassAuthentication},
+		{errors.New("dial tcp: lookup api.example.com: no such host"), ErrorClassNetwork},
+		{errors.New("twitter API error (status 503)"), ErrorClassProviderError},
+		{errors.New("something odd"), ErrorClassUnknown},
+	}
+	for _, tt := range tests {
+		if got := classifyError(tt.err); got != tt.want {
+			t.Errorf("classifyError(%q) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+	if Diagnose(&pipeline_type.Pipeline{}, nil, nil) != nil {
+		t.Error("successful executions have no diagnosis")
+	}
+}
@@ -0,0 +1,188 @@
+package pipeline
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/pricing"
+)
+
+const (
+	// defaultMaxOutputTokens is assumed for LLM steps without max_tokens
+	defaultMaxOutputTokens = 4096
+	// unknownOutputTokens is assumed for the outputs the estimate can't size,
+	// e.g. search results or fetched articles
+	unknownOutputTokens = 1000
+)
+
+// Durations assumed for steps that never ran, in seconds.
+var defaultStepDurations = map[string][2]int64{
+	"llm_step": {2, 60},
+}
+
+var defaultStepDuration = [2]int64{0, 10}
+
+// EstimateRequest describes a prospective run.
+type EstimateRequest struct {
+	UserInput string `json:"user_input"`
+	// Outputs are known values of step outputs, e.g. a trigger payload
+	Outputs map[string]string `json:"outputs,omitempty"`
+}
+
+// StepEstimate is the estimate of one step.
+type StepEstimate struct {
+	StepID          string  `json:"step_id"`
+	StepType        string  `json:"step_type"`
+	Service         string  `json:"service,omitempty"`
+	Model           string  `json:"model,omitempty"`
+	InputTokens     int     `json:"input_tokens,omitempty"`
+	OutputTokensMin int     `json:"output_tokens_min,omitempty"`
+	OutputTokensMax int     `json:"output_tokens_max,omitempty"`
+	CostMin         float64 `json:"cost_min"`
+	CostMax         float64 `json:"cost_max"`
+	DurationMin     int64   `json:"duration_min"`
+	DurationMax     int64   `json:"duration_max"`
+	// DurationSamples is the number of past runs the duration is based on
+	DurationSamples int `json:"duration_samples"`
+}
+
+// Estimate is the expected cost and duration range of a run. Durations are
+// in seconds.
+type Estimate struct {
+	PipelineID  string         `json:"pipeline_id"`
+	Currency    string         `json:"currency"`
+	CostMin     float64        `json:"cost_min"`
+	CostMax     float64        `json:"cost_max"`
+	DurationMin int64          `json:"duration_min"`
+	DurationMax int64          `json:"duration_max"`
+	Steps       []StepEstimate `json:"steps"`
+	Warnings    []string       `json:"warnings,omitempty"`
+}
+
+// tokenRange is the size of an output, in tokens.
+type tokenRange struct{ min, max int }
+
+// EstimateExecution estimates what a run of the pipeline would cost and how
+// long it would take. LLM costs come from the prompt sizes, the max_tokens of
+// the steps and the price table, durations from the recent runs of each
+// step. Outputs of previous steps included in a prompt are sized with the
+// estimate of these steps.
+func EstimateExecution(p *pipeline_type.Pipeline, req EstimateRequest) (*Estimate, error) {
+	outputs := map[string]tokenRange{}
+	available := map[string]interface{}{}
+	userInput := pricing.ApproxTokens(req.UserInput)
+	outputs["user_input"] = tokenRange{userInput, userInput}
+	available["user_input"] = req.UserInput
+	for key, value := range req.Outputs {
+		n := pricing.ApproxTokens(value)
+		outputs[key] = tokenRange{n, n}
+		available[key] = value
+	}
+	steps, err := OrderSteps(p.Steps, available)
+	if err != nil {
+		return nil, err
+	}
+
+	estimate := &Estimate{PipelineID: p.ID, Currency: pricing.Currency, Steps: []StepEstimate{}}
+	for _, step := range steps {
+		stepEstimate := StepEstimate{StepID: step.ID, StepType: step.Type}
+		size := tokenRange{unknownOutputTokens, unknownOutputTokens}
+
+		if step.Type == "llm_step" {
+			service, _ := step.LLMServiceConfig["service_name"].(string)
+			model, _ := step.LLMServiceConfig["model_name"].(string)
+			stepEstimate.Service, stepEstimate.Model = service, model
+
+			inputMin, inputMax, missing := promptTokens(step, outputs)
+			for _, key := range missing {
+				estimate.Warnings = append(estimate.Warnings, fmt.Sprintf("Step %s: size of output %q unknown, assuming %d tokens", step.ID, key, unknownOutputTokens))
+			}
+			maxOutput := maxOutputTokens(step.LLMServiceConfig)
+			size = tokenRange{min(maxOutput, maxOutput/8+1), maxOutput}
+			stepEstimate.InputTokens = inputMax
+			stepEstimate.OutputTokensMin, stepEstimate.OutputTokensMax = size.min, size.max
+
+			if price, ok := pricing.Lookup(model); ok {
+				stepEstimate.CostMin = roundCost(price.Cost(inputMin, size.min))
+				stepEstimate.CostMax = roundCost(price.Cost(inputMax, size.max))
+			} else {
+				estimate.Warnings = append(estimate.Warnings, fmt.Sprintf("Step %s: no price for model %q, cost not included", step.ID, model))
+			}
+		}
+		if step.StepOutputKey != "" {
+			outputs[step.StepOutputKey] = size
+		}
+
+		shortest, longest, samples := StepDurations.Range(p.ID, step.ID)
+		if samples == 0 {
+			defaults, ok := defaultStepDurations[step.Type]
+			if !ok {
+				defaults = defaultStepDuration
+			}
+			shortest, longest = defaults[0], defaults[1]
+		}
+		stepEstimate.DurationMin, stepEstimate.DurationMax, stepEstimate.DurationSamples = shortest, longest, samples
+
+		estimate.CostMin += stepEstimate.CostMin
+		estimate.CostMax += stepEstimate.CostMax
+		estimate.DurationMin += shortest
+		estimate.DurationMax += longest
+		estimate.Steps = append(estimate.Steps, stepEstimate)
+	}
+
+	estimate.CostMin = roundCost(estimate.CostMin)
+	estimate.CostMax = roundCost(estimate.CostMax)
+	return estimate, nil
+}
+
+// promptTokens sizes the prompt of an LLM step once its placeholders are
+// replaced, and returns the placeholders of outputs it knows nothing about.
+func promptTokens(step pipeline_type.PipelineStep, outputs map[string]tokenRange) (int, int, []string) {
+	prompt := step.Prompt
+	var inputMin, inputMax int
+	var missing []string
+	for _, key := range step.RequiredStepKeys() {
+		placeholder := "{" + key + "}"
+		count := strings.Count(prompt, placeholder)
+		if count == 0 {
+			continue
+		}
+		prompt = strings.ReplaceAll(prompt, placeholder, "")
+		size, ok := outputs[key]
+		if !ok {
+			size = tokenRange{unknownOutputTokens, unknownOutputTokens}
+			missing = append(missing, key)
+		}
+		inputMin += count * size.min
+		inputMax += count * size.max
+	}
+	base := pricing.ApproxTokens(prompt)
+	return base + inputMin, base + inputMax, missing
+}
+
+// maxOutputTokens reads the max_tokens parameter of an LLM step.
+func maxOutputTokens(config map[string]interface{}) int {
+	parameters, _ := config["parameters"].(map[string]interface{})
+	switch v := parameters["max_tokens"].(type) {
+	case float64:
+		if v > 0 {
+			return int(v)
+		}
+	case int:
+		if v > 0 {
+			return v
+		}
+	case string:
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultMaxOutputTokens
+}
+
+func roundCost(cost float64) float64 {
+	return math.Round(cost*1e6) / 1e6
+}
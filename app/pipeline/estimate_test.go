@@ -0,0 +1,63 @@
+package pipeline
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+func TestEstimateExecution(t *testing.T) {
+	saved := StepDurations
+	StepDurations = NewStepDurationStore(filepath.Join(t.TempDir(), "durations.json"))
+	defer func() { StepDurations = saved }()
+	StepDurations.Record("p1", "outline", 4)
+	StepDurations.Record("p1", "outline", 9)
+
+	p := &pipeline_type.Pipeline{
+		ID: "p1",
+		Steps: []pipeline_type.PipelineStep{
+			{
+				ID: "outline", Type: "llm_step", StepOutputKey: "outline", RequiredSteps: "user_input",
+				Prompt: "Outline an article about {user_input}",
+				LLMServiceConfig: map[string]interface{}{
+					"service_name": "openai", "model_name": "gpt-4o",
+					"parameters": map[string]interface{}{"max_tokens": float64(800)},
+				},
+			},
+			{
+				ID: "article", Type: "llm_step", StepOutputKey: "article", RequiredSteps: "outline",
+				Prompt:           "Write the article: {outline}",
+				LLMServiceConfig: map[string]interface{}{"service_name": "custom", "model_name": "in-house"},
+			},
+		},
+	}
+
+	estimate, err := EstimateExecution(p, EstimateRequest{UserInput: "Go generics"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(estimate.Steps) != 2 {
+		t.Fatalf("expected 2 steps, got %d", len(estimate.Steps))
+	}
+
+	outline := estimate.Steps[0]
+	if outline.OutputTokensMax != 800 || outline.CostMax <= outline.CostMin || outline.CostMin <= 0 {
+		t.Errorf("unexpected outline estimate %+v", outline)
+	}
+	if outline.DurationMin != 4 || outline.DurationMax != 9 || outline.DurationSamples != 2 {
+		t.Errorf("duration should come from history, got %+v", outline)
+	}
+
+	// The article prompt includes the outline, sized by its estimate
+	article := estimate.Steps[1]
+	if article.InputTokens < 800 {
+		t.Errorf("article input should include the outline, got %d tokens", article.InputTokens)
+	}
+	if article.CostMax != 0 || len(estimate.Warnings) != 1 {
+		t.Errorf("unpriced model should be reported, got %+v %v", article, estimate.Warnings)
+	}
+	if estimate.CostMax != outline.CostMax || estimate.DurationMax != 9+60 {
+		t.Errorf("unexpected totals %+v", estimate)
+	}
+}
@@ -0,0 +1,196 @@
+package pipeline
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/serisow/lesocle/api"
+	"github.com/serisow/lesocle/logging"
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+// EventType identifies a point in the lifecycle of an execution.
+type EventType string
+
+const (
+	EventExecutionStarted   EventType = "execution.started"
+	EventExecutionCompleted EventType = "execution.completed"
+	EventExecutionFailed    EventType = "execution.failed"
+	EventStepStarted        EventType = "step.started"
+	EventStepCompleted      EventType = "step.completed"
+	EventStepFailed         EventType = "step.failed"
+	// Published while a step runs, such as render percent or LLM tokens
+	EventStepProgress EventType = "step.progress"
+)
+
+// Event is published on the event bus by the executor. Step fields are empty
+// for execution events.
+type Event struct {
+	Type        EventType
+	PipelineID  string
+	ExecutionID string
+	StepID      string
+	StepType    string
+	Error       error
+	// Result is the step result for step events and the results of all steps
+	// for execution events. Subscribers must not modify it.
+	Result map[string]interface{}
+	// Progress is set for step.progress events
+	Progress *logging.Progress
+	Time     time.Time
+}
+
+func stepEvent(eventType EventType, pipelineID, executionID string, pipelineStep pipeline_type.PipelineStep, result map[string]interface{}, err error) Event {
+	return Event{
+		Type:        eventType,
+		PipelineID:  pipelineID,
+		ExecutionID: executionID,
+		StepID:      pipelineStep.ID,
+		StepType:    pipelineStep.Type,
+		Error:       err,
+		Result:      result,
+	}
+}
+
+// The steps and services report progress through the logging package, as
+// they can't import the executor.
+func init() {
+	logging.SetProgressHandler(func(progress logging.Progress) {
+		Events.Publish(Event{
+			Type:        EventStepProgress,
+			PipelineID:  executionPipelineID(progress.ExecutionID),
+			ExecutionID: progress.ExecutionID,
+			StepID:      progress.StepID,
+			Progress:    &progress,
+		})
+	})
+}
+
+// executionPipelineID returns the pipeline of an execution of the store.
+func executionPipelineID(executionID string) string {
+	ExecutionStore.RLock()
+	defer ExecutionStore.RUnlock()
+	if execResult, ok := ExecutionStore.Executions[executionID]; ok {
+		return execResult.PipelineID
+	}
+	return ""
+}
+
+// EventHandler receives events. It runs on the executor goroutine, so
+// anything slow should be handed off.
+type EventHandler func(Event)
+
+type subscription struct {
+	id      int
+	types   map[EventType]bool
+	handler EventHandler
+}
+
+// EventBus is an in-process pub/sub letting metrics, notifications or sync
+// components follow executions without the executor calling each of them.
+type EventBus struct {
+	sync.RWMutex
+	nextID        int
+	subscriptions []subscription
+}
+
+// Events is the bus the executor publishes to.
+var Events = NewEventBus()
+
+// NewEventBus creates an empty event bus.
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Subscribe registers handler for the given event types, or for every event
+// when none is given. It returns a function that removes the subscription.
+func (b *EventBus) Subscribe(handler EventHandler, types ...EventType) func() {
+	sub := subscription{handler: handler}
+	if len(types) > 0 {
+		sub.types = make(map[EventType]bool, len(types))
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+
+	b.Lock()
+	b.nextID++
+	sub.id = b.nextID
+	b.subscriptions = append(b.subscriptions, sub)
+	b.Unlock()
+
+	return func() {
+		b.Lock()
+		defer b.Unlock()
+		for i, s := range b.subscriptions {
+			if s.id == sub.id {
+				b.subscriptions = append(b.subscriptions[:i:i], b.subscriptions[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Publish delivers an event to its subscribers, in subscription order. A
+// panicking subscriber is logged and doesn't affect the execution.
+func (b *EventBus) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.RLock()
+	subscriptions := b.subscriptions
+	b.RUnlock()
+
+	for _, sub := range subscriptions {
+		if sub.types != nil && !sub.types[event.Type] {
+			continue
+		}
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("Event handler panicked on %s for execution %s: %v", event.Type, event.ExecutionID, r)
+				}
+			}()
+			sub.handler(event)
+		}()
+	}
+}
+
+// Message returns the event as streamed to the API clients.
+func (e Event) Message() api.ExecutionEvent {
+	message := api.ExecutionEvent{
+		Type:        string(e.Type),
+		PipelineID:  e.PipelineID,
+		ExecutionID: e.ExecutionID,
+		StepID:      e.StepID,
+		StepType:    e.StepType,
+		Time:        e.Time.Unix(),
+	}
+	if e.Error != nil {
+		message.Error = e.Error.Error()
+	}
+	if e.Progress != nil {
+		message.Percent = e.Progress.Percent
+		message.Tokens = e.Progress.Tokens
+		message.Message = e.Progress.Message
+	}
+	return message
+}
+
+// StatusEvent returns the current status of an execution as the first
+// message of the event streams, and whether the execution is finished.
+func StatusEvent(executionID string) (api.ExecutionEvent, bool) {
+	ExecutionStore.RLock()
+	defer ExecutionStore.RUnlock()
+	message := api.ExecutionEvent{Type: "status", ExecutionID: executionID, Time: time.Now().Unix()}
+	execution, ok := ExecutionStore.Executions[executionID]
+	if !ok {
+		return message, true
+	}
+	message.PipelineID = execution.PipelineID
+	message.Status = string(execution.Status)
+	message.Error = execution.ErrorMessage
+	return message, execution.Status != StatusStarted
+}
@@ -0,0 +1,44 @@
+package pipeline
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventBusFiltersAndUnsubscribes(t *testing.T) {
+	bus := NewEventBus()
+
+	var all, failures []EventType
+	bus.Subscribe(func(e Event) { panic("broken subscriber") })
+	unsubscribe := bus.Subscribe(func(e Event) { all = append(all, e.Type) })
+	bus.Subscribe(func(e Event) { failures = append(failures, e.Type) }, EventStepFailed, EventExecutionFailed)
+
+	bus.Publish(Event{Type: EventStepStarted})
+	bus.Publish(Event{Type: EventStepFailed})
+	unsubscribe()
+	bus.Publish(Event{Type: EventExecutionFailed})
+
+	if len(all) != 2 || all[0] != EventStepStarted || all[1] != EventStepFailed {
+		t.Errorf("unexpected events for the catch-all subscriber: %v", all)
+	}
+	if len(failures) != 2 || failures[0] != EventStepFailed || failures[1] != EventExecutionFailed {
+		t.Errorf("unexpected events for the failure subscriber: %v", failures)
+	}
+}
+
+func TestEventsFeedMetrics(t *testing.T) {
+	started := time.Now()
+	recordMetrics(Event{Type: EventStepStarted, ExecutionID: "exec-metrics", StepID: "render", StepType: "metrics_step", Time: started})
+	recordMetrics(Event{Type: EventStepFailed, ExecutionID: "exec-metrics", StepID: "render", StepType: "metrics_step", Time: started.Add(2 * time.Second)})
+	recordMetrics(Event{Type: EventExecutionFailed, PipelineID: "pipeline-metrics", ExecutionID: "exec-metrics"})
+
+	if got := stepDurationSeconds.Count("metrics_step", "failed"); got != 1 {
+		t.Errorf("expected 1 failed step observed, got %d", got)
+	}
+	if got := executionsTotal.Value("pipeline-metrics", "failed"); got != 1 {
+		t.Errorf("expected 1 failed execution counted, got %v", got)
+	}
+	if _, ok := stepStarts.byExecution["exec-metrics"]; ok {
+		t.Error("expected the step starts of the execution forgotten")
+	}
+}
@@ -1,9 +1,16 @@
 package pipeline
 
 import (
+	"errors"
 	"log"
+	"os"
 	"sync"
 	"time"
+
+	"github.com/serisow/lesocle/api"
+	"github.com/serisow/lesocle/environment"
+	"github.com/serisow/lesocle/logging"
+	"github.com/serisow/lesocle/pipeline_type"
 )
 
 type ExecutionStatus string
@@ -15,16 +22,21 @@ const (
 )
 
 type ExecutionResult struct {
-    PipelineID    string                 `json:"pipeline_id"`
-    ExecutionID   string                 `json:"execution_id"`
-    Status        ExecutionStatus        `json:"status"`
-    StartTime     int64                  `json:"start_time"`
-    EndTime       int64                  `json:"end_time,omitempty"`
-    Results       map[string]interface{} `json:"results,omitempty"`
-    ErrorMessage  string                 `json:"error_message,omitempty"`
-    UserInput     string                 `json:"user_input,omitempty"`
-    SubmittedAt   string                 `json:"submitted_at"`
-    CompletedAt   string                 `json:"completed_at,omitempty"`
+    PipelineID     string                   `json:"pipeline_id"`
+    ExecutionID    string                   `json:"execution_id"`
+    DefinitionHash string                   `json:"definition_hash,omitempty"`
+    Environment    *environment.Fingerprint `json:"environment,omitempty"`
+    Status         ExecutionStatus          `json:"status"`
+    StartTime      int64                    `json:"start_time"`
+    EndTime        int64                    `json:"end_time,omitempty"`
+    Results        map[string]interface{}   `json:"results,omitempty"`
+    ErrorMessage   string                   `json:"error_message,omitempty"`
+    UserInput      string                   `json:"user_input,omitempty"`
+    SubmittedAt    string                   `json:"submitted_at"`
+    CompletedAt    string                   `json:"completed_at,omitempty"`
+    Sandbox        bool                     `json:"sandbox,omitempty"`
+    RequestID      string                   `json:"request_id,omitempty"`
+    Cost           *api.ExecutionCost       `json:"cost,omitempty"`
 }
 
 // StartExecutionStoreCleanup starts a goroutine that periodically cleans up old execution results.
@@ -67,17 +79,58 @@ func StopExecutionStoreCleanup() {
 
 func performCleanup(threshold time.Duration) {
     now := timeProvider.Now()
-    ExecutionStore.Lock()
-    defer ExecutionStore.Unlock()
 
+    ExecutionStore.RLock()
+    expired := make(map[string]*ExecutionResult)
     for execID, execResult := range ExecutionStore.Executions {
         if execResult.CompletedAt != "" {
             completedAt, err := time.Parse(time.RFC3339, execResult.CompletedAt)
             if err == nil && now.Sub(completedAt) > threshold {
-                delete(ExecutionStore.Executions, execID)
-                log.Printf("Deleted execution result %s due to expiration", execID)
+                expired[execID] = execResult
+            }
+        }
+    }
+    ExecutionStore.RUnlock()
+
+    // Completed results no longer change, archive them without holding the
+    // lock so uploads don't block running executions
+    archiver := ExecutionArchiver
+    for execID, execResult := range expired {
+        if archiver != nil {
+            if err := archiver.Archive(execResult); err != nil {
+                // Keep it for the next cleanup rather than losing it
+                log.Printf("Error archiving execution result %s: %v", execID, err)
+                continue
             }
         }
+
+        ExecutionStore.Lock()
+        delete(ExecutionStore.Executions, execID)
+        ExecutionStore.Unlock()
+        logging.ExecutionLogs.Remove(execID)
+        RemoveContextSnapshot(execID)
+        removeSpilledOutputs(execResult)
+        log.Printf("Deleted execution result %s due to expiration", execID)
+    }
+}
+
+// removeSpilledOutputs deletes the files of the step outputs an execution
+// spilled to disk, only its results and snapshot refer to them.
+func removeSpilledOutputs(result *ExecutionResult) {
+    for _, value := range result.Results {
+        stepResult, ok := value.(map[string]interface{})
+        if !ok {
+            continue
+        }
+        spilled, ok := stepResult["data"].(pipeline_type.SpilledOutput)
+        if !ok {
+            if spilled, ok = pipeline_type.SpilledOutputFromMap(stepResult["data"]); !ok {
+                continue
+            }
+        }
+        if err := os.Remove(spilled.Path()); err != nil && !errors.Is(err, os.ErrNotExist) {
+            log.Printf("Error deleting spilled output %s of execution %s: %v", spilled.Filename, result.ExecutionID, err)
+        }
     }
 }
 
@@ -2,10 +2,14 @@ package pipeline
 
 import (
 	"math/rand"
+	"os"
+	"path/filepath"
 	"fmt"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
 )
 
 type mockTimeProvider struct {
@@ -89,3 +93,86 @@ func addRandomExecution(now time.Time) {
     }
     AddExecution(id, result)
 }
+
+type failingArchiver struct{}
+
+func (failingArchiver) Archive(result *ExecutionResult) error {
+    return fmt.Errorf("archive unavailable")
+}
+
+func TestCleanupArchivesExpiredExecutions(t *testing.T) {
+    now := time.Now()
+    mtp := &mockTimeProvider{currentTime: now}
+    timeProvider = mtp
+    defer func() { timeProvider = &realTimeProvider{} }()
+    defer func() { ExecutionArchiver = nil }()
+
+    completedAt := now.Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+    AddExecution("archived-exec", &ExecutionResult{ExecutionID: "archived-exec", Status: StatusCompleted, CompletedAt: completedAt})
+
+    // A failing archive keeps the result for the next cleanup
+    ExecutionArchiver = failingArchiver{}
+    performCleanup(time.Hour)
+    if _, ok := GetExecution("archived-exec"); !ok {
+        t.Fatal("Execution should be kept when archiving fails")
+    }
+
+    dir := t.TempDir()
+    ExecutionArchiver = &FileArchiver{Dir: dir}
+    performCleanup(time.Hour)
+    if _, ok := GetExecution("archived-exec"); ok {
+        t.Error("Expired execution should have been deleted")
+    }
+
+    day := now.Add(-2 * time.Hour).UTC().Format("2006-01-02")
+    if _, err := os.Stat(filepath.Join(dir, day, "archived-exec.json")); err != nil {
+        t.Errorf("Expected archived execution file: %v", err)
+    }
+}
+
+func TestCleanupDeletesSpilledOutputs(t *testing.T) {
+    now := time.Now()
+    mtp := &mockTimeProvider{currentTime: now}
+    timeProvider = mtp
+    defer func() { timeProvider = &realTimeProvider{} }()
+    previousDir := pipeline_type.SpillDir
+    pipeline_type.SpillDir = t.TempDir()
+    defer func() { pipeline_type.SpillDir = previousDir }()
+
+    expired := pipeline_type.SpilledOutput{Spilled: true, Filename: "1_expired.txt"}
+    // Archived results come back as decoded JSON
+    archived := pipeline_type.SpilledOutput{Spilled: true, Filename: "2_archived.txt"}
+    kept := pipeline_type.SpilledOutput{Spilled: true, Filename: "3_kept.txt"}
+    for _, output := range []pipeline_type.SpilledOutput{expired, archived, kept} {
+        if err := os.WriteFile(output.Path(), []byte("large output"), 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    old := now.Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+    AddExecution("spilled-exec", &ExecutionResult{ExecutionID: "spilled-exec", Status: StatusCompleted, CompletedAt: old,
+        Results: map[string]interface{}{
+            "uuid-1": map[string]interface{}{"data": expired},
+            "uuid-2": map[string]interface{}{"data": map[string]interface{}{"spilled": true, "filename": archived.Filename}},
+            "uuid-3": map[string]interface{}{"data": "inline"},
+        }})
+    recent := now.Add(-time.Minute).UTC().Format(time.RFC3339)
+    AddExecution("recent-exec", &ExecutionResult{ExecutionID: "recent-exec", Status: StatusCompleted, CompletedAt: recent,
+        Results: map[string]interface{}{"uuid-1": map[string]interface{}{"data": kept}}})
+    defer func() {
+        ExecutionStore.Lock()
+        delete(ExecutionStore.Executions, "recent-exec")
+        ExecutionStore.Unlock()
+    }()
+
+    performCleanup(time.Hour)
+
+    for _, output := range []pipeline_type.SpilledOutput{expired, archived} {
+        if _, err := os.Stat(output.Path()); !os.IsNotExist(err) {
+            t.Errorf("expected %s deleted with its execution, got %v", output.Filename, err)
+        }
+    }
+    if _, err := os.Stat(kept.Path()); err != nil {
+        t.Errorf("expected the output of a retained execution kept: %v", err)
+    }
+}
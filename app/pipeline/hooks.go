@@ -0,0 +1,78 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/serisow/lesocle/logging"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/plugin_registry"
+)
+
+const (
+	HookBefore = "before"
+	HookAfter  = "after"
+)
+
+// runHooks runs the before or after steps of a pipeline in order, adding their
+// results to results. Before hooks stop at the first failure. After hooks
+// behave like defer: they all run whatever happened before, and a failure
+// doesn't stop the next ones.
+func runHooks(ctx context.Context, executionID string, p *pipeline_type.Pipeline, hook string, steps []pipeline_type.PipelineStep, registry *plugin_registry.PluginRegistry, results map[string]interface{}) error {
+	var firstErr error
+	for _, hookStep := range steps {
+		stepStartTime := time.Now().Unix()
+		logExecution(executionID, hookStep.ID, "INFO", fmt.Sprintf("%s hook started: %s (%s)", hook, hookStep.StepDescription, hookStep.Type))
+		Events.Publish(stepEvent(EventStepStarted, p.ID, executionID, hookStep, nil, nil))
+
+		err := runHookStep(logging.WithExecutionLog(ctx, executionID, hookStep.ID), p, hookStep, registry)
+
+		output, _ := p.Context.GetRawStepOutput(hookStep.StepOutputKey)
+		stepResult := map[string]interface{}{
+			"step_uuid":        hookStep.UUID,
+			"step_description": hookStep.StepDescription,
+			"status":           "completed",
+			"start_time":       stepStartTime,
+			"end_time":         time.Now().Unix(),
+			"step_type":        hookStep.Type,
+			"sequence":         hookStep.Weight,
+			"data":             output,
+			"output_type":      hookStep.OutputType,
+			"error_message":    "",
+			"hook":             hook,
+		}
+		if err != nil {
+			stepResult["status"] = "failed"
+			stepResult["error_message"] = err.Error()
+			stepResult["data"] = fmt.Sprintf("Error: %v", err)
+		}
+		results[hookStep.UUID] = stepResult
+
+		if err != nil {
+			logExecution(executionID, hookStep.ID, "ERROR", fmt.Sprintf("%s hook failed: %v", hook, err))
+			Events.Publish(stepEvent(EventStepFailed, p.ID, executionID, hookStep, stepResult, err))
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s hook %s failed: %w", hook, hookStep.ID, err)
+			}
+			if hook == HookBefore {
+				break
+			}
+			continue
+		}
+		logExecution(executionID, hookStep.ID, "INFO", fmt.Sprintf("%s hook completed", hook))
+		Events.Publish(stepEvent(EventStepCompleted, p.ID, executionID, hookStep, stepResult, nil))
+	}
+	return firstErr
+}
+
+func runHookStep(ctx context.Context, p *pipeline_type.Pipeline, hookStep pipeline_type.PipelineStep, registry *plugin_registry.PluginRegistry) error {
+	instance, err := registry.GetStepInstance(hookStep.Type)
+	if err != nil {
+		return fmt.Errorf("unknown step type: %s", hookStep.Type)
+	}
+	if err := configureStep(instance, hookStep, registry); err != nil {
+		return err
+	}
+	return instance.Execute(ctx, p.Context)
+}
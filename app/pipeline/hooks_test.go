@@ -0,0 +1,69 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/serisow/lesocle/llm_step"
+	"github.com/serisow/lesocle/pipeline/step"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/plugin_registry"
+)
+
+type hookTestLLM struct {
+	prompts []string
+}
+
+func (m *hookTestLLM) CallLLM(ctx context.Context, config map[string]interface{}, prompt string) (string, error) {
+	m.prompts = append(m.prompts, prompt)
+	if strings.Contains(prompt, "fail") {
+		return "", errors.New("llm failure")
+	}
+	return "ok: " + prompt, nil
+}
+
+func TestAfterHooksRunWhenStepsFail(t *testing.T) {
+	originalSend := SendExecutionResultsFunc
+	defer func() { SendExecutionResultsFunc = originalSend }()
+	var sent map[string]interface{}
+	SendExecutionResultsFunc = func(pipelineID string, results map[string]interface{}, startTime, endTime int64) error {
+		sent = results
+		return nil
+	}
+
+	llm := &hookTestLLM{}
+	registry := plugin_registry.NewPluginRegistry()
+	registry.RegisterLLMService("hook_llm", llm)
+	registry.RegisterStepType("llm_step", func() step.Step { return &llm_step.LLMStepImpl{} })
+
+	llmStep := func(id, prompt string) pipeline_type.PipelineStep {
+		return pipeline_type.PipelineStep{
+			ID: id, UUID: id + "-uuid", Type: "llm_step", Prompt: prompt, StepOutputKey: id,
+			LLMServiceConfig: map[string]interface{}{"service_name": "hook_llm"},
+		}
+	}
+	p := &pipeline_type.Pipeline{
+		ID:          "hooks",
+		BeforeSteps: []pipeline_type.PipelineStep{llmStep("acquire", "acquire lock")},
+		Steps:       []pipeline_type.PipelineStep{llmStep("main", "fail please")},
+		AfterSteps:  []pipeline_type.PipelineStep{llmStep("cleanup", "release lock")},
+		Context:     pipeline_type.NewContext(),
+	}
+
+	if err := ExecutePipeline("exec-hooks", p, registry); err == nil || !strings.Contains(err.Error(), "llm failure") {
+		t.Fatalf("expected the main step error, got %v", err)
+	}
+
+	if strings.Join(llm.prompts, ",") != "acquire lock,fail please,release lock" {
+		t.Errorf("unexpected call order: %v", llm.prompts)
+	}
+	if status, _ := p.Context.Get("pipeline_status"); status != "failed" {
+		t.Errorf("expected after hooks to see the failed status, got %v", status)
+	}
+	cleanup, ok := sent["cleanup-uuid"].(map[string]interface{})
+	if !ok || cleanup["hook"] != HookAfter || cleanup["status"] != "completed" {
+		t.Errorf("expected a completed after hook result, got %v", sent["cleanup-uuid"])
+	}
+}
@@ -0,0 +1,38 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/plugin_registry"
+)
+
+// InlinePipelinePrefix starts the ID given to inline pipelines posted without
+// one, so they can't be mistaken for a Drupal pipeline.
+const InlinePipelinePrefix = "inline-"
+
+// ValidateInline checks a pipeline definition posted to the API can run: it
+// has steps, every step type is registered and the steps' requirements are
+// met by other steps or by availableOutputs. Drupal validates the pipelines
+// it sends, inline ones only reach this service.
+func ValidateInline(p *pipeline_type.Pipeline, registry *plugin_registry.PluginRegistry, availableOutputs map[string]interface{}) error {
+	if len(p.Steps) == 0 {
+		return errors.New("pipeline validation failed: no steps")
+	}
+	for _, group := range [][]pipeline_type.PipelineStep{p.BeforeSteps, p.Steps, p.AfterSteps} {
+		for _, s := range group {
+			if s.ID == "" {
+				return errors.New("pipeline validation failed: a step has no id")
+			}
+			if _, err := registry.GetStepInstance(s.Type); err != nil {
+				return fmt.Errorf("pipeline validation failed: step %s: %w", s.ID, err)
+			}
+			if err := validateTools(s, registry); err != nil {
+				return fmt.Errorf("pipeline validation failed: %w", err)
+			}
+		}
+	}
+	_, err := OrderSteps(p.Steps, availableOutputs)
+	return err
+}
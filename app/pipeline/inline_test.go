@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/serisow/lesocle/action_step"
+	"github.com/serisow/lesocle/pipeline/step"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/plugin_registry"
+	"github.com/serisow/lesocle/services/action_service"
+)
+
+func TestValidateInline(t *testing.T) {
+	registry := plugin_registry.NewPluginRegistry()
+	registry.RegisterStepType("action_step", func() step.Step { return &action_step.ActionStepImpl{} })
+
+	tests := []struct {
+		name  string
+		steps []pipeline_type.PipelineStep
+		want  string
+	}{
+		{"no steps", nil, "no steps"},
+		{"unknown type", []pipeline_type.PipelineStep{{ID: "a", Type: "nope"}}, "unknown step type: nope"},
+		{"missing requirement", []pipeline_type.PipelineStep{{ID: "a", Type: "action_step", RequiredSteps: "missing"}}, "missing"},
+		{"user input available", []pipeline_type.PipelineStep{{ID: "a", Type: "action_step", RequiredSteps: "user_input"}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateInline(&pipeline_type.Pipeline{Steps: tt.steps}, registry, map[string]interface{}{"user_input": ""})
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestInlineResultsAreNotSentToDrupal(t *testing.T) {
+	sent := false
+	originalSend := SendExecutionResultsFunc
+	defer func() { SendExecutionResultsFunc = originalSend }()
+	SendExecutionResultsFunc = func(pipelineID string, results map[string]interface{}, startTime, endTime int64) error {
+		sent = true
+		return nil
+	}
+
+	registry := plugin_registry.NewPluginRegistry()
+	registry.RegisterActionService("echo", &action_service.MockActionService{
+		Response: func(ctx context.Context, actionConfig string, c *pipeline_type.Context, s *pipeline_type.PipelineStep) string {
+			return "done"
+		},
+	})
+	registry.RegisterStepType("action_step", func() step.Step { return &action_step.ActionStepImpl{} })
+
+	p := &pipeline_type.Pipeline{
+		ID:     InlinePipelinePrefix + "test",
+		Inline: true,
+		Steps: []pipeline_type.PipelineStep{
+			{ID: "echo", UUID: "uuid-echo", Type: "action_step", StepOutputKey: "echoed",
+				ActionDetails: &pipeline_type.ActionDetails{ActionService: "echo", ExecutionLocation: "go"}},
+		},
+	}
+	if err := ExecutePipeline("exec-inline", p, registry); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sent {
+		t.Error("expected the inline results kept off Drupal")
+	}
+	execution, _ := GetExecution("exec-inline")
+	if execution.Status != StatusCompleted {
+		t.Errorf("expected the execution completed, got %+v", execution)
+	}
+}
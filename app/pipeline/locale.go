@@ -0,0 +1,92 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/plugin_registry"
+)
+
+// applyLocales exposes the default locale of a localized pipeline, so steps
+// requiring the locale output can be ordered and run once per locale.
+func applyLocales(p *pipeline_type.Pipeline) {
+	if len(p.Locales) > 0 {
+		p.Context.SetStepOutput(pipeline_type.LocaleOutputKey, p.Locales[0])
+	}
+}
+
+// addLocaleVariants reports the variants of a per-locale step output in its
+// result, by locale.
+func addLocaleVariants(p *pipeline_type.Pipeline, pipelineStep pipeline_type.PipelineStep, stepResult map[string]interface{}) {
+	if !pipelineStep.PerLocale || pipelineStep.StepOutputKey == "" {
+		return
+	}
+	variants := make(map[string]interface{})
+	for _, locale := range p.Locales {
+		if output, ok := p.Context.GetRawStepOutput(pipeline_type.LocalizedKey(pipelineStep.StepOutputKey, locale)); ok {
+			variants[locale] = output
+		}
+	}
+	if len(variants) > 0 {
+		stepResult["locale_variants"] = variants
+	}
+}
+
+// runLocalized runs a per-locale step once for each target locale of the
+// pipeline, each run on a fork of the context where the locale output is set
+// and the required outputs are their variant for the locale, if any. Action
+// steps use the locale_accounts entry of their configuration for the locale.
+// The token usage of the runs adds up on the context.
+//
+// The variant for each locale is stored as "<output>@<locale>", the output
+// itself is the variant of the default locale for steps that don't localize.
+func runLocalized(ctx context.Context, p *pipeline_type.Pipeline, pipelineStep pipeline_type.PipelineStep, registry *plugin_registry.PluginRegistry) error {
+	variants := make(map[string]interface{}, len(p.Locales))
+	for _, locale := range p.Locales {
+		fork := p.Context.Fork()
+		fork.SetStepOutput(pipeline_type.LocaleOutputKey, locale)
+		for _, key := range pipelineStep.RequiredStepKeys() {
+			if variant, ok := p.Context.GetRawStepOutput(pipeline_type.LocalizedKey(key, locale)); ok {
+				fork.SetStepOutput(key, variant)
+			}
+		}
+
+		localized := pipelineStep
+		if details := pipelineStep.ActionDetails; details != nil {
+			localizedDetails := *details
+			localizedDetails.Configuration = pipeline_type.LocalizedConfiguration(details.Configuration, locale)
+			localized.ActionDetails = &localizedDetails
+		}
+
+		instance, err := registry.GetStepInstance(pipelineStep.Type)
+		if err != nil {
+			return fmt.Errorf("unknown step type: %s", pipelineStep.Type)
+		}
+		if err := configureStep(instance, localized, registry); err != nil {
+			return err
+		}
+		err = instance.Execute(ctx, fork)
+		// The tokens spent are reported even when the run failed
+		p.Context.MergeTokenUsage(fork)
+		if err != nil {
+			return fmt.Errorf("locale %s: %w", locale, err)
+		}
+		p.Context.Annotate(pipelineStep.ID, fork.Annotations(pipelineStep.ID)...)
+
+		if pipelineStep.StepOutputKey == "" {
+			continue
+		}
+		if output, ok := fork.GetRawStepOutput(pipelineStep.StepOutputKey); ok {
+			variants[locale] = output
+			p.Context.SetStepOutput(pipeline_type.LocalizedKey(pipelineStep.StepOutputKey, locale), output)
+		}
+	}
+
+	if pipelineStep.StepOutputKey != "" {
+		if output, ok := variants[p.Locales[0]]; ok {
+			p.Context.SetStepOutput(pipelineStep.StepOutputKey, output)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/serisow/lesocle/action_step"
+	"github.com/serisow/lesocle/api"
+	"github.com/serisow/lesocle/llm_step"
+	"github.com/serisow/lesocle/pipeline/step"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/plugin_registry"
+	"github.com/serisow/lesocle/services/action_service"
+)
+
+func TestPerLocaleStepsRouteVariants(t *testing.T) {
+	originalSend := SendExecutionResultsFunc
+	defer func() { SendExecutionResultsFunc = originalSend }()
+	var sent map[string]interface{}
+	SendExecutionResultsFunc = func(pipelineID string, results map[string]interface{}, startTime, endTime int64) error {
+		sent = results
+		return nil
+	}
+
+	var published []string
+	publisher := &action_service.MockActionService{
+		Response: func(ctx context.Context, actionConfig string, c *pipeline_type.Context, s *pipeline_type.PipelineStep) string {
+			post, _ := c.GetString("post")
+			published = append(published, fmt.Sprintf("%v: %s", s.ActionDetails.Configuration["page_id"], post))
+			return "posted"
+		},
+	}
+	registry := plugin_registry.NewPluginRegistry()
+	registry.RegisterLLMService("hook_llm", &hookTestLLM{})
+	registry.RegisterActionService("publish", publisher)
+	registry.RegisterStepType("llm_step", func() step.Step { return &llm_step.LLMStepImpl{} })
+	registry.RegisterStepType("action_step", func() step.Step { return &action_step.ActionStepImpl{} })
+
+	p := &pipeline_type.Pipeline{
+		ID:      "localized",
+		Locales: []string{"en", "fr"},
+		Steps: []pipeline_type.PipelineStep{
+			{
+				ID: "post", UUID: "post-uuid", Type: "llm_step", StepOutputKey: "post", PerLocale: true,
+				RequiredSteps: "locale", Prompt: "post in {locale}",
+				LLMServiceConfig: map[string]interface{}{"service_name": "hook_llm"},
+			},
+			{
+				ID: "share", UUID: "share-uuid", Type: "action_step", StepOutputKey: "shared", PerLocale: true,
+				RequiredSteps: "post",
+				ActionDetails: &pipeline_type.ActionDetails{
+					ActionService: "publish", ExecutionLocation: "go",
+					Configuration: map[string]interface{}{
+						"page_id":         "global",
+						"locale_accounts": map[string]interface{}{"fr": map[string]interface{}{"page_id": "page-fr"}},
+					},
+				},
+			},
+		},
+		Context: pipeline_type.NewContext(),
+	}
+
+	if err := ExecutePipeline("exec-locales", p, registry); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(published)
+	if strings.Join(published, "|") != "global: ok: post in en|page-fr: ok: post in fr" {
+		t.Errorf("each variant should go to its locale page, got %v", published)
+	}
+	if post, _ := p.Context.GetString("post"); post != "ok: post in en" {
+		t.Errorf("output should be the default locale variant, got %q", post)
+	}
+	variants, _ := sent["post-uuid"].(map[string]interface{})["locale_variants"].(map[string]interface{})
+	if variants["fr"] != "ok: post in fr" {
+		t.Errorf("step result should list the variants, got %v", variants)
+	}
+}
+
+func TestPerLocaleLLMStepCost(t *testing.T) {
+	originalSend, originalQuotas := SendExecutionResultsFunc, Quotas
+	defer func() { SendExecutionResultsFunc, Quotas = originalSend, originalQuotas }()
+	var sent map[string]interface{}
+	SendExecutionResultsFunc = func(pipelineID string, results map[string]interface{}, startTime, endTime int64) error {
+		sent = results
+		return nil
+	}
+	// The cost is counted against the quota of the pipeline
+	Quotas = NewQuotaStore(filepath.Join(t.TempDir(), "quota_usage.json"))
+
+	registry := plugin_registry.NewPluginRegistry()
+	registry.RegisterLLMService("hook_llm", &hookTestLLM{})
+	registry.RegisterStepType("llm_step", func() step.Step { return &llm_step.LLMStepImpl{} })
+	p := &pipeline_type.Pipeline{
+		ID:      "localized-cost",
+		Locales: []string{"en", "fr", "wo"},
+		Steps: []pipeline_type.PipelineStep{{
+			ID: "post", UUID: "post-uuid", Type: "llm_step", StepOutputKey: "post", PerLocale: true,
+			RequiredSteps: "locale", Prompt: "post in {locale}",
+			LLMServiceConfig: map[string]interface{}{"service_name": "hook_llm", "model_name": "gpt-4o"},
+		}},
+		Context: pipeline_type.NewContext(),
+	}
+
+	if err := ExecutePipeline("exec-locale-cost", p, registry); err != nil {
+		t.Fatal(err)
+	}
+
+	stepResult := sent["post-uuid"].(map[string]interface{})
+	usage, _ := stepResult[TokenUsageResultKey].(pipeline_type.TokenUsage)
+	if usage.Requests != 3 {
+		t.Fatalf("expected the calls of the three locales, got %+v", usage)
+	}
+	want, _ := stepCost(usage)
+	if cost, _ := stepResult[CostResultKey].(StepCost); cost.Amount != want.Amount || cost.Amount == 0 {
+		t.Errorf("expected the step to cost %v, got %v", want.Amount, cost.Amount)
+	}
+	if cost, _ := sent[CostResultKey].(*api.ExecutionCost); cost == nil || cost.Total != want.Amount {
+		t.Errorf("expected the execution to cost %v, got %+v", want.Amount, cost)
+	}
+}
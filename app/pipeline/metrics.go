@@ -0,0 +1,62 @@
+package pipeline
+
+import (
+	"sync"
+	"time"
+
+	"github.com/serisow/lesocle/metrics"
+)
+
+var (
+	stepDurationSeconds = metrics.NewHistogram("lesocle_step_duration_seconds",
+		"Duration of the pipeline steps.", nil, "step_type", "status")
+	executionsTotal = metrics.NewCounter("lesocle_pipeline_executions_total",
+		"Finished pipeline executions.", "pipeline_id", "status")
+)
+
+// stepStarts holds the start of the running steps, per execution and step.
+var stepStarts = struct {
+	sync.Mutex
+	byExecution map[string]map[string]time.Time
+}{byExecution: make(map[string]map[string]time.Time)}
+
+// The executor events feed the metrics, so every way of running a pipeline
+// is counted.
+func init() {
+	Events.Subscribe(recordMetrics,
+		EventStepStarted, EventStepCompleted, EventStepFailed,
+		EventExecutionCompleted, EventExecutionFailed)
+}
+
+func recordMetrics(event Event) {
+	stepStarts.Lock()
+	defer stepStarts.Unlock()
+
+	switch event.Type {
+	case EventStepStarted:
+		if stepStarts.byExecution[event.ExecutionID] == nil {
+			stepStarts.byExecution[event.ExecutionID] = make(map[string]time.Time)
+		}
+		stepStarts.byExecution[event.ExecutionID][event.StepID] = event.Time
+	case EventStepCompleted, EventStepFailed:
+		started, ok := stepStarts.byExecution[event.ExecutionID][event.StepID]
+		if !ok {
+			return
+		}
+		delete(stepStarts.byExecution[event.ExecutionID], event.StepID)
+		if len(stepStarts.byExecution[event.ExecutionID]) == 0 {
+			delete(stepStarts.byExecution, event.ExecutionID)
+		}
+		status := "completed"
+		if event.Type == EventStepFailed {
+			status = "failed"
+		}
+		stepDurationSeconds.Observe(event.Time.Sub(started).Seconds(), event.StepType, status)
+	case EventExecutionCompleted:
+		delete(stepStarts.byExecution, event.ExecutionID)
+		executionsTotal.Inc(event.PipelineID, "completed")
+	case EventExecutionFailed:
+		delete(stepStarts.byExecution, event.ExecutionID)
+		executionsTotal.Inc(event.PipelineID, "failed")
+	}
+}
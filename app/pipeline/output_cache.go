@@ -0,0 +1,105 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+// OutputCache memoizes step outputs across executions. Steps opt in with a
+// cache TTL; runs of the same step configuration on the same inputs within
+// the TTL reuse the stored output instead of calling the provider again.
+type OutputCache struct {
+	sync.Mutex
+	entries map[string]cachedOutput
+	hits    int64
+	misses  int64
+}
+
+type cachedOutput struct {
+	output      interface{}
+	executionID string
+	expiresAt   time.Time
+}
+
+// OutputCacheStats reports the use of the output cache.
+type OutputCacheStats struct {
+	Entries int     `json:"entries"`
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+}
+
+// StepOutputCache is the output cache used by the executor.
+var StepOutputCache = NewOutputCache()
+
+func NewOutputCache() *OutputCache {
+	return &OutputCache{entries: make(map[string]cachedOutput)}
+}
+
+// CacheKey hashes the step type and configuration with the inputs the step
+// reads: the outputs of its required steps and the user input.
+func CacheKey(step pipeline_type.PipelineStep, c *pipeline_type.Context) string {
+	h := sha256.New()
+	h.Write([]byte(step.Type + "\x00" + step.ConfigHash() + "\x00" + c.GetUserInput()))
+	for _, key := range step.RequiredStepKeys() {
+		value, err := c.GetString(key)
+		if err != nil {
+			value = ""
+		}
+		h.Write([]byte("\x00" + key + "=" + value))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns the cached output for key and the execution that produced it,
+// counting a hit or a miss.
+func (oc *OutputCache) Get(key string, now time.Time) (interface{}, string, bool) {
+	oc.Lock()
+	defer oc.Unlock()
+	entry, ok := oc.entries[key]
+	if ok && now.After(entry.expiresAt) {
+		delete(oc.entries, key)
+		ok = false
+	}
+	if !ok {
+		oc.misses++
+		return nil, "", false
+	}
+	oc.hits++
+	return entry.output, entry.executionID, true
+}
+
+// Put stores an output for ttl.
+func (oc *OutputCache) Put(key string, output interface{}, executionID string, ttl time.Duration, now time.Time) {
+	oc.Lock()
+	defer oc.Unlock()
+	// Drop expired entries as we go so the cache doesn't grow unbounded
+	for k, entry := range oc.entries {
+		if now.After(entry.expiresAt) {
+			delete(oc.entries, k)
+		}
+	}
+	oc.entries[key] = cachedOutput{output: output, executionID: executionID, expiresAt: now.Add(ttl)}
+}
+
+// Purge removes every entry.
+func (oc *OutputCache) Purge() {
+	oc.Lock()
+	defer oc.Unlock()
+	oc.entries = make(map[string]cachedOutput)
+}
+
+// Stats returns the number of entries and the hit and miss counts.
+func (oc *OutputCache) Stats() OutputCacheStats {
+	oc.Lock()
+	defer oc.Unlock()
+	stats := OutputCacheStats{Entries: len(oc.entries), Hits: oc.hits, Misses: oc.misses}
+	if total := oc.hits + oc.misses; total > 0 {
+		stats.HitRate = float64(oc.hits) / float64(total)
+	}
+	return stats
+}
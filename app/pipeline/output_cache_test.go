@@ -0,0 +1,85 @@
+package pipeline
+
+import (
+	"testing"
+	"time"
+
+	"github.com/serisow/lesocle/llm_step"
+	"github.com/serisow/lesocle/pipeline/step"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/plugin_registry"
+)
+
+func TestOutputCacheExpiryAndStats(t *testing.T) {
+	oc := NewOutputCache()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	oc.Put("k", "result", "exec-1", time.Minute, now)
+	if output, execID, hit := oc.Get("k", now.Add(30*time.Second)); !hit || output != "result" || execID != "exec-1" {
+		t.Errorf("expected a hit, got %v %v %v", output, execID, hit)
+	}
+	if _, _, hit := oc.Get("k", now.Add(2*time.Minute)); hit {
+		t.Error("expected the entry to expire")
+	}
+
+	stats := oc.Stats()
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 0 || stats.HitRate != 0.5 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	search := pipeline_type.PipelineStep{ID: "search", UUID: "u1", Type: "google_search", SearchInput: "{topic}", RequiredSteps: "topic", CacheTTL: 60}
+	c := pipeline_type.NewContext()
+	c.SetStepOutput("topic", "golang")
+
+	moved := search
+	moved.ID, moved.UUID, moved.Weight, moved.StepOutputKey = "other", "u2", 3, "results"
+	if CacheKey(search, c) != CacheKey(moved, c) {
+		t.Error("the position of the step should not change its cache key")
+	}
+
+	other := pipeline_type.NewContext()
+	other.SetStepOutput("topic", "rust")
+	if CacheKey(search, c) == CacheKey(search, other) {
+		t.Error("different inputs should have different cache keys")
+	}
+}
+
+func TestExecutePipelineReusesCachedOutput(t *testing.T) {
+	originalSend := SendExecutionResultsFunc
+	defer func() { SendExecutionResultsFunc = originalSend }()
+	SendExecutionResultsFunc = func(pipelineID string, results map[string]interface{}, startTime, endTime int64) error { return nil }
+	defer StepOutputCache.Purge()
+
+	llm := &hookTestLLM{}
+	registry := plugin_registry.NewPluginRegistry()
+	registry.RegisterLLMService("cache_llm", llm)
+	registry.RegisterStepType("llm_step", func() step.Step { return &llm_step.LLMStepImpl{} })
+
+	newPipeline := func() *pipeline_type.Pipeline {
+		return &pipeline_type.Pipeline{
+			ID: "cached",
+			Steps: []pipeline_type.PipelineStep{{
+				ID: "speak", UUID: "speak-uuid", Type: "llm_step", Prompt: "same text", StepOutputKey: "speech",
+				LLMServiceConfig: map[string]interface{}{"service_name": "cache_llm"}, CacheTTL: 3600,
+			}},
+			Context: pipeline_type.NewContext(),
+		}
+	}
+
+	if err := ExecutePipeline("exec-cache-1", newPipeline(), registry); err != nil {
+		t.Fatalf("first execution failed: %v", err)
+	}
+	second := newPipeline()
+	if err := ExecutePipeline("exec-cache-2", second, registry); err != nil {
+		t.Fatalf("second execution failed: %v", err)
+	}
+
+	if len(llm.prompts) != 1 {
+		t.Errorf("expected the LLM to be called once, got %d calls", len(llm.prompts))
+	}
+	if output, _ := second.Context.GetStepOutput("speech"); output != "ok: same text" {
+		t.Errorf("expected the cached output, got %v", output)
+	}
+}
@@ -11,45 +11,203 @@ import (
 	"time"
 
 	"github.com/serisow/lesocle/action_step"
+	"github.com/serisow/lesocle/artifact"
 	"github.com/serisow/lesocle/config"
+	"github.com/serisow/lesocle/environment"
 	"github.com/serisow/lesocle/llm_step"
+	"github.com/serisow/lesocle/logging"
+	"github.com/serisow/lesocle/pipeline/step"
 	"github.com/serisow/lesocle/pipeline_type"
 	"github.com/serisow/lesocle/plugin_registry"
+	"github.com/serisow/lesocle/requestid"
 )
 
 
 
 var SendExecutionResultsFunc = SendExecutionResults
 
+// RequestIDResultKey holds the ID of the request that started an execution,
+// Drupal gets it in the results and the X-Request-ID header.
+const RequestIDResultKey = "request_id"
+
 func ExecutePipeline(executionID string, p *pipeline_type.Pipeline, registry *plugin_registry.PluginRegistry) error {
-    ctx := context.Background()
+    // The request that started the execution correlates its logs and calls,
+    // the execution ID otherwise
+    requestID := p.RequestID
+    if requestID == "" {
+        requestID = executionID
+    }
+    ctx, done := withCancel(requestid.WithID(logging.WithExecutionLog(context.Background(), executionID, ""), requestID), executionID)
+    defer done()
     if p.Context == nil {
         p.Context = pipeline_type.NewContext()
     }
     
     // Add all pipeline steps to the context so we can look them up by output type
     p.Context.SetSteps(p.Steps)
+    p.Context.ContentFilter = p.ContentFilter
+    applySandbox(p)
+
+    // Tells which version of the definition produced the artifacts when Drupal
+    // edits the pipeline between runs
+    definitionHash := p.DefinitionHash()
 
     ExecutionStore.Lock()
     execResult := &ExecutionResult{
-        PipelineID:  p.ID,
-        ExecutionID: executionID,
-        Status:      StatusStarted,
-        StartTime:   time.Now().Unix(),
-        SubmittedAt: time.Now().UTC().Format(time.RFC3339),
-        UserInput:   p.Context.GetUserInput(),
+        PipelineID:     p.ID,
+        ExecutionID:    executionID,
+        DefinitionHash: definitionHash,
+        Environment:    environmentFingerprint(registry),
+        Status:         StatusStarted,
+        StartTime:      time.Now().Unix(),
+        SubmittedAt:    time.Now().UTC().Format(time.RFC3339),
+        UserInput:      p.Context.GetUserInput(),
+        Sandbox:        p.Sandbox,
+        RequestID:      requestID,
     }
     ExecutionStore.Executions[executionID] = execResult
     ExecutionStore.Unlock()
+
+    if err := SaveExecutionDefinition(executionID, p); err != nil {
+        log.Printf("Error saving definition of execution %s: %v", executionID, err)
+    }
     var executionError error  // Add this line to track errors
 
+    logExecution(executionID, "", "INFO", fmt.Sprintf("Execution started for pipeline %s", p.ID))
+    Events.Publish(Event{Type: EventExecutionStarted, PipelineID: p.ID, ExecutionID: executionID})
+    defer logging.ExecutionLogs.Finish(executionID)
+
 
 
     results := make(map[string]interface{})
+    if p.Sandbox {
+        results[SandboxResultKey] = true
+        logExecution(executionID, "", "INFO", "Sandbox mode, actions are simulated")
+    }
+    if p.RequestID != "" {
+        results[RequestIDResultKey] = p.RequestID
+    }
+    var manifestEntries []artifact.ManifestEntry
     pipelineStartTime := time.Now().Unix()
 
-    for _, pipelineStep := range p.Steps {
+    // Files pushed ahead of the run by external systems
+    assets, err := PendingAssets(p.ID)
+    if err != nil {
+        logExecution(executionID, "", "WARN", fmt.Sprintf("Pending assets unavailable: %v", err))
+    }
+    applyAssets(p.Context, assets)
+    applyLocales(p)
+
+    // Run the steps in dependency order rather than the order Drupal sent them
+    orderedSteps, err := OrderSteps(p.Steps, p.Context.StepOutputsCopy())
+    if err == nil {
+        // Protect against runaway schedules, no step runs once the budget is spent
+        if quotaErr := Quotas.Reserve(p.ID, p.Quota, timeProvider.Now()); quotaErr != nil {
+            orderedSteps = nil
+            executionError = quotaErr
+            results["quota"] = map[string]interface{}{
+                "step_description": "Execution quota",
+                "status":           "failed",
+                "quota_exceeded":   true,
+                "start_time":       pipelineStartTime,
+                "end_time":         time.Now().Unix(),
+                "error_message":    quotaErr.Error(),
+            }
+            logExecution(executionID, "", "ERROR", quotaErr.Error())
+        }
+    } else {
+        executionError = err
+        results["pipeline_validation"] = map[string]interface{}{
+            "step_description": "Pipeline validation",
+            "status":           "failed",
+            "start_time":       pipelineStartTime,
+            "end_time":         time.Now().Unix(),
+            "error_message":    err.Error(),
+        }
+        logExecution(executionID, "", "ERROR", err.Error())
+    }
+
+    // Before hooks gate the steps, after hooks then run whatever the outcome
+    hooksStarted := orderedSteps != nil
+    if hooksStarted && len(p.BeforeSteps) > 0 {
+        if err := runHooks(ctx, executionID, p, HookBefore, p.BeforeSteps, registry, results); err != nil {
+            executionError = err
+            orderedSteps = nil
+        }
+    }
+
+    warnedAliases := make(map[string]bool)
+    for _, pipelineStep := range orderedSteps {
+        // Cancelled, e.g. by the watchdog
+        if ctx.Err() != nil {
+            executionError = context.Cause(ctx)
+            break
+        }
         stepStartTime := time.Now().Unix()
+        // Debugging reruns can provide the output of a step instead of running it
+        if override, ok := p.StepOverrides[pipelineStep.ID]; ok {
+            if pipelineStep.StepOutputKey != "" {
+                p.Context.SetStepOutput(pipelineStep.StepOutputKey, override.Output)
+            }
+            results[pipelineStep.UUID] = map[string]interface{}{
+                "step_uuid":        pipelineStep.UUID,
+                "step_description": pipelineStep.StepDescription,
+                "status":           "completed",
+                "start_time":       stepStartTime,
+                "end_time":         time.Now().Unix(),
+                "step_type":        pipelineStep.Type,
+                "sequence":         pipelineStep.Weight,
+                "data":             override.Output,
+                "output_type":      pipelineStep.OutputType,
+                "error_message":    "",
+                "override":         override.Source,
+            }
+            logExecution(executionID, pipelineStep.ID, "INFO", fmt.Sprintf("Step %s, output provided by rerun", override.Source))
+            Events.Publish(stepEvent(EventStepCompleted, p.ID, executionID, pipelineStep, results[pipelineStep.UUID].(map[string]interface{}), nil))
+            continue
+        }
+
+        logExecution(executionID, pipelineStep.ID, "INFO", fmt.Sprintf("Step started: %s (%s)", pipelineStep.StepDescription, pipelineStep.Type))
+        Events.Publish(stepEvent(EventStepStarted, p.ID, executionID, pipelineStep, nil, nil))
+
+        // Renamed step types keep working, warn once per execution
+        if newType, deprecated := registry.ResolveAlias(pipelineStep.Type); deprecated && !warnedAliases[pipelineStep.Type] {
+            warnedAliases[pipelineStep.Type] = true
+            message := fmt.Sprintf("Step type %s is deprecated, use %s instead", pipelineStep.Type, newType)
+            logExecution(executionID, pipelineStep.ID, "WARN", message)
+            log.Printf("Pipeline %s: %s", p.ID, message)
+        }
+
+        // A candidate configuration may be served to part of the executions
+        var variant string
+        pipelineStep, variant = Rollouts.Select(p.ID, executionID, pipelineStep)
+
+        // Opted-in steps reuse the output of an identical run of another execution
+        var cacheKey string
+        if pipelineStep.CacheTTL > 0 && pipelineStep.StepOutputKey != "" {
+            cacheKey = CacheKey(pipelineStep, p.Context)
+            if cached, sourceExecutionID, hit := StepOutputCache.Get(cacheKey, timeProvider.Now()); hit {
+                p.Context.SetStepOutput(pipelineStep.StepOutputKey, cached)
+                stepResult := map[string]interface{}{
+                    "step_uuid":        pipelineStep.UUID,
+                    "step_description": pipelineStep.StepDescription,
+                    "status":           "completed",
+                    "start_time":       stepStartTime,
+                    "end_time":         time.Now().Unix(),
+                    "step_type":        pipelineStep.Type,
+                    "sequence":         pipelineStep.Weight,
+                    "data":             cached,
+                    "output_type":      pipelineStep.OutputType,
+                    "error_message":    "",
+                    "definition_hash":  definitionHash,
+                    "cache":            map[string]interface{}{"hit": true, "execution_id": sourceExecutionID},
+                }
+                results[pipelineStep.UUID] = stepResult
+                logExecution(executionID, pipelineStep.ID, "INFO", fmt.Sprintf("Step output reused from execution %s", sourceExecutionID))
+                Events.Publish(stepEvent(EventStepCompleted, p.ID, executionID, pipelineStep, stepResult, nil))
+                continue
+            }
+        }
 
         // Get the step instance from the registry
         step, err := registry.GetStepInstance(pipelineStep.Type)
@@ -67,52 +225,39 @@ func ExecutePipeline(executionID string, p *pipeline_type.Pipeline, registry *pl
                 "error_message":   executionError.Error(),
             }
             results[pipelineStep.UUID] = stepResult
+            Events.Publish(stepEvent(EventStepFailed, p.ID, executionID, pipelineStep, stepResult, executionError))
             break
         }
 
-        // Set the PipelineStep field directly
-        switch s := step.(type) {
-        case *llm_step.LLMStepImpl:
-            s.PipelineStep = pipelineStep
-            // Additional setup for LLM service
-            serviceName, ok := pipelineStep.LLMServiceConfig["service_name"].(string)
-            if !ok {
-                return fmt.Errorf("service_name not found in llm_service configuration for step %s", pipelineStep.ID)
-            }
-            llmServiceInstance, ok := registry.GetLLMService(serviceName)
-            if !ok {
-                return fmt.Errorf("unknown LLM service: %s", serviceName)
-            }
-            s.LLMServiceInstance = llmServiceInstance
-        case *action_step.ActionStepImpl:
-            s.PipelineStep = pipelineStep
-            if pipelineStep.ActionDetails == nil {
-                // Backward compatibility: treat as Drupal-side action
-                s.PipelineStep.ActionDetails = &pipeline_type.ActionDetails{
-                    ActionService: pipelineStep.ActionConfig,
-                    ExecutionLocation: "drupal",
-                    Configuration: map[string]interface{}{},
-                }
-            } else if pipelineStep.ActionDetails.ExecutionLocation == "go" {
-                // Only validate and set action service for Go-side actions
-                actionServiceName := pipelineStep.ActionDetails.ActionService
-                actionServiceInstance, ok := registry.GetActionService(actionServiceName)
-                if !ok {
-                    return fmt.Errorf("unknown Go-side Action service: %s", actionServiceName)
-                }
-                s.ActionServiceInstance = actionServiceInstance
-            }
-        default:
-            // Attempt to set the PipelineStep field directly
-            if err := setPipelineStepField(step, pipelineStep); err != nil {
-                return fmt.Errorf("cannot set PipelineStep for step type %s: %v", pipelineStep.Type, err)
+        // A misconfigured step, e.g. with tools that can't run, fails the
+        // execution like any step and is reported as such
+        if err := configureStep(step, pipelineStep, registry); err != nil {
+            executionError = err
+            stepResult := map[string]interface{}{
+                "step_uuid":        pipelineStep.UUID,
+                "step_description": pipelineStep.StepDescription,
+                "status":           "failed",
+                "start_time":       stepStartTime,
+                "end_time":         time.Now().Unix(),
+                "step_type":        pipelineStep.Type,
+                "sequence":         pipelineStep.Weight,
+                "error_message":    err.Error(),
             }
+            results[pipelineStep.UUID] = stepResult
+            logExecution(executionID, pipelineStep.ID, "ERROR", fmt.Sprintf("Step configuration failed: %v", err))
+            Events.Publish(stepEvent(EventStepFailed, p.ID, executionID, pipelineStep, stepResult, err))
+            break
         }
 
-		err = step.Execute(ctx, p.Context)
+		if pipelineStep.PerLocale && len(p.Locales) > 0 {
+			err = runLocalized(logging.WithExecutionLog(ctx, executionID, pipelineStep.ID), p, pipelineStep, registry)
+		} else {
+			err = step.Execute(logging.WithExecutionLog(ctx, executionID, pipelineStep.ID), p.Context)
+		}
 		stepEndTime := time.Now().Unix()
 
-		output, _ := p.Context.GetStepOutput(pipelineStep.StepOutputKey)
+		// Spilled outputs are reported by reference rather than inline
+		output, _ := p.Context.GetRawStepOutput(pipelineStep.StepOutputKey)
 		stepResult := map[string]interface{}{
 			"step_uuid":        pipelineStep.UUID,
 			"step_description": pipelineStep.StepDescription,
@@ -124,6 +269,7 @@ func ExecutePipeline(executionID string, p *pipeline_type.Pipeline, registry *pl
 			"data":             output,
 			"output_type":      pipelineStep.OutputType,
 			"error_message":    "",
+			"definition_hash":  definitionHash,
 		}
 
         // Add execution location for action steps
@@ -132,11 +278,27 @@ func ExecutePipeline(executionID string, p *pipeline_type.Pipeline, registry *pl
             stepResult["action_service"] = pipelineStep.ActionDetails.ActionService
         }
 
+        // Keep which configuration ran for rollout analysis
+        if variant != "" {
+            stepResult["rollout"] = map[string]interface{}{
+                "version": pipelineStep.Rollout.Version,
+                "variant": variant,
+            }
+            if Rollouts.Record(p.ID, pipelineStep, variant, err == nil) {
+                logExecution(executionID, pipelineStep.ID, "WARN", fmt.Sprintf("Version %s of the step configuration was rolled back", pipelineStep.Rollout.Version))
+            }
+        }
+
+        addAnnotations(p.Context, pipelineStep, stepResult)
+        addTokenUsage(p.Context, pipelineStep, stepResult)
+        addLocaleVariants(p, pipelineStep, stepResult)
+
         if err != nil {
             stepResult["status"] = "failed"
             stepResult["error_message"] = err.Error()
             stepResult["data"] = fmt.Sprintf("Error: %v", err)
             executionError = err  // Store the error but don't return yet
+            logExecution(executionID, pipelineStep.ID, "ERROR", fmt.Sprintf("Step failed: %v", err))
         
             ExecutionStore.Lock()
             execResult.Status = StatusFailed
@@ -146,12 +308,66 @@ func ExecutePipeline(executionID string, p *pipeline_type.Pipeline, registry *pl
             ExecutionStore.Unlock()
         
             results[pipelineStep.UUID] = stepResult
+            Events.Publish(stepEvent(EventStepFailed, p.ID, executionID, pipelineStep, stepResult, err))
             break  // Break the loop after storing the failed step result
         }
 
+		// Spilled outputs are tied to this execution and not cached
+		if _, spilled := output.(pipeline_type.SpilledOutput); cacheKey != "" && !spilled {
+			StepOutputCache.Put(cacheKey, output, executionID, time.Duration(pipelineStep.CacheTTL)*time.Second, timeProvider.Now())
+			stepResult["cache"] = map[string]interface{}{"hit": false}
+		}
+
+		if entry := processArtifact(logging.WithExecutionLog(ctx, executionID, pipelineStep.ID), p.ID, executionID, pipelineStep, registry, output, stepResult); entry != nil {
+			manifestEntries = append(manifestEntries, *entry)
+		}
+
+		StepDurations.Record(p.ID, pipelineStep.ID, stepEndTime-stepStartTime)
 		results[pipelineStep.UUID] = stepResult
+		logExecution(executionID, pipelineStep.ID, "INFO", "Step completed")
+		Events.Publish(stepEvent(EventStepCompleted, p.ID, executionID, pipelineStep, stepResult, nil))
 	}
 
+    if hooksStarted && len(p.AfterSteps) > 0 {
+        // Let after hooks report or clean up depending on the outcome
+        p.Context.Set("pipeline_status", "completed")
+        if executionError != nil {
+            p.Context.Set("pipeline_status", "failed")
+            p.Context.Set("pipeline_error", executionError.Error())
+        }
+        if err := runHooks(ctx, executionID, p, HookAfter, p.AfterSteps, registry, results); err != nil && executionError == nil {
+            executionError = err
+        }
+    }
+
+    // Derived fields for Drupal, computed from whatever the steps produced
+    if len(p.PostRunHooks) > 0 {
+        if summary := runPostRunHooks(ctx, executionID, p, results); len(summary) > 0 {
+            results[SummaryResultKey] = summary
+        }
+    }
+
+    // What the LLM calls cost, counted against the budget of the pipeline
+    if cost := executionCost(results); cost != nil {
+        results[CostResultKey] = cost
+        Quotas.AddCost(p.ID, cost.Total, timeProvider.Now())
+        ExecutionStore.Lock()
+        execResult.Cost = cost
+        ExecutionStore.Unlock()
+    }
+
+    // Tell operators where it failed and what to do about it
+    if diagnosis := Diagnose(p, results, executionError); diagnosis != nil {
+        results[DiagnosisResultKey] = diagnosis
+        logExecution(executionID, diagnosis.StepID, "ERROR", fmt.Sprintf("Diagnosis: %s, %s", diagnosis.ErrorClass, diagnosis.Remediation))
+    }
+
+    // The watchdog already reported the execution failed
+    if timedOut(ctx) {
+        logExecution(executionID, "", "WARN", "Execution returned after timing out, its results are dropped")
+        return context.Cause(ctx)
+    }
+
     pipelineEndTime := time.Now().Unix()
 
     // Update execution status based on whether we encountered an error
@@ -166,11 +382,37 @@ func ExecutePipeline(executionID string, p *pipeline_type.Pipeline, registry *pl
     execResult.Results = results
     ExecutionStore.Unlock()
 
-    // Always send execution results to Drupal, regardless of error
-    err := SendExecutionResultsFunc(p.ID, results, pipelineStartTime, pipelineEndTime)
-    if err != nil {
-        // Log the error but don't override the original execution error
-        log.Printf("Error sending execution results: %v", err)
+    if executionError == nil {
+        consumeAssets(p.ID, executionID, assets)
+        logExecution(executionID, "", "INFO", "Execution completed")
+        Events.Publish(Event{Type: EventExecutionCompleted, PipelineID: p.ID, ExecutionID: executionID, Result: results})
+    } else {
+        logExecution(executionID, "", "ERROR", fmt.Sprintf("Execution failed: %v", executionError))
+        Events.Publish(Event{Type: EventExecutionFailed, PipelineID: p.ID, ExecutionID: executionID, Result: results, Error: executionError})
+    }
+
+    if len(manifestEntries) > 0 {
+        saveArtifactManifest(executionID, p.ID, definitionHash, manifestEntries, p.ArtifactOrigin)
+    }
+
+    // Keep the final context around so single steps can be debugged against it
+    if err := SaveContextSnapshot(executionID, p); err != nil {
+        log.Printf("Error saving context snapshot for execution %s: %v", executionID, err)
+    }
+
+    // Always send execution results to Drupal, regardless of error. Inline
+    // pipelines don't exist there, their results are only kept here.
+    if !p.Inline {
+        err = SendExecutionResultsFunc(p.ID, results, pipelineStartTime, pipelineEndTime)
+        if err != nil {
+            // Log the error but don't override the original execution error
+            log.Printf("Error sending execution results: %v", err)
+        }
+    }
+    if len(p.ResultWebhooks) > 0 {
+        payload := ExecutionPayload(p.ID, results, pipelineStartTime, pipelineEndTime)
+        payload["execution_id"] = executionID
+        go deliverResultWebhooks(context.WithoutCancel(ctx), p.ID, executionID, p.ResultWebhooks, payload)
     }
 
     // Return the original execution error if any
@@ -182,13 +424,8 @@ func SendExecutionResults(pipelineID string, results map[string]interface{}, sta
 
     apiEndpoint := fmt.Sprintf("%s/pipeline/%s/execution-result", cfg.APIEndpoint, pipelineID)
 
-	executionData := map[string]interface{}{
-        "pipeline_id": pipelineID,
-        "start_time": startTime,
-        "end_time": endTime,
-        "step_results": results,
-        "success": !hasFailedSteps(results),
-    }
+    executionData := ExecutionPayload(pipelineID, results, startTime, endTime)
+    requestID, _ := executionData[RequestIDResultKey].(string)
 
     jsonData, err := json.Marshal(executionData)
 
@@ -204,6 +441,9 @@ func SendExecutionResults(pipelineID string, results map[string]interface{}, sta
     // Add the Host header
     req.Host = cfg.APIHost  // Add this line
     req.Header.Set("Content-Type", "application/json")
+    if requestID != "" {
+        req.Header.Set(requestid.Header, requestID)
+    }
     //req.SetBasicAuth(config.DrupalUsername, config.DrupalPassword)
 
     client := &http.Client{}
@@ -220,6 +460,100 @@ func SendExecutionResults(pipelineID string, results map[string]interface{}, sta
     return nil
 }
 
+// ExecutionPayload is the execution result sent to Drupal and to the result
+// webhooks.
+func ExecutionPayload(pipelineID string, results map[string]interface{}, startTime, endTime int64) map[string]interface{} {
+    executionData := map[string]interface{}{
+        "pipeline_id": pipelineID,
+        "start_time": startTime,
+        "end_time": endTime,
+        "step_results": results,
+        "success": !hasFailedSteps(results),
+    }
+    promoteSummary(executionData, results)
+    if notes := collectAnnotations(results); len(notes) > 0 {
+        executionData[AnnotationsResultKey] = notes
+    }
+    if diagnosis, ok := results[DiagnosisResultKey]; ok {
+        executionData[DiagnosisResultKey] = diagnosis
+    }
+    if sandbox, ok := results[SandboxResultKey]; ok {
+        executionData[SandboxResultKey] = sandbox
+    }
+    if requestID, _ := results[RequestIDResultKey].(string); requestID != "" {
+        executionData[RequestIDResultKey] = requestID
+    }
+    if cost, ok := results[CostResultKey]; ok {
+        executionData[CostResultKey] = cost
+    }
+    return executionData
+}
+
+// configureStep injects the step definition and the services it needs into a
+// step instance obtained from the registry.
+func configureStep(instance step.Step, pipelineStep pipeline_type.PipelineStep, registry *plugin_registry.PluginRegistry) error {
+    switch s := instance.(type) {
+    case *llm_step.LLMStepImpl:
+        s.PipelineStep = pipelineStep
+        // Additional setup for LLM service
+        serviceName, ok := pipelineStep.LLMServiceConfig["service_name"].(string)
+        if !ok {
+            return fmt.Errorf("service_name not found in llm_service configuration for step %s", pipelineStep.ID)
+        }
+        llmServiceInstance, ok := registry.GetLLMService(serviceName)
+        if !ok {
+            return fmt.Errorf("unknown LLM service: %s", serviceName)
+        }
+        s.LLMServiceInstance = llmServiceInstance
+        if len(pipelineStep.Tools) > 0 {
+            if err := validateTools(pipelineStep, registry); err != nil {
+                return err
+            }
+            s.RunTool = toolRunner(pipelineStep.ID, registry)
+        }
+    case *action_step.ActionStepImpl:
+        s.PipelineStep = pipelineStep
+        if pipelineStep.ActionDetails == nil {
+            // Backward compatibility: treat as Drupal-side action
+            s.PipelineStep.ActionDetails = &pipeline_type.ActionDetails{
+                ActionService: pipelineStep.ActionConfig,
+                ExecutionLocation: "drupal",
+                Configuration: map[string]interface{}{},
+            }
+        } else if pipelineStep.ActionDetails.ExecutionLocation == "go" {
+            // Only validate and set action service for Go-side actions
+            actionServiceName := pipelineStep.ActionDetails.ActionService
+            actionServiceInstance, ok := registry.GetActionService(actionServiceName)
+            if !ok {
+                return fmt.Errorf("unknown Go-side Action service: %s", actionServiceName)
+            }
+            s.ActionServiceInstance = actionServiceInstance
+        }
+    default:
+        // Attempt to set the PipelineStep field directly
+        if err := setPipelineStepField(instance, pipelineStep); err != nil {
+            return fmt.Errorf("cannot set PipelineStep for step type %s: %v", pipelineStep.Type, err)
+        }
+    }
+    return nil
+}
+
+// environmentFingerprint describes the host and plugins an execution runs with.
+func environmentFingerprint(registry *plugin_registry.PluginRegistry) *environment.Fingerprint {
+    fingerprint := environment.Collect(registry.Plugins())
+    return &fingerprint
+}
+
+// logExecution appends a lifecycle line to the live execution log.
+func logExecution(executionID, stepID, level, message string) {
+    logging.ExecutionLogs.Append(logging.ExecutionLogLine{
+        ExecutionID: executionID,
+        StepID:      stepID,
+        Level:       level,
+        Message:     message,
+    })
+}
+
 // Helper function to set the PipelineStep field via reflection
 func setPipelineStepField(step interface{}, pipelineStep pipeline_type.PipelineStep) error {
     v := reflect.ValueOf(step)
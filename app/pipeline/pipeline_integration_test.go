@@ -816,3 +816,131 @@ func TestPipelineExecutionWithStepInitializationError(t *testing.T) {
         t.Errorf("Expected error '%s', got '%s'", expectedErrorMsg, err.Error())
     }
 }
+
+func TestPipelineExecutionWithStepOverrides(t *testing.T) {
+    os.Setenv("GO_ENVIRONMENT", "test")
+
+    originalSendExecutionResultsFunc := pipeline.SendExecutionResultsFunc
+    defer func() { pipeline.SendExecutionResultsFunc = originalSendExecutionResultsFunc }()
+    pipeline.SendExecutionResultsFunc = func(pipelineID string, results map[string]interface{}, startTime, endTime int64) error {
+        return nil
+    }
+
+    // The LLM service fails, so the pipeline only succeeds if the step is skipped
+    registry := plugin_registry.NewPluginRegistry()
+    registry.RegisterLLMService("mock_llm_service", &MockLLMService{Error: errors.New("should not be called")})
+    registry.RegisterStepType("llm_step", func() step.Step {
+        return &llm_step.LLMStepImpl{}
+    })
+    registry.RegisterStepType("google_search", func() step.Step {
+        return &MockGoogleSearchStep{Response: "fresh search output"}
+    })
+
+    steps := []pipeline_type.PipelineStep{
+        {
+            ID:            "llm_step_1",
+            UUID:          "uuid-llm",
+            Type:          "llm_step",
+            StepOutputKey: "llm_output",
+            LLMServiceConfig: map[string]interface{}{
+                "service_name": "mock_llm_service",
+            },
+        },
+        {
+            ID:            "google_search_1",
+            UUID:          "uuid-search",
+            Type:          "google_search",
+            StepOutputKey: "search_output",
+        },
+    }
+
+    previous := &pipeline.ExecutionResult{
+        ExecutionID: "previous-execution",
+        Results: map[string]interface{}{
+            "uuid-llm": map[string]interface{}{"status": "completed", "data": "previous LLM output"},
+        },
+    }
+
+    overrides, err := pipeline.BuildRerunOverrides(previous, steps, []string{"llm_step_1"}, nil)
+    if err != nil {
+        t.Fatalf("Failed to build overrides: %v", err)
+    }
+
+    ctx := pipeline_type.NewContext()
+    p := &pipeline_type.Pipeline{
+        ID:            "test_pipeline_rerun",
+        Steps:         steps,
+        Context:       ctx,
+        StepOverrides: overrides,
+    }
+
+    if err := pipeline.ExecutePipeline("test-rerun-execution-id", p, registry); err != nil {
+        t.Fatalf("Pipeline rerun failed: %v", err)
+    }
+
+    if output, _ := ctx.GetStepOutput("llm_output"); output != "previous LLM output" {
+        t.Errorf("Expected reused LLM output, got '%v'", output)
+    }
+    if output, _ := ctx.GetStepOutput("search_output"); output != "fresh search output" {
+        t.Errorf("Expected fresh search output, got '%v'", output)
+    }
+
+    if _, err := pipeline.BuildRerunOverrides(previous, steps, []string{"google_search_1"}, nil); err == nil {
+        t.Error("Expected error when skipping a step that did not run previously")
+    }
+}
+
+func TestInvalidToolsFailTheExecution(t *testing.T) {
+    os.Setenv("GO_ENVIRONMENT", "test")
+
+    var reported map[string]interface{}
+    originalSendExecutionResultsFunc := pipeline.SendExecutionResultsFunc
+    defer func() { pipeline.SendExecutionResultsFunc = originalSendExecutionResultsFunc }()
+    pipeline.SendExecutionResultsFunc = func(pipelineID string, results map[string]interface{}, startTime, endTime int64) error {
+        reported = results
+        return nil
+    }
+
+    registry := plugin_registry.NewPluginRegistry()
+    registry.RegisterLLMService("mock_llm_service", &MockLLMService{Response: "unused"})
+    registry.RegisterStepType("llm_step", func() step.Step {
+        return &llm_step.LLMStepImpl{}
+    })
+
+    p := &pipeline_type.Pipeline{
+        ID: "test_pipeline_invalid_tools",
+        Steps: []pipeline_type.PipelineStep{
+            {
+                ID:            "llm_step_1",
+                UUID:          "uuid-llm-1",
+                Type:          "llm_step",
+                Prompt:        "Look it up.",
+                StepOutputKey: "llm_output",
+                LLMServiceConfig: map[string]interface{}{
+                    "service_name": "mock_llm_service",
+                },
+                Tools: []pipeline_type.StepTool{{Name: "lookup", ActionService: "missing_service"}},
+            },
+        },
+        Context: pipeline_type.NewContext(),
+    }
+
+    err := pipeline.ExecutePipeline("test-invalid-tools", p, registry)
+    if err == nil || !strings.Contains(err.Error(), "unknown action service missing_service") {
+        t.Fatalf("expected the tool validation error, got %v", err)
+    }
+
+    pipeline.ExecutionStore.RLock()
+    execResult := pipeline.ExecutionStore.Executions["test-invalid-tools"]
+    pipeline.ExecutionStore.RUnlock()
+    if execResult == nil || execResult.Status != pipeline.StatusFailed {
+        t.Errorf("expected the execution to be failed, got %+v", execResult)
+    }
+    stepResult, ok := reported["uuid-llm-1"].(map[string]interface{})
+    if !ok {
+        t.Fatalf("expected the failed step in the results sent to Drupal, got %v", reported)
+    }
+    if stepResult["status"] != "failed" {
+        t.Errorf("expected a failed step result, got %v", stepResult)
+    }
+}
@@ -0,0 +1,156 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+const (
+	PostRunExtract = "extract"
+	PostRunWebhook = "webhook"
+
+	// SummaryResultKey holds the summary fields in the results of an
+	// execution. SendExecutionResults promotes them to top-level keys.
+	SummaryResultKey = "summary"
+
+	defaultPostRunTimeout = 10 * time.Second
+	maxPostRunResponse    = 1 << 20
+)
+
+// reservedResultKeys are the keys of the execution result sent to Drupal that
+// summary fields can't replace.
+var reservedResultKeys = map[string]bool{
+	"pipeline_id":  true,
+	"start_time":   true,
+	"end_time":     true,
+	"step_results": true,
+	"success":      true,
+	"annotations":  true,
+	"diagnosis":    true,
+	"sandbox":      true,
+	"request_id":   true,
+	"cost":         true,
+}
+
+// runPostRunHooks computes the summary fields of an execution. A failing hook
+// is logged and skipped, the summary is a convenience and never fails a run.
+func runPostRunHooks(ctx context.Context, executionID string, p *pipeline_type.Pipeline, results map[string]interface{}) map[string]interface{} {
+	summary := make(map[string]interface{})
+	for i, hook := range p.PostRunHooks {
+		var fields map[string]interface{}
+		var err error
+		switch hook.Type {
+		case PostRunExtract:
+			fields, err = extractSummary(p.Context, hook.Fields)
+		case PostRunWebhook:
+			fields, err = webhookSummary(ctx, executionID, p, hook, results)
+		default:
+			err = fmt.Errorf("unknown post-run hook type %q", hook.Type)
+		}
+		if err != nil {
+			logExecution(executionID, "", "WARN", fmt.Sprintf("Post-run hook %d failed: %v", i, err))
+		}
+		for key, value := range fields {
+			if reservedResultKeys[key] {
+				logExecution(executionID, "", "WARN", fmt.Sprintf("Post-run hook %d: summary field %q is reserved", i, key))
+				continue
+			}
+			summary[key] = value
+		}
+	}
+	return summary
+}
+
+// extractSummary resolves each path of fields in the step outputs. Paths that
+// don't resolve are reported together, the other fields are still returned.
+func extractSummary(c *pipeline_type.Context, fields map[string]string) (map[string]interface{}, error) {
+	summary := make(map[string]interface{}, len(fields))
+	var missing []string
+	for field, path := range fields {
+		value, ok := c.GetPath(path)
+		if !ok {
+			missing = append(missing, path)
+			continue
+		}
+		summary[field] = value
+	}
+	if len(missing) > 0 {
+		return summary, fmt.Errorf("paths not found: %s", strings.Join(missing, ", "))
+	}
+	return summary, nil
+}
+
+// webhookSummary posts the results to the hook URL, which answers with the
+// summary fields as a JSON object.
+func webhookSummary(ctx context.Context, executionID string, p *pipeline_type.Pipeline, hook pipeline_type.PostRunHook, results map[string]interface{}) (map[string]interface{}, error) {
+	if hook.URL == "" {
+		return nil, fmt.Errorf("webhook hook has no url")
+	}
+	timeout := defaultPostRunTimeout
+	if hook.Timeout > 0 {
+		timeout = time.Duration(hook.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	body, err := json.Marshal(map[string]interface{}{
+		"pipeline_id":  p.ID,
+		"execution_id": executionID,
+		"step_results": results,
+		"success":      !hasFailedSteps(results),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling results: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error calling %s: %w", hook.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var fields map[string]interface{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxPostRunResponse)).Decode(&fields); err != nil {
+		return nil, fmt.Errorf("invalid summary from %s: %w", hook.URL, err)
+	}
+	return fields, nil
+}
+
+// promoteSummary moves the summary fields of results to the top level of the
+// execution result sent to Drupal.
+func promoteSummary(executionData map[string]interface{}, results map[string]interface{}) {
+	summary, ok := results[SummaryResultKey].(map[string]interface{})
+	if !ok {
+		return
+	}
+	stepResults := make(map[string]interface{}, len(results))
+	for key, value := range results {
+		if key != SummaryResultKey {
+			stepResults[key] = value
+		}
+	}
+	executionData["step_results"] = stepResults
+	for key, value := range summary {
+		if !reservedResultKeys[key] {
+			executionData[key] = value
+		}
+	}
+}
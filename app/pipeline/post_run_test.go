@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+func TestRunPostRunHooks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["execution_id"] != "exec-post-run" {
+			t.Errorf("expected the execution ID in the webhook body, got %v", body["execution_id"])
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"video_url": "https://cdn.example.com/v.mp4", "success": false})
+	}))
+	defer server.Close()
+
+	c := pipeline_type.NewContext()
+	c.SetStepOutput("article", "```json\n{\"title\": \"Breaking news\", \"tags\": [\"a\", \"b\"]}\n```")
+	c.SetStepOutput("summary_text", "plain text")
+	p := &pipeline_type.Pipeline{
+		ID:      "pipeline-1",
+		Context: c,
+		PostRunHooks: []pipeline_type.PostRunHook{
+			{Type: PostRunExtract, Fields: map[string]string{
+				"headline":  "article.title",
+				"first_tag": "article.tags.0",
+				"teaser":    "summary_text",
+				"missing":   "article.author",
+			}},
+			{Type: PostRunWebhook, URL: server.URL},
+		},
+	}
+
+	summary := runPostRunHooks(context.Background(), "exec-post-run", p, map[string]interface{}{})
+	expected := map[string]interface{}{
+		"headline":  "Breaking news",
+		"first_tag": "a",
+		"teaser":    "plain text",
+		"video_url": "https://cdn.example.com/v.mp4",
+	}
+	for key, value := range expected {
+		if summary[key] != value {
+			t.Errorf("expected %s = %v, got %v", key, value, summary[key])
+		}
+	}
+	if _, ok := summary["missing"]; ok {
+		t.Error("expected unresolved paths to be left out")
+	}
+	if _, ok := summary["success"]; ok {
+		t.Error("expected reserved keys to be rejected")
+	}
+}
+
+func TestPromoteSummary(t *testing.T) {
+	results := map[string]interface{}{
+		"step-1":         map[string]interface{}{"status": "completed"},
+		SummaryResultKey: map[string]interface{}{"headline": "Breaking news"},
+	}
+	executionData := map[string]interface{}{"pipeline_id": "pipeline-1", "step_results": results}
+
+	promoteSummary(executionData, results)
+
+	if executionData["headline"] != "Breaking news" {
+		t.Errorf("expected headline at the top level, got %v", executionData["headline"])
+	}
+	stepResults := executionData["step_results"].(map[string]interface{})
+	if _, ok := stepResults[SummaryResultKey]; ok {
+		t.Error("expected the summary to be removed from the step results")
+	}
+	if _, ok := results[SummaryResultKey]; !ok {
+		t.Error("expected the execution results to be left untouched")
+	}
+}
@@ -0,0 +1,134 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+// ErrQuotaExceeded is returned when a pipeline ran out of its execution budget.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaUsage counts the executions and LLM cost of a pipeline in the current
+// day and month.
+type QuotaUsage struct {
+	Day        string  `json:"day"`
+	DayCount   int     `json:"day_count"`
+	DayCost    float64 `json:"day_cost"`
+	Month      string  `json:"month"`
+	MonthCount int     `json:"month_count"`
+	MonthCost  float64 `json:"month_cost"`
+}
+
+// QuotaStore tracks quota usage per pipeline. Usage is persisted to a JSON file
+// so a restart doesn't reset the budget of a runaway schedule.
+type QuotaStore struct {
+	sync.Mutex
+	path  string
+	usage map[string]*QuotaUsage
+}
+
+// Quotas is the quota store used by the executor.
+var Quotas = NewQuotaStore(filepath.Join("storage", "pipeline", "quota_usage.json"))
+
+// NewQuotaStore creates a quota store persisted at path, loading previous usage.
+func NewQuotaStore(path string) *QuotaStore {
+	s := &QuotaStore{path: path, usage: make(map[string]*QuotaUsage)}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &s.usage); err != nil {
+			log.Printf("Error loading quota usage from %s: %v", path, err)
+		}
+	}
+	return s
+}
+
+// current returns the usage of a pipeline, resetting the counters of a period
+// that ended. Callers must hold the lock.
+func (s *QuotaStore) current(pipelineID string, now time.Time) *QuotaUsage {
+	usage, ok := s.usage[pipelineID]
+	if !ok {
+		usage = &QuotaUsage{}
+		s.usage[pipelineID] = usage
+	}
+	if day := now.Format("2006-01-02"); usage.Day != day {
+		usage.Day, usage.DayCount, usage.DayCost = day, 0, 0
+	}
+	if month := now.Format("2006-01"); usage.Month != month {
+		usage.Month, usage.MonthCount, usage.MonthCost = month, 0, 0
+	}
+	return usage
+}
+
+// Reserve checks the quota of a pipeline and counts one more execution. It
+// returns an error wrapping ErrQuotaExceeded when the budget is exhausted.
+// Pipelines without a quota are not tracked.
+func (s *QuotaStore) Reserve(pipelineID string, quota *pipeline_type.ExecutionQuota, now time.Time) error {
+	if quota == nil || quota.IsZero() {
+		return nil
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	usage := s.current(pipelineID, now)
+	switch {
+	case quota.DailyExecutions > 0 && usage.DayCount >= quota.DailyExecutions:
+		return fmt.Errorf("%w: daily limit of %d executions reached for pipeline %s", ErrQuotaExceeded, quota.DailyExecutions, pipelineID)
+	case quota.MonthlyExecutions > 0 && usage.MonthCount >= quota.MonthlyExecutions:
+		return fmt.Errorf("%w: monthly limit of %d executions reached for pipeline %s", ErrQuotaExceeded, quota.MonthlyExecutions, pipelineID)
+	case quota.DailyCost > 0 && usage.DayCost >= quota.DailyCost:
+		return fmt.Errorf("%w: daily LLM cost budget of %.2f reached for pipeline %s", ErrQuotaExceeded, quota.DailyCost, pipelineID)
+	case quota.MonthlyCost > 0 && usage.MonthCost >= quota.MonthlyCost:
+		return fmt.Errorf("%w: monthly LLM cost budget of %.2f reached for pipeline %s", ErrQuotaExceeded, quota.MonthlyCost, pipelineID)
+	}
+
+	usage.DayCount++
+	usage.MonthCount++
+	s.save()
+	return nil
+}
+
+// AddCost records the LLM cost of an execution against the pipeline budget.
+func (s *QuotaStore) AddCost(pipelineID string, cost float64, now time.Time) {
+	if cost <= 0 {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	usage := s.current(pipelineID, now)
+	usage.DayCost += cost
+	usage.MonthCost += cost
+	s.save()
+}
+
+// Usage returns a copy of the current usage of a pipeline.
+func (s *QuotaStore) Usage(pipelineID string, now time.Time) QuotaUsage {
+	s.Lock()
+	defer s.Unlock()
+	return *s.current(pipelineID, now)
+}
+
+// save persists the usage. Callers must hold the lock.
+func (s *QuotaStore) save() {
+	data, err := json.Marshal(s.usage)
+	if err != nil {
+		log.Printf("Error marshaling quota usage: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		log.Printf("Error creating quota usage directory: %v", err)
+		return
+	}
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		log.Printf("Error saving quota usage: %v", err)
+	}
+}
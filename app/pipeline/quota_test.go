@@ -0,0 +1,45 @@
+package pipeline
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+func TestQuotaStoreEnforcesAndResetsDailyLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quota_usage.json")
+	store := NewQuotaStore(path)
+	quota := &pipeline_type.ExecutionQuota{DailyExecutions: 2, MonthlyCost: 5}
+	day := time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		if err := store.Reserve("p1", quota, day); err != nil {
+			t.Fatalf("execution %d: unexpected error: %v", i+1, err)
+		}
+	}
+	if err := store.Reserve("p1", quota, day); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected quota exceeded, got %v", err)
+	}
+
+	// Usage survives a restart
+	if usage := NewQuotaStore(path).Usage("p1", day); usage.DayCount != 2 {
+		t.Errorf("expected persisted day count 2, got %d", usage.DayCount)
+	}
+
+	nextDay := day.Add(24 * time.Hour)
+	if err := store.Reserve("p1", quota, nextDay); err != nil {
+		t.Fatalf("expected daily counter to reset, got %v", err)
+	}
+
+	store.AddCost("p1", 5, nextDay)
+	if err := store.Reserve("p1", quota, nextDay); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected monthly cost budget to be exceeded, got %v", err)
+	}
+
+	if err := store.Reserve("p2", nil, day); err != nil {
+		t.Errorf("expected pipelines without quota to be unlimited, got %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package pipeline
+
+import (
+	"strings"
+)
+
+// RedactedValue replaces secrets in the contexts exposed through the API.
+const RedactedValue = "[REDACTED]"
+
+// sensitiveKeyParts are the key fragments of values that must not leave the
+// server: credentials found in step outputs and action configurations.
+var sensitiveKeyParts = []string{
+	"api_key",
+	"apikey",
+	"secret",
+	"password",
+	"token",
+	"authorization",
+	"credential",
+	"private_key",
+}
+
+func isSensitiveKey(key string) bool {
+	normalized := strings.ToLower(strings.ReplaceAll(key, "-", "_"))
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(normalized, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactValue returns a copy of value where every map entry with a sensitive
+// key is replaced by RedactedValue, at any depth.
+func RedactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return redactMap(v)
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = RedactValue(item)
+		}
+		return redacted
+	}
+	return value
+}
+
+func redactMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	redacted := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		if isSensitiveKey(key) {
+			redacted[key] = RedactedValue
+			continue
+		}
+		redacted[key] = RedactValue(value)
+	}
+	return redacted
+}
+
+// Redacted returns a copy of the snapshot safe to expose: secrets are masked
+// in the step outputs and the context data.
+func (s *ContextSnapshot) Redacted() *ContextSnapshot {
+	redacted := *s
+	redacted.StepOutputs = redactMap(s.StepOutputs)
+	redacted.Data = redactMap(s.Data)
+	return &redacted
+}
@@ -0,0 +1,136 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/serisow/lesocle/artifact"
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+// ErrArtifactNotFound is returned when regenerating an artifact missing from
+// the manifest of the execution.
+var ErrArtifactNotFound = errors.New("artifact not found")
+
+// Regeneration is the plan of a run producing a new version of one artifact
+// of an execution.
+type Regeneration struct {
+	// Steps are the pipeline steps, the producing step with the parameter
+	// overrides applied
+	Steps []pipeline_type.PipelineStep
+	// RerunSteps are the IDs of the producing step and of its dependents, the
+	// other completed steps reuse their output from the execution
+	RerunSteps []string
+	Overrides  map[string]pipeline_type.StepOverride
+	Origin     artifact.Origin
+}
+
+// PlanRegeneration plans the regeneration of an artifact, identified by the
+// ID or UUID of the step that produced it. Parameters override the prompt of
+// the producing step ("prompt"), else its llm_service configuration for LLM
+// steps and its action configuration for action steps, e.g. "voice_id".
+func PlanRegeneration(previous *ExecutionResult, manifest *artifact.Manifest, steps []pipeline_type.PipelineStep, artifactID string, parameters map[string]interface{}) (*Regeneration, error) {
+	entry, ok := manifest.Entry(artifactID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrArtifactNotFound, artifactID)
+	}
+
+	planned := make([]pipeline_type.PipelineStep, len(steps))
+	copy(planned, steps)
+	producer := -1
+	for i, s := range planned {
+		if s.ID == entry.StepID {
+			producer = i
+		}
+	}
+	if producer < 0 {
+		return nil, fmt.Errorf("step %s producing the artifact is no longer in the pipeline", entry.StepID)
+	}
+	if err := applyParameters(&planned[producer], parameters); err != nil {
+		return nil, err
+	}
+
+	rerun := dependentSteps(planned, planned[producer])
+	var skip []string
+	for _, s := range planned {
+		if rerun[s.ID] {
+			continue
+		}
+		if stepResult, ok := previous.Results[s.UUID].(map[string]interface{}); ok {
+			if status, _ := stepResult["status"].(string); status == "completed" {
+				skip = append(skip, s.ID)
+			}
+		}
+	}
+	overrides, err := BuildRerunOverrides(previous, planned, skip, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Regeneration{Steps: planned, Overrides: overrides, Origin: manifest.NextVersion(entry.StepID)}
+	for _, s := range planned {
+		if rerun[s.ID] {
+			r.RerunSteps = append(r.RerunSteps, s.ID)
+		}
+	}
+	return r, nil
+}
+
+// applyParameters overrides the configuration of a step, copying the maps it
+// changes so the definition fetched stays untouched.
+func applyParameters(step *pipeline_type.PipelineStep, parameters map[string]interface{}) error {
+	for key, value := range parameters {
+		switch {
+		case key == "prompt":
+			prompt, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("parameter prompt must be a string")
+			}
+			step.Prompt = prompt
+		case step.Type == "llm_step":
+			config := make(map[string]interface{}, len(step.LLMServiceConfig)+1)
+			for k, v := range step.LLMServiceConfig {
+				config[k] = v
+			}
+			config[key] = value
+			step.LLMServiceConfig = config
+		case step.ActionDetails != nil:
+			details := *step.ActionDetails
+			details.Configuration = make(map[string]interface{}, len(step.ActionDetails.Configuration)+1)
+			for k, v := range step.ActionDetails.Configuration {
+				details.Configuration[k] = v
+			}
+			details.Configuration[key] = value
+			step.ActionDetails = &details
+		default:
+			return fmt.Errorf("parameter %s does not apply to %s step %s", key, step.Type, step.ID)
+		}
+	}
+	return nil
+}
+
+// dependentSteps returns the IDs of the producer and of the steps requiring
+// its output, directly or through other dependents.
+func dependentSteps(steps []pipeline_type.PipelineStep, producer pipeline_type.PipelineStep) map[string]bool {
+	dependents := map[string]bool{producer.ID: true}
+	outputs := map[string]bool{producer.StepOutputKey: producer.StepOutputKey != ""}
+	for changed := true; changed; {
+		changed = false
+		for _, s := range steps {
+			if dependents[s.ID] {
+				continue
+			}
+			for _, key := range s.RequiredStepKeys() {
+				if outputs[key] {
+					dependents[s.ID] = true
+					if s.StepOutputKey != "" {
+						outputs[s.StepOutputKey] = true
+					}
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return dependents
+}
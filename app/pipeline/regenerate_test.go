@@ -0,0 +1,73 @@
+package pipeline
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/serisow/lesocle/artifact"
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+func TestPlanRegeneration(t *testing.T) {
+	steps := []pipeline_type.PipelineStep{
+		{ID: "write", UUID: "uuid-write", Type: "llm_step", StepOutputKey: "article"},
+		{ID: "image", UUID: "uuid-image", Type: "llm_step", StepOutputKey: "image", RequiredSteps: "article",
+			Prompt: "A photo", LLMServiceConfig: map[string]interface{}{"size": "512x512"}},
+		{ID: "video", UUID: "uuid-video", Type: "action_step", StepOutputKey: "video", RequiredSteps: "image\narticle"},
+		{ID: "tweet", UUID: "uuid-tweet", Type: "action_step", RequiredSteps: "article"},
+	}
+	completed := func(data string) map[string]interface{} {
+		return map[string]interface{}{"status": "completed", "data": data}
+	}
+	previous := &ExecutionResult{
+		ExecutionID: "exec-1",
+		Results: map[string]interface{}{
+			"uuid-write": completed("the article"),
+			"uuid-image": completed("old image"),
+			"uuid-video": completed("old video"),
+			"uuid-tweet": completed("tweet id"),
+		},
+	}
+	manifest := &artifact.Manifest{
+		ExecutionID: "exec-1",
+		Artifacts:   []artifact.ManifestEntry{{StepID: "image", StepUUID: "uuid-image"}},
+	}
+
+	plan, err := PlanRegeneration(previous, manifest, steps, "uuid-image", map[string]interface{}{
+		"prompt": "A drawing",
+		"size":   "1024x1024",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(plan.RerunSteps) != 2 || plan.RerunSteps[0] != "image" || plan.RerunSteps[1] != "video" {
+		t.Errorf("expected the image step and its dependent to run, got %v", plan.RerunSteps)
+	}
+	if len(plan.Overrides) != 2 || plan.Overrides["write"].Output != "the article" || plan.Overrides["tweet"].Output != "tweet id" {
+		t.Errorf("expected the other steps to reuse their output, got %v", plan.Overrides)
+	}
+	if plan.Steps[1].Prompt != "A drawing" || plan.Steps[1].LLMServiceConfig["size"] != "1024x1024" {
+		t.Errorf("expected the parameters on the producing step, got %+v", plan.Steps[1])
+	}
+	if steps[1].Prompt != "A photo" || steps[1].LLMServiceConfig["size"] != "512x512" {
+		t.Errorf("expected the fetched steps untouched, got %+v", steps[1])
+	}
+	want := artifact.Origin{ExecutionID: "exec-1", OriginalExecutionID: "exec-1", ArtifactID: "image", Version: 2}
+	if plan.Origin != want {
+		t.Errorf("expected origin %+v, got %+v", want, plan.Origin)
+	}
+
+	// A regeneration of a regenerated artifact is its next version
+	manifest = &artifact.Manifest{ExecutionID: "exec-2", Artifacts: manifest.Artifacts, RegeneratedFrom: &want}
+	if origin := manifest.NextVersion("image"); origin.Version != 3 || origin.OriginalExecutionID != "exec-1" {
+		t.Errorf("expected version 3 of the exec-1 artifact, got %+v", origin)
+	}
+
+	if _, err := PlanRegeneration(previous, manifest, steps, "video", nil); !errors.Is(err, ErrArtifactNotFound) {
+		t.Errorf("expected ErrArtifactNotFound, got %v", err)
+	}
+	if _, err := PlanRegeneration(previous, manifest, steps, "image", map[string]interface{}{"prompt": 3}); err == nil {
+		t.Error("expected an error for a non-string prompt")
+	}
+}
@@ -0,0 +1,57 @@
+package pipeline
+
+import (
+	"fmt"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+const (
+	OverrideSourceSkipped = "skipped"
+	OverrideSourcePinned  = "pinned"
+)
+
+// BuildRerunOverrides computes the step overrides for a debugging rerun.
+// Skipped steps reuse the output they produced in the previous execution, pinned
+// steps get the caller supplied value. Both are keyed by step ID.
+func BuildRerunOverrides(previous *ExecutionResult, steps []pipeline_type.PipelineStep, skipSteps []string, pinnedOutputs map[string]interface{}) (map[string]pipeline_type.StepOverride, error) {
+	stepsByID := make(map[string]pipeline_type.PipelineStep, len(steps))
+	for _, s := range steps {
+		stepsByID[s.ID] = s
+	}
+
+	overrides := make(map[string]pipeline_type.StepOverride)
+
+	for _, stepID := range skipSteps {
+		s, ok := stepsByID[stepID]
+		if !ok {
+			return nil, fmt.Errorf("cannot skip unknown step: %s", stepID)
+		}
+		if previous == nil {
+			return nil, fmt.Errorf("cannot skip step %s: no previous execution available", stepID)
+		}
+		stepResult, ok := previous.Results[s.UUID].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot skip step %s: it did not run in execution %s", stepID, previous.ExecutionID)
+		}
+		if status, _ := stepResult["status"].(string); status != "completed" {
+			return nil, fmt.Errorf("cannot skip step %s: it did not complete in execution %s", stepID, previous.ExecutionID)
+		}
+		overrides[stepID] = pipeline_type.StepOverride{
+			Output: stepResult["data"],
+			Source: OverrideSourceSkipped,
+		}
+	}
+
+	for stepID, output := range pinnedOutputs {
+		if _, ok := stepsByID[stepID]; !ok {
+			return nil, fmt.Errorf("cannot pin unknown step: %s", stepID)
+		}
+		overrides[stepID] = pipeline_type.StepOverride{
+			Output: output,
+			Source: OverrideSourcePinned,
+		}
+	}
+
+	return overrides, nil
+}
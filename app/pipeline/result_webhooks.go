@@ -0,0 +1,116 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+const (
+	// SignatureHeader carries "sha256=<hex HMAC-SHA256 of
+	// timestamp.pipeline_id.body>" on the result webhooks with a secret, the
+	// signature the triggers expect, so a result webhook can trigger another
+	// pipeline.
+	SignatureHeader = "X-Signature-256"
+	// TimestampHeader carries the Unix timestamp of the signature.
+	TimestampHeader = "X-Trigger-Timestamp"
+
+	resultWebhookAttempts = 4
+	resultWebhookTimeout  = 10 * time.Second
+)
+
+// resultWebhookRetryDelay is the wait before the second attempt, doubled
+// after each failed one.
+var resultWebhookRetryDelay = 5 * time.Second
+
+// deliverResultWebhooks posts the execution result to every webhook of the
+// pipeline. Deliveries are retried on network errors and 5xx or 429
+// answers, failures are logged to the execution.
+func deliverResultWebhooks(ctx context.Context, pipelineID, executionID string, webhooks []pipeline_type.ResultWebhook, payload map[string]interface{}) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logExecution(executionID, "", "ERROR", fmt.Sprintf("Error marshaling the result webhook payload: %v", err))
+		return
+	}
+	for _, webhook := range webhooks {
+		if err := deliverResultWebhook(ctx, pipelineID, webhook, body); err != nil {
+			logExecution(executionID, "", "WARN", fmt.Sprintf("Result webhook %s failed: %v", webhook.URL, err))
+		}
+	}
+}
+
+func deliverResultWebhook(ctx context.Context, pipelineID string, webhook pipeline_type.ResultWebhook, body []byte) error {
+	if webhook.URL == "" {
+		return fmt.Errorf("no url")
+	}
+	delay := resultWebhookRetryDelay
+	var err error
+	for attempt := 1; attempt <= resultWebhookAttempts; attempt++ {
+		var retry bool
+		retry, err = postResultWebhook(ctx, pipelineID, webhook, body)
+		if err == nil || !retry || attempt == resultWebhookAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	return err
+}
+
+// postResultWebhook sends one delivery, it reports whether a failure is worth
+// retrying.
+func postResultWebhook(ctx context.Context, pipelineID string, webhook pipeline_type.ResultWebhook, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, resultWebhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if webhook.Secret != "" {
+		SignRequest(req, webhook.Secret, pipelineID, body, time.Now())
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("error sending results: %w", err)
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return true, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	case resp.StatusCode >= 300:
+		return false, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return false, nil
+}
+
+// SignRequest sets the SignatureHeader and TimestampHeader of req, whose
+// body is body, as a signed trigger request of pipelineID.
+func SignRequest(req *http.Request, secret, pipelineID string, body []byte, now time.Time) {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(TriggerSignature(secret, timestamp, pipelineID, body)))
+}
+
+// TriggerSignature is the HMAC-SHA256 of "timestamp.pipeline_id.body".
+func TriggerSignature(secret, timestamp, pipelineID string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + pipelineID + "."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
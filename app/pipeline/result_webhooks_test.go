@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/serisow/lesocle/action_step"
+	"github.com/serisow/lesocle/pipeline/step"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/plugin_registry"
+	"github.com/serisow/lesocle/services/action_service"
+)
+
+func TestResultWebhooksAreSignedAndRetried(t *testing.T) {
+	originalSend := SendExecutionResultsFunc
+	originalDelay := resultWebhookRetryDelay
+	defer func() { SendExecutionResultsFunc, resultWebhookRetryDelay = originalSend, originalDelay }()
+	SendExecutionResultsFunc = func(pipelineID string, results map[string]interface{}, startTime, endTime int64) error { return nil }
+	resultWebhookRetryDelay = time.Millisecond
+
+	attempts := 0
+	delivered := make(chan map[string]interface{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			http.Error(w, "Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		timestamp := r.Header.Get(TimestampHeader)
+		if want := "sha256=" + hex.EncodeToString(TriggerSignature("s3cret", timestamp, "pipeline-webhooks", body)); r.Header.Get(SignatureHeader) != want {
+			t.Errorf("unexpected signature %q at %q", r.Header.Get(SignatureHeader), timestamp)
+		}
+		var payload map[string]interface{}
+		json.Unmarshal(body, &payload)
+		delivered <- payload
+	}))
+	defer srv.Close()
+
+	registry := plugin_registry.NewPluginRegistry()
+	registry.RegisterActionService("echo", &action_service.MockActionService{
+		Response: func(ctx context.Context, actionConfig string, c *pipeline_type.Context, s *pipeline_type.PipelineStep) string {
+			return "done"
+		},
+	})
+	registry.RegisterStepType("action_step", func() step.Step { return &action_step.ActionStepImpl{} })
+	p := &pipeline_type.Pipeline{
+		ID: "pipeline-webhooks",
+		Steps: []pipeline_type.PipelineStep{
+			{ID: "echo", UUID: "uuid-echo", Type: "action_step", StepOutputKey: "echoed",
+				ActionDetails: &pipeline_type.ActionDetails{ActionService: "echo", ExecutionLocation: "go"}},
+		},
+		ResultWebhooks: []pipeline_type.ResultWebhook{{URL: srv.URL, Secret: "s3cret"}},
+	}
+	if err := ExecutePipeline("exec-webhooks", p, registry); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	select {
+	case payload := <-delivered:
+		if payload["execution_id"] != "exec-webhooks" || payload["pipeline_id"] != "pipeline-webhooks" || payload["success"] != true {
+			t.Errorf("unexpected payload %v", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the results delivered after a retry")
+	}
+}
+
+func TestResultWebhookClientErrorsAreNotRetried(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		http.Error(w, "Gone", http.StatusGone)
+	}))
+	defer srv.Close()
+
+	err := deliverResultWebhook(context.Background(), "p1", pipeline_type.ResultWebhook{URL: srv.URL}, []byte("{}"))
+	if err == nil || attempts != 1 {
+		t.Errorf("expected a single failed attempt, got %d and %v", attempts, err)
+	}
+}
@@ -0,0 +1,195 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+const (
+	VariantStable    = "stable"
+	VariantCandidate = "candidate"
+
+	defaultRolloutMinExecutions      = 10
+	defaultRolloutMaxFailureIncrease = 0.1
+)
+
+// VariantStats counts the runs of one variant of a step.
+type VariantStats struct {
+	Executions int `json:"executions"`
+	Failures   int `json:"failures"`
+}
+
+// FailureRate returns the share of failed runs.
+func (v VariantStats) FailureRate() float64 {
+	if v.Executions == 0 {
+		return 0
+	}
+	return float64(v.Failures) / float64(v.Executions)
+}
+
+// RolloutState tracks a candidate step configuration against the stable one.
+type RolloutState struct {
+	Stable         VariantStats `json:"stable"`
+	Candidate      VariantStats `json:"candidate"`
+	RolledBack     bool         `json:"rolled_back"`
+	RollbackReason string       `json:"rollback_reason,omitempty"`
+	RolledBackAt   string       `json:"rolled_back_at,omitempty"`
+}
+
+// RolloutStore tracks the rollouts of step configurations, keyed by pipeline,
+// step and candidate version. It is persisted so a rollback sticks across
+// restarts.
+type RolloutStore struct {
+	sync.Mutex
+	path   string
+	states map[string]*RolloutState
+}
+
+// Rollouts is the rollout store used by the executor.
+var Rollouts = NewRolloutStore(filepath.Join("storage", "pipeline", "rollouts.json"))
+
+// NewRolloutStore creates a rollout store persisted at path, loading the
+// previous state.
+func NewRolloutStore(path string) *RolloutStore {
+	s := &RolloutStore{path: path, states: make(map[string]*RolloutState)}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &s.states); err != nil {
+			log.Printf("Error loading rollout state from %s: %v", path, err)
+		}
+	}
+	return s
+}
+
+func rolloutKey(pipelineID string, step pipeline_type.PipelineStep) string {
+	return pipelineID + "/" + step.ID + "/" + step.Rollout.Version
+}
+
+// Select picks the variant of a step for an execution and returns the step
+// configuration to run. The choice is a hash of the execution ID so it can be
+// reproduced. Steps without a rollout, or whose candidate was rolled back,
+// always run the stable configuration.
+func (s *RolloutStore) Select(pipelineID, executionID string, step pipeline_type.PipelineStep) (pipeline_type.PipelineStep, string) {
+	rollout := step.Rollout
+	if rollout == nil || rollout.Version == "" || rollout.Percentage <= 0 {
+		return step, ""
+	}
+
+	s.Lock()
+	state, ok := s.states[rolloutKey(pipelineID, step)]
+	rolledBack := ok && state.RolledBack
+	s.Unlock()
+	if rolledBack {
+		return step, VariantStable
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(executionID + "/" + step.ID))
+	if int(h.Sum32()%100) >= rollout.Percentage {
+		return step, VariantStable
+	}
+
+	if rollout.Prompt != "" {
+		step.Prompt = rollout.Prompt
+	}
+	if len(rollout.LLMServiceConfig) > 0 {
+		config := make(map[string]interface{}, len(step.LLMServiceConfig)+len(rollout.LLMServiceConfig))
+		for k, v := range step.LLMServiceConfig {
+			config[k] = v
+		}
+		for k, v := range rollout.LLMServiceConfig {
+			config[k] = v
+		}
+		step.LLMServiceConfig = config
+	}
+	return step, VariantCandidate
+}
+
+// Record counts the outcome of a step run and rolls the candidate back when
+// its failure rate regressed. It returns true when this run triggered the
+// rollback.
+func (s *RolloutStore) Record(pipelineID string, step pipeline_type.PipelineStep, variant string, success bool) bool {
+	if step.Rollout == nil || variant == "" {
+		return false
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	key := rolloutKey(pipelineID, step)
+	state, ok := s.states[key]
+	if !ok {
+		state = &RolloutState{}
+		s.states[key] = state
+	}
+
+	stats := &state.Stable
+	if variant == VariantCandidate {
+		stats = &state.Candidate
+	}
+	stats.Executions++
+	if !success {
+		stats.Failures++
+	}
+
+	rolledBack := false
+	if !state.RolledBack {
+		minExecutions := step.Rollout.MinExecutions
+		if minExecutions <= 0 {
+			minExecutions = defaultRolloutMinExecutions
+		}
+		maxIncrease := step.Rollout.MaxFailureRateIncrease
+		if maxIncrease <= 0 {
+			maxIncrease = defaultRolloutMaxFailureIncrease
+		}
+
+		candidateRate, stableRate := state.Candidate.FailureRate(), state.Stable.FailureRate()
+		if state.Candidate.Executions >= minExecutions && candidateRate > stableRate+maxIncrease {
+			state.RolledBack = true
+			state.RollbackReason = fmt.Sprintf("candidate failure rate %.0f%% vs %.0f%% for stable", candidateRate*100, stableRate*100)
+			state.RolledBackAt = time.Now().UTC().Format(time.RFC3339)
+			rolledBack = true
+			log.Printf("Rolled back version %s of step %s in pipeline %s: %s", step.Rollout.Version, step.ID, pipelineID, state.RollbackReason)
+		}
+	}
+
+	s.save()
+	return rolledBack
+}
+
+// State returns a copy of the rollout state of a step version.
+func (s *RolloutStore) State(pipelineID string, step pipeline_type.PipelineStep) (RolloutState, bool) {
+	if step.Rollout == nil {
+		return RolloutState{}, false
+	}
+	s.Lock()
+	defer s.Unlock()
+	state, ok := s.states[rolloutKey(pipelineID, step)]
+	if !ok {
+		return RolloutState{}, false
+	}
+	return *state, true
+}
+
+// save persists the state. Callers must hold the lock.
+func (s *RolloutStore) save() {
+	data, err := json.Marshal(s.states)
+	if err != nil {
+		log.Printf("Error marshaling rollout state: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		log.Printf("Error creating rollout state directory: %v", err)
+		return
+	}
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		log.Printf("Error saving rollout state: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package pipeline
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+func TestRolloutSelectsCandidateByPercentage(t *testing.T) {
+	store := NewRolloutStore(filepath.Join(t.TempDir(), "rollouts.json"))
+	step := pipeline_type.PipelineStep{
+		ID:               "write",
+		Prompt:           "stable prompt",
+		LLMServiceConfig: map[string]interface{}{"service_name": "openai", "model_name": "gpt-4o"},
+		Rollout: &pipeline_type.StepRollout{
+			Version:          "v2",
+			Percentage:       30,
+			LLMServiceConfig: map[string]interface{}{"model_name": "gpt-4.1"},
+		},
+	}
+
+	candidates := 0
+	for i := 0; i < 1000; i++ {
+		selected, variant := store.Select("p1", fmt.Sprintf("exec-%d", i), step)
+		if variant == VariantCandidate {
+			candidates++
+			if selected.LLMServiceConfig["model_name"] != "gpt-4.1" || selected.LLMServiceConfig["service_name"] != "openai" {
+				t.Fatalf("candidate configuration not applied: %v", selected.LLMServiceConfig)
+			}
+		} else if selected.LLMServiceConfig["model_name"] != "gpt-4o" {
+			t.Fatalf("stable configuration modified: %v", selected.LLMServiceConfig)
+		}
+	}
+	if candidates < 230 || candidates > 370 {
+		t.Errorf("expected about 30%% candidate executions, got %d/1000", candidates)
+	}
+}
+
+func TestRolloutRollsBackOnFailureRegression(t *testing.T) {
+	store := NewRolloutStore(filepath.Join(t.TempDir(), "rollouts.json"))
+	step := pipeline_type.PipelineStep{
+		ID:      "write",
+		Rollout: &pipeline_type.StepRollout{Version: "v2", Percentage: 100, MinExecutions: 4},
+	}
+
+	for i := 0; i < 4; i++ {
+		store.Record("p1", step, VariantStable, true)
+	}
+	store.Record("p1", step, VariantCandidate, true)
+	store.Record("p1", step, VariantCandidate, false)
+	store.Record("p1", step, VariantCandidate, true)
+	if !store.Record("p1", step, VariantCandidate, false) {
+		t.Fatal("expected the fourth candidate run to trigger the rollback")
+	}
+
+	if _, variant := store.Select("p1", "exec-1", step); variant != VariantStable {
+		t.Errorf("expected stable variant after rollback, got %s", variant)
+	}
+}
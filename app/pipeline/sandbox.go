@@ -0,0 +1,19 @@
+package pipeline
+
+import (
+	"github.com/serisow/lesocle/config"
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+// SandboxResultKey flags the results of sandboxed executions, whose actions
+// were simulated or sent to test endpoints.
+const SandboxResultKey = "sandbox"
+
+// applySandbox turns sandbox mode on for the execution of p when it was
+// requested for it, or for every execution with SANDBOX_MODE.
+func applySandbox(p *pipeline_type.Pipeline) {
+	if config.Load().SandboxMode {
+		p.Sandbox = true
+	}
+	p.Context.Sandbox = p.Sandbox
+}
@@ -0,0 +1,127 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/serisow/lesocle/logging"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/plugin_registry"
+)
+
+// ExecuteStep runs a single step of the pipeline against p.Context, usually
+// restored from the snapshot of a previous execution. It is meant for debugging:
+// the result is tracked in the ExecutionStore like a regular execution but is not
+// sent to Drupal.
+func ExecuteStep(executionID string, p *pipeline_type.Pipeline, stepID string, registry *plugin_registry.PluginRegistry) error {
+	ctx := logging.WithExecutionLog(context.Background(), executionID, stepID)
+	if p.Context == nil {
+		p.Context = pipeline_type.NewContext()
+	}
+	p.Context.SetSteps(p.Steps)
+	p.Context.ContentFilter = p.ContentFilter
+	applySandbox(p)
+
+	var pipelineStep pipeline_type.PipelineStep
+	found := false
+	for _, s := range p.Steps {
+		if s.ID == stepID {
+			pipelineStep, found = s, true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("step %s not found in pipeline %s", stepID, p.ID)
+	}
+
+	startTime := time.Now()
+	definitionHash := p.DefinitionHash()
+	execResult := &ExecutionResult{
+		PipelineID:     p.ID,
+		ExecutionID:    executionID,
+		DefinitionHash: definitionHash,
+		Environment:    environmentFingerprint(registry),
+		Status:         StatusStarted,
+		StartTime:      startTime.Unix(),
+		SubmittedAt:    startTime.UTC().Format(time.RFC3339),
+		UserInput:      p.Context.GetUserInput(),
+		Sandbox:        p.Sandbox,
+	}
+	AddExecution(executionID, execResult)
+	if err := SaveExecutionDefinition(executionID, p); err != nil {
+		log.Printf("Error saving definition of execution %s: %v", executionID, err)
+	}
+	defer logging.ExecutionLogs.Finish(executionID)
+
+	logExecution(executionID, stepID, "INFO", fmt.Sprintf("Single step execution started: %s (%s)", pipelineStep.StepDescription, pipelineStep.Type))
+	Events.Publish(stepEvent(EventStepStarted, p.ID, executionID, pipelineStep, nil, nil))
+
+	err := runSingleStep(ctx, p, pipelineStep, registry)
+
+	output, _ := p.Context.GetRawStepOutput(pipelineStep.StepOutputKey)
+	stepResult := map[string]interface{}{
+		"step_uuid":        pipelineStep.UUID,
+		"step_description": pipelineStep.StepDescription,
+		"status":           "completed",
+		"start_time":       startTime.Unix(),
+		"end_time":         time.Now().Unix(),
+		"step_type":        pipelineStep.Type,
+		"sequence":         pipelineStep.Weight,
+		"data":             output,
+		"output_type":      pipelineStep.OutputType,
+		"error_message":    "",
+		"definition_hash":  definitionHash,
+	}
+
+	addAnnotations(p.Context, pipelineStep, stepResult)
+	addTokenUsage(p.Context, pipelineStep, stepResult)
+
+	if err != nil {
+		stepResult["status"] = "failed"
+		stepResult["error_message"] = err.Error()
+		stepResult["data"] = fmt.Sprintf("Error: %v", err)
+		logExecution(executionID, stepID, "ERROR", fmt.Sprintf("Step failed: %v", err))
+		Events.Publish(stepEvent(EventStepFailed, p.ID, executionID, pipelineStep, stepResult, err))
+	} else {
+		processArtifact(ctx, p.ID, executionID, pipelineStep, registry, output, stepResult)
+		logExecution(executionID, stepID, "INFO", "Step completed")
+		Events.Publish(stepEvent(EventStepCompleted, p.ID, executionID, pipelineStep, stepResult, nil))
+	}
+
+	ExecutionStore.Lock()
+	execResult.Status = StatusCompleted
+	if err != nil {
+		execResult.Status = StatusFailed
+		execResult.ErrorMessage = err.Error()
+	}
+	execResult.EndTime = time.Now().Unix()
+	execResult.CompletedAt = time.Now().UTC().Format(time.RFC3339)
+	execResult.Results = map[string]interface{}{pipelineStep.UUID: stepResult}
+	ExecutionStore.Unlock()
+
+	return err
+}
+
+func runSingleStep(ctx context.Context, p *pipeline_type.Pipeline, pipelineStep pipeline_type.PipelineStep, registry *plugin_registry.PluginRegistry) error {
+	for _, key := range pipelineStep.RequiredStepKeys() {
+		if _, ok := p.Context.GetStepOutput(key); !ok {
+			return fmt.Errorf("required output '%s' is missing from the context snapshot", key)
+		}
+	}
+
+	if newType, deprecated := registry.ResolveAlias(pipelineStep.Type); deprecated {
+		executionID, _, _ := logging.ExecutionLogScope(ctx)
+		logExecution(executionID, pipelineStep.ID, "WARN", fmt.Sprintf("Step type %s is deprecated, use %s instead", pipelineStep.Type, newType))
+	}
+
+	instance, err := registry.GetStepInstance(pipelineStep.Type)
+	if err != nil {
+		return fmt.Errorf("unknown step type: %s", pipelineStep.Type)
+	}
+	if err := configureStep(instance, pipelineStep, registry); err != nil {
+		return err
+	}
+	return instance.Execute(ctx, p.Context)
+}
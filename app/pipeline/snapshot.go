@@ -0,0 +1,190 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+// SnapshotDir is where the context of every execution is persisted so single
+// steps can be debugged against it later, even after a restart.
+var SnapshotDir = filepath.Join("storage", "pipeline", "snapshots")
+
+// ErrDefinitionChanged is returned when a snapshot is resumed against a
+// pipeline definition that differs from the one that produced it.
+var ErrDefinitionChanged = errors.New("pipeline definition changed")
+
+// ContextSnapshot is the pipeline context as it was at the end of an execution.
+type ContextSnapshot struct {
+	ExecutionID    string                 `json:"execution_id"`
+	PipelineID     string                 `json:"pipeline_id"`
+	DefinitionHash string                 `json:"definition_hash,omitempty"`
+	StepHashes     map[string]string      `json:"step_hashes,omitempty"`
+	Steps          []SnapshotStep         `json:"steps,omitempty"`
+	UserInput      string                 `json:"user_input"`
+	StepOutputs    map[string]interface{} `json:"step_outputs"`
+	Data           map[string]interface{} `json:"data,omitempty"`
+	CreatedAt      string                 `json:"created_at"`
+}
+
+// SnapshotStep is a step of the execution, in run order, with the output it
+// wrote to the context.
+type SnapshotStep struct {
+	ID        string `json:"id"`
+	OutputKey string `json:"output_key,omitempty"`
+}
+
+func snapshotPath(executionID string) string {
+	return filepath.Join(SnapshotDir, filepath.Base(executionID)+".json")
+}
+
+// SaveContextSnapshot writes the context of an execution to disk, along with
+// the definition version of the pipeline that produced it.
+func SaveContextSnapshot(executionID string, p *pipeline_type.Pipeline) error {
+	if err := os.MkdirAll(SnapshotDir, 0755); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	snapshot := ContextSnapshot{
+		ExecutionID:    executionID,
+		PipelineID:     p.ID,
+		DefinitionHash: p.DefinitionHash(),
+		StepHashes:     p.StepDefinitionHashes(),
+		Steps:          snapshotSteps(p),
+		UserInput:      p.Context.GetUserInput(),
+		StepOutputs:    p.Context.StepOutputsCopy(),
+		Data:           p.Context.DataCopy(),
+		CreatedAt:      time.Now().UTC().Format(time.RFC3339),
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling context snapshot: %w", err)
+	}
+
+	if err := os.WriteFile(snapshotPath(executionID), data, 0644); err != nil {
+		return fmt.Errorf("failed to write context snapshot: %w", err)
+	}
+	return nil
+}
+
+// snapshotSteps lists the steps of p in the order ExecutePipeline runs them.
+// The order only depends on the dependencies between steps, so it is the same
+// with the outputs of the finished execution available.
+func snapshotSteps(p *pipeline_type.Pipeline) []SnapshotStep {
+	ordered, err := OrderSteps(p.Steps, p.Context.StepOutputsCopy())
+	if err != nil {
+		return nil
+	}
+	steps := make([]SnapshotStep, 0, len(ordered))
+	for _, s := range ordered {
+		steps = append(steps, SnapshotStep{ID: s.ID, OutputKey: s.StepOutputKey})
+	}
+	return steps
+}
+
+// LoadContextSnapshot reads the context snapshot of a previous execution.
+func LoadContextSnapshot(executionID string) (*ContextSnapshot, error) {
+	data, err := os.ReadFile(snapshotPath(executionID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no context snapshot for execution %s", executionID)
+		}
+		return nil, fmt.Errorf("failed to read context snapshot: %w", err)
+	}
+
+	var snapshot ContextSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("error decoding context snapshot: %w", err)
+	}
+	return &snapshot, nil
+}
+
+// RemoveContextSnapshot deletes the snapshot of an execution, if any.
+func RemoveContextSnapshot(executionID string) {
+	os.Remove(snapshotPath(executionID))
+}
+
+// Context rebuilds a pipeline context from the snapshot.
+func (s *ContextSnapshot) Context() *pipeline_type.Context {
+	c := pipeline_type.NewContext()
+	c.SetUserInput(s.UserInput)
+	for key, value := range s.StepOutputs {
+		// Spilled outputs stay on disk, only their reference is restored
+		if spilled, ok := pipeline_type.SpilledOutputFromMap(value); ok {
+			value = spilled
+		}
+		c.StepOutputs[key] = value
+	}
+	for key, value := range s.Data {
+		c.Set(key, value)
+	}
+	return c
+}
+
+// AtStep returns the snapshot as the context was right after stepID ran: the
+// outputs of the steps that run later are dropped. Outputs no step produced,
+// such as the user input or a trigger payload, were there from the start.
+func (s *ContextSnapshot) AtStep(stepID string) (*ContextSnapshot, error) {
+	if len(s.Steps) == 0 {
+		return nil, fmt.Errorf("snapshot of execution %s has no step order", s.ExecutionID)
+	}
+
+	position := -1
+	for i, step := range s.Steps {
+		if step.ID == stepID {
+			position = i
+			break
+		}
+	}
+	if position < 0 {
+		return nil, fmt.Errorf("step %s not found in execution %s", stepID, s.ExecutionID)
+	}
+
+	at := *s
+	at.StepOutputs = make(map[string]interface{}, len(s.StepOutputs))
+	for key, value := range s.StepOutputs {
+		at.StepOutputs[key] = value
+	}
+	for _, step := range s.Steps[position+1:] {
+		if step.OutputKey != "" {
+			delete(at.StepOutputs, step.OutputKey)
+		}
+	}
+	return &at, nil
+}
+
+// CheckDefinition verifies that the snapshot can be resumed against p to run
+// stepID. The step being rerun may have been edited, that is the point of a
+// debugging rerun, but every other step must be the version that produced the
+// snapshot outputs. Snapshots from before versioning are not checked.
+func (s *ContextSnapshot) CheckDefinition(p *pipeline_type.Pipeline, stepID string) error {
+	if len(s.StepHashes) == 0 {
+		return nil
+	}
+
+	current := p.StepDefinitionHashes()
+	for id, hash := range s.StepHashes {
+		if id == stepID {
+			continue
+		}
+		currentHash, ok := current[id]
+		if !ok {
+			return fmt.Errorf("%w: step %s was removed since execution %s", ErrDefinitionChanged, id, s.ExecutionID)
+		}
+		if currentHash != hash {
+			return fmt.Errorf("%w: step %s was modified since execution %s", ErrDefinitionChanged, id, s.ExecutionID)
+		}
+	}
+	for id := range current {
+		if _, ok := s.StepHashes[id]; !ok && id != stepID {
+			return fmt.Errorf("%w: step %s was added since execution %s", ErrDefinitionChanged, id, s.ExecutionID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package pipeline
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+func TestMain(m *testing.M) {
+	// Executions write context snapshots, definitions and step durations and read assets,
+	// keep them out of the source tree
+	dir, err := os.MkdirTemp("", "snapshots")
+	if err != nil {
+		panic(err)
+	}
+	SnapshotDir = dir
+	AssetDir = filepath.Join(dir, "assets")
+	DefinitionDir = filepath.Join(dir, "definitions")
+	StepDurations = NewStepDurationStore(filepath.Join(dir, "step_durations.json"))
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestContextSnapshotRoundTrip(t *testing.T) {
+	c := pipeline_type.NewContext()
+	c.SetUserInput("topic")
+	c.SetStepOutput("user_input", "topic")
+	c.SetStepOutput("article", "Generated article")
+
+	p := &pipeline_type.Pipeline{ID: "pipeline-1", Context: c}
+	if err := SaveContextSnapshot("exec-snapshot", p); err != nil {
+		t.Fatalf("unexpected error saving snapshot: %v", err)
+	}
+
+	snapshot, err := LoadContextSnapshot("exec-snapshot")
+	if err != nil {
+		t.Fatalf("unexpected error loading snapshot: %v", err)
+	}
+	if snapshot.PipelineID != "pipeline-1" {
+		t.Errorf("expected pipeline ID 'pipeline-1', got %q", snapshot.PipelineID)
+	}
+
+	restored := snapshot.Context()
+	if restored.GetUserInput() != "topic" {
+		t.Errorf("expected user input 'topic', got %q", restored.GetUserInput())
+	}
+	if output, _ := restored.GetStepOutput("article"); output != "Generated article" {
+		t.Errorf("expected article output, got %v", output)
+	}
+
+	RemoveContextSnapshot("exec-snapshot")
+	if _, err := LoadContextSnapshot("exec-snapshot"); err == nil {
+		t.Error("expected error after removing snapshot")
+	}
+}
+
+func TestContextSnapshotCheckDefinition(t *testing.T) {
+	p := &pipeline_type.Pipeline{
+		ID: "pipeline-1",
+		Steps: []pipeline_type.PipelineStep{
+			{ID: "generate", Type: "llm_step", Prompt: "Write about {topic}", StepOutputKey: "article"},
+			{ID: "publish", Type: "action_step", RequiredSteps: "article"},
+		},
+		Context: pipeline_type.NewContext(),
+	}
+	if err := SaveContextSnapshot("exec-version", p); err != nil {
+		t.Fatalf("unexpected error saving snapshot: %v", err)
+	}
+	defer RemoveContextSnapshot("exec-version")
+
+	snapshot, err := LoadContextSnapshot("exec-version")
+	if err != nil {
+		t.Fatalf("unexpected error loading snapshot: %v", err)
+	}
+	if snapshot.DefinitionHash != p.DefinitionHash() {
+		t.Errorf("expected definition hash %s, got %s", p.DefinitionHash(), snapshot.DefinitionHash)
+	}
+
+	// Editing the step being rerun is allowed
+	p.Steps[1].RequiredSteps = "article\r\nimage"
+	if err := snapshot.CheckDefinition(p, "publish"); err != nil {
+		t.Errorf("unexpected error rerunning the edited step: %v", err)
+	}
+
+	// Editing an upstream step invalidates the snapshot outputs
+	p.Steps[0].Prompt = "Write a poem about {topic}"
+	if err := snapshot.CheckDefinition(p, "publish"); !errors.Is(err, ErrDefinitionChanged) {
+		t.Errorf("expected ErrDefinitionChanged, got %v", err)
+	}
+}
+
+func TestContextSnapshotAtStepRedacted(t *testing.T) {
+	c := pipeline_type.NewContext()
+	c.SetUserInput("topic")
+	c.SetStepOutput("user_input", "topic")
+	c.SetStepOutput("article", "Generated article")
+	c.SetStepOutput("publication", map[string]interface{}{"url": "https://example.com/1", "access_token": "abc"})
+	c.Set("api_key", "sk-123")
+
+	p := &pipeline_type.Pipeline{
+		ID: "pipeline-1",
+		Steps: []pipeline_type.PipelineStep{
+			{ID: "publish", Type: "action_step", RequiredSteps: "article", StepOutputKey: "publication"},
+			{ID: "generate", Type: "llm_step", StepOutputKey: "article"},
+		},
+		Context: c,
+	}
+	if err := SaveContextSnapshot("exec-at-step", p); err != nil {
+		t.Fatalf("unexpected error saving snapshot: %v", err)
+	}
+	defer RemoveContextSnapshot("exec-at-step")
+
+	snapshot, err := LoadContextSnapshot("exec-at-step")
+	if err != nil {
+		t.Fatalf("unexpected error loading snapshot: %v", err)
+	}
+
+	// generate runs first despite being listed last
+	at, err := snapshot.AtStep("generate")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := at.StepOutputs["publication"]; ok {
+		t.Error("expected outputs of later steps to be dropped")
+	}
+	if at.StepOutputs["article"] != "Generated article" || at.StepOutputs["user_input"] != "topic" {
+		t.Errorf("expected earlier outputs to be kept, got %v", at.StepOutputs)
+	}
+	if _, ok := snapshot.StepOutputs["publication"]; !ok {
+		t.Error("expected the loaded snapshot to be left untouched")
+	}
+
+	redacted, err := snapshot.AtStep("publish")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	redacted = redacted.Redacted()
+	publication := redacted.StepOutputs["publication"].(map[string]interface{})
+	if publication["access_token"] != RedactedValue || publication["url"] != "https://example.com/1" {
+		t.Errorf("expected only the token to be redacted, got %v", publication)
+	}
+	if redacted.Data["api_key"] != RedactedValue {
+		t.Errorf("expected api_key to be redacted, got %v", redacted.Data["api_key"])
+	}
+
+	if _, err := snapshot.AtStep("missing"); err == nil {
+		t.Error("expected error for an unknown step")
+	}
+}
@@ -0,0 +1,86 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// maxDurationSamples is the number of recent runs kept per step.
+const maxDurationSamples = 20
+
+// StepDurationStore keeps how long the last successful runs of each step
+// took, keyed by pipeline and step, to estimate the duration of future runs.
+type StepDurationStore struct {
+	sync.Mutex
+	path    string
+	samples map[string][]int64
+}
+
+// StepDurations is the duration store fed by the executor.
+var StepDurations = NewStepDurationStore(filepath.Join("storage", "pipeline", "step_durations.json"))
+
+// NewStepDurationStore creates a store persisted at path, loading the
+// previous samples.
+func NewStepDurationStore(path string) *StepDurationStore {
+	s := &StepDurationStore{path: path, samples: make(map[string][]int64)}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &s.samples); err != nil {
+			log.Printf("Error loading step durations from %s: %v", path, err)
+		}
+		if s.samples == nil {
+			s.samples = make(map[string][]int64)
+		}
+	}
+	return s
+}
+
+// Record adds the duration, in seconds, of a successful run of the step.
+func (s *StepDurationStore) Record(pipelineID, stepID string, seconds int64) {
+	s.Lock()
+	defer s.Unlock()
+	key := pipelineID + "/" + stepID
+	samples := append(s.samples[key], seconds)
+	if len(samples) > maxDurationSamples {
+		samples = samples[len(samples)-maxDurationSamples:]
+	}
+	s.samples[key] = samples
+	s.save()
+}
+
+// Range returns the shortest and longest of the recent durations of the
+// step, in seconds, and the number of samples.
+func (s *StepDurationStore) Range(pipelineID, stepID string) (int64, int64, int) {
+	s.Lock()
+	defer s.Unlock()
+	samples := s.samples[pipelineID+"/"+stepID]
+	if len(samples) == 0 {
+		return 0, 0, 0
+	}
+	shortest, longest := samples[0], samples[0]
+	for _, d := range samples[1:] {
+		shortest, longest = min(shortest, d), max(longest, d)
+	}
+	return shortest, longest, len(samples)
+}
+
+// save persists the samples. Callers must hold the lock.
+func (s *StepDurationStore) save() {
+	if s.path == "" {
+		return
+	}
+	data, err := json.Marshal(s.samples)
+	if err != nil {
+		log.Printf("Error marshaling step durations: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		log.Printf("Error creating step durations directory: %v", err)
+		return
+	}
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		log.Printf("Error saving step durations: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+// OrderSteps computes the execution order of the pipeline steps from their
+// RequiredSteps. A step runs only after every step producing one of its required
+// outputs; among ready steps the lowest Weight goes first, then the original
+// position. availableOutputs lists outputs already present in the context
+// before the first step runs (e.g. user_input).
+func OrderSteps(steps []pipeline_type.PipelineStep, availableOutputs map[string]interface{}) ([]pipeline_type.PipelineStep, error) {
+	producers := make(map[string]int, len(steps))
+	for i, s := range steps {
+		if s.StepOutputKey == "" {
+			continue
+		}
+		if other, exists := producers[s.StepOutputKey]; exists {
+			return nil, fmt.Errorf("pipeline validation failed: steps %s and %s both produce output '%s'",
+				steps[other].ID, s.ID, s.StepOutputKey)
+		}
+		producers[s.StepOutputKey] = i
+	}
+
+	dependents := make([][]int, len(steps))
+	pending := make([]int, len(steps))
+	var unsatisfied []string
+
+	for i, s := range steps {
+		seen := make(map[int]bool)
+		for _, key := range s.RequiredStepKeys() {
+			producer, ok := producers[key]
+			if !ok {
+				if _, available := availableOutputs[key]; !available {
+					unsatisfied = append(unsatisfied, fmt.Sprintf("step %s requires '%s'", s.ID, key))
+				}
+				continue
+			}
+			if producer == i {
+				return nil, fmt.Errorf("pipeline validation failed: step %s requires its own output '%s'", s.ID, key)
+			}
+			if seen[producer] {
+				continue
+			}
+			seen[producer] = true
+			dependents[producer] = append(dependents[producer], i)
+			pending[i]++
+		}
+	}
+
+	if len(unsatisfied) > 0 {
+		return nil, fmt.Errorf("pipeline validation failed: unsatisfiable dependencies, no step produces the required output (%s)",
+			strings.Join(unsatisfied, "; "))
+	}
+
+	less := func(a, b int) bool {
+		if steps[a].Weight != steps[b].Weight {
+			return steps[a].Weight < steps[b].Weight
+		}
+		return a < b
+	}
+
+	var ready []int
+	for i := range steps {
+		if pending[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	ordered := make([]pipeline_type.PipelineStep, 0, len(steps))
+	for len(ready) > 0 {
+		sort.Slice(ready, func(x, y int) bool { return less(ready[x], ready[y]) })
+		next := ready[0]
+		ready = ready[1:]
+		ordered = append(ordered, steps[next])
+
+		for _, dependent := range dependents[next] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	if len(ordered) != len(steps) {
+		var cycle []string
+		for i, s := range steps {
+			if pending[i] > 0 {
+				cycle = append(cycle, s.ID)
+			}
+		}
+		return nil, fmt.Errorf("pipeline validation failed: dependency cycle between steps %s", strings.Join(cycle, ", "))
+	}
+
+	return ordered, nil
+}
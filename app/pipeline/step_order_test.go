@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+func stepIDs(steps []pipeline_type.PipelineStep) string {
+	ids := make([]string, len(steps))
+	for i, s := range steps {
+		ids[i] = s.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestOrderStepsFollowsDependenciesAndWeight(t *testing.T) {
+	steps := []pipeline_type.PipelineStep{
+		{ID: "publish", StepOutputKey: "post", RequiredSteps: "article\r\nimage", Weight: 0},
+		{ID: "image", StepOutputKey: "image", RequiredSteps: "article", Weight: 5},
+		{ID: "article", StepOutputKey: "article", RequiredSteps: "user_input", Weight: 10},
+		{ID: "search", StepOutputKey: "search", Weight: 1},
+	}
+
+	ordered, err := OrderSteps(steps, map[string]interface{}{"user_input": "topic"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got, want := stepIDs(ordered), "search,article,image,publish"; got != want {
+		t.Errorf("expected order %s, got %s", want, got)
+	}
+}
+
+func TestOrderStepsDetectsCycle(t *testing.T) {
+	steps := []pipeline_type.PipelineStep{
+		{ID: "a", StepOutputKey: "a_out", RequiredSteps: "c_out"},
+		{ID: "b", StepOutputKey: "b_out", RequiredSteps: "a_out"},
+		{ID: "c", StepOutputKey: "c_out", RequiredSteps: "b_out"},
+		{ID: "d", StepOutputKey: "d_out"},
+	}
+
+	_, err := OrderSteps(steps, nil)
+	if err == nil {
+		t.Fatal("expected cycle error, got nil")
+	}
+	if !strings.Contains(err.Error(), "dependency cycle between steps a, b, c") {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
+
+func TestOrderStepsRejectsUnsatisfiableDependency(t *testing.T) {
+	steps := []pipeline_type.PipelineStep{
+		{ID: "summary", StepOutputKey: "summary", RequiredSteps: "missing_output"},
+	}
+
+	_, err := OrderSteps(steps, nil)
+	if err == nil {
+		t.Fatal("expected validation error, got nil")
+	}
+	if !strings.Contains(err.Error(), "step summary requires 'missing_output'") {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
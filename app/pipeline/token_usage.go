@@ -0,0 +1,47 @@
+package pipeline
+
+import "github.com/serisow/lesocle/pipeline_type"
+
+// TokenUsageResultKey is the key of the prompt and completion tokens in the
+// results of LLM steps.
+const TokenUsageResultKey = "token_usage"
+
+// SamplingResultKey is the key of the sampling parameters the LLM steps sent
+// in their results, to reproduce their runs.
+const SamplingResultKey = "sampling"
+
+// ToolTokenUsageResultKey is the key of the usage of the steps an LLM step
+// ran as tools, by tool step ID, in its result.
+const ToolTokenUsageResultKey = "tool_token_usage"
+
+// addTokenUsage copies the tokens the LLM calls of the step consumed to its
+// result, with their cost and sampling parameters. The cost includes the LLM
+// steps its model ran as tools.
+func addTokenUsage(c *pipeline_type.Context, pipelineStep pipeline_type.PipelineStep, stepResult map[string]interface{}) {
+	usage, ok := c.TokenUsage(pipelineStep.ID)
+	if !ok {
+		return
+	}
+	stepResult[TokenUsageResultKey] = usage
+	cost, priced := stepCost(usage)
+	tools := c.ToolTokenUsage(pipelineStep.ID)
+	if len(tools) > 0 {
+		stepResult[ToolTokenUsageResultKey] = tools
+	}
+	for _, toolUsage := range tools {
+		toolCost, toolPriced := stepCost(toolUsage)
+		if !toolPriced {
+			continue
+		}
+		if !priced {
+			cost, priced = StepCost{Model: usage.Model, Currency: toolCost.Currency}, true
+		}
+		cost.Amount = roundCost(cost.Amount + toolCost.Amount)
+	}
+	if priced {
+		stepResult[CostResultKey] = cost
+	}
+	if len(usage.Sampling) > 0 {
+		stepResult[SamplingResultKey] = usage.Sampling
+	}
+}
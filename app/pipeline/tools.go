@@ -0,0 +1,164 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/serisow/lesocle/llm_step"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/plugin_registry"
+)
+
+// toolOutputKey is the output key of the steps run for tool calls.
+const toolOutputKey = "tool_result"
+
+// toolRunner runs the tool calls of the LLM step llmStepID. The tool step
+// runs on a fork of the context that is dropped afterwards, but for its token
+// usage, the arguments being available to it as step outputs and as its
+// "{argument}" placeholders.
+func toolRunner(llmStepID string, registry *plugin_registry.PluginRegistry) llm_step.ToolRunner {
+	return func(ctx context.Context, tool pipeline_type.StepTool, arguments map[string]interface{}, c *pipeline_type.Context) (string, error) {
+		toolStep, err := toolStepFor(llmStepID, tool, arguments)
+		if err != nil {
+			return "", err
+		}
+		instance, err := registry.GetStepInstance(toolStep.Type)
+		if err != nil {
+			return "", fmt.Errorf("tool %s: %w", tool.Name, err)
+		}
+		if err := configureStep(instance, toolStep, registry); err != nil {
+			return "", fmt.Errorf("tool %s: %w", tool.Name, err)
+		}
+
+		fork := c.Fork()
+		for name, value := range arguments {
+			fork.SetStepOutput(name, argumentString(value))
+		}
+		err = instance.Execute(ctx, fork)
+		c.MergeTokenUsage(fork)
+		if err != nil {
+			return "", fmt.Errorf("tool %s: %w", tool.Name, err)
+		}
+		output, ok := fork.GetStepOutput(toolStep.StepOutputKey)
+		if !ok {
+			return "", nil
+		}
+		return argumentString(output), nil
+	}
+}
+
+// toolStepFor returns the step run for a call of the tool, with the
+// placeholders of its configuration replaced by the arguments.
+func toolStepFor(llmStepID string, tool pipeline_type.StepTool, arguments map[string]interface{}) (pipeline_type.PipelineStep, error) {
+	var toolStep pipeline_type.PipelineStep
+	switch {
+	case tool.Step != nil:
+		toolStep = *tool.Step
+	case tool.ActionService != "":
+		configuration, err := toolConfiguration(tool, arguments)
+		if err != nil {
+			return toolStep, err
+		}
+		toolStep = pipeline_type.PipelineStep{
+			Type: "action_step",
+			ActionDetails: &pipeline_type.ActionDetails{
+				ActionService:     tool.ActionService,
+				ExecutionLocation: "go",
+				Configuration:     configuration,
+			},
+		}
+	default:
+		return toolStep, fmt.Errorf("tool %s has neither a step nor an action service", tool.Name)
+	}
+	toolStep.ID = pipeline_type.ToolStepID(llmStepID, tool.Name)
+	if toolStep.StepOutputKey == "" {
+		toolStep.StepOutputKey = toolOutputKey
+	}
+
+	replacements := make([]string, 0, 2*len(arguments))
+	for name, value := range arguments {
+		replacements = append(replacements, "{"+name+"}", argumentString(value))
+	}
+	replacer := strings.NewReplacer(replacements...)
+	toolStep.Prompt = replacer.Replace(toolStep.Prompt)
+	toolStep.SearchInput = replacer.Replace(toolStep.SearchInput)
+	toolStep.ActionConfig = replacer.Replace(toolStep.ActionConfig)
+	if toolStep.GoogleSearchConfig != nil {
+		search := *toolStep.GoogleSearchConfig
+		search.Query = replacer.Replace(search.Query)
+		toolStep.GoogleSearchConfig = &search
+	}
+	if toolStep.NewsAPIConfig != nil {
+		news := *toolStep.NewsAPIConfig
+		news.Query = replacer.Replace(news.Query)
+		toolStep.NewsAPIConfig = &news
+	}
+	return toolStep, nil
+}
+
+// toolConfiguration is the configuration of the action service of the tool,
+// its static configuration with the allowed arguments of the call. The model
+// choosing the hosts, recipients or credentials of the action, the other
+// arguments are refused.
+func toolConfiguration(tool pipeline_type.StepTool, arguments map[string]interface{}) (map[string]interface{}, error) {
+	allowed := make(map[string]bool, len(tool.AllowedArguments))
+	for _, name := range tool.AllowedArguments {
+		allowed[name] = true
+	}
+	configuration := make(map[string]interface{}, len(tool.Configuration)+len(arguments))
+	for key, value := range tool.Configuration {
+		configuration[key] = value
+	}
+	for name, value := range arguments {
+		if !allowed[name] {
+			return nil, fmt.Errorf("tool %s doesn't accept the argument %s", tool.Name, name)
+		}
+		configuration[name] = value
+	}
+	return configuration, nil
+}
+
+// argumentString renders a value for a prompt, JSON unless it is a string.
+func argumentString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// validateTools checks the tools of a step can run.
+func validateTools(s pipeline_type.PipelineStep, registry *plugin_registry.PluginRegistry) error {
+	seen := make(map[string]bool, len(s.Tools))
+	for _, tool := range s.Tools {
+		if tool.Name == "" {
+			return fmt.Errorf("step %s: a tool has no name", s.ID)
+		}
+		if seen[tool.Name] {
+			return fmt.Errorf("step %s: duplicate tool %s", s.ID, tool.Name)
+		}
+		seen[tool.Name] = true
+		switch {
+		case tool.Step != nil && tool.ActionService != "":
+			return fmt.Errorf("step %s: tool %s has both a step and an action service", s.ID, tool.Name)
+		case tool.Step != nil && (tool.Configuration != nil || tool.AllowedArguments != nil):
+			return fmt.Errorf("step %s: tool %s runs a step, configure it in the step", s.ID, tool.Name)
+		case tool.Step != nil:
+			if _, err := registry.GetStepInstance(tool.Step.Type); err != nil {
+				return fmt.Errorf("step %s: tool %s: %w", s.ID, tool.Name, err)
+			}
+		case tool.ActionService != "":
+			if _, ok := registry.GetActionService(tool.ActionService); !ok {
+				return fmt.Errorf("step %s: tool %s: unknown action service %s", s.ID, tool.Name, tool.ActionService)
+			}
+		default:
+			return fmt.Errorf("step %s: tool %s has neither a step nor an action service", s.ID, tool.Name)
+		}
+	}
+	return nil
+}
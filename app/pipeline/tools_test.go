@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/serisow/lesocle/llm_step"
+	"github.com/serisow/lesocle/pipeline/step"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/plugin_registry"
+)
+
+func TestToolStepForActionService(t *testing.T) {
+	tool := pipeline_type.StepTool{
+		Name:             "notify",
+		ActionService:    "send_email",
+		Configuration:    map[string]interface{}{"smtp_host": "smtp.example.com", "to": "desk@example.com"},
+		AllowedArguments: []string{"subject", "body"},
+	}
+
+	toolStep, err := toolStepFor("write", tool, map[string]interface{}{"subject": "Draft ready", "body": "See the draft"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]interface{}{"smtp_host": "smtp.example.com", "to": "desk@example.com", "subject": "Draft ready", "body": "See the draft"}
+	if !reflect.DeepEqual(toolStep.ActionDetails.Configuration, want) {
+		t.Errorf("got configuration %v, want %v", toolStep.ActionDetails.Configuration, want)
+	}
+	if toolStep.ID != "write:notify" || toolStep.ActionDetails.ExecutionLocation != "go" {
+		t.Errorf("unexpected tool step %+v", toolStep)
+	}
+	// The static configuration is shared by the calls
+	if len(tool.Configuration) != 2 {
+		t.Errorf("the call changed the tool configuration: %v", tool.Configuration)
+	}
+
+	// The model can't pick the recipient
+	_, err = toolStepFor("write", tool, map[string]interface{}{"subject": "Hi", "to": "someone@example.net"})
+	if err == nil || !strings.Contains(err.Error(), "tool notify doesn't accept the argument to") {
+		t.Errorf("expected the argument refused, got %v", err)
+	}
+}
+
+func TestToolRunnerCountsToolTokens(t *testing.T) {
+	registry := plugin_registry.NewPluginRegistry()
+	registry.RegisterLLMService("hook_llm", &hookTestLLM{})
+	registry.RegisterStepType("llm_step", func() step.Step { return &llm_step.LLMStepImpl{} })
+
+	tool := pipeline_type.StepTool{
+		Name: "summarize",
+		Step: &pipeline_type.PipelineStep{
+			Type: "llm_step", Prompt: "summarize {topic}",
+			LLMServiceConfig: map[string]interface{}{"service_name": "hook_llm", "model_name": "gpt-4o-mini"},
+		},
+	}
+	c := pipeline_type.NewContext()
+	output, err := toolRunner("write", registry)(context.Background(), tool, map[string]interface{}{"topic": "rain"}, c)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if output != "ok: summarize rain" {
+		t.Errorf("unexpected output %q", output)
+	}
+	usage, ok := c.TokenUsage("write:summarize")
+	if !ok || usage.Requests != 1 || usage.Model != "gpt-4o-mini" {
+		t.Errorf("expected the tool usage on the context, got %+v", usage)
+	}
+	if _, ok := c.GetStepOutput(toolOutputKey); ok {
+		t.Error("the outputs of the tool step should stay in its fork")
+	}
+
+	invalid := pipeline_type.PipelineStep{ID: "write", Tools: []pipeline_type.StepTool{{
+		Name: "summarize", Step: tool.Step, AllowedArguments: []string{"topic"},
+	}}}
+	if err := validateTools(invalid, registry); err == nil {
+		t.Error("expected allowed arguments on a step tool refused")
+	}
+}
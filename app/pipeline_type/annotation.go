@@ -0,0 +1,69 @@
+package pipeline_type
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// Annotation kinds.
+const (
+	AnnotationNote       = "note"
+	AnnotationWarning    = "warning"
+	AnnotationConfidence = "confidence"
+	AnnotationSource     = "source"
+)
+
+// Annotation is a note a step leaves for the person reviewing the execution,
+// e.g. how confident a model was, the sources it considered or a warning.
+type Annotation struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message,omitempty"`
+	// Confidence is between 0 and 1, for confidence annotations
+	Confidence float64  `json:"confidence,omitempty"`
+	Sources    []string `json:"sources,omitempty"`
+}
+
+// annotationBlock matches a trailing ```annotations fenced block holding a
+// JSON array of annotations.
+var annotationBlock = regexp.MustCompile("(?s)\\n?```annotations\\s*\\n(.*?)\\n?```\\s*$")
+
+// ExtractAnnotations splits the annotations a model was asked to append to its
+// answer, as a trailing ```annotations block, from the answer itself. Text
+// without a valid block is returned unchanged.
+func ExtractAnnotations(text string) (string, []Annotation) {
+	match := annotationBlock.FindStringSubmatchIndex(text)
+	if match == nil {
+		return text, nil
+	}
+	var annotations []Annotation
+	if err := json.Unmarshal([]byte(text[match[2]:match[3]]), &annotations); err != nil {
+		return text, nil
+	}
+	for i := range annotations {
+		if annotations[i].Kind == "" {
+			annotations[i].Kind = AnnotationNote
+		}
+	}
+	return strings.TrimRightFunc(text[:match[0]], func(r rune) bool { return r == ' ' || r == '\n' || r == '\r' }), annotations
+}
+
+// Annotate attaches annotations to the step.
+func (c *Context) Annotate(stepID string, annotations ...Annotation) {
+	if len(annotations) == 0 {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.annotations == nil {
+		c.annotations = make(map[string][]Annotation)
+	}
+	c.annotations[stepID] = append(c.annotations[stepID], annotations...)
+}
+
+// Annotations returns the annotations attached to the step.
+func (c *Context) Annotations(stepID string) []Annotation {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return append([]Annotation(nil), c.annotations[stepID]...)
+}
@@ -0,0 +1,39 @@
+package pipeline_type
+
+import "testing"
+
+func TestExtractAnnotations(t *testing.T) {
+	text := "The answer.\n\n```annotations\n[{\"kind\": \"confidence\", \"confidence\": 0.7}, {\"message\": \"Dates not checked\"}]\n```\n"
+	answer, annotations := ExtractAnnotations(text)
+	if answer != "The answer." {
+		t.Errorf("unexpected answer %q", answer)
+	}
+	if len(annotations) != 2 || annotations[0].Confidence != 0.7 || annotations[1].Kind != AnnotationNote {
+		t.Errorf("unexpected annotations %+v", annotations)
+	}
+
+	invalid := "The answer.\n```annotations\nnot json\n```"
+	if answer, annotations := ExtractAnnotations(invalid); answer != invalid || annotations != nil {
+		t.Errorf("invalid block should be kept, got %q %+v", answer, annotations)
+	}
+}
+
+func TestAnnotationsMergedFromForks(t *testing.T) {
+	c := NewContext()
+	c.Annotate("step_1", Annotation{Kind: AnnotationWarning, Message: "first"})
+
+	fork := c.Fork()
+	fork.Annotate("step_2", Annotation{Kind: AnnotationNote, Message: "parallel"})
+	if len(c.Annotations("step_2")) != 0 {
+		t.Fatal("fork annotations should stay in the fork until merged")
+	}
+	if err := c.Merge(fork); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Annotations("step_2"); len(got) != 1 || got[0].Message != "parallel" {
+		t.Errorf("unexpected merged annotations %+v", got)
+	}
+	if got := c.Annotations("step_1"); len(got) != 1 {
+		t.Errorf("unexpected annotations %+v", got)
+	}
+}
@@ -1,10 +1,37 @@
 package pipeline_type
 
+import (
+    "errors"
+    "fmt"
+    "log"
+    "sort"
+    "strings"
+    "sync"
+)
+
+// ErrContextConflict is returned by Merge when parallel steps wrote the same key.
+var ErrContextConflict = errors.New("conflicting context writes")
+
+// Context is shared by the steps of an execution. Its methods are safe for
+// concurrent use; steps running in parallel should each work on a Fork so they
+// see a stable snapshot and their writes can be checked for conflicts.
 type Context struct {
+    mutex sync.RWMutex
     Data map[string]interface{}
     StepOutputs map[string]interface{}
     UserInput   string
     Steps       []PipelineStep  // Added to track all pipeline steps
+    // ContentFilter is the brand-safety configuration of the pipeline
+    ContentFilter *ContentFilterConfig
+    // Sandbox makes the action steps simulate their side effects
+    Sandbox bool
+
+    // Set on forks, the keys written since the fork ("data:" or "output:" prefixed)
+    written map[string]struct{}
+    // Notes for the reviewer by step ID
+    annotations map[string][]Annotation
+    // Tokens of the LLM calls by step ID
+    tokenUsage map[string]TokenUsage
 }
 
 func NewContext() *Context {
@@ -16,38 +43,108 @@ func NewContext() *Context {
 }
 
 func (c *Context) Set(key string, value interface{}) {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
     c.Data[key] = value
+    c.recordWrite("data:" + key)
 }
 
 func (c *Context) Get(key string) (interface{}, bool) {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
     val, ok := c.Data[key]
     return val, ok
 }
 
+// SetStepOutput stores a step output. String outputs larger than SpillThreshold
+// are written to disk and only a SpilledOutput reference is kept in memory.
 func (c *Context) SetStepOutput(key string, value interface{}) {
+    if s, ok := value.(string); ok && SpillThreshold > 0 && len(s) > SpillThreshold {
+        spilled, err := spillOutput(key, s)
+        if err == nil {
+            value = spilled
+        } else {
+            log.Printf("Keeping output %s in memory: %v", key, err)
+        }
+    }
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
     c.StepOutputs[key] = value
+    c.recordWrite("output:" + key)
 }
 
+// GetStepOutput returns a step output, loading spilled outputs back from disk.
 func (c *Context) GetStepOutput(key string) (interface{}, bool) {
+    val, ok := c.GetRawStepOutput(key)
+    if spilled, isSpilled := val.(SpilledOutput); isSpilled {
+        full, err := spilled.Load()
+        if err != nil {
+            log.Printf("Error reading output %s: %v", key, err)
+            return nil, false
+        }
+        return full, true
+    }
+    return val, ok
+}
+
+// GetRawStepOutput returns a step output as stored, i.e. the SpilledOutput
+// reference instead of the full value for spilled outputs.
+func (c *Context) GetRawStepOutput(key string) (interface{}, bool) {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
     val, ok := c.StepOutputs[key]
     return val, ok
 }
 
+// StepOutputsCopy returns a copy of the step outputs as stored.
+func (c *Context) StepOutputsCopy() map[string]interface{} {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
+    return copyMap(c.StepOutputs)
+}
+
+// DataCopy returns a copy of the context data.
+func (c *Context) DataCopy() map[string]interface{} {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
+    return copyMap(c.Data)
+}
+
+// StepOutputKeys returns the keys of the step outputs, sorted.
+func (c *Context) StepOutputKeys() []string {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
+    keys := make([]string, 0, len(c.StepOutputs))
+    for key := range c.StepOutputs {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    return keys
+}
+
 func (c *Context) SetUserInput(input string) {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
     c.UserInput = input
 }
 
 func (c *Context) GetUserInput() string {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
     return c.UserInput
 }
 
 // SetSteps sets all the pipeline steps, useful for looking up by output type
 func (c *Context) SetSteps(steps []PipelineStep) {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
     c.Steps = steps
 }
 
 // GetStepByOutputKey finds a pipeline step by its StepOutputKey
 func (c *Context) GetStepByOutputKey(outputKey string) (PipelineStep, bool) {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
     for _, step := range c.Steps {
         if step.StepOutputKey == outputKey {
             return step, true
@@ -58,6 +155,8 @@ func (c *Context) GetStepByOutputKey(outputKey string) (PipelineStep, bool) {
 
 // GetStepsByOutputType finds all pipeline steps with a specific OutputType
 func (c *Context) GetStepsByOutputType(outputType string) []PipelineStep {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
     var matchingSteps []PipelineStep
     for _, step := range c.Steps {
         if step.OutputType == outputType {
@@ -65,4 +164,84 @@ func (c *Context) GetStepsByOutputType(outputType string) []PipelineStep {
         }
     }
     return matchingSteps
-}
\ No newline at end of file
+}
+
+// Fork returns a snapshot of the context for a step running in parallel with
+// others. The fork doesn't see later writes to the context and its own writes
+// stay in the fork until Merge.
+func (c *Context) Fork() *Context {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
+    return &Context{
+        Data:          copyMap(c.Data),
+        StepOutputs:   copyMap(c.StepOutputs),
+        UserInput:     c.UserInput,
+        Steps:         c.Steps,
+        ContentFilter: c.ContentFilter,
+        Sandbox:       c.Sandbox,
+        written:       make(map[string]struct{}),
+    }
+}
+
+// Merge applies the writes of forks to the context. When two forks wrote the
+// same key nothing is applied and the error wraps ErrContextConflict.
+func (c *Context) Merge(forks ...*Context) error {
+    writers := make(map[string]int)
+    var conflicts []string
+    for i, fork := range forks {
+        fork.mutex.RLock()
+        for key := range fork.written {
+            if _, seen := writers[key]; seen {
+                conflicts = append(conflicts, key)
+            }
+            writers[key] = i
+        }
+        fork.mutex.RUnlock()
+    }
+    if len(conflicts) > 0 {
+        sort.Strings(conflicts)
+        return fmt.Errorf("%w: %s", ErrContextConflict, strings.Join(conflicts, ", "))
+    }
+
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+    // Steps annotate under their own ID, annotations and usage never conflict
+    for _, fork := range forks {
+        fork.mutex.RLock()
+        for stepID, annotations := range fork.annotations {
+            if c.annotations == nil {
+                c.annotations = make(map[string][]Annotation)
+            }
+            c.annotations[stepID] = append(c.annotations[stepID], annotations...)
+        }
+        c.mergeTokenUsage(fork)
+        fork.mutex.RUnlock()
+    }
+    for key, i := range writers {
+        fork := forks[i]
+        fork.mutex.RLock()
+        if name, ok := strings.CutPrefix(key, "output:"); ok {
+            c.StepOutputs[name] = fork.StepOutputs[name]
+        } else if name, ok := strings.CutPrefix(key, "data:"); ok {
+            c.Data[name] = fork.Data[name]
+        }
+        fork.mutex.RUnlock()
+        c.recordWrite(key)
+    }
+    return nil
+}
+
+// recordWrite tracks a write on forks. Callers must hold the lock.
+func (c *Context) recordWrite(key string) {
+    if c.written != nil {
+        c.written[key] = struct{}{}
+    }
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+    copied := make(map[string]interface{}, len(m))
+    for k, v := range m {
+        copied[k] = v
+    }
+    return copied
+}
@@ -0,0 +1,123 @@
+package pipeline_type
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestContextConcurrentAccess(t *testing.T) {
+	c := NewContext()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("step_%d", i)
+			c.SetStepOutput(key, i)
+			c.Set(key, i)
+			c.GetStepOutput(key)
+			c.StepOutputKeys()
+			c.StepOutputsCopy()
+			c.GetUserInput()
+		}(i)
+	}
+	wg.Wait()
+
+	if n := len(c.StepOutputKeys()); n != 20 {
+		t.Errorf("expected 20 outputs, got %d", n)
+	}
+}
+
+func TestForkIsolationAndMerge(t *testing.T) {
+	c := NewContext()
+	c.SetStepOutput("article", "draft")
+
+	a, b := c.Fork(), c.Fork()
+	a.SetStepOutput("image", "a.png")
+	b.SetStepOutput("audio", "b.mp3")
+	b.Set("voice", "alloy")
+
+	// Writes after the fork are not visible to it
+	c.SetStepOutput("article", "final")
+	if v, _ := a.GetStepOutput("article"); v != "draft" {
+		t.Errorf("fork should see the snapshot value, got %v", v)
+	}
+	if _, ok := c.GetStepOutput("image"); ok {
+		t.Error("fork writes should not be visible before merge")
+	}
+
+	if err := c.Merge(a, b); err != nil {
+		t.Fatalf("unexpected merge error: %v", err)
+	}
+	if v, _ := c.GetStepOutput("image"); v != "a.png" {
+		t.Errorf("expected merged image, got %v", v)
+	}
+	if v, _ := c.Get("voice"); v != "alloy" {
+		t.Errorf("expected merged data, got %v", v)
+	}
+	// Keys only read by the forks keep their latest value
+	if v, _ := c.GetStepOutput("article"); v != "final" {
+		t.Errorf("merge should not overwrite unwritten keys, got %v", v)
+	}
+}
+
+func TestMergeDetectsConflicts(t *testing.T) {
+	c := NewContext()
+	a, b := c.Fork(), c.Fork()
+	a.SetStepOutput("summary", "from a")
+	b.SetStepOutput("summary", "from b")
+	b.SetStepOutput("other", "b only")
+
+	err := c.Merge(a, b)
+	if !errors.Is(err, ErrContextConflict) {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+	if _, ok := c.GetStepOutput("other"); ok {
+		t.Error("nothing should be merged on conflict")
+	}
+}
+
+func TestConcurrentForks(t *testing.T) {
+	c := NewContext()
+	forks := make([]*Context, 10)
+	var wg sync.WaitGroup
+	for i := range forks {
+		forks[i] = c.Fork()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			forks[i].SetStepOutput(fmt.Sprintf("item_%d", i), i)
+			c.GetStepOutput("item_0")
+		}(i)
+	}
+	wg.Wait()
+	if err := c.Merge(forks...); err != nil {
+		t.Fatalf("unexpected merge error: %v", err)
+	}
+	if n := len(c.StepOutputKeys()); n != 10 {
+		t.Errorf("expected 10 outputs, got %d", n)
+	}
+}
+
+func TestMergeTokenUsageLeavesOutputs(t *testing.T) {
+	c := NewContext()
+	c.RecordTokenUsage("post", TokenUsage{Model: "gpt-4o", Requests: 1, PromptTokens: 10})
+
+	en, fr := c.Fork(), c.Fork()
+	en.RecordTokenUsage("post", TokenUsage{Model: "gpt-4o", Requests: 1, PromptTokens: 20, CompletionTokens: 5})
+	fr.RecordTokenUsage("post", TokenUsage{Model: "gpt-4o", Requests: 2, PromptTokens: 30, CompletionTokens: 7})
+	// The forks write the same output, only their usage is merged
+	en.SetStepOutput("post", "Hello")
+	fr.SetStepOutput("post", "Bonjour")
+	c.MergeTokenUsage(en, fr)
+
+	usage, _ := c.TokenUsage("post")
+	if usage.Requests != 4 || usage.PromptTokens != 60 || usage.CompletionTokens != 12 {
+		t.Errorf("unexpected merged usage %+v", usage)
+	}
+	if _, ok := c.GetStepOutput("post"); ok {
+		t.Error("outputs of the forks should not be merged")
+	}
+}
@@ -0,0 +1,193 @@
+package pipeline_type
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrStepOutputNotFound is returned by the typed getters when the context has
+// no output for the key.
+var ErrStepOutputNotFound = errors.New("step output not found")
+
+// FileInfo describes a file produced by a step, as output by the upload and
+// media generation steps.
+type FileInfo struct {
+	FileID    int64  `json:"file_id,omitempty"`
+	URI       string `json:"uri"`
+	URL       string `json:"url,omitempty"`
+	MimeType  string `json:"mime_type"`
+	Filename  string `json:"filename,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+	SHA256    string `json:"sha256,omitempty"`
+	// Voice of the generated audio files
+	Voice *AudioVoice `json:"voice,omitempty"`
+}
+
+// AudioVoice describes the voice a text-to-speech step used.
+type AudioVoice struct {
+	Provider string                 `json:"provider"`
+	ID       string                 `json:"id"`
+	Name     string                 `json:"name,omitempty"`
+	Model    string                 `json:"model,omitempty"`
+	Language string                 `json:"language,omitempty"`
+	Settings map[string]interface{} `json:"settings,omitempty"`
+}
+
+// GetString returns a step output as text. Strings are returned as is,
+// structured values are encoded as JSON.
+func (c *Context) GetString(key string) (string, error) {
+	val, ok := c.GetStepOutput(key)
+	if !ok || val == nil {
+		return "", fmt.Errorf("%w: %s", ErrStepOutputNotFound, key)
+	}
+	switch v := val.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case fmt.Stringer:
+		return v.String(), nil
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("error encoding step output %s: %w", key, err)
+		}
+		return string(data), nil
+	}
+	return fmt.Sprintf("%v", val), nil
+}
+
+// GetJSON decodes a step output into v. Text outputs may be wrapped in a
+// markdown code block, as LLMs often do.
+func (c *Context) GetJSON(key string, v interface{}) error {
+	val, ok := c.GetStepOutput(key)
+	if !ok || val == nil {
+		return fmt.Errorf("%w: %s", ErrStepOutputNotFound, key)
+	}
+
+	var data []byte
+	switch raw := val.(type) {
+	case string:
+		data = []byte(StripCodeFence(raw))
+	case []byte:
+		data = []byte(StripCodeFence(string(raw)))
+	default:
+		encoded, err := json.Marshal(raw)
+		if err != nil {
+			return fmt.Errorf("error encoding step output %s: %w", key, err)
+		}
+		data = encoded
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("step output %s is not valid JSON for %T: %w", key, v, err)
+	}
+	return nil
+}
+
+// GetPath walks a dotted path: the first segment is a step output key, the
+// next ones are object keys or list indexes. Outputs holding JSON text, as LLM
+// steps produce, are decoded first.
+func (c *Context) GetPath(path string) (interface{}, bool) {
+	segments := strings.Split(path, ".")
+	var value interface{}
+	if err := c.GetJSON(segments[0], &value); err != nil {
+		if errors.Is(err, ErrStepOutputNotFound) || len(segments) > 1 {
+			return nil, false
+		}
+		text, err := c.GetString(segments[0])
+		return text, err == nil
+	}
+	return WalkPath(value, segments[1:])
+}
+
+// WalkPath follows the object keys and list indexes of the segments in a
+// decoded JSON value.
+func WalkPath(value interface{}, segments []string) (interface{}, bool) {
+	for _, segment := range segments {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			next, ok := v[segment]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, false
+			}
+			value = v[index]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// GetFileInfo decodes a step output describing a single file.
+func (c *Context) GetFileInfo(key string) (FileInfo, error) {
+	var info FileInfo
+	if err := c.GetJSON(key, &info); err != nil {
+		return FileInfo{}, err
+	}
+	if info.URI == "" && info.URL == "" {
+		return FileInfo{}, fmt.Errorf("step output %s is not a file: no uri or url", key)
+	}
+	return info, nil
+}
+
+// GetFileList decodes a step output describing files: a list of files, an
+// object with a "files" list, or a single file.
+func (c *Context) GetFileList(key string) ([]FileInfo, error) {
+	var raw json.RawMessage
+	if err := c.GetJSON(key, &raw); err != nil {
+		return nil, err
+	}
+
+	var files []FileInfo
+	if err := json.Unmarshal(raw, &files); err != nil {
+		var wrapper struct {
+			Files []FileInfo `json:"files"`
+		}
+		if err := json.Unmarshal(raw, &wrapper); err != nil {
+			return nil, fmt.Errorf("step output %s is not a file list: %w", key, err)
+		}
+		files = wrapper.Files
+		if files == nil {
+			info, err := c.GetFileInfo(key)
+			if err != nil {
+				return nil, err
+			}
+			files = []FileInfo{info}
+		}
+	}
+
+	for i, f := range files {
+		if f.URI == "" && f.URL == "" {
+			return nil, fmt.Errorf("file %d of step output %s has no uri or url", i, key)
+		}
+	}
+	return files, nil
+}
+
+// StripCodeFence removes the markdown code block wrapping an LLM answer, e.g.
+// "```json ... ```".
+func StripCodeFence(s string) string {
+	trimmed := strings.TrimSpace(s)
+	if !strings.HasPrefix(trimmed, "```") {
+		return s
+	}
+	trimmed = strings.TrimPrefix(trimmed, "```")
+	// Drop the language tag
+	if i := strings.IndexByte(trimmed, '\n'); i >= 0 && !strings.ContainsAny(trimmed[:i], "{[\"") {
+		trimmed = trimmed[i+1:]
+	} else {
+		trimmed = strings.TrimPrefix(trimmed, "json")
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(trimmed), "```"))
+}
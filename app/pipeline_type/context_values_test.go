@@ -0,0 +1,91 @@
+package pipeline_type
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGetString(t *testing.T) {
+	c := NewContext()
+	c.SetStepOutput("text", "hello")
+	c.SetStepOutput("map", map[string]interface{}{"a": 1})
+	c.SetStepOutput("number", 42)
+
+	tests := map[string]string{"text": "hello", "map": `{"a":1}`, "number": "42"}
+	for key, want := range tests {
+		if got, err := c.GetString(key); err != nil || got != want {
+			t.Errorf("GetString(%s) = %q, %v, want %q", key, got, err, want)
+		}
+	}
+	if _, err := c.GetString("missing"); !errors.Is(err, ErrStepOutputNotFound) {
+		t.Errorf("expected ErrStepOutputNotFound, got %v", err)
+	}
+}
+
+func TestGetJSON(t *testing.T) {
+	c := NewContext()
+	c.SetStepOutput("fenced", "```json\n{\"message\": \"hi\"}\n```")
+	c.SetStepOutput("map", map[string]interface{}{"message": "from map"})
+	c.SetStepOutput("prose", "Sure! Here is your SMS.")
+
+	var sms struct {
+		Message string `json:"message"`
+	}
+	if err := c.GetJSON("fenced", &sms); err != nil || sms.Message != "hi" {
+		t.Errorf("fenced: got %+v, %v", sms, err)
+	}
+	if err := c.GetJSON("map", &sms); err != nil || sms.Message != "from map" {
+		t.Errorf("map: got %+v, %v", sms, err)
+	}
+	if err := c.GetJSON("prose", &sms); err == nil {
+		t.Error("expected an error for a non-JSON output")
+	}
+}
+
+func TestGetFileInfoAndList(t *testing.T) {
+	c := NewContext()
+	c.SetStepOutput("image", `{"uri":"storage/img.png","mime_type":"image/png"}`)
+	c.SetStepOutput("list", `[{"uri":"a.mp3","mime_type":"audio/mpeg"},{"uri":"b.mp3","mime_type":"audio/mpeg"}]`)
+	c.SetStepOutput("wrapped", map[string]interface{}{"files": []interface{}{map[string]interface{}{"url": "https://x/y.png"}}})
+	c.SetStepOutput("text", `{"text":"not a file"}`)
+
+	if info, err := c.GetFileInfo("image"); err != nil || info.URI != "storage/img.png" {
+		t.Errorf("GetFileInfo(image) = %+v, %v", info, err)
+	}
+	if _, err := c.GetFileInfo("text"); err == nil {
+		t.Error("expected an error for an output without uri or url")
+	}
+
+	for key, want := range map[string]int{"image": 1, "list": 2, "wrapped": 1} {
+		files, err := c.GetFileList(key)
+		if err != nil || len(files) != want {
+			t.Errorf("GetFileList(%s) = %d files, %v, want %d", key, len(files), err, want)
+		}
+	}
+	if _, err := c.GetFileList("text"); err == nil {
+		t.Error("expected an error for an output that isn't a file list")
+	}
+}
+
+func TestGetPath(t *testing.T) {
+	c := NewContext()
+	c.SetStepOutput("article", "```json\n{\"title\": \"Hi\", \"tags\": [\"a\", \"b\"], \"meta\": {\"words\": 120}}\n```")
+	c.SetStepOutput("prose", "plain text")
+
+	tests := map[string]interface{}{
+		"article.title":      "Hi",
+		"article.tags.1":     "b",
+		"article.meta.words": float64(120),
+		"prose":              "plain text",
+	}
+	for path, want := range tests {
+		if got, ok := c.GetPath(path); !ok || got != want {
+			t.Errorf("GetPath(%s) = %v, %v, want %v", path, got, ok, want)
+		}
+	}
+	for _, path := range []string{"missing", "article.body", "article.tags.2", "prose.title"} {
+		if got, ok := c.GetPath(path); ok {
+			t.Errorf("GetPath(%s) = %v, want not found", path, got)
+		}
+	}
+}
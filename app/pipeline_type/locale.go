@@ -0,0 +1,32 @@
+package pipeline_type
+
+// LocaleOutputKey is the output holding the locale a step runs for, usable as
+// the {locale} placeholder by listing it in the required steps.
+const LocaleOutputKey = "locale"
+
+// LocaleAccountsKey is the action configuration entry holding, by locale, the
+// settings (page, account, credentials...) replacing the default ones when
+// the action runs for that locale.
+const LocaleAccountsKey = "locale_accounts"
+
+// LocalizedKey is the output key of the variant of an output for a locale.
+func LocalizedKey(key, locale string) string {
+	return key + "@" + locale
+}
+
+// LocalizedConfiguration returns the action configuration for the locale,
+// the entries of its locale_accounts overriding the default ones.
+func LocalizedConfiguration(config map[string]interface{}, locale string) map[string]interface{} {
+	localized := make(map[string]interface{}, len(config))
+	for k, v := range config {
+		if k != LocaleAccountsKey {
+			localized[k] = v
+		}
+	}
+	accounts, _ := config[LocaleAccountsKey].(map[string]interface{})
+	overrides, _ := accounts[locale].(map[string]interface{})
+	for k, v := range overrides {
+		localized[k] = v
+	}
+	return localized
+}
@@ -0,0 +1,103 @@
+package pipeline_type
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+	"unicode/utf8"
+
+	"github.com/serisow/lesocle/signedurl"
+)
+
+var (
+	// SpillThreshold is the size in bytes above which string step outputs are
+	// written to disk instead of being kept in memory. Zero disables spillover.
+	SpillThreshold = 0
+	// SpillDir is where spilled step outputs are stored.
+	SpillDir = filepath.Join("storage", "pipeline", "outputs")
+	// SpillBaseURL is prefixed to the download path of spilled outputs, if set.
+	SpillBaseURL = ""
+)
+
+const spillPreviewLength = 200
+
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// SpilledOutput is the reference kept in the context, and sent to Drupal, in
+// place of a step output too large to be held inline. The context loads the
+// full value back transparently on GetStepOutput.
+type SpilledOutput struct {
+	Spilled  bool   `json:"spilled"`
+	Filename string `json:"filename"`
+	URL      string `json:"url,omitempty"`
+	Size     int    `json:"size"`
+	Preview  string `json:"preview"`
+}
+
+// Path returns the location of the spilled output on disk.
+func (o SpilledOutput) Path() string {
+	return filepath.Join(SpillDir, filepath.Base(o.Filename))
+}
+
+// Load reads the full output back from disk.
+func (o SpilledOutput) Load() (string, error) {
+	data, err := os.ReadFile(o.Path())
+	if err != nil {
+		return "", fmt.Errorf("failed to load spilled output %s: %w", o.Filename, err)
+	}
+	return string(data), nil
+}
+
+// SpilledOutputFromMap recognizes a SpilledOutput that went through a JSON
+// round trip, e.g. in a context snapshot.
+func SpilledOutputFromMap(value interface{}) (SpilledOutput, bool) {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return SpilledOutput{}, false
+	}
+	spilled, _ := m["spilled"].(bool)
+	filename, _ := m["filename"].(string)
+	if !spilled || filename == "" {
+		return SpilledOutput{}, false
+	}
+	o := SpilledOutput{Spilled: true, Filename: filename}
+	o.URL, _ = m["url"].(string)
+	o.Preview, _ = m["preview"].(string)
+	if size, ok := m["size"].(float64); ok {
+		o.Size = int(size)
+	}
+	return o, true
+}
+
+// spillOutput writes a large output to disk and returns its reference.
+func spillOutput(key, value string) (SpilledOutput, error) {
+	if err := os.MkdirAll(SpillDir, 0755); err != nil {
+		return SpilledOutput{}, fmt.Errorf("failed to create spill directory: %w", err)
+	}
+
+	filename := fmt.Sprintf("%d_%s.txt", time.Now().UnixNano(), unsafeFilenameChars.ReplaceAllString(key, "_"))
+	o := SpilledOutput{
+		Spilled:  true,
+		Filename: filename,
+		Size:     len(value),
+		Preview:  value,
+	}
+	if len(o.Preview) > spillPreviewLength {
+		// Cut on a character boundary so the preview stays valid UTF-8
+		cut := spillPreviewLength
+		for cut > 0 && !utf8.RuneStart(value[cut]) {
+			cut--
+		}
+		o.Preview = value[:cut]
+	}
+	if SpillBaseURL != "" {
+		o.URL = signedurl.Sign(fmt.Sprintf("%s/api/outputs/%s", SpillBaseURL, filename))
+	}
+
+	if err := os.WriteFile(o.Path(), []byte(value), 0644); err != nil {
+		return SpilledOutput{}, fmt.Errorf("failed to write spilled output: %w", err)
+	}
+	return o, nil
+}
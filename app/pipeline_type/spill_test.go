@@ -0,0 +1,57 @@
+package pipeline_type
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestLargeOutputsAreSpilledToDisk(t *testing.T) {
+	SpillThreshold = 100
+	SpillDir = t.TempDir()
+	defer func() { SpillThreshold = 0 }()
+
+	c := NewContext()
+	article := strings.Repeat("a long article body ", 50)
+	c.SetStepOutput("article", article)
+	c.SetStepOutput("title", "Short title")
+
+	raw, _ := c.GetRawStepOutput("article")
+	spilled, ok := raw.(SpilledOutput)
+	if !ok {
+		t.Fatalf("expected SpilledOutput reference, got %T", raw)
+	}
+	if spilled.Size != len(article) || len(spilled.Preview) != spillPreviewLength {
+		t.Errorf("unexpected reference: %+v", spilled)
+	}
+
+	if output, _ := c.GetStepOutput("article"); output != article {
+		t.Error("expected the full article to be loaded back from disk")
+	}
+	if raw, _ := c.GetRawStepOutput("title"); raw != "Short title" {
+		t.Errorf("expected short output to stay inline, got %v", raw)
+	}
+
+	// References survive a JSON round trip, e.g. through a context snapshot
+	data, _ := json.Marshal(spilled)
+	var decoded interface{}
+	json.Unmarshal(data, &decoded)
+	if restored, ok := SpilledOutputFromMap(decoded); !ok || restored.Filename != spilled.Filename {
+		t.Errorf("expected reference to be restored, got %+v", restored)
+	}
+}
+
+func TestSpillPreviewKeepsCharactersWhole(t *testing.T) {
+	SpillDir = t.TempDir()
+
+	// "é" is two bytes, the limit falls in the middle of one
+	value := "a" + strings.Repeat("é", spillPreviewLength)
+	spilled, err := spillOutput("article", value)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !utf8.ValidString(spilled.Preview) || len(spilled.Preview) != spillPreviewLength-1 {
+		t.Errorf("expected a valid preview of %d bytes, got %d bytes %q", spillPreviewLength-1, len(spilled.Preview), spilled.Preview)
+	}
+}
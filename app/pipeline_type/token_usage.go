@@ -0,0 +1,97 @@
+package pipeline_type
+
+import "strings"
+
+// TokenUsage is what the LLM calls of a step consumed.
+type TokenUsage struct {
+	Model            string `json:"model,omitempty"`
+	Requests         int    `json:"requests"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	// Tokenizer is the encoding the tokens were counted with, "heuristic"
+	// for estimates
+	Tokenizer string `json:"tokenizer"`
+	// Truncated is set when the prompt was cut to its token budget
+	Truncated bool `json:"truncated,omitempty"`
+	// Sampling are the sampling parameters sent, reported apart from the
+	// usage in the step result
+	Sampling map[string]interface{} `json:"-"`
+}
+
+// ToolStepID is the ID of the step run for the calls of a tool by the model
+// of the LLM step stepID.
+func ToolStepID(stepID, tool string) string {
+	return stepID + ":" + tool
+}
+
+// RecordTokenUsage adds the usage of an LLM call of the step.
+func (c *Context) RecordTokenUsage(stepID string, usage TokenUsage) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.tokenUsage == nil {
+		c.tokenUsage = make(map[string]TokenUsage)
+	}
+	c.tokenUsage[stepID] = addTokenUsage(c.tokenUsage[stepID], usage)
+}
+
+// TokenUsage returns the usage of the LLM calls of the step.
+func (c *Context) TokenUsage(stepID string) (TokenUsage, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	usage, ok := c.tokenUsage[stepID]
+	return usage, ok
+}
+
+// MergeTokenUsage adds the usage recorded on forks to the context, without
+// their other writes, for steps whose fork is dropped once they ran.
+func (c *Context) MergeTokenUsage(forks ...*Context) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, fork := range forks {
+		fork.mutex.RLock()
+		c.mergeTokenUsage(fork)
+		fork.mutex.RUnlock()
+	}
+}
+
+// mergeTokenUsage adds the usage of the fork. Callers must hold the lock of
+// the context and the read lock of the fork.
+func (c *Context) mergeTokenUsage(fork *Context) {
+	for stepID, usage := range fork.tokenUsage {
+		if c.tokenUsage == nil {
+			c.tokenUsage = make(map[string]TokenUsage)
+		}
+		c.tokenUsage[stepID] = addTokenUsage(c.tokenUsage[stepID], usage)
+	}
+}
+
+// ToolTokenUsage returns the usage of the steps the model of the LLM step
+// ran as tools, by tool step ID.
+func (c *Context) ToolTokenUsage(stepID string) map[string]TokenUsage {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	prefix := ToolStepID(stepID, "")
+	var usages map[string]TokenUsage
+	for id, usage := range c.tokenUsage {
+		if strings.HasPrefix(id, prefix) {
+			if usages == nil {
+				usages = make(map[string]TokenUsage)
+			}
+			usages[id] = usage
+		}
+	}
+	return usages
+}
+
+func addTokenUsage(total, usage TokenUsage) TokenUsage {
+	total.Model = usage.Model
+	total.Requests += usage.Requests
+	total.PromptTokens += usage.PromptTokens
+	total.CompletionTokens += usage.CompletionTokens
+	total.Tokenizer = usage.Tokenizer
+	total.Truncated = total.Truncated || usage.Truncated
+	if usage.Sampling != nil {
+		total.Sampling = usage.Sampling
+	}
+	return total
+}
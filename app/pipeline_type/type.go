@@ -1,6 +1,11 @@
 package pipeline_type
 
-import "github.com/serisow/lesocle/services/llm_service"
+import (
+	"strings"
+
+	"github.com/serisow/lesocle/artifact"
+	"github.com/serisow/lesocle/services/llm_service"
+)
 
 // Used essentially to detect if pipeline might run, so we fetch minimal data
 type ScheduledPipeline struct {
@@ -11,13 +16,94 @@ type ScheduledPipeline struct {
 
 // The full pipeline data
 type Pipeline struct {
-	ID                string         `json:"id"`
-	Label             string         `json:"label"`
-	Steps             []PipelineStep `json:"steps"`
-	ScheduledTime     int64          `json:"scheduled_time"`
-	ExecutionFailures int            `json:"execution_failures"`
-	LLMServices       map[string]llm_service.LLMService
-	Context           *Context
+	ID                string                            `json:"id"`
+	Label             string                            `json:"label"`
+	Steps             []PipelineStep                    `json:"steps"`
+	BeforeSteps       []PipelineStep                    `json:"before_steps,omitempty"` // Run ahead of the steps
+	AfterSteps        []PipelineStep                    `json:"after_steps,omitempty"`  // Always run at the end, like deferred calls
+	ScheduledTime     int64                             `json:"scheduled_time"`
+	ExecutionFailures int                               `json:"execution_failures"`
+	Quota             *ExecutionQuota                   `json:"execution_quota,omitempty"`
+	ContentFilter     *ContentFilterConfig              `json:"content_filter,omitempty"`
+	SLA               *SLAConfig                        `json:"sla,omitempty"`
+	PostRunHooks      []PostRunHook                     `json:"post_run_hooks,omitempty"`  // Derive summary fields from the results
+	Locales           []string                          `json:"locales,omitempty"`         // Target locales, the first is the default
+	Sandbox           bool                              `json:"sandbox,omitempty"`         // Rehearsal, actions are simulated or use test endpoints
+	ResultWebhooks    []ResultWebhook                   `json:"result_webhooks,omitempty"` // Also receive the execution results
+	LLMServices       map[string]llm_service.LLMService `json:"-"`
+	Context           *Context                          `json:"-"`
+	// StepOverrides replaces the execution of the keyed steps (by step ID) with a
+	// fixed output, used by debugging reruns.
+	StepOverrides map[string]StepOverride `json:"-"`
+	// ArtifactOrigin links the manifest of a regeneration run to the execution
+	// whose artifact it regenerates.
+	ArtifactOrigin *artifact.Origin `json:"-"`
+	// Inline is set for pipelines run from a definition posted to the API
+	// rather than fetched from Drupal, their results aren't sent to Drupal.
+	Inline bool `json:"-"`
+	// RequestID is the X-Request-ID of the API request starting the execution.
+	RequestID string `json:"-"`
+}
+
+// StepOverride provides the output of a step without executing it.
+type StepOverride struct {
+	Output interface{}
+	// Source is "skipped" when the output is reused from a previous execution,
+	// or "pinned" when it was supplied by the caller.
+	Source string
+}
+
+// ExecutionQuota is the execution budget of a pipeline. Zero values mean no limit.
+type ExecutionQuota struct {
+	DailyExecutions   int     `json:"daily_executions"`
+	MonthlyExecutions int     `json:"monthly_executions"`
+	DailyCost         float64 `json:"daily_cost"`
+	MonthlyCost       float64 `json:"monthly_cost"`
+}
+
+// IsZero reports whether the quota sets no limit at all.
+func (q ExecutionQuota) IsZero() bool {
+	return q == ExecutionQuota{}
+}
+
+// SLAConfig is the service level a pipeline is expected to meet, in seconds.
+// Zero values are not checked.
+type SLAConfig struct {
+	// MaxDuration is the expected completion time of a run
+	MaxDuration int `json:"max_duration"`
+	// StartWindow is how late after its scheduled time a run may start
+	StartWindow int `json:"start_window"`
+}
+
+// ResultWebhook receives the execution result sent to Drupal once an
+// execution ends, signed with Secret when set.
+type ResultWebhook struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// PostRunHook computes summary fields from the final results of an execution,
+// sent to Drupal as top-level keys of the execution result.
+type PostRunHook struct {
+	// Type is "extract" or "webhook".
+	Type string `json:"type"`
+	// Fields maps a summary field to a path in the step outputs, e.g.
+	// "headline": "article.title", for extract hooks.
+	Fields map[string]string `json:"fields,omitempty"`
+	// URL receives the results of webhook hooks and answers with a JSON
+	// object of summary fields.
+	URL string `json:"url,omitempty"`
+	// Timeout of webhook hooks, in seconds.
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// ContentFilterConfig configures the lexical brand-safety check applied to the
+// content published by action steps.
+type ContentFilterConfig struct {
+	Enabled        bool     `json:"enabled"`
+	UseDefaultList bool     `json:"use_default_list"`
+	DenyList       []string `json:"deny_list"`
+	AllowList      []string `json:"allow_list"`
 }
 
 type PipelineStep struct {
@@ -41,6 +127,94 @@ type PipelineStep struct {
 	// Drupal node data for social media step
 	ArticleData       map[string]interface{} `json:"article_data,omitempty"`
 	UploadImageConfig *UploadImageConfig     `json:"upload_image_config,omitempty"`
+	// Rollout deploys a candidate configuration to part of the executions
+	Rollout *StepRollout `json:"rollout,omitempty"`
+	// CacheTTL, in seconds, lets identical runs of the step in other
+	// executions reuse its output, 0 disables caching
+	CacheTTL int `json:"cache_ttl,omitempty"`
+	// PerLocale runs the step once per target locale of the pipeline
+	PerLocale bool `json:"per_locale,omitempty"`
+	// Tools the model of an LLM step may call before answering
+	Tools []StepTool `json:"tools,omitempty"`
+	// MaxToolRounds bounds the rounds of tool calls, 5 when 0
+	MaxToolRounds int `json:"max_tool_rounds,omitempty"`
+	// ResponseSchema is the JSON schema the answer of an LLM step must match,
+	// answers that don't are sent back to the model for repair
+	ResponseSchema map[string]interface{} `json:"response_schema,omitempty"`
+	// Messages are the system instructions and prior turns an LLM step
+	// sends before its prompt
+	Messages []StepMessage `json:"messages,omitempty"`
+	// PromptAssembly fits the required step outputs of an LLM step prompt in
+	// a token budget
+	PromptAssembly *PromptAssembly `json:"prompt_assembly,omitempty"`
+}
+
+// Prompt assembly overflow strategies.
+const (
+	OverflowTruncate  = "truncate"
+	OverflowSummarize = "summarize"
+)
+
+// PromptAssembly fits the outputs filling the placeholders of a prompt in
+// MaxTokens, or the context window of the model minus ReserveTokens for the
+// answer. The sources keep their share by priority, the ones over their
+// share are truncated or, with the summarize overflow, summarized by the
+// model chunk by chunk.
+type PromptAssembly struct {
+	MaxTokens     int            `json:"max_tokens,omitempty"`
+	ReserveTokens int            `json:"reserve_tokens,omitempty"`
+	Overflow      string         `json:"overflow,omitempty"`
+	Sources       []PromptSource `json:"sources,omitempty"`
+}
+
+// PromptSource sets how a required step output is fitted in the prompt. The
+// sources with a higher priority are kept first, the unlisted ones have 0.
+type PromptSource struct {
+	Key       string `json:"key"`
+	Priority  int    `json:"priority,omitempty"`
+	MaxTokens int    `json:"max_tokens,omitempty"`
+}
+
+// StepMessage is a turn of the conversation an LLM step has with its model.
+// Content may hold "{step_output_key}" placeholders of the required steps.
+// From takes the turn from a step output instead, all the turns when the
+// output is a JSON list of messages.
+type StepMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content,omitempty"`
+	From    string `json:"from,omitempty"`
+}
+
+// StepTool is a tool the model of an LLM step may call. A call runs either
+// Step, whose "{argument}" placeholders are replaced by the arguments of the
+// call and whose output is the result, or the Go-side ActionService with
+// Configuration and the arguments listed in AllowedArguments.
+type StepTool struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// JSON schema of the arguments
+	Parameters    map[string]interface{} `json:"parameters,omitempty"`
+	Step          *PipelineStep          `json:"step,omitempty"`
+	ActionService string                 `json:"action_service,omitempty"`
+	// Configuration of the action service, with its credentials and the
+	// settings the model doesn't choose
+	Configuration map[string]interface{} `json:"configuration,omitempty"`
+	// AllowedArguments are the configuration keys the model may set, other
+	// arguments are refused
+	AllowedArguments []string `json:"allowed_arguments,omitempty"`
+}
+
+// StepRollout is a candidate version of a step configuration served to a
+// percentage of executions. Empty fields keep the current configuration.
+type StepRollout struct {
+	Version          string                 `json:"version"`
+	Percentage       int                    `json:"percentage"`
+	Prompt           string                 `json:"prompt,omitempty"`
+	LLMServiceConfig map[string]interface{} `json:"llm_service,omitempty"`
+	// The candidate is rolled back once it ran MinExecutions times with a
+	// failure rate more than MaxFailureRateIncrease above the stable version.
+	MinExecutions          int     `json:"min_executions"`
+	MaxFailureRateIncrease float64 `json:"max_failure_rate_increase"`
 }
 
 type ActionDetails struct {
@@ -100,3 +274,15 @@ type UploadImageConfig struct {
 	FileName string `json:"image_file_name"`
 	FileSize int64  `json:"image_file_size"`
 }
+
+// RequiredStepKeys returns the step output keys listed in RequiredSteps.
+func (s PipelineStep) RequiredStepKeys() []string {
+	var keys []string
+	for _, key := range strings.FieldsFunc(s.RequiredSteps, func(r rune) bool { return r == '\r' || r == '\n' }) {
+		key = strings.TrimSpace(key)
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
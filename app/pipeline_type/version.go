@@ -0,0 +1,55 @@
+package pipeline_type
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// definitionHashLength is the number of hex characters kept from the SHA-256,
+// plenty to tell versions of one pipeline apart.
+const definitionHashLength = 16
+
+func hashDefinition(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:definitionHashLength]
+}
+
+// DefinitionHash identifies the version of the pipeline definition: its steps,
+// hooks and the content filter applied to what they publish. Runtime state
+// such as the schedule or the failure count is left out.
+func (p *Pipeline) DefinitionHash() string {
+	return hashDefinition(struct {
+		Steps         []PipelineStep       `json:"steps"`
+		ContentFilter *ContentFilterConfig `json:"content_filter"`
+		BeforeSteps   []PipelineStep       `json:"before_steps,omitempty"`
+		AfterSteps    []PipelineStep       `json:"after_steps,omitempty"`
+	}{p.Steps, p.ContentFilter, p.BeforeSteps, p.AfterSteps})
+}
+
+// StepDefinitionHashes returns the definition hash of every step keyed by step ID.
+func (p *Pipeline) StepDefinitionHashes() map[string]string {
+	hashes := make(map[string]string, len(p.Steps))
+	for _, s := range p.Steps {
+		hashes[s.ID] = s.DefinitionHash()
+	}
+	return hashes
+}
+
+// DefinitionHash identifies the version of a single step definition.
+func (s PipelineStep) DefinitionHash() string {
+	return hashDefinition(s)
+}
+
+// ConfigHash identifies what a step does regardless of where it sits in a
+// pipeline: its ID, position, description and output key are left out, so
+// the same search in two pipelines has the same hash.
+func (s PipelineStep) ConfigHash() string {
+	s.ID, s.UUID, s.Weight, s.StepDescription, s.StepOutputKey = "", "", 0, "", ""
+	s.CacheTTL, s.Rollout = 0, nil
+	return hashDefinition(s)
+}
@@ -2,6 +2,7 @@ package plugin_registry
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/serisow/lesocle/services/action_service"
 	"github.com/serisow/lesocle/services/llm_service"
@@ -12,7 +13,8 @@ type PluginRegistry struct {
     stepTypes   map[string]func() step.Step
     llmServices map[string]llm_service.LLMService
     actionServices map[string]action_service.ActionService
-
+    // aliases maps deprecated step type names to their current name
+    aliases     map[string]string
 }
 
 func NewPluginRegistry() *PluginRegistry {
@@ -20,6 +22,7 @@ func NewPluginRegistry() *PluginRegistry {
         stepTypes:   make(map[string]func() step.Step),
         llmServices: make(map[string]llm_service.LLMService),
         actionServices: make(map[string]action_service.ActionService),
+        aliases:     make(map[string]string),
     }
 }
 
@@ -28,8 +31,24 @@ func (pr *PluginRegistry) RegisterStepType(typeName string, factory func() step.
     pr.stepTypes[typeName] = factory
 }
 
+// RegisterAlias keeps a renamed step type working under its old name, so
+// pipelines defined in Drupal with the old name don't break.
+func (pr *PluginRegistry) RegisterAlias(oldName, newName string) {
+    pr.aliases[oldName] = newName
+}
+
+// ResolveAlias returns the current name of a deprecated step type. The second
+// value is false when typeName is not an alias.
+func (pr *PluginRegistry) ResolveAlias(typeName string) (string, bool) {
+    newName, ok := pr.aliases[typeName]
+    return newName, ok
+}
+
 // GetStepInstance returns a new instance of a step type
 func (pr *PluginRegistry) GetStepInstance(typeName string) (step.Step, error) {
+    if newName, ok := pr.aliases[typeName]; ok {
+        typeName = newName
+    }
     factory, ok := pr.stepTypes[typeName]
     if !ok {
         return nil, fmt.Errorf("unknown step type: %s", typeName)
@@ -57,4 +76,21 @@ func (pr *PluginRegistry) RegisterActionService(name string, service action_serv
 func (pr *PluginRegistry) GetActionService(name string) (action_service.ActionService, bool) {
     service, ok := pr.actionServices[name]
     return service, ok
-}
\ No newline at end of file
+}
+// Plugins lists the registered plugin names by kind, sorted.
+func (pr *PluginRegistry) Plugins() map[string][]string {
+    return map[string][]string{
+        "step_types":      sortedKeys(pr.stepTypes),
+        "llm_services":    sortedKeys(pr.llmServices),
+        "action_services": sortedKeys(pr.actionServices),
+    }
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+    keys := make([]string, 0, len(m))
+    for k := range m {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    return keys
+}
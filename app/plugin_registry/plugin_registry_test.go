@@ -110,3 +110,27 @@ func TestGetUnregisteredActionService(t *testing.T) {
         t.Fatal("Expected to not find unregistered action service, but got true")
     }
 }
+
+func TestRegisterAliasResolvesRenamedStepType(t *testing.T) {
+    registry := plugin_registry.NewPluginRegistry()
+
+    registry.RegisterStepType("mock_step", func() step.Step {
+        return &MockStep{}
+    })
+    registry.RegisterAlias("legacy_mock_step", "mock_step")
+
+    stepInstance, err := registry.GetStepInstance("legacy_mock_step")
+    if err != nil {
+        t.Fatalf("Expected alias to resolve, got error: %v", err)
+    }
+    if stepInstance.GetType() != "mock_step" {
+        t.Errorf("Expected step type 'mock_step', got '%s'", stepInstance.GetType())
+    }
+
+    if newName, ok := registry.ResolveAlias("legacy_mock_step"); !ok || newName != "mock_step" {
+        t.Errorf("Expected alias to resolve to 'mock_step', got '%s' (%v)", newName, ok)
+    }
+    if _, ok := registry.ResolveAlias("mock_step"); ok {
+        t.Error("Expected 'mock_step' not to be reported as an alias")
+    }
+}
@@ -0,0 +1,150 @@
+// Package pricing holds the prices of the LLM and media providers the steps
+// call, to estimate and track what executions cost.
+package pricing
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Currency of the prices.
+const Currency = "USD"
+
+// Price is what a model costs, per million tokens for text models and per
+// call for the models billed by request (images, video).
+type Price struct {
+	InputPerMillion  float64 `json:"input_per_million,omitempty"`
+	OutputPerMillion float64 `json:"output_per_million,omitempty"`
+	PerRequest       float64 `json:"per_request,omitempty"`
+}
+
+// Cost returns the cost of a call with the given token counts.
+func (p Price) Cost(inputTokens, outputTokens int) float64 {
+	return p.CallsCost(1, inputTokens, outputTokens)
+}
+
+// CallsCost returns the cost of a number of calls totalling the given token
+// counts.
+func (p Price) CallsCost(calls, inputTokens, outputTokens int) float64 {
+	return float64(calls)*p.PerRequest +
+		float64(inputTokens)*p.InputPerMillion/1e6 +
+		float64(outputTokens)*p.OutputPerMillion/1e6
+}
+
+// defaultPrices are the public list prices of the models, keyed by model name
+// prefix. Dated variants ("gpt-4o-2024-08-06") match their family.
+var defaultPrices = map[string]Price{
+	"gpt-4o":              {InputPerMillion: 2.50, OutputPerMillion: 10},
+	"gpt-4o-mini":         {InputPerMillion: 0.15, OutputPerMillion: 0.60},
+	"gpt-4-turbo":         {InputPerMillion: 10, OutputPerMillion: 30},
+	"gpt-4":               {InputPerMillion: 30, OutputPerMillion: 60},
+	"gpt-3.5-turbo":       {InputPerMillion: 0.50, OutputPerMillion: 1.50},
+	"o1":                  {InputPerMillion: 15, OutputPerMillion: 60},
+	"o1-mini":             {InputPerMillion: 3, OutputPerMillion: 12},
+	"claude-3-5-sonnet":   {InputPerMillion: 3, OutputPerMillion: 15},
+	"claude-3-5-haiku":    {InputPerMillion: 0.80, OutputPerMillion: 4},
+	"claude-3-opus":       {InputPerMillion: 15, OutputPerMillion: 75},
+	"claude-3-sonnet":     {InputPerMillion: 3, OutputPerMillion: 15},
+	"claude-3-haiku":      {InputPerMillion: 0.25, OutputPerMillion: 1.25},
+	"gemini-1.5-pro":      {InputPerMillion: 1.25, OutputPerMillion: 5},
+	"gemini-1.5-flash":    {InputPerMillion: 0.075, OutputPerMillion: 0.30},
+	"gemini-pro":          {InputPerMillion: 0.50, OutputPerMillion: 1.50},
+	"llama-3.3-70b":       {InputPerMillion: 0.59, OutputPerMillion: 0.79},
+	"llama-3.1-8b":        {InputPerMillion: 0.05, OutputPerMillion: 0.08},
+	"mixtral-8x7b":        {InputPerMillion: 0.24, OutputPerMillion: 0.24},
+	"gemma2-9b":           {InputPerMillion: 0.20, OutputPerMillion: 0.20},
+	"dall-e-3":            {PerRequest: 0.04},
+	"dall-e-2":            {PerRequest: 0.02},
+	"stable-image-core":   {PerRequest: 0.03},
+	"stable-image-ultra":  {PerRequest: 0.08},
+	"sd3.5-large":         {PerRequest: 0.065},
+	"sd3.5-large-turbo":   {PerRequest: 0.04},
+	"sd3.5-medium":        {PerRequest: 0.035},
+	"stable-diffusion-xl": {PerRequest: 0.002},
+}
+
+var (
+	mutex  sync.RWMutex
+	prices = copyPrices(defaultPrices)
+)
+
+// Load overrides and extends the default prices with the JSON object of
+// model prefix to Price stored at path.
+func Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read price table: %w", err)
+	}
+	var overrides map[string]Price
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return fmt.Errorf("invalid price table %s: %w", path, err)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	for model, price := range overrides {
+		prices[model] = price
+	}
+	return nil
+}
+
+// Lookup returns the price of the model, matched on the longest known prefix
+// of its name. Models routed through a gateway ("anthropic/claude-3.5-sonnet")
+// match the price of the model without the vendor, with dashes for dots.
+func Lookup(model string) (Price, bool) {
+	model = strings.ToLower(strings.TrimSpace(model))
+	if model == "" {
+		return Price{}, false
+	}
+	if price, found := lookup(model); found {
+		return price, true
+	}
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+		if price, found := lookup(model); found {
+			return price, true
+		}
+		return lookup(strings.ReplaceAll(model, ".", "-"))
+	}
+	return Price{}, false
+}
+
+func lookup(model string) (Price, bool) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	best, found := "", false
+	for prefix := range prices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best, found = prefix, true
+		}
+	}
+	return prices[best], found
+}
+
+// Table returns a copy of the prices.
+func Table() map[string]Price {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return copyPrices(prices)
+}
+
+// ApproxTokens estimates the number of tokens of a text, about four
+// characters per token for English.
+func ApproxTokens(text string) int {
+	n := utf8.RuneCountInString(text)
+	if n == 0 {
+		return 0
+	}
+	return (n + 3) / 4
+}
+
+func copyPrices(m map[string]Price) map[string]Price {
+	copied := make(map[string]Price, len(m))
+	for k, v := range m {
+		copied[k] = v
+	}
+	return copied
+}
@@ -0,0 +1,42 @@
+package pricing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLookupMatchesLongestPrefix(t *testing.T) {
+	price, ok := Lookup("gpt-4o-mini-2024-07-18")
+	if !ok || price != defaultPrices["gpt-4o-mini"] {
+		t.Errorf("expected gpt-4o-mini price, got %+v %v", price, ok)
+	}
+	if price, ok := Lookup("anthropic/claude-3.5-sonnet"); !ok || price != defaultPrices["claude-3-5-sonnet"] {
+		t.Errorf("expected the price of the routed model, got %+v %v", price, ok)
+	}
+	if _, ok := Lookup("unknown-model"); ok {
+		t.Error("unknown model should have no price")
+	}
+}
+
+func TestLoadOverridesPrices(t *testing.T) {
+	saved := Table()
+	defer func() {
+		mutex.Lock()
+		prices = saved
+		mutex.Unlock()
+	}()
+
+	path := filepath.Join(t.TempDir(), "prices.json")
+	os.WriteFile(path, []byte(`{"my-model": {"input_per_million": 1, "output_per_million": 2}}`), 0644)
+	if err := Load(path); err != nil {
+		t.Fatal(err)
+	}
+	price, ok := Lookup("my-model")
+	if !ok {
+		t.Fatal("loaded model should have a price")
+	}
+	if cost := price.Cost(1_000_000, 500_000); cost != 2 {
+		t.Errorf("expected a cost of 2, got %v", cost)
+	}
+}
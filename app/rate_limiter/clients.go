@@ -0,0 +1,149 @@
+package rate_limiter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/serisow/lesocle/auth"
+)
+
+// ClientQuota is the rate allowed to each API client.
+type ClientQuota struct {
+	PerMinute int
+	Burst     int
+	// Overrides of PerMinute keyed by client, "ip:203.0.113.7" or the JWT
+	// subject as "sub:partner-a"
+	Overrides map[string]int
+	// Read the client address from X-Forwarded-For, only behind a proxy
+	// setting it
+	TrustProxy bool
+}
+
+// idleAfter is how long the limiter of a client is kept without requests.
+const idleAfter = 10 * time.Minute
+
+// ClientLimiter is a Negroni middleware answering 429 to the clients sending
+// more requests than their quota to the limited routes.
+type ClientLimiter struct {
+	mutex     sync.Mutex
+	quota     ClientQuota
+	applies   func(*http.Request) bool
+	limiters  map[string]*Limiter
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewClientLimiter creates the middleware. applies reports whether a request
+// is to a limited route, every request is limited when it is nil.
+func NewClientLimiter(quota ClientQuota, applies func(*http.Request) bool) *ClientLimiter {
+	return &ClientLimiter{
+		quota:    quota,
+		applies:  applies,
+		limiters: make(map[string]*Limiter),
+		now:      time.Now,
+	}
+}
+
+// Enabled reports whether a quota is configured.
+func (l *ClientLimiter) Enabled() bool {
+	return l.quota.PerMinute > 0 || len(l.quota.Overrides) > 0
+}
+
+// ServeHTTP implements negroni.Handler.
+func (l *ClientLimiter) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if !l.Enabled() || (l.applies != nil && !l.applies(r)) {
+		next(w, r)
+		return
+	}
+
+	limiter, perMinute := l.limiter(ClientKey(r, l.quota.TrustProxy))
+	if limiter == nil {
+		next(w, r)
+		return
+	}
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(perMinute))
+	if wait := limiter.reserve(l.now()); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+	next(w, r)
+}
+
+// limiter returns the limiter of a client and its rate, nil when the client
+// isn't limited.
+func (l *ClientLimiter) limiter(client string) (*Limiter, int) {
+	perMinute := l.quota.PerMinute
+	if override, ok := l.quota.Overrides[client]; ok {
+		perMinute = override
+	}
+	if perMinute <= 0 {
+		return nil, 0
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.now()
+	if now.Sub(l.lastSweep) > idleAfter {
+		l.sweep(now)
+	}
+	limiter, ok := l.limiters[client]
+	if !ok {
+		limiter = NewLimiter(perMinute, l.quota.Burst)
+		limiter.last = now
+		l.limiters[client] = limiter
+	}
+	return limiter, perMinute
+}
+
+// sweep forgets the clients idle long enough for their bucket to be full.
+func (l *ClientLimiter) sweep(now time.Time) {
+	for client, limiter := range l.limiters {
+		limiter.Lock()
+		idle := now.Sub(limiter.last) > idleAfter
+		limiter.Unlock()
+		if idle {
+			delete(l.limiters, client)
+		}
+	}
+	l.lastSweep = now
+}
+
+// ClientKey identifies the client of a request: the JWT subject or the API
+// key for authenticated requests, the address otherwise. Public routes don't
+// check the credentials, so they are limited by address.
+func ClientKey(r *http.Request, trustProxy bool) string {
+	if principal, ok := auth.Principal(r.Context()); ok {
+		if principal != "api-key" {
+			return "sub:" + principal
+		}
+		key := r.Header.Get(auth.APIKeyHeader)
+		if key == "" {
+			key = r.Header.Get("Authorization") + r.URL.Query().Get("access_token")
+		}
+		digest := sha256.Sum256([]byte(key))
+		return "key:" + hex.EncodeToString(digest[:8])
+	}
+	return "ip:" + clientIP(r, trustProxy)
+}
+
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,65 @@
+package rate_limiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientLimiter(t *testing.T) {
+	now := time.Now()
+	l := NewClientLimiter(ClientQuota{
+		PerMinute: 60,
+		Burst:     2,
+		Overrides: map[string]int{"ip:203.0.113.9": 0},
+	}, func(r *http.Request) bool { return r.URL.Path == "/triggers/daily" })
+	l.now = func() time.Time { return now }
+
+	send := func(path, addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.RemoteAddr = addr + ":40000"
+		w := httptest.NewRecorder()
+		l.ServeHTTP(w, req, func(w http.ResponseWriter, r *http.Request) {})
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := send("/triggers/daily", "203.0.113.7"); w.Code != http.StatusOK {
+			t.Fatalf("expected the burst allowed, got %d", w.Code)
+		}
+	}
+	w := send("/triggers/daily", "203.0.113.7")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("expected a 429 retrying after 1s, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := send("/triggers/daily", "203.0.113.8"); w.Code != http.StatusOK {
+		t.Errorf("expected other clients unaffected, got %d", w.Code)
+	}
+	if w := send("/pipelines/sla", "203.0.113.7"); w.Code != http.StatusOK {
+		t.Errorf("expected the routes without limit unaffected, got %d", w.Code)
+	}
+	for i := 0; i < 5; i++ {
+		if w := send("/triggers/daily", "203.0.113.9"); w.Code != http.StatusOK {
+			t.Fatalf("expected the client exempted by its override, got %d", w.Code)
+		}
+	}
+
+	now = now.Add(time.Second)
+	if w := send("/triggers/daily", "203.0.113.7"); w.Code != http.StatusOK {
+		t.Errorf("expected a request allowed once refilled, got %d", w.Code)
+	}
+}
+
+func TestClientKeyBehindProxy(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/triggers/daily", nil)
+	req.RemoteAddr = "10.0.0.2:40000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.4, 10.0.0.1")
+
+	if key := ClientKey(req, false); key != "ip:10.0.0.2" {
+		t.Errorf("expected the proxy header ignored, got %q", key)
+	}
+	if key := ClientKey(req, true); key != "ip:198.51.100.4" {
+		t.Errorf("expected the forwarded client, got %q", key)
+	}
+}
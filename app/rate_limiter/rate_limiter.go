@@ -0,0 +1,151 @@
+package rate_limiter
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// providers groups services that share the quota of the same external API.
+var providers = map[string]string{
+	"post_tweet":     "twitter",
+	"search_tweets":  "twitter",
+	"facebook_share": "facebook",
+	"linkedin_share": "linkedin",
+	"send_sms":       "twilio",
+}
+
+// Provider returns the rate limit key of a service, the provider it calls when
+// several services share one API quota, the service name otherwise.
+func Provider(service string) string {
+	if provider, ok := providers[service]; ok {
+		return provider
+	}
+	return service
+}
+
+// ParseLimits reads a "provider=requests_per_minute" comma separated list.
+// Malformed entries are ignored.
+func ParseLimits(value string) map[string]int {
+	limits := make(map[string]int)
+	for _, entry := range strings.Split(value, ",") {
+		provider, perMinute, ok := strings.Cut(entry, "=")
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(perMinute))
+		if err != nil {
+			continue
+		}
+		limits[strings.TrimSpace(provider)] = n
+	}
+	return limits
+}
+
+// Limiter is a token bucket refilled at a fixed rate.
+type Limiter struct {
+	sync.Mutex
+	interval time.Duration
+	burst    int
+	tokens   float64
+	last     time.Time
+}
+
+// NewLimiter allows perMinute calls per minute, in bursts of at most burst calls.
+func NewLimiter(perMinute, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		interval: time.Minute / time.Duration(perMinute),
+		burst:    burst,
+		tokens:   float64(burst),
+		last:     time.Now(),
+	}
+}
+
+// Wait blocks until a call is allowed or the context is done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	for {
+		delay := l.reserve(time.Now())
+		if delay == 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes a token if one is available, otherwise it returns how long to
+// wait for the next one.
+func (l *Limiter) reserve(now time.Time) time.Duration {
+	l.Lock()
+	defer l.Unlock()
+
+	l.tokens += float64(now.Sub(l.last)) / float64(l.interval)
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) * float64(l.interval))
+}
+
+// Registry holds one limiter per provider. Providers without a configured
+// limit are not throttled.
+type Registry struct {
+	sync.RWMutex
+	limiters map[string]*Limiter
+}
+
+// Limits is the registry shared by all steps.
+var Limits = NewRegistry(nil)
+
+// NewRegistry creates a registry from requests per minute keyed by provider.
+func NewRegistry(limits map[string]int) *Registry {
+	r := &Registry{}
+	r.Configure(limits)
+	return r
+}
+
+// Configure replaces the limits of the registry.
+func (r *Registry) Configure(limits map[string]int) {
+	limiters := make(map[string]*Limiter)
+	for provider, perMinute := range limits {
+		if perMinute > 0 {
+			limiters[provider] = NewLimiter(perMinute, 1)
+		}
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	r.limiters = limiters
+}
+
+// Wait blocks until the provider of service allows another call.
+func (r *Registry) Wait(ctx context.Context, service string) error {
+	r.RLock()
+	limiter, ok := r.limiters[Provider(service)]
+	r.RUnlock()
+	if !ok {
+		return nil
+	}
+	return limiter.Wait(ctx)
+}
+
+// Wait acquires a call slot for service from the shared registry.
+func Wait(ctx context.Context, service string) error {
+	return Limits.Wait(ctx, service)
+}
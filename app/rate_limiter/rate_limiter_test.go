@@ -0,0 +1,47 @@
+package rate_limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiterSpacesCalls(t *testing.T) {
+	l := NewLimiter(60, 1)
+	now := l.last
+
+	if delay := l.reserve(now); delay != 0 {
+		t.Fatalf("first call should not wait, got %v", delay)
+	}
+	if delay := l.reserve(now); delay != time.Second {
+		t.Errorf("expected 1s wait for the second call, got %v", delay)
+	}
+	if delay := l.reserve(now.Add(time.Second)); delay != 0 {
+		t.Errorf("expected a token after 1s, got %v", delay)
+	}
+}
+
+func TestRegistrySharesProviderLimit(t *testing.T) {
+	r := NewRegistry(map[string]int{"twitter": 1})
+	ctx := context.Background()
+
+	if err := r.Wait(ctx, "post_tweet"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := r.Wait(ctx, "search_tweets"); err != context.DeadlineExceeded {
+		t.Errorf("expected search_tweets to wait on the twitter limit, got %v", err)
+	}
+	if err := r.Wait(ctx, "anthropic"); err != nil {
+		t.Errorf("unlimited provider should not wait, got %v", err)
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	limits := ParseLimits("openai_image=5, twitter = 50,bad,facebook=x")
+	if len(limits) != 2 || limits["openai_image"] != 5 || limits["twitter"] != 50 {
+		t.Errorf("unexpected limits: %v", limits)
+	}
+}
@@ -0,0 +1,122 @@
+// Package requestid correlates the work done for a request or an execution:
+// the ID is taken from the X-Request-ID header or generated, carried in the
+// context, sent on the outbound HTTP calls and added to the log records.
+package requestid
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/serisow/lesocle/logging"
+)
+
+// Header carries the request ID.
+const Header = "X-Request-ID"
+
+// maxLength bounds the IDs accepted from clients, longer ones are replaced.
+const maxLength = 128
+
+type contextKey struct{}
+
+// WithID returns a copy of ctx carrying id.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID of ctx. Outside of a request it falls
+// back to the execution ID of the execution log scope, so the calls made by
+// scheduled runs are correlated too.
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if id, ok := ctx.Value(contextKey{}).(string); ok {
+		return id
+	}
+	executionID, _, _ := logging.ExecutionLogScope(ctx)
+	return executionID
+}
+
+// valid reports whether an ID received from a client can be reused, it ends
+// up in headers and log lines.
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// Middleware is a Negroni middleware giving each request an ID, the one sent
+// by the client when valid, and echoing it in the response.
+type Middleware struct{}
+
+// ServeHTTP implements negroni.Handler.
+func (Middleware) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	id := r.Header.Get(Header)
+	if !valid(id) {
+		id = uuid.New().String()
+	}
+	r.Header.Set(Header, id)
+	w.Header().Set(Header, id)
+	next(w, r.WithContext(WithID(r.Context(), id)))
+}
+
+// Transport sets the request ID of the request context on outbound requests
+// that don't have one.
+type Transport struct {
+	// Base performs the requests, http.DefaultTransport when nil
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	id := FromContext(req.Context())
+	if id == "" || req.Header.Get(Header) != "" {
+		return base.RoundTrip(req)
+	}
+	// A RoundTripper must not modify the request
+	req = req.Clone(req.Context())
+	req.Header.Set(Header, id)
+	return base.RoundTrip(req)
+}
+
+// LogHandler adds the request ID of the record context as the request_id
+// attribute.
+type LogHandler struct {
+	slog.Handler
+}
+
+// NewLogHandler wraps h.
+func NewLogHandler(h slog.Handler) *LogHandler {
+	return &LogHandler{Handler: h}
+}
+
+// Handle implements slog.Handler.
+func (h *LogHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := FromContext(ctx); id != "" {
+		r = r.Clone()
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler.
+func (h *LogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &LogHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup implements slog.Handler.
+func (h *LogHandler) WithGroup(name string) slog.Handler {
+	return &LogHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,85 @@
+package requestid
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/serisow/lesocle/logging"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		reuse  bool
+	}{
+		{"client ID reused", "ci-run-42", true},
+		{"missing ID generated", "", false},
+		{"invalid ID replaced", "bad id\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(Header, tt.header)
+			}
+			w := httptest.NewRecorder()
+			var seen string
+			Middleware{}.ServeHTTP(w, req, func(w http.ResponseWriter, r *http.Request) {
+				seen = FromContext(r.Context())
+			})
+			if seen == "" || w.Header().Get(Header) != seen {
+				t.Fatalf("expected the ID in the context and the response, got %q and %q", seen, w.Header().Get(Header))
+			}
+			if (seen == tt.header) != tt.reuse {
+				t.Errorf("unexpected ID %q for header %q", seen, tt.header)
+			}
+		})
+	}
+}
+
+func TestTransportSetsHeader(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get(Header))
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: &Transport{}}
+
+	for _, ctx := range []context.Context{
+		WithID(context.Background(), "req-1"),
+		logging.WithExecutionLog(context.Background(), "exec-1", ""),
+		context.Background(),
+	} {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+	if strings.Join(got, ",") != "req-1,exec-1," {
+		t.Errorf("unexpected request IDs %q", got)
+	}
+}
+
+func TestLogHandlerAddsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewLogHandler(slog.NewTextHandler(&buf, nil))).With("service", "openai")
+
+	logger.InfoContext(WithID(context.Background(), "req-1"), "calling")
+	logger.Info("no context")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if !strings.Contains(lines[0], "request_id=req-1") || !strings.Contains(lines[0], "service=openai") {
+		t.Errorf("expected the request ID added, got %q", lines[0])
+	}
+	if strings.Contains(lines[1], "request_id") {
+		t.Errorf("expected no request ID without one in the context, got %q", lines[1])
+	}
+}
@@ -0,0 +1,203 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Default failure backoff: the wait after the first failure, the longest wait,
+// and how long after the last failure the count starts over.
+const (
+	DefaultFailureBackoffBase = 5 * time.Minute
+	DefaultFailureBackoffMax  = 6 * time.Hour
+	DefaultFailureCooldown    = 24 * time.Hour
+)
+
+// FailureState is the consecutive failures of a pipeline.
+type FailureState struct {
+	Count       int   `json:"count"`
+	LastFailure int64 `json:"last_failure,omitempty"`
+	// RetryAfter is when the scheduler may start the pipeline again
+	RetryAfter int64 `json:"retry_after,omitempty"`
+}
+
+// FailureTracker counts the consecutive failures of scheduled pipelines and
+// spaces out their next attempts with an exponential backoff, instead of
+// skipping them for good. The count starts over after a success, after the
+// cool-down, or when cleared through the API.
+//
+// Pipelines the tracker knows nothing about use the count reported by Drupal,
+// once tracked the local count wins so a clear isn't undone by Drupal.
+type FailureTracker struct {
+	sync.Mutex
+	path     string
+	base     time.Duration
+	max      time.Duration
+	cooldown time.Duration
+	failures map[string]FailureState
+}
+
+// NewFailureTracker creates a tracker persisted at path, loading the previous
+// state. An empty path keeps the state in memory.
+func NewFailureTracker(path string, base, max, cooldown time.Duration) *FailureTracker {
+	if base <= 0 {
+		base = DefaultFailureBackoffBase
+	}
+	if max < base {
+		max = base
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultFailureCooldown
+	}
+	t := &FailureTracker{path: path, base: base, max: max, cooldown: cooldown, failures: make(map[string]FailureState)}
+	if path == "" {
+		return t
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &t.failures); err != nil {
+			log.Printf("Error loading pipeline failures from %s: %v", path, err)
+		}
+		if t.failures == nil {
+			t.failures = make(map[string]FailureState)
+		}
+	}
+	return t
+}
+
+// CanRun reports whether the pipeline may start at now. drupalFailures is the
+// count reported by Drupal, used for pipelines not tracked yet.
+func (t *FailureTracker) CanRun(pipelineID string, drupalFailures int, now time.Time) (bool, time.Time) {
+	t.Lock()
+	defer t.Unlock()
+	state, tracked := t.failures[pipelineID]
+	if !tracked {
+		if drupalFailures < MaxExecutionFailures {
+			return true, time.Time{}
+		}
+		// Start tracking the backoff from now, Drupal doesn't say when it failed
+		state = FailureState{Count: drupalFailures, LastFailure: now.Unix()}
+		state.RetryAfter = now.Add(t.delay(state.Count)).Unix()
+		t.failures[pipelineID] = state
+		t.save()
+	}
+
+	if state.Count > 0 && now.Sub(time.Unix(state.LastFailure, 0)) >= t.cooldown {
+		log.Printf("Pipeline %s cooled down, resetting its %d failures", pipelineID, state.Count)
+		state = FailureState{}
+		t.failures[pipelineID] = state
+		t.save()
+	}
+
+	retryAfter := time.Unix(state.RetryAfter, 0)
+	if state.Count == 0 || !now.Before(retryAfter) {
+		return true, time.Time{}
+	}
+	return false, retryAfter
+}
+
+// RecordFailure counts a failed execution and returns the new count.
+func (t *FailureTracker) RecordFailure(pipelineID string, now time.Time) int {
+	t.Lock()
+	defer t.Unlock()
+	state := t.failures[pipelineID]
+	state.Count++
+	state.LastFailure = now.Unix()
+	state.RetryAfter = now.Add(t.delay(state.Count)).Unix()
+	t.failures[pipelineID] = state
+	t.save()
+	return state.Count
+}
+
+// RecordSuccess resets the failures of the pipeline.
+func (t *FailureTracker) RecordSuccess(pipelineID string) {
+	t.Clear(pipelineID)
+}
+
+// Clear resets the failures of the pipeline, it runs at its next schedule.
+func (t *FailureTracker) Clear(pipelineID string) {
+	t.Lock()
+	defer t.Unlock()
+	if state, ok := t.failures[pipelineID]; ok && state.Count == 0 {
+		return
+	}
+	t.failures[pipelineID] = FailureState{}
+	t.save()
+}
+
+// Get returns the failure state of the pipeline.
+func (t *FailureTracker) Get(pipelineID string) (FailureState, bool) {
+	t.Lock()
+	defer t.Unlock()
+	state, ok := t.failures[pipelineID]
+	return state, ok
+}
+
+// delay is the backoff after count failures. Callers must hold the lock.
+func (t *FailureTracker) delay(count int) time.Duration {
+	delay := t.base
+	for i := 1; i < count && delay < t.max; i++ {
+		delay *= 2
+	}
+	return min(delay, t.max)
+}
+
+// save persists the state. Callers must hold the lock.
+func (t *FailureTracker) save() {
+	if t.path == "" {
+		return
+	}
+	if err := t.write(); err != nil {
+		log.Printf("Error saving pipeline failures: %v", err)
+	}
+}
+
+func (t *FailureTracker) write() error {
+	data, err := json.MarshalIndent(t.failures, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling pipeline failures: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return fmt.Errorf("failed to create failures directory: %w", err)
+	}
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.path)
+}
+
+// SetFailureTracker replaces the permanent skip after MaxExecutionFailures
+// with the backoff of tracker.
+func (s *Scheduler) SetFailureTracker(tracker *FailureTracker) {
+	s.failures = tracker
+}
+
+// failureGate reports whether the failures of the pipeline let it start now.
+func (s *Scheduler) failureGate(pipelineID string, drupalFailures int) bool {
+	if s.failures == nil {
+		if drupalFailures >= MaxExecutionFailures {
+			log.Printf("Pipeline %s has failed %d times consecutively. Skipping execution.", pipelineID, drupalFailures)
+			return false
+		}
+		return true
+	}
+	ok, retryAfter := s.failures.CanRun(pipelineID, drupalFailures, time.Now())
+	if !ok {
+		log.Printf("Pipeline %s is backing off after failures, next attempt after %s", pipelineID, retryAfter.Format(time.RFC3339))
+	}
+	return ok
+}
+
+// failureCount returns the consecutive failures of the pipeline including the
+// one that just happened.
+func (s *Scheduler) failureCount(pipelineID string, drupalFailures int) int {
+	if s.failures == nil {
+		return drupalFailures + 1
+	}
+	return s.failures.RecordFailure(pipelineID, time.Now())
+}
@@ -0,0 +1,54 @@
+package scheduler
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFailureTrackerBackoff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "failures.json")
+	tracker := NewFailureTracker(path, time.Minute, 10*time.Minute, 24*time.Hour)
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	if ok, _ := tracker.CanRun("p1", 0, now); !ok {
+		t.Fatal("expected a pipeline without failures to run")
+	}
+
+	// 1, 2, 4, 8 then capped at 10 minutes
+	for i, expected := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute} {
+		tracker.RecordFailure("p1", now)
+		if ok, _ := tracker.CanRun("p1", 0, now.Add(expected-time.Second)); ok {
+			t.Errorf("failure %d: expected to back off for %v", i+1, expected)
+		}
+		if ok, _ := tracker.CanRun("p1", 0, now.Add(expected)); !ok {
+			t.Errorf("failure %d: expected to run after %v", i+1, expected)
+		}
+	}
+
+	// The count is kept across restarts and forgotten after the cool-down
+	reloaded := NewFailureTracker(path, time.Minute, 10*time.Minute, 24*time.Hour)
+	if state, _ := reloaded.Get("p1"); state.Count != 5 {
+		t.Errorf("expected 5 failures after reload, got %d", state.Count)
+	}
+	if ok, _ := reloaded.CanRun("p1", 0, now.Add(24*time.Hour)); !ok {
+		t.Error("expected the pipeline to run after the cool-down")
+	}
+	if state, _ := reloaded.Get("p1"); state.Count != 0 {
+		t.Errorf("expected the count to be reset, got %d", state.Count)
+	}
+}
+
+func TestFailureTrackerClearOverridesDrupalCount(t *testing.T) {
+	tracker := NewFailureTracker("", time.Minute, time.Hour, 24*time.Hour)
+	now := time.Now()
+
+	if ok, _ := tracker.CanRun("p1", MaxExecutionFailures, now); ok {
+		t.Fatal("expected a pipeline Drupal reports as failing to back off")
+	}
+
+	tracker.Clear("p1")
+	if ok, _ := tracker.CanRun("p1", MaxExecutionFailures, now); !ok {
+		t.Error("expected a cleared pipeline to run despite the Drupal count")
+	}
+}
@@ -0,0 +1,145 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// BlackoutWindow is a period during which the scheduler doesn't start a
+// pipeline, e.g. public holidays or overnight. Runs falling in it are skipped,
+// one-time runs wait for the end of the window. Manual runs ignore it.
+//
+// With Date the window covers the dates from Date to EndDate (inclusive,
+// defaults to Date), otherwise it repeats every week on Weekdays (every day
+// when empty). StartTime and EndTime ("15:04") restrict it to part of the day,
+// an EndTime before StartTime ends the next day, the window then belongs to
+// the day it starts.
+type BlackoutWindow struct {
+	Date      string   `json:"date,omitempty"`
+	EndDate   string   `json:"end_date,omitempty"`
+	Weekdays  []string `json:"weekdays,omitempty"`
+	StartTime string   `json:"start_time,omitempty"`
+	EndTime   string   `json:"end_time,omitempty"`
+	// Timezone of the dates and times, the scheduler's when empty
+	Timezone string `json:"timezone,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Validate checks the window is well formed.
+func (w BlackoutWindow) Validate() error {
+	for _, d := range []string{w.Date, w.EndDate} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, d); err != nil {
+			return fmt.Errorf("invalid blackout date %q", d)
+		}
+	}
+	if w.EndDate != "" && w.Date == "" {
+		return fmt.Errorf("blackout end date %q without a start date", w.EndDate)
+	}
+	if (w.StartTime == "") != (w.EndTime == "") {
+		return fmt.Errorf("blackout window needs both a start and an end time")
+	}
+	for _, t := range []string{w.StartTime, w.EndTime} {
+		if t == "" {
+			continue
+		}
+		if _, err := time.Parse("15:04", t); err != nil {
+			return fmt.Errorf("invalid blackout time %q", t)
+		}
+	}
+	for _, day := range w.Weekdays {
+		if _, ok := weekdayNames[strings.ToLower(day)[:min(3, len(day))]]; !ok {
+			return fmt.Errorf("invalid blackout weekday %q", day)
+		}
+	}
+	if w.Timezone != "" {
+		if _, err := time.LoadLocation(w.Timezone); err != nil {
+			return fmt.Errorf("invalid blackout timezone %q", w.Timezone)
+		}
+	}
+	return nil
+}
+
+// Contains reports whether t falls in the window. Invalid windows contain
+// nothing.
+func (w BlackoutWindow) Contains(t time.Time) bool {
+	if w.Validate() != nil {
+		return false
+	}
+	if w.Timezone != "" {
+		loc, _ := time.LoadLocation(w.Timezone)
+		t = t.In(loc)
+	}
+
+	if w.StartTime == "" {
+		return w.coversDay(t)
+	}
+	start, _ := time.Parse("15:04", w.StartTime)
+	end, _ := time.Parse("15:04", w.EndTime)
+	minute := t.Hour()*60 + t.Minute()
+	startMinute := start.Hour()*60 + start.Minute()
+	endMinute := end.Hour()*60 + end.Minute()
+
+	if startMinute <= endMinute {
+		return minute >= startMinute && minute < endMinute && w.coversDay(t)
+	}
+	// Overnight, the early hours belong to the window of the day before
+	if minute >= startMinute {
+		return w.coversDay(t)
+	}
+	return minute < endMinute && w.coversDay(t.AddDate(0, 0, -1))
+}
+
+// coversDay reports whether the window applies to the day of t.
+func (w BlackoutWindow) coversDay(t time.Time) bool {
+	if w.Date != "" {
+		day := t.Format(time.DateOnly)
+		endDate := w.EndDate
+		if endDate == "" {
+			endDate = w.Date
+		}
+		return day >= w.Date && day <= endDate
+	}
+	if len(w.Weekdays) == 0 {
+		return true
+	}
+	for _, name := range w.Weekdays {
+		if weekdayNames[strings.ToLower(name)[:min(3, len(name))]] == t.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// blackedOut returns the blackout window of the pipeline containing t.
+func (sp *ScheduledPipeline) blackedOut(t time.Time) (BlackoutWindow, bool) {
+	for _, w := range sp.BlackoutWindows {
+		if w.Contains(t) {
+			return w, true
+		}
+	}
+	return BlackoutWindow{}, false
+}
+
+// blackoutGate reports whether the pipeline may be started at now.
+func (sp *ScheduledPipeline) blackoutGate(now time.Time) bool {
+	w, ok := sp.blackedOut(now)
+	if !ok {
+		return true
+	}
+	reason := w.Reason
+	if reason == "" {
+		reason = "no reason given"
+	}
+	log.Printf("Pipeline %s is in a blackout window (%s), not starting it", sp.ID, reason)
+	return false
+}
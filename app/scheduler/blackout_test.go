@@ -0,0 +1,66 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBlackoutWindowContains(t *testing.T) {
+	at := func(s string) time.Time {
+		parsed, err := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	tests := []struct {
+		name   string
+		window BlackoutWindow
+		t      string
+		want   bool
+	}{
+		{"single date", BlackoutWindow{Date: "2025-12-25"}, "2025-12-25 10:00", true},
+		{"day after date", BlackoutWindow{Date: "2025-12-25"}, "2025-12-26 00:00", false},
+		{"date range", BlackoutWindow{Date: "2025-12-24", EndDate: "2025-12-26"}, "2025-12-26 23:59", true},
+		{"weekday", BlackoutWindow{Weekdays: []string{"saturday", "sun"}}, "2025-06-07 12:00", true},
+		{"other weekday", BlackoutWindow{Weekdays: []string{"sat"}}, "2025-06-09 12:00", false},
+		{"daytime window", BlackoutWindow{StartTime: "12:00", EndTime: "14:00"}, "2025-06-09 13:59", true},
+		{"end is exclusive", BlackoutWindow{StartTime: "12:00", EndTime: "14:00"}, "2025-06-09 14:00", false},
+		{"overnight late", BlackoutWindow{StartTime: "22:00", EndTime: "06:00"}, "2025-06-09 23:00", true},
+		{"overnight early", BlackoutWindow{StartTime: "22:00", EndTime: "06:00"}, "2025-06-09 05:00", true},
+		// Friday night window reaches into Saturday morning only
+		{"overnight weekday carry", BlackoutWindow{Weekdays: []string{"fri"}, StartTime: "22:00", EndTime: "06:00"}, "2025-06-07 05:00", true},
+		{"overnight weekday start day", BlackoutWindow{Weekdays: []string{"fri"}, StartTime: "22:00", EndTime: "06:00"}, "2025-06-06 05:00", false},
+		{"timezone", BlackoutWindow{Date: "2025-12-25", Timezone: "Asia/Tokyo"}, "2025-12-24 16:00", true},
+		{"invalid window", BlackoutWindow{StartTime: "22:00"}, "2025-06-09 23:00", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.window.Contains(at(tt.t)); got != tt.want {
+				t.Errorf("Contains(%s) = %v, want %v", tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissedRunsSkipBlackouts(t *testing.T) {
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	sp := &ScheduledPipeline{
+		ID:                 "p1",
+		ScheduleType:       "recurring",
+		RecurringFrequency: "daily",
+		RecurringTime:      "09:00",
+		LastRunTime:        now.AddDate(0, 0, -4).Unix(),
+		BlackoutWindows:    []BlackoutWindow{{Date: "2025-06-08"}},
+	}
+	missed := sp.missedRuns(now)
+	if len(missed) != 3 {
+		t.Fatalf("expected 3 missed runs, got %v", missed)
+	}
+	for _, run := range missed {
+		if run.Day() == 8 {
+			t.Errorf("run in the blackout window should not be caught up: %v", run)
+		}
+	}
+}
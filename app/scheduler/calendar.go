@@ -0,0 +1,149 @@
+package scheduler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxProjectedRuns bounds the runs projected per pipeline, a cron schedule
+// running every minute would otherwise flood the calendar.
+const maxProjectedRuns = 500
+
+// defaultRunDuration is the length of a calendar event when the pipeline has
+// no SLA duration.
+const defaultRunDuration = 15 * time.Minute
+
+// ProjectedRun is an upcoming run of a scheduled pipeline.
+type ProjectedRun struct {
+	PipelineID string
+	Label      string
+	At         time.Time
+	Duration   time.Duration
+}
+
+// UpcomingRuns returns the runs of the pipeline scheduled after from and not
+// after until, oldest first, at most limit. After-pipeline schedules have no
+// time of their own and return nothing.
+func (sp *ScheduledPipeline) UpcomingRuns(from, until time.Time, limit int) []time.Time {
+	var runs []time.Time
+	switch sp.ScheduleType {
+	case "one_time":
+		at := time.Unix(sp.ScheduledTime, 0)
+		if at.After(from) && !at.After(until) && sp.LastRunTime < sp.ScheduledTime {
+			runs = append(runs, at)
+		}
+	case "recurring":
+		scheduleTime, err := time.Parse("15:04", sp.RecurringTime)
+		if err != nil {
+			return nil
+		}
+		for day := from; !day.After(until.AddDate(0, 0, 1)) && len(runs) < limit; day = day.AddDate(0, 0, 1) {
+			at := time.Date(day.Year(), day.Month(), day.Day(), scheduleTime.Hour(), scheduleTime.Minute(), 0, 0, from.Location())
+			if !at.After(from) || at.After(until) {
+				continue
+			}
+			switch sp.RecurringFrequency {
+			case "daily":
+			case "weekly":
+				if at.Weekday() != time.Monday {
+					continue
+				}
+			case "monthly":
+				if at.Day() != 1 {
+					continue
+				}
+			default:
+				return nil
+			}
+			runs = append(runs, at)
+		}
+	case ScheduleTypeCron:
+		schedule, err := ParseCron(sp.CronExpression)
+		if err != nil {
+			return nil
+		}
+		for t := from; len(runs) < limit; {
+			next, ok := schedule.Next(t)
+			if !ok || next.After(until) {
+				break
+			}
+			runs = append(runs, next)
+			t = next
+		}
+	}
+	return runs
+}
+
+// ProjectRuns returns the upcoming runs of the pipelines between from and
+// until, oldest first.
+func ProjectRuns(pipelines []*ScheduledPipeline, from, until time.Time) []ProjectedRun {
+	var runs []ProjectedRun
+	for _, sp := range pipelines {
+		duration := defaultRunDuration
+		if sp.SLA != nil && sp.SLA.MaxDuration > 0 {
+			duration = time.Duration(sp.SLA.MaxDuration) * time.Second
+		}
+		for _, at := range sp.UpcomingRuns(from, until, maxProjectedRuns) {
+			if _, blackedOut := sp.blackedOut(at); blackedOut && sp.ScheduleType != "one_time" {
+				continue
+			}
+			runs = append(runs, ProjectedRun{PipelineID: sp.ID, Label: sp.Label, At: at, Duration: duration})
+		}
+	}
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].At.Before(runs[j].At) })
+	return runs
+}
+
+// WriteICS writes the runs as an iCalendar (RFC 5545) feed.
+func WriteICS(w io.Writer, runs []ProjectedRun, now time.Time) error {
+	buf := bufio.NewWriter(w)
+	line := func(s string) {
+		// Lines are folded at 75 octets, continuation lines start with a space
+		for len(s) > 75 {
+			cut := 75
+			for cut > 0 && !isRuneStart(s[cut]) {
+				cut--
+			}
+			buf.WriteString(s[:cut] + "\r\n")
+			s = " " + s[cut:]
+		}
+		buf.WriteString(s + "\r\n")
+	}
+
+	stamp := now.UTC().Format("20060102T150405Z")
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//lesocle//Pipeline schedule//EN")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:Pipeline schedule")
+	for _, run := range runs {
+		label := run.Label
+		if label == "" {
+			label = run.PipelineID
+		}
+		line("BEGIN:VEVENT")
+		line(fmt.Sprintf("UID:%s-%d@lesocle", run.PipelineID, run.At.Unix()))
+		line("DTSTAMP:" + stamp)
+		line("DTSTART:" + run.At.UTC().Format("20060102T150405Z"))
+		line("DTEND:" + run.At.Add(run.Duration).UTC().Format("20060102T150405Z"))
+		line("SUMMARY:" + escapeICS(label))
+		line("DESCRIPTION:" + escapeICS("Scheduled run of pipeline "+run.PipelineID))
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return buf.Flush()
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// escapeICS escapes a TEXT value.
+func escapeICS(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,74 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	schedule, err := ParseCron("30 9 * * MON-FRI")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Friday evening, next run is Monday morning
+	from := time.Date(2024, 3, 1, 18, 0, 0, 0, time.UTC)
+	next, ok := schedule.Next(from)
+	expected := time.Date(2024, 3, 4, 9, 30, 0, 0, time.UTC)
+	if !ok || !next.Equal(expected) {
+		t.Errorf("expected %v, got %v (%v)", expected, next, ok)
+	}
+	// Strictly after t
+	if again, _ := schedule.Next(next); !again.Equal(expected.AddDate(0, 0, 1)) {
+		t.Errorf("expected the following day, got %v", again)
+	}
+}
+
+func TestProjectRunsAndICS(t *testing.T) {
+	from := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC) // a Friday
+	until := from.AddDate(0, 0, 7)
+	pipelines := []*ScheduledPipeline{
+		{ID: "daily", Label: "Morning news, sports", ScheduleType: "recurring", RecurringFrequency: "daily", RecurringTime: "08:00"},
+		{ID: "weekly", Label: "Weekly recap", ScheduleType: "recurring", RecurringFrequency: "weekly", RecurringTime: "10:00"},
+		{ID: "once", ScheduleType: "one_time", ScheduledTime: from.Add(time.Hour).Unix()},
+		{ID: "done", ScheduleType: "one_time", ScheduledTime: from.Add(time.Hour).Unix(), LastRunTime: from.Add(2 * time.Hour).Unix()},
+		{ID: "cron", ScheduleType: ScheduleTypeCron, CronExpression: "0 */6 * * *"},
+		{ID: "chained", ScheduleType: "after_pipeline", AfterPipelineID: "daily"},
+	}
+
+	runs := ProjectRuns(pipelines, from, until)
+	counts := make(map[string]int)
+	for i, run := range runs {
+		counts[run.PipelineID]++
+		if i > 0 && run.At.Before(runs[i-1].At) {
+			t.Fatal("expected runs sorted by time")
+		}
+	}
+	expected := map[string]int{"daily": 7, "weekly": 1, "once": 1, "cron": 28}
+	for id, n := range expected {
+		if counts[id] != n {
+			t.Errorf("expected %d runs of %s, got %d", n, id, counts[id])
+		}
+	}
+	if counts["done"] != 0 || counts["chained"] != 0 {
+		t.Errorf("expected no runs for done or chained pipelines, got %v", counts)
+	}
+
+	var ics strings.Builder
+	if err := WriteICS(&ics, runs, from); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	feed := ics.String()
+	if !strings.HasPrefix(feed, "BEGIN:VCALENDAR\r\n") || !strings.HasSuffix(feed, "END:VCALENDAR\r\n") {
+		t.Error("expected a VCALENDAR with CRLF line endings")
+	}
+	if strings.Count(feed, "BEGIN:VEVENT") != len(runs) {
+		t.Errorf("expected %d events", len(runs))
+	}
+	if !strings.Contains(feed, `SUMMARY:Morning news\, sports`) {
+		t.Error("expected commas to be escaped")
+	}
+	if !strings.Contains(feed, "DTSTART:20240302T080000Z") {
+		t.Error("expected the next daily run on Saturday at 08:00 UTC")
+	}
+}
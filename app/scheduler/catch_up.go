@@ -0,0 +1,126 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+)
+
+// Catch-up policies, applied on startup to the runs of recurring and cron
+// schedules missed while the service was down.
+const (
+	// CatchUpSkip drops the missed runs, the default
+	CatchUpSkip = "skip"
+	// CatchUpRunOnce runs the pipeline once if any run was missed
+	CatchUpRunOnce = "run_once"
+	// CatchUpRunAllMissed runs the pipeline once per missed run, oldest first
+	CatchUpRunAllMissed = "run_all_missed"
+
+	// maxCatchUpRuns bounds run_all_missed after a long outage
+	maxCatchUpRuns = 24
+	// runWindow is how late after its time ShouldRun still starts a run
+	runWindow = 5 * time.Minute
+)
+
+// catchUp applies the catch-up policy of every pipeline.
+func (s *Scheduler) catchUp(scheduledPipelines []*ScheduledPipeline, now time.Time) {
+	for _, sp := range scheduledPipelines {
+		if sp.CatchUpPolicy == "" || sp.CatchUpPolicy == CatchUpSkip {
+			continue
+		}
+		missed := sp.missedRuns(now)
+		if len(missed) == 0 {
+			continue
+		}
+
+		runs := 1
+		if sp.CatchUpPolicy == CatchUpRunAllMissed {
+			runs = min(len(missed), maxCatchUpRuns)
+			if len(missed) > maxCatchUpRuns {
+				log.Printf("Pipeline %s missed %d runs, catching up the last %d only", sp.ID, len(missed), maxCatchUpRuns)
+			}
+		} else if sp.CatchUpPolicy != CatchUpRunOnce {
+			log.Printf("Pipeline %s has an unknown catch-up policy %q, skipping its missed runs", sp.ID, sp.CatchUpPolicy)
+			continue
+		}
+
+		// The instance claiming the latest missed run does the whole catch-up
+		if !s.claimRun(sp.ID, missed[len(missed)-1]) {
+			continue
+		}
+
+		log.Printf("Pipeline %s missed %d runs since %s, catching up with %d run(s)",
+			sp.ID, len(missed), time.Unix(sp.LastRunTime, 0).Format(time.RFC3339), runs)
+		go s.runSequentially(sp.ID, runs)
+	}
+}
+
+// runSequentially runs a pipeline n times, each run starting after the
+// previous one finished. It stops when a run can't start.
+func (s *Scheduler) runSequentially(pipelineID string, n int) {
+	for i := 0; i < n; i++ {
+		done := s.startPipeline(pipelineID)
+		if done == nil {
+			return
+		}
+		<-done
+	}
+}
+
+// missedRuns returns the scheduled times, oldest first, between the last run
+// and the current run window. Pipelines that never ran have nothing to catch up.
+func (sp *ScheduledPipeline) missedRuns(now time.Time) []time.Time {
+	if sp.LastRunTime == 0 {
+		return nil
+	}
+	var missed []time.Time
+	cursor := now.Add(-runWindow)
+	for {
+		t, ok := sp.previousRun(cursor)
+		if !ok || t.Unix() <= sp.LastRunTime {
+			break
+		}
+		cursor = t.Add(-time.Second)
+		// Runs falling in a blackout window were not due
+		if _, blackedOut := sp.blackedOut(t); blackedOut {
+			continue
+		}
+		missed = append([]time.Time{t}, missed...)
+	}
+	return missed
+}
+
+// previousRun returns the latest scheduled time of a recurring or cron
+// schedule at or before t.
+func (sp *ScheduledPipeline) previousRun(t time.Time) (time.Time, bool) {
+	switch sp.ScheduleType {
+	case ScheduleTypeCron:
+		return sp.lastCronTime(t)
+	case "recurring":
+		scheduleTime, err := time.Parse("15:04", sp.RecurringTime)
+		if err != nil {
+			return time.Time{}, false
+		}
+		for d := 0; d <= 366; d++ {
+			day := t.AddDate(0, 0, -d)
+			candidate := time.Date(day.Year(), day.Month(), day.Day(), scheduleTime.Hour(), scheduleTime.Minute(), 0, 0, t.Location())
+			if candidate.After(t) {
+				continue
+			}
+			switch sp.RecurringFrequency {
+			case "daily":
+				return candidate, true
+			case "weekly":
+				if candidate.Weekday() == time.Monday {
+					return candidate, true
+				}
+			case "monthly":
+				if candidate.Day() == 1 {
+					return candidate, true
+				}
+			default:
+				return time.Time{}, false
+			}
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,138 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// claimTimeout bounds a claim, a stuck database must not stall the scheduler.
+const claimTimeout = 5 * time.Second
+
+// RunClaimer lets several instances share the same Drupal schedules: every
+// scheduled run is claimed before it starts, and only the instance that got
+// the claim runs it.
+type RunClaimer interface {
+	// Claim returns true when this instance owns the run of the pipeline
+	// scheduled at scheduledAt. Claiming again a run the instance owns
+	// succeeds, so it can retry a run it couldn't start.
+	Claim(ctx context.Context, pipelineID string, scheduledAt time.Time) (bool, error)
+}
+
+// SetClaimer makes the scheduler claim each run before starting it. Without a
+// claimer every run is started, which is right for a single instance.
+func (s *Scheduler) SetClaimer(claimer RunClaimer) {
+	s.claimer = claimer
+}
+
+// claimRun reports whether this instance should start the run. When the claim
+// can't be checked the run is skipped: running it twice is worse than late,
+// and the next check retries it.
+func (s *Scheduler) claimRun(pipelineID string, scheduledAt time.Time) bool {
+	if s.claimer == nil {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), claimTimeout)
+	defer cancel()
+	claimed, err := s.claimer.Claim(ctx, pipelineID, scheduledAt)
+	if err != nil {
+		log.Printf("Error claiming run of pipeline %s scheduled at %s: %v", pipelineID, scheduledAt.Format(time.RFC3339), err)
+		return false
+	}
+	if !claimed {
+		log.Printf("Run of pipeline %s scheduled at %s is claimed by another instance", pipelineID, scheduledAt.Format(time.RFC3339))
+	}
+	return claimed
+}
+
+// runTime identifies the run ShouldRun found due at now. Recurring runs are
+// due from a few minutes before their time to a few minutes after, within the
+// day of now like the window of ShouldRun, so the run is today's occurrence.
+func (sp *ScheduledPipeline) runTime(now time.Time) time.Time {
+	if sp.ScheduleType == "recurring" {
+		if scheduleTime, err := time.Parse("15:04", sp.RecurringTime); err == nil {
+			return time.Date(now.Year(), now.Month(), now.Day(), scheduleTime.Hour(), scheduleTime.Minute(), 0, 0, now.Location())
+		}
+	}
+	if t, ok := sp.lastScheduledTime(now); ok {
+		return t
+	}
+	return now.Truncate(time.Minute)
+}
+
+// claimDB is the part of a pgx pool used by PostgresClaimer.
+type claimDB interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// claimRetention is how long claims are kept, long enough to cover any
+// catch-up after an outage.
+const claimRetention = 30 * 24 * time.Hour
+
+// PostgresClaimer claims runs with a row per run in a table shared by the
+// instances. The primary key makes the first insert win, unlike an advisory
+// lock the claim outlives the execution, so a slower instance can't run the
+// same schedule again once the first one finished.
+type PostgresClaimer struct {
+	db       claimDB
+	instance string
+
+	pruneMutex sync.Mutex
+	lastPrune  time.Time
+}
+
+// NewPostgresClaimer creates a claimer for the instance named instance.
+func NewPostgresClaimer(db claimDB, instance string) *PostgresClaimer {
+	return &PostgresClaimer{db: db, instance: instance}
+}
+
+// EnsureSchema creates the claims table if needed.
+func (c *PostgresClaimer) EnsureSchema(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `CREATE TABLE IF NOT EXISTS scheduler_run_claims (
+		pipeline_id  TEXT NOT NULL,
+		scheduled_at BIGINT NOT NULL,
+		instance     TEXT NOT NULL,
+		claimed_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (pipeline_id, scheduled_at)
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create scheduler claims table: %w", err)
+	}
+	return nil
+}
+
+// Claim implements RunClaimer.
+func (c *PostgresClaimer) Claim(ctx context.Context, pipelineID string, scheduledAt time.Time) (bool, error) {
+	c.prune(ctx)
+
+	// The no-op update returns the row only when this instance owns it
+	tag, err := c.db.Exec(ctx, `INSERT INTO scheduler_run_claims (pipeline_id, scheduled_at, instance)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (pipeline_id, scheduled_at) DO UPDATE SET instance = EXCLUDED.instance
+		WHERE scheduler_run_claims.instance = EXCLUDED.instance`,
+		pipelineID, scheduledAt.Unix(), c.instance)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim run: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// prune deletes expired claims, at most once an hour.
+func (c *PostgresClaimer) prune(ctx context.Context) {
+	c.pruneMutex.Lock()
+	if time.Since(c.lastPrune) < time.Hour {
+		c.pruneMutex.Unlock()
+		return
+	}
+	c.lastPrune = time.Now()
+	c.pruneMutex.Unlock()
+
+	cutoff := time.Now().Add(-claimRetention).Unix()
+	if _, err := c.db.Exec(ctx, `DELETE FROM scheduler_run_claims WHERE scheduled_at < $1`, cutoff); err != nil {
+		log.Printf("Error pruning scheduler claims: %v", err)
+	}
+}
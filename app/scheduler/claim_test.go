@@ -0,0 +1,106 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeClaimDB mimics the claims table: the first instance inserting a run
+// owns it.
+type fakeClaimDB struct {
+	owners map[string]string
+	err    error
+}
+
+func (db *fakeClaimDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if db.err != nil {
+		return pgconn.CommandTag{}, db.err
+	}
+	if !strings.HasPrefix(strings.TrimSpace(sql), "INSERT") {
+		return pgconn.NewCommandTag("DELETE 0"), nil
+	}
+	key := args[0].(string) + "@" + time.Unix(args[1].(int64), 0).UTC().Format(time.RFC3339)
+	instance := args[2].(string)
+	if owner, ok := db.owners[key]; ok && owner != instance {
+		return pgconn.NewCommandTag("INSERT 0 0"), nil
+	}
+	db.owners[key] = instance
+	return pgconn.NewCommandTag("INSERT 0 1"), nil
+}
+
+func TestPostgresClaimerSingleOwner(t *testing.T) {
+	db := &fakeClaimDB{owners: make(map[string]string)}
+	first := NewPostgresClaimer(db, "instance-a")
+	second := NewPostgresClaimer(db, "instance-b")
+	scheduledAt := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	ctx := context.Background()
+	if claimed, err := first.Claim(ctx, "p1", scheduledAt); err != nil || !claimed {
+		t.Fatalf("expected the first instance to claim the run, got %v, %v", claimed, err)
+	}
+	if claimed, _ := second.Claim(ctx, "p1", scheduledAt); claimed {
+		t.Error("expected the second instance to lose the claim")
+	}
+	if claimed, _ := first.Claim(ctx, "p1", scheduledAt); !claimed {
+		t.Error("expected the owner to claim its run again")
+	}
+	if claimed, _ := second.Claim(ctx, "p1", scheduledAt.Add(24*time.Hour)); !claimed {
+		t.Error("expected the next run to be claimable")
+	}
+}
+
+func TestClaimRunSkipsOnError(t *testing.T) {
+	s := &Scheduler{}
+	if !s.claimRun("p1", time.Now()) {
+		t.Error("expected runs to start without a claimer")
+	}
+
+	s.SetClaimer(NewPostgresClaimer(&fakeClaimDB{err: errors.New("connection refused")}, "instance-a"))
+	if s.claimRun("p1", time.Now()) {
+		t.Error("expected the run to be skipped when the claim fails")
+	}
+}
+
+func TestRunTimeOfRecurringRunBeforeItsTime(t *testing.T) {
+	sp := &ScheduledPipeline{ScheduleType: "recurring", RecurringFrequency: "daily", RecurringTime: "09:00"}
+	now := time.Date(2024, 3, 1, 8, 57, 0, 0, time.UTC)
+	expected := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	if got := sp.runTime(now); !got.Equal(expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if got := sp.runTime(now.Add(5 * time.Minute)); !got.Equal(expected) {
+		t.Errorf("expected %v once the time passed, got %v", expected, got)
+	}
+}
+
+func TestRunTimeOfRecurringRunNearMidnight(t *testing.T) {
+	tests := []struct {
+		name          string
+		recurringTime string
+		now           time.Time
+		due           bool
+		want          time.Time
+	}{
+		{"00:01 run at 00:03", "00:01", time.Date(2024, 3, 1, 0, 3, 0, 0, time.UTC), true, time.Date(2024, 3, 1, 0, 1, 0, 0, time.UTC)},
+		{"23:58 run at 23:55", "23:58", time.Date(2024, 12, 31, 23, 55, 0, 0, time.UTC), true, time.Date(2024, 12, 31, 23, 58, 0, 0, time.UTC)},
+		// The windows don't cross midnight, the runs are due on their own day
+		{"00:01 run at 23:58 the day before", "00:01", time.Date(2024, 2, 29, 23, 58, 0, 0, time.UTC), false, time.Date(2024, 2, 29, 0, 1, 0, 0, time.UTC)},
+		{"23:58 run at 00:01 the day after", "23:58", time.Date(2024, 3, 1, 0, 1, 0, 0, time.UTC), false, time.Date(2024, 3, 1, 23, 58, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp := &ScheduledPipeline{ScheduleType: "recurring", RecurringFrequency: "daily", RecurringTime: tt.recurringTime}
+			if due := sp.ShouldRun(tt.now); due != tt.due {
+				t.Errorf("expected due %v, got %v", tt.due, due)
+			}
+			if got := sp.runTime(tt.now); !got.Equal(tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package scheduler
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+// ScheduleTypeAfterPipeline schedules a pipeline to run once another pipeline
+// completed successfully, optionally after a delay.
+const ScheduleTypeAfterPipeline = "after_pipeline"
+
+// updateDependencies rebuilds the map of pipelines chained after another one.
+// Pipelines that are part of a dependency cycle are left out, otherwise they
+// would trigger each other forever.
+func (s *Scheduler) updateDependencies(scheduledPipelines []*ScheduledPipeline) {
+	cyclic := FindDependencyCycles(scheduledPipelines)
+	for _, id := range cyclic {
+		log.Printf("Pipeline %s is part of a dependency cycle, its chained schedule is ignored", id)
+	}
+	inCycle := make(map[string]bool, len(cyclic))
+	for _, id := range cyclic {
+		inCycle[id] = true
+	}
+
+	dependents := make(map[string][]*ScheduledPipeline)
+	for _, sp := range scheduledPipelines {
+		if sp.ScheduleType != ScheduleTypeAfterPipeline || sp.AfterPipelineID == "" || inCycle[sp.ID] {
+			continue
+		}
+		dependents[sp.AfterPipelineID] = append(dependents[sp.AfterPipelineID], sp)
+	}
+
+	s.dependentsMutex.Lock()
+	s.dependents = dependents
+	s.dependentsMutex.Unlock()
+}
+
+// triggerDependents starts the pipelines chained after pipelineID.
+func (s *Scheduler) triggerDependents(pipelineID string) {
+	s.dependentsMutex.RLock()
+	dependents := s.dependents[pipelineID]
+	s.dependentsMutex.RUnlock()
+
+	for _, sp := range dependents {
+		sp := sp
+		dependentID := sp.ID
+		delay := time.Duration(sp.AfterDelay) * time.Second
+		if delay <= 0 {
+			if !sp.blackoutGate(time.Now()) {
+				continue
+			}
+			log.Printf("Pipeline %s completed, starting chained pipeline %s", pipelineID, dependentID)
+			go s.executePipeline(dependentID)
+			continue
+		}
+		log.Printf("Pipeline %s completed, chained pipeline %s starts in %v", pipelineID, dependentID, delay)
+		time.AfterFunc(delay, func() {
+			if sp.blackoutGate(time.Now()) {
+				s.executePipeline(dependentID)
+			}
+		})
+	}
+}
+
+// FindDependencyCycles returns the IDs of the pipelines whose "after pipeline"
+// chain loops back on itself, sorted.
+func FindDependencyCycles(scheduledPipelines []*ScheduledPipeline) []string {
+	after := make(map[string]string)
+	for _, sp := range scheduledPipelines {
+		if sp.ScheduleType == ScheduleTypeAfterPipeline && sp.AfterPipelineID != "" {
+			after[sp.ID] = sp.AfterPipelineID
+		}
+	}
+
+	// Each pipeline waits on at most one other, so following the chain from
+	// every node either ends or comes back to a node already on the path.
+	inCycle := make(map[string]bool)
+	for start := range after {
+		path := make(map[string]bool)
+		for id, ok := start, true; ok; id, ok = after[id] {
+			if path[id] {
+				for cycleID := id; ; {
+					inCycle[cycleID] = true
+					if cycleID = after[cycleID]; cycleID == id {
+						break
+					}
+				}
+				break
+			}
+			path[id] = true
+		}
+	}
+
+	ids := make([]string, 0, len(inCycle))
+	for id := range inCycle {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
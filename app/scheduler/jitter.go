@@ -0,0 +1,69 @@
+package scheduler
+
+import (
+	"log"
+	"math/rand"
+	"time"
+)
+
+// SetJitter sets the default maximum random delay added to recurring and cron
+// runs, so pipelines scheduled at the same minute don't all hit the LLM APIs
+// at once. Pipelines can override it with their own jitter.
+func (s *Scheduler) SetJitter(jitter time.Duration) {
+	s.jitter = jitter
+}
+
+// jitterDelay returns a random delay below the jitter of the pipeline, or of
+// the scheduler when the pipeline doesn't set one. One-time runs start on time.
+func (sp *ScheduledPipeline) jitterDelay(defaultJitter time.Duration) time.Duration {
+	if sp.ScheduleType != "recurring" && sp.ScheduleType != ScheduleTypeCron {
+		return 0
+	}
+	jitter := defaultJitter
+	if sp.Jitter > 0 {
+		jitter = time.Duration(sp.Jitter) * time.Second
+	} else if sp.Jitter < 0 {
+		return 0
+	}
+	if jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(jitter)))
+}
+
+// scheduleRun starts a due pipeline after its jitter delay. The pipeline is
+// tracked as pending meanwhile so later checks don't schedule it twice.
+func (s *Scheduler) scheduleRun(sp *ScheduledPipeline) {
+	delay := sp.jitterDelay(s.jitter)
+	if delay <= 0 {
+		go s.executePipeline(sp.ID)
+		return
+	}
+
+	pipelineID := sp.ID
+	s.pendingPipelinesMutex.Lock()
+	defer s.pendingPipelinesMutex.Unlock()
+	if _, pending := s.pendingPipelines[pipelineID]; pending {
+		return
+	}
+	if s.pendingPipelines == nil {
+		s.pendingPipelines = make(map[string]struct{})
+	}
+	s.pendingPipelines[pipelineID] = struct{}{}
+
+	log.Printf("Pipeline %s is due, starting in %v", pipelineID, delay.Round(time.Second))
+	time.AfterFunc(delay, func() {
+		s.pendingPipelinesMutex.Lock()
+		delete(s.pendingPipelines, pipelineID)
+		s.pendingPipelinesMutex.Unlock()
+		s.executePipeline(pipelineID)
+	})
+}
+
+// isPending reports whether a run of the pipeline is waiting for its jitter delay.
+func (s *Scheduler) isPending(pipelineID string) bool {
+	s.pendingPipelinesMutex.Lock()
+	defer s.pendingPipelinesMutex.Unlock()
+	_, pending := s.pendingPipelines[pipelineID]
+	return pending
+}
@@ -1,6 +1,7 @@
 package scheduler
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -211,6 +212,54 @@ func TestShouldRun(t *testing.T) {
 			now:  time.Date(2023, 3, 12, 2, 31, 0, 0, time.UTC), // Day of DST transition in the US
 			want: true,
 		},
+		// Cron expression tests, 2023-01-02 is a Monday
+		{
+			name: "Cron - Should run (every 2 hours on weekdays)",
+			pipeline: ScheduledPipeline{
+				ScheduleType:   ScheduleTypeCron,
+				CronExpression: "0 */2 * * 1-5",
+				LastRunTime:    time.Date(2023, 1, 2, 8, 0, 0, 0, time.UTC).Unix(),
+			},
+			now:  time.Date(2023, 1, 2, 10, 3, 0, 0, time.UTC),
+			want: true,
+		},
+		{
+			name: "Cron - Should not run (already run for this slot)",
+			pipeline: ScheduledPipeline{
+				ScheduleType:   ScheduleTypeCron,
+				CronExpression: "0 */2 * * 1-5",
+				LastRunTime:    time.Date(2023, 1, 2, 10, 1, 0, 0, time.UTC).Unix(),
+			},
+			now:  time.Date(2023, 1, 2, 10, 3, 0, 0, time.UTC),
+			want: false,
+		},
+		{
+			name: "Cron - Should not run (weekend)",
+			pipeline: ScheduledPipeline{
+				ScheduleType:   ScheduleTypeCron,
+				CronExpression: "0 */2 * * MON-FRI",
+			},
+			now:  time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC),
+			want: false,
+		},
+		{
+			name: "Cron - Should not run (outside window)",
+			pipeline: ScheduledPipeline{
+				ScheduleType:   ScheduleTypeCron,
+				CronExpression: "0 */2 * * 1-5",
+			},
+			now:  time.Date(2023, 1, 2, 11, 0, 0, 0, time.UTC),
+			want: false,
+		},
+		{
+			name: "Cron - Invalid expression",
+			pipeline: ScheduledPipeline{
+				ScheduleType:   ScheduleTypeCron,
+				CronExpression: "0 */2 * *",
+			},
+			now:  time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC),
+			want: false,
+		},
 
 	}
 
@@ -224,6 +273,43 @@ func TestShouldRun(t *testing.T) {
 }
 
 
+func TestParseCron(t *testing.T) {
+	for _, expr := range []string{"* * * *", "60 * * * *", "* * * 13 *", "5-1 * * * *", "*/0 * * * *", "* * * * funday"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) expected an error", expr)
+		}
+	}
+
+	tests := []struct {
+		expr string
+		now  time.Time
+		want time.Time
+	}{
+		{"30 9 * * *", time.Date(2023, 1, 2, 9, 0, 0, 0, time.UTC), time.Date(2023, 1, 1, 9, 30, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2023, 1, 2, 9, 44, 59, 0, time.UTC), time.Date(2023, 1, 2, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2023, 3, 15, 12, 0, 0, 0, time.UTC), time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)},
+		// Sunday as 7; 2023-01-08 is a Sunday
+		{"0 12 * * 7", time.Date(2023, 1, 10, 0, 0, 0, 0, time.UTC), time.Date(2023, 1, 8, 12, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: the 15th or any Monday
+		{"0 0 15 * 1", time.Date(2023, 1, 14, 0, 0, 0, 0, time.UTC), time.Date(2023, 1, 9, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		schedule, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+		}
+		got, ok := schedule.Prev(tt.now)
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("%q.Prev(%v) = %v, %v, want %v", tt.expr, tt.now, got, ok, tt.want)
+		}
+	}
+
+	impossible, _ := ParseCron("0 0 31 2 *")
+	if _, ok := impossible.Prev(time.Now()); ok {
+		t.Error("expected no match for February 31st")
+	}
+}
+
 func TestFetchScheduledPipelines(t *testing.T) {
 	// Setup a mock HTTP server
 	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -552,3 +638,325 @@ func TestFetchFullPipeline(t *testing.T) {
 func contains(s, substr string) bool {
     return strings.Contains(s, substr)
 }
+
+func TestFindDependencyCycles(t *testing.T) {
+    pipelines := []*ScheduledPipeline{
+        {ID: "publish", ScheduleType: "recurring"},
+        {ID: "metrics", ScheduleType: ScheduleTypeAfterPipeline, AfterPipelineID: "publish"},
+        {ID: "a", ScheduleType: ScheduleTypeAfterPipeline, AfterPipelineID: "b"},
+        {ID: "b", ScheduleType: ScheduleTypeAfterPipeline, AfterPipelineID: "c"},
+        {ID: "c", ScheduleType: ScheduleTypeAfterPipeline, AfterPipelineID: "a"},
+        {ID: "d", ScheduleType: ScheduleTypeAfterPipeline, AfterPipelineID: "a"},
+        {ID: "self", ScheduleType: ScheduleTypeAfterPipeline, AfterPipelineID: "self"},
+    }
+
+    got := strings.Join(FindDependencyCycles(pipelines), ",")
+    if got != "a,b,c,self" {
+        t.Errorf("Expected cycle a,b,c,self, got %s", got)
+    }
+}
+
+func TestChainedPipelineRunsAfterSuccess(t *testing.T) {
+    var mu sync.Mutex
+    var executed []string
+    done := make(chan struct{})
+
+    s := &Scheduler{
+        fetchPipelineFunc: func(id, apiHost, apiEndpoint string) (pipeline_type.Pipeline, error) {
+            return pipeline_type.Pipeline{ID: id}, nil
+        },
+        executePipelineFunc: func(executionID string, p *pipeline_type.Pipeline, registry *plugin_registry.PluginRegistry) error {
+            mu.Lock()
+            executed = append(executed, p.ID)
+            mu.Unlock()
+            if p.ID == "metrics" {
+                close(done)
+            }
+            return nil
+        },
+        runningPipelines: make(map[string]struct{}),
+    }
+    s.updateDependencies([]*ScheduledPipeline{
+        {ID: "publish", ScheduleType: "recurring"},
+        {ID: "metrics", ScheduleType: ScheduleTypeAfterPipeline, AfterPipelineID: "publish"},
+    })
+
+    s.executePipeline("publish")
+
+    select {
+    case <-done:
+    case <-time.After(1 * time.Second):
+        t.Fatal("Chained pipeline was not executed")
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+    if strings.Join(executed, ",") != "publish,metrics" {
+        t.Errorf("Expected publish then metrics, got %v", executed)
+    }
+}
+
+func TestJitterDelay(t *testing.T) {
+    recurring := &ScheduledPipeline{ScheduleType: "recurring"}
+    for i := 0; i < 100; i++ {
+        if d := recurring.jitterDelay(time.Minute); d < 0 || d >= time.Minute {
+            t.Fatalf("Delay %v outside of [0, 1m)", d)
+        }
+    }
+    if d := (&ScheduledPipeline{ScheduleType: "recurring", Jitter: 2}).jitterDelay(time.Hour); d >= 2*time.Second {
+        t.Errorf("Expected the pipeline jitter to override the default, got %v", d)
+    }
+    if d := (&ScheduledPipeline{ScheduleType: "recurring", Jitter: -1}).jitterDelay(time.Hour); d != 0 {
+        t.Errorf("Expected a negative jitter to disable the delay, got %v", d)
+    }
+    if d := (&ScheduledPipeline{ScheduleType: "one_time"}).jitterDelay(time.Hour); d != 0 {
+        t.Errorf("Expected one-time runs to start on time, got %v", d)
+    }
+}
+
+func TestScheduleRunWithJitterRunsOnce(t *testing.T) {
+    var executions int32
+    done := make(chan struct{}, 2)
+    s := &Scheduler{
+        fetchPipelineFunc: func(id, apiHost, apiEndpoint string) (pipeline_type.Pipeline, error) {
+            return pipeline_type.Pipeline{ID: id}, nil
+        },
+        executePipelineFunc: func(executionID string, p *pipeline_type.Pipeline, registry *plugin_registry.PluginRegistry) error {
+            atomic.AddInt32(&executions, 1)
+            done <- struct{}{}
+            return nil
+        },
+        runningPipelines: make(map[string]struct{}),
+    }
+    s.SetJitter(50 * time.Millisecond)
+
+    sp := &ScheduledPipeline{ID: "morning-digest", ScheduleType: "recurring"}
+    s.scheduleRun(sp)
+    s.scheduleRun(sp)
+
+    select {
+    case <-done:
+    case <-time.After(1 * time.Second):
+        t.Fatal("Pipeline was not executed")
+    }
+    time.Sleep(100 * time.Millisecond)
+    if n := atomic.LoadInt32(&executions); n != 1 {
+        t.Errorf("Expected one jittered run, got %d", n)
+    }
+}
+
+func TestWorkerPoolCapsConcurrency(t *testing.T) {
+    release := make(chan struct{})
+    var running, maxRunning, executed int32
+    completed := make(chan string, 3)
+
+    s := &Scheduler{
+        fetchPipelineFunc: func(id, apiHost, apiEndpoint string) (pipeline_type.Pipeline, error) {
+            return pipeline_type.Pipeline{ID: id}, nil
+        },
+        executePipelineFunc: func(executionID string, p *pipeline_type.Pipeline, registry *plugin_registry.PluginRegistry) error {
+            n := atomic.AddInt32(&running, 1)
+            for {
+                m := atomic.LoadInt32(&maxRunning)
+                if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+                    break
+                }
+            }
+            <-release
+            atomic.AddInt32(&running, -1)
+            atomic.AddInt32(&executed, 1)
+            return nil
+        },
+        runningPipelines:   make(map[string]struct{}),
+        onPipelineComplete: func(pipelineID string) { completed <- pipelineID },
+    }
+    s.SetConcurrency(1, 1)
+
+    s.executePipeline("first")
+    waitFor(t, func() bool { return s.QueueStats().Running == 1 })
+    s.executePipeline("second")
+    waitFor(t, func() bool { return s.QueueStats().Queued == 1 })
+
+    // The queue is full, the third pipeline is skipped
+    s.executePipeline("third")
+    if id := <-completed; id != "third" {
+        t.Fatalf("Expected the third pipeline to be skipped first, got %s", id)
+    }
+
+    close(release)
+    <-completed
+    <-completed
+
+    if m := atomic.LoadInt32(&maxRunning); m != 1 {
+        t.Errorf("Expected at most 1 concurrent execution, got %d", m)
+    }
+    if n := atomic.LoadInt32(&executed); n != 2 {
+        t.Errorf("Expected 2 executions, got %d", n)
+    }
+    if stats := s.QueueStats(); stats.Running != 0 || stats.Queued != 0 {
+        t.Errorf("Expected an idle pool, got %+v", stats)
+    }
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+    t.Helper()
+    deadline := time.Now().Add(time.Second)
+    for !condition() {
+        if time.Now().After(deadline) {
+            t.Fatal("Timed out waiting for condition")
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+}
+
+func TestMissedRuns(t *testing.T) {
+    now := time.Date(2023, 1, 5, 12, 0, 0, 0, time.UTC)
+    daily := &ScheduledPipeline{
+        ScheduleType:       "recurring",
+        RecurringFrequency: "daily",
+        RecurringTime:      "09:00",
+        LastRunTime:        time.Date(2023, 1, 2, 9, 1, 0, 0, time.UTC).Unix(),
+    }
+    missed := daily.missedRuns(now)
+    if len(missed) != 3 || !missed[0].Equal(time.Date(2023, 1, 3, 9, 0, 0, 0, time.UTC)) {
+        t.Errorf("Expected the runs of Jan 3 to 5, got %v", missed)
+    }
+
+    // The run still inside its window is left to ShouldRun
+    inWindow := &ScheduledPipeline{
+        ScheduleType:   ScheduleTypeCron,
+        CronExpression: "58 11 * * *",
+        LastRunTime:    time.Date(2023, 1, 4, 11, 58, 0, 0, time.UTC).Unix(),
+    }
+    if missed := inWindow.missedRuns(now); len(missed) != 0 {
+        t.Errorf("Expected no missed runs, got %v", missed)
+    }
+
+    if missed := (&ScheduledPipeline{ScheduleType: "recurring", RecurringFrequency: "daily", RecurringTime: "09:00"}).missedRuns(now); missed != nil {
+        t.Errorf("Expected no catch-up for a pipeline that never ran, got %v", missed)
+    }
+}
+
+func TestCatchUpPolicies(t *testing.T) {
+    var mu sync.Mutex
+    executions := make(map[string]int)
+    completed := make(chan string, 10)
+
+    s := &Scheduler{
+        fetchPipelineFunc: func(id, apiHost, apiEndpoint string) (pipeline_type.Pipeline, error) {
+            return pipeline_type.Pipeline{ID: id}, nil
+        },
+        executePipelineFunc: func(executionID string, p *pipeline_type.Pipeline, registry *plugin_registry.PluginRegistry) error {
+            mu.Lock()
+            executions[p.ID]++
+            mu.Unlock()
+            return nil
+        },
+        runningPipelines:   make(map[string]struct{}),
+        onPipelineComplete: func(pipelineID string) { completed <- pipelineID },
+    }
+
+    now := time.Date(2023, 1, 5, 12, 0, 0, 0, time.UTC)
+    lastRun := time.Date(2023, 1, 2, 9, 1, 0, 0, time.UTC).Unix()
+    schedule := func(id, policy string) *ScheduledPipeline {
+        return &ScheduledPipeline{ID: id, ScheduleType: "recurring", RecurringFrequency: "daily",
+            RecurringTime: "09:00", LastRunTime: lastRun, CatchUpPolicy: policy}
+    }
+    s.catchUp([]*ScheduledPipeline{
+        schedule("skip", CatchUpSkip),
+        schedule("once", CatchUpRunOnce),
+        schedule("all", CatchUpRunAllMissed),
+    }, now)
+
+    for i := 0; i < 4; i++ {
+        select {
+        case <-completed:
+        case <-time.After(time.Second):
+            t.Fatal("Timed out waiting for catch-up runs")
+        }
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+    if executions["skip"] != 0 || executions["once"] != 1 || executions["all"] != 3 {
+        t.Errorf("Unexpected catch-up runs: %v", executions)
+    }
+}
+
+func TestStateStoreSurvivesRestart(t *testing.T) {
+    path := t.TempDir() + "/scheduler_state.json"
+    startedAt := time.Date(2023, 1, 2, 9, 0, 30, 0, time.UTC)
+
+    store := NewStateStore(path)
+    store.RecordStart("finished", "exec-1", startedAt)
+    store.RecordFinish("finished")
+    // The process dies during this one
+    store.RecordStart("interrupted", "exec-2", startedAt)
+
+    s := &Scheduler{}
+    s.SetStateStore(NewStateStore(path))
+
+    for _, id := range []string{"finished", "interrupted"} {
+        sp := &ScheduledPipeline{
+            ID:                 id,
+            ScheduleType:       "recurring",
+            RecurringFrequency: "daily",
+            RecurringTime:      "09:00",
+        }
+        s.applyLocalState(sp)
+        if sp.LastRunTime != startedAt.Unix() {
+            t.Errorf("%s: expected the local last run, got %d", id, sp.LastRunTime)
+        }
+        if sp.ShouldRun(time.Date(2023, 1, 2, 9, 3, 0, 0, time.UTC)) {
+            t.Errorf("%s: should not run twice for the same schedule", id)
+        }
+    }
+
+    if inFlight := NewStateStore(path).RecoverInterrupted(); len(inFlight) != 0 {
+        t.Errorf("Expected the interrupted run to be recovered once, got %v", inFlight)
+    }
+}
+
+func TestRunNowSharesDuplicateRunProtection(t *testing.T) {
+    release := make(chan struct{})
+    var executions int32
+    s := &Scheduler{
+        fetchPipelineFunc: func(id, apiHost, apiEndpoint string) (pipeline_type.Pipeline, error) {
+            return pipeline_type.Pipeline{ID: id, ExecutionFailures: MaxExecutionFailures}, nil
+        },
+        executePipelineFunc: func(executionID string, p *pipeline_type.Pipeline, registry *plugin_registry.PluginRegistry) error {
+            atomic.AddInt32(&executions, 1)
+            <-release
+            return nil
+        },
+        runningPipelines: make(map[string]struct{}),
+    }
+
+    // Failures don't stop a run asked for explicitly
+    executionID, err := s.RunNow("run-now")
+    if err != nil || executionID == "" {
+        t.Fatalf("expected the run to start, got %q, %v", executionID, err)
+    }
+    if _, err := s.RunNow("run-now"); !errors.Is(err, ErrAlreadyRunning) {
+        t.Errorf("expected ErrAlreadyRunning, got %v", err)
+    }
+    if done := s.startPipeline("run-now"); done != nil {
+        t.Error("expected the schedule not to start a second run")
+    }
+
+    close(release)
+    deadline := time.Now().Add(2 * time.Second)
+    for s.isRunning("run-now") && time.Now().Before(deadline) {
+        time.Sleep(10 * time.Millisecond)
+    }
+    if atomic.LoadInt32(&executions) != 1 {
+        t.Errorf("expected 1 execution, got %d", executions)
+    }
+}
+
+func (s *Scheduler) isRunning(pipelineID string) bool {
+    s.runningPipelinesMutex.Lock()
+    defer s.runningPipelinesMutex.Unlock()
+    _, running := s.runningPipelines[pipelineID]
+    return running
+}
@@ -2,6 +2,7 @@ package scheduler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -13,12 +14,21 @@ import (
 	"github.com/serisow/lesocle/pipeline"
 	"github.com/serisow/lesocle/pipeline_type"
 	"github.com/serisow/lesocle/plugin_registry"
+	"github.com/serisow/lesocle/sla"
 )
 
 const (
     MaxExecutionFailures = 3
 )
 
+var (
+    // ErrAlreadyRunning is returned when an execution of the pipeline is in
+    // progress.
+    ErrAlreadyRunning = errors.New("pipeline is already running")
+    // ErrBackingOff is returned when a failing pipeline waits for its backoff.
+    ErrBackingOff = errors.New("pipeline is backing off after failures")
+)
+
 
 type Scheduler struct {
 	apiHost       string
@@ -34,6 +44,36 @@ type Scheduler struct {
 
 	runningPipelinesMutex sync.Mutex
     runningPipelines      map[string]struct{}
+	// The execution of each running pipeline, for the watchdog
+	runningExecutions map[string]runningExecution
+	// Executions running longer are cancelled, 0 disables the watchdog
+	maxDuration time.Duration
+
+	// Pipelines chained after another one, keyed by the upstream pipeline ID
+	dependentsMutex sync.RWMutex
+	dependents      map[string][]*ScheduledPipeline
+
+	// Random delay added to recurring runs, and the runs waiting for it
+	jitter                time.Duration
+	pendingPipelinesMutex sync.Mutex
+	pendingPipelines      map[string]struct{}
+
+	// Worker pool: one slot per running execution, nil when uncapped
+	slots     chan struct{}
+	queued    int32
+	queueSize int
+
+	// Set once the missed runs were handled after startup
+	caughtUp bool
+
+	// Local last runs and in-flight markers, nil when not persisted
+	state *StateStore
+
+	// Claims scheduled runs when several instances run, nil for a single one
+	claimer RunClaimer
+
+	// Backoff after failures, nil to skip pipelines after MaxExecutionFailures
+	failures *FailureTracker
 
 }
 
@@ -44,7 +84,18 @@ type ScheduledPipeline struct {
 	ScheduledTime    int64  `json:"scheduled_time"`
 	RecurringFrequency string `json:"recurring_frequency"`
 	RecurringTime    string `json:"recurring_time"`
+	CronExpression     string `json:"cron_expression,omitempty"`
     LastRunTime        int64  `json:"last_run_time"`
+	// Set for "after_pipeline" schedules, the delay is in seconds
+	AfterPipelineID    string `json:"after_pipeline_id,omitempty"`
+	AfterDelay         int    `json:"after_delay,omitempty"`
+	SLA                *pipeline_type.SLAConfig `json:"sla,omitempty"`
+	// Maximum random delay in seconds, overrides the scheduler default, -1 disables it
+	Jitter             int    `json:"jitter,omitempty"`
+	// What to do on startup with the runs missed while the service was down
+	CatchUpPolicy      string `json:"catch_up_policy,omitempty"`
+	// Periods during which the pipeline is not started
+	BlackoutWindows    []BlackoutWindow `json:"blackout_windows,omitempty"`
 
 }
 
@@ -55,7 +106,7 @@ func New(apiHost, apiEndpoint string, checkInterval time.Duration, registry *plu
 		apiEndpoint:   apiEndpoint,
 		checkInterval: checkInterval,
 		registry:      registry,
-		fetchPipelineFunc:  fetchFullPipeline,
+		fetchPipelineFunc:  FetchFullPipeline,
         executePipelineFunc: pipeline.ExecutePipeline,
 		runningPipelines:     make(map[string]struct{}),
 		cronURL:        cronURL,
@@ -74,10 +125,33 @@ func (s *Scheduler) Start() {
 			continue
 		}
 
+		s.updateDependencies(scheduledPipelines)
+
+		for _, sp := range scheduledPipelines {
+			s.applyLocalState(sp)
+			for _, w := range sp.BlackoutWindows {
+				if err := w.Validate(); err != nil {
+					log.Printf("Pipeline %s: ignoring blackout window: %v", sp.ID, err)
+				}
+			}
+		}
+
 		now := time.Now()
+		if !s.caughtUp {
+			s.catchUp(scheduledPipelines, now)
+			s.caughtUp = true
+		}
 		for _, sp := range scheduledPipelines {
 			if sp.ShouldRun(now) {
-				go s.executePipeline(sp.ID)
+				if !sp.blackoutGate(now) {
+					continue
+				}
+				if !s.claimRun(sp.ID, sp.runTime(now)) {
+					continue
+				}
+				s.scheduleRun(sp)
+			} else {
+				s.checkMissedStart(sp, now)
 			}
 		}
 
@@ -107,7 +181,17 @@ func (s *Scheduler) StartCronTrigger() {
 
 
 func (s *Scheduler) fetchScheduledPipelines() ([]*ScheduledPipeline, error) {
-	url := fmt.Sprintf("%s/%s", s.apiEndpoint, "pipelines/scheduled")
+    return FetchScheduledPipelines(s.apiHost, s.apiEndpoint)
+}
+
+// FetchScheduledPipelines returns the schedules of the pipelines, from Drupal
+// unless another Source is set.
+func FetchScheduledPipelines(apiHost, apiEndpoint string) ([]*ScheduledPipeline, error) {
+	return source(apiHost, apiEndpoint).ScheduledPipelines()
+}
+
+func fetchScheduledPipelines(apiHost, apiEndpoint string) ([]*ScheduledPipeline, error) {
+	url := fmt.Sprintf("%s/%s", apiEndpoint, "pipelines/scheduled")
 
     // Create a new request instead of using http.Get
     req, err := http.NewRequest("GET", url, nil)
@@ -116,7 +200,7 @@ func (s *Scheduler) fetchScheduledPipelines() ([]*ScheduledPipeline, error) {
     }
     
     // Add the Host header
-    req.Host = s.apiHost
+    req.Host = apiHost
     
     // Use http.DefaultClient to make the request
     resp, err := http.DefaultClient.Do(req)
@@ -141,56 +225,131 @@ func (s *Scheduler) fetchScheduledPipelines() ([]*ScheduledPipeline, error) {
 }
 
 func (s *Scheduler) executePipeline(pipelineID string) {
+    s.startPipeline(pipelineID)
+}
+
+// startPipeline starts an execution of the pipeline in the background and
+// returns a channel closed once it finished, or nil when it didn't start.
+func (s *Scheduler) startPipeline(pipelineID string) <-chan struct{} {
+    // Maintenance mode, kill switches and paused schedules stop new runs, not
+    // the ones in flight
+    if err := pipeline.Controls.CanSchedule(pipelineID); err != nil {
+        log.Printf("Skipping pipeline %s: %v", pipelineID, err)
+        return nil
+    }
+
+    _, done, err := s.launch(pipelineID, true)
+    // Runs already in progress or backing off are expected, and the backoff
+    // logs itself
+    if err != nil && !errors.Is(err, ErrAlreadyRunning) && !errors.Is(err, ErrBackingOff) {
+        log.Printf("Skipping pipeline %s: %v", pipelineID, err)
+    }
+    return done
+}
+
+// RunNow starts an execution of the pipeline right away, outside of its
+// schedule, and returns its ID. It fails with ErrAlreadyRunning when the
+// pipeline is running. Paused schedules and failure backoff don't apply, nor
+// does the worker pool, the caller asked for this run.
+func (s *Scheduler) RunNow(pipelineID string) (string, error) {
+    if err := pipeline.Controls.CanStart(pipelineID); err != nil {
+        return "", err
+    }
+    executionID, _, err := s.launch(pipelineID, false)
+    return executionID, err
+}
+
+// launch fetches the pipeline and executes it in the background, once at a
+// time per pipeline. Scheduled runs are subject to the failure backoff and
+// wait for a slot of the worker pool.
+func (s *Scheduler) launch(pipelineID string, scheduled bool) (string, <-chan struct{}, error) {
+    executionID := uuid.New().String()
+
     s.runningPipelinesMutex.Lock()
     if _, exists := s.runningPipelines[pipelineID]; exists {
         s.runningPipelinesMutex.Unlock()
-        return
+        return "", nil, ErrAlreadyRunning
     }
     s.runningPipelines[pipelineID] = struct{}{}
+    if s.runningExecutions == nil {
+        s.runningExecutions = make(map[string]runningExecution)
+    }
+    s.runningExecutions[pipelineID] = runningExecution{ID: executionID, StartedAt: time.Now()}
     s.runningPipelinesMutex.Unlock()
 
+    // The watchdog may have released a stuck execution, and the pipeline be
+    // running again since
+    release := func() {
+        s.runningPipelinesMutex.Lock()
+        if s.runningExecutions[pipelineID].ID == executionID {
+            delete(s.runningPipelines, pipelineID)
+            delete(s.runningExecutions, pipelineID)
+        }
+        s.runningPipelinesMutex.Unlock()
+    }
+
     fullPipeline, err := s.fetchPipelineFunc(pipelineID, s.apiHost, s.apiEndpoint)
     if err != nil {
-        log.Printf("Error fetching full pipeline %s: %v", pipelineID, err)
         // Remove from runningPipelines since execution won't proceed
-        s.runningPipelinesMutex.Lock()
-        delete(s.runningPipelines, pipelineID)
-        s.runningPipelinesMutex.Unlock()
-        return
+        release()
+        return "", nil, fmt.Errorf("error fetching full pipeline: %w", err)
     }
 
 	// Check failure count before executing
-	if fullPipeline.ExecutionFailures >= MaxExecutionFailures {
-		log.Printf("Pipeline %s has failed %d times consecutively. Skipping execution.", 
-			pipelineID, fullPipeline.ExecutionFailures)
-		s.runningPipelinesMutex.Lock()
-		delete(s.runningPipelines, pipelineID)
-		s.runningPipelinesMutex.Unlock()
-		return
+	if scheduled && !s.failureGate(pipelineID, fullPipeline.ExecutionFailures) {
+		release()
+		return "", nil, ErrBackingOff
 	}
 
-    executionID := uuid.New().String()
-
-
-
+    done := make(chan struct{})
     go func() {
         defer func() {
-            s.runningPipelinesMutex.Lock()
-            delete(s.runningPipelines, pipelineID)
-            s.runningPipelinesMutex.Unlock()
+            release()
 			// Call the completion callback if it's set
 			if s.onPipelineComplete != nil {
 				s.onPipelineComplete(pipelineID)
 			}
+            close(done)
         }()
 
-        err = s.executePipelineFunc(executionID, &fullPipeline, s.registry)
+        if scheduled {
+            if !s.acquireSlot(pipelineID) {
+                return
+            }
+            defer s.releaseSlot()
+        }
+
+        if s.state != nil {
+            s.state.RecordStart(pipelineID, executionID, time.Now())
+            defer func() {
+                if s.ownsRun(pipelineID, executionID) {
+                    s.state.RecordFinish(pipelineID)
+                }
+            }()
+        }
+
+        slaDone := sla.Default.Watch(pipelineID, executionID, fullPipeline.SLA)
+        err := s.executePipelineFunc(executionID, &fullPipeline, s.registry)
+        slaDone()
         if err != nil {
             log.Printf("Error executing pipeline %s: %v", pipelineID, err)
+            // Keep the execution that exhausted the retries so it can be re-driven
+            if s.failureCount(pipelineID, fullPipeline.ExecutionFailures) == MaxExecutionFailures {
+                if dlErr := pipeline.SaveDeadLetter(pipeline.NewDeadLetter(executionID, &fullPipeline, err)); dlErr != nil {
+                    log.Printf("Error saving dead letter for pipeline %s: %v", pipelineID, dlErr)
+                } else {
+                    log.Printf("Pipeline %s exhausted its retries, execution %s moved to the dead-letter store", pipelineID, executionID)
+                }
+            }
         } else {
             log.Printf("Successfully executed pipeline %s", pipelineID)
+            if s.failures != nil {
+                s.failures.RecordSuccess(pipelineID)
+            }
+            s.triggerDependents(pipelineID)
         }
     }()
+    return executionID, done, nil
 }
 
 func fetchFullPipeline(id, apiHost, apiEndpoint string) (pipeline_type.Pipeline, error) {
@@ -233,6 +392,8 @@ func fetchFullPipeline(id, apiHost, apiEndpoint string) (pipeline_type.Pipeline,
 }
 
 
+// ShouldRun reports whether a time-based schedule is due. Chained pipelines
+// never are, they are started when the pipeline they follow succeeds.
 func (sp *ScheduledPipeline) ShouldRun(now time.Time) bool {
 	switch sp.ScheduleType {
 	case "one_time":
@@ -272,13 +433,32 @@ func (sp *ScheduledPipeline) ShouldRun(now time.Time) bool {
 		case "monthly":
 			return now.Day() == 1 && isWithinWindow && hasNotRunToday
 		}
+	case ScheduleTypeCron:
+		scheduledTime, ok := sp.lastCronTime(now)
+		if !ok {
+			return false
+		}
+		// Same 5 minute grace period as recurring schedules
+		return now.Before(scheduledTime.Add(5*time.Minute)) && sp.LastRunTime < scheduledTime.Unix()
 	}
 	return false
 }
 
-// FetchFullPipeline fetches a full pipeline by ID
+// lastCronTime returns the latest time, not after now, matched by the cron
+// expression of the pipeline.
+func (sp *ScheduledPipeline) lastCronTime(now time.Time) (time.Time, bool) {
+	schedule, err := ParseCron(sp.CronExpression)
+	if err != nil {
+		log.Printf("Pipeline %s: %v", sp.ID, err)
+		return time.Time{}, false
+	}
+	return schedule.Prev(now)
+}
+
+// FetchFullPipeline fetches a full pipeline by ID, from Drupal unless another
+// Source is set.
 func FetchFullPipeline(id, apiHost, apiEndpoint string) (pipeline_type.Pipeline, error) {
-	return fetchFullPipeline(id, apiHost, apiEndpoint)
+	return source(apiHost, apiEndpoint).Pipeline(id)
 }
 
 func (s *Scheduler) triggerCron() error {
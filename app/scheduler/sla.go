@@ -0,0 +1,71 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/serisow/lesocle/pipeline"
+	"github.com/serisow/lesocle/sla"
+)
+
+// checkMissedStart alerts when the latest scheduled run of a pipeline didn't
+// start within the start window of its SLA.
+func (s *Scheduler) checkMissedStart(sp *ScheduledPipeline, now time.Time) {
+	if sp.SLA == nil || sp.SLA.StartWindow <= 0 {
+		return
+	}
+	// Runs held back on purpose are not SLA breaches
+	if pipeline.Controls.CanSchedule(sp.ID) != nil {
+		return
+	}
+	scheduledAt, ok := sp.lastScheduledTime(now)
+	if !ok {
+		return
+	}
+	if _, blackedOut := sp.blackedOut(scheduledAt); blackedOut {
+		return
+	}
+
+	window := time.Duration(sp.SLA.StartWindow) * time.Second
+	if now.Before(scheduledAt.Add(window)) || sp.LastRunTime >= scheduledAt.Unix() {
+		return
+	}
+
+	s.runningPipelinesMutex.Lock()
+	_, running := s.runningPipelines[sp.ID]
+	s.runningPipelinesMutex.Unlock()
+	if running || s.isPending(sp.ID) {
+		return
+	}
+
+	sla.Default.MissedStart(sp.ID, scheduledAt, window)
+}
+
+// lastScheduledTime returns the most recent time, not after now, at which the
+// pipeline was scheduled to run.
+func (sp *ScheduledPipeline) lastScheduledTime(now time.Time) (time.Time, bool) {
+	switch sp.ScheduleType {
+	case "one_time":
+		scheduledTime := time.Unix(sp.ScheduledTime, 0)
+		return scheduledTime, !scheduledTime.After(now)
+	case "recurring":
+		scheduleTime, err := time.Parse("15:04", sp.RecurringTime)
+		if err != nil {
+			return time.Time{}, false
+		}
+		scheduledDateTime := time.Date(now.Year(), now.Month(), now.Day(), scheduleTime.Hour(), scheduleTime.Minute(), 0, 0, now.Location())
+		if scheduledDateTime.After(now) {
+			return time.Time{}, false
+		}
+		switch sp.RecurringFrequency {
+		case "daily":
+			return scheduledDateTime, true
+		case "weekly":
+			return scheduledDateTime, now.Weekday() == time.Monday
+		case "monthly":
+			return scheduledDateTime, now.Day() == 1
+		}
+	case ScheduleTypeCron:
+		return sp.lastCronTime(now)
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,137 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+// PipelineSource provides the pipeline definitions and their schedules.
+type PipelineSource interface {
+	ScheduledPipelines() ([]*ScheduledPipeline, error)
+	Pipeline(id string) (pipeline_type.Pipeline, error)
+}
+
+// Source replaces Drupal as the source of the pipelines when set by main.
+var Source PipelineSource
+
+// DrupalSource fetches the pipelines from the Drupal API.
+type DrupalSource struct {
+	APIHost     string
+	APIEndpoint string
+}
+
+// ScheduledPipelines implements PipelineSource.
+func (d DrupalSource) ScheduledPipelines() ([]*ScheduledPipeline, error) {
+	return fetchScheduledPipelines(d.APIHost, d.APIEndpoint)
+}
+
+// Pipeline implements PipelineSource.
+func (d DrupalSource) Pipeline(id string) (pipeline_type.Pipeline, error) {
+	return fetchFullPipeline(id, d.APIHost, d.APIEndpoint)
+}
+
+// source returns Source, or Drupal at apiHost and apiEndpoint when unset.
+func source(apiHost, apiEndpoint string) PipelineSource {
+	if Source != nil {
+		return Source
+	}
+	return DrupalSource{APIHost: apiHost, APIEndpoint: apiEndpoint}
+}
+
+// DirectorySource reads the pipelines from the JSON files of a directory, one
+// pipeline per file in the format served by Drupal, so the engine runs
+// without Drupal. A file with a schedule_type is also a schedule, its fields
+// being those of ScheduledPipeline. The ID defaults to the file name.
+//
+// Files are read on every call, edits apply at the next scheduler check.
+type DirectorySource struct {
+	Dir string
+}
+
+// ScheduledPipelines implements PipelineSource.
+func (d DirectorySource) ScheduledPipelines() ([]*ScheduledPipeline, error) {
+	paths, err := d.files()
+	if err != nil {
+		return nil, err
+	}
+	var scheduled []*ScheduledPipeline
+	for _, path := range paths {
+		var sp ScheduledPipeline
+		if err := readPipelineFile(path, &sp); err != nil {
+			log.Printf("Skipping pipeline file %s: %v", path, err)
+			continue
+		}
+		if sp.ScheduleType == "" {
+			continue
+		}
+		if sp.ID == "" {
+			sp.ID = fileID(path)
+		}
+		scheduled = append(scheduled, &sp)
+	}
+	return scheduled, nil
+}
+
+// Pipeline implements PipelineSource.
+func (d DirectorySource) Pipeline(id string) (pipeline_type.Pipeline, error) {
+	paths, err := d.files()
+	if err != nil {
+		return pipeline_type.Pipeline{}, err
+	}
+	for _, path := range paths {
+		var p pipeline_type.Pipeline
+		if err := readPipelineFile(path, &p); err != nil {
+			if fileID(path) == id {
+				return pipeline_type.Pipeline{}, err
+			}
+			continue
+		}
+		if p.ID == "" {
+			p.ID = fileID(path)
+		}
+		if p.ID == id {
+			p.Context = pipeline_type.NewContext()
+			return p, nil
+		}
+	}
+	return pipeline_type.Pipeline{}, fmt.Errorf("pipeline %s not found in %s", id, d.Dir)
+}
+
+// files returns the pipeline files of the directory, sorted.
+func (d DirectorySource) files() ([]string, error) {
+	entries, err := os.ReadDir(d.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pipeline directory: %w", err)
+	}
+	var paths []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".json") {
+			continue
+		}
+		paths = append(paths, filepath.Join(d.Dir, entry.Name()))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func readPipelineFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid pipeline JSON: %w", err)
+	}
+	return nil
+}
+
+func fileID(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
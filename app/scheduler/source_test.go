@@ -0,0 +1,52 @@
+package scheduler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirectorySource(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"daily_digest.json": `{"label": "Daily digest", "schedule_type": "recurring", "recurring_frequency": "daily", "recurring_time": "08:00",
+			"steps": [{"id": "write", "type": "llm_step", "step_output_key": "digest"}]}`,
+		"on_demand.json": `{"id": "adhoc", "label": "On demand", "steps": []}`,
+		"broken.json":    `{`,
+		"notes.txt":      `not a pipeline`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	saved := Source
+	Source = DirectorySource{Dir: dir}
+	defer func() { Source = saved }()
+
+	scheduled, err := FetchScheduledPipelines("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scheduled) != 1 || scheduled[0].ID != "daily_digest" || scheduled[0].RecurringTime != "08:00" {
+		t.Fatalf("expected the daily digest schedule only, got %+v", scheduled)
+	}
+
+	p, err := FetchFullPipeline("daily_digest", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Label != "Daily digest" || len(p.Steps) != 1 || p.Context == nil {
+		t.Errorf("unexpected pipeline %+v", p)
+	}
+	if _, err := FetchFullPipeline("adhoc", "", ""); err != nil {
+		t.Errorf("pipeline with an explicit ID should be found: %v", err)
+	}
+	if _, err := FetchFullPipeline("broken", "", ""); err == nil {
+		t.Error("invalid pipeline file should be reported")
+	}
+	if _, err := FetchFullPipeline("missing", "", ""); err == nil {
+		t.Error("unknown pipeline should be reported")
+	}
+}
@@ -0,0 +1,164 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// InFlightRun marks a scheduled execution that started and hasn't finished.
+type InFlightRun struct {
+	ExecutionID string `json:"execution_id"`
+	StartedAt   int64  `json:"started_at"`
+}
+
+// StateStore keeps the scheduler state on local disk so a restart doesn't
+// lose it: the last run of every pipeline, which Drupal may not know yet, and
+// the executions in flight.
+//
+// The state is a single JSON file rather than a bolt or SQLite database: the
+// module has neither, SQLite needs cgo, and the state is a few hundred bytes
+// per pipeline written once per run. The file is replaced with fsync and an
+// atomic rename, so a crash leaves either the previous or the new state.
+type StateStore struct {
+	sync.Mutex
+	path  string
+	state schedulerState
+}
+
+type schedulerState struct {
+	LastRuns map[string]int64       `json:"last_runs"`
+	InFlight map[string]InFlightRun `json:"in_flight"`
+}
+
+// NewStateStore creates a state store persisted at path, loading the previous
+// state.
+func NewStateStore(path string) *StateStore {
+	s := &StateStore{path: path, state: schedulerState{
+		LastRuns: make(map[string]int64),
+		InFlight: make(map[string]InFlightRun),
+	}}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &s.state); err != nil {
+			log.Printf("Error loading scheduler state from %s: %v", path, err)
+		}
+		if s.state.LastRuns == nil {
+			s.state.LastRuns = make(map[string]int64)
+		}
+		if s.state.InFlight == nil {
+			s.state.InFlight = make(map[string]InFlightRun)
+		}
+	}
+	return s
+}
+
+// RecordStart marks an execution of the pipeline as in flight.
+func (s *StateStore) RecordStart(pipelineID, executionID string, startedAt time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	s.state.InFlight[pipelineID] = InFlightRun{ExecutionID: executionID, StartedAt: startedAt.Unix()}
+	s.save()
+}
+
+// RecordFinish clears the in-flight marker and records the run, whatever its
+// outcome, as the last run of the pipeline.
+func (s *StateStore) RecordFinish(pipelineID string) {
+	s.Lock()
+	defer s.Unlock()
+	if run, ok := s.state.InFlight[pipelineID]; ok {
+		s.state.LastRuns[pipelineID] = max(s.state.LastRuns[pipelineID], run.StartedAt)
+		delete(s.state.InFlight, pipelineID)
+	}
+	s.save()
+}
+
+// LastRun returns the start time of the last run of the pipeline, 0 if unknown.
+func (s *StateStore) LastRun(pipelineID string) int64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.state.LastRuns[pipelineID]
+}
+
+// RecoverInterrupted handles the executions left in flight by a previous
+// process. They count as run, so the schedule doesn't start them a second
+// time, and are returned for reporting.
+func (s *StateStore) RecoverInterrupted() map[string]InFlightRun {
+	s.Lock()
+	defer s.Unlock()
+	interrupted := s.state.InFlight
+	for pipelineID, run := range interrupted {
+		s.state.LastRuns[pipelineID] = max(s.state.LastRuns[pipelineID], run.StartedAt)
+	}
+	s.state.InFlight = make(map[string]InFlightRun)
+	if len(interrupted) > 0 {
+		s.save()
+	}
+	return interrupted
+}
+
+// save persists the state. Callers must hold the lock.
+func (s *StateStore) save() {
+	if err := s.write(); err != nil {
+		log.Printf("Error saving scheduler state: %v", err)
+	}
+}
+
+func (s *StateStore) write() error {
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling scheduler state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create scheduler state directory: %w", err)
+	}
+	// Write then rename so a crash mid-write doesn't corrupt the state
+	tmp := s.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync scheduler state: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	if dir, err := os.Open(filepath.Dir(s.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// SetStateStore makes the scheduler persist its state in store. It must be
+// called before Start.
+func (s *Scheduler) SetStateStore(store *StateStore) {
+	s.state = store
+	for pipelineID, run := range store.RecoverInterrupted() {
+		log.Printf("Execution %s of pipeline %s was interrupted by a restart, it won't be started again for the same schedule",
+			run.ExecutionID, pipelineID)
+	}
+}
+
+// applyLocalState completes the last run time reported by Drupal with the one
+// known locally, which is more recent when Drupal wasn't updated yet.
+func (s *Scheduler) applyLocalState(sp *ScheduledPipeline) {
+	if s.state == nil {
+		return
+	}
+	if lastRun := s.state.LastRun(sp.ID); lastRun > sp.LastRunTime {
+		sp.LastRunTime = lastRun
+	}
+}
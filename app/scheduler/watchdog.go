@@ -0,0 +1,73 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline"
+)
+
+// watchdogInterval is how often the watchdog looks for stuck executions.
+var watchdogInterval = time.Minute
+
+// runningExecution is the execution of a running pipeline.
+type runningExecution struct {
+	ID        string
+	StartedAt time.Time
+}
+
+// SetWatchdog sets the maximum duration of an execution, the ones running
+// longer are cancelled by the watchdog. 0 disables it.
+func (s *Scheduler) SetWatchdog(maxDuration time.Duration) {
+	s.maxDuration = maxDuration
+}
+
+// StartWatchdog checks the running executions every minute, when a maximum
+// duration is set.
+func (s *Scheduler) StartWatchdog() {
+	if s.maxDuration <= 0 {
+		return
+	}
+	log.Printf("Starting execution watchdog, executions are cancelled after %s", s.maxDuration)
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		s.checkStuckExecutions(now)
+	}
+}
+
+// checkStuckExecutions times out the executions running for longer than the
+// maximum duration: they are cancelled, reported failed to Drupal and removed
+// from the running pipelines so the next run isn't blocked by a stuck one.
+// It returns the IDs of the executions timed out.
+func (s *Scheduler) checkStuckExecutions(now time.Time) []string {
+	stuck := make(map[string]runningExecution)
+	s.runningPipelinesMutex.Lock()
+	for pipelineID, execution := range s.runningExecutions {
+		if now.Sub(execution.StartedAt) > s.maxDuration {
+			stuck[pipelineID] = execution
+			delete(s.runningExecutions, pipelineID)
+			delete(s.runningPipelines, pipelineID)
+		}
+	}
+	s.runningPipelinesMutex.Unlock()
+
+	var timedOut []string
+	for pipelineID, execution := range stuck {
+		log.Printf("Execution %s of pipeline %s is running for %s, cancelling it", execution.ID, pipelineID, now.Sub(execution.StartedAt).Round(time.Second))
+		if s.state != nil {
+			s.state.RecordFinish(pipelineID)
+		}
+		pipeline.TimeOutExecution(pipelineID, execution.ID, execution.StartedAt, s.maxDuration)
+		timedOut = append(timedOut, execution.ID)
+	}
+	return timedOut
+}
+
+// ownsRun reports whether executionID is the running execution of the
+// pipeline, it no longer is once timed out.
+func (s *Scheduler) ownsRun(pipelineID, executionID string) bool {
+	s.runningPipelinesMutex.Lock()
+	defer s.runningPipelinesMutex.Unlock()
+	return s.runningExecutions[pipelineID].ID == executionID
+}
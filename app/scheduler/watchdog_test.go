@@ -0,0 +1,83 @@
+package scheduler
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/plugin_registry"
+)
+
+func TestWatchdogReleasesStuckExecutions(t *testing.T) {
+	var mu sync.Mutex
+	var reported []map[string]interface{}
+	originalSend := pipeline.SendExecutionResultsFunc
+	pipeline.SendExecutionResultsFunc = func(pipelineID string, results map[string]interface{}, startTime, endTime int64) error {
+		mu.Lock()
+		defer mu.Unlock()
+		reported = append(reported, results)
+		return nil
+	}
+	defer func() { pipeline.SendExecutionResultsFunc = originalSend }()
+
+	stuck := make(chan struct{})
+	hold := make(chan struct{})
+	defer close(hold)
+	entered := make(chan struct{}, 2)
+	var calls int32
+	s := &Scheduler{
+		fetchPipelineFunc: func(id, apiHost, apiEndpoint string) (pipeline_type.Pipeline, error) {
+			return pipeline_type.Pipeline{ID: id}, nil
+		},
+		executePipelineFunc: func(executionID string, p *pipeline_type.Pipeline, registry *plugin_registry.PluginRegistry) error {
+			entered <- struct{}{}
+			if atomic.AddInt32(&calls, 1) == 1 {
+				<-stuck
+			} else {
+				<-hold
+			}
+			return nil
+		},
+		runningPipelines: make(map[string]struct{}),
+		maxDuration:      time.Hour,
+	}
+
+	first, err := s.RunNow("stuck-pipeline")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	<-entered
+	if timedOut := s.checkStuckExecutions(time.Now()); len(timedOut) != 0 {
+		t.Fatalf("expected no timeout before the maximum duration, got %v", timedOut)
+	}
+
+	timedOut := s.checkStuckExecutions(time.Now().Add(2 * time.Hour))
+	if len(timedOut) != 1 || timedOut[0] != first {
+		t.Fatalf("expected execution %s to time out, got %v", first, timedOut)
+	}
+	mu.Lock()
+	if len(reported) != 1 || reported[0][pipeline.WatchdogResultKey] == nil {
+		t.Errorf("expected the timeout reported to Drupal, got %v", reported)
+	}
+	mu.Unlock()
+
+	// The stuck execution no longer blocks the pipeline
+	second, err := s.RunNow("stuck-pipeline")
+	if err != nil {
+		t.Fatalf("expected a new run to start, got %v", err)
+	}
+
+	// and returning late doesn't release the new run
+	close(stuck)
+	time.Sleep(50 * time.Millisecond)
+	if !s.ownsRun("stuck-pipeline", second) {
+		t.Error("expected the new run to stay registered")
+	}
+	if _, err := s.RunNow("stuck-pipeline"); !errors.Is(err, ErrAlreadyRunning) {
+		t.Errorf("expected ErrAlreadyRunning, got %v", err)
+	}
+}
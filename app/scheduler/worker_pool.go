@@ -0,0 +1,81 @@
+package scheduler
+
+import (
+	"log"
+	"sync/atomic"
+
+	"github.com/serisow/lesocle/metrics"
+)
+
+// QueueStats describes the load of the scheduler worker pool.
+type QueueStats struct {
+	Running       int `json:"running"`
+	Queued        int `json:"queued"`
+	MaxConcurrent int `json:"max_concurrent"`
+	QueueSize     int `json:"queue_size"`
+}
+
+// SetConcurrency caps the scheduled pipelines executing at once. Due pipelines
+// beyond the cap wait in a queue of queueSize entries, and are skipped until
+// their next schedule when it is full. A maxConcurrent of 0 removes the cap.
+// It must be called before Start.
+func (s *Scheduler) SetConcurrency(maxConcurrent, queueSize int) {
+	if maxConcurrent <= 0 {
+		s.slots = nil
+		return
+	}
+	s.slots = make(chan struct{}, maxConcurrent)
+	s.queueSize = queueSize
+}
+
+// acquireSlot waits for a free worker. It returns false without waiting when
+// the queue is full.
+func (s *Scheduler) acquireSlot(pipelineID string) bool {
+	if s.slots == nil {
+		return true
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	queued := atomic.AddInt32(&s.queued, 1)
+	if int(queued) > s.queueSize {
+		atomic.AddInt32(&s.queued, -1)
+		log.Printf("Scheduler queue full (%d waiting, %d running), skipping pipeline %s", s.queueSize, cap(s.slots), pipelineID)
+		return false
+	}
+	log.Printf("All %d scheduler workers busy, pipeline %s queued (queue depth %d/%d)", cap(s.slots), pipelineID, queued, s.queueSize)
+
+	s.slots <- struct{}{}
+	atomic.AddInt32(&s.queued, -1)
+	return true
+}
+
+func (s *Scheduler) releaseSlot() {
+	if s.slots != nil {
+		<-s.slots
+	}
+}
+
+// QueueStats returns the number of running and queued scheduled executions.
+func (s *Scheduler) QueueStats() QueueStats {
+	stats := QueueStats{Queued: int(atomic.LoadInt32(&s.queued)), QueueSize: s.queueSize}
+	if s.slots != nil {
+		stats.Running = len(s.slots)
+		stats.MaxConcurrent = cap(s.slots)
+	}
+	return stats
+}
+
+// RegisterMetrics exposes the queue depth and running executions of the
+// worker pool as gauges. It must be called once.
+func (s *Scheduler) RegisterMetrics() {
+	metrics.NewGaugeFunc("lesocle_scheduler_queue_depth", "Scheduled pipelines waiting for a worker.", func() float64 {
+		return float64(s.QueueStats().Queued)
+	})
+	metrics.NewGaugeFunc("lesocle_scheduler_running", "Scheduled pipelines running in the worker pool.", func() float64 {
+		return float64(s.QueueStats().Running)
+	})
+}
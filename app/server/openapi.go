@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/serisow/lesocle/health"
+	"github.com/serisow/lesocle/openapi"
+	"github.com/serisow/lesocle/pipeline"
+	"github.com/serisow/lesocle/scheduler"
+	"github.com/serisow/lesocle/sla"
+)
+
+// APIVersion is the version of the OpenAPI document.
+const APIVersion = "1.0.0"
+
+// The bodies of the routes answering with an object built by their handler,
+// documented here as they exist nowhere else.
+type (
+	serviceHealth struct {
+		Status            string                               `json:"status"`
+		Maintenance       pipeline.Switch                      `json:"maintenance"`
+		DisabledPipelines map[string]pipeline.DisabledPipeline `json:"disabled_pipelines"`
+		PausedSchedules   map[string]pipeline.PausedSchedule   `json:"paused_schedules"`
+		RunningExecutions int                                  `json:"running_executions"`
+		Components        []health.Component                   `json:"components"`
+	}
+	providersHealth struct {
+		Status     string             `json:"status"`
+		Components []health.Component `json:"components"`
+		// Circuit breaker state per provider
+		Breakers map[string]string `json:"breakers"`
+	}
+	slaReport struct {
+		Pipelines []sla.Compliance `json:"pipelines"`
+	}
+	pausedSchedules struct {
+		PausedSchedules map[string]pipeline.PausedSchedule `json:"paused_schedules"`
+	}
+	pipelineFailures struct {
+		PipelineID string                 `json:"pipeline_id"`
+		Tracked    bool                   `json:"tracked"`
+		Failures   scheduler.FailureState `json:"failures"`
+	}
+	deadLetterSummary struct {
+		ExecutionID        string `json:"execution_id"`
+		PipelineID         string `json:"pipeline_id"`
+		PipelineLabel      string `json:"pipeline_label"`
+		ErrorMessage       string `json:"error_message"`
+		FailedAt           string `json:"failed_at"`
+		RedrivenAt         string `json:"redriven_at"`
+		RedriveExecutionID string `json:"redrive_execution_id"`
+	}
+	deadLetterList struct {
+		DeadLetters []deadLetterSummary `json:"dead_letters"`
+	}
+	assetUpload struct {
+		File openapi.File `json:"file"`
+		// Replaces the waiting asset of the same key
+		Key string `json:"key"`
+		Tag string `json:"tag,omitempty"`
+	}
+	assetList struct {
+		Assets []pipeline.Asset `json:"assets"`
+	}
+)
+
+// routeDocs describe the bodies of the documented routes.
+var routeDocs = make(map[*mux.Route]openapi.Operation)
+
+// documented records the summary and body types of a route for the OpenAPI
+// document. Its path and methods are read from the route.
+func documented(route *mux.Route, op openapi.Operation) *mux.Route {
+	routeDocs[route] = op
+	return route
+}
+
+// Operations lists the operations of every route of the router. A route
+// missing its documentation only gets its path parameters.
+func Operations(router *mux.Router) []openapi.Operation {
+	var operations []openapi.Operation
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			methods = []string{http.MethodGet}
+		}
+		for _, method := range methods {
+			op := routeDocs[route]
+			op.Method, op.Path, op.Public = method, path, publicRoutes[route]
+			if len(op.Tags) == 0 {
+				op.Tags = []string{routeTag(path)}
+			}
+			operations = append(operations, op)
+		}
+		return nil
+	})
+	return operations
+}
+
+// routeTag groups the undocumented routes by their first path segment.
+func routeTag(path string) string {
+	segment, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	return strings.TrimSuffix(segment, ".json")
+}
+
+// Document builds the OpenAPI document of the router.
+func Document(router *mux.Router) *openapi.Document {
+	return openapi.Build("Lesocle pipeline API", APIVersion, Operations(router))
+}
+
+// OpenAPIHandler serves the OpenAPI document of the router, built once on the
+// first request.
+func OpenAPIHandler(router *mux.Router) http.HandlerFunc {
+	var once sync.Once
+	var document []byte
+	var buildErr error
+	return func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() {
+			document, buildErr = json.MarshalIndent(Document(router), "", "  ")
+		})
+		if buildErr != nil {
+			http.Error(w, "Failed to build the OpenAPI document", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(document)
+	}
+}
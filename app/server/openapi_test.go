@@ -0,0 +1,36 @@
+package server
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/serisow/lesocle/openapi"
+	"github.com/serisow/lesocle/plugin_registry"
+)
+
+func TestEveryRouteIsDocumented(t *testing.T) {
+	router := SetupRoutes("http://drupal.test", "/api", plugin_registry.NewPluginRegistry())
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, _ := route.GetPathTemplate()
+		op, ok := routeDocs[route]
+		if !ok || op.Summary == "" || len(op.Tags) == 0 {
+			t.Errorf("route %s is not documented", path)
+		}
+		return nil
+	})
+}
+
+// The TypeScript client is generated from the document, go generate in
+// client updates it.
+func TestTypeScriptClientIsUpToDate(t *testing.T) {
+	client, err := os.ReadFile("../client/ts/lesocle.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := Document(SetupRoutes("", "", plugin_registry.NewPluginRegistry()))
+	if !bytes.Equal(client, openapi.TypeScript(doc)) {
+		t.Error("client/ts/lesocle.ts is out of date, run go generate in client")
+	}
+}
@@ -1,22 +1,30 @@
 package server
 
 import (
-	"crypto/tls"
 	"log"
 	"net/http"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/serisow/lesocle/api"
+	"github.com/serisow/lesocle/artifact"
 	"github.com/serisow/lesocle/handlers"
+	"github.com/serisow/lesocle/metrics"
+	"github.com/serisow/lesocle/openapi"
+	"github.com/serisow/lesocle/pipeline"
+	"github.com/serisow/lesocle/pipeline_type"
 	"github.com/serisow/lesocle/plugin_registry"
 	"github.com/urfave/negroni"
-	"golang.org/x/crypto/acme/autocert"
 )
 
+// Config is the TLS setup of ServeProduction. Certificates come from
+// CertFile and KeyFile when set, from Let's Encrypt for Domains otherwise.
 type Config struct {
 	Domains      []string
 	CertCacheDir string
-	HTTPPort     string
+	ACMEEmail    string
+	CertFile     string
+	KeyFile      string
 	HTTPSPort    string
 	IdleTimeout  time.Duration
 	ReadTimeout  time.Duration
@@ -28,35 +36,228 @@ func SetupRoutes(apiHost, apiEndpoint string, registry *plugin_registry.PluginRe
 
 	// New route for on-demand pipeline execution
 	pipelineHandler := handlers.NewPipelineHandler(apiHost, apiEndpoint, registry)
-	r.HandleFunc("/pipeline/{id}/execute", pipelineHandler.ExecutePipeline).Methods("POST")
-	r.HandleFunc("/pipeline/{id}/execution/{execution_id}/status", pipelineHandler.GetExecutionStatus).Methods("GET")
-	r.HandleFunc("/pipeline/{id}/execution/{execution_id}/results", pipelineHandler.GetExecutionResults).Methods("GET")
+	documented(limited(r.HandleFunc("/pipeline/{id}/execute", pipelineHandler.ExecutePipeline).Methods("POST")), openapi.Operation{
+		Summary: "Start an on-demand execution", Tags: []string{"executions"},
+		Request: api.ExecuteRequest{}, Response: api.ExecutionAccepted{}, Status: http.StatusAccepted,
+	})
+	documented(limited(r.HandleFunc("/executions", pipelineHandler.ExecuteInlinePipeline).Methods("POST")), openapi.Operation{
+		Summary: "Run a pipeline from its definition, without it existing in Drupal", Tags: []string{"executions"},
+		Request: pipeline_type.Pipeline{}, Response: api.ExecutionAccepted{}, Status: http.StatusAccepted,
+	})
+	documented(limited(r.HandleFunc("/pipelines/{id}/execute/bulk", pipelineHandler.ExecutePipelineBulk).Methods("POST")), openapi.Operation{
+		Summary: "Enqueue one execution per parameter set, sharing a batch ID", Tags: []string{"executions"},
+		Request: api.BulkExecuteRequest{}, Response: api.BatchStatus{}, Status: http.StatusAccepted,
+	})
+	documented(r.HandleFunc("/batches/{batch_id}", pipelineHandler.GetBatchStatus).Methods("GET"), openapi.Operation{
+		Summary: "Get the status of the executions of a bulk request", Tags: []string{"executions"}, Response: api.BatchStatus{},
+	})
+	documented(r.HandleFunc("/pipeline/{id}/execution/{execution_id}/status", pipelineHandler.GetExecutionStatus).Methods("GET"), openapi.Operation{
+		Summary: "Get the status of an execution", Tags: []string{"executions"}, Response: api.ExecutionStatus{},
+	})
+	documented(r.HandleFunc("/pipeline/{id}/execution/{execution_id}/results", pipelineHandler.GetExecutionResults).Methods("GET"), openapi.Operation{
+		Summary: "Get the results of a completed execution", Tags: []string{"executions"}, Response: api.ExecutionResults{},
+	})
+	documented(limited(r.HandleFunc("/pipeline/{id}/execution/{execution_id}/rerun", pipelineHandler.RerunExecution).Methods("POST")), openapi.Operation{
+		Summary: "Rerun an execution, reusing the outputs of the skipped steps", Tags: []string{"executions"},
+		Request: api.RerunRequest{}, Response: api.ExecutionAccepted{}, Status: http.StatusAccepted,
+	})
+	documented(limited(r.HandleFunc("/pipeline/{id}/execution/{execution_id}/steps/{step_id}/execute", pipelineHandler.ExecuteSingleStep).Methods("POST")), openapi.Operation{
+		Summary: "Run a single step on the context of a past execution", Tags: []string{"executions"},
+		Request: api.StepRequest{}, Response: api.ExecutionAccepted{}, Status: http.StatusAccepted,
+	})
+	documented(limited(r.HandleFunc("/pipeline/{id}/execution/{execution_id}/manifest", pipelineHandler.GetArtifactManifest).Methods("GET")), openapi.Operation{
+		Summary: "Get the artifact manifest of an execution", Tags: []string{"artifacts"}, Response: artifact.Manifest{},
+	})
+	documented(limited(r.HandleFunc("/executions/{execution_id}/artifacts/{artifact_id}/regenerate", pipelineHandler.RegenerateArtifact).Methods("POST")), openapi.Operation{
+		Summary: "Regenerate an artifact of an execution", Tags: []string{"artifacts"},
+		Request: api.RegenerateRequest{}, Response: api.ExecutionAccepted{}, Status: http.StatusAccepted,
+	})
+	documented(r.HandleFunc("/pipeline/{id}/execution/{execution_id}/logs/ws", pipelineHandler.StreamExecutionLogsWS).Methods("GET"), openapi.Operation{
+		Summary: "Stream the log lines of an execution over a WebSocket", Tags: []string{"executions"},
+		Query: []string{"backfill"}, WebSocket: true,
+	})
+	documented(r.HandleFunc("/executions/{execution_id}/logs/stream", pipelineHandler.StreamExecutionLogs).Methods("GET"), openapi.Operation{
+		Summary: "Stream the log lines of an execution as server-sent events", Tags: []string{"executions"},
+		Query: []string{"backfill"}, ResponseType: "text/event-stream",
+	})
+	documented(r.HandleFunc("/executions/{execution_id}/progress/ws", pipelineHandler.StreamExecutionProgress).Methods("GET"), openapi.Operation{
+		Summary: "Stream the status and the events of an execution over a WebSocket", Tags: []string{"executions"}, WebSocket: true,
+	})
+	documented(limited(r.HandleFunc("/pipelines/{id}/run", pipelineHandler.RunPipelineNow).Methods("POST")), openapi.Operation{
+		Summary: "Run a scheduled pipeline now", Tags: []string{"scheduler"}, Response: api.ExecutionAccepted{}, Status: http.StatusAccepted,
+	})
+	documented(r.HandleFunc("/pipelines/{id}/estimate", pipelineHandler.EstimateExecution).Methods("POST"), openapi.Operation{
+		Summary: "Estimate the tokens and the cost of an execution", Tags: []string{"executions"},
+		Request: pipeline.EstimateRequest{}, Response: pipeline.Estimate{},
+	})
+	documented(r.HandleFunc("/pipelines/sla", pipelineHandler.GetSLAReport).Methods("GET"), openapi.Operation{
+		Summary: "Get the schedule compliance of the pipelines", Tags: []string{"scheduler"}, Response: slaReport{},
+	})
+	documented(r.HandleFunc("/pipelines/schedule.ics", pipelineHandler.GetScheduleCalendar).Methods("GET"), openapi.Operation{
+		Summary: "Get the coming runs of the scheduled pipelines as an iCalendar feed", Tags: []string{"scheduler"},
+		Query: []string{"days", "pipeline_id"}, ResponseType: "text/calendar",
+	})
+
+	// Maintenance mode, per-pipeline kill switch and schedule pausing, they only
+	// stop new executions
+	documented(r.HandleFunc("/maintenance", pipelineHandler.SetMaintenance).Methods("PUT"), openapi.Operation{
+		Summary: "Turn maintenance mode on or off", Tags: []string{"scheduler"}, Request: api.SwitchRequest{}, Response: api.Switch{},
+	})
+	documented(r.HandleFunc("/pipeline/{id}/enabled", pipelineHandler.SetPipelineEnabled).Methods("PUT"), openapi.Operation{
+		Summary: "Switch a pipeline on or off", Tags: []string{"scheduler"}, Request: api.SwitchRequest{}, Response: api.PipelineSwitch{},
+	})
+	documented(r.HandleFunc("/pipeline/{id}/schedule/pause", pipelineHandler.PauseSchedule).Methods("POST"), openapi.Operation{
+		Summary: "Pause the schedule of a pipeline", Tags: []string{"scheduler"}, Request: api.ScheduleRequest{}, Response: api.ScheduleState{},
+	})
+	documented(r.HandleFunc("/pipeline/{id}/schedule/resume", pipelineHandler.ResumeSchedule).Methods("POST"), openapi.Operation{
+		Summary: "Resume the schedule of a pipeline", Tags: []string{"scheduler"}, Request: api.ScheduleRequest{}, Response: api.ScheduleState{},
+	})
+	documented(r.HandleFunc("/schedules/paused", pipelineHandler.ListPausedSchedules).Methods("GET"), openapi.Operation{
+		Summary: "List the paused schedules", Tags: []string{"scheduler"}, Response: pausedSchedules{},
+	})
+	documented(r.HandleFunc("/pipeline/{id}/failures", pipelineHandler.GetPipelineFailures).Methods("GET"), openapi.Operation{
+		Summary: "Get the consecutive failures of a scheduled pipeline", Tags: []string{"scheduler"}, Response: pipelineFailures{},
+	})
+	documented(r.HandleFunc("/pipeline/{id}/failures", pipelineHandler.ClearPipelineFailures).Methods("DELETE"), openapi.Operation{
+		Summary: "Clear the failures of a pipeline, lifting its backoff", Tags: []string{"scheduler"}, Status: http.StatusNoContent,
+	})
+	documented(public(r.HandleFunc("/healthz", pipelineHandler.Healthz).Methods("GET")), openapi.Operation{
+		Summary: "Check the service is alive", Tags: []string{"health"}, Response: serviceHealth{},
+	})
+	documented(public(r.HandleFunc("/readyz", pipelineHandler.Readyz).Methods("GET")), openapi.Operation{
+		Summary: "Check the service is ready to run executions", Tags: []string{"health"}, Response: serviceHealth{},
+	})
+	// Credentials of the scheduled pipelines, checked with each provider
+	documented(r.HandleFunc("/providers/health", pipelineHandler.ProvidersHealth).Methods("GET"), openapi.Operation{
+		Summary: "Check the provider credentials of the scheduled pipelines", Tags: []string{"health"}, Response: providersHealth{},
+	})
+	documented(r.Handle("/metrics", metrics.Default.Handler()).Methods("GET"), openapi.Operation{
+		Summary: "Get the Prometheus metrics", Tags: []string{"health"}, ResponseType: "text/plain",
+	})
+	documented(public(r.HandleFunc("/openapi.json", OpenAPIHandler(r)).Methods("GET")), openapi.Operation{
+		Summary: "Get this OpenAPI document", Tags: []string{"openapi"}, Response: map[string]interface{}{},
+	})
+
+	// Context of past executions, for debugging
+	documented(r.HandleFunc("/executions/{execution_id}/context", pipelineHandler.GetExecutionContext).Methods("GET"), openapi.Operation{
+		Summary: "Get the context of a past execution, secrets redacted", Tags: []string{"executions"},
+		Query: []string{"at_step"}, Response: pipeline.ContextSnapshot{},
+	})
+	documented(r.HandleFunc("/executions/{execution_id}/definition", pipelineHandler.GetExecutionDefinition).Methods("GET"), openapi.Operation{
+		Summary: "Get the pipeline definition a past execution ran", Tags: []string{"executions"}, Response: pipeline.ExecutionDefinition{},
+	})
+
+	// Executions that exhausted their retries
+	documented(r.HandleFunc("/dead-letters", pipelineHandler.ListDeadLetters).Methods("GET"), openapi.Operation{
+		Summary: "List the executions that exhausted their retries", Tags: []string{"dead-letters"},
+		Query: []string{"pipeline_id"}, Response: deadLetterList{},
+	})
+	documented(r.HandleFunc("/dead-letters/{execution_id}", pipelineHandler.GetDeadLetter).Methods("GET"), openapi.Operation{
+		Summary: "Get a dead letter", Tags: []string{"dead-letters"}, Response: pipeline.DeadLetter{},
+	})
+	documented(r.HandleFunc("/dead-letters/{execution_id}", pipelineHandler.DeleteDeadLetter).Methods("DELETE"), openapi.Operation{
+		Summary: "Delete a dead letter", Tags: []string{"dead-letters"}, Status: http.StatusNoContent,
+	})
+	documented(r.HandleFunc("/dead-letters/{execution_id}/redrive", pipelineHandler.RedriveDeadLetter).Methods("POST"), openapi.Operation{
+		Summary: "Start a dead letter again", Tags: []string{"dead-letters"},
+		Request: api.RedriveRequest{}, Response: api.ExecutionAccepted{}, Status: http.StatusAccepted,
+	})
+
+	// External events starting a pipeline, authenticated with a shared secret
+	documented(limited(public(r.HandleFunc("/triggers/{pipeline_id}", pipelineHandler.TriggerPipeline).Methods("POST"))), openapi.Operation{
+		Summary: "Start a pipeline from an external event, signed with the trigger secret", Tags: []string{"triggers"},
+		Request: map[string]interface{}{}, Response: api.ExecutionAccepted{}, Status: http.StatusAccepted,
+	})
+
+	// Files pushed by external systems for the next execution of a pipeline,
+	// authenticated with the trigger secret
+	documented(limited(public(r.HandleFunc("/pipeline/{id}/assets", pipelineHandler.UploadAsset).Methods("POST"))), openapi.Operation{
+		Summary: "Push a file for the next execution of a pipeline", Tags: []string{"assets"},
+		Request: assetUpload{}, RequestType: "multipart/form-data", Response: pipeline.Asset{}, Status: http.StatusCreated,
+	})
+	documented(limited(public(r.HandleFunc("/pipeline/{id}/assets", pipelineHandler.ListAssets).Methods("GET"))), openapi.Operation{
+		Summary: "List the files waiting for the next execution of a pipeline", Tags: []string{"assets"}, Response: assetList{},
+	})
+	documented(limited(public(r.HandleFunc("/pipeline/{id}/assets/{key}", pipelineHandler.DeleteAsset).Methods("DELETE"))), openapi.Operation{
+		Summary: "Delete a waiting file", Tags: []string{"assets"}, Status: http.StatusNoContent,
+	})
+
+	// Step outputs shared across executions
+	documented(r.HandleFunc("/cache/outputs", pipelineHandler.GetOutputCacheStats).Methods("GET"), openapi.Operation{
+		Summary: "Get the statistics of the shared step output cache", Tags: []string{"cache"}, Response: pipeline.OutputCacheStats{},
+	})
+	documented(r.HandleFunc("/cache/outputs", pipelineHandler.PurgeOutputCache).Methods("DELETE"), openapi.Operation{
+		Summary: "Purge the shared step output cache", Tags: []string{"cache"}, Status: http.StatusNoContent,
+	})
 
 	// Video download route removed
 
-	// Add new route for image serving
-	r.HandleFunc("/api/images/{file_id}", pipelineHandler.ServeImageFile).Methods("GET")
+	// Add new route for image serving. The images are fetched by Instagram and
+	// Facebook, which hold no credentials: their URLs are signed instead
+	documented(limited(public(r.HandleFunc("/api/images/{file_id}", pipelineHandler.ServeImageFile).Methods("GET"))), openapi.Operation{
+		Summary: "Get a generated image with its signed URL", Tags: []string{"files"},
+		Query: []string{"expires", "signature"}, ResponseType: "image/*",
+	})
+
+	// Step outputs too large to be sent inline to Drupal, signed URLs as well
+	documented(limited(public(r.HandleFunc("/api/outputs/{filename}", pipelineHandler.ServeSpilledOutput).Methods("GET"))), openapi.Operation{
+		Summary: "Get a step output too large to be sent inline with its signed URL", Tags: []string{"files"},
+		Query: []string{"expires", "signature"}, ResponseType: "text/plain",
+	})
 
 	return r
 }
 
+// publicRoutes are reachable without API credentials: probes, and routes
+// authenticating their callers themselves.
+var publicRoutes = make(map[*mux.Route]bool)
+
+func public(route *mux.Route) *mux.Route {
+	publicRoutes[route] = true
+	return route
+}
+
+// IsPublic returns a function reporting whether a request is to a public
+// route of the router, for the authentication middleware.
+func IsPublic(router *mux.Router) func(*http.Request) bool {
+	return func(r *http.Request) bool {
+		var match mux.RouteMatch
+		return router.Match(r, &match) && publicRoutes[match.Route]
+	}
+}
+
+// limitedRoutes are rate limited per client, they are exposed to partner
+// systems.
+var limitedRoutes = make(map[*mux.Route]bool)
+
+func limited(route *mux.Route) *mux.Route {
+	limitedRoutes[route] = true
+	return route
+}
+
+// IsLimited returns a function reporting whether a request is to a rate
+// limited route of the router, for the client rate limiter.
+func IsLimited(router *mux.Router) func(*http.Request) bool {
+	return func(r *http.Request) bool {
+		var match mux.RouteMatch
+		return router.Match(r, &match) && limitedRoutes[match.Route]
+	}
+}
+
 // ServeProduction build the server when we operate in a production environment.
-func ServeProduction(n *negroni.Negroni) {
-	// Configure autocert settings
-	autocertManager := autocert.Manager{
-		Prompt:     autocert.AcceptTOS,
-		HostPolicy: autocert.HostWhitelist("serisow.com", "www.serisow.com"),
-		Cache:      autocert.DirCache("../serisow_certs"),
+func ServeProduction(n *negroni.Negroni, cfg Config) {
+	tlsConfig, httpHandler, err := tlsConfig(cfg)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	// Listen for HTTP requests on port 80 in a new goroutine. Use
-	// autocertManager.HTTPHandler(nil) as the handler. This will send ACME
-	// "http-01" challenge responses as necessary, and 302 redirect all other
+	// Listen for HTTP requests on port 80 in a new goroutine: it answers the
+	// ACME "http-01" challenges as necessary, and 302 redirects all other
 	// requests to HTTPS.
 	go func() {
 		srv := &http.Server{
 			Addr:         ":80",
-			Handler:      autocertManager.HTTPHandler(nil),
+			Handler:      httpHandler,
 			IdleTimeout:  time.Minute,
 			ReadTimeout:  5 * time.Second,
 			WriteTimeout: 10 * time.Second,
@@ -66,23 +267,16 @@ func ServeProduction(n *negroni.Negroni) {
 		log.Fatal(err)
 	}()
 
-	// Configure the TLS config to use the autocertManager.GetCertificate function.
-	tlsConfig := &tls.Config{
-		GetCertificate:           autocertManager.GetCertificate,
-		PreferServerCipherSuites: true,
-		CurvePreferences:         []tls.CurveID{tls.X25519, tls.CurveP256},
-	}
-
 	srv := &http.Server{
-		Addr:         ":443",
-		Handler:      n,
+		Addr:         ":" + cfg.HTTPSPort,
+		Handler:      handlers.KeepStreamsOpen(n),
 		TLSConfig:    tlsConfig,
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  cfg.IdleTimeout,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
 	}
 
-	err := srv.ListenAndServeTLS("", "") // Key and cert provided automatically by autocert.
+	err = srv.ListenAndServeTLS("", "") // Certificates provided by the TLS config.
 	log.Fatal(err)
 }
 
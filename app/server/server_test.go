@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/serisow/lesocle/auth"
+	"github.com/serisow/lesocle/plugin_registry"
+	"github.com/serisow/lesocle/services/llm_service"
+	"github.com/serisow/lesocle/signedurl"
+	"github.com/urfave/negroni"
+)
+
+func TestIsLimited(t *testing.T) {
+	router := SetupRoutes("http://drupal.test", "/api", plugin_registry.NewPluginRegistry())
+	isLimited := IsLimited(router)
+
+	tests := []struct {
+		method  string
+		path    string
+		limited bool
+	}{
+		{"POST", "/pipeline/p1/execute", true},
+		{"POST", "/executions", true},
+		{"POST", "/pipelines/p1/execute/bulk", true},
+		{"POST", "/pipelines/p1/run", true},
+		{"POST", "/pipeline/p1/execution/e1/rerun", true},
+		{"POST", "/pipeline/p1/execution/e1/steps/s1/execute", true},
+		{"POST", "/triggers/p1", true},
+		{"POST", "/pipeline/p1/assets", true},
+		{"GET", "/pipeline/p1/execution/e1/manifest", true},
+		{"POST", "/executions/e1/artifacts/a1/regenerate", true},
+		{"GET", "/api/images/f1", true},
+		{"GET", "/api/outputs/out.json", true},
+		{"GET", "/healthz", false},
+		{"GET", "/pipeline/p1/execution/e1/status", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := isLimited(req); got != tt.limited {
+			t.Errorf("%s %s: limited = %v, want %v", tt.method, tt.path, got, tt.limited)
+		}
+	}
+}
+
+func TestGeneratedImageURLWithAuth(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	signedurl.Key = []byte("file-url-secret")
+	t.Cleanup(func() {
+		os.Chdir(wd)
+		signedurl.Key = nil
+	})
+
+	stability := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"image":         base64.StdEncoding.EncodeToString([]byte("png")),
+			"seed":          7,
+			"finish_reason": "SUCCESS",
+		})
+	}))
+	defer stability.Close()
+	output, err := llm_service.NewStabilityImageService(slog.Default()).CallLLM(context.Background(),
+		map[string]interface{}{"api_key": "key", "api_url": stability.URL}, "a lighthouse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var image struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal([]byte(output), &image); err != nil {
+		t.Fatal(err)
+	}
+	imageURL, err := url.Parse(image.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := SetupRoutes("http://drupal.test", "/api", plugin_registry.NewPluginRegistry())
+	authenticated := negroni.New(auth.New(auth.Config{APIKeys: []string{"api-key"}}, IsPublic(router)))
+	authenticated.UseHandler(router)
+
+	tests := []struct {
+		name string
+		path string
+		code int
+	}{
+		// Fetched by Instagram or Facebook, without credentials
+		{"signed URL", imageURL.RequestURI(), http.StatusOK},
+		{"unsigned URL", imageURL.Path, http.StatusForbidden},
+		{"other route", "/pipelines/sla", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		authenticated.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.code)
+		}
+	}
+}
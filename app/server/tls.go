@@ -0,0 +1,131 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// tlsConfig returns the TLS configuration of cfg and the handler of the plain
+// HTTP listener: the ACME challenges and a redirect with autocert, only the
+// redirect with certificate files.
+func tlsConfig(cfg Config) (*tls.Config, http.Handler, error) {
+	config := &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		if cfg.CertFile == "" || cfg.KeyFile == "" {
+			return nil, nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+		}
+		reloader := &certReloader{certFile: cfg.CertFile, keyFile: cfg.KeyFile}
+		if _, err := reloader.load(); err != nil {
+			return nil, nil, err
+		}
+		config.GetCertificate = reloader.GetCertificate
+		return config, redirectToHTTPS(cfg.HTTPSPort), nil
+	}
+
+	if len(cfg.Domains) == 0 {
+		return nil, nil, fmt.Errorf("DOMAINS is required to request certificates from Let's Encrypt")
+	}
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.Domains...),
+		Cache:      autocert.DirCache(cfg.CertCacheDir),
+		Email:      cfg.ACMEEmail,
+	}
+	config.GetCertificate = manager.GetCertificate
+	// Also answers the tls-alpn-01 challenges
+	config.NextProtos = []string{"h2", "http/1.1", "acme-tls/1"}
+	return config, manager.HTTPHandler(redirectToHTTPS(cfg.HTTPSPort)), nil
+}
+
+// redirectToHTTPS redirects to the same URL on the HTTPS port, left out of
+// the URL when it is the default one.
+func redirectToHTTPS(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Use HTTPS", http.StatusBadRequest)
+			return
+		}
+		host := stripPort(r.Host)
+		if httpsPort != "" && httpsPort != "443" {
+			host += ":" + httpsPort
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusFound)
+	})
+}
+
+func stripPort(host string) string {
+	for i := len(host) - 1; i >= 0; i-- {
+		switch host[i] {
+		case ':':
+			return host[:i]
+		case ']':
+			return host
+		}
+	}
+	return host
+}
+
+// certCheckInterval is how often the certificate files are checked for a
+// renewal.
+const certCheckInterval = time.Minute
+
+// certReloader serves the certificate of the files, reloaded when they
+// change so renewals by certbot and the like don't need a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mutex     sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if time.Since(c.checkedAt) < certCheckInterval {
+		return c.cert, nil
+	}
+	c.checkedAt = time.Now()
+	info, err := os.Stat(c.certFile)
+	if err != nil || !info.ModTime().After(c.modTime) {
+		// Keep serving the loaded certificate
+		return c.cert, nil
+	}
+	if cert, err := c.loadLocked(); err == nil {
+		return cert, nil
+	}
+	return c.cert, nil
+}
+
+func (c *certReloader) load() (*tls.Certificate, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.checkedAt = time.Now()
+	return c.loadLocked()
+}
+
+func (c *certReloader) loadLocked() (*tls.Certificate, error) {
+	info, err := os.Stat(c.certFile)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading the TLS certificate: %w", err)
+	}
+	c.cert = &cert
+	c.modTime = info.ModTime()
+	return c.cert, nil
+}
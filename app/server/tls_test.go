@@ -0,0 +1,132 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes a self-signed certificate and its key to dir.
+func writeCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+func TestTLSConfigCertificateFiles(t *testing.T) {
+	certFile, keyFile := writeCertificate(t, t.TempDir())
+	config, handler, err := tlsConfig(Config{CertFile: certFile, KeyFile: keyFile, HTTPSPort: "443"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cert, err := config.GetCertificate(nil)
+	if err != nil || cert == nil {
+		t.Fatalf("expected the certificate of the files, got %v", err)
+	}
+	for _, proto := range config.NextProtos {
+		if proto == "acme-tls/1" {
+			t.Error("expected no ACME challenges with certificate files")
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com/healthz", nil))
+	if location := rec.Header().Get("Location"); location != "https://example.com/healthz" {
+		t.Errorf("unexpected redirect to %q", location)
+	}
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	certFile, _ := writeCertificate(t, t.TempDir())
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{"key without certificate", Config{KeyFile: "key.pem"}, "must be set together"},
+		{"certificate without key", Config{CertFile: certFile}, "must be set together"},
+		{"missing key file", Config{CertFile: certFile, KeyFile: filepath.Join(t.TempDir(), "missing.pem")}, "error loading the TLS certificate"},
+		{"no domains for ACME", Config{}, "DOMAINS is required"},
+	}
+	for _, tt := range tests {
+		if _, _, err := tlsConfig(tt.cfg); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestTLSConfigACME(t *testing.T) {
+	config, handler, err := tlsConfig(Config{Domains: []string{"example.com"}, CertCacheDir: t.TempDir(), HTTPSPort: "8443"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	acme := false
+	for _, proto := range config.NextProtos {
+		acme = acme || proto == "acme-tls/1"
+	}
+	if !acme || config.GetCertificate == nil {
+		t.Error("expected certificates from Let's Encrypt")
+	}
+
+	// Requests other than the challenges are redirected to the HTTPS port
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com/pipelines/sla", nil))
+	if location := rec.Header().Get("Location"); location != "https://example.com:8443/pipelines/sla" {
+		t.Errorf("unexpected redirect to %q", location)
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		port   string
+		method string
+		target string
+		status int
+		want   string
+	}{
+		{"443", http.MethodGet, "http://example.com/a?b=c", http.StatusFound, "https://example.com/a?b=c"},
+		{"", http.MethodGet, "http://example.com:80/a", http.StatusFound, "https://example.com/a"},
+		{"8443", http.MethodGet, "http://example.com:8080/a", http.StatusFound, "https://example.com:8443/a"},
+		{"8443", http.MethodHead, "http://[::1]/a", http.StatusFound, "https://[::1]:8443/a"},
+		{"443", http.MethodPost, "http://example.com/a", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		redirectToHTTPS(tt.port).ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+		if rec.Code != tt.status || rec.Header().Get("Location") != tt.want {
+			t.Errorf("%s %s on port %q: got %d to %q, want %d to %q", tt.method, tt.target, tt.port, rec.Code, rec.Header().Get("Location"), tt.status, tt.want)
+		}
+	}
+}
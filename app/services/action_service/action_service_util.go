@@ -16,4 +16,15 @@ func getIntValue(config map[string]interface{}, key string, defaultValue int) in
 		return val
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+func getBoolValue(config map[string]interface{}, key string, defaultValue bool) bool {
+	switch val := config[key].(type) {
+	case bool:
+		return val
+	case string:
+		return val == "true" || val == "1"
+	case float64:
+		return val != 0
+	}
+	return defaultValue
+}
@@ -0,0 +1,557 @@
+package action_service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/serisow/lesocle/logging"
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+const CreateCalendarEventServiceName = "create_calendar_event"
+
+const (
+	googleCalendarAPIBaseURL = "https://www.googleapis.com/calendar/v3"
+	googleCalendarScope      = "https://www.googleapis.com/auth/calendar.events"
+	// defaultEventDuration is the length of a timed event without end
+	defaultEventDuration = 30 * time.Minute
+	// defaultMaxCalendarEvents bounds the events of a run unless max_events
+	// is set
+	defaultMaxCalendarEvents = 50
+	// maxEventReminders is how many reminders Google keeps on an event
+	maxEventReminders = 5
+)
+
+// eventTimeLayouts are the local times accepted besides RFC 3339, read in
+// the time zone of the event.
+var eventTimeLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+type CreateCalendarEventActionService struct {
+	logger     *slog.Logger
+	httpClient *http.Client
+}
+
+func NewCreateCalendarEventActionService(logger *slog.Logger) *CreateCalendarEventActionService {
+	return &CreateCalendarEventActionService{
+		logger:     logger,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// CalendarEvent is an event to create, read from the pipeline output or the
+// configuration.
+type CalendarEvent struct {
+	Summary     string
+	Description string
+	Location    string
+	Start       string
+	End         string
+	// Duration is the length of a timed event without End, in minutes
+	Duration  int
+	Attendees []string
+}
+
+// CalendarEventConfig is the configuration shared by the events of a step.
+type CalendarEventConfig struct {
+	CalendarID string
+	TimeZone   *time.Location
+	Attendees  []string
+	// Reminders are "popup:10" or "email:1440", in minutes before the event
+	Reminders []string
+	// SendUpdates tells Google whom to invite by email: none, all or
+	// externalOnly
+	SendUpdates string
+	ColorID     string
+	// Deduplicate derives the event ID from the calendar, the execution, the
+	// summary and the start as written, so a retried step finds the event it
+	// already created even when the start is an offset from now
+	Deduplicate bool
+	MaxEvents   int
+}
+
+// Execute creates Google Calendar events, such as publication slots or
+// editorial reminders. The events are the objects of the list at events_from,
+// or the JSON content of the required steps: an event, a list of them or an
+// object with an events list. Their fields are summary (or title),
+// description, location, start, end, duration_minutes and attendees; the
+// summary, description, location, start and end templates of the
+// configuration fill in the fields they lack, or make the event alone.
+// Times are RFC 3339, local times of time_zone, dates for all-day events, or
+// offsets from now such as "+24h".
+func (s *CreateCalendarEventActionService) Execute(ctx context.Context, actionConfig string, pipelineContext *pipeline_type.Context, step *pipeline_type.PipelineStep) (string, error) {
+	if step.ActionDetails == nil || step.ActionDetails.Configuration == nil {
+		return "", fmt.Errorf("missing action configuration for CreateCalendarEventAction")
+	}
+
+	config := step.ActionDetails.Configuration
+	eventConfig, err := extractCalendarEventConfig(config)
+	if err != nil {
+		return "", fmt.Errorf("error extracting calendar configuration: %w", err)
+	}
+
+	events, err := calendarEvents(config, step, pipelineContext)
+	if err != nil {
+		return "", err
+	}
+	if len(events) > eventConfig.MaxEvents {
+		return "", fmt.Errorf("%d events exceed max_events of %d", len(events), eventConfig.MaxEvents)
+	}
+
+	token, err := googleAccessToken(ctx, s.httpClient, config, googleCalendarScope)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	executionID, _, _ := logging.ExecutionLogScope(ctx)
+	created := make([]map[string]interface{}, 0, len(events))
+	for i, event := range events {
+		payload, err := eventPayload(event, eventConfig, executionID, now)
+		if err != nil {
+			return "", fmt.Errorf("event %d: %w", i+1, err)
+		}
+		result, duplicate, err := s.insertEvent(ctx, token, eventConfig, payload)
+		if err != nil {
+			s.logger.ErrorContext(ctx, "Failed to create calendar event",
+				slog.String("error", err.Error()),
+				slog.String("calendar_id", eventConfig.CalendarID),
+				slog.Int("created", len(created)))
+			return "", fmt.Errorf("failed to create calendar event %d of %d: %w", i+1, len(events), err)
+		}
+		if duplicate {
+			result["duplicate"] = true
+		}
+		created = append(created, result)
+
+		s.logger.InfoContext(ctx, "Calendar event created",
+			slog.String("calendar_id", eventConfig.CalendarID),
+			slog.String("event_id", fmt.Sprint(result["event_id"])),
+			slog.Bool("duplicate", duplicate))
+	}
+
+	response := map[string]interface{}{
+		"success":     true,
+		"calendar_id": eventConfig.CalendarID,
+		"events":      created,
+		"created":     len(created),
+		"timestamp":   now.Unix(),
+	}
+	// A single event keeps its fields at the top
+	if len(created) == 1 {
+		response["event_id"] = created[0]["event_id"]
+		response["html_link"] = created[0]["html_link"]
+	}
+	resultJSON, err := json.Marshal(response)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling result: %w", err)
+	}
+	return string(resultJSON), nil
+}
+
+func (s *CreateCalendarEventActionService) CanHandle(actionService string) bool {
+	return actionService == CreateCalendarEventServiceName
+}
+
+// ValidateCredentials reads the calendar the events go to.
+func (s *CreateCalendarEventActionService) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	calendarID := getStringValue(config, "calendar_id", "primary")
+	token, err := googleAccessToken(ctx, s.httpClient, config, googleCalendarScope)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, googleCalendarAPIBaseURL+"/calendars/"+url.PathEscape(calendarID), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return checkCredentialResponse(s.httpClient.Do(req))
+}
+
+// insertEvent creates an event. With an event ID already taken, the event
+// of a previous run, it returns that event as a duplicate.
+func (s *CreateCalendarEventActionService) insertEvent(ctx context.Context, token string, config *CalendarEventConfig, payload map[string]interface{}) (map[string]interface{}, bool, error) {
+	path := "/calendars/" + url.PathEscape(config.CalendarID) + "/events"
+	query := url.Values{"sendUpdates": {config.SendUpdates}}
+	var event googleCalendarEvent
+	status, err := s.do(ctx, token, http.MethodPost, path+"?"+query.Encode(), payload, &event)
+	if status == http.StatusConflict && payload["id"] != nil {
+		_, err = s.do(ctx, token, http.MethodGet, path+"/"+url.PathEscape(payload["id"].(string)), nil, &event)
+		if err != nil {
+			return nil, false, err
+		}
+		return event.result(), true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return event.result(), false, nil
+}
+
+type googleCalendarEvent struct {
+	ID       string `json:"id"`
+	HTMLLink string `json:"htmlLink"`
+	Status   string `json:"status"`
+	Summary  string `json:"summary"`
+	Start    struct {
+		Date     string `json:"date"`
+		DateTime string `json:"dateTime"`
+	} `json:"start"`
+	End struct {
+		Date     string `json:"date"`
+		DateTime string `json:"dateTime"`
+	} `json:"end"`
+}
+
+func (e *googleCalendarEvent) result() map[string]interface{} {
+	start, end := e.Start.DateTime, e.End.DateTime
+	if start == "" {
+		start, end = e.Start.Date, e.End.Date
+	}
+	return map[string]interface{}{
+		"event_id":  e.ID,
+		"html_link": e.HTMLLink,
+		"status":    e.Status,
+		"summary":   e.Summary,
+		"start":     start,
+		"end":       end,
+	}
+}
+
+// do calls the Calendar API and decodes its JSON answer, returning the
+// status code too.
+func (s *CreateCalendarEventActionService) do(ctx context.Context, token, method, path string, payload, result interface{}) (int, error) {
+	var body io.Reader
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return 0, fmt.Errorf("error marshaling payload: %w", err)
+		}
+		body = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, googleCalendarAPIBaseURL+path, body)
+	if err != nil {
+		return 0, fmt.Errorf("error creating request: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, fmt.Errorf("error reading response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return resp.StatusCode, fmt.Errorf("error parsing response: %w", err)
+	}
+	return resp.StatusCode, nil
+}
+
+func extractCalendarEventConfig(config map[string]interface{}) (*CalendarEventConfig, error) {
+	eventConfig := &CalendarEventConfig{
+		CalendarID:  getStringValue(config, "calendar_id", "primary"),
+		Attendees:   splitList(config["attendees"]),
+		Reminders:   splitList(config["reminders"]),
+		SendUpdates: getStringValue(config, "send_updates", "none"),
+		ColorID:     getStringValue(config, "color_id", ""),
+		Deduplicate: getBoolValue(config, "deduplicate", false),
+		MaxEvents:   getIntValue(config, "max_events", defaultMaxCalendarEvents),
+	}
+	location, err := time.LoadLocation(getStringValue(config, "time_zone", "UTC"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid time_zone: %w", err)
+	}
+	eventConfig.TimeZone = location
+
+	switch eventConfig.SendUpdates {
+	case "none", "all", "externalOnly":
+	default:
+		return nil, fmt.Errorf("send_updates must be none, all or externalOnly")
+	}
+	if len(eventConfig.Reminders) > maxEventReminders {
+		return nil, fmt.Errorf("an event takes at most %d reminders", maxEventReminders)
+	}
+	for _, reminder := range eventConfig.Reminders {
+		if _, _, err := parseReminder(reminder); err != nil {
+			return nil, err
+		}
+	}
+	return eventConfig, nil
+}
+
+// calendarEvents reads the events of the pipeline output, completed with the
+// templates of the configuration.
+func calendarEvents(config map[string]interface{}, step *pipeline_type.PipelineStep, pipelineContext *pipeline_type.Context) ([]CalendarEvent, error) {
+	var items []interface{}
+	if path := getStringValue(config, "events_from", ""); path != "" {
+		value, ok := pipelineContext.GetPath(path)
+		if !ok {
+			return nil, fmt.Errorf("events_from path %s not found", path)
+		}
+		items = eventItems(value)
+		if items == nil {
+			return nil, fmt.Errorf("events_from path %s is not an event or a list of them", path)
+		}
+	} else if getStringValue(config, "summary", "") == "" {
+		for _, requiredStep := range step.RequiredStepKeys() {
+			stepOutput, err := pipelineContext.GetString(requiredStep)
+			if err != nil {
+				return nil, fmt.Errorf("error reading event content: %w", err)
+			}
+			var value interface{}
+			if err := json.Unmarshal([]byte(cleanJsonContent(stepOutput)), &value); err != nil {
+				return nil, fmt.Errorf("error parsing event content of %s: %w", requiredStep, err)
+			}
+			items = append(items, eventItems(value)...)
+		}
+	}
+	if len(items) == 0 {
+		// The templates alone make the event
+		items = []interface{}{map[string]interface{}{}}
+	}
+
+	defaults := CalendarEvent{
+		Summary:     fillEmailTemplate(getStringValue(config, "summary", ""), pipelineContext),
+		Description: fillEmailTemplate(getStringValue(config, "description", ""), pipelineContext),
+		Location:    fillEmailTemplate(getStringValue(config, "location", ""), pipelineContext),
+		Start:       fillEmailTemplate(getStringValue(config, "start", ""), pipelineContext),
+		End:         fillEmailTemplate(getStringValue(config, "end", ""), pipelineContext),
+		Duration:    getIntValue(config, "duration_minutes", 0),
+	}
+
+	events := make([]CalendarEvent, 0, len(items))
+	for i, item := range items {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("event %d is not an object", i+1)
+		}
+		event := CalendarEvent{
+			Summary:     firstString(fields, "summary", "title"),
+			Description: firstString(fields, "description"),
+			Location:    firstString(fields, "location"),
+			Start:       firstString(fields, "start"),
+			End:         firstString(fields, "end"),
+			Duration:    getIntValue(fields, "duration_minutes", defaults.Duration),
+			Attendees:   eventAttendees(fields["attendees"]),
+		}
+		if event.Summary == "" {
+			event.Summary = defaults.Summary
+		}
+		if event.Description == "" {
+			event.Description = defaults.Description
+		}
+		if event.Location == "" {
+			event.Location = defaults.Location
+		}
+		if event.Start == "" {
+			event.Start, event.End = defaults.Start, defaults.End
+		}
+		event.Summary = strings.Join(strings.Fields(event.Summary), " ")
+		if event.Summary == "" {
+			return nil, fmt.Errorf("event %d has no summary", i+1)
+		}
+		if event.Start == "" {
+			return nil, fmt.Errorf("event %d has no start", i+1)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// eventItems reads an event, a list of events or an object with an events
+// list.
+func eventItems(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		return v
+	case map[string]interface{}:
+		if list, ok := v["events"].([]interface{}); ok {
+			return list
+		}
+		return []interface{}{v}
+	}
+	return nil
+}
+
+func firstString(fields map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if value, ok := fields[key].(string); ok && strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// eventAttendees reads emails, or objects with an email field.
+func eventAttendees(value interface{}) []string {
+	if list, ok := value.([]interface{}); ok {
+		var emails []string
+		for _, item := range list {
+			if fields, ok := item.(map[string]interface{}); ok {
+				item = fields["email"]
+			}
+			if email, ok := item.(string); ok && strings.TrimSpace(email) != "" {
+				emails = append(emails, strings.TrimSpace(email))
+			}
+		}
+		return emails
+	}
+	return splitList(value)
+}
+
+// eventPayload builds the Calendar API event of an event.
+func eventPayload(event CalendarEvent, config *CalendarEventConfig, executionID string, now time.Time) (map[string]interface{}, error) {
+	start, allDay, err := parseEventTime(event.Start, config.TimeZone, now)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start: %w", err)
+	}
+
+	var end time.Time
+	if event.End != "" {
+		var endAllDay bool
+		if end, endAllDay, err = parseEventTime(event.End, config.TimeZone, now); err != nil {
+			return nil, fmt.Errorf("invalid end: %w", err)
+		}
+		if endAllDay != allDay {
+			return nil, fmt.Errorf("start and end must both be dates or both be times")
+		}
+		// The end date of an all-day event is given inclusive, Google
+		// takes it exclusive
+		if allDay {
+			end = end.AddDate(0, 0, 1)
+		}
+	} else if allDay {
+		end = start.AddDate(0, 0, 1)
+	} else {
+		duration := defaultEventDuration
+		if event.Duration > 0 {
+			duration = time.Duration(event.Duration) * time.Minute
+		}
+		end = start.Add(duration)
+	}
+	if !end.After(start) {
+		return nil, fmt.Errorf("end is not after start")
+	}
+
+	payload := map[string]interface{}{
+		"summary": event.Summary,
+	}
+	if allDay {
+		payload["start"] = map[string]string{"date": start.Format("2006-01-02")}
+		payload["end"] = map[string]string{"date": end.Format("2006-01-02")}
+	} else {
+		zone := config.TimeZone.String()
+		payload["start"] = map[string]string{"dateTime": start.Format(time.RFC3339), "timeZone": zone}
+		payload["end"] = map[string]string{"dateTime": end.Format(time.RFC3339), "timeZone": zone}
+	}
+	if event.Description != "" {
+		payload["description"] = event.Description
+	}
+	if event.Location != "" {
+		payload["location"] = event.Location
+	}
+	if config.ColorID != "" {
+		payload["colorId"] = config.ColorID
+	}
+
+	seen := make(map[string]bool)
+	var attendees []map[string]string
+	for _, email := range append(append([]string(nil), config.Attendees...), event.Attendees...) {
+		if key := strings.ToLower(email); !seen[key] {
+			seen[key] = true
+			attendees = append(attendees, map[string]string{"email": email})
+		}
+	}
+	if len(attendees) > 0 {
+		payload["attendees"] = attendees
+	}
+
+	if len(config.Reminders) > 0 {
+		overrides := make([]map[string]interface{}, 0, len(config.Reminders))
+		for _, reminder := range config.Reminders {
+			method, minutes, _ := parseReminder(reminder)
+			overrides = append(overrides, map[string]interface{}{"method": method, "minutes": minutes})
+		}
+		payload["reminders"] = map[string]interface{}{"useDefault": false, "overrides": overrides}
+	}
+
+	if config.Deduplicate {
+		payload["id"] = calendarEventID(config.CalendarID, executionID, event.Summary, event.Start)
+	}
+	return payload, nil
+}
+
+// parseEventTime reads an RFC 3339 time, a local time of the location, a
+// date for an all-day event, or an offset from now such as "+90m".
+func parseEventTime(value string, location *time.Location, now time.Time) (time.Time, bool, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "+") {
+		offset, err := time.ParseDuration(value[1:])
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		return now.Add(offset).In(location).Truncate(time.Minute), false, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, location); err == nil {
+		return t, true, nil
+	}
+	for _, layout := range eventTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, location); err == nil {
+			return t, false, nil
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("%q is not a date, a time or an offset", value)
+}
+
+// parseReminder reads "popup:10" or "email:1440", or minutes alone for a
+// popup.
+func parseReminder(reminder string) (string, int, error) {
+	method, value := "popup", reminder
+	if before, after, found := strings.Cut(reminder, ":"); found {
+		method, value = strings.TrimSpace(before), after
+	}
+	minutes, err := strconv.Atoi(strings.TrimSpace(value))
+	// Google allows up to four weeks ahead
+	if err != nil || minutes < 0 || minutes > 40320 {
+		return "", 0, fmt.Errorf("invalid reminder %q: minutes must be between 0 and 40320", reminder)
+	}
+	if method != "popup" && method != "email" {
+		return "", 0, fmt.Errorf("invalid reminder %q: method must be popup or email", reminder)
+	}
+	return method, minutes, nil
+}
+
+// calendarEventID derives an event ID, of the lowercase hex digits Google
+// accepts, from what identifies the event. The start is the one of the
+// event, not the time computed from it, which changes with offsets.
+func calendarEventID(calendarID, executionID, summary, start string) string {
+	sum := sha256.Sum256([]byte(calendarID + "\x00" + executionID + "\x00" + summary + "\x00" + strings.TrimSpace(start)))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,101 @@
+package action_service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseEventTime(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	now := time.Date(2025, 3, 10, 8, 15, 42, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		value      string
+		want       time.Time
+		wantAllDay bool
+		wantErr    bool
+	}{
+		{"RFC 3339", "2025-03-12T09:30:00Z", time.Date(2025, 3, 12, 9, 30, 0, 0, time.UTC), false, false},
+		{"RFC 3339 with offset", "2025-03-12T09:30:00+02:00", time.Date(2025, 3, 12, 7, 30, 0, 0, time.UTC), false, false},
+		{"local time", "2025-03-12T09:30", time.Date(2025, 3, 12, 9, 30, 0, 0, paris), false, false},
+		{"local time with space", "2025-03-12 09:30:15", time.Date(2025, 3, 12, 9, 30, 15, 0, paris), false, false},
+		{"date", "2025-03-12", time.Date(2025, 3, 12, 0, 0, 0, 0, paris), true, false},
+		{"offset", "+90m", time.Date(2025, 3, 10, 9, 45, 0, 0, time.UTC), false, false},
+		{"padded offset", "  +24h ", time.Date(2025, 3, 11, 8, 15, 0, 0, time.UTC), false, false},
+		{"bad offset", "+soon", time.Time{}, false, true},
+		{"text", "next tuesday", time.Time{}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, allDay, err := parseEventTime(tt.value, paris, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseEventTime(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) || allDay != tt.wantAllDay {
+				t.Errorf("parseEventTime(%q) = %v, %v, want %v, %v", tt.value, got, allDay, tt.want, tt.wantAllDay)
+			}
+		})
+	}
+}
+
+func TestParseReminder(t *testing.T) {
+	tests := []struct {
+		reminder    string
+		wantMethod  string
+		wantMinutes int
+		wantErr     bool
+	}{
+		{"popup:10", "popup", 10, false},
+		{"email: 1440", "email", 1440, false},
+		{"30", "popup", 30, false},
+		{"0", "popup", 0, false},
+		{"popup:40320", "popup", 40320, false},
+		{"popup:40321", "", 0, true},
+		{"popup:-5", "", 0, true},
+		{"sms:10", "", 0, true},
+		{"email:soon", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.reminder, func(t *testing.T) {
+			method, minutes, err := parseReminder(tt.reminder)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseReminder(%q) error = %v, wantErr %v", tt.reminder, err, tt.wantErr)
+			}
+			if method != tt.wantMethod || minutes != tt.wantMinutes {
+				t.Errorf("parseReminder(%q) = %s, %d, want %s, %d", tt.reminder, method, minutes, tt.wantMethod, tt.wantMinutes)
+			}
+		})
+	}
+}
+
+func TestCalendarEventIDIsStableAcrossRetries(t *testing.T) {
+	config := &CalendarEventConfig{CalendarID: "primary", TimeZone: time.UTC, Deduplicate: true}
+	event := CalendarEvent{Summary: "Publish", Start: "+90m"}
+
+	first, err := eventPayload(event, config, "exec-1", time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// A retry a few minutes later computes another start but finds the event
+	retried, err := eventPayload(event, config, "exec-1", time.Date(2025, 3, 10, 8, 7, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first["id"] != retried["id"] {
+		t.Errorf("expected the retry to reuse the event ID, got %v and %v", first["id"], retried["id"])
+	}
+
+	next, _ := eventPayload(event, config, "exec-2", time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC))
+	if next["id"] == first["id"] {
+		t.Error("expected another execution to create its own event")
+	}
+	if id, _ := first["id"].(string); len(id) != 32 {
+		t.Errorf("expected 32 hex digits, got %q", id)
+	}
+}
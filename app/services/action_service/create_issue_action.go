@@ -0,0 +1,466 @@
+package action_service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+const CreateIssueServiceName = "create_issue"
+
+// Issue trackers.
+const (
+	IssueTrackerGitHub = "github"
+	IssueTrackerJira   = "jira"
+)
+
+const (
+	gitHubAPIBaseURL = "https://api.github.com"
+	// maxIssueTitleLength is the summary limit of Jira, GitHub allows more
+	maxIssueTitleLength = 255
+)
+
+type CreateIssueActionService struct {
+	logger     *slog.Logger
+	httpClient *http.Client
+}
+
+func NewCreateIssueActionService(logger *slog.Logger) *CreateIssueActionService {
+	return &CreateIssueActionService{
+		logger:     logger,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type IssueConfig struct {
+	Tracker string
+	// APIURL is the GitHub API, or the Jira site such as
+	// https://example.atlassian.net
+	APIURL string
+	// AccessToken is the GitHub token
+	AccessToken string
+	// Username and APIKey are the Jira account email and API token
+	Username   string
+	APIKey     string
+	Repository string
+	ProjectKey string
+	IssueType  string
+	Labels     []string
+	Assignees  []string
+	// Deduplicate skips the issue when an open one has the same title
+	Deduplicate bool
+}
+
+// Issue is an opened, or already open, issue.
+type Issue struct {
+	ID  string `json:"id"`
+	Key string `json:"key"`
+	URL string `json:"url"`
+}
+
+// Execute opens a GitHub issue or a Jira ticket. The title and body are
+// templates filled with the pipeline outputs; the body defaults to the text
+// outputs of the required steps. The files of the required steps having a URL
+// are linked in an artifacts section. With create_if, a dotted output path,
+// nothing is opened unless the value is set and not false, zero or empty.
+func (s *CreateIssueActionService) Execute(ctx context.Context, actionConfig string, pipelineContext *pipeline_type.Context, step *pipeline_type.PipelineStep) (string, error) {
+	if step.ActionDetails == nil || step.ActionDetails.Configuration == nil {
+		return "", fmt.Errorf("missing action configuration for CreateIssueAction")
+	}
+
+	config := step.ActionDetails.Configuration
+	issueConfig, err := extractIssueConfig(config)
+	if err != nil {
+		return "", fmt.Errorf("error extracting issue configuration: %w", err)
+	}
+
+	if condition := getStringValue(config, "create_if", ""); condition != "" {
+		value, ok := pipelineContext.GetPath(condition)
+		if !ok || !actionable(value) {
+			s.logger.InfoContext(ctx, "Nothing actionable, no issue opened",
+				slog.String("step_id", step.ID),
+				slog.String("create_if", condition))
+			return marshalIssueResult(issueConfig.Tracker, nil, false, false)
+		}
+	}
+
+	title, body, err := issueContent(config, issueConfig.Tracker, step, pipelineContext)
+	if err != nil {
+		return "", err
+	}
+
+	if issueConfig.Deduplicate {
+		existing, err := s.findOpenIssue(ctx, issueConfig, title)
+		if err != nil {
+			return "", fmt.Errorf("error searching open issues: %w", err)
+		}
+		if existing != nil {
+			s.logger.InfoContext(ctx, "Issue already open",
+				slog.String("tracker", issueConfig.Tracker),
+				slog.String("issue", existing.Key))
+			return marshalIssueResult(issueConfig.Tracker, existing, false, true)
+		}
+	}
+
+	var issue *Issue
+	switch issueConfig.Tracker {
+	case IssueTrackerGitHub:
+		issue, err = s.createGitHubIssue(ctx, issueConfig, title, body)
+	case IssueTrackerJira:
+		issue, err = s.createJiraIssue(ctx, issueConfig, title, body)
+	}
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to open issue",
+			slog.String("error", err.Error()),
+			slog.String("tracker", issueConfig.Tracker))
+		return "", fmt.Errorf("failed to open %s issue: %w", issueConfig.Tracker, err)
+	}
+
+	s.logger.InfoContext(ctx, "Issue opened",
+		slog.String("tracker", issueConfig.Tracker),
+		slog.String("issue", issue.Key),
+		slog.String("url", issue.URL))
+	return marshalIssueResult(issueConfig.Tracker, issue, true, false)
+}
+
+func (s *CreateIssueActionService) CanHandle(actionService string) bool {
+	return actionService == CreateIssueServiceName
+}
+
+// ValidateCredentials reads the repository, or the Jira user of the token.
+func (s *CreateIssueActionService) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	issueConfig, err := extractIssueConfig(config)
+	if err != nil {
+		return err
+	}
+	endpoint := issueConfig.APIURL + "/rest/api/2/myself"
+	if issueConfig.Tracker == IssueTrackerGitHub {
+		endpoint = issueConfig.APIURL + "/repos/" + issueConfig.Repository
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	issueConfig.authorize(req)
+	return checkCredentialResponse(s.httpClient.Do(req))
+}
+
+func (s *CreateIssueActionService) createGitHubIssue(ctx context.Context, config *IssueConfig, title, body string) (*Issue, error) {
+	payload := map[string]interface{}{
+		"title": title,
+		"body":  body,
+	}
+	if len(config.Labels) > 0 {
+		payload["labels"] = config.Labels
+	}
+	if len(config.Assignees) > 0 {
+		payload["assignees"] = config.Assignees
+	}
+	var created struct {
+		Number  int    `json:"number"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := s.do(ctx, config, http.MethodPost, "/repos/"+config.Repository+"/issues", payload, &created); err != nil {
+		return nil, err
+	}
+	return &Issue{
+		ID:  fmt.Sprintf("%d", created.Number),
+		Key: fmt.Sprintf("%s#%d", config.Repository, created.Number),
+		URL: created.HTMLURL,
+	}, nil
+}
+
+func (s *CreateIssueActionService) createJiraIssue(ctx context.Context, config *IssueConfig, title, body string) (*Issue, error) {
+	// The v2 API takes the description as wiki markup, v3 only as documents
+	fields := map[string]interface{}{
+		"project":     map[string]string{"key": config.ProjectKey},
+		"issuetype":   map[string]string{"name": config.IssueType},
+		"summary":     title,
+		"description": body,
+	}
+	if len(config.Labels) > 0 {
+		fields["labels"] = config.Labels
+	}
+	if len(config.Assignees) > 0 {
+		fields["assignee"] = map[string]string{"accountId": config.Assignees[0]}
+	}
+	var created struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	if err := s.do(ctx, config, http.MethodPost, "/rest/api/2/issue", map[string]interface{}{"fields": fields}, &created); err != nil {
+		return nil, err
+	}
+	return &Issue{
+		ID:  created.ID,
+		Key: created.Key,
+		URL: config.APIURL + "/browse/" + created.Key,
+	}, nil
+}
+
+// findOpenIssue returns the open issue with the title, if any.
+func (s *CreateIssueActionService) findOpenIssue(ctx context.Context, config *IssueConfig, title string) (*Issue, error) {
+	if config.Tracker == IssueTrackerGitHub {
+		query := fmt.Sprintf(`repo:%s is:issue is:open in:title %s`, config.Repository, quoteSearchString(title))
+		var found struct {
+			Items []struct {
+				Number  int    `json:"number"`
+				Title   string `json:"title"`
+				HTMLURL string `json:"html_url"`
+			} `json:"items"`
+		}
+		if err := s.do(ctx, config, http.MethodGet, "/search/issues?q="+url.QueryEscape(query), nil, &found); err != nil {
+			return nil, err
+		}
+		// The search matches words, the title must be the same
+		for _, item := range found.Items {
+			if item.Title == title {
+				return &Issue{
+					ID:  fmt.Sprintf("%d", item.Number),
+					Key: fmt.Sprintf("%s#%d", config.Repository, item.Number),
+					URL: item.HTMLURL,
+				}, nil
+			}
+		}
+		return nil, nil
+	}
+
+	// The summary is searched as a phrase, itself quoted as a JQL string
+	jql := fmt.Sprintf(`project = %s AND summary ~ %s AND statusCategory != Done`,
+		quoteSearchString(config.ProjectKey), quoteSearchString(quoteSearchString(title)))
+	var found struct {
+		Issues []struct {
+			ID     string `json:"id"`
+			Key    string `json:"key"`
+			Fields struct {
+				Summary string `json:"summary"`
+			} `json:"fields"`
+		} `json:"issues"`
+	}
+	path := "/rest/api/3/search/jql?fields=summary&maxResults=20&jql=" + url.QueryEscape(jql)
+	if err := s.do(ctx, config, http.MethodGet, path, nil, &found); err != nil {
+		return nil, err
+	}
+	for _, item := range found.Issues {
+		if item.Fields.Summary == title {
+			return &Issue{ID: item.ID, Key: item.Key, URL: config.APIURL + "/browse/" + item.Key}, nil
+		}
+	}
+	return nil, nil
+}
+
+// quoteSearchString quotes text as a string of the search queries, escaping
+// its quotes and backslashes.
+func quoteSearchString(text string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text) + `"`
+}
+
+// do calls the tracker API and decodes its JSON answer.
+func (s *CreateIssueActionService) do(ctx context.Context, config *IssueConfig, method, path string, payload, result interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("error marshaling payload: %w", err)
+		}
+		body = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, config.APIURL+path, body)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	config.authorize(req)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return fmt.Errorf("error parsing response: %w", err)
+	}
+	return nil
+}
+
+// authorize sets the credentials of the tracker on a request.
+func (c *IssueConfig) authorize(req *http.Request) {
+	req.Header.Set("Accept", "application/json")
+	if c.Tracker == IssueTrackerGitHub {
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("Authorization", "Bearer "+c.AccessToken)
+		req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+		return
+	}
+	req.SetBasicAuth(c.Username, c.APIKey)
+}
+
+// issueContent fills the title and body templates and appends the links to
+// the artifacts, in the markup of the tracker.
+func issueContent(config map[string]interface{}, tracker string, step *pipeline_type.PipelineStep, pipelineContext *pipeline_type.Context) (string, string, error) {
+	var texts []string
+	var links []string
+	for _, requiredStep := range step.RequiredStepKeys() {
+		if files, err := pipelineContext.GetFileList(requiredStep); err == nil && describesFiles(files) {
+			for _, file := range files {
+				if file.URL == "" {
+					continue
+				}
+				if tracker == IssueTrackerJira {
+					links = append(links, fmt.Sprintf("* [%s|%s]", attachmentName(file), file.URL))
+				} else {
+					links = append(links, fmt.Sprintf("- [%s](%s)", attachmentName(file), file.URL))
+				}
+			}
+			continue
+		}
+		stepOutput, err := pipelineContext.GetString(requiredStep)
+		if err != nil {
+			return "", "", fmt.Errorf("error reading issue content: %w", err)
+		}
+		texts = append(texts, strings.TrimSpace(stepOutput))
+	}
+
+	// Titles are a single line
+	title := strings.Join(strings.Fields(fillEmailTemplate(getStringValue(config, "title", ""), pipelineContext)), " ")
+	if title == "" {
+		return "", "", fmt.Errorf("the issue has no title")
+	}
+	if runes := []rune(title); len(runes) > maxIssueTitleLength {
+		title = string(runes[:maxIssueTitleLength-3]) + "..."
+	}
+
+	body := strings.Join(texts, "\n\n")
+	if template := getStringValue(config, "body", ""); template != "" {
+		body = fillEmailTemplate(template, pipelineContext)
+	}
+	if len(links) > 0 {
+		heading := "### Artifacts"
+		if tracker == IssueTrackerJira {
+			heading = "h3. Artifacts"
+		}
+		body = strings.TrimSpace(body + "\n\n" + heading + "\n\n" + strings.Join(links, "\n"))
+	}
+	return title, body, nil
+}
+
+// actionable tells whether a create_if value asks for an issue.
+func actionable(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		v = strings.ToLower(strings.TrimSpace(v))
+		return v != "" && v != "false" && v != "0" && v != "no" && v != "none"
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}:
+		return len(v) > 0
+	}
+	return true
+}
+
+func marshalIssueResult(tracker string, issue *Issue, created, duplicate bool) (string, error) {
+	response := map[string]interface{}{
+		"success":   true,
+		"tracker":   tracker,
+		"created":   created,
+		"timestamp": time.Now().Unix(),
+	}
+	if duplicate {
+		response["duplicate"] = true
+	}
+	if issue != nil {
+		response["issue_id"] = issue.ID
+		response["issue_key"] = issue.Key
+		response["issue_url"] = issue.URL
+	}
+	resultJSON, err := json.Marshal(response)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling result: %w", err)
+	}
+	return string(resultJSON), nil
+}
+
+// splitList reads a list config value, given as a list or comma separated.
+func splitList(value interface{}) []string {
+	var items []string
+	switch v := value.(type) {
+	case string:
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && strings.TrimSpace(s) != "" {
+				items = append(items, strings.TrimSpace(s))
+			}
+		}
+	}
+	return items
+}
+
+func extractIssueConfig(config map[string]interface{}) (*IssueConfig, error) {
+	issueConfig := &IssueConfig{
+		Tracker:     getStringValue(config, "provider", ""),
+		APIURL:      strings.TrimRight(getStringValue(config, "api_url", ""), "/"),
+		AccessToken: getStringValue(config, "access_token", ""),
+		Username:    getStringValue(config, "username", ""),
+		APIKey:      getStringValue(config, "api_key", ""),
+		Repository:  strings.Trim(getStringValue(config, "repository", ""), "/"),
+		ProjectKey:  getStringValue(config, "project_key", ""),
+		IssueType:   getStringValue(config, "issue_type", "Task"),
+		Labels:      splitList(config["labels"]),
+		Assignees:   splitList(config["assignees"]),
+		Deduplicate: getBoolValue(config, "deduplicate", false),
+	}
+	switch issueConfig.Tracker {
+	case IssueTrackerGitHub:
+		if issueConfig.APIURL == "" {
+			issueConfig.APIURL = gitHubAPIBaseURL
+		}
+		if issueConfig.AccessToken == "" {
+			return nil, fmt.Errorf("access_token not found in config")
+		}
+		if strings.Count(issueConfig.Repository, "/") != 1 {
+			return nil, fmt.Errorf("repository must be owner/name")
+		}
+	case IssueTrackerJira:
+		if issueConfig.APIURL == "" {
+			return nil, fmt.Errorf("api_url of the Jira site not found in config")
+		}
+		if issueConfig.Username == "" || issueConfig.APIKey == "" {
+			return nil, fmt.Errorf("username and api_key not found in config")
+		}
+		if issueConfig.ProjectKey == "" {
+			return nil, fmt.Errorf("project_key not found in config")
+		}
+	default:
+		return nil, fmt.Errorf("unknown issue tracker %q", issueConfig.Tracker)
+	}
+	return issueConfig, nil
+}
@@ -0,0 +1,154 @@
+package action_service
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+func issueStep(config map[string]interface{}) *pipeline_type.PipelineStep {
+	return &pipeline_type.PipelineStep{
+		ID:            "open_issue",
+		RequiredSteps: "report",
+		ActionDetails: &pipeline_type.ActionDetails{ActionService: CreateIssueServiceName, Configuration: config},
+	}
+}
+
+func issueContext() *pipeline_type.Context {
+	ctx := pipeline_type.NewContext()
+	ctx.SetStepOutput("report", "Broken links found on 3 pages.")
+	ctx.SetStepOutput("audit", `{"site":"example.com"}`)
+	return ctx
+}
+
+func TestCreateGitHubIssue(t *testing.T) {
+	var created map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer ghp_token" {
+			t.Errorf("unexpected authorization %q", r.Header.Get("Authorization"))
+		}
+		switch r.URL.Path {
+		case "/search/issues":
+			json.NewEncoder(w).Encode(map[string]interface{}{"items": []interface{}{
+				map[string]interface{}{"number": 3, "title": "Audit of example.com, part 2", "html_url": "https://github.com/acme/site/issues/3"},
+			}})
+		case "/repos/acme/site/issues":
+			json.NewDecoder(r.Body).Decode(&created)
+			json.NewEncoder(w).Encode(map[string]interface{}{"number": 7, "html_url": "https://github.com/acme/site/issues/7"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	s := NewCreateIssueActionService(slog.Default())
+	step := issueStep(map[string]interface{}{
+		"provider":     IssueTrackerGitHub,
+		"api_url":      srv.URL,
+		"access_token": "ghp_token",
+		"repository":   "acme/site",
+		"title":        "Audit of {audit.site}",
+		"labels":       "audit, seo",
+		"deduplicate":  true,
+	})
+	result, err := s.Execute(context.Background(), "", issueContext(), step)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var response map[string]interface{}
+	json.Unmarshal([]byte(result), &response)
+	if response["created"] != true || response["issue_key"] != "acme/site#7" {
+		t.Errorf("unexpected result %s", result)
+	}
+	if created["title"] != "Audit of example.com" || created["body"] != "Broken links found on 3 pages." {
+		t.Errorf("unexpected issue %v", created)
+	}
+	if labels, _ := created["labels"].([]interface{}); len(labels) != 2 {
+		t.Errorf("expected the labels, got %v", created["labels"])
+	}
+}
+
+func TestCreateJiraIssueDeduplicates(t *testing.T) {
+	var jql string
+	createdIssues := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, key, _ := r.BasicAuth(); user != "bot@example.com" || key != "jira-token" {
+			t.Errorf("unexpected credentials %s:%s", user, key)
+		}
+		switch r.URL.Path {
+		case "/rest/api/3/search/jql":
+			jql = r.URL.Query().Get("jql")
+			json.NewEncoder(w).Encode(map[string]interface{}{"issues": []interface{}{
+				map[string]interface{}{"id": "10001", "key": "WEB-12", "fields": map[string]interface{}{"summary": `Fix "404" on C:\docs`}},
+			}})
+		case "/rest/api/2/issue":
+			createdIssues++
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": "10002", "key": "WEB-13"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	s := NewCreateIssueActionService(slog.Default())
+	config := map[string]interface{}{
+		"provider":    IssueTrackerJira,
+		"api_url":     srv.URL,
+		"username":    "bot@example.com",
+		"api_key":     "jira-token",
+		"project_key": "WEB",
+		"title":       `Fix "404" on C:\docs`,
+		"deduplicate": true,
+	}
+	result, err := s.Execute(context.Background(), "", issueContext(), issueStep(config))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var response map[string]interface{}
+	json.Unmarshal([]byte(result), &response)
+	if response["duplicate"] != true || response["issue_key"] != "WEB-12" || createdIssues != 0 {
+		t.Errorf("expected the open issue reused, got %s", result)
+	}
+	// The phrase is escaped once for the search, then once for the JQL string
+	want := `project = "WEB" AND summary ~ "\"Fix \\\"404\\\" on C:\\\\docs\"" AND statusCategory != Done`
+	if jql != want {
+		t.Errorf("got JQL %s, want %s", jql, want)
+	}
+
+	config["title"] = "Another problem"
+	result, err = s.Execute(context.Background(), "", issueContext(), issueStep(config))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	json.Unmarshal([]byte(result), &response)
+	if response["created"] != true || response["issue_url"] != srv.URL+"/browse/WEB-13" || createdIssues != 1 {
+		t.Errorf("expected a new issue, got %s", result)
+	}
+}
+
+func TestCreateIssueSkipsWhenNotActionable(t *testing.T) {
+	s := NewCreateIssueActionService(slog.Default())
+	step := issueStep(map[string]interface{}{
+		"provider":     IssueTrackerGitHub,
+		"api_url":      "http://127.0.0.1:0",
+		"access_token": "ghp_token",
+		"repository":   "acme/site",
+		"title":        "Audit",
+		"create_if":    "audit.problems",
+	})
+	result, err := s.Execute(context.Background(), "", issueContext(), step)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var response map[string]interface{}
+	json.Unmarshal([]byte(result), &response)
+	if response["created"] != false {
+		t.Errorf("expected no issue without problems, got %s", result)
+	}
+}
@@ -0,0 +1,97 @@
+package action_service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/dghubble/oauth1"
+	"github.com/serisow/lesocle/services/llm_service"
+)
+
+// CredentialValidator is implemented by the action services able to check
+// their credentials without publishing anything, for the provider health.
+type CredentialValidator interface {
+	ValidateCredentials(ctx context.Context, config map[string]interface{}) error
+}
+
+// checkCredentialResponse maps the rejections of a credential check to
+// llm_service.ErrInvalidCredentials.
+func checkCredentialResponse(resp *http.Response, err error) error {
+	if err != nil {
+		// The URL may carry the token
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%w: status %d", llm_service.ErrInvalidCredentials, resp.StatusCode)
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// ValidateCredentials reads the page with the token, which must grant access
+// to it.
+func (s *FacebookShareActionService) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	credentials, err := extractFacebookCredentials(config)
+	if err != nil {
+		return err
+	}
+	return s.validateAccessToken(ctx, credentials)
+}
+
+// ValidateCredentials reads the member of the token.
+func (s *LinkedInShareActionService) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	credentials, err := extractLinkedInCredentials(config)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, linkedInAPIBaseURL+"/userinfo", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+credentials.AccessToken)
+	return checkCredentialResponse(http.DefaultClient.Do(req))
+}
+
+// ValidateCredentials reads the user of the tokens.
+func (s *PostTweetActionService) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	credentials, err := extractTwitterCredentials(config)
+	if err != nil {
+		return err
+	}
+	return validateTwitterUser(ctx, credentials.ConsumerKey, credentials.ConsumerSecret, credentials.AccessToken, credentials.AccessTokenSecret)
+}
+
+// ValidateCredentials reads the user of the tokens.
+func (s *SearchTweetsActionService) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	searchConfig, err := extractTwitterSearchConfig(config)
+	if err != nil {
+		return err
+	}
+	return validateTwitterUser(ctx, searchConfig.ConsumerKey, searchConfig.ConsumerSecret, searchConfig.AccessToken, searchConfig.AccessTokenSecret)
+}
+
+func validateTwitterUser(ctx context.Context, consumerKey, consumerSecret, accessToken, accessTokenSecret string) error {
+	client := oauth1.NewConfig(consumerKey, consumerSecret).Client(ctx, oauth1.NewToken(accessToken, accessTokenSecret))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, twitterAPIV2BaseURL+"/users/me", nil)
+	if err != nil {
+		return err
+	}
+	return checkCredentialResponse(client.Do(req))
+}
+
+// ValidateCredentials reads the Twilio account.
+func (s *SendSMSActionService) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	provider, err := newSMSProvider(config, s.httpClient)
+	if err != nil {
+		return err
+	}
+	return provider.Validate(ctx)
+}
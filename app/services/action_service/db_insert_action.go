@@ -0,0 +1,345 @@
+package action_service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+const DBInsertServiceName = "db_insert"
+
+// Supported databases.
+const (
+	DBPostgres = "postgres"
+	DBMySQL    = "mysql"
+)
+
+// dbDrivers are the database/sql drivers of the databases.
+var dbDrivers = map[string]string{
+	DBPostgres: "pgx",
+	DBMySQL:    "mysql",
+}
+
+// Column values not taken from the outputs.
+const (
+	// dbValueNow is the time of the insert
+	dbValueNow = "@now"
+	// dbValueStepID is the ID of the step
+	dbValueStepID = "@step_id"
+	// dbItemPrefix starts the paths read in each item of rows_from
+	dbItemPrefix = "item"
+)
+
+// dbDSNEnvPrefix starts the names of the environment variables dsn_env may
+// read, so a pipeline can't read the other secrets of the service.
+const dbDSNEnvPrefix = "DB_INSERT_DSN_"
+
+// dbIdentifier matches the table and column names, optionally schema
+// qualified, the only part of the queries not passed as parameters.
+var dbIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// dbPools keeps a connection pool per database, shared by the executions.
+var dbPools = struct {
+	sync.Mutex
+	byDSN map[string]*sql.DB
+}{byDSN: make(map[string]*sql.DB)}
+
+type DBInsertActionService struct {
+	logger *slog.Logger
+}
+
+func NewDBInsertActionService(logger *slog.Logger) *DBInsertActionService {
+	return &DBInsertActionService{
+		logger: logger,
+	}
+}
+
+type DBInsertConfig struct {
+	Database string
+	DSN      string
+	Table    string
+	// Columns maps the columns to the paths of their values
+	Columns map[string]string
+	// RowsFrom is the path of a list inserted as one row per item
+	RowsFrom string
+	// Rows violating a unique constraint are skipped instead of failing
+	IgnoreConflicts bool
+}
+
+// Execute inserts a row, or a row per item of the rows_from list, into the
+// table. The columns map takes each column to a dotted path in the outputs,
+// such as "article.title", to "item." paths in the rows_from items, or to
+// @now and @step_id. Objects and lists are stored as JSON, and every value is
+// passed as a query parameter.
+func (s *DBInsertActionService) Execute(ctx context.Context, actionConfig string, pipelineContext *pipeline_type.Context, step *pipeline_type.PipelineStep) (string, error) {
+	if step.ActionDetails == nil || step.ActionDetails.Configuration == nil {
+		return "", fmt.Errorf("missing action configuration for DBInsertAction")
+	}
+
+	config, err := extractDBInsertConfig(step.ActionDetails.Configuration)
+	if err != nil {
+		return "", fmt.Errorf("error extracting database configuration: %w", err)
+	}
+	rows, err := dbRows(config, step.ID, pipelineContext)
+	if err != nil {
+		return "", err
+	}
+
+	db, err := dbPool(config.Database, config.DSN)
+	if err != nil {
+		return "", err
+	}
+	columns := make([]string, 0, len(config.Columns))
+	for column := range config.Columns {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	query := insertQuery(config.Database, config.Table, columns, config.IgnoreConflicts)
+
+	// The rows of an execution are inserted all or none
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+	var inserted int64
+	for i, row := range rows {
+		args := make([]interface{}, len(columns))
+		for j, column := range columns {
+			args[j] = row[column]
+		}
+		result, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return "", fmt.Errorf("error inserting row %d into %s: %w", i+1, config.Table, err)
+		}
+		if n, err := result.RowsAffected(); err == nil {
+			inserted += n
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("error committing the inserts: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "Inserted rows",
+		slog.String("table", config.Table),
+		slog.Int64("rows", inserted))
+	response := map[string]interface{}{
+		"success":       true,
+		"database":      config.Database,
+		"table":         config.Table,
+		"rows":          len(rows),
+		"rows_inserted": inserted,
+		"timestamp":     time.Now().Unix(),
+	}
+	resultJSON, err := json.Marshal(response)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling result: %w", err)
+	}
+	return string(resultJSON), nil
+}
+
+func (s *DBInsertActionService) CanHandle(actionService string) bool {
+	return actionService == DBInsertServiceName
+}
+
+// ValidateCredentials pings the database.
+func (s *DBInsertActionService) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	insertConfig, err := extractDBInsertConfig(config)
+	if err != nil {
+		return err
+	}
+	db, err := dbPool(insertConfig.Database, insertConfig.DSN)
+	if err != nil {
+		return err
+	}
+	return db.PingContext(ctx)
+}
+
+// dbRows resolves the column values of the rows to insert.
+func dbRows(config *DBInsertConfig, stepID string, pipelineContext *pipeline_type.Context) ([]map[string]interface{}, error) {
+	items := []interface{}{nil}
+	if config.RowsFrom != "" {
+		value, ok := pipelineContext.GetPath(config.RowsFrom)
+		if !ok {
+			return nil, fmt.Errorf("rows_from path %s not found", config.RowsFrom)
+		}
+		list, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("rows_from path %s is not a list", config.RowsFrom)
+		}
+		if len(list) == 0 {
+			return nil, nil
+		}
+		items = list
+	}
+
+	now := time.Now().UTC()
+	rows := make([]map[string]interface{}, 0, len(items))
+	for i, item := range items {
+		row := make(map[string]interface{}, len(config.Columns))
+		for column, path := range config.Columns {
+			var value interface{}
+			var ok bool
+			switch {
+			case path == dbValueNow:
+				value, ok = now, true
+			case path == dbValueStepID:
+				value, ok = stepID, true
+			case config.RowsFrom != "" && (path == dbItemPrefix || strings.HasPrefix(path, dbItemPrefix+".")):
+				segments := strings.Split(path, ".")[1:]
+				value, ok = pipeline_type.WalkPath(item, segments)
+			default:
+				value, ok = pipelineContext.GetPath(path)
+			}
+			if !ok {
+				return nil, fmt.Errorf("row %d: path %s of column %s not found", i+1, path, column)
+			}
+			if row[column], ok = dbValue(value); !ok {
+				return nil, fmt.Errorf("row %d: column %s: value of %s cannot be stored", i+1, column, path)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// dbValue converts a decoded JSON value to a query parameter, objects and
+// lists as JSON text.
+func dbValue(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}, []interface{}:
+		encoded, err := json.Marshal(v)
+		return string(encoded), err == nil
+	default:
+		return v, true
+	}
+}
+
+// insertQuery builds the parameterized insert of the database.
+func insertQuery(database, table string, columns []string, ignoreConflicts bool) string {
+	quoted := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = quoteIdentifier(database, column)
+		placeholders[i] = "?"
+		if database == DBPostgres {
+			placeholders[i] = fmt.Sprintf("$%d", i+1)
+		}
+	}
+
+	insert := "INSERT"
+	suffix := ""
+	if ignoreConflicts {
+		if database == DBMySQL {
+			insert = "INSERT IGNORE"
+		} else {
+			suffix = " ON CONFLICT DO NOTHING"
+		}
+	}
+	return fmt.Sprintf("%s INTO %s (%s) VALUES (%s)%s", insert, quoteIdentifier(database, table),
+		strings.Join(quoted, ", "), strings.Join(placeholders, ", "), suffix)
+}
+
+// quoteIdentifier quotes each part of a validated identifier.
+func quoteIdentifier(database, identifier string) string {
+	quote := `"`
+	if database == DBMySQL {
+		quote = "`"
+	}
+	parts := strings.Split(identifier, ".")
+	for i, part := range parts {
+		parts[i] = quote + part + quote
+	}
+	return strings.Join(parts, ".")
+}
+
+// dbPool returns the connection pool of the database, opening it once.
+func dbPool(database, dsn string) (*sql.DB, error) {
+	driver := dbDrivers[database]
+	registered := false
+	for _, name := range sql.Drivers() {
+		if name == driver {
+			registered = true
+		}
+	}
+	if !registered {
+		return nil, fmt.Errorf("no %s driver is compiled in this build", database)
+	}
+
+	dbPools.Lock()
+	defer dbPools.Unlock()
+	key := database + "|" + dsn
+	if db, ok := dbPools.byDSN[key]; ok {
+		return db, nil
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening the %s database: %w", database, err)
+	}
+	db.SetMaxOpenConns(4)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+	dbPools.byDSN[key] = db
+	return db, nil
+}
+
+func extractDBInsertConfig(config map[string]interface{}) (*DBInsertConfig, error) {
+	insertConfig := &DBInsertConfig{
+		Database:        getStringValue(config, "database", DBPostgres),
+		DSN:             getStringValue(config, "dsn", ""),
+		Table:           getStringValue(config, "table", ""),
+		RowsFrom:        getStringValue(config, "rows_from", ""),
+		IgnoreConflicts: getStringValue(config, "on_conflict", "") == "ignore",
+		Columns:         make(map[string]string),
+	}
+	if _, ok := dbDrivers[insertConfig.Database]; !ok {
+		return nil, fmt.Errorf("unsupported database %q", insertConfig.Database)
+	}
+	// The DSN may stay out of Drupal, in the environment of the service
+	if env := getStringValue(config, "dsn_env", ""); env != "" && insertConfig.DSN == "" {
+		if !strings.HasPrefix(env, dbDSNEnvPrefix) {
+			return nil, fmt.Errorf("dsn_env %s must start with %s", env, dbDSNEnvPrefix)
+		}
+		insertConfig.DSN = os.Getenv(env)
+	}
+	if insertConfig.DSN == "" {
+		return nil, fmt.Errorf("dsn not found in config")
+	}
+	if !dbIdentifier.MatchString(insertConfig.Table) {
+		return nil, fmt.Errorf("invalid table name %q", insertConfig.Table)
+	}
+
+	switch columns := config["columns"].(type) {
+	case map[string]interface{}:
+		for column, path := range columns {
+			insertConfig.Columns[column], _ = path.(string)
+		}
+	case string:
+		if err := json.Unmarshal([]byte(columns), &insertConfig.Columns); err != nil {
+			return nil, fmt.Errorf("invalid columns JSON: %w", err)
+		}
+	}
+	if len(insertConfig.Columns) == 0 {
+		return nil, fmt.Errorf("columns not found in config")
+	}
+	for column, path := range insertConfig.Columns {
+		if !dbIdentifier.MatchString(column) || strings.Contains(column, ".") {
+			return nil, fmt.Errorf("invalid column name %q", column)
+		}
+		if path == "" {
+			return nil, fmt.Errorf("column %s has no path", column)
+		}
+	}
+	return insertConfig, nil
+}
@@ -0,0 +1,123 @@
+package action_service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+func TestExtractDBInsertConfigValidatesIdentifiers(t *testing.T) {
+	t.Setenv("DB_INSERT_DSN_ANALYTICS", "postgres://analytics")
+	t.Setenv("OPENAI_API_KEY", "sk-secret")
+
+	base := func(overrides map[string]interface{}) map[string]interface{} {
+		config := map[string]interface{}{
+			"dsn":     "postgres://localhost/app",
+			"table":   "public.articles",
+			"columns": map[string]interface{}{"title": "article.title"},
+		}
+		for key, value := range overrides {
+			config[key] = value
+		}
+		return config
+	}
+
+	tests := []struct {
+		name    string
+		config  map[string]interface{}
+		wantErr string
+	}{
+		{"valid", base(nil), ""},
+		{"columns as JSON", base(map[string]interface{}{"columns": `{"title":"article.title"}`}), ""},
+		{"mysql", base(map[string]interface{}{"database": DBMySQL}), ""},
+		{"unsupported database", base(map[string]interface{}{"database": "oracle"}), "unsupported database"},
+		{"injected table", base(map[string]interface{}{"table": "articles; DROP TABLE users"}), "invalid table name"},
+		{"quoted table", base(map[string]interface{}{"table": `articles"`}), "invalid table name"},
+		{"three part table", base(map[string]interface{}{"table": "db.public.articles"}), "invalid table name"},
+		{"qualified column", base(map[string]interface{}{"columns": map[string]interface{}{"a.title": "article.title"}}), "invalid column name"},
+		{"injected column", base(map[string]interface{}{"columns": map[string]interface{}{"title) VALUES (1); --": "x"}}), "invalid column name"},
+		{"column without path", base(map[string]interface{}{"columns": map[string]interface{}{"title": ""}}), "has no path"},
+		{"no columns", base(map[string]interface{}{"columns": map[string]interface{}{}}), "columns not found"},
+		{"dsn_env", base(map[string]interface{}{"dsn": "", "dsn_env": "DB_INSERT_DSN_ANALYTICS"}), ""},
+		{"dsn_env outside the prefix", base(map[string]interface{}{"dsn": "", "dsn_env": "OPENAI_API_KEY"}), "must start with DB_INSERT_DSN_"},
+		{"dsn_env unset", base(map[string]interface{}{"dsn": "", "dsn_env": "DB_INSERT_DSN_MISSING"}), "dsn not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := extractDBInsertConfig(tt.config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInsertQuery(t *testing.T) {
+	tests := []struct {
+		name            string
+		database        string
+		table           string
+		ignoreConflicts bool
+		want            string
+	}{
+		{"postgres", DBPostgres, "public.articles", false,
+			`INSERT INTO "public"."articles" ("body", "title") VALUES ($1, $2)`},
+		{"postgres ignoring conflicts", DBPostgres, "articles", true,
+			`INSERT INTO "articles" ("body", "title") VALUES ($1, $2) ON CONFLICT DO NOTHING`},
+		{"mysql", DBMySQL, "app.articles", false,
+			"INSERT INTO `app`.`articles` (`body`, `title`) VALUES (?, ?)"},
+		{"mysql ignoring conflicts", DBMySQL, "articles", true,
+			"INSERT IGNORE INTO `articles` (`body`, `title`) VALUES (?, ?)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := insertQuery(tt.database, tt.table, []string{"body", "title"}, tt.ignoreConflicts); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDBRows(t *testing.T) {
+	ctx := pipeline_type.NewContext()
+	ctx.SetStepOutput("article", `{"title":"Hello","tags":["a","b"]}`)
+	ctx.SetStepOutput("items", `[{"name":"one","meta":{"n":1}},{"name":"two","meta":{"n":2}}]`)
+
+	rows, err := dbRows(&DBInsertConfig{Columns: map[string]string{"title": "article.title", "tags": "article.tags", "step": dbValueStepID}}, "insert", ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 1 || rows[0]["title"] != "Hello" || rows[0]["tags"] != `["a","b"]` || rows[0]["step"] != "insert" {
+		t.Errorf("unexpected rows %v", rows)
+	}
+
+	rows, err = dbRows(&DBInsertConfig{RowsFrom: "items", Columns: map[string]string{"name": "item.name", "meta": "item.meta", "title": "article.title"}}, "insert", ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 2 || rows[1]["name"] != "two" || rows[1]["meta"] != `{"n":2}` || rows[1]["title"] != "Hello" {
+		t.Errorf("unexpected rows %v", rows)
+	}
+
+	if _, err := dbRows(&DBInsertConfig{Columns: map[string]string{"title": "article.missing"}}, "insert", ctx); err == nil {
+		t.Error("expected a missing path to fail")
+	}
+	if _, err := dbRows(&DBInsertConfig{RowsFrom: "article", Columns: map[string]string{"title": "item.title"}}, "insert", ctx); err == nil {
+		t.Error("expected rows_from on an object to fail")
+	}
+}
+
+func TestMySQLDriverIsCompiledIn(t *testing.T) {
+	if _, err := dbPool(DBMySQL, "user:password@tcp(127.0.0.1:3306)/app"); err != nil {
+		t.Errorf("expected the MySQL driver registered, got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package action_service
+
+import (
+	"strings"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+// DisclosurePolicy is the "AI-generated" label appended to content published
+// by the social actions when it was written by an LLM step. It is enforced here
+// rather than in prompts so no pipeline can forget it.
+type DisclosurePolicy struct {
+	Text     string
+	Hashtags []string
+}
+
+// Disclosure is the policy of the social actions, set at startup from
+// AI_DISCLOSURE_TEXT and AI_DISCLOSURE_HASHTAGS. Nothing is disclosed while
+// it is empty.
+var Disclosure DisclosurePolicy
+
+// NewDisclosurePolicy builds a policy from the text and the space separated
+// hashtags.
+func NewDisclosurePolicy(text, hashtags string) DisclosurePolicy {
+	return DisclosurePolicy{
+		Text:     strings.TrimSpace(text),
+		Hashtags: strings.Fields(hashtags),
+	}
+}
+
+// Enabled reports whether there is anything to disclose.
+func (p DisclosurePolicy) Enabled() bool {
+	return p.Text != "" || len(p.Hashtags) > 0
+}
+
+func (p DisclosurePolicy) suffix() string {
+	return strings.TrimSpace(p.Text + " " + strings.Join(p.Hashtags, " "))
+}
+
+// Apply appends the disclosure to text, unless it is already there. When
+// maxLength is positive the text is shortened so the disclosure always fits.
+func (p DisclosurePolicy) Apply(text string, maxLength int) string {
+	if !p.Enabled() || p.isDisclosed(text) {
+		return text
+	}
+
+	suffix := "\n\n" + p.suffix()
+	body := []rune(strings.TrimRight(text, " \n"))
+	if room := maxLength - len([]rune(suffix)); maxLength > 0 && len(body) > room {
+		if room <= 1 {
+			return text
+		}
+		body = append([]rune(strings.TrimRight(string(body[:room-1]), " \n")), '…')
+	}
+	return string(body) + suffix
+}
+
+func (p DisclosurePolicy) isDisclosed(text string) bool {
+	lower := strings.ToLower(text)
+	if p.Text != "" && !strings.Contains(lower, strings.ToLower(p.Text)) {
+		return false
+	}
+	for _, tag := range p.Hashtags {
+		if !strings.Contains(lower, strings.ToLower(tag)) {
+			return false
+		}
+	}
+	return true
+}
+
+// generatedByLLM reports whether one of the outputs the step consumes was
+// produced by an LLM step.
+func generatedByLLM(step *pipeline_type.PipelineStep, pipelineContext *pipeline_type.Context) bool {
+	for _, key := range step.RequiredStepKeys() {
+		if producer, ok := pipelineContext.GetStepByOutputKey(key); ok && producer.Type == "llm_step" {
+			return true
+		}
+	}
+	return false
+}
+
+// applyDisclosure labels the text of a post when its content comes from an LLM.
+func applyDisclosure(text string, maxLength int, step *pipeline_type.PipelineStep, pipelineContext *pipeline_type.Context) string {
+	if !generatedByLLM(step, pipelineContext) {
+		return text
+	}
+	return Disclosure.Apply(text, maxLength)
+}
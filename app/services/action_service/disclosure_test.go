@@ -0,0 +1,43 @@
+package action_service
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDisclosurePolicyApply(t *testing.T) {
+	policy := NewDisclosurePolicy(" Written with AI ", "#AI  #GenAI")
+	suffix := "\n\nWritten with AI #AI #GenAI"
+	room := 60 - utf8.RuneCountInString(suffix)
+
+	tests := []struct {
+		name      string
+		policy    DisclosurePolicy
+		text      string
+		maxLength int
+		want      string
+	}{
+		{"empty policy", DisclosurePolicy{}, "Hello", 10, "Hello"},
+		{"no limit", policy, "Hello  \n", 0, "Hello" + suffix},
+		{"already disclosed", policy, "Hello\n\nwritten with ai #ai #genai", 0, "Hello\n\nwritten with ai #ai #genai"},
+		{"partly disclosed", policy, "Hello #AI", 0, "Hello #AI" + suffix},
+		{"fits with the disclosure", policy, strings.Repeat("a", room), 60, strings.Repeat("a", room) + suffix},
+		{"text at the cap", policy, strings.Repeat("a", 60), 60, strings.Repeat("a", room-1) + "…" + suffix},
+		{"multibyte text", policy, strings.Repeat("é日", 40), 60, string([]rune(strings.Repeat("é日", 40))[:room-1]) + "…" + suffix},
+		{"no room for the text", policy, "Hello", 20, "Hello"},
+		{"hashtags only", NewDisclosurePolicy("", "#AI"), "Hello", 0, "Hello\n\n#AI"},
+	}
+	for _, tt := range tests {
+		got := tt.policy.Apply(tt.text, tt.maxLength)
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+		if tt.maxLength > 0 && got != tt.text && utf8.RuneCountInString(got) > tt.maxLength {
+			t.Errorf("%s: %d characters exceed the limit of %d", tt.name, utf8.RuneCountInString(got), tt.maxLength)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("%s: invalid UTF-8 %q", tt.name, got)
+		}
+	}
+}
@@ -18,6 +18,9 @@ func (d *DrupalActionService) Execute(ctx context.Context, actionConfig string,
             "configuration":       step.ActionDetails.Configuration,
             "required_steps":      step.RequiredSteps,
         }
+        if pipelineContext.Sandbox {
+            contextData["sandbox"] = true
+        }
         pipelineContext.SetStepOutput(step.StepOutputKey, contextData)
     }
     return "", nil
@@ -0,0 +1,393 @@
+package action_service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+const EmailProviderServiceName = "email_provider"
+
+// Transactional email providers.
+const (
+	EmailProviderSendGrid = "sendgrid"
+	EmailProviderMailgun  = "mailgun"
+)
+
+const (
+	sendGridAPIBaseURL  = "https://api.sendgrid.com"
+	mailgunAPIBaseURL   = "https://api.mailgun.net"
+	mailgunEUAPIBaseURL = "https://api.eu.mailgun.net"
+)
+
+type EmailProviderActionService struct {
+	logger     *slog.Logger
+	httpClient *http.Client
+}
+
+func NewEmailProviderActionService(logger *slog.Logger) *EmailProviderActionService {
+	return &EmailProviderActionService{
+		logger:     logger,
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// Execute sends an email through the API of SendGrid or Mailgun, with the
+// same addresses, templates and attachments as send_email. With a template_id
+// the provider renders the message from its stored template, with the
+// template_variables of the config, whose values are templates too, or by
+// default the outputs of the required steps keyed by their output key.
+func (s *EmailProviderActionService) Execute(ctx context.Context, actionConfig string, pipelineContext *pipeline_type.Context, step *pipeline_type.PipelineStep) (string, error) {
+	if step.ActionDetails == nil || step.ActionDetails.Configuration == nil {
+		return "", fmt.Errorf("missing action configuration for EmailProviderAction")
+	}
+
+	config := step.ActionDetails.Configuration
+	provider := getStringValue(config, "provider", "")
+	apiKey, ok := config["api_key"].(string)
+	if !ok || apiKey == "" {
+		return "", fmt.Errorf("api_key not found in config")
+	}
+	templateID := getStringValue(config, "template_id", "")
+	email, err := buildEmail(config, step, pipelineContext, templateID != "")
+	if err != nil {
+		return "", err
+	}
+	variables, err := templateVariables(config, step, pipelineContext)
+	if err != nil {
+		return "", err
+	}
+
+	var messageID string
+	switch provider {
+	case EmailProviderSendGrid:
+		messageID, err = s.sendWithSendGrid(ctx, apiKey, email, templateID, variables)
+	case EmailProviderMailgun:
+		messageID, err = s.sendWithMailgun(ctx, config, apiKey, email, templateID, variables)
+	default:
+		return "", fmt.Errorf("unknown email provider %q", provider)
+	}
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to send email",
+			slog.String("error", err.Error()),
+			slog.String("provider", provider))
+		return "", fmt.Errorf("failed to send email with %s: %w", provider, err)
+	}
+
+	response := map[string]interface{}{
+		"success":    true,
+		"provider":   provider,
+		"message_id": messageID,
+		"recipients": len(email.To) + len(email.Cc) + len(email.Bcc),
+		"timestamp":  time.Now().Unix(),
+	}
+	if templateID != "" {
+		response["template_id"] = templateID
+	} else {
+		response["subject"] = email.Subject
+	}
+	resultJSON, err := json.Marshal(response)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling result: %w", err)
+	}
+	return string(resultJSON), nil
+}
+
+func (s *EmailProviderActionService) CanHandle(actionService string) bool {
+	return actionService == EmailProviderServiceName
+}
+
+// ValidateCredentials reads the scopes of a SendGrid key or the sending
+// domain of a Mailgun key.
+func (s *EmailProviderActionService) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	apiKey := getStringValue(config, "api_key", "")
+	var req *http.Request
+	var err error
+	switch provider := getStringValue(config, "provider", ""); provider {
+	case EmailProviderSendGrid:
+		if req, err = http.NewRequestWithContext(ctx, http.MethodGet, sendGridAPIBaseURL+"/v3/scopes", nil); err == nil {
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+	case EmailProviderMailgun:
+		domain := getStringValue(config, "domain", "")
+		if req, err = http.NewRequestWithContext(ctx, http.MethodGet, mailgunBaseURL(config)+"/v3/domains/"+url.PathEscape(domain), nil); err == nil {
+			req.SetBasicAuth("api", apiKey)
+		}
+	default:
+		return fmt.Errorf("unknown email provider %q", provider)
+	}
+	if err != nil {
+		return err
+	}
+	return checkCredentialResponse(s.httpClient.Do(req))
+}
+
+// sendWithSendGrid sends the email with the v3 mail send API and returns the
+// message ID.
+func (s *EmailProviderActionService) sendWithSendGrid(ctx context.Context, apiKey string, email *Email, templateID string, variables map[string]interface{}) (string, error) {
+	recipients := func(addresses []string) []map[string]string {
+		list := make([]map[string]string, 0, len(addresses))
+		for _, address := range addresses {
+			list = append(list, map[string]string{"email": address})
+		}
+		return list
+	}
+	personalization := map[string]interface{}{"to": recipients(email.To)}
+	if len(email.Cc) > 0 {
+		personalization["cc"] = recipients(email.Cc)
+	}
+	if len(email.Bcc) > 0 {
+		personalization["bcc"] = recipients(email.Bcc)
+	}
+
+	from := map[string]string{"email": email.From.Address}
+	if email.From.Name != "" {
+		from["name"] = email.From.Name
+	}
+	body := map[string]interface{}{
+		"personalizations": []map[string]interface{}{personalization},
+		"from":             from,
+	}
+	if email.Subject != "" {
+		body["subject"] = email.Subject
+	}
+	if email.ReplyTo != nil {
+		replyTo := map[string]string{"email": email.ReplyTo.Address}
+		if email.ReplyTo.Name != "" {
+			replyTo["name"] = email.ReplyTo.Name
+		}
+		body["reply_to"] = replyTo
+	}
+	if templateID != "" {
+		body["template_id"] = templateID
+		personalization["dynamic_template_data"] = variables
+	}
+	if email.Body != "" {
+		contentType := "text/plain"
+		if email.HTML {
+			contentType = "text/html"
+		}
+		body["content"] = []map[string]string{{"type": contentType, "value": email.Body}}
+	}
+	if len(email.Attachments) > 0 {
+		attachments := make([]map[string]string, 0, len(email.Attachments))
+		for _, file := range email.Attachments {
+			data, err := os.ReadFile(file.URI)
+			if err != nil {
+				return "", fmt.Errorf("error reading attachment %s: %w", attachmentName(file), err)
+			}
+			attachment := map[string]string{
+				"content":     base64.StdEncoding.EncodeToString(data),
+				"filename":    attachmentName(file),
+				"disposition": "attachment",
+			}
+			if file.MimeType != "" {
+				attachment["type"] = file.MimeType
+			}
+			attachments = append(attachments, attachment)
+		}
+		body["attachments"] = attachments
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sendGridAPIBaseURL+"/v3/mail/send", bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error executing request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		var errorResp struct {
+			Errors []struct {
+				Message string `json:"message"`
+				Field   string `json:"field"`
+			} `json:"errors"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&errorResp); err != nil || len(errorResp.Errors) == 0 {
+			return "", fmt.Errorf("sendgrid API error (HTTP %d)", resp.StatusCode)
+		}
+		messages := make([]string, 0, len(errorResp.Errors))
+		for _, e := range errorResp.Errors {
+			if e.Field != "" {
+				messages = append(messages, e.Field+": "+e.Message)
+			} else {
+				messages = append(messages, e.Message)
+			}
+		}
+		return "", fmt.Errorf("sendgrid API error (HTTP %d): %s", resp.StatusCode, strings.Join(messages, "; "))
+	}
+	return resp.Header.Get("X-Message-Id"), nil
+}
+
+// sendWithMailgun sends the email with the messages API of the domain and
+// returns the message ID.
+func (s *EmailProviderActionService) sendWithMailgun(ctx context.Context, config map[string]interface{}, apiKey string, email *Email, templateID string, variables map[string]interface{}) (string, error) {
+	domain := getStringValue(config, "domain", "")
+	if domain == "" {
+		return "", fmt.Errorf("domain not found in config")
+	}
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	fields := [][2]string{{"from", email.From.String()}}
+	for _, address := range email.To {
+		fields = append(fields, [2]string{"to", address})
+	}
+	for _, address := range email.Cc {
+		fields = append(fields, [2]string{"cc", address})
+	}
+	for _, address := range email.Bcc {
+		fields = append(fields, [2]string{"bcc", address})
+	}
+	if email.Subject != "" {
+		fields = append(fields, [2]string{"subject", email.Subject})
+	}
+	if email.ReplyTo != nil {
+		fields = append(fields, [2]string{"h:Reply-To", email.ReplyTo.String()})
+	}
+	if email.Body != "" {
+		if email.HTML {
+			fields = append(fields, [2]string{"html", email.Body})
+		} else {
+			fields = append(fields, [2]string{"text", email.Body})
+		}
+	}
+	if templateID != "" {
+		encoded, err := json.Marshal(variables)
+		if err != nil {
+			return "", fmt.Errorf("error marshaling template variables: %w", err)
+		}
+		fields = append(fields, [2]string{"template", templateID}, [2]string{"t:variables", string(encoded)})
+	}
+	for _, field := range fields {
+		if err := writer.WriteField(field[0], field[1]); err != nil {
+			return "", fmt.Errorf("error writing form field %s: %w", field[0], err)
+		}
+	}
+	for _, file := range email.Attachments {
+		if err := writeAttachment(writer, file); err != nil {
+			return "", err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return "", fmt.Errorf("error writing form: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, mailgunBaseURL(config)+"/v3/"+url.PathEscape(domain)+"/messages", &buf)
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+	req.SetBasicAuth("api", apiKey)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error executing request: %w", err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+	}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&result)
+	if resp.StatusCode != http.StatusOK {
+		if decodeErr != nil || result.Message == "" {
+			return "", fmt.Errorf("mailgun API error (HTTP %d)", resp.StatusCode)
+		}
+		return "", fmt.Errorf("mailgun API error (HTTP %d): %s", resp.StatusCode, result.Message)
+	}
+	if decodeErr != nil {
+		return "", fmt.Errorf("error decoding response: %w", decodeErr)
+	}
+	return result.ID, nil
+}
+
+func writeAttachment(writer *multipart.Writer, file pipeline_type.FileInfo) error {
+	f, err := os.Open(file.URI)
+	if err != nil {
+		return fmt.Errorf("error reading attachment %s: %w", attachmentName(file), err)
+	}
+	defer f.Close()
+	part, err := writer.CreateFormFile("attachment", attachmentName(file))
+	if err != nil {
+		return fmt.Errorf("error writing attachment %s: %w", attachmentName(file), err)
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return fmt.Errorf("error writing attachment %s: %w", attachmentName(file), err)
+	}
+	return nil
+}
+
+// mailgunBaseURL returns the API of the region of the Mailgun account.
+func mailgunBaseURL(config map[string]interface{}) string {
+	if strings.EqualFold(getStringValue(config, "region", ""), "eu") {
+		return mailgunEUAPIBaseURL
+	}
+	return mailgunAPIBaseURL
+}
+
+// templateVariables returns the substitution variables of a provider
+// template: the configured ones, a map or a JSON object whose string values
+// are filled like the subject, else the text outputs of the required steps,
+// decoded when they are JSON.
+func templateVariables(config map[string]interface{}, step *pipeline_type.PipelineStep, pipelineContext *pipeline_type.Context) (map[string]interface{}, error) {
+	variables := map[string]interface{}{}
+	switch configured := config["template_variables"].(type) {
+	case map[string]interface{}:
+		for name, value := range configured {
+			variables[name] = value
+		}
+	case string:
+		if strings.TrimSpace(configured) != "" {
+			if err := json.Unmarshal([]byte(configured), &variables); err != nil {
+				return nil, fmt.Errorf("invalid template_variables JSON: %w", err)
+			}
+		}
+	}
+
+	if len(variables) > 0 {
+		for name, value := range variables {
+			if template, ok := value.(string); ok {
+				variables[name] = fillEmailTemplate(template, pipelineContext)
+			}
+		}
+		return variables, nil
+	}
+	for _, key := range step.RequiredStepKeys() {
+		if files, err := pipelineContext.GetFileList(key); err == nil && describesFiles(files) {
+			continue
+		}
+		value, err := pipelineContext.GetString(key)
+		if err != nil {
+			return nil, fmt.Errorf("error reading template variable %s: %w", key, err)
+		}
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(cleanJsonContent(value)), &decoded); err == nil {
+			variables[key] = decoded
+		} else {
+			variables[key] = strings.TrimSpace(value)
+		}
+	}
+	return variables, nil
+}
@@ -0,0 +1,240 @@
+package action_service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+// executeEmailProvider runs the action on the outputs of the steps "summary"
+// and "report", with its requests sent to handler.
+func executeEmailProvider(t *testing.T, config map[string]interface{}, handler http.HandlerFunc) (map[string]interface{}, error) {
+	report := filepath.Join(t.TempDir(), "report.pdf")
+	if err := os.WriteFile(report, []byte("%PDF"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pipelineContext := pipeline_type.NewContext()
+	pipelineContext.SetStepOutput("summary", "```json\n{\"headline\":\"Sales are up\"}\n```")
+	pipelineContext.SetStepOutput("report", `[{"uri":"`+report+`","mime_type":"application/pdf","filename":"report.pdf"}]`)
+	pipelineContext.SetStepOutput("customer", "Ann")
+
+	s := NewEmailProviderActionService(slog.Default())
+	s.httpClient = redirectClient(t, handler)
+	step := &pipeline_type.PipelineStep{
+		ID:            "email",
+		RequiredSteps: "summary\r\nreport",
+		ActionDetails: &pipeline_type.ActionDetails{Configuration: config},
+	}
+	output, err := s.Execute(context.Background(), "", pipelineContext, step)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		t.Fatalf("invalid output %q: %v", output, err)
+	}
+	return result, nil
+}
+
+func TestEmailProviderSendGrid(t *testing.T) {
+	var payload map[string]interface{}
+	result, err := executeEmailProvider(t, map[string]interface{}{
+		"provider":  EmailProviderSendGrid,
+		"api_key":   "sg-key",
+		"from":      "news@example.com",
+		"from_name": "Newsroom",
+		"reply_to":  "Desk <desk@example.com>",
+		"to":        "ann@example.com",
+		"bcc":       "archive@example.com",
+		"subject":   "Report for {customer}",
+	}, func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "api.sendgrid.com" || r.URL.Path != "/v3/mail/send" || r.Header.Get("Authorization") != "Bearer sg-key" {
+			t.Errorf("unexpected request to %s%s", r.Host, r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		w.Header().Set("X-Message-Id", "sg-123")
+		w.WriteHeader(http.StatusAccepted)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result["message_id"] != "sg-123" || result["recipients"] != float64(2) || result["subject"] != "Report for Ann" {
+		t.Errorf("unexpected result %v", result)
+	}
+	personalizations, _ := payload["personalizations"].([]interface{})
+	wantPersonalization := map[string]interface{}{
+		"to":  []interface{}{map[string]interface{}{"email": "ann@example.com"}},
+		"bcc": []interface{}{map[string]interface{}{"email": "archive@example.com"}},
+	}
+	if len(personalizations) != 1 || !reflect.DeepEqual(personalizations[0], wantPersonalization) {
+		t.Errorf("unexpected personalizations %v", payload["personalizations"])
+	}
+	if !reflect.DeepEqual(payload["from"], map[string]interface{}{"email": "news@example.com", "name": "Newsroom"}) ||
+		!reflect.DeepEqual(payload["reply_to"], map[string]interface{}{"email": "desk@example.com", "name": "Desk"}) {
+		t.Errorf("unexpected addresses %v %v", payload["from"], payload["reply_to"])
+	}
+	content, _ := payload["content"].([]interface{})
+	if len(content) != 1 || content[0].(map[string]interface{})["type"] != "text/plain" {
+		t.Errorf("unexpected content %v", payload["content"])
+	}
+	attachments, _ := payload["attachments"].([]interface{})
+	wantAttachment := map[string]interface{}{
+		"content":     base64.StdEncoding.EncodeToString([]byte("%PDF")),
+		"filename":    "report.pdf",
+		"type":        "application/pdf",
+		"disposition": "attachment",
+	}
+	if len(attachments) != 1 || !reflect.DeepEqual(attachments[0], wantAttachment) {
+		t.Errorf("unexpected attachments %v", payload["attachments"])
+	}
+}
+
+func TestEmailProviderSendGridTemplate(t *testing.T) {
+	var payload map[string]interface{}
+	result, err := executeEmailProvider(t, map[string]interface{}{
+		"provider":    EmailProviderSendGrid,
+		"api_key":     "sg-key",
+		"from":        "news@example.com",
+		"to":          "ann@example.com",
+		"template_id": "d-123",
+	}, func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&payload)
+		w.WriteHeader(http.StatusAccepted)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The outputs are the template data, the provider renders subject and body
+	personalization := payload["personalizations"].([]interface{})[0].(map[string]interface{})
+	wantData := map[string]interface{}{"summary": map[string]interface{}{"headline": "Sales are up"}}
+	if payload["template_id"] != "d-123" || !reflect.DeepEqual(personalization["dynamic_template_data"], wantData) {
+		t.Errorf("unexpected template payload %v", payload)
+	}
+	if payload["subject"] != nil || payload["content"] != nil {
+		t.Errorf("expected no subject and content, got %v", payload)
+	}
+	if result["template_id"] != "d-123" || result["subject"] != nil {
+		t.Errorf("unexpected result %v", result)
+	}
+}
+
+func TestEmailProviderMailgun(t *testing.T) {
+	var fields map[string][]string
+	var attachment string
+	result, err := executeEmailProvider(t, map[string]interface{}{
+		"provider":           EmailProviderMailgun,
+		"api_key":            "mg-key",
+		"domain":             "mg.example.com",
+		"region":             "EU",
+		"from":               "news@example.com",
+		"to":                 "ann@example.com, bob@example.com",
+		"cc":                 "carol@example.com",
+		"template_id":        "weekly",
+		"template_variables": `{"name":"{customer}","count":3}`,
+	}, func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		if r.Host != "api.eu.mailgun.net" || r.URL.Path != "/v3/mg.example.com/messages" || user != "api" || password != "mg-key" {
+			t.Errorf("unexpected request to %s%s as %s", r.Host, r.URL.Path, user)
+		}
+		r.ParseMultipartForm(1 << 20)
+		fields = r.MultipartForm.Value
+		if file, header, err := r.FormFile("attachment"); err == nil {
+			data, _ := io.ReadAll(file)
+			attachment = header.Filename + ":" + string(data)
+		}
+		w.Write([]byte(`{"id":"<mg-1@mg.example.com>","message":"Queued. Thank you."}`))
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result["message_id"] != "<mg-1@mg.example.com>" || result["recipients"] != float64(3) {
+		t.Errorf("unexpected result %v", result)
+	}
+	if !reflect.DeepEqual(fields["to"], []string{"ann@example.com", "bob@example.com"}) || !reflect.DeepEqual(fields["cc"], []string{"carol@example.com"}) ||
+		fields["template"][0] != "weekly" || fields["from"][0] != "<news@example.com>" {
+		t.Errorf("unexpected fields %v", fields)
+	}
+	var variables map[string]interface{}
+	json.Unmarshal([]byte(fields["t:variables"][0]), &variables)
+	if !reflect.DeepEqual(variables, map[string]interface{}{"name": "Ann", "count": float64(3)}) {
+		t.Errorf("unexpected template variables %v", variables)
+	}
+	if attachment != "report.pdf:%PDF" {
+		t.Errorf("unexpected attachment %q", attachment)
+	}
+}
+
+func TestEmailProviderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  map[string]interface{}
+		status  int
+		body    string
+		wantErr string
+	}{
+		{
+			name:    "SendGrid errors",
+			config:  map[string]interface{}{"provider": EmailProviderSendGrid},
+			status:  http.StatusBadRequest,
+			body:    `{"errors":[{"message":"Invalid email","field":"personalizations.0.to"},{"message":"Bad key"}]}`,
+			wantErr: "sendgrid API error (HTTP 400): personalizations.0.to: Invalid email; Bad key",
+		},
+		{
+			name:    "SendGrid without details",
+			config:  map[string]interface{}{"provider": EmailProviderSendGrid},
+			status:  http.StatusInternalServerError,
+			body:    "oops",
+			wantErr: "sendgrid API error (HTTP 500)",
+		},
+		{
+			name:    "Mailgun message",
+			config:  map[string]interface{}{"provider": EmailProviderMailgun, "domain": "mg.example.com"},
+			status:  http.StatusUnauthorized,
+			body:    `{"message":"Invalid private key"}`,
+			wantErr: "mailgun API error (HTTP 401): Invalid private key",
+		},
+		{
+			name:    "Mailgun without domain",
+			config:  map[string]interface{}{"provider": EmailProviderMailgun},
+			wantErr: "domain not found in config",
+		},
+		{
+			name:    "unknown provider",
+			config:  map[string]interface{}{"provider": "postmark"},
+			wantErr: `unknown email provider "postmark"`,
+		},
+		{
+			name:    "invalid template variables",
+			config:  map[string]interface{}{"provider": EmailProviderSendGrid, "template_variables": "{name"},
+			wantErr: "invalid template_variables JSON",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := map[string]interface{}{"api_key": "key", "from": "news@example.com", "to": "ann@example.com", "subject": "Hi"}
+			for k, v := range tt.config {
+				config[k] = v
+			}
+			_, err := executeEmailProvider(t, config, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -1,12 +1,17 @@
 package action_service
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"net/url"
+	"os"
 	"strings"
 	"time"
 
@@ -16,18 +21,37 @@ import (
 const (
 	FacebookShareServiceName = "facebook_share"
 	facebookAPIBaseURL       = "https://graph.facebook.com"
+	// maxFacebookPhotoSize is the largest photo the Graph API accepts
+	maxFacebookPhotoSize = 10 << 20
 )
 
 type FacebookShareActionService struct {
 	logger *slog.Logger
+	// httpClient uploads and publishes the videos, which may take long
+	httpClient *http.Client
 }
 
 func NewFacebookShareActionService(logger *slog.Logger) *FacebookShareActionService {
 	return &FacebookShareActionService{
-		logger: logger,
+		logger:     logger,
+		httpClient: &http.Client{},
 	}
 }
 
+// FacebookPost is the content of a post: a link, or a photo given by its URL
+// or generated by the pipeline.
+type FacebookPost struct {
+	Text     string `json:"text"`
+	URL      string `json:"url,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	// Title of the page videos
+	Title string `json:"title,omitempty"`
+	// Image and Video are the first image and video outputs of the
+	// required steps
+	Image *pipeline_type.FileInfo `json:"-"`
+	Video *pipeline_type.FileInfo `json:"-"`
+}
+
 type FacebookCredentials struct {
 	AccessToken string
 	PageID      string
@@ -51,9 +75,9 @@ func (s *FacebookShareActionService) Execute(ctx context.Context, actionConfig s
 	}
 
 	// Find Facebook content in the context
-	facebookContent := s.findFacebookContent(step, pipelineContext)
+	facebookContent, image, video := s.findFacebookContent(step, pipelineContext)
 	if facebookContent == "" {
-		s.logger.Error("Facebook content is empty",
+		s.logger.ErrorContext(ctx, "Facebook content is empty",
 			slog.String("step_id", step.ID),
 			slog.String("required_steps", step.RequiredSteps))
 		return "", fmt.Errorf("facebook content is empty")
@@ -64,11 +88,20 @@ func (s *FacebookShareActionService) Execute(ctx context.Context, actionConfig s
 	if err != nil {
 		return "", err
 	}
+	data.Text = applyDisclosure(data.Text, 0, step, pipelineContext)
+	data.Image = image
+	data.Video = video
+
+	// Videos are published natively, as Reels unless video_type is "video"
+	if data.Video != nil {
+		return s.postVideo(ctx, data, credentials, getStringValue(config, "video_type", FacebookVideoReel))
+	}
+	if data.URL == "" && data.ImageURL == "" && data.Image == nil {
+		return "", fmt.Errorf("either url or image_url field, or an image step output, is required")
+	}
 
-	// Note: For production, ensure image URLs are properly configured
-	data.ImageURL = "https://i.postimg.cc/Y0jyFx5m/test-sharing-image.webp"
 	// Choose posting method based on content type
-	if data.ImageURL != "" {
+	if data.Image != nil || data.ImageURL != "" {
 		return s.postPhoto(ctx, data, credentials)
 	}
 	return s.postLink(ctx, data, credentials)
@@ -117,9 +150,12 @@ func (s *FacebookShareActionService) validateAccessToken(ctx context.Context, cr
 	return nil
 }
 
-func (s *FacebookShareActionService) findFacebookContent(step *pipeline_type.PipelineStep, pipelineContext *pipeline_type.Context) string {
+// findFacebookContent returns the content of the required steps and the
+// first image and video they output.
+func (s *FacebookShareActionService) findFacebookContent(step *pipeline_type.PipelineStep, pipelineContext *pipeline_type.Context) (string, *pipeline_type.FileInfo, *pipeline_type.FileInfo) {
 	// First try to get content from a social media step
-	var content string
+	var content, socialContent string
+	var image, video *pipeline_type.FileInfo
 	requiredSteps := strings.Split(step.RequiredSteps, "\r\n")
 
 	for _, requiredStep := range requiredSteps {
@@ -128,40 +164,49 @@ func (s *FacebookShareActionService) findFacebookContent(step *pipeline_type.Pip
 			continue
 		}
 
-		if stepOutput, ok := pipelineContext.GetStepOutput(requiredStep); ok {
+		if files, err := pipelineContext.GetFileList(requiredStep); err == nil && describesMedia(files) {
+			for i := range files {
+				if image == nil && strings.HasPrefix(files[i].MimeType, "image/") {
+					image = &files[i]
+				}
+				if video == nil && strings.HasPrefix(files[i].MimeType, "video/") {
+					video = &files[i]
+				}
+			}
+			continue
+		}
+
+		if stepOutput, err := pipelineContext.GetString(requiredStep); err == nil {
 			// Try to parse as social media step output
 			var resultData map[string]interface{}
-			if err := json.Unmarshal([]byte(fmt.Sprintf("%v", stepOutput)), &resultData); err == nil {
+			if err := pipelineContext.GetJSON(requiredStep, &resultData); err == nil {
 				if platforms, ok := resultData["platforms"].(map[string]interface{}); ok {
 					if facebookContent, ok := platforms["facebook"].(map[string]interface{}); ok {
 						// This is from a social media step, use the facebook content
 						if contentJSON, err := json.Marshal(facebookContent); err == nil {
-							return string(contentJSON)
+							if socialContent == "" {
+								socialContent = string(contentJSON)
+							}
+							continue
 						}
 					}
 				}
 			}
-			content += fmt.Sprintf("%v", stepOutput)
+			content += stepOutput
 		}
 	}
 
-	return content
+	if socialContent != "" {
+		return socialContent, image, video
+	}
+	return content, image, video
 }
 
-func (s *FacebookShareActionService) parseAndValidateContent(content string) (*struct {
-	Text     string `json:"text"`
-	URL      string `json:"url,omitempty"`
-	ImageURL string `json:"image_url,omitempty"`
-}, error) {
+func (s *FacebookShareActionService) parseAndValidateContent(content string) (*FacebookPost, error) {
 	// Remove JSON code block markers if present
 	content = cleanJsonContent(content)
 
-	var data struct {
-		Text     string `json:"text"`
-		URL      string `json:"url,omitempty"`
-		ImageURL string `json:"image_url,omitempty"`
-	}
-
+	var data FacebookPost
 	if err := json.Unmarshal([]byte(content), &data); err != nil {
 		return nil, fmt.Errorf("invalid JSON format: %w", err)
 	}
@@ -171,18 +216,10 @@ func (s *FacebookShareActionService) parseAndValidateContent(content string) (*s
 		return nil, fmt.Errorf("text field is required")
 	}
 
-	if data.URL == "" && data.ImageURL == "" {
-		return nil, fmt.Errorf("either url or image_url field is required")
-	}
-
 	return &data, nil
 }
 
-func (s *FacebookShareActionService) postLink(ctx context.Context, data *struct {
-	Text     string `json:"text"`
-	URL      string `json:"url,omitempty"`
-	ImageURL string `json:"image_url,omitempty"`
-}, credentials *FacebookCredentials) (string, error) {
+func (s *FacebookShareActionService) postLink(ctx context.Context, data *FacebookPost, credentials *FacebookCredentials) (string, error) {
 	facebookUrl := fmt.Sprintf("%s/%s/%s/feed",
 		facebookAPIBaseURL,
 		credentials.APIVersion,
@@ -247,43 +284,52 @@ func (s *FacebookShareActionService) postLink(ctx context.Context, data *struct
 	return string(resultJSON), nil
 }
 
-func (s *FacebookShareActionService) postPhoto(ctx context.Context, data *struct {
-	Text     string `json:"text"`
-	URL      string `json:"url,omitempty"`
-	ImageURL string `json:"image_url,omitempty"`
-}, credentials *FacebookCredentials) (string, error) {
-	// First validate the image URL is accessible
-	err := s.validateImageURL(ctx, data.ImageURL)
-	if err != nil {
-		s.logger.Warn("Image validation failed, falling back to link post",
-			slog.String("error", err.Error()),
-			slog.String("image_url", data.ImageURL))
-
-		// If we have a URL, fall back to link post
-		if data.URL != "" {
-			return s.postLink(ctx, data, credentials)
-		}
-		return "", fmt.Errorf("unable to post content: invalid image URL and no fallback URL available")
-	}
-
+func (s *FacebookShareActionService) postPhoto(ctx context.Context, data *FacebookPost, credentials *FacebookCredentials) (string, error) {
 	facebookUrl := fmt.Sprintf("%s/%s/%s/photos",
 		facebookAPIBaseURL,
 		credentials.APIVersion,
 		credentials.PageID)
 
-	// Create form data - this is key for Facebook's API
-	formData := url.Values{}
-	formData.Set("message", data.Text)
-	formData.Set("url", data.ImageURL)
-	formData.Set("access_token", credentials.AccessToken)
-
-	// Make request with form data
-	req, err := http.NewRequestWithContext(ctx, "POST", facebookUrl, strings.NewReader(formData.Encode()))
-	if err != nil {
-		return "", fmt.Errorf("error creating request: %w", err)
+	// Images generated on this host are uploaded, the others given by URL
+	var req *http.Request
+	var err error
+	if data.Image != nil {
+		req, err = s.photoUploadRequest(ctx, facebookUrl, data, credentials)
+		if err != nil {
+			return "", err
+		}
 	}
+	if req == nil {
+		if data.ImageURL == "" && data.Image != nil {
+			data.ImageURL = data.Image.URL
+		}
+		// First validate the image URL is accessible
+		if err := s.validateImageURL(ctx, data.ImageURL); err != nil {
+			s.logger.WarnContext(ctx, "Image validation failed, falling back to link post",
+				slog.String("error", err.Error()),
+				slog.String("image_url", data.ImageURL))
+
+			// If we have a URL, fall back to link post
+			if data.URL != "" {
+				return s.postLink(ctx, data, credentials)
+			}
+			return "", fmt.Errorf("unable to post content: invalid image URL and no fallback URL available")
+		}
 
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		// Create form data - this is key for Facebook's API
+		formData := url.Values{}
+		formData.Set("message", data.Text)
+		formData.Set("url", data.ImageURL)
+		formData.Set("access_token", credentials.AccessToken)
+
+		// Make request with form data
+		req, err = http.NewRequestWithContext(ctx, "POST", facebookUrl, strings.NewReader(formData.Encode()))
+		if err != nil {
+			return "", fmt.Errorf("error creating request: %w", err)
+		}
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -330,6 +376,51 @@ func (s *FacebookShareActionService) postPhoto(ctx context.Context, data *struct
 	return string(resultJSON), nil
 }
 
+// photoUploadRequest builds the upload of the image file in the "source"
+// field, or returns a nil request when the file is not on this host.
+func (s *FacebookShareActionService) photoUploadRequest(ctx context.Context, facebookUrl string, data *FacebookPost, credentials *FacebookCredentials) (*http.Request, error) {
+	file, err := os.Open(data.Image.URI)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading image file: %w", err)
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("error reading image file: %w", err)
+	}
+	if stat.Size() > maxFacebookPhotoSize {
+		return nil, fmt.Errorf("image %s is %d MB, over the %d MB limit of Facebook", attachmentName(*data.Image), stat.Size()>>20, maxFacebookPhotoSize>>20)
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("message", data.Text)
+	writer.WriteField("access_token", credentials.AccessToken)
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="source"; filename=%q`, attachmentName(*data.Image)))
+	header.Set("Content-Type", data.Image.MimeType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return nil, fmt.Errorf("error creating upload: %w", err)
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return nil, fmt.Errorf("error reading image file: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("error creating upload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", facebookUrl, &body)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req, nil
+}
+
 func (s *FacebookShareActionService) validateImageURL(ctx context.Context, imageURL string) error {
 	if !strings.HasPrefix(imageURL, "http") {
 		return fmt.Errorf("invalid image URL format: must start with http/https")
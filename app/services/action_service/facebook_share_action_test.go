@@ -0,0 +1,50 @@
+package action_service
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+func TestPhotoUploadRequest(t *testing.T) {
+	dir := t.TempDir()
+	image := filepath.Join(dir, "image.png")
+	if err := os.WriteFile(image, []byte("png"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s := NewFacebookShareActionService(slog.Default())
+	credentials := &FacebookCredentials{AccessToken: "token"}
+
+	tests := []struct {
+		name    string
+		uri     string
+		request bool
+		err     string
+	}{
+		{"file on this host", image, true, ""},
+		// Falls back to the image URL
+		{"file on another host", filepath.Join(dir, "missing.png"), false, ""},
+		{"unreadable file", filepath.Join(image, "child.png"), false, "error reading image file"},
+	}
+	for _, tt := range tests {
+		data := &FacebookPost{Text: "Hello", Image: &pipeline_type.FileInfo{URI: tt.uri, MimeType: "image/png"}}
+		req, err := s.photoUploadRequest(context.Background(), "https://graph.facebook.test/photos", data, credentials)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+		if (req != nil) != tt.request {
+			t.Errorf("%s: got request %v, want one: %v", tt.name, req != nil, tt.request)
+		}
+	}
+}
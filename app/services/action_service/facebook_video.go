@@ -0,0 +1,355 @@
+package action_service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Facebook video types.
+const (
+	FacebookVideoReel    = "reel"
+	FacebookVideoRegular = "video"
+)
+
+const (
+	facebookVideoAPIBaseURL = "https://graph-video.facebook.com"
+	facebookReelUploadURL   = "https://rupload.facebook.com/video-upload"
+)
+
+var (
+	facebookVideoPollInterval = 10 * time.Second
+	// facebookVideoTimeout bounds the wait for a video to be published,
+	// which then goes on in the background
+	facebookVideoTimeout = 15 * time.Minute
+)
+
+// postVideo publishes the video of the post as a Reel or a page video and
+// waits for it to be processed.
+func (s *FacebookShareActionService) postVideo(ctx context.Context, data *FacebookPost, credentials *FacebookCredentials, videoType string) (string, error) {
+	var videoID string
+	var err error
+	switch videoType {
+	case FacebookVideoReel:
+		videoID, err = s.uploadReel(ctx, data, credentials)
+	case FacebookVideoRegular:
+		videoID, err = s.uploadVideo(ctx, data, credentials)
+	default:
+		return "", fmt.Errorf("unknown Facebook video type %q", videoType)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	status, permalink, err := s.waitForVideo(ctx, credentials, videoID)
+	if err != nil {
+		return "", err
+	}
+	s.logger.InfoContext(ctx, "Published Facebook video",
+		slog.String("video_id", videoID),
+		slog.String("type", videoType),
+		slog.String("status", status))
+
+	response := map[string]interface{}{
+		"post_id":  videoID,
+		"video_id": videoID,
+		"text":     data.Text,
+		"type":     videoType,
+		"status":   status,
+	}
+	// Video permalinks may be relative to the site
+	if strings.HasPrefix(permalink, "/") {
+		permalink = "https://www.facebook.com" + permalink
+	}
+	if permalink != "" {
+		response["permalink_url"] = permalink
+	}
+	resultJSON, err := json.Marshal(response)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling result: %w", err)
+	}
+	return string(resultJSON), nil
+}
+
+// uploadReel publishes a Reel: a session is started, the file uploaded, or
+// fetched by Facebook from its URL, then the Reel published.
+func (s *FacebookShareActionService) uploadReel(ctx context.Context, data *FacebookPost, credentials *FacebookCredentials) (string, error) {
+	reelsPath := credentials.PageID + "/video_reels"
+	var started struct {
+		VideoID string `json:"video_id"`
+	}
+	if err := s.graphRequest(ctx, http.MethodPost, facebookAPIBaseURL, credentials, reelsPath, url.Values{"upload_phase": {"start"}}, &started); err != nil {
+		return "", fmt.Errorf("error starting Reel upload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("%s/%s/%s", facebookReelUploadURL, credentials.APIVersion, started.VideoID), nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "OAuth "+credentials.AccessToken)
+	if file, err := os.Open(data.Video.URI); err == nil {
+		defer file.Close()
+		stat, err := file.Stat()
+		if err != nil {
+			return "", fmt.Errorf("error reading video file: %w", err)
+		}
+		req.Body = file
+		req.ContentLength = stat.Size()
+		req.Header.Set("offset", "0")
+		req.Header.Set("file_size", strconv.FormatInt(stat.Size(), 10))
+	} else if data.Video.URL != "" {
+		req.Header.Set("file_url", data.Video.URL)
+	} else {
+		return "", fmt.Errorf("video file %s is neither on this host nor has a URL", data.Video.URI)
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error uploading Reel: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", s.handleErrorResponse(resp)
+	}
+
+	var finished struct {
+		Success bool `json:"success"`
+	}
+	err = s.graphRequest(ctx, http.MethodPost, facebookAPIBaseURL, credentials, reelsPath, url.Values{
+		"upload_phase": {"finish"},
+		"video_id":     {started.VideoID},
+		"video_state":  {"PUBLISHED"},
+		"description":  {data.Text},
+	}, &finished)
+	if err != nil {
+		return "", fmt.Errorf("error publishing Reel: %w", err)
+	}
+	if !finished.Success {
+		return "", fmt.Errorf("facebook did not accept Reel %s", started.VideoID)
+	}
+	return started.VideoID, nil
+}
+
+// uploadVideo publishes a page video with the resumable upload, in the chunks
+// Facebook asks for, or from its URL when the file is not on this host.
+func (s *FacebookShareActionService) uploadVideo(ctx context.Context, data *FacebookPost, credentials *FacebookCredentials) (string, error) {
+	videosPath := credentials.PageID + "/videos"
+	file, err := os.Open(data.Video.URI)
+	if err != nil {
+		if data.Video.URL == "" {
+			return "", fmt.Errorf("video file %s is neither on this host nor has a URL", data.Video.URI)
+		}
+		var created struct {
+			ID string `json:"id"`
+		}
+		err := s.graphRequest(ctx, http.MethodPost, facebookVideoAPIBaseURL, credentials, videosPath,
+			videoDetails(data, url.Values{"file_url": {data.Video.URL}}), &created)
+		if err != nil {
+			return "", fmt.Errorf("error publishing video: %w", err)
+		}
+		return created.ID, nil
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("error reading video file: %w", err)
+	}
+
+	var session struct {
+		UploadSessionID string `json:"upload_session_id"`
+		VideoID         string `json:"video_id"`
+		StartOffset     string `json:"start_offset"`
+		EndOffset       string `json:"end_offset"`
+	}
+	err = s.graphRequest(ctx, http.MethodPost, facebookVideoAPIBaseURL, credentials, videosPath, url.Values{
+		"upload_phase": {"start"},
+		"file_size":    {strconv.FormatInt(stat.Size(), 10)},
+	}, &session)
+	if err != nil {
+		return "", fmt.Errorf("error starting video upload: %w", err)
+	}
+
+	start, end := session.StartOffset, session.EndOffset
+	for start != end {
+		from, err1 := strconv.ParseInt(start, 10, 64)
+		to, err2 := strconv.ParseInt(end, 10, 64)
+		if err1 != nil || err2 != nil || to <= from || to > stat.Size() {
+			return "", fmt.Errorf("invalid upload range %s-%s", start, end)
+		}
+		if start, end, err = s.transferVideoChunk(ctx, credentials, videosPath, session.UploadSessionID, file, from, to); err != nil {
+			return "", fmt.Errorf("error uploading video chunk at %d: %w", from, err)
+		}
+	}
+
+	var finished struct {
+		Success bool `json:"success"`
+	}
+	err = s.graphRequest(ctx, http.MethodPost, facebookVideoAPIBaseURL, credentials, videosPath,
+		videoDetails(data, url.Values{"upload_phase": {"finish"}, "upload_session_id": {session.UploadSessionID}}), &finished)
+	if err != nil {
+		return "", fmt.Errorf("error publishing video: %w", err)
+	}
+	if !finished.Success {
+		return "", fmt.Errorf("facebook did not accept video %s", session.VideoID)
+	}
+	return session.VideoID, nil
+}
+
+// videoDetails adds the description and title of a page video to params.
+func videoDetails(data *FacebookPost, params url.Values) url.Values {
+	params.Set("description", data.Text)
+	if data.Title != "" {
+		params.Set("title", data.Title)
+	}
+	return params
+}
+
+// transferVideoChunk uploads the bytes from-to of the file and returns the
+// next range Facebook asks for, empty once complete.
+func (s *FacebookShareActionService) transferVideoChunk(ctx context.Context, credentials *FacebookCredentials, videosPath, sessionID string, file *os.File, from, to int64) (string, string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("access_token", credentials.AccessToken)
+	writer.WriteField("upload_phase", "transfer")
+	writer.WriteField("upload_session_id", sessionID)
+	writer.WriteField("start_offset", strconv.FormatInt(from, 10))
+	part, err := writer.CreateFormFile("video_file_chunk", "chunk")
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := io.Copy(part, io.NewSectionReader(file, from, to-from)); err != nil {
+		return "", "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("%s/%s/%s", facebookVideoAPIBaseURL, credentials.APIVersion, videosPath), &body)
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", s.handleErrorResponse(resp)
+	}
+	var next struct {
+		StartOffset string `json:"start_offset"`
+		EndOffset   string `json:"end_offset"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&next); err != nil {
+		return "", "", fmt.Errorf("error decoding response: %w", err)
+	}
+	return next.StartOffset, next.EndOffset, nil
+}
+
+// waitForVideo polls the video until it is published and returns its status
+// and permalink. A video still processing after the timeout is reported as
+// such rather than failed, posting it again would duplicate it.
+func (s *FacebookShareActionService) waitForVideo(ctx context.Context, credentials *FacebookCredentials, videoID string) (string, string, error) {
+	type phase struct {
+		Status string `json:"status"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	deadline := time.Now().Add(facebookVideoTimeout)
+	for {
+		var video struct {
+			PermalinkURL string `json:"permalink_url"`
+			Status       struct {
+				VideoStatus     string `json:"video_status"`
+				ProcessingPhase phase  `json:"processing_phase"`
+				PublishingPhase phase  `json:"publishing_phase"`
+			} `json:"status"`
+		}
+		err := s.graphRequest(ctx, http.MethodGet, facebookAPIBaseURL, credentials, videoID, url.Values{"fields": {"status,permalink_url"}}, &video)
+		if err != nil {
+			return "", "", fmt.Errorf("error reading video status: %w", err)
+		}
+
+		status := video.Status
+		for _, p := range []phase{status.ProcessingPhase, status.PublishingPhase} {
+			if p.Status == "error" {
+				message := "unknown error"
+				if len(p.Errors) > 0 {
+					message = p.Errors[0].Message
+				}
+				return "", "", fmt.Errorf("facebook could not publish video %s: %s", videoID, message)
+			}
+		}
+		switch status.VideoStatus {
+		case "error", "expired":
+			return "", "", fmt.Errorf("facebook could not process video %s: %s", videoID, status.VideoStatus)
+		case "ready":
+			if status.PublishingPhase.Status == "" || status.PublishingPhase.Status == "complete" {
+				return "published", video.PermalinkURL, nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			s.logger.WarnContext(ctx, "Facebook video still processing",
+				slog.String("video_id", videoID),
+				slog.String("video_status", status.VideoStatus))
+			return "processing", video.PermalinkURL, nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", "", ctx.Err()
+		case <-time.After(facebookVideoPollInterval):
+		}
+	}
+}
+
+// graphRequest calls the Graph API with the token and decodes the answer in
+// result.
+func (s *FacebookShareActionService) graphRequest(ctx context.Context, method, baseURL string, credentials *FacebookCredentials, path string, params url.Values, result interface{}) error {
+	endpoint := fmt.Sprintf("%s/%s/%s", baseURL, credentials.APIVersion, path)
+	params.Set("access_token", credentials.AccessToken)
+
+	var req *http.Request
+	var err error
+	if method == http.MethodGet {
+		req, err = http.NewRequestWithContext(ctx, method, endpoint+"?"+params.Encode(), nil)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, method, endpoint, strings.NewReader(params.Encode()))
+		if req != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		// The URL carries the token
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("error executing request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s.handleErrorResponse(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package action_service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+var facebookTestCredentials = &FacebookCredentials{AccessToken: "token", PageID: "page1", APIVersion: "v21.0"}
+
+// useFacebookVideoTimings shortens the status polling for a test.
+func useFacebookVideoTimings(t *testing.T, interval, timeout time.Duration) {
+	originalInterval, originalTimeout := facebookVideoPollInterval, facebookVideoTimeout
+	facebookVideoPollInterval, facebookVideoTimeout = interval, timeout
+	t.Cleanup(func() { facebookVideoPollInterval, facebookVideoTimeout = originalInterval, originalTimeout })
+}
+
+// facebookVideoServer fakes the Graph API video endpoints. The resumable
+// upload asks for the ranges in turn, the video status goes through the
+// statuses in turn.
+type facebookVideoServer struct {
+	mu       sync.Mutex
+	ranges   [][2]string
+	statuses []string
+	chunks   []string
+	phases   []string
+	reel     http.Header
+}
+
+func (f *facebookVideoServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Host == "rupload.facebook.com":
+		f.reel = r.Header.Clone()
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte(`{"success":true}`))
+	case r.Host == "graph.facebook.com" && r.Method == http.MethodGet:
+		if r.URL.Query().Get("access_token") != "token" {
+			http.Error(w, `{"error":{"message":"Invalid token"}}`, http.StatusUnauthorized)
+			return
+		}
+		status := f.statuses[0]
+		if len(f.statuses) > 1 {
+			f.statuses = f.statuses[1:]
+		}
+		w.Write([]byte(`{"permalink_url":"/page1/videos/v1/","status":` + status + `}`))
+	case strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/"):
+		r.ParseMultipartForm(1 << 20)
+		file, _, _ := r.FormFile("video_file_chunk")
+		data, _ := io.ReadAll(file)
+		f.phases = append(f.phases, r.FormValue("upload_phase"))
+		f.chunks = append(f.chunks, r.FormValue("start_offset")+":"+string(data))
+		json.NewEncoder(w).Encode(f.nextRange())
+	default:
+		r.ParseForm()
+		phase := r.Form.Get("upload_phase")
+		f.phases = append(f.phases, phase)
+		switch phase {
+		case "start":
+			if r.URL.Path == "/v21.0/page1/video_reels" {
+				w.Write([]byte(`{"video_id":"v1"}`))
+				return
+			}
+			session := f.nextRange()
+			session["upload_session_id"], session["video_id"] = "s1", "v1"
+			json.NewEncoder(w).Encode(session)
+		case "finish":
+			w.Write([]byte(`{"success":true}`))
+		default:
+			w.Write([]byte(`{"id":"v1"}`))
+		}
+	}
+}
+
+func (f *facebookVideoServer) nextRange() map[string]string {
+	next := [2]string{"", ""}
+	if len(f.ranges) > 0 {
+		next, f.ranges = f.ranges[0], f.ranges[1:]
+	}
+	return map[string]string{"start_offset": next[0], "end_offset": next[1]}
+}
+
+const facebookReadyStatus = `{"video_status":"ready","processing_phase":{"status":"complete"},"publishing_phase":{"status":"complete"}}`
+
+func TestFacebookVideoChunkedUpload(t *testing.T) {
+	useFacebookVideoTimings(t, time.Millisecond, time.Minute)
+	video := &pipeline_type.FileInfo{URI: filepath.Join(t.TempDir(), "clip.mp4"), MimeType: "video/mp4"}
+	if err := os.WriteFile(video.URI, []byte("0123456789abcdefghij"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server := &facebookVideoServer{
+		ranges: [][2]string{{"0", "8"}, {"8", "16"}, {"16", "20"}, {"20", "20"}},
+		statuses: []string{
+			`{"video_status":"processing","processing_phase":{"status":"in_progress"}}`,
+			facebookReadyStatus,
+		},
+	}
+	s := NewFacebookShareActionService(slog.Default())
+	s.httpClient = redirectClient(t, server)
+
+	output, err := s.postVideo(context.Background(), &FacebookPost{Text: "Our new clip", Title: "Clip", Video: video}, facebookTestCredentials, FacebookVideoRegular)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantChunks := []string{"0:01234567", "8:89abcdef", "16:ghij"}
+	if !reflect.DeepEqual(server.chunks, wantChunks) {
+		t.Errorf("got chunks %v, want %v", server.chunks, wantChunks)
+	}
+	wantPhases := []string{"start", "transfer", "transfer", "transfer", "finish"}
+	if !reflect.DeepEqual(server.phases, wantPhases) {
+		t.Errorf("got phases %v, want %v", server.phases, wantPhases)
+	}
+
+	var result map[string]interface{}
+	json.Unmarshal([]byte(output), &result)
+	if result["video_id"] != "v1" || result["status"] != "published" || result["permalink_url"] != "https://www.facebook.com/page1/videos/v1/" {
+		t.Errorf("unexpected result %v", result)
+	}
+}
+
+func TestFacebookVideoInvalidRange(t *testing.T) {
+	video := &pipeline_type.FileInfo{URI: writeMediaFile(t, "clip.mp4", 10), MimeType: "video/mp4"}
+	server := &facebookVideoServer{ranges: [][2]string{{"0", "50"}}}
+	s := NewFacebookShareActionService(slog.Default())
+	s.httpClient = redirectClient(t, server)
+
+	_, err := s.uploadVideo(context.Background(), &FacebookPost{Video: video}, facebookTestCredentials)
+	if err == nil || !strings.Contains(err.Error(), "invalid upload range 0-50") {
+		t.Errorf("expected the range past the file refused, got %v", err)
+	}
+}
+
+func TestFacebookReelUpload(t *testing.T) {
+	tests := []struct {
+		name   string
+		video  *pipeline_type.FileInfo
+		header map[string]string
+	}{
+		{
+			name:   "local file",
+			video:  &pipeline_type.FileInfo{URI: writeMediaFile(t, "reel.mp4", 12)},
+			header: map[string]string{"Offset": "0", "File_size": "12", "Authorization": "OAuth token"},
+		},
+		{
+			name:   "remote file",
+			video:  &pipeline_type.FileInfo{URI: "/elsewhere/reel.mp4", URL: "https://cdn.example.com/reel.mp4"},
+			header: map[string]string{"File_url": "https://cdn.example.com/reel.mp4", "Authorization": "OAuth token"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &facebookVideoServer{}
+			s := NewFacebookShareActionService(slog.Default())
+			s.httpClient = redirectClient(t, server)
+
+			videoID, err := s.uploadReel(context.Background(), &FacebookPost{Text: "Reel", Video: tt.video}, facebookTestCredentials)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if videoID != "v1" || !reflect.DeepEqual(server.phases, []string{"start", "finish"}) {
+				t.Errorf("unexpected upload of %q: %v", videoID, server.phases)
+			}
+			for key, want := range tt.header {
+				if got := server.reel.Get(key); got != want {
+					t.Errorf("header %s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFacebookWaitForVideo(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []string
+		timeout  time.Duration
+		want     string
+		wantErr  string
+	}{
+		{name: "ready", statuses: []string{facebookReadyStatus}, timeout: time.Minute, want: "published"},
+		{
+			name:     "ready once published",
+			statuses: []string{`{"video_status":"ready","publishing_phase":{"status":"in_progress"}}`, facebookReadyStatus},
+			timeout:  time.Minute,
+			want:     "published",
+		},
+		{
+			name:     "processing error",
+			statuses: []string{`{"video_status":"processing","processing_phase":{"status":"error","errors":[{"message":"Unsupported codec"}]}}`},
+			timeout:  time.Minute,
+			wantErr:  "facebook could not publish video v1: Unsupported codec",
+		},
+		{
+			name:     "expired",
+			statuses: []string{`{"video_status":"expired"}`},
+			timeout:  time.Minute,
+			wantErr:  "facebook could not process video v1: expired",
+		},
+		{
+			name:     "still processing after the timeout",
+			statuses: []string{`{"video_status":"processing"}`},
+			timeout:  0,
+			want:     "processing",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFacebookVideoTimings(t, time.Millisecond, tt.timeout)
+			s := NewFacebookShareActionService(slog.Default())
+			s.httpClient = redirectClient(t, &facebookVideoServer{statuses: tt.statuses})
+
+			status, permalink, err := s.waitForVideo(context.Background(), facebookTestCredentials, "v1")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if status != tt.want || permalink != "/page1/videos/v1/" {
+				t.Errorf("got %q %q, want %q", status, permalink, tt.want)
+			}
+		})
+	}
+}
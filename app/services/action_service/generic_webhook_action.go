@@ -3,33 +3,80 @@ package action_service
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
-	"math"
+	"math/rand"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/serisow/lesocle/httputil"
 	"github.com/serisow/lesocle/pipeline_type"
 )
 
 const GenericWebhookServiceName = "generic_webhook"
 
+const (
+	// defaultSignatureHeader carries the HMAC of the signed requests
+	defaultSignatureHeader = "X-Webhook-Signature"
+	// maxWebhookResponseBytes bounds the response body kept in the output
+	maxWebhookResponseBytes = 1 << 20
+)
+
 type WebhookConfig struct {
-	WebhookURL       string            `json:"webhook_url"`
-	HTTPMethod       string            `json:"http_method"`
-	Timeout          int               `json:"timeout"`
-	RetryAttempts    int               `json:"retry_attempts"`
-	CustomHeaders    map[string]string `json:"custom_headers"`
-	Authentication   string            `json:"authentication"`
-	Username         string            `json:"username,omitempty"`
-	Password         string            `json:"password,omitempty"`
-	Token            string            `json:"token,omitempty"`
-	HeaderName       string            `json:"header_name,omitempty"`
-	HeaderValue      string            `json:"header_value,omitempty"`
+	WebhookURL     string            `json:"webhook_url"`
+	HTTPMethod     string            `json:"http_method"`
+	Timeout        int               `json:"timeout"`
+	RetryAttempts  int               `json:"retry_attempts"`
+	CustomHeaders  map[string]string `json:"custom_headers"`
+	Authentication string            `json:"authentication"`
+	Username       string            `json:"username,omitempty"`
+	Password       string            `json:"password,omitempty"`
+	Token          string            `json:"token,omitempty"`
+	HeaderName     string            `json:"header_name,omitempty"`
+	HeaderValue    string            `json:"header_value,omitempty"`
+	// RetryBackoff is doubled after each failed attempt, up to MaxBackoff,
+	// which also bounds the Retry-After waits
+	RetryBackoff time.Duration `json:"-"`
+	MaxBackoff   time.Duration `json:"-"`
+	// SigningSecret signs the requests with HMAC-SHA256 in SignatureHeader
+	SigningSecret   string `json:"-"`
+	SignatureHeader string `json:"-"`
+	// CaptureHeaders are the response headers kept in the output
+	CaptureHeaders []string `json:"-"`
+}
+
+// WebhookResponse is the answer of the webhook kept in the step output.
+type WebhookResponse struct {
+	StatusCode int               `json:"status_code"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	// Body is the decoded JSON body, or the text of other bodies
+	Body interface{} `json:"body"`
+}
+
+// webhookStatusError is a response outside 2xx.
+type webhookStatusError struct {
+	statusCode int
+	retryAfter string
+	body       string
 }
 
+func (e *webhookStatusError) Error() string {
+	return fmt.Sprintf("webhook returned non-success status: %d: %s", e.statusCode, e.body)
+}
+
+// retryable tells whether another attempt may succeed: rate limits and
+// server errors, not the rejections of the request itself.
+func (e *webhookStatusError) retryable() bool {
+	return e.statusCode == http.StatusTooManyRequests || e.statusCode >= 500
+}
 
 type GenericWebhookActionService struct {
 	logger *slog.Logger
@@ -41,6 +88,11 @@ func NewGenericWebhookActionService(logger *slog.Logger) *GenericWebhookActionSe
 	}
 }
 
+// Execute sends the outputs of the required steps to the webhook. The
+// custom header values are templates filled with the pipeline outputs. The
+// attempts share an X-Webhook-ID header so the receiver can discard the
+// duplicates of a retried delivery, and with a signing_secret they are
+// signed. The decoded response body is the "response" of the step output.
 func (s *GenericWebhookActionService) Execute(ctx context.Context, actionConfig string, pipelineContext *pipeline_type.Context, step *pipeline_type.PipelineStep) (string, error) {
 	if step.ActionDetails == nil || step.ActionDetails.Configuration == nil {
 		return "", fmt.Errorf("missing action configuration for GenericWebhookAction")
@@ -51,26 +103,29 @@ func (s *GenericWebhookActionService) Execute(ctx context.Context, actionConfig
 	if err != nil {
 		return "", fmt.Errorf("error extracting webhook configuration: %w", err)
 	}
+	for name, value := range credentials.CustomHeaders {
+		credentials.CustomHeaders[name] = fillEmailTemplate(value, pipelineContext)
+	}
 
 	// Get content from required steps
 	requiredSteps := strings.Split(step.RequiredSteps, "\r\n")
 	var payloadContent string
-	
+
 	for _, requiredStep := range requiredSteps {
 		requiredStep = strings.TrimSpace(requiredStep)
 		if requiredStep == "" {
 			continue
 		}
-		
-		stepOutput, ok := pipelineContext.GetStepOutput(requiredStep)
-		if !ok {
-			return "", fmt.Errorf("required step output '%s' not found for webhook content", requiredStep)
+
+		stepOutput, err := pipelineContext.GetString(requiredStep)
+		if err != nil {
+			return "", fmt.Errorf("error reading webhook content: %w", err)
 		}
-		payloadContent += fmt.Sprintf("%v", stepOutput)
+		payloadContent += stepOutput
 	}
 
 	if payloadContent == "" {
-		s.logger.Error("Webhook content is empty",
+		s.logger.ErrorContext(ctx, "Webhook content is empty",
 			slog.String("step_id", step.ID),
 			slog.String("required_steps", step.RequiredSteps))
 		return "", fmt.Errorf("webhook content is empty")
@@ -83,19 +138,27 @@ func (s *GenericWebhookActionService) Execute(ctx context.Context, actionConfig
 	}
 
 	// Send webhook with retries
-	result, err := s.sendWebhookWithRetry(ctx, credentials, payload)
+	deliveryID := uuid.New().String()
+	result, attempts, err := s.sendWebhookWithRetry(ctx, credentials, deliveryID, payload)
 	if err != nil {
-		s.logger.Error("Failed to send webhook",
+		s.logger.ErrorContext(ctx, "Failed to send webhook",
 			slog.String("error", err.Error()),
-			slog.String("webhook_url", credentials.WebhookURL))
+			slog.String("webhook_url", credentials.WebhookURL),
+			slog.Int("attempts", attempts))
 		return "", fmt.Errorf("failed to send webhook: %w", err)
 	}
 
 	// Prepare response
 	response := map[string]interface{}{
-		"success":   true,
-		"timestamp": time.Now().Unix(),
-		"response":  result,
+		"success":     true,
+		"timestamp":   time.Now().Unix(),
+		"delivery_id": deliveryID,
+		"attempts":    attempts,
+		"status_code": result.StatusCode,
+		"response":    result.Body,
+	}
+	if len(result.Headers) > 0 {
+		response["headers"] = result.Headers
 	}
 
 	resultJson, err := json.Marshal(response)
@@ -118,11 +181,26 @@ func extractWebhookConfig(config map[string]interface{}) (*WebhookConfig, error)
 
 	// Extract and validate other configuration fields
 	wc := &WebhookConfig{
-		WebhookURL:    webhookURL,
-		HTTPMethod:    getStringValue(config, "http_method", "POST"),
-		Timeout:       getIntValue(config, "timeout", 30),
-		RetryAttempts: getIntValue(config, "retry_attempts", 3),
-		Authentication: getStringValue(config, "authentication", "none"),
+		WebhookURL:      webhookURL,
+		HTTPMethod:      strings.ToUpper(getStringValue(config, "http_method", "POST")),
+		Timeout:         getIntValue(config, "timeout", 30),
+		RetryAttempts:   getIntValue(config, "retry_attempts", 3),
+		Authentication:  getStringValue(config, "authentication", "none"),
+		RetryBackoff:    time.Duration(getIntValue(config, "retry_backoff", 2)) * time.Second,
+		MaxBackoff:      time.Duration(getIntValue(config, "max_backoff", 60)) * time.Second,
+		SigningSecret:   getStringValue(config, "signing_secret", ""),
+		SignatureHeader: getStringValue(config, "signature_header", defaultSignatureHeader),
+		CaptureHeaders:  splitList(config["capture_headers"]),
+	}
+	if wc.Timeout <= 0 {
+		return nil, fmt.Errorf("timeout must be a positive number of seconds")
+	}
+	// The first attempt is always made
+	if wc.RetryAttempts < 1 {
+		wc.RetryAttempts = 1
+	}
+	if wc.RetryBackoff <= 0 || wc.MaxBackoff < wc.RetryBackoff {
+		return nil, fmt.Errorf("retry_backoff must be positive and at most max_backoff")
 	}
 
 	// Parse custom headers if present
@@ -158,49 +236,71 @@ func extractWebhookConfig(config map[string]interface{}) (*WebhookConfig, error)
 	return wc, nil
 }
 
-func (s *GenericWebhookActionService) sendWebhookWithRetry(ctx context.Context, config *WebhookConfig, payload interface{}) (string, error) {
-	var lastErr error
-	
-	for attempt := 0; attempt < config.RetryAttempts; attempt++ {
-		if attempt > 0 {
-			// Exponential backoff with jitter
-			backoff := time.Duration(math.Pow(2, float64(attempt))) * time.Second
-			jitter := time.Duration(float64(backoff) * (0.1 * (float64(time.Now().UnixNano()%100) / 100.0)))
-			time.Sleep(backoff + jitter)
-		}
+// sendWebhookWithRetry retries the network errors, 429 and 5xx responses
+// with exponential backoff, honoring Retry-After up to the max backoff. It
+// returns the number of attempts made.
+func (s *GenericWebhookActionService) sendWebhookWithRetry(ctx context.Context, config *WebhookConfig, deliveryID string, payload interface{}) (*WebhookResponse, int, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error marshaling payload: %w", err)
+	}
 
-		result, err := s.sendWebhook(ctx, config, payload)
+	var lastErr error
+	delay := config.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		result, err := s.sendWebhook(ctx, config, deliveryID, payloadBytes)
 		if err == nil {
-			return result, nil
+			return result, attempt, nil
 		}
-		
 		lastErr = err
-		s.logger.Warn("Webhook attempt failed",
-			slog.Int("attempt", attempt+1),
+		s.logger.WarnContext(ctx, "Webhook attempt failed",
+			slog.Int("attempt", attempt),
 			slog.String("error", err.Error()))
+
+		wait := delay
+		if statusErr, ok := err.(*webhookStatusError); ok {
+			if !statusErr.retryable() {
+				return nil, attempt, err
+			}
+			if after, ok := httputil.ParseRetryAfter(statusErr.retryAfter); ok {
+				if after > config.MaxBackoff {
+					return nil, attempt, fmt.Errorf("webhook asked to retry after %s: %w", after, err)
+				}
+				wait = after
+			}
+		}
+		if attempt >= config.RetryAttempts || ctx.Err() != nil {
+			break
+		}
+		// Jitter keeps the executions from retrying in lockstep
+		wait += time.Duration(rand.Int63n(int64(wait)/4 + 1))
+		select {
+		case <-ctx.Done():
+			return nil, attempt, ctx.Err()
+		case <-time.After(wait):
+		}
+		if delay *= 2; delay > config.MaxBackoff {
+			delay = config.MaxBackoff
+		}
 	}
 
-	return "", fmt.Errorf("all webhook attempts failed: %w", lastErr)
+	return nil, config.RetryAttempts, fmt.Errorf("all webhook attempts failed: %w", lastErr)
 }
 
-func (s *GenericWebhookActionService) sendWebhook(ctx context.Context, config *WebhookConfig, payload interface{}) (string, error) {
-	payloadBytes, err := json.Marshal(payload)
-	if err != nil {
-		return "", fmt.Errorf("error marshaling payload: %w", err)
-	}
-
+func (s *GenericWebhookActionService) sendWebhook(ctx context.Context, config *WebhookConfig, deliveryID string, payloadBytes []byte) (*WebhookResponse, error) {
 	// Create request with context and timeout
 	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.Timeout)*time.Second)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, config.HTTPMethod, config.WebhookURL, bytes.NewBuffer(payloadBytes))
+	req, err := http.NewRequestWithContext(ctx, config.HTTPMethod, config.WebhookURL, bytes.NewReader(payloadBytes))
 	if err != nil {
-		return "", fmt.Errorf("error creating request: %w", err)
+		return nil, fmt.Errorf("error creating request: %w", err)
 	}
 
 	// Set headers
 	req.Header.Set("Content-Type", "application/json")
-	
+	req.Header.Set("X-Webhook-ID", deliveryID)
+
 	// Add authentication headers
 	switch config.Authentication {
 	case "basic":
@@ -216,29 +316,61 @@ func (s *GenericWebhookActionService) sendWebhook(ctx context.Context, config *W
 		req.Header.Set(key, value)
 	}
 
+	if config.SigningSecret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Webhook-Timestamp", timestamp)
+		req.Header.Set(config.SignatureHeader, "sha256="+signWebhook(config.SigningSecret, timestamp, payloadBytes))
+	}
+
 	// Send request
-	client := &http.Client{Timeout: time.Duration(config.Timeout) * time.Second}
-	resp, err := client.Do(req)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("error sending request: %w", err)
+		return nil, fmt.Errorf("error sending request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	// Read response
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %w", err)
+	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", fmt.Errorf("webhook returned non-success status: %d", resp.StatusCode)
+		snippet := string(body)
+		if len(snippet) > 512 {
+			snippet = snippet[:512]
+		}
+		return nil, &webhookStatusError{
+			statusCode: resp.StatusCode,
+			retryAfter: resp.Header.Get("Retry-After"),
+			body:       snippet,
+		}
 	}
 
-	// Return response body as string
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("error decoding response: %w", err)
+	result := &WebhookResponse{StatusCode: resp.StatusCode}
+	if len(bytes.TrimSpace(body)) > 0 {
+		var decoded interface{}
+		if err := json.Unmarshal(body, &decoded); err == nil {
+			result.Body = decoded
+		} else {
+			result.Body = string(body)
+		}
 	}
-
-	resultBytes, err := json.Marshal(result)
-	if err != nil {
-		return "", fmt.Errorf("error marshaling response: %w", err)
+	for _, name := range config.CaptureHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			if result.Headers == nil {
+				result.Headers = make(map[string]string)
+			}
+			result.Headers[name] = value
+		}
 	}
+	return result, nil
+}
 
-	return string(resultBytes), nil
-}
\ No newline at end of file
+// signWebhook returns the hex HMAC-SHA256 of "timestamp.body", which the
+// receiver recomputes to authenticate the request and reject replays.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
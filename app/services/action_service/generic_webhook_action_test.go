@@ -0,0 +1,131 @@
+package action_service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+// executeWebhook runs the action against a server running handler, and
+// returns the decoded step output.
+func executeWebhook(t *testing.T, config map[string]interface{}, handler http.HandlerFunc) map[string]interface{} {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	config["webhook_url"] = server.URL
+
+	pipelineContext := pipeline_type.NewContext()
+	pipelineContext.SetStepOutput("summary", "Today's summary")
+	step := &pipeline_type.PipelineStep{
+		ID:            "webhook",
+		RequiredSteps: "summary",
+		ActionDetails: &pipeline_type.ActionDetails{Configuration: config},
+	}
+	output, err := NewGenericWebhookActionService(slog.Default()).Execute(context.Background(), "", pipelineContext, step)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		t.Fatalf("invalid output %q: %v", output, err)
+	}
+	return result
+}
+
+func TestGenericWebhookResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        interface{}
+	}{
+		// JSON bodies are decoded, not kept as a JSON string
+		{"JSON body", "application/json", `{"id":42,"tags":["a"]}`, map[string]interface{}{"id": float64(42), "tags": []interface{}{"a"}}},
+		{"text body", "text/plain", "accepted", "accepted"},
+		{"empty body", "text/plain", "", nil},
+	}
+	for _, tt := range tests {
+		result := executeWebhook(t, map[string]interface{}{}, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", tt.contentType)
+			w.Write([]byte(tt.body))
+		})
+		if !reflect.DeepEqual(result["response"], tt.want) {
+			t.Errorf("%s: got response %#v, want %#v", tt.name, result["response"], tt.want)
+		}
+	}
+}
+
+func TestGenericWebhookSignature(t *testing.T) {
+	var body []byte
+	var header http.Header
+	result := executeWebhook(t, map[string]interface{}{"signing_secret": "secret"}, func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header.Clone()
+	})
+	if result["success"] != true {
+		t.Fatalf("unexpected output %v", result)
+	}
+
+	timestamp := header.Get("X-Webhook-Timestamp")
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(sent, 0)) > time.Minute {
+		t.Fatalf("expected the current time in X-Webhook-Timestamp, got %q", timestamp)
+	}
+	if want := "sha256=" + signWebhook("secret", timestamp, body); header.Get(defaultSignatureHeader) != want {
+		t.Errorf("got signature %q, want %q", header.Get(defaultSignatureHeader), want)
+	}
+	if want := "sha256=" + signWebhook("secret", timestamp, []byte(`{"tampered":true}`)); header.Get(defaultSignatureHeader) == want {
+		t.Error("expected the signature to cover the body")
+	}
+	if header.Get("X-Webhook-ID") != result["delivery_id"] {
+		t.Errorf("expected the delivery ID %v in X-Webhook-ID, got %q", result["delivery_id"], header.Get("X-Webhook-ID"))
+	}
+}
+
+func TestGenericWebhookRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		attempts int32
+		success  bool
+	}{
+		{"rejected request", http.StatusBadRequest, 1, false},
+		{"unauthorized", http.StatusUnauthorized, 1, false},
+		{"rate limited", http.StatusTooManyRequests, 2, true},
+		{"server error", http.StatusBadGateway, 2, true},
+	}
+	for _, tt := range tests {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				w.WriteHeader(tt.status)
+			}
+		}))
+		config := &WebhookConfig{
+			WebhookURL:    server.URL,
+			HTTPMethod:    http.MethodPost,
+			Timeout:       5,
+			RetryAttempts: 3,
+			RetryBackoff:  time.Millisecond,
+			MaxBackoff:    10 * time.Millisecond,
+		}
+		_, attempts, err := NewGenericWebhookActionService(slog.Default()).sendWebhookWithRetry(context.Background(), config, "delivery", map[string]string{"data": "x"})
+		server.Close()
+
+		if (err == nil) != tt.success {
+			t.Errorf("%s: got error %v, want success %v", tt.name, err, tt.success)
+		}
+		if calls != tt.attempts || int32(attempts) != tt.attempts {
+			t.Errorf("%s: got %d calls and %d attempts, want %d", tt.name, calls, attempts, tt.attempts)
+		}
+	}
+}
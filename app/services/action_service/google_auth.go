@@ -0,0 +1,166 @@
+package action_service
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const googleTokenURL = "https://oauth2.googleapis.com/token"
+
+// googleTokens caches the access tokens obtained from refresh tokens and
+// service account keys until shortly before they expire.
+var googleTokens = struct {
+	sync.Mutex
+	tokens map[string]googleToken
+}{tokens: make(map[string]googleToken)}
+
+type googleToken struct {
+	value   string
+	expires time.Time
+}
+
+type googleServiceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// googleAccessToken returns a token for the scope from the configuration:
+// access_token as is, or one obtained with refresh_token, client_id and
+// client_secret, or with the service_account JSON key, acting for the user
+// of subject when the domain delegates to it.
+func googleAccessToken(ctx context.Context, httpClient *http.Client, config map[string]interface{}, scope string) (string, error) {
+	if token := getStringValue(config, "access_token", ""); token != "" {
+		return token, nil
+	}
+
+	var form url.Values
+	tokenURL := googleTokenURL
+	var cacheKey string
+	if refreshToken := getStringValue(config, "refresh_token", ""); refreshToken != "" {
+		clientID := getStringValue(config, "client_id", "")
+		clientSecret := getStringValue(config, "client_secret", "")
+		if clientID == "" || clientSecret == "" {
+			return "", fmt.Errorf("client_id and client_secret are required with refresh_token")
+		}
+		form = url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {refreshToken},
+			"client_id":     {clientID},
+			"client_secret": {clientSecret},
+		}
+		cacheKey = "refresh:" + clientID + ":" + refreshToken
+	} else if key := getStringValue(config, "service_account", ""); key != "" {
+		var account googleServiceAccount
+		if err := json.Unmarshal([]byte(key), &account); err != nil {
+			return "", fmt.Errorf("error parsing service_account key: %w", err)
+		}
+		if account.TokenURI != "" {
+			tokenURL = account.TokenURI
+		}
+		subject := getStringValue(config, "subject", "")
+		assertion, err := googleAssertion(account, tokenURL, scope, subject, time.Now())
+		if err != nil {
+			return "", err
+		}
+		form = url.Values{
+			"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+			"assertion":  {assertion},
+		}
+		cacheKey = "service:" + account.ClientEmail + ":" + subject + ":" + scope
+	} else {
+		return "", fmt.Errorf("access_token, refresh_token or service_account not found in config")
+	}
+
+	googleTokens.Lock()
+	cached, ok := googleTokens.tokens[cacheKey]
+	googleTokens.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.value, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := doJSONRequest(httpClient, req, &token); err != nil {
+		return "", fmt.Errorf("error obtaining Google access token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("google returned no access token")
+	}
+
+	// A minute of margin so a token doesn't expire during a request
+	lifetime := time.Duration(token.ExpiresIn)*time.Second - time.Minute
+	if lifetime > 0 {
+		googleTokens.Lock()
+		googleTokens.tokens[cacheKey] = googleToken{value: token.AccessToken, expires: time.Now().Add(lifetime)}
+		googleTokens.Unlock()
+	}
+	return token.AccessToken, nil
+}
+
+// googleAssertion signs the RS256 JWT a service account exchanges for an
+// access token.
+func googleAssertion(account googleServiceAccount, audience, scope, subject string, now time.Time) (string, error) {
+	if account.ClientEmail == "" || account.PrivateKey == "" {
+		return "", fmt.Errorf("service_account key has no client_email or private_key")
+	}
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("service_account private_key is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return "", fmt.Errorf("error parsing service_account private_key: %w", err)
+		}
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("service_account private_key is not an RSA key")
+	}
+
+	claims := map[string]interface{}{
+		"iss":   account.ClientEmail,
+		"scope": scope,
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+	if subject != "" {
+		claims["sub"] = subject
+	}
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(nil, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("error signing service_account assertion: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
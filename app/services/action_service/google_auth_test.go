@@ -0,0 +1,96 @@
+package action_service
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGoogleAssertion(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+
+	for name, block := range map[string]*pem.Block{
+		"PKCS #8": {Type: "PRIVATE KEY", Bytes: pkcs8},
+		"PKCS #1": {Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			account := googleServiceAccount{ClientEmail: "bot@project.iam.gserviceaccount.com", PrivateKey: string(pem.EncodeToMemory(block))}
+			assertion, err := googleAssertion(account, googleTokenURL, googleCalendarScope, "editor@example.com", now)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			parts := strings.Split(assertion, ".")
+			if len(parts) != 3 {
+				t.Fatalf("expected a JWT, got %q", assertion)
+			}
+			signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+			if err != nil {
+				t.Fatal(err)
+			}
+			digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+				t.Errorf("invalid RS256 signature: %v", err)
+			}
+
+			var header map[string]string
+			var claims map[string]interface{}
+			decodeJWTPart(t, parts[0], &header)
+			decodeJWTPart(t, parts[1], &claims)
+			if header["alg"] != "RS256" || header["typ"] != "JWT" {
+				t.Errorf("unexpected header %v", header)
+			}
+			if claims["iss"] != account.ClientEmail || claims["aud"] != googleTokenURL || claims["scope"] != googleCalendarScope || claims["sub"] != "editor@example.com" {
+				t.Errorf("unexpected claims %v", claims)
+			}
+			if claims["iat"] != float64(now.Unix()) || claims["exp"] != float64(now.Add(time.Hour).Unix()) {
+				t.Errorf("unexpected validity %v to %v", claims["iat"], claims["exp"])
+			}
+		})
+	}
+}
+
+func TestGoogleAssertionRejectsInvalidKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		account googleServiceAccount
+	}{
+		{"no email", googleServiceAccount{PrivateKey: "key"}},
+		{"no key", googleServiceAccount{ClientEmail: "bot@example.com"}},
+		{"not PEM", googleServiceAccount{ClientEmail: "bot@example.com", PrivateKey: "not a key"}},
+		{"not a private key", googleServiceAccount{ClientEmail: "bot@example.com",
+			PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("garbage")}))}},
+	}
+	for _, tt := range tests {
+		if _, err := googleAssertion(tt.account, googleTokenURL, googleCalendarScope, "", time.Now()); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func decodeJWTPart(t *testing.T, part string, out interface{}) {
+	t.Helper()
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		t.Fatal(err)
+	}
+}
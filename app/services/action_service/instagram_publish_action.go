@@ -0,0 +1,486 @@
+package action_service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+const (
+	InstagramPublishServiceName = "instagram_publish"
+	instagramAPIBaseURL         = "https://graph.facebook.com"
+	// instagramMaxCaption is the caption limit of the Graph API
+	instagramMaxCaption = 2200
+	// instagramMaxCarousel is the number of items a carousel holds at most
+	instagramMaxCarousel = 10
+)
+
+// Media types of the Instagram containers.
+const (
+	InstagramImage    = "IMAGE"
+	InstagramCarousel = "CAROUSEL"
+	InstagramReels    = "REELS"
+)
+
+var (
+	// instagramPollInterval is the wait between two checks of a container
+	// still processing its video
+	instagramPollInterval = 5 * time.Second
+	// instagramProcessingTimeout is how long a video may take to process
+	instagramProcessingTimeout = 5 * time.Minute
+)
+
+type InstagramPublishActionService struct {
+	logger     *slog.Logger
+	httpClient *http.Client
+}
+
+func NewInstagramPublishActionService(logger *slog.Logger) *InstagramPublishActionService {
+	return &InstagramPublishActionService{
+		logger:     logger,
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+type InstagramCredentials struct {
+	AccessToken string
+	AccountID   string
+	APIVersion  string
+}
+
+// InstagramMedia is an image or a video to publish, at a public URL Instagram
+// fetches it from.
+type InstagramMedia struct {
+	URL   string
+	Video bool
+}
+
+// InstagramContent is what a post publishes.
+type InstagramContent struct {
+	Caption  string
+	Media    []InstagramMedia
+	CoverURL string
+	// Reels are also shown in the feed unless disabled
+	ShareToFeed *bool
+}
+
+// Execute publishes a single image, a carousel or a Reel with the media and
+// caption of the required steps. Steps outputting files contribute their
+// media, which must be reachable by Instagram, other steps the caption or a
+// JSON object with caption, image_url, image_urls, video_url and cover_url
+// fields, possibly from the instagram platform of a social media step.
+func (s *InstagramPublishActionService) Execute(ctx context.Context, actionConfig string, pipelineContext *pipeline_type.Context, step *pipeline_type.PipelineStep) (string, error) {
+	if step.ActionDetails == nil || step.ActionDetails.Configuration == nil {
+		return "", fmt.Errorf("missing action configuration for InstagramPublishAction")
+	}
+
+	config := step.ActionDetails.Configuration
+	credentials, err := extractInstagramCredentials(config)
+	if err != nil {
+		return "", fmt.Errorf("error extracting Instagram credentials: %w", err)
+	}
+
+	content, err := s.findInstagramContent(step, pipelineContext)
+	if err != nil {
+		return "", err
+	}
+	content.Caption = applyDisclosure(content.Caption, instagramMaxCaption, step, pipelineContext)
+	if len([]rune(content.Caption)) > instagramMaxCaption {
+		return "", fmt.Errorf("caption is %d characters long, Instagram accepts %d", len([]rune(content.Caption)), instagramMaxCaption)
+	}
+
+	mediaType, err := instagramMediaType(content, getStringValue(config, "media_type", ""))
+	if err != nil {
+		return "", err
+	}
+	// Instagram fetches the media itself, a URL it cannot reach would only
+	// fail once some containers are created
+	if err := checkInstagramMediaURLs(content); err != nil {
+		return "", err
+	}
+
+	var containerID string
+	switch mediaType {
+	case InstagramImage:
+		containerID, err = s.createContainer(ctx, credentials, url.Values{
+			"image_url": {content.Media[0].URL},
+			"caption":   {content.Caption},
+		})
+	case InstagramReels:
+		params := url.Values{
+			"media_type": {InstagramReels},
+			"video_url":  {content.Media[0].URL},
+			"caption":    {content.Caption},
+		}
+		if content.CoverURL != "" {
+			params.Set("cover_url", content.CoverURL)
+		}
+		if content.ShareToFeed != nil {
+			params.Set("share_to_feed", fmt.Sprintf("%t", *content.ShareToFeed))
+		}
+		containerID, err = s.createContainer(ctx, credentials, params)
+	case InstagramCarousel:
+		containerID, err = s.createCarousel(ctx, credentials, content)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Videos are fetched and processed asynchronously, the container can only
+	// be published once done
+	if err := s.waitForContainer(ctx, credentials, containerID); err != nil {
+		return "", err
+	}
+
+	var published struct {
+		ID string `json:"id"`
+	}
+	if err := s.graphRequest(ctx, http.MethodPost, credentials, credentials.AccountID+"/media_publish", url.Values{"creation_id": {containerID}}, &published); err != nil {
+		return "", fmt.Errorf("error publishing Instagram media: %w", err)
+	}
+
+	// The permalink is only informative, the post is published anyway
+	var media struct {
+		Permalink string `json:"permalink"`
+	}
+	if err := s.graphRequest(ctx, http.MethodGet, credentials, published.ID, url.Values{"fields": {"permalink"}}, &media); err != nil {
+		s.logger.WarnContext(ctx, "Error reading the Instagram permalink",
+			slog.String("media_id", published.ID),
+			slog.String("error", err.Error()))
+	}
+
+	response := map[string]interface{}{
+		"media_id":     published.ID,
+		"container_id": containerID,
+		"type":         strings.ToLower(mediaType),
+		"caption":      content.Caption,
+		"media_count":  len(content.Media),
+	}
+	if media.Permalink != "" {
+		response["permalink"] = media.Permalink
+	}
+	resultJSON, err := json.Marshal(response)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling result: %w", err)
+	}
+	return string(resultJSON), nil
+}
+
+func (s *InstagramPublishActionService) CanHandle(actionService string) bool {
+	return actionService == InstagramPublishServiceName
+}
+
+// ValidateCredentials reads the Instagram account with the token.
+func (s *InstagramPublishActionService) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	credentials, err := extractInstagramCredentials(config)
+	if err != nil {
+		return err
+	}
+	var account struct {
+		ID string `json:"id"`
+	}
+	return s.graphRequest(ctx, http.MethodGet, credentials, credentials.AccountID, url.Values{"fields": {"id,username"}}, &account)
+}
+
+// createCarousel creates a container per item, then the carousel container.
+func (s *InstagramPublishActionService) createCarousel(ctx context.Context, credentials *InstagramCredentials, content *InstagramContent) (string, error) {
+	children := make([]string, 0, len(content.Media))
+	for i, media := range content.Media {
+		params := url.Values{"is_carousel_item": {"true"}}
+		if media.Video {
+			params.Set("media_type", "VIDEO")
+			params.Set("video_url", media.URL)
+		} else {
+			params.Set("image_url", media.URL)
+		}
+		childID, err := s.createContainer(ctx, credentials, params)
+		if err != nil {
+			return "", fmt.Errorf("carousel item %d: %w", i+1, err)
+		}
+		if media.Video {
+			if err := s.waitForContainer(ctx, credentials, childID); err != nil {
+				return "", fmt.Errorf("carousel item %d: %w", i+1, err)
+			}
+		}
+		children = append(children, childID)
+	}
+	return s.createContainer(ctx, credentials, url.Values{
+		"media_type": {InstagramCarousel},
+		"children":   {strings.Join(children, ",")},
+		"caption":    {content.Caption},
+	})
+}
+
+func (s *InstagramPublishActionService) createContainer(ctx context.Context, credentials *InstagramCredentials, params url.Values) (string, error) {
+	var container struct {
+		ID string `json:"id"`
+	}
+	if err := s.graphRequest(ctx, http.MethodPost, credentials, credentials.AccountID+"/media", params, &container); err != nil {
+		return "", fmt.Errorf("error creating Instagram media container: %w", err)
+	}
+	if container.ID == "" {
+		return "", fmt.Errorf("instagram returned no media container")
+	}
+	return container.ID, nil
+}
+
+// waitForContainer polls the status of a container until it can be
+// published.
+func (s *InstagramPublishActionService) waitForContainer(ctx context.Context, credentials *InstagramCredentials, containerID string) error {
+	deadline := time.Now().Add(instagramProcessingTimeout)
+	for {
+		var status struct {
+			StatusCode string `json:"status_code"`
+			Status     string `json:"status"`
+		}
+		if err := s.graphRequest(ctx, http.MethodGet, credentials, containerID, url.Values{"fields": {"status_code,status"}}, &status); err != nil {
+			return fmt.Errorf("error reading Instagram container status: %w", err)
+		}
+		switch status.StatusCode {
+		case "FINISHED", "PUBLISHED", "":
+			return nil
+		case "ERROR", "EXPIRED":
+			return fmt.Errorf("instagram could not process the media: %s %s", status.StatusCode, status.Status)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("instagram media still processing after %s", instagramProcessingTimeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(instagramPollInterval):
+		}
+	}
+}
+
+// graphRequest calls the Graph API with the token and decodes the answer in
+// result.
+func (s *InstagramPublishActionService) graphRequest(ctx context.Context, method string, credentials *InstagramCredentials, path string, params url.Values, result interface{}) error {
+	endpoint := fmt.Sprintf("%s/%s/%s", instagramAPIBaseURL, credentials.APIVersion, path)
+	params.Set("access_token", credentials.AccessToken)
+
+	var req *http.Request
+	var err error
+	if method == http.MethodGet {
+		req, err = http.NewRequestWithContext(ctx, method, endpoint+"?"+params.Encode(), nil)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, method, endpoint, strings.NewReader(params.Encode()))
+		if req != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		// The URL carries the token
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("error executing request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errorResp struct {
+			Error struct {
+				Message string `json:"message"`
+				Type    string `json:"type"`
+				Code    int    `json:"code"`
+			} `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&errorResp); err != nil {
+			return fmt.Errorf("instagram API error (HTTP %d)", resp.StatusCode)
+		}
+		return fmt.Errorf("instagram API error: %s (Type: %s, Code: %d)",
+			errorResp.Error.Message,
+			errorResp.Error.Type,
+			errorResp.Error.Code)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
+
+// findInstagramContent gathers the caption and media of the required steps.
+func (s *InstagramPublishActionService) findInstagramContent(step *pipeline_type.PipelineStep, pipelineContext *pipeline_type.Context) (*InstagramContent, error) {
+	content := &InstagramContent{}
+	var captions []string
+	for _, requiredStep := range strings.Split(step.RequiredSteps, "\r\n") {
+		requiredStep = strings.TrimSpace(requiredStep)
+		if requiredStep == "" {
+			continue
+		}
+
+		if files, err := pipelineContext.GetFileList(requiredStep); err == nil && describesMedia(files) {
+			for _, file := range files {
+				if file.URL == "" {
+					return nil, fmt.Errorf("file %s of step %s has no URL Instagram can fetch it from", file.Filename, requiredStep)
+				}
+				content.Media = append(content.Media, InstagramMedia{URL: file.URL, Video: strings.HasPrefix(file.MimeType, "video/")})
+			}
+			continue
+		}
+
+		stepOutput, err := pipelineContext.GetString(requiredStep)
+		if err != nil {
+			return nil, fmt.Errorf("error reading Instagram content: %w", err)
+		}
+		// An image step answering with the URL of the image
+		if trimmed := strings.TrimSpace(stepOutput); strings.HasPrefix(trimmed, "http") && !strings.ContainsAny(trimmed, " \n") {
+			content.Media = append(content.Media, InstagramMedia{URL: trimmed})
+			continue
+		}
+		var data map[string]interface{}
+		if err := json.Unmarshal([]byte(cleanJsonContent(stepOutput)), &data); err != nil {
+			if caption := strings.TrimSpace(stepOutput); caption != "" {
+				captions = append(captions, caption)
+			}
+			continue
+		}
+		// The instagram platform of a social media step
+		if platforms, ok := data["platforms"].(map[string]interface{}); ok {
+			if instagram, ok := platforms["instagram"].(map[string]interface{}); ok {
+				data = instagram
+			}
+		}
+		if caption := getStringValue(data, "caption", getStringValue(data, "text", "")); caption != "" {
+			captions = append(captions, caption)
+		}
+		if imageURL := getStringValue(data, "image_url", ""); imageURL != "" {
+			content.Media = append(content.Media, InstagramMedia{URL: imageURL})
+		}
+		if imageURLs, ok := data["image_urls"].([]interface{}); ok {
+			for _, imageURL := range imageURLs {
+				if u, ok := imageURL.(string); ok && u != "" {
+					content.Media = append(content.Media, InstagramMedia{URL: u})
+				}
+			}
+		}
+		if videoURL := getStringValue(data, "video_url", ""); videoURL != "" {
+			content.Media = append(content.Media, InstagramMedia{URL: videoURL, Video: true})
+		}
+		if coverURL := getStringValue(data, "cover_url", ""); coverURL != "" {
+			content.CoverURL = coverURL
+		}
+		if shareToFeed, ok := data["share_to_feed"].(bool); ok {
+			content.ShareToFeed = &shareToFeed
+		}
+	}
+
+	content.Caption = strings.Join(captions, "\n\n")
+	if len(content.Media) == 0 {
+		return nil, fmt.Errorf("no image or video to publish on Instagram")
+	}
+	return content, nil
+}
+
+// checkInstagramMediaURLs makes sure Instagram can fetch every media and the
+// cover.
+func checkInstagramMediaURLs(content *InstagramContent) error {
+	for i, media := range content.Media {
+		if err := checkPublicURL(media.URL); err != nil {
+			return fmt.Errorf("media %d cannot be fetched by Instagram: %w", i+1, err)
+		}
+	}
+	if content.CoverURL != "" {
+		if err := checkPublicURL(content.CoverURL); err != nil {
+			return fmt.Errorf("cover cannot be fetched by Instagram: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkPublicURL returns an error unless rawURL is an absolute HTTP(S) URL on
+// a host reachable from the internet. The files of this service only pass
+// when SERVICE_BASE_URL is its public address.
+func checkPublicURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %w", rawURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute HTTP URL", rawURL)
+	}
+	host := u.Hostname()
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || strings.HasSuffix(host, ".local") {
+		return fmt.Errorf("%q is on a local host, check SERVICE_BASE_URL", rawURL)
+	}
+	if ip := net.ParseIP(host); ip != nil && (ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified()) {
+		return fmt.Errorf("%q is on a private address, check SERVICE_BASE_URL", rawURL)
+	}
+	return nil
+}
+
+// describesMedia tells files generated by the steps, which have a MIME type,
+// from content objects that merely have a url field.
+func describesMedia(files []pipeline_type.FileInfo) bool {
+	for _, file := range files {
+		if !strings.HasPrefix(file.MimeType, "image/") && !strings.HasPrefix(file.MimeType, "video/") {
+			return false
+		}
+	}
+	return len(files) > 0
+}
+
+// instagramMediaType returns the configured media type, checked against the
+// media, or the one the media call for.
+func instagramMediaType(content *InstagramContent, configured string) (string, error) {
+	mediaType := strings.ToUpper(configured)
+	if mediaType == "" {
+		switch {
+		case len(content.Media) > 1:
+			mediaType = InstagramCarousel
+		case content.Media[0].Video:
+			mediaType = InstagramReels
+		default:
+			mediaType = InstagramImage
+		}
+	}
+
+	switch mediaType {
+	case InstagramImage:
+		if len(content.Media) != 1 || content.Media[0].Video {
+			return "", fmt.Errorf("an Instagram image post takes a single image, got %d media", len(content.Media))
+		}
+	case InstagramReels:
+		if len(content.Media) != 1 || !content.Media[0].Video {
+			return "", fmt.Errorf("an Instagram Reel takes a single video, got %d media", len(content.Media))
+		}
+	case InstagramCarousel:
+		if len(content.Media) < 2 || len(content.Media) > instagramMaxCarousel {
+			return "", fmt.Errorf("an Instagram carousel takes 2 to %d media, got %d", instagramMaxCarousel, len(content.Media))
+		}
+	default:
+		return "", fmt.Errorf("unknown Instagram media type %q", configured)
+	}
+	return mediaType, nil
+}
+
+func extractInstagramCredentials(config map[string]interface{}) (*InstagramCredentials, error) {
+	credentials := &InstagramCredentials{}
+	var ok bool
+
+	if credentials.AccessToken, ok = config["access_token"].(string); !ok {
+		return nil, fmt.Errorf("access_token not found in config")
+	}
+	if credentials.AccountID, ok = config["instagram_account_id"].(string); !ok {
+		return nil, fmt.Errorf("instagram_account_id not found in config")
+	}
+	if credentials.APIVersion, ok = config["api_version"].(string); !ok {
+		credentials.APIVersion = "v22.0" // Default version
+	}
+
+	return credentials, nil
+}
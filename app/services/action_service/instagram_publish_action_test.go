@@ -0,0 +1,276 @@
+package action_service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+// fakeGraphAPI answers the Instagram Graph API calls, the containers of
+// videos report IN_PROGRESS until polled processingPolls times.
+type fakeGraphAPI struct {
+	mu              sync.Mutex
+	processingPolls int
+	finalStatus     string
+	containers      []url.Values
+	polls           map[string]int
+	published       []string
+}
+
+func (g *fakeGraphAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	r.ParseForm()
+	path := strings.TrimPrefix(r.URL.Path, "/v22.0/")
+	switch {
+	case r.Method == http.MethodPost && path == "ig-1/media":
+		g.containers = append(g.containers, r.PostForm)
+		fmt.Fprintf(w, `{"id":"c%d"}`, len(g.containers))
+	case r.Method == http.MethodPost && path == "ig-1/media_publish":
+		g.published = append(g.published, r.PostForm.Get("creation_id"))
+		fmt.Fprint(w, `{"id":"m1"}`)
+	case r.Method == http.MethodGet && path == "m1":
+		fmt.Fprint(w, `{"permalink":"https://www.instagram.com/p/abc/"}`)
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "c"):
+		if g.polls == nil {
+			g.polls = map[string]int{}
+		}
+		g.polls[path]++
+		status := "FINISHED"
+		if g.polls[path] <= g.processingPolls {
+			status = "IN_PROGRESS"
+		} else if g.finalStatus != "" {
+			status = g.finalStatus
+		}
+		fmt.Fprintf(w, `{"status_code":%q}`, status)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":{"message":"unexpected call","type":"OAuthException","code":100}}`)
+	}
+}
+
+func instagramStep(config map[string]interface{}, requiredSteps ...string) *pipeline_type.PipelineStep {
+	if config == nil {
+		config = map[string]interface{}{}
+	}
+	config["access_token"] = "token"
+	config["instagram_account_id"] = "ig-1"
+	return &pipeline_type.PipelineStep{
+		ID:            "instagram",
+		RequiredSteps: strings.Join(requiredSteps, "\r\n"),
+		ActionDetails: &pipeline_type.ActionDetails{Configuration: config},
+	}
+}
+
+func publishInstagram(t *testing.T, graph *fakeGraphAPI, step *pipeline_type.PipelineStep, outputs map[string]interface{}) (map[string]interface{}, error) {
+	t.Helper()
+	interval := instagramPollInterval
+	instagramPollInterval = time.Millisecond
+	t.Cleanup(func() { instagramPollInterval = interval })
+
+	pipelineContext := pipeline_type.NewContext()
+	for key, value := range outputs {
+		pipelineContext.SetStepOutput(key, value)
+	}
+	s := NewInstagramPublishActionService(slog.Default())
+	s.httpClient = redirectClient(t, graph)
+	output, err := s.Execute(context.Background(), "", pipelineContext, step)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		t.Fatalf("invalid output %q: %v", output, err)
+	}
+	return result, nil
+}
+
+func TestFindInstagramContent(t *testing.T) {
+	images := `[{"uri":"a.png","url":"https://cdn.test/a.png","mime_type":"image/png"},{"uri":"b.mp4","url":"https://cdn.test/b.mp4","mime_type":"video/mp4"}]`
+	tests := []struct {
+		name    string
+		outputs map[string]interface{}
+		want    *InstagramContent
+		err     string
+	}{
+		{"generated files and caption", map[string]interface{}{"media": images, "caption": "Hello"}, &InstagramContent{
+			Caption: "Hello",
+			Media:   []InstagramMedia{{URL: "https://cdn.test/a.png"}, {URL: "https://cdn.test/b.mp4", Video: true}},
+		}, ""},
+		{"image URL answer", map[string]interface{}{"media": "https://cdn.test/a.png\n", "caption": "Hello"}, &InstagramContent{
+			Caption: "Hello",
+			Media:   []InstagramMedia{{URL: "https://cdn.test/a.png"}},
+		}, ""},
+		{"social media step", map[string]interface{}{
+			"media":   `{"platforms":{"instagram":{"caption":"From the step","image_urls":["https://cdn.test/a.png","https://cdn.test/b.png"]},"twitter":{"text":"Not this"}}}`,
+			"caption": "",
+		}, &InstagramContent{
+			Caption: "From the step",
+			Media:   []InstagramMedia{{URL: "https://cdn.test/a.png"}, {URL: "https://cdn.test/b.png"}},
+		}, ""},
+		{"reel object", map[string]interface{}{"media": `{"caption":"Watch","video_url":"https://cdn.test/v.mp4","cover_url":"https://cdn.test/c.jpg","share_to_feed":false}`, "caption": ""}, &InstagramContent{
+			Caption:     "Watch",
+			Media:       []InstagramMedia{{URL: "https://cdn.test/v.mp4", Video: true}},
+			CoverURL:    "https://cdn.test/c.jpg",
+			ShareToFeed: new(bool),
+		}, ""},
+		{"file without URL", map[string]interface{}{"media": `[{"uri":"a.png","mime_type":"image/png"}]`, "caption": "Hello"}, nil, "has no URL Instagram can fetch it from"},
+		{"no media", map[string]interface{}{"media": "Only text", "caption": "Hello"}, nil, "no image or video"},
+	}
+	s := NewInstagramPublishActionService(slog.Default())
+	for _, tt := range tests {
+		pipelineContext := pipeline_type.NewContext()
+		for key, value := range tt.outputs {
+			pipelineContext.SetStepOutput(key, value)
+		}
+		got, err := s.findInstagramContent(instagramStep(nil, "media", "caption"), pipelineContext)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInstagramMediaType(t *testing.T) {
+	image := InstagramMedia{URL: "https://cdn.test/a.png"}
+	video := InstagramMedia{URL: "https://cdn.test/v.mp4", Video: true}
+	tests := []struct {
+		name       string
+		media      []InstagramMedia
+		configured string
+		want       string
+		err        string
+	}{
+		{"single image", []InstagramMedia{image}, "", InstagramImage, ""},
+		{"single video", []InstagramMedia{video}, "", InstagramReels, ""},
+		{"several media", []InstagramMedia{image, video}, "", InstagramCarousel, ""},
+		{"configured lower case", []InstagramMedia{video}, "reels", InstagramReels, ""},
+		{"image configured for a video", []InstagramMedia{video}, "image", "", "takes a single image"},
+		{"reel of an image", []InstagramMedia{image}, "REELS", "", "takes a single video"},
+		{"carousel of one", []InstagramMedia{image}, "CAROUSEL", "", "takes 2 to 10 media"},
+		{"carousel too large", make([]InstagramMedia, 11), "", "", "takes 2 to 10 media"},
+		{"unknown", []InstagramMedia{image}, "STORY", "", "unknown Instagram media type"},
+	}
+	for _, tt := range tests {
+		got, err := instagramMediaType(&InstagramContent{Media: tt.media}, tt.configured)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.err, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestInstagramPublishCarousel(t *testing.T) {
+	graph := &fakeGraphAPI{processingPolls: 1}
+	result, err := publishInstagram(t, graph, instagramStep(nil, "media", "caption"), map[string]interface{}{
+		"media":   `[{"uri":"a.png","url":"https://lesocle.test/api/images/1","mime_type":"image/png"},{"uri":"b.mp4","url":"https://lesocle.test/b.mp4","mime_type":"video/mp4"}]`,
+		"caption": "Two things",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(graph.containers) != 3 {
+		t.Fatalf("expected 2 items and the carousel container, got %v", graph.containers)
+	}
+	if graph.containers[0].Get("image_url") != "https://lesocle.test/api/images/1" || graph.containers[0].Get("is_carousel_item") != "true" {
+		t.Errorf("unexpected image item %v", graph.containers[0])
+	}
+	if graph.containers[1].Get("media_type") != "VIDEO" || graph.containers[1].Get("video_url") != "https://lesocle.test/b.mp4" {
+		t.Errorf("unexpected video item %v", graph.containers[1])
+	}
+	carousel := graph.containers[2]
+	if carousel.Get("media_type") != InstagramCarousel || carousel.Get("children") != "c1,c2" || carousel.Get("caption") != "Two things" {
+		t.Errorf("unexpected carousel container %v", carousel)
+	}
+	// The video item is waited for before the carousel is created
+	if graph.polls["c2"] != 2 {
+		t.Errorf("expected the video item to be polled until processed, got %d polls", graph.polls["c2"])
+	}
+	if !reflect.DeepEqual(graph.published, []string{"c3"}) {
+		t.Errorf("expected the carousel to be published, got %v", graph.published)
+	}
+	if result["type"] != "carousel" || result["media_id"] != "m1" || result["permalink"] != "https://www.instagram.com/p/abc/" || result["media_count"] != float64(2) {
+		t.Errorf("unexpected result %v", result)
+	}
+}
+
+func TestInstagramPublishReel(t *testing.T) {
+	graph := &fakeGraphAPI{processingPolls: 3}
+	result, err := publishInstagram(t, graph, instagramStep(nil, "media"), map[string]interface{}{
+		"media": `{"caption":"Watch","video_url":"https://cdn.test/v.mp4","cover_url":"https://cdn.test/c.jpg","share_to_feed":false}`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	container := graph.containers[0]
+	if container.Get("media_type") != InstagramReels || container.Get("video_url") != "https://cdn.test/v.mp4" ||
+		container.Get("cover_url") != "https://cdn.test/c.jpg" || container.Get("share_to_feed") != "false" {
+		t.Errorf("unexpected Reel container %v", container)
+	}
+	if graph.polls["c1"] != 4 {
+		t.Errorf("expected the Reel to be polled until processed, got %d polls", graph.polls["c1"])
+	}
+	if result["type"] != "reels" || result["container_id"] != "c1" {
+		t.Errorf("unexpected result %v", result)
+	}
+}
+
+func TestInstagramProcessingFailure(t *testing.T) {
+	graph := &fakeGraphAPI{processingPolls: 1, finalStatus: "ERROR"}
+	_, err := publishInstagram(t, graph, instagramStep(nil, "media"), map[string]interface{}{
+		"media": `{"caption":"Watch","video_url":"https://cdn.test/v.mp4"}`,
+	})
+	if err == nil || !strings.Contains(err.Error(), "could not process the media: ERROR") {
+		t.Fatalf("expected a processing error, got %v", err)
+	}
+	if len(graph.published) != 0 {
+		t.Errorf("expected nothing published, got %v", graph.published)
+	}
+}
+
+func TestInstagramRejectsUnreachableMedia(t *testing.T) {
+	tests := []struct {
+		name  string
+		media string
+	}{
+		{"relative URL", `[{"uri":"storage/pipeline/videos/v.mp4","url":"/storage/pipeline/videos/2025-01/v.mp4","mime_type":"video/mp4"}]`},
+		{"localhost", `[{"uri":"i.png","url":"http://localhost:8086/api/images/1","mime_type":"image/png"}]`},
+		{"private address", `{"caption":"Hi","image_url":"http://10.0.0.4/api/images/1"}`},
+		{"private cover", `{"caption":"Hi","video_url":"https://cdn.test/v.mp4","cover_url":"http://127.0.0.1/c.jpg"}`},
+	}
+	for _, tt := range tests {
+		graph := &fakeGraphAPI{}
+		_, err := publishInstagram(t, graph, instagramStep(nil, "media"), map[string]interface{}{"media": tt.media})
+		if err == nil || !strings.Contains(err.Error(), "cannot be fetched by Instagram") {
+			t.Errorf("%s: expected the URL to be rejected, got %v", tt.name, err)
+		}
+		if len(graph.containers) != 0 {
+			t.Errorf("%s: expected no container created, got %v", tt.name, graph.containers)
+		}
+	}
+}
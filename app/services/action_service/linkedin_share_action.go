@@ -15,6 +15,7 @@ import (
 const (
     LinkedInShareServiceName = "linkedin_share"
     linkedInAPIBaseURL      = "https://api.linkedin.com/v2"
+    maxLinkedInPostLength   = 3000
 )
 
 type LinkedInShareActionService struct {
@@ -65,14 +66,14 @@ func (s *LinkedInShareActionService) Execute(ctx context.Context, actionConfig s
         }
 
         // Get the step output
-        stepOutput, ok := pipelineContext.GetStepOutput(requiredStep)
-        if !ok {
-            return "", fmt.Errorf("required step output '%s' not found for LinkedIn content", requiredStep)
+        stepOutput, err := pipelineContext.GetString(requiredStep)
+        if err != nil {
+            return "", fmt.Errorf("error reading LinkedIn content: %w", err)
         }
 
         // Try to detect if this is from a social media step type
         var resultData map[string]interface{}
-        if err := json.Unmarshal([]byte(fmt.Sprintf("%v", stepOutput)), &resultData); err == nil {
+        if err := pipelineContext.GetJSON(requiredStep, &resultData); err == nil {
             if platforms, ok := resultData["platforms"].(map[string]interface{}); ok {
                 if linkedinContent, ok := platforms["linkedin"].(map[string]interface{}); ok {
                     // This is from a social media step, use the linkedin content
@@ -87,11 +88,11 @@ func (s *LinkedInShareActionService) Execute(ctx context.Context, actionConfig s
         }
         
         // If not from social media step, use content as is (existing behavior)
-        content += fmt.Sprintf("%v", stepOutput)
+        content += stepOutput
     }
 
     if content == "" {
-        s.logger.Error("LinkedIn content is empty",
+        s.logger.ErrorContext(ctx, "LinkedIn content is empty",
             slog.String("step_id", step.ID),
             slog.String("required_steps", step.RequiredSteps))
         return "", fmt.Errorf("LinkedIn content is empty")
@@ -103,6 +104,8 @@ func (s *LinkedInShareActionService) Execute(ctx context.Context, actionConfig s
         return "", fmt.Errorf("error parsing LinkedIn content: %w", err)
     }
 
+    linkedInContent.Text = applyDisclosure(linkedInContent.Text, maxLinkedInPostLength, step, pipelineContext)
+
     // Build the share payload
     payload := s.buildSharePayload(linkedInContent, credentials)
 
@@ -163,7 +166,7 @@ func (s *LinkedInShareActionService) Execute(ctx context.Context, actionConfig s
         return "", fmt.Errorf("LinkedIn API error (status %d)", resp.StatusCode)
     }
 
-    s.logger.Error("LinkedIn API error",
+    s.logger.ErrorContext(ctx, "LinkedIn API error",
         slog.String("error", errorResp.Message),
         slog.Int("status_code", resp.StatusCode))
 
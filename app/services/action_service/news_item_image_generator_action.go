@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/rate_limiter"
 	"github.com/serisow/lesocle/services/llm_service"
 )
 
@@ -63,7 +64,7 @@ func (s *NewsItemImageGeneratorActionService) Execute(ctx context.Context, actio
 	concurrentLimit := getIntValue(config, "concurrent_limit", 3)
 	retryCount := getIntValue(config, "retry_count", 2)
 
-	s.logger.Info("Starting news item image generation",
+	s.logger.InfoContext(ctx, "Starting news item image generation",
 		slog.String("step_id", step.ID),
 		slog.String("image_generator", imageGenerator),
 		slog.String("image_size", imageSize),
@@ -91,7 +92,7 @@ func (s *NewsItemImageGeneratorActionService) Execute(ctx context.Context, actio
 	batches := chunkSlice(newsItems, concurrentLimit)
 
 	for batchIdx, batch := range batches {
-		s.logger.Debug("Processing batch",
+		s.logger.DebugContext(ctx, "Processing batch",
 			slog.Int("batch", batchIdx+1),
 			slog.Int("total_batches", len(batches)),
 			slog.Int("batch_size", len(batch)))
@@ -107,7 +108,7 @@ func (s *NewsItemImageGeneratorActionService) Execute(ctx context.Context, actio
 
 				// Skip if no image prompt
 				if newsItem.ImagePrompt == "" {
-					s.logger.Warn("Missing image prompt for article",
+					s.logger.WarnContext(ctx, "Missing image prompt for article",
 						slog.String("article_id", newsItem.ArticleID))
 					
 					// Store the article without image info
@@ -172,7 +173,7 @@ func (s *NewsItemImageGeneratorActionService) Execute(ctx context.Context, actio
 					if apiKey != "" {
 						configParams["api_key"] = apiKey
 					} else {
-						s.logger.Error("API key not found in config or environment",
+						s.logger.ErrorContext(ctx, "API key not found in config or environment",
 							slog.String("article_id", newsItem.ArticleID),
 							slog.String("service", imageGenerator),
 							slog.String("env_var", envVarName))
@@ -197,7 +198,7 @@ func (s *NewsItemImageGeneratorActionService) Execute(ctx context.Context, actio
 
 				for attempt := 0; attempt <= retryCount && !success; attempt++ {
 					if attempt > 0 {
-						s.logger.Warn("Retrying image generation",
+						s.logger.WarnContext(ctx, "Retrying image generation",
 							slog.String("article_id", newsItem.ArticleID),
 							slog.Int("attempt", attempt),
 							slog.Int("max_attempts", retryCount),
@@ -211,12 +212,18 @@ func (s *NewsItemImageGeneratorActionService) Execute(ctx context.Context, actio
 						defer func() {
 							if r := recover(); r != nil {
 								errorMsg = fmt.Sprintf("Panic in LLM service: %v", r)
-								s.logger.Error("Panic while calling LLM service",
+								s.logger.ErrorContext(ctx, "Panic while calling LLM service",
 									slog.String("article_id", newsItem.ArticleID),
 									slog.Any("panic", r))
 							}
 						}()
 						
+						// Parallel items share the provider limit
+						if err := rate_limiter.Wait(ctx, imageGenerator); err != nil {
+							errorMsg = err.Error()
+							return
+						}
+
 						// Make the actual call
 						result, err := llmServiceInstance.CallLLM(ctx, configParams, newsItem.ImagePrompt)
 						if err == nil {
@@ -241,7 +248,7 @@ func (s *NewsItemImageGeneratorActionService) Execute(ctx context.Context, actio
 				} else {
 					newsItem.ImageInfo = nil
 					newsItem.ImageError = errorMsg
-					s.logger.Error("Image generation failed after retries",
+					s.logger.ErrorContext(ctx, "Image generation failed after retries",
 						slog.String("article_id", newsItem.ArticleID),
 						slog.Int("retries", retryCount),
 						slog.String("error", errorMsg))
@@ -265,7 +272,7 @@ func (s *NewsItemImageGeneratorActionService) Execute(ctx context.Context, actio
 		return "", fmt.Errorf("error marshaling results: %w", err)
 	}
 
-	s.logger.Info("News item image generation completed",
+	s.logger.InfoContext(ctx, "News item image generation completed",
 		slog.Int("total_processed", len(processedItems)))
 
 	return string(result), nil
@@ -336,7 +343,7 @@ func parseImageResult(imageResult string) (interface{}, error) {
 func (s *NewsItemImageGeneratorActionService) findNewsContentData(pipelineContext *pipeline_type.Context) ([]NewsItemWithImage, error) {
 	// Log all step outputs for debugging
 	s.logger.Debug("Searching for structured news content in pipeline context",
-		slog.Any("available_step_keys", getMapKeys(pipelineContext.StepOutputs)))
+		slog.Any("available_step_keys", pipelineContext.StepOutputKeys()))
 
 	// First, look for steps with output_type="structured_news"
 	steps := pipelineContext.GetStepsByOutputType("structured_news")
@@ -362,10 +369,12 @@ func (s *NewsItemImageGeneratorActionService) findNewsContentData(pipelineContex
 	}
 
 	// If not found via output_type, try all step outputs
-	for key, value := range pipelineContext.StepOutputs {
+	for _, key := range pipelineContext.StepOutputKeys() {
 		s.logger.Debug("Checking step output for structured news content",
 			slog.String("step_key", key))
-			
+
+		value, _ := pipelineContext.GetStepOutput(key)
+
 		if newsItems := tryParseNewsItems(value); newsItems != nil {
 			s.logger.Info("Found structured news content in step output",
 				slog.String("step_key", key),
@@ -495,15 +504,6 @@ func tryParseNewsItems(value interface{}) []NewsItemWithImage {
 	return nil
 }
 
-// Helper function to get map keys for logging
-func getMapKeys(m map[string]interface{}) []string {
-	keys := make([]string, 0, len(m))
-	for k := range m {
-		keys = append(keys, k)
-	}
-	return keys
-}
-
 // RegisterLLMService allows registering an LLM service with this action service
 func (s *NewsItemImageGeneratorActionService) RegisterLLMService(name string, service llm_service.LLMService) {
 	s.llmServiceManager[name] = service
@@ -0,0 +1,57 @@
+package action_service
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+// OutboundContent returns the texts an action may send besides its required
+// step outputs: the string settings of its configuration with their
+// placeholders filled (message_template, subject, body, summary...), and the
+// content read at the paths of its *_from settings (recipients_from,
+// events_from, rows_from...).
+func OutboundContent(config map[string]interface{}, pipelineContext *pipeline_type.Context) []string {
+	var texts []string
+	var walk func(key string, value interface{})
+	walk = func(key string, value interface{}) {
+		switch v := value.(type) {
+		case string:
+			if !strings.HasSuffix(key, "_from") {
+				texts = append(texts, fillEmailTemplate(v, pipelineContext))
+				return
+			}
+			content, ok := pipelineContext.GetPath(v)
+			if !ok || content == nil {
+				return
+			}
+			if text, isText := content.(string); isText {
+				texts = append(texts, text)
+			} else if encoded, err := json.Marshal(content); err == nil {
+				texts = append(texts, string(encoded))
+			}
+		case []string:
+			for _, item := range v {
+				walk(key, item)
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(key, item)
+			}
+		case map[string]interface{}:
+			// Sorted so the first rejected setting is always the same
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				walk(k, v[k])
+			}
+		}
+	}
+	walk("", config)
+	return texts
+}
@@ -16,6 +16,7 @@ import (
 const (
     PostTweetServiceName = "post_tweet"
     twitterAPIV2URL     = "https://api.twitter.com/2/tweets"
+    maxTweetLength      = 280
 )
 
 type PostTweetActionService struct {
@@ -42,22 +43,28 @@ func (s *PostTweetActionService) Execute(ctx context.Context, actionConfig strin
     // Get content from required steps exactly like create_article_action
     requiredSteps := strings.Split(step.RequiredSteps, "\r\n")
     var content string
+    var media []pipeline_type.FileInfo
     
     for _, requiredStep := range requiredSteps {
         requiredStep = strings.TrimSpace(requiredStep)
         if requiredStep == "" {
             continue
         }
+
+        // Generated images and videos are attached to the tweet
+        if files, err := pipelineContext.GetFileList(requiredStep); err == nil && describesMedia(files) {
+            media = append(media, files...)
+            continue
+        }
         
-        stepOutput, ok := pipelineContext.GetStepOutput(requiredStep)
-        if !ok {
-            return "", fmt.Errorf("required step output '%s' not found for tweet content", requiredStep)
+        stepOutput, err := pipelineContext.GetString(requiredStep)
+        if err != nil {
+            return "", fmt.Errorf("error reading tweet content: %w", err)
         }
 
-
         // Try to detect if this is from a social media step
         var resultData map[string]interface{}
-        if err := json.Unmarshal([]byte(fmt.Sprintf("%v", stepOutput)), &resultData); err == nil {
+        if err := pipelineContext.GetJSON(requiredStep, &resultData); err == nil {
             if platforms, ok := resultData["platforms"].(map[string]interface{}); ok {
                 if twitterContent, ok := platforms["twitter"].(map[string]interface{}); ok {
                     // This is from a social media step, use the twitter content
@@ -71,11 +78,11 @@ func (s *PostTweetActionService) Execute(ctx context.Context, actionConfig strin
             }
         }
 
-        content += fmt.Sprintf("%v", stepOutput)
+        content += stepOutput
     }
 
     if content == "" {
-        s.logger.Error("Tweet content is empty",
+        s.logger.ErrorContext(ctx, "Tweet content is empty",
             slog.String("step_id", step.ID),
             slog.String("required_steps", step.RequiredSteps))
         return "", fmt.Errorf("tweet content is empty")
@@ -84,14 +91,38 @@ func (s *PostTweetActionService) Execute(ctx context.Context, actionConfig strin
     // Clean and parse the JSON content
     tweetContent := cleanJsonContent(content)
     var tweetData struct {
-        Text string `json:"text"`
+        Text    string   `json:"text"`
+        Thread  []string `json:"thread"`
+        AltText string   `json:"alt_text"`
     }
     if err := json.Unmarshal([]byte(tweetContent), &tweetData); err != nil {
         return "", fmt.Errorf("error parsing tweet content: %w", err)
     }
 
-    if tweetData.Text == "" {
-        return "", fmt.Errorf("JSON must contain 'text' field")
+    if tweetData.Text == "" && len(tweetData.Thread) == 0 {
+        return "", fmt.Errorf("JSON must contain 'text' or 'thread' field")
+    }
+
+    // A thread given by the content, or a text too long for a tweet when
+    // threads are enabled, is posted as numbered tweets replying to each other
+    var tweets []string
+    threaded := len(tweetData.Thread) > 0 || (getBoolValue(config, "thread", false) && tweetLength(tweetData.Text) > maxTweetLength)
+    if threaded {
+        parts := tweetData.Thread
+        if len(parts) == 0 {
+            parts = []string{tweetData.Text}
+        }
+        // The disclosure goes at the end of the thread, never shortening it
+        last := len(parts) - 1
+        parts[last] = applyDisclosure(parts[last], 0, step, pipelineContext)
+        tweets, err = buildThread(parts, maxTweetLength,
+            getIntValue(config, "max_thread_length", defaultMaxThreadLength),
+            getBoolValue(config, "thread_numbering", true))
+        if err != nil {
+            return "", err
+        }
+    } else {
+        tweets = []string{applyDisclosure(tweetData.Text, maxTweetLength, step, pipelineContext)}
     }
 
     // Configure OAuth1.0a client
@@ -99,11 +130,81 @@ func (s *PostTweetActionService) Execute(ctx context.Context, actionConfig strin
     token := oauth1.NewToken(credentials.AccessToken, credentials.AccessTokenSecret)
     httpClient := oauthConfig.Client(ctx, token)
 
+    // The media go with the first tweet
+    var mediaIDs []string
+    if getBoolValue(config, "attach_media", true) {
+        altText := tweetData.AltText
+        if altText == "" {
+            altText = strings.TrimSpace(fillEmailTemplate(getStringValue(config, "alt_text", ""), pipelineContext))
+        }
+        for _, file := range tweetMedia(media) {
+            mediaID, err := s.uploadTweetMedia(ctx, httpClient, file, altText)
+            if err != nil {
+                return "", fmt.Errorf("error uploading %s: %w", attachmentName(file), err)
+            }
+            mediaIDs = append(mediaIDs, mediaID)
+        }
+    }
+
+    // Each tweet replies to the previous one
+    tweetIDs := make([]string, 0, len(tweets))
+    for i, text := range tweets {
+        replyTo := ""
+        var tweetMediaIDs []string
+        if i > 0 {
+            replyTo = tweetIDs[i-1]
+        } else {
+            tweetMediaIDs = mediaIDs
+        }
+        tweetID, err := s.postTweet(ctx, httpClient, text, replyTo, tweetMediaIDs)
+        if err != nil {
+            if len(tweetIDs) > 0 {
+                s.logger.ErrorContext(ctx, "Thread interrupted",
+                    slog.Int("posted", len(tweetIDs)),
+                    slog.Int("tweets", len(tweets)),
+                    slog.String("tweet_ids", strings.Join(tweetIDs, ",")))
+                return "", fmt.Errorf("thread interrupted after %d of %d tweets (posted %s): %w",
+                    len(tweetIDs), len(tweets), strings.Join(tweetIDs, ", "), err)
+            }
+            return "", err
+        }
+        tweetIDs = append(tweetIDs, tweetID)
+    }
+
+    result := map[string]interface{}{
+        "tweet_id": tweetIDs[0],
+        "text":     tweets[0],
+    }
+    if len(mediaIDs) > 0 {
+        result["media_ids"] = mediaIDs
+    }
+    if threaded {
+        result["tweet_ids"] = tweetIDs
+        result["thread"] = tweets
+    }
+
+    resultJson, err := json.Marshal(result)
+    if err != nil {
+        return "", fmt.Errorf("error marshaling result: %w", err)
+    }
+
+    return string(resultJson), nil
+}
+
+// postTweet posts a tweet, in reply to replyTo when set and with the
+// uploaded media, and returns its ID.
+func (s *PostTweetActionService) postTweet(ctx context.Context, httpClient *http.Client, text, replyTo string, mediaIDs []string) (string, error) {
     // Prepare tweet payload
-    tweetRequest := map[string]string{
-        "text": tweetData.Text,
+    tweetRequest := map[string]interface{}{
+        "text": text,
     }
-    
+    if replyTo != "" {
+        tweetRequest["reply"] = map[string]string{"in_reply_to_tweet_id": replyTo}
+    }
+    if len(mediaIDs) > 0 {
+        tweetRequest["media"] = map[string][]string{"media_ids": mediaIDs}
+    }
+
     jsonData, err := json.Marshal(tweetRequest)
     if err != nil {
         return "", fmt.Errorf("error marshaling tweet request: %w", err)
@@ -135,18 +236,7 @@ func (s *PostTweetActionService) Execute(ctx context.Context, actionConfig strin
         if err := json.NewDecoder(resp.Body).Decode(&tweetResponse); err != nil {
             return "", fmt.Errorf("error decoding response: %w", err)
         }
-
-        result := map[string]interface{}{
-            "tweet_id": tweetResponse.Data.ID,
-            "text":     tweetData.Text,
-        }
-        
-        resultJson, err := json.Marshal(result)
-        if err != nil {
-            return "", fmt.Errorf("error marshaling result: %w", err)
-        }
-
-        return string(resultJson), nil
+        return tweetResponse.Data.ID, nil
     }
 
     // Handle error case
@@ -165,7 +255,7 @@ func (s *PostTweetActionService) Execute(ctx context.Context, actionConfig strin
         errorMessage = errorResp.Errors[0].Message
     }
 
-    s.logger.Error("Twitter API error",
+    s.logger.ErrorContext(ctx, "Twitter API error",
         slog.String("error", errorMessage),
         slog.Int("status_code", resp.StatusCode))
 
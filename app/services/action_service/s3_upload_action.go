@@ -0,0 +1,322 @@
+package action_service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/stream_upload"
+)
+
+const (
+	S3UploadServiceName = "s3_upload"
+	// defaultS3KeyTemplate files the objects by upload day
+	defaultS3KeyTemplate = "{date}/{filename}"
+	// defaultPresignExpiry is how long presigned URLs stay valid
+	defaultPresignExpiry = time.Hour
+	// maxPresignExpiry is the longest validity S3 signatures accept
+	maxPresignExpiry = 7 * 24 * time.Hour
+)
+
+type S3UploadActionService struct {
+	logger     *slog.Logger
+	httpClient *http.Client
+}
+
+func NewS3UploadActionService(logger *slog.Logger) *S3UploadActionService {
+	return &S3UploadActionService{
+		logger:     logger,
+		httpClient: &http.Client{Timeout: 10 * time.Minute},
+	}
+}
+
+type S3Config struct {
+	Bucket          string
+	Region          string
+	Endpoint        string
+	AccessKeyID     string
+	SecretAccessKey string
+	ForcePathStyle  bool
+	KeyTemplate     string
+	ACL             string
+	CacheControl    string
+	StorageClass    string
+	PublicBaseURL   string
+	PresignExpiry   time.Duration
+}
+
+// UploadedFile is a file pushed to the bucket: the file info with the URL of
+// the object, public or presigned, so the next steps use it in place of the
+// local file.
+type UploadedFile struct {
+	pipeline_type.FileInfo
+	Bucket    string `json:"bucket"`
+	Key       string `json:"key"`
+	S3URI     string `json:"s3_uri"`
+	ETag      string `json:"etag,omitempty"`
+	Presigned bool   `json:"presigned,omitempty"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+}
+
+// Execute uploads the files output by the required steps to an S3 compatible
+// bucket, such as MinIO or Cloudflare R2 with a custom endpoint. The object
+// keys come from the key template, whose placeholders are {filename}, {name},
+// {ext}, {file_id}, {step_id}, {date}, {year}, {month}, {day}, {timestamp}
+// and the pipeline outputs. A single file gives its uploaded file info,
+// several a "files" list.
+func (s *S3UploadActionService) Execute(ctx context.Context, actionConfig string, pipelineContext *pipeline_type.Context, step *pipeline_type.PipelineStep) (string, error) {
+	if step.ActionDetails == nil || step.ActionDetails.Configuration == nil {
+		return "", fmt.Errorf("missing action configuration for S3UploadAction")
+	}
+
+	s3Config, err := extractS3Config(step.ActionDetails.Configuration)
+	if err != nil {
+		return "", fmt.Errorf("error extracting S3 configuration: %w", err)
+	}
+
+	var files []pipeline_type.FileInfo
+	for _, requiredStep := range step.RequiredStepKeys() {
+		stepFiles, err := pipelineContext.GetFileList(requiredStep)
+		if err != nil {
+			return "", fmt.Errorf("step output %s has no file to upload: %w", requiredStep, err)
+		}
+		files = append(files, stepFiles...)
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no file to upload")
+	}
+
+	client, err := s3Client(s3Config)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	uploaded := make([]UploadedFile, 0, len(files))
+	for _, file := range files {
+		key := s3ObjectKey(s3Config.KeyTemplate, file, step.ID, now, pipelineContext)
+		result, err := s.upload(ctx, client, s3Config, file, key)
+		if err != nil {
+			return "", fmt.Errorf("error uploading %s: %w", attachmentName(file), err)
+		}
+		s.logger.InfoContext(ctx, "Uploaded file to S3",
+			slog.String("bucket", s3Config.Bucket),
+			slog.String("key", key),
+			slog.Int64("size", result.Size))
+		uploaded = append(uploaded, *result)
+	}
+
+	var output interface{} = map[string]interface{}{"files": uploaded}
+	if len(uploaded) == 1 {
+		output = uploaded[0]
+	}
+	resultJSON, err := json.Marshal(output)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling result: %w", err)
+	}
+	return string(resultJSON), nil
+}
+
+func (s *S3UploadActionService) CanHandle(actionService string) bool {
+	return actionService == S3UploadServiceName
+}
+
+// ValidateCredentials checks the bucket is reachable with the keys.
+func (s *S3UploadActionService) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	s3Config, err := extractS3Config(config)
+	if err != nil {
+		return err
+	}
+	client, err := s3Client(s3Config)
+	if err != nil {
+		return err
+	}
+	_, err = client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(s3Config.Bucket)})
+	return err
+}
+
+// upload streams a file, local or downloaded from its URL, to the key, with
+// its progress in the execution log.
+func (s *S3UploadActionService) upload(ctx context.Context, client *s3.S3, config *S3Config, file pipeline_type.FileInfo, key string) (*UploadedFile, error) {
+	contentType := file.MimeType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(key))
+	}
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(config.Bucket),
+		Key:    aws.String(key),
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+	if config.ACL != "" {
+		input.ACL = aws.String(config.ACL)
+	}
+	if config.CacheControl != "" {
+		input.CacheControl = aws.String(config.CacheControl)
+	}
+	if config.StorageClass != "" {
+		input.StorageClass = aws.String(config.StorageClass)
+	}
+	if file.SHA256 != "" {
+		input.Metadata = map[string]*string{"sha256": aws.String(file.SHA256)}
+	}
+
+	progress := stream_upload.LogProgress(ctx, key)
+	var output *s3manager.UploadOutput
+	size := file.Size
+	if info, err := os.Stat(file.URI); err == nil && !info.IsDir() {
+		size = info.Size()
+		if output, err = stream_upload.UploadToS3(ctx, client, input, file.URI, progress); err != nil {
+			return nil, err
+		}
+	} else if file.URL != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, file.URL, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("error downloading the file: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("error downloading the file: status %d", resp.StatusCode)
+		}
+		if resp.ContentLength > 0 {
+			size = resp.ContentLength
+		}
+		if output, err = stream_upload.UploadStreamToS3(ctx, client, input, resp.Body, resp.ContentLength, progress); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, fmt.Errorf("file %s is not on this host and has no URL", file.URI)
+	}
+
+	uploaded := &UploadedFile{
+		FileInfo: file,
+		Bucket:   config.Bucket,
+		Key:      key,
+		S3URI:    fmt.Sprintf("s3://%s/%s", config.Bucket, key),
+		ETag:     strings.Trim(aws.StringValue(output.ETag), `"`),
+	}
+	uploaded.Size = size
+	uploaded.MimeType = contentType
+	uploaded.Filename = path.Base(key)
+
+	// Objects are reachable at the public base URL or when public-read,
+	// otherwise through a presigned URL
+	switch {
+	case config.PublicBaseURL != "":
+		uploaded.URL = strings.TrimRight(config.PublicBaseURL, "/") + "/" + escapeKey(key)
+	case config.ACL == s3.ObjectCannedACLPublicRead || config.ACL == s3.ObjectCannedACLPublicReadWrite:
+		uploaded.URL = output.Location
+	default:
+		req, _ := client.GetObjectRequest(&s3.GetObjectInput{Bucket: aws.String(config.Bucket), Key: aws.String(key)})
+		presigned, err := req.Presign(config.PresignExpiry)
+		if err != nil {
+			return nil, fmt.Errorf("error presigning the URL: %w", err)
+		}
+		uploaded.URL = presigned
+		uploaded.Presigned = true
+		uploaded.ExpiresAt = time.Now().Add(config.PresignExpiry).Unix()
+	}
+	return uploaded, nil
+}
+
+// s3Client returns a client of the bucket's region and endpoint, with the
+// configured keys or else those of the environment.
+func s3Client(config *S3Config) (*s3.S3, error) {
+	awsConfig := &aws.Config{
+		Region:           aws.String(config.Region),
+		S3ForcePathStyle: aws.Bool(config.ForcePathStyle),
+	}
+	if config.Endpoint != "" {
+		awsConfig.Endpoint = aws.String(config.Endpoint)
+	}
+	if config.AccessKeyID != "" {
+		awsConfig.Credentials = credentials.NewStaticCredentials(config.AccessKeyID, config.SecretAccessKey, "")
+	}
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS session: %w", err)
+	}
+	return s3.New(sess), nil
+}
+
+// s3ObjectKey fills the key template for a file.
+func s3ObjectKey(template string, file pipeline_type.FileInfo, stepID string, now time.Time, pipelineContext *pipeline_type.Context) string {
+	filename := attachmentName(file)
+	ext := filepath.Ext(filename)
+	fileID := ""
+	if file.FileID != 0 {
+		fileID = fmt.Sprintf("%d", file.FileID)
+	}
+	key := strings.NewReplacer(
+		"{filename}", filename,
+		"{name}", strings.TrimSuffix(filename, ext),
+		"{ext}", strings.TrimPrefix(ext, "."),
+		"{file_id}", fileID,
+		"{step_id}", stepID,
+		"{date}", now.Format("2006-01-02"),
+		"{year}", now.Format("2006"),
+		"{month}", now.Format("01"),
+		"{day}", now.Format("02"),
+		"{timestamp}", fmt.Sprintf("%d", now.Unix()),
+	).Replace(template)
+	key = fillEmailTemplate(key, pipelineContext)
+	// Keys are paths relative to the bucket
+	return strings.TrimLeft(path.Clean("/"+key), "/")
+}
+
+// escapeKey escapes the segments of an object key for a URL.
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func extractS3Config(config map[string]interface{}) (*S3Config, error) {
+	s3Config := &S3Config{
+		Bucket:          getStringValue(config, "bucket", ""),
+		Region:          getStringValue(config, "region", "us-east-1"),
+		Endpoint:        getStringValue(config, "endpoint", ""),
+		AccessKeyID:     getStringValue(config, "access_key_id", ""),
+		SecretAccessKey: getStringValue(config, "secret_access_key", ""),
+		KeyTemplate:     getStringValue(config, "key_template", defaultS3KeyTemplate),
+		ACL:             getStringValue(config, "acl", ""),
+		CacheControl:    getStringValue(config, "cache_control", ""),
+		StorageClass:    getStringValue(config, "storage_class", ""),
+		PublicBaseURL:   getStringValue(config, "public_base_url", ""),
+		PresignExpiry:   time.Duration(getIntValue(config, "presign_expiry", int(defaultPresignExpiry/time.Second))) * time.Second,
+	}
+	if s3Config.Bucket == "" {
+		return nil, fmt.Errorf("bucket not found in config")
+	}
+	if s3Config.AccessKeyID != "" && s3Config.SecretAccessKey == "" {
+		return nil, fmt.Errorf("secret_access_key not found in config")
+	}
+	// MinIO and most S3 compatible stores only serve path style URLs
+	s3Config.ForcePathStyle = getBoolValue(config, "force_path_style", s3Config.Endpoint != "")
+	if s3Config.PresignExpiry <= 0 || s3Config.PresignExpiry > maxPresignExpiry {
+		return nil, fmt.Errorf("presign_expiry must be between 1 second and 7 days")
+	}
+	return s3Config, nil
+}
@@ -0,0 +1,239 @@
+package action_service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+func TestS3ObjectKey(t *testing.T) {
+	now := time.Date(2026, 3, 5, 14, 30, 0, 0, time.UTC)
+	pipelineContext := pipeline_type.NewContext()
+	pipelineContext.SetStepOutput("campaign", " spring ")
+	pipelineContext.SetStepOutput("brief", `{"client":{"slug":"acme"}}`)
+
+	report := pipeline_type.FileInfo{URI: "/tmp/out/report.pdf"}
+	clip := pipeline_type.FileInfo{URI: "/tmp/out/1234.mp4", Filename: "clip.mp4", FileID: 42}
+	tests := []struct {
+		name     string
+		template string
+		file     pipeline_type.FileInfo
+		want     string
+	}{
+		{name: "default", template: defaultS3KeyTemplate, file: report, want: "2026-03-05/report.pdf"},
+		{name: "file placeholders", template: "{step_id}/{year}/{month}/{day}/{name}-{file_id}.{ext}", file: clip, want: "upload/2026/03/05/clip-42.mp4"},
+		{name: "timestamp", template: "{timestamp}_{filename}", file: clip, want: "1772721000_clip.mp4"},
+		{name: "pipeline outputs", template: "{brief.client.slug}/{campaign}/{filename}", file: report, want: "acme/spring/report.pdf"},
+		{name: "unknown placeholder kept", template: "{missing}/{filename}", file: report, want: "{missing}/report.pdf"},
+		{name: "empty segments removed", template: "/{file_id}//{filename}", file: report, want: "report.pdf"},
+		{name: "kept in the bucket", template: "../../{campaign}/../../{filename}", file: report, want: "report.pdf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s3ObjectKey(tt.template, tt.file, "upload", now, pipelineContext); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscapeKey(t *testing.T) {
+	tests := map[string]string{
+		"2026-03-05/report.pdf":   "2026-03-05/report.pdf",
+		"media/my report #1.pdf":  "media/my%20report%20%231.pdf",
+		"a/b?c=d":                 "a/b%3Fc=d",
+		"été/clip 100%.mp4":       "%C3%A9t%C3%A9/clip%20100%25.mp4",
+		"nested/path/segment+one": "nested/path/segment+one",
+	}
+	for key, want := range tests {
+		if got := escapeKey(key); got != want {
+			t.Errorf("escapeKey(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestExtractS3Config(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    map[string]interface{}
+		pathStyle bool
+		wantErr   string
+	}{
+		{name: "AWS", config: map[string]interface{}{"bucket": "media"}},
+		{name: "custom endpoint", config: map[string]interface{}{"bucket": "media", "endpoint": "https://minio.example.com"}, pathStyle: true},
+		{name: "virtual host style endpoint", config: map[string]interface{}{"bucket": "media", "endpoint": "https://r2.example.com", "force_path_style": false}},
+		{name: "no bucket", config: map[string]interface{}{}, wantErr: "bucket not found in config"},
+		{name: "no secret", config: map[string]interface{}{"bucket": "media", "access_key_id": "AKID"}, wantErr: "secret_access_key not found in config"},
+		{name: "presign expiry too long", config: map[string]interface{}{"bucket": "media", "presign_expiry": 8 * 24 * 3600}, wantErr: "presign_expiry must be between"},
+		{name: "presign expiry negative", config: map[string]interface{}{"bucket": "media", "presign_expiry": -1}, wantErr: "presign_expiry must be between"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Config, err := extractS3Config(tt.config)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if s3Config.ForcePathStyle != tt.pathStyle || s3Config.PresignExpiry != defaultPresignExpiry || s3Config.KeyTemplate != defaultS3KeyTemplate {
+				t.Errorf("unexpected config %+v", s3Config)
+			}
+		})
+	}
+}
+
+// s3Server fakes the path style PUT object endpoint of a bucket.
+type s3Server struct {
+	mu      sync.Mutex
+	objects map[string]string
+	headers map[string]http.Header
+}
+
+func (f *s3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Method != http.MethodPut || !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+	data, _ := io.ReadAll(r.Body)
+	f.objects[r.URL.EscapedPath()] = string(data)
+	f.headers[r.URL.EscapedPath()] = r.Header.Clone()
+	w.Header().Set("ETag", `"etag-`+r.URL.Path+`"`)
+}
+
+// executeS3Upload runs the action with the bucket at the fake endpoint and the
+// downloads sent to handler.
+func executeS3Upload(t *testing.T, config map[string]interface{}, pipelineContext *pipeline_type.Context, required string, download http.HandlerFunc) (string, *s3Server, error) {
+	bucket := &s3Server{objects: map[string]string{}, headers: map[string]http.Header{}}
+	endpoint := httptest.NewServer(bucket)
+	t.Cleanup(endpoint.Close)
+	config["bucket"] = "media"
+	config["endpoint"] = endpoint.URL
+	config["access_key_id"] = "AKID"
+	config["secret_access_key"] = "secret"
+
+	s := NewS3UploadActionService(slog.Default())
+	s.httpClient = redirectClient(t, download)
+	step := &pipeline_type.PipelineStep{
+		ID:            "upload",
+		RequiredSteps: required,
+		ActionDetails: &pipeline_type.ActionDetails{Configuration: config},
+	}
+	output, err := s.Execute(context.Background(), "", pipelineContext, step)
+	return output, bucket, err
+}
+
+func TestS3UploadFiles(t *testing.T) {
+	report := filepath.Join(t.TempDir(), "report.pdf")
+	if err := os.WriteFile(report, []byte("%PDF"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pipelineContext := pipeline_type.NewContext()
+	pipelineContext.SetStepOutput("report", `[{"uri":"`+report+`","mime_type":"application/pdf","filename":"Q1 report.pdf","sha256":"abc123"}]`)
+	pipelineContext.SetStepOutput("image", `[{"uri":"/elsewhere/cover.png","url":"https://files.example.com/cover.png","mime_type":"image/png"}]`)
+
+	output, bucket, err := executeS3Upload(t, map[string]interface{}{
+		"key_template":    "{step_id}/{filename}",
+		"public_base_url": "https://cdn.example.com/media/",
+		"cache_control":   "max-age=3600",
+	}, pipelineContext, "report\r\nimage", func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "files.example.com" || r.URL.Path != "/cover.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("PNG data"))
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if bucket.objects["/media/upload/Q1%20report.pdf"] != "%PDF" || bucket.objects["/media/upload/cover.png"] != "PNG data" {
+		t.Errorf("unexpected objects %v", bucket.objects)
+	}
+	headers := bucket.headers["/media/upload/Q1%20report.pdf"]
+	if headers.Get("Content-Type") != "application/pdf" || headers.Get("Cache-Control") != "max-age=3600" || headers.Get("X-Amz-Meta-Sha256") != "abc123" {
+		t.Errorf("unexpected headers %v", headers)
+	}
+
+	var result struct {
+		Files []UploadedFile `json:"files"`
+	}
+	if err := json.Unmarshal([]byte(output), &result); err != nil || len(result.Files) != 2 {
+		t.Fatalf("expected two uploaded files, got %s", output)
+	}
+	first, second := result.Files[0], result.Files[1]
+	if first.URL != "https://cdn.example.com/media/upload/Q1%20report.pdf" || first.S3URI != "s3://media/upload/Q1 report.pdf" ||
+		first.ETag != "etag-/media/upload/Q1 report.pdf" || first.Size != 4 || first.Presigned {
+		t.Errorf("unexpected first file %+v", first)
+	}
+	if second.URL != "https://cdn.example.com/media/upload/cover.png" || second.Size != 8 || second.Filename != "cover.png" || second.MimeType != "image/png" {
+		t.Errorf("unexpected second file %+v", second)
+	}
+}
+
+func TestS3UploadPresigned(t *testing.T) {
+	video := writeMediaFile(t, "clip.mp4", 10)
+	pipelineContext := pipeline_type.NewContext()
+	pipelineContext.SetStepOutput("video", `[{"uri":"`+video+`"}]`)
+
+	before := time.Now()
+	output, _, err := executeS3Upload(t, map[string]interface{}{"key_template": "videos/{filename}", "presign_expiry": 600}, pipelineContext, "video", http.NotFound)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A single file is the output itself
+	var uploaded UploadedFile
+	if err := json.Unmarshal([]byte(output), &uploaded); err != nil {
+		t.Fatalf("invalid output %q: %v", output, err)
+	}
+	if !uploaded.Presigned || !strings.Contains(uploaded.URL, "/media/videos/clip.mp4?") || !strings.Contains(uploaded.URL, "X-Amz-Expires=600") {
+		t.Errorf("expected a presigned URL, got %+v", uploaded)
+	}
+	if expiry := time.Unix(uploaded.ExpiresAt, 0).Sub(before); expiry < 599*time.Second || expiry > 601*time.Second {
+		t.Errorf("unexpected expiry in %v", expiry)
+	}
+	// The content type comes from the key when the file has none
+	if uploaded.MimeType != "video/mp4" {
+		t.Errorf("unexpected MIME type %q", uploaded.MimeType)
+	}
+}
+
+func TestS3UploadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		wantErr string
+	}{
+		{name: "no file", output: `[]`, wantErr: "no file to upload"},
+		{name: "not a file list", output: "Some text", wantErr: "step output files has no file to upload"},
+		{name: "not on this host", output: `[{"uri":"/elsewhere/a.png","mime_type":"image/png"}]`, wantErr: "file /elsewhere/a.png is not on this host and has no URL"},
+		{name: "download failed", output: `[{"uri":"/elsewhere/a.png","url":"https://files.example.com/a.png","mime_type":"image/png"}]`, wantErr: "error downloading the file: status 404"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipelineContext := pipeline_type.NewContext()
+			pipelineContext.SetStepOutput("files", tt.output)
+			_, _, err := executeS3Upload(t, map[string]interface{}{}, pipelineContext, "files", http.NotFound)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package action_service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+// SandboxService is implemented by action services handling sandbox mode
+// themselves: they call a test endpoint of the provider, or run for real when
+// they have no side effect. Other services are simulated in sandbox mode.
+type SandboxService interface {
+	ExecuteSandbox(ctx context.Context, actionConfig string, pipelineContext *pipeline_type.Context, step *pipeline_type.PipelineStep) (string, error)
+}
+
+// SimulatedResult is the output of an action simulated in sandbox mode.
+func SimulatedResult(step *pipeline_type.PipelineStep) (string, error) {
+	service := step.ActionConfig
+	if step.ActionDetails != nil {
+		service = step.ActionDetails.ActionService
+	}
+	result, err := json.Marshal(map[string]interface{}{
+		"sandbox":        true,
+		"simulated":      true,
+		"action_service": service,
+		"step_id":        step.ID,
+		"message":        fmt.Sprintf("%s simulated in sandbox mode, nothing was sent", service),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error marshaling simulated result: %w", err)
+	}
+	return string(result), nil
+}
+
+// markSandbox adds the sandbox flag to the JSON object result of an action
+// run against a test endpoint.
+func markSandbox(result string) (string, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(result), &fields); err != nil {
+		return "", fmt.Errorf("error parsing sandbox result: %w", err)
+	}
+	fields["sandbox"] = true
+	marked, err := json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling sandbox result: %w", err)
+	}
+	return string(marked), nil
+}
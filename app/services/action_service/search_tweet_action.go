@@ -62,9 +62,9 @@ func (s *SearchTweetsActionService) Execute(ctx context.Context, actionConfig st
 			if requiredStep == "" {
 				continue
 			}
-			if stepOutput, ok := pipelineContext.GetStepOutput(requiredStep); ok {
+			if stepOutput, err := pipelineContext.GetString(requiredStep); err == nil {
 				placeholder := fmt.Sprintf("{%s}", requiredStep)
-				searchQuery = strings.Replace(searchQuery, placeholder, fmt.Sprintf("%v", stepOutput), -1)
+				searchQuery = strings.Replace(searchQuery, placeholder, stepOutput, -1)
 			}
 		}
 	}
@@ -90,7 +90,7 @@ func (s *SearchTweetsActionService) Execute(ctx context.Context, actionConfig st
 
 	response, err := httpClient.Do(req)
 	if err != nil {
-		s.logger.Error("Error executing Twitter search request",
+		s.logger.ErrorContext(ctx, "Error executing Twitter search request",
 			slog.String("error", err.Error()))
 		return "", fmt.Errorf("error executing request: %w", err)
 	}
@@ -98,7 +98,7 @@ func (s *SearchTweetsActionService) Execute(ctx context.Context, actionConfig st
 
 	// Handle rate limiting
 	if response.StatusCode == 429 {
-		s.logger.Warn("Rate limit exceeded for Twitter search",
+		s.logger.WarnContext(ctx, "Rate limit exceeded for Twitter search",
 			slog.String("reset", response.Header.Get("x-rate-limit-reset")))
 		return "", fmt.Errorf("rate limit exceeded - please wait before trying again")
 	}
@@ -264,3 +264,8 @@ func buildTweetFields(config *TwitterSearchConfig) string {
 	}
 	return strings.Join(fields, ",")
 }
+
+// ExecuteSandbox runs the action for real, it only reads from Twitter.
+func (s *SearchTweetsActionService) ExecuteSandbox(ctx context.Context, actionConfig string, pipelineContext *pipeline_type.Context, step *pipeline_type.PipelineStep) (string, error) {
+	return s.Execute(ctx, actionConfig, pipelineContext, step)
+}
@@ -0,0 +1,492 @@
+package action_service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+const (
+	SendEmailServiceName = "send_email"
+	// defaultMaxAttachmentMB caps the attachments of a message, most servers
+	// refuse messages over 25 MB once encoded
+	defaultMaxAttachmentMB = 18
+)
+
+// SMTP connection security.
+const (
+	SMTPStartTLS = "starttls"
+	SMTPTLS      = "tls"
+	SMTPNone     = "none"
+)
+
+// emailPlaceholder matches the "{step_output_key}" placeholders of the
+// subject and body templates.
+var emailPlaceholder = regexp.MustCompile(`\{([A-Za-z0-9_.\-]+)\}`)
+
+type SendEmailActionService struct {
+	logger *slog.Logger
+}
+
+func NewSendEmailActionService(logger *slog.Logger) *SendEmailActionService {
+	return &SendEmailActionService{
+		logger: logger,
+	}
+}
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Security string
+}
+
+// Email is a message to send.
+type Email struct {
+	From        mail.Address
+	To          []string
+	Cc          []string
+	Bcc         []string
+	ReplyTo     *mail.Address
+	Subject     string
+	Body        string
+	HTML        bool
+	Attachments []pipeline_type.FileInfo
+}
+
+// Execute sends an email. The subject and body templates take the outputs of
+// the pipeline as "{step_output_key}" placeholders; without a body template
+// the body is the text outputs of the required steps. The files the required
+// steps output are attached.
+func (s *SendEmailActionService) Execute(ctx context.Context, actionConfig string, pipelineContext *pipeline_type.Context, step *pipeline_type.PipelineStep) (string, error) {
+	if step.ActionDetails == nil || step.ActionDetails.Configuration == nil {
+		return "", fmt.Errorf("missing action configuration for SendEmailAction")
+	}
+
+	config := step.ActionDetails.Configuration
+	smtpConfig, err := extractSMTPConfig(config)
+	if err != nil {
+		return "", fmt.Errorf("error extracting SMTP configuration: %w", err)
+	}
+	email, err := buildEmail(config, step, pipelineContext, false)
+	if err != nil {
+		return "", err
+	}
+
+	message, messageID, err := email.message()
+	if err != nil {
+		return "", err
+	}
+	recipients := append(append(append([]string{}, email.To...), email.Cc...), email.Bcc...)
+	if err := sendSMTP(ctx, smtpConfig, email.From.Address, recipients, message); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to send email",
+			slog.String("error", err.Error()),
+			slog.String("smtp_host", smtpConfig.Host))
+		return "", fmt.Errorf("failed to send email: %w", err)
+	}
+
+	attachments := make([]string, 0, len(email.Attachments))
+	for _, file := range email.Attachments {
+		attachments = append(attachments, attachmentName(file))
+	}
+	response := map[string]interface{}{
+		"success":     true,
+		"message_id":  messageID,
+		"subject":     email.Subject,
+		"recipients":  len(recipients),
+		"attachments": attachments,
+		"timestamp":   time.Now().Unix(),
+	}
+	resultJSON, err := json.Marshal(response)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling result: %w", err)
+	}
+	return string(resultJSON), nil
+}
+
+func (s *SendEmailActionService) CanHandle(actionService string) bool {
+	return actionService == SendEmailServiceName
+}
+
+// ValidateCredentials logs in to the SMTP server without sending anything.
+func (s *SendEmailActionService) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	smtpConfig, err := extractSMTPConfig(config)
+	if err != nil {
+		return err
+	}
+	client, err := dialSMTP(ctx, smtpConfig)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return client.Quit()
+}
+
+// buildEmail gathers the addresses, content and attachments of an email.
+// Emails rendered from a provider template may have no subject and body.
+func buildEmail(config map[string]interface{}, step *pipeline_type.PipelineStep, pipelineContext *pipeline_type.Context, templated bool) (*Email, error) {
+	from, err := mail.ParseAddress(getStringValue(config, "from", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid from address: %w", err)
+	}
+	if name := getStringValue(config, "from_name", ""); name != "" {
+		from.Name = name
+	}
+	email := &Email{From: *from}
+	if replyTo := getStringValue(config, "reply_to", ""); replyTo != "" {
+		// Parsed like the other addresses, a raw value could inject headers
+		if email.ReplyTo, err = mail.ParseAddress(replyTo); err != nil {
+			return nil, fmt.Errorf("invalid reply_to address: %w", err)
+		}
+	}
+	for field, list := range map[string]*[]string{"to": &email.To, "cc": &email.Cc, "bcc": &email.Bcc} {
+		if *list, err = emailAddresses(config[field]); err != nil {
+			return nil, fmt.Errorf("invalid %s addresses: %w", field, err)
+		}
+	}
+	if len(email.To)+len(email.Cc)+len(email.Bcc) == 0 {
+		return nil, fmt.Errorf("the email has no recipient")
+	}
+
+	// The text outputs of the required steps make the default body, their
+	// files the attachments
+	var texts []string
+	for _, requiredStep := range step.RequiredStepKeys() {
+		if files, err := pipelineContext.GetFileList(requiredStep); err == nil && describesFiles(files) {
+			email.Attachments = append(email.Attachments, files...)
+			continue
+		}
+		stepOutput, err := pipelineContext.GetString(requiredStep)
+		if err != nil {
+			return nil, fmt.Errorf("error reading email content: %w", err)
+		}
+		texts = append(texts, strings.TrimSpace(stepOutput))
+	}
+
+	email.Subject = strings.TrimSpace(fillEmailTemplate(getStringValue(config, "subject", ""), pipelineContext))
+	if email.Subject == "" && !templated {
+		return nil, fmt.Errorf("the email has no subject")
+	}
+	// The outputs go into the variables of a provider template instead
+	if !templated {
+		email.Body = strings.Join(texts, "\n\n")
+	}
+	if template := getStringValue(config, "body", ""); template != "" {
+		email.Body = fillEmailTemplate(template, pipelineContext)
+	}
+	if strings.TrimSpace(email.Body) == "" && !templated {
+		return nil, fmt.Errorf("the email body is empty")
+	}
+	switch getStringValue(config, "body_format", "") {
+	case "html":
+		email.HTML = true
+	case "":
+		email.HTML = strings.HasPrefix(strings.TrimSpace(email.Body), "<")
+	}
+
+	maxSize := int64(getIntValue(config, "max_attachment_size_mb", defaultMaxAttachmentMB)) << 20
+	var total int64
+	for _, file := range email.Attachments {
+		stat, err := os.Stat(file.URI)
+		if err != nil {
+			return nil, fmt.Errorf("attachment %s is not on this host: %w", attachmentName(file), err)
+		}
+		if total += stat.Size(); total > maxSize {
+			return nil, fmt.Errorf("attachments exceed %d MB", maxSize>>20)
+		}
+	}
+	return email, nil
+}
+
+// message renders the email as a MIME message and returns it with its
+// Message-ID.
+func (e *Email) message() ([]byte, string, error) {
+	var buf bytes.Buffer
+	messageID := newMessageID(e.From.Address)
+
+	headers := []string{
+		"From: " + e.From.String(),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Message-ID: " + messageID,
+		"Subject: " + mime.QEncoding.Encode("utf-8", e.Subject),
+		"MIME-Version: 1.0",
+	}
+	if len(e.To) > 0 {
+		headers = append(headers, "To: "+strings.Join(e.To, ", "))
+	}
+	if len(e.Cc) > 0 {
+		headers = append(headers, "Cc: "+strings.Join(e.Cc, ", "))
+	}
+	if e.ReplyTo != nil {
+		headers = append(headers, "Reply-To: "+e.ReplyTo.String())
+	}
+	for _, header := range headers {
+		buf.WriteString(header + "\r\n")
+	}
+
+	contentType := "text/plain; charset=utf-8"
+	if e.HTML {
+		contentType = "text/html; charset=utf-8"
+	}
+	if len(e.Attachments) == 0 {
+		buf.WriteString("Content-Type: " + contentType + "\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&buf, e.Body); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), messageID, nil
+	}
+
+	writer := multipart.NewWriter(&buf)
+	buf.WriteString("Content-Type: multipart/mixed; boundary=" + writer.Boundary() + "\r\n\r\n")
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("error writing email body: %w", err)
+	}
+	if err := writeQuotedPrintable(part, e.Body); err != nil {
+		return nil, "", err
+	}
+	for _, file := range e.Attachments {
+		data, err := os.ReadFile(file.URI)
+		if err != nil {
+			return nil, "", fmt.Errorf("error reading attachment %s: %w", attachmentName(file), err)
+		}
+		// The type comes from a step output, it goes into a header
+		mimeType, _, err := mime.ParseMediaType(file.MimeType)
+		if err != nil {
+			mimeType = "application/octet-stream"
+		}
+		name := mime.QEncoding.Encode("utf-8", attachmentName(file))
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {fmt.Sprintf("%s; name=%q", mimeType, name)},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", name)},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, "", fmt.Errorf("error writing attachment %s: %w", attachmentName(file), err)
+		}
+		encoded := base64.StdEncoding.EncodeToString(data)
+		for len(encoded) > 76 {
+			part.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		part.Write([]byte(encoded + "\r\n"))
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", fmt.Errorf("error writing email: %w", err)
+	}
+	return buf.Bytes(), messageID, nil
+}
+
+// sendSMTP delivers the message to the recipients.
+func sendSMTP(ctx context.Context, config *SMTPConfig, from string, recipients []string, message []byte) error {
+	client, err := dialSMTP(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := client.Mail(from); err != nil {
+		return fmt.Errorf("sender refused: %w", err)
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("recipient %s refused: %w", recipient, err)
+		}
+	}
+	data, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("error starting message data: %w", err)
+	}
+	if _, err := data.Write(message); err != nil {
+		return fmt.Errorf("error writing message data: %w", err)
+	}
+	if err := data.Close(); err != nil {
+		return fmt.Errorf("message refused: %w", err)
+	}
+	return client.Quit()
+}
+
+// dialSMTP connects to the server with the configured security and logs in.
+func dialSMTP(ctx context.Context, config *SMTPConfig) (*smtp.Client, error) {
+	address := net.JoinHostPort(config.Host, strconv.Itoa(config.Port))
+	tlsConfig := &tls.Config{ServerName: config.Host}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if config.Security == SMTPTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %w", address, err)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Minute)
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, config.Host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error greeting %s: %w", address, err)
+	}
+	if config.Security == SMTPStartTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+	if config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", config.Username, config.Password, config.Host)); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+	return client, nil
+}
+
+func extractSMTPConfig(config map[string]interface{}) (*SMTPConfig, error) {
+	smtpConfig := &SMTPConfig{
+		Host:     getStringValue(config, "smtp_host", ""),
+		Port:     getIntValue(config, "smtp_port", 587),
+		Username: getStringValue(config, "username", ""),
+		Password: getStringValue(config, "password", ""),
+	}
+	if port, ok := config["smtp_port"].(string); ok {
+		var err error
+		if smtpConfig.Port, err = strconv.Atoi(port); err != nil {
+			return nil, fmt.Errorf("invalid smtp_port %q", port)
+		}
+	}
+	if smtpConfig.Host == "" {
+		return nil, fmt.Errorf("smtp_host not found in config")
+	}
+
+	// Port 465 speaks TLS from the start, the others upgrade with STARTTLS
+	defaultSecurity := SMTPStartTLS
+	if smtpConfig.Port == 465 {
+		defaultSecurity = SMTPTLS
+	}
+	smtpConfig.Security = getStringValue(config, "security", defaultSecurity)
+	switch smtpConfig.Security {
+	case SMTPStartTLS, SMTPTLS, SMTPNone:
+	default:
+		return nil, fmt.Errorf("unknown SMTP security %q", smtpConfig.Security)
+	}
+	return smtpConfig, nil
+}
+
+// emailAddresses parses a list of addresses, a JSON list or a string
+// separated by commas, semicolons or new lines.
+func emailAddresses(value interface{}) ([]string, error) {
+	var raw []string
+	switch v := value.(type) {
+	case string:
+		raw = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ';' || r == '\n' || r == '\r' })
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				raw = append(raw, s)
+			}
+		}
+	}
+	var addresses []string
+	for _, entry := range raw {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		address, err := mail.ParseAddress(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", entry, err)
+		}
+		addresses = append(addresses, address.Address)
+	}
+	return addresses, nil
+}
+
+// fillEmailTemplate replaces the placeholders naming step outputs, or dotted
+// paths in them such as {search.title}, with their values. Unknown
+// placeholders are kept.
+func fillEmailTemplate(template string, pipelineContext *pipeline_type.Context) string {
+	return emailPlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		key := placeholder[1 : len(placeholder)-1]
+		if value, err := pipelineContext.GetString(key); err == nil {
+			return strings.TrimSpace(value)
+		}
+		value, ok := pipelineContext.GetPath(key)
+		if !ok || value == nil {
+			return placeholder
+		}
+		if text, ok := value.(string); ok {
+			return strings.TrimSpace(text)
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return placeholder
+		}
+		return string(encoded)
+	})
+}
+
+// describesFiles tells the outputs of file steps, which have a MIME type,
+// from content objects that merely have a url field.
+func describesFiles(files []pipeline_type.FileInfo) bool {
+	for _, file := range files {
+		if file.MimeType == "" || file.URI == "" {
+			return false
+		}
+	}
+	return len(files) > 0
+}
+
+func attachmentName(file pipeline_type.FileInfo) string {
+	if file.Filename != "" {
+		return file.Filename
+	}
+	return filepath.Base(file.URI)
+}
+
+func writeQuotedPrintable(w interface{ Write([]byte) (int, error) }, text string) error {
+	encoder := quotedprintable.NewWriter(w)
+	if _, err := encoder.Write([]byte(strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\n", "\r\n"))); err != nil {
+		return fmt.Errorf("error encoding email body: %w", err)
+	}
+	return encoder.Close()
+}
+
+func newMessageID(from string) string {
+	domain := "lesocle.local"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = from[at+1:]
+	}
+	random := make([]byte, 12)
+	rand.Read(random)
+	return fmt.Sprintf("<%d.%x@%s>", time.Now().UnixNano(), random, domain)
+}
@@ -0,0 +1,202 @@
+package action_service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+func TestEmailAddresses(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  []string
+		err   string
+	}{
+		{"separated string", "a@example.com, b@example.com;c@example.com\r\nd@example.com", []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com"}, ""},
+		{"named address", "Jane Doe <jane@example.com>", []string{"jane@example.com"}, ""},
+		{"JSON list", []interface{}{"a@example.com", 42, " b@example.com "}, []string{"a@example.com", "b@example.com"}, ""},
+		{"empty entries", " , ;", nil, ""},
+		{"missing", nil, nil, ""},
+		{"invalid address", "a@example.com, not an address", nil, `"not an address"`},
+	}
+	for _, tt := range tests {
+		got, err := emailAddresses(tt.value)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.err, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestBuildEmailReplyTo(t *testing.T) {
+	pipelineContext := pipeline_type.NewContext()
+	pipelineContext.SetStepOutput("summary", "Today's summary")
+	step := &pipeline_type.PipelineStep{ID: "email", RequiredSteps: "summary"}
+	config := map[string]interface{}{
+		"from":    "news@example.com",
+		"to":      "reader@example.com",
+		"subject": "News",
+	}
+
+	config["reply_to"] = "Desk <desk@example.com>"
+	email, err := buildEmail(config, step, pipelineContext, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if email.ReplyTo == nil || email.ReplyTo.Address != "desk@example.com" || email.ReplyTo.Name != "Desk" {
+		t.Errorf("unexpected reply-to %v", email.ReplyTo)
+	}
+
+	config["reply_to"] = "desk@example.com\r\nBcc: victim@example.com"
+	if _, err := buildEmail(config, step, pipelineContext, false); err == nil || !strings.Contains(err.Error(), "invalid reply_to address") {
+		t.Errorf("expected the reply_to header injection to be refused, got %v", err)
+	}
+}
+
+func TestEmailMessage(t *testing.T) {
+	email := &Email{
+		From:    mail.Address{Name: "Le Socle", Address: "news@example.com"},
+		To:      []string{"a@example.com", "b@example.com"},
+		Cc:      []string{"c@example.com"},
+		Bcc:     []string{"hidden@example.com"},
+		ReplyTo: &mail.Address{Name: "Rédaction", Address: "desk@example.com"},
+		Subject: "Résumé du jour",
+		Body:    "Première ligne\nSeconde ligne, assez longue pour être coupée par l'encodage quoted-printable de la norme.",
+	}
+	data, messageID, err := email.message()
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("invalid message: %v", err)
+	}
+
+	header := message.Header
+	if !strings.HasPrefix(header.Get("Subject"), "=?utf-8?q?") {
+		t.Errorf("expected a Q-encoded subject, got %q", header.Get("Subject"))
+	}
+	if subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject")); err != nil || subject != email.Subject {
+		t.Errorf("subject decodes to %q, %v", subject, err)
+	}
+	if header.Get("Message-ID") != messageID || !strings.HasSuffix(messageID, "@example.com>") {
+		t.Errorf("unexpected Message-ID %q, returned %q", header.Get("Message-ID"), messageID)
+	}
+	for name, want := range map[string]string{"From": "news@example.com", "Reply-To": "desk@example.com"} {
+		if address, err := header.AddressList(name); err != nil || len(address) != 1 || address[0].Address != want {
+			t.Errorf("%s: got %v, %v, want %s", name, address, err, want)
+		}
+	}
+	if to, err := header.AddressList("To"); err != nil || len(to) != 2 {
+		t.Errorf("unexpected To %v, %v", to, err)
+	}
+	if header.Get("Cc") != "c@example.com" {
+		t.Errorf("unexpected Cc %q", header.Get("Cc"))
+	}
+	if header.Get("Bcc") != "" || bytes.Contains(data, []byte("hidden@example.com")) {
+		t.Error("the Bcc recipients must not be in the message")
+	}
+	if header.Get("Content-Type") != "text/plain; charset=utf-8" || header.Get("Content-Transfer-Encoding") != "quoted-printable" {
+		t.Errorf("unexpected content headers %q, %q", header.Get("Content-Type"), header.Get("Content-Transfer-Encoding"))
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(message.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.ReplaceAll(string(body), "\r\n", "\n"); got != email.Body {
+		t.Errorf("body decodes to %q", got)
+	}
+}
+
+func TestEmailMessageAttachments(t *testing.T) {
+	dir := t.TempDir()
+	image := filepath.Join(dir, "chart.png")
+	content := bytes.Repeat([]byte("png data "), 20)
+	if err := os.WriteFile(image, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	email := &Email{
+		From:    mail.Address{Address: "news@example.com"},
+		To:      []string{"a@example.com"},
+		Subject: "Chart",
+		Body:    "<p>See the chart</p>",
+		HTML:    true,
+		Attachments: []pipeline_type.FileInfo{
+			{URI: image, Filename: "graphique été.png", MimeType: "image/png"},
+			{URI: image, MimeType: "image/png\r\nX-Injected: yes"},
+		},
+	}
+	data, _, err := email.message()
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("invalid message: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("unexpected content type %q, %v", message.Header.Get("Content-Type"), err)
+	}
+
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	var parts []*multipart.Part
+	var bodies [][]byte
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(part)
+		parts = append(parts, part)
+		bodies = append(bodies, body)
+	}
+	if len(parts) != 3 {
+		t.Fatalf("expected the body and 2 attachments, got %d parts", len(parts))
+	}
+	if parts[0].Header.Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Errorf("unexpected body type %q", parts[0].Header.Get("Content-Type"))
+	}
+
+	_, disposition, err := mime.ParseMediaType(parts[1].Header.Get("Content-Disposition"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, err := new(mime.WordDecoder).DecodeHeader(disposition["filename"]); err != nil || name != "graphique été.png" {
+		t.Errorf("attachment name decodes to %q, %v", name, err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(bodies[1]), "\r\n", ""))
+	if err != nil || !bytes.Equal(decoded, content) {
+		t.Errorf("attachment decodes to %q, %v", decoded, err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(bodies[1])), "\r\n") {
+		if len(line) > 76 {
+			t.Errorf("base64 line of %d characters", len(line))
+		}
+	}
+
+	// A MIME type breaking the header is replaced
+	if parts[2].Header.Get("X-Injected") != "" || !strings.HasPrefix(parts[2].Header.Get("Content-Type"), "application/octet-stream;") {
+		t.Errorf("unexpected attachment headers %v", parts[2].Header)
+	}
+}
@@ -5,21 +5,30 @@ import (
     "encoding/json"
     "fmt"
     "log/slog"
+    "errors"
+    "net/http"
     "strings"
-    "github.com/twilio/twilio-go"
-    twilioApi "github.com/twilio/twilio-go/rest/api/v2010"
+    "time"
     "github.com/serisow/lesocle/pipeline_type"
 )
 
 const SendSMSServiceName = "send_sms"
 
+const (
+    // defaultMaxSMSRecipients bounds a batch unless max_recipients is set
+    defaultMaxSMSRecipients = 100
+    smsStatusInterval       = 5 * time.Second
+)
+
 type SendSMSActionService struct {
-    logger *slog.Logger
+    logger     *slog.Logger
+    httpClient *http.Client
 }
 
 func NewSendSMSActionService(logger *slog.Logger) *SendSMSActionService {
     return &SendSMSActionService{
-        logger: logger,
+        logger:     logger,
+        httpClient: &http.Client{Timeout: 30 * time.Second},
     }
 }
 
@@ -28,32 +37,117 @@ func (s *SendSMSActionService) Execute(ctx context.Context, actionConfig string,
         return "", fmt.Errorf("missing action configuration for SendSMSAction")
     }
 
-    // Get credentials from configuration
     config := step.ActionDetails.Configuration
-    credentials, err := extractTwilioCredentials(config)
+    provider, err := newSMSProvider(config, s.httpClient)
+    if err != nil {
+        return "", fmt.Errorf("error reading SMS provider credentials: %w", err)
+    }
+    fromNumber := getStringValue(config, "from_number", "")
+    if fromNumber == "" {
+        return "", fmt.Errorf("from_number not found in config")
+    }
+
+    recipients, err := smsRecipients(config, pipelineContext)
     if err != nil {
-        return "", fmt.Errorf("error extracting Twilio credentials: %w", err)
+        return "", err
     }
 
-    // Get content from required steps
+    // A template is filled per recipient, otherwise the message comes from
+    // the required steps
+    template := getStringValue(config, "message_template", "")
+    var message string
+    if template == "" {
+        if message, err = s.readMessage(ctx, pipelineContext, step); err != nil {
+            return "", err
+        }
+    }
+
+    providerName := getStringValue(config, "provider", SMSProviderTwilio)
+    messages := make([]map[string]interface{}, 0, len(recipients))
+    sent := 0
+    for _, recipient := range recipients {
+        body := message
+        if template != "" {
+            body = strings.TrimSpace(fillSMSTemplate(template, recipient, pipelineContext))
+        }
+        entry := map[string]interface{}{
+            "to":      recipient.Number,
+            "message": body,
+        }
+        if body == "" {
+            entry["status"] = "failed"
+            entry["error"] = "message is empty"
+            messages = append(messages, entry)
+            continue
+        }
+
+        id, status, err := provider.Send(ctx, fromNumber, recipient.Number, body)
+        if err != nil {
+            // One bad number doesn't stop the batch
+            s.logger.ErrorContext(ctx, "Failed to send SMS",
+                slog.String("error", err.Error()),
+                slog.String("provider", providerName),
+                slog.String("to", recipient.Number))
+            entry["status"] = "failed"
+            entry["error"] = err.Error()
+            messages = append(messages, entry)
+            continue
+        }
+        entry["message_sid"] = id
+        entry["status"] = status
+        messages = append(messages, entry)
+        sent++
+    }
+
+    if sent == 0 {
+        return "", fmt.Errorf("failed to send SMS to any of %d recipients: %v", len(recipients), messages[0]["error"])
+    }
+
+    if wait := getIntValue(config, "capture_status", 0); wait > 0 {
+        s.captureStatus(ctx, provider, messages, time.Duration(wait)*time.Second)
+    }
+
+    result := map[string]interface{}{
+        "provider": providerName,
+        "messages": messages,
+        "sent":     sent,
+        "failed":   len(recipients) - sent,
+    }
+    // A single SMS keeps the fields of its result at the top
+    if len(messages) == 1 {
+        result["message_sid"] = messages[0]["message_sid"]
+        result["status"] = messages[0]["status"]
+        result["message"] = messages[0]["message"]
+    }
+
+    resultJson, err := json.Marshal(result)
+    if err != nil {
+        return "", fmt.Errorf("error marshaling result: %w", err)
+    }
+
+    return string(resultJson), nil
+}
+
+// readMessage reads the message of the JSON content of the required steps.
+func (s *SendSMSActionService) readMessage(ctx context.Context, pipelineContext *pipeline_type.Context, step *pipeline_type.PipelineStep) (string, error) {
     requiredSteps := strings.Split(step.RequiredSteps, "\r\n")
     var content string
-    
+
     for _, requiredStep := range requiredSteps {
         requiredStep = strings.TrimSpace(requiredStep)
         if requiredStep == "" {
             continue
         }
-        
-        stepOutput, ok := pipelineContext.GetStepOutput(requiredStep)
-        if !ok {
-            return "", fmt.Errorf("required step output '%s' not found for SMS content", requiredStep)
+
+        stepOutput, err := pipelineContext.GetString(requiredStep)
+        if err != nil {
+            return "", fmt.Errorf("error reading SMS content: %w", err)
         }
-        content += fmt.Sprintf("%v", stepOutput)
+        content += stepOutput
     }
 
     if content == "" {
-        s.logger.Error("SMS content is empty",
+        s.logger.ErrorContext(ctx, "SMS content is empty",
             slog.String("step_id", step.ID),
             slog.String("required_steps", step.RequiredSteps))
         return "", fmt.Errorf("SMS content is empty")
@@ -71,71 +165,185 @@ func (s *SendSMSActionService) Execute(ctx context.Context, actionConfig string,
     if smsData.Message == "" {
         return "", fmt.Errorf("JSON must contain 'message' field")
     }
+    return smsData.Message, nil
+}
 
-    // Initialize Twilio client
-    client := twilio.NewRestClientWithParams(twilio.ClientParams{
-        Username: credentials.AccountSid,
-        Password: credentials.AuthToken,
-    })
+// captureStatus polls the delivery status of the sent messages until they
+// are final or the wait is over, keeping the last status known.
+func (s *SendSMSActionService) captureStatus(ctx context.Context, provider SMSProvider, messages []map[string]interface{}, wait time.Duration) {
+    ctx, cancel := context.WithTimeout(ctx, wait)
+    defer cancel()
 
-    // Create message params
-    params := &twilioApi.CreateMessageParams{
-        To:   &credentials.ToNumber,
-        From: &credentials.FromNumber,
-        Body: &smsData.Message,
+    for {
+        pending := 0
+        for _, entry := range messages {
+            id, _ := entry["message_sid"].(string)
+            status, _ := entry["status"].(string)
+            if id == "" || smsFinalStatus(status) {
+                continue
+            }
+            status, err := provider.Status(ctx, id)
+            if errors.Is(err, errSMSStatusUnsupported) {
+                return
+            }
+            if err != nil {
+                s.logger.WarnContext(ctx, "Failed to fetch SMS status",
+                    slog.String("message_sid", id),
+                    slog.String("error", err.Error()))
+                pending++
+                continue
+            }
+            if status != "" {
+                entry["status"] = status
+            }
+            if !smsFinalStatus(status) {
+                pending++
+            }
+        }
+        if pending == 0 {
+            return
+        }
+        select {
+        case <-ctx.Done():
+            return
+        case <-time.After(smsStatusInterval):
+        }
     }
+}
 
-    // Send SMS
-    message, err := client.Api.CreateMessage(params)
-    if err != nil {
-        s.logger.Error("Failed to send SMS",
-            slog.String("error", err.Error()),
-            slog.String("to", credentials.ToNumber))
-        return "", fmt.Errorf("failed to send SMS: %w", err)
-    }
+func (s *SendSMSActionService) CanHandle(actionService string) bool {
+    return actionService == SendSMSServiceName
+}
 
-    // Prepare response
-    result := map[string]interface{}{
-        "message_sid": *message.Sid,
-        "status":     *message.Status,
-        "message":    smsData.Message,
-    }
+// smsRecipient is a number to send to, with the list item it was read from
+// for the placeholders of the template.
+type smsRecipient struct {
+    Number string
+    Data   interface{}
+}
 
-    resultJson, err := json.Marshal(result)
-    if err != nil {
-        return "", fmt.Errorf("error marshaling result: %w", err)
+// smsRecipients reads the numbers of the list at recipients_from, strings or
+// objects with a phone field, or else of to_number, which may list several.
+func smsRecipients(config map[string]interface{}, pipelineContext *pipeline_type.Context) ([]smsRecipient, error) {
+    var recipients []smsRecipient
+    if path := getStringValue(config, "recipients_from", ""); path != "" {
+        value, ok := pipelineContext.GetPath(path)
+        if !ok {
+            return nil, fmt.Errorf("recipients_from path %s not found", path)
+        }
+        list, ok := value.([]interface{})
+        if !ok {
+            if text, isText := value.(string); isText {
+                for _, number := range splitList(text) {
+                    list = append(list, number)
+                }
+            } else {
+                return nil, fmt.Errorf("recipients_from path %s is not a list", path)
+            }
+        }
+        for _, item := range list {
+            if number := smsRecipientNumber(item); number != "" {
+                recipients = append(recipients, smsRecipient{Number: number, Data: item})
+            }
+        }
+    } else {
+        for _, number := range splitList(config["to_number"]) {
+            recipients = append(recipients, smsRecipient{Number: number, Data: number})
+        }
     }
 
-    return string(resultJson), nil
+    seen := make(map[string]bool, len(recipients))
+    unique := recipients[:0]
+    for _, recipient := range recipients {
+        if !seen[recipient.Number] {
+            seen[recipient.Number] = true
+            unique = append(unique, recipient)
+        }
+    }
+    if len(unique) == 0 {
+        return nil, fmt.Errorf("no recipient: set to_number or recipients_from")
+    }
+    if max := getIntValue(config, "max_recipients", defaultMaxSMSRecipients); len(unique) > max {
+        return nil, fmt.Errorf("%d recipients exceed max_recipients of %d", len(unique), max)
+    }
+    return unique, nil
 }
 
-func (s *SendSMSActionService) CanHandle(actionService string) bool {
-    return actionService == SendSMSServiceName
+func smsRecipientNumber(item interface{}) string {
+    switch v := item.(type) {
+    case string:
+        return strings.TrimSpace(v)
+    case map[string]interface{}:
+        for _, key := range []string{"phone", "phone_number", "to", "number"} {
+            if number, ok := v[key].(string); ok && strings.TrimSpace(number) != "" {
+                return strings.TrimSpace(number)
+            }
+        }
+    }
+    return ""
 }
 
-type TwilioCredentials struct {
-    AccountSid  string
-    AuthToken   string
-    FromNumber  string
-    ToNumber    string
+// fillSMSTemplate fills {recipient} with the number and {recipient.name}
+// with the fields of the recipient item, then the step output placeholders.
+func fillSMSTemplate(template string, recipient smsRecipient, pipelineContext *pipeline_type.Context) string {
+    template = emailPlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+        segments := strings.Split(placeholder[1:len(placeholder)-1], ".")
+        if segments[0] != "recipient" {
+            return placeholder
+        }
+        if len(segments) == 1 {
+            return recipient.Number
+        }
+        value, ok := pipeline_type.WalkPath(recipient.Data, segments[1:])
+        if !ok || value == nil {
+            return ""
+        }
+        if text, ok := value.(string); ok {
+            return text
+        }
+        return fmt.Sprint(value)
+    })
+    return fillEmailTemplate(template, pipelineContext)
 }
 
-func extractTwilioCredentials(config map[string]interface{}) (*TwilioCredentials, error) {
-    credentials := &TwilioCredentials{}
-    var ok bool
+// twilioTestFromNumber is the number Twilio test credentials send from
+// successfully.
+const twilioTestFromNumber = "+15005550006"
 
-    if credentials.AccountSid, ok = config["account_sid"].(string); !ok {
-        return nil, fmt.Errorf("account_sid not found in config")
+// ExecuteSandbox sends the SMS with the Twilio test credentials of the
+// configuration (test_account_sid and test_auth_token): Twilio validates the
+// message but delivers nothing. Without them, or with another provider, the
+// SMS is simulated.
+func (s *SendSMSActionService) ExecuteSandbox(ctx context.Context, actionConfig string, pipelineContext *pipeline_type.Context, step *pipeline_type.PipelineStep) (string, error) {
+    if step.ActionDetails == nil || step.ActionDetails.Configuration == nil {
+        return "", fmt.Errorf("missing action configuration for SendSMSAction")
     }
-    if credentials.AuthToken, ok = config["auth_token"].(string); !ok {
-        return nil, fmt.Errorf("auth_token not found in config")
+    config := step.ActionDetails.Configuration
+    if getStringValue(config, "provider", SMSProviderTwilio) != SMSProviderTwilio {
+        return SimulatedResult(step)
     }
-    if credentials.FromNumber, ok = config["from_number"].(string); !ok {
-        return nil, fmt.Errorf("from_number not found in config")
+    testSid, _ := config["test_account_sid"].(string)
+    testToken, _ := config["test_auth_token"].(string)
+    if testSid == "" || testToken == "" {
+        return SimulatedResult(step)
     }
-    if credentials.ToNumber, ok = config["to_number"].(string); !ok {
-        return nil, fmt.Errorf("to_number not found in config")
+
+    testConfig := make(map[string]interface{}, len(config))
+    for key, value := range config {
+        testConfig[key] = value
     }
+    testConfig["account_sid"] = testSid
+    testConfig["auth_token"] = testToken
+    testConfig["from_number"] = twilioTestFromNumber
+
+    testStep := *step
+    testDetails := *step.ActionDetails
+    testDetails.Configuration = testConfig
+    testStep.ActionDetails = &testDetails
 
-    return credentials, nil
-}
\ No newline at end of file
+    result, err := s.Execute(ctx, actionConfig, pipelineContext, &testStep)
+    if err != nil {
+        return "", err
+    }
+    return markSandbox(result)
+}
@@ -0,0 +1,277 @@
+package action_service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+func TestSMSRecipients(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  map[string]interface{}
+		output  interface{}
+		want    []string
+		wantErr string
+	}{
+		{
+			name:   "to_number list deduplicated",
+			config: map[string]interface{}{"to_number": "+15550001, +15550002,+15550001"},
+			want:   []string{"+15550001", "+15550002"},
+		},
+		{
+			name:   "strings",
+			config: map[string]interface{}{"recipients_from": "contacts"},
+			output: `[" +15550001 ", "+15550002", ""]`,
+			want:   []string{"+15550001", "+15550002"},
+		},
+		{
+			name:   "objects",
+			config: map[string]interface{}{"recipients_from": "contacts.list"},
+			output: `{"list":[{"name":"Ann","phone":"+15550001"},{"name":"Bob","phone_number":"+15550002"},{"name":"Ann again","to":"+15550001"},{"name":"Nobody"}]}`,
+			want:   []string{"+15550001", "+15550002"},
+		},
+		{
+			name:   "comma separated text",
+			config: map[string]interface{}{"recipients_from": "contacts"},
+			output: "+15550001,+15550002",
+			want:   []string{"+15550001", "+15550002"},
+		},
+		{
+			name:    "over max_recipients",
+			config:  map[string]interface{}{"to_number": "+15550001,+15550002,+15550003", "max_recipients": 2},
+			wantErr: "3 recipients exceed max_recipients of 2",
+		},
+		{
+			name:    "no recipient",
+			config:  map[string]interface{}{"to_number": " "},
+			wantErr: "no recipient",
+		},
+		{
+			name:    "missing path",
+			config:  map[string]interface{}{"recipients_from": "missing"},
+			wantErr: "recipients_from path missing not found",
+		},
+		{
+			name:    "not a list",
+			config:  map[string]interface{}{"recipients_from": "contacts.count"},
+			output:  `{"count":2}`,
+			wantErr: "is not a list",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipelineContext := pipeline_type.NewContext()
+			if tt.output != nil {
+				pipelineContext.SetStepOutput("contacts", tt.output)
+			}
+			recipients, err := smsRecipients(tt.config, pipelineContext)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var numbers []string
+			for _, recipient := range recipients {
+				numbers = append(numbers, recipient.Number)
+			}
+			if !reflect.DeepEqual(numbers, tt.want) {
+				t.Errorf("got %v, want %v", numbers, tt.want)
+			}
+		})
+	}
+}
+
+func TestFillSMSTemplate(t *testing.T) {
+	pipelineContext := pipeline_type.NewContext()
+	pipelineContext.SetStepOutput("offer", " 20% off ")
+
+	tests := []struct {
+		name      string
+		template  string
+		recipient smsRecipient
+		want      string
+	}{
+		{
+			name:      "object fields",
+			template:  "Hi {recipient.name}, {offer} at {recipient.shop.city} for {recipient}",
+			recipient: smsRecipient{Number: "+15550001", Data: map[string]interface{}{"name": "Ann", "shop": map[string]interface{}{"city": "Dakar"}}},
+			want:      "Hi Ann, 20% off at Dakar for +15550001",
+		},
+		{
+			name:      "non-string and missing fields",
+			template:  "Points: {recipient.points}, tier: {recipient.tier}",
+			recipient: smsRecipient{Number: "+15550001", Data: map[string]interface{}{"points": float64(12)}},
+			want:      "Points: 12, tier: ",
+		},
+		{
+			name:      "string recipient",
+			template:  "Hi {recipient.name}, {unknown}",
+			recipient: smsRecipient{Number: "+15550001", Data: "+15550001"},
+			want:      "Hi , {unknown}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fillSMSTemplate(tt.template, tt.recipient, pipelineContext); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// executeSMS runs the action with its HTTP requests sent to handler, and
+// returns the decoded step output.
+func executeSMS(t *testing.T, config map[string]interface{}, pipelineContext *pipeline_type.Context, handler http.HandlerFunc) (map[string]interface{}, error) {
+	s := NewSendSMSActionService(slog.Default())
+	s.httpClient = redirectClient(t, handler)
+	step := &pipeline_type.PipelineStep{
+		ID:            "sms",
+		RequiredSteps: "message",
+		ActionDetails: &pipeline_type.ActionDetails{Configuration: config},
+	}
+	output, err := s.Execute(context.Background(), "", pipelineContext, step)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		t.Fatalf("invalid output %q: %v", output, err)
+	}
+	return result, nil
+}
+
+func TestSendSMSVonagePartialFailure(t *testing.T) {
+	pipelineContext := pipeline_type.NewContext()
+	pipelineContext.SetStepOutput("contacts", `[{"phone":"+15550001","name":"Ann"},{"phone":"+15550002","name":"Bob"},{"phone":"+15550003","name":""}]`)
+	config := map[string]interface{}{
+		"provider":         SMSProviderVonage,
+		"api_key":          "key",
+		"api_secret":       "secret",
+		"from_number":      "+15559999",
+		"recipients_from":  "contacts",
+		"message_template": "{recipient.name}",
+	}
+
+	var sent []url.Values
+	result, err := executeSMS(t, config, pipelineContext, func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "rest.nexmo.com" || r.URL.Path != "/sms/json" {
+			t.Errorf("unexpected request to %s%s", r.Host, r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(body))
+		sent = append(sent, form)
+		if form.Get("to") == "15550002" {
+			w.Write([]byte(`{"messages":[{"status":"3","error-text":"Invalid to number"}]}`))
+			return
+		}
+		w.Write([]byte(`{"messages":[{"status":"0","message-id":"m-` + form.Get("to") + `"},{"status":"0","message-id":"m-part2"}]}`))
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The empty message of the third recipient isn't sent
+	if len(sent) != 2 || sent[0].Get("from") != "15559999" || sent[0].Get("text") != "Ann" || sent[0].Get("api_key") != "key" {
+		t.Fatalf("unexpected requests %v", sent)
+	}
+	if result["sent"] != float64(1) || result["failed"] != float64(2) || result["provider"] != SMSProviderVonage {
+		t.Errorf("unexpected counts %v", result)
+	}
+	messages, _ := result["messages"].([]interface{})
+	if len(messages) != 3 {
+		t.Fatalf("expected an entry per recipient, got %v", result["messages"])
+	}
+	want := []map[string]interface{}{
+		{"to": "+15550001", "message": "Ann", "message_sid": "m-15550001", "status": "submitted"},
+		{"to": "+15550002", "message": "Bob", "status": "failed", "error": "vonage error 3: Invalid to number"},
+		{"to": "+15550003", "message": "", "status": "failed", "error": "message is empty"},
+	}
+	for i, entry := range messages {
+		if !reflect.DeepEqual(entry, map[string]interface{}(want[i])) {
+			t.Errorf("message %d: got %v, want %v", i, entry, want[i])
+		}
+	}
+}
+
+func TestSendSMSAllFailed(t *testing.T) {
+	config := map[string]interface{}{
+		"provider":    SMSProviderVonage,
+		"api_key":     "key",
+		"api_secret":  "secret",
+		"from_number": "+15559999",
+		"to_number":   "+15550001,+15550002",
+	}
+	pipelineContext := pipeline_type.NewContext()
+	pipelineContext.SetStepOutput("message", `{"message":"Hello"}`)
+	_, err := executeSMS(t, config, pipelineContext, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":"bad credentials"}`))
+	})
+	if err == nil || !strings.Contains(err.Error(), "failed to send SMS to any of 2 recipients") || !strings.Contains(err.Error(), "status 401") {
+		t.Errorf("expected the batch to fail, got %v", err)
+	}
+}
+
+func TestSendSMSMessageBird(t *testing.T) {
+	config := map[string]interface{}{
+		"provider":       SMSProviderMessageBird,
+		"api_key":        "access",
+		"from_number":    "Lesocle",
+		"to_number":      "+15550001",
+		"capture_status": 5,
+	}
+	pipelineContext := pipeline_type.NewContext()
+	pipelineContext.SetStepOutput("message", "```json\n{\"message\":\"Hello\"}\n```")
+
+	var payload map[string]interface{}
+	result, err := executeSMS(t, config, pipelineContext, func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "rest.messagebird.com" || r.Header.Get("Authorization") != "AccessKey access" {
+			t.Errorf("unexpected request to %s with %q", r.Host, r.Header.Get("Authorization"))
+		}
+		if r.Method == http.MethodPost {
+			json.NewDecoder(r.Body).Decode(&payload)
+			w.Write([]byte(`{"id":"mb1","recipients":{"items":[{"status":"sent"}]}}`))
+			return
+		}
+		if r.URL.Path != "/messages/mb1" {
+			t.Errorf("unexpected status request %s", r.URL.Path)
+		}
+		w.Write([]byte(`{"id":"mb1","recipients":{"items":[{"status":"delivered"}]}}`))
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if payload["originator"] != "Lesocle" || payload["body"] != "Hello" || !reflect.DeepEqual(payload["recipients"], []interface{}{"+15550001"}) {
+		t.Errorf("unexpected payload %v", payload)
+	}
+	// A single SMS keeps its fields at the top, with the status captured
+	if result["message_sid"] != "mb1" || result["status"] != "delivered" || result["message"] != "Hello" || result["sent"] != float64(1) {
+		t.Errorf("unexpected result %v", result)
+	}
+}
+
+func TestSMSFinalStatus(t *testing.T) {
+	for status, want := range map[string]bool{
+		"delivered": true, "Undelivered": true, "delivery_failed": true, "read": true,
+		"queued": false, "sent": false, "submitted": false, "": false,
+	} {
+		if got := smsFinalStatus(status); got != want {
+			t.Errorf("smsFinalStatus(%q) = %v, want %v", status, got, want)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package action_service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/twilio/twilio-go"
+	twilioApi "github.com/twilio/twilio-go/rest/api/v2010"
+)
+
+// SMS gateways.
+const (
+	SMSProviderTwilio      = "twilio"
+	SMSProviderVonage      = "vonage"
+	SMSProviderMessageBird = "messagebird"
+)
+
+const (
+	vonageAPIBaseURL      = "https://rest.nexmo.com"
+	messageBirdAPIBaseURL = "https://rest.messagebird.com"
+)
+
+// errSMSStatusUnsupported is returned by the gateways reporting delivery
+// only through callbacks.
+var errSMSStatusUnsupported = errors.New("delivery status not available from the provider")
+
+// SMSProvider sends text messages through an SMS gateway.
+type SMSProvider interface {
+	// Send sends a message and returns its ID and status at the gateway
+	Send(ctx context.Context, from, to, body string) (id, status string, err error)
+	// Status returns the delivery status of a message
+	Status(ctx context.Context, id string) (string, error)
+	// Validate checks the credentials without sending anything
+	Validate(ctx context.Context) error
+}
+
+// newSMSProvider returns the gateway of the configuration, Twilio by default.
+// The gateways called over plain HTTP use httpClient.
+func newSMSProvider(config map[string]interface{}, httpClient *http.Client) (SMSProvider, error) {
+	switch provider := getStringValue(config, "provider", SMSProviderTwilio); provider {
+	case SMSProviderTwilio:
+		accountSid := getStringValue(config, "account_sid", "")
+		authToken := getStringValue(config, "auth_token", "")
+		if accountSid == "" || authToken == "" {
+			return nil, fmt.Errorf("account_sid and auth_token not found in config")
+		}
+		return &twilioSMS{
+			accountSid: accountSid,
+			authToken:  authToken,
+			client: twilio.NewRestClientWithParams(twilio.ClientParams{
+				Username: accountSid,
+				Password: authToken,
+			}),
+		}, nil
+	case SMSProviderVonage:
+		apiKey := getStringValue(config, "api_key", "")
+		apiSecret := getStringValue(config, "api_secret", "")
+		if apiKey == "" || apiSecret == "" {
+			return nil, fmt.Errorf("api_key and api_secret not found in config")
+		}
+		return &vonageSMS{apiKey: apiKey, apiSecret: apiSecret, httpClient: httpClient}, nil
+	case SMSProviderMessageBird:
+		accessKey := getStringValue(config, "api_key", "")
+		if accessKey == "" {
+			return nil, fmt.Errorf("api_key not found in config")
+		}
+		return &messageBirdSMS{accessKey: accessKey, httpClient: httpClient}, nil
+	default:
+		return nil, fmt.Errorf("unknown SMS provider %q", provider)
+	}
+}
+
+// smsFinalStatus tells whether a delivery status will not change anymore.
+func smsFinalStatus(status string) bool {
+	switch strings.ToLower(status) {
+	case "delivered", "undelivered", "failed", "canceled", "expired", "delivery_failed", "rejected", "read":
+		return true
+	}
+	return false
+}
+
+type twilioSMS struct {
+	accountSid string
+	authToken  string
+	client     *twilio.RestClient
+}
+
+func (t *twilioSMS) Send(ctx context.Context, from, to, body string) (string, string, error) {
+	message, err := t.client.Api.CreateMessage(&twilioApi.CreateMessageParams{
+		To:   &to,
+		From: &from,
+		Body: &body,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	var id, status string
+	if message.Sid != nil {
+		id = *message.Sid
+	}
+	if message.Status != nil {
+		status = *message.Status
+	}
+	return id, status, nil
+}
+
+func (t *twilioSMS) Status(ctx context.Context, id string) (string, error) {
+	message, err := t.client.Api.FetchMessage(id, &twilioApi.FetchMessageParams{})
+	if err != nil {
+		return "", err
+	}
+	if message.Status == nil {
+		return "", nil
+	}
+	if message.ErrorMessage != nil && *message.ErrorMessage != "" {
+		return *message.Status + ": " + *message.ErrorMessage, nil
+	}
+	return *message.Status, nil
+}
+
+func (t *twilioSMS) Validate(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.twilio.com/2010-04-01/Accounts/"+url.PathEscape(t.accountSid)+".json", nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(t.accountSid, t.authToken)
+	return checkCredentialResponse(http.DefaultClient.Do(req))
+}
+
+// vonageSMS sends with the Vonage SMS API, which reports delivery through
+// receipts sent to a callback only.
+type vonageSMS struct {
+	apiKey     string
+	apiSecret  string
+	httpClient *http.Client
+}
+
+func (v *vonageSMS) Send(ctx context.Context, from, to, body string) (string, string, error) {
+	form := url.Values{
+		"api_key":    {v.apiKey},
+		"api_secret": {v.apiSecret},
+		"from":       {strings.TrimPrefix(from, "+")},
+		"to":         {strings.TrimPrefix(to, "+")},
+		"text":       {body},
+		"type":       {"unicode"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, vonageAPIBaseURL+"/sms/json", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var result struct {
+		Messages []struct {
+			Status    string `json:"status"`
+			MessageID string `json:"message-id"`
+			ErrorText string `json:"error-text"`
+		} `json:"messages"`
+	}
+	if err := doJSONRequest(v.httpClient, req, &result); err != nil {
+		return "", "", err
+	}
+	if len(result.Messages) == 0 {
+		return "", "", fmt.Errorf("vonage returned no message")
+	}
+	// A long text is sent as parts, the first one identifies it
+	for _, part := range result.Messages {
+		if part.Status != "0" {
+			return "", "", fmt.Errorf("vonage error %s: %s", part.Status, part.ErrorText)
+		}
+	}
+	return result.Messages[0].MessageID, "submitted", nil
+}
+
+func (v *vonageSMS) Status(ctx context.Context, id string) (string, error) {
+	return "", errSMSStatusUnsupported
+}
+
+func (v *vonageSMS) Validate(ctx context.Context) error {
+	params := url.Values{"api_key": {v.apiKey}, "api_secret": {v.apiSecret}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, vonageAPIBaseURL+"/account/get-balance?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	return checkCredentialResponse(v.httpClient.Do(req))
+}
+
+type messageBirdSMS struct {
+	accessKey  string
+	httpClient *http.Client
+}
+
+type messageBirdMessage struct {
+	ID         string `json:"id"`
+	Recipients struct {
+		Items []struct {
+			Status string `json:"status"`
+		} `json:"items"`
+	} `json:"recipients"`
+}
+
+func (m *messageBirdMessage) status() string {
+	if len(m.Recipients.Items) == 0 {
+		return ""
+	}
+	return m.Recipients.Items[0].Status
+}
+
+func (m *messageBirdSMS) Send(ctx context.Context, from, to, body string) (string, string, error) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"originator": from,
+		"recipients": []string{to},
+		"body":       body,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, messageBirdAPIBaseURL+"/messages", bytes.NewReader(payload))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "AccessKey "+m.accessKey)
+	var message messageBirdMessage
+	if err := doJSONRequest(m.httpClient, req, &message); err != nil {
+		return "", "", err
+	}
+	return message.ID, message.status(), nil
+}
+
+func (m *messageBirdSMS) Status(ctx context.Context, id string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, messageBirdAPIBaseURL+"/messages/"+url.PathEscape(id), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "AccessKey "+m.accessKey)
+	var message messageBirdMessage
+	if err := doJSONRequest(m.httpClient, req, &message); err != nil {
+		return "", err
+	}
+	return message.status(), nil
+}
+
+func (m *messageBirdSMS) Validate(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, messageBirdAPIBaseURL+"/balance", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "AccessKey "+m.accessKey)
+	return checkCredentialResponse(m.httpClient.Do(req))
+}
+
+// doJSONRequest sends a request and decodes its JSON answer.
+func doJSONRequest(client *http.Client, req *http.Request, result interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		// The URL may carry the credentials
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("error parsing response: %w", err)
+	}
+	return nil
+}
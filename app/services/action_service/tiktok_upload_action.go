@@ -0,0 +1,357 @@
+package action_service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
+	"github.com/serisow/lesocle/stream_upload"
+)
+
+const (
+	TikTokUploadServiceName = "tiktok_upload"
+	tiktokAPIBaseURL        = "https://open.tiktokapis.com/v2"
+	// tiktokMaxTitle is the caption limit of the content posting API
+	tiktokMaxTitle = 2200
+	// tiktokChunkSize is the size of the uploaded chunks, TikTok takes 5 to
+	// 64 MB and the last chunk holds the remainder, up to 128 MB. Smaller
+	// videos are uploaded whole.
+	tiktokChunkSize = 10 << 20
+)
+
+// TikTok posting modes: published on the profile, or sent to the TikTok
+// inbox of the creator to finish and post from the app.
+const (
+	TikTokDirectPost = "direct"
+	TikTokInbox      = "inbox"
+)
+
+var (
+	tiktokPollInterval      = 5 * time.Second
+	tiktokProcessingTimeout = 10 * time.Minute
+)
+
+type TikTokUploadActionService struct {
+	logger     *slog.Logger
+	httpClient *http.Client
+}
+
+func NewTikTokUploadActionService(logger *slog.Logger) *TikTokUploadActionService {
+	return &TikTokUploadActionService{
+		logger:     logger,
+		httpClient: &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// tiktokResponse is the envelope of the content posting API answers.
+type tiktokResponse struct {
+	Data  json.RawMessage `json:"data"`
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		LogID   string `json:"log_id"`
+	} `json:"error"`
+}
+
+// Execute posts the video of the required steps: a local file, such as the
+// vertical videos rendered with FFmpeg, is uploaded in chunks, a file known
+// by its URL only is pulled by TikTok from a verified domain. The other
+// steps give the caption, as text or the caption, title or text field of a
+// JSON object, possibly from the tiktok platform of a social media step.
+func (s *TikTokUploadActionService) Execute(ctx context.Context, actionConfig string, pipelineContext *pipeline_type.Context, step *pipeline_type.PipelineStep) (string, error) {
+	if step.ActionDetails == nil || step.ActionDetails.Configuration == nil {
+		return "", fmt.Errorf("missing action configuration for TikTokUploadAction")
+	}
+
+	config := step.ActionDetails.Configuration
+	accessToken, ok := config["access_token"].(string)
+	if !ok {
+		return "", fmt.Errorf("access_token not found in config")
+	}
+	mode := getStringValue(config, "mode", TikTokDirectPost)
+	if mode != TikTokDirectPost && mode != TikTokInbox {
+		return "", fmt.Errorf("unknown TikTok posting mode %q", mode)
+	}
+
+	video, caption, err := s.findTikTokContent(step, pipelineContext)
+	if err != nil {
+		return "", err
+	}
+	caption = applyDisclosure(caption, tiktokMaxTitle, step, pipelineContext)
+
+	sourceInfo := map[string]interface{}{}
+	var file *os.File
+	var size int64
+	if video.URI != "" {
+		if file, err = os.Open(video.URI); err == nil {
+			defer file.Close()
+		}
+	}
+	switch {
+	case file != nil:
+		stat, err := file.Stat()
+		if err != nil {
+			return "", fmt.Errorf("error reading video file: %w", err)
+		}
+		size = stat.Size()
+		chunkSize, chunkCount := tiktokChunks(size)
+		sourceInfo["source"] = "FILE_UPLOAD"
+		sourceInfo["video_size"] = size
+		sourceInfo["chunk_size"] = chunkSize
+		sourceInfo["total_chunk_count"] = chunkCount
+	case video.URL != "":
+		sourceInfo["source"] = "PULL_FROM_URL"
+		sourceInfo["video_url"] = video.URL
+	default:
+		return "", fmt.Errorf("video file %s is neither on this host nor has a URL", video.URI)
+	}
+
+	body := map[string]interface{}{"source_info": sourceInfo}
+	endpoint := "/post/publish/inbox/video/init/"
+	if mode == TikTokDirectPost {
+		endpoint = "/post/publish/video/init/"
+		privacyLevel, err := s.privacyLevel(ctx, accessToken, getStringValue(config, "privacy_level", "SELF_ONLY"))
+		if err != nil {
+			return "", err
+		}
+		postInfo := map[string]interface{}{
+			"title":           caption,
+			"privacy_level":   privacyLevel,
+			"disable_comment": getBoolValue(config, "disable_comment", false),
+			"disable_duet":    getBoolValue(config, "disable_duet", false),
+			"disable_stitch":  getBoolValue(config, "disable_stitch", false),
+			// Label the video as AI-generated content
+			"is_aigc": getBoolValue(config, "is_aigc", true),
+		}
+		if cover := getIntValue(config, "cover_timestamp_ms", -1); cover >= 0 {
+			postInfo["video_cover_timestamp_ms"] = cover
+		}
+		body["post_info"] = postInfo
+	}
+
+	var initData struct {
+		PublishID string `json:"publish_id"`
+		UploadURL string `json:"upload_url"`
+	}
+	if err := s.apiRequest(ctx, accessToken, endpoint, body, &initData); err != nil {
+		return "", fmt.Errorf("error initializing TikTok upload: %w", err)
+	}
+
+	if file != nil {
+		if err := s.uploadChunks(ctx, initData.UploadURL, file, size, video.MimeType); err != nil {
+			return "", err
+		}
+	}
+
+	status, postIDs, err := s.waitForPublish(ctx, accessToken, initData.PublishID, mode)
+	if err != nil {
+		return "", err
+	}
+
+	response := map[string]interface{}{
+		"publish_id": initData.PublishID,
+		"status":     status,
+		"mode":       mode,
+		"caption":    caption,
+		"source":     sourceInfo["source"],
+	}
+	if len(postIDs) > 0 {
+		response["post_ids"] = postIDs
+	}
+	resultJSON, err := json.Marshal(response)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling result: %w", err)
+	}
+	return string(resultJSON), nil
+}
+
+func (s *TikTokUploadActionService) CanHandle(actionService string) bool {
+	return actionService == TikTokUploadServiceName
+}
+
+// ValidateCredentials reads the creator info of the token.
+func (s *TikTokUploadActionService) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	accessToken, ok := config["access_token"].(string)
+	if !ok {
+		return fmt.Errorf("access_token not found in config")
+	}
+	var info json.RawMessage
+	return s.apiRequest(ctx, accessToken, "/post/publish/creator_info/query/", map[string]interface{}{}, &info)
+}
+
+// tiktokChunks returns the chunk size and count of a video: chunks of
+// tiktokChunkSize, the last one holding the remainder.
+func tiktokChunks(size int64) (int64, int64) {
+	if size <= tiktokChunkSize {
+		return size, 1
+	}
+	return tiktokChunkSize, size / tiktokChunkSize
+}
+
+// uploadChunks streams the video to the upload URL, chunk by chunk, resending
+// a chunk after a transient failure.
+func (s *TikTokUploadActionService) uploadChunks(ctx context.Context, uploadURL string, file *os.File, size int64, mimeType string) error {
+	if mimeType == "" {
+		mimeType = "video/mp4"
+	}
+	chunkSize, _ := tiktokChunks(size)
+	upload := &stream_upload.ResumableUpload{
+		Client:            s.httpClient,
+		SessionURL:        uploadURL,
+		ChunkSize:         chunkSize,
+		MergeLastChunk:    true,
+		ResendFailedChunk: true,
+		ContentType:       mimeType,
+		Progress:          stream_upload.LogProgress(ctx, file.Name()),
+	}
+	resp, err := upload.UploadFrom(ctx, file, size)
+	if err != nil {
+		return fmt.Errorf("error uploading the video to TikTok: %w", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return nil
+}
+
+// privacyLevel checks the privacy level is one the creator may post with.
+func (s *TikTokUploadActionService) privacyLevel(ctx context.Context, accessToken, configured string) (string, error) {
+	var info struct {
+		PrivacyLevelOptions []string `json:"privacy_level_options"`
+	}
+	if err := s.apiRequest(ctx, accessToken, "/post/publish/creator_info/query/", map[string]interface{}{}, &info); err != nil {
+		return "", fmt.Errorf("error reading TikTok creator info: %w", err)
+	}
+	for _, option := range info.PrivacyLevelOptions {
+		if option == configured {
+			return configured, nil
+		}
+	}
+	return "", fmt.Errorf("privacy level %s not available to the creator, options: %s", configured, strings.Join(info.PrivacyLevelOptions, ", "))
+}
+
+// waitForPublish polls the status of the post until TikTok published it or
+// sent it to the inbox.
+func (s *TikTokUploadActionService) waitForPublish(ctx context.Context, accessToken, publishID, mode string) (string, []interface{}, error) {
+	deadline := time.Now().Add(tiktokProcessingTimeout)
+	for {
+		var status struct {
+			Status     string        `json:"status"`
+			FailReason string        `json:"fail_reason"`
+			PostIDs    []interface{} `json:"publicaly_available_post_id"`
+		}
+		if err := s.apiRequest(ctx, accessToken, "/post/publish/status/fetch/", map[string]interface{}{"publish_id": publishID}, &status); err != nil {
+			return "", nil, fmt.Errorf("error reading TikTok publish status: %w", err)
+		}
+		switch status.Status {
+		case "PUBLISH_COMPLETE":
+			return status.Status, status.PostIDs, nil
+		case "SEND_TO_USER_INBOX":
+			if mode == TikTokInbox {
+				return status.Status, nil, nil
+			}
+		case "FAILED":
+			return "", nil, fmt.Errorf("tiktok could not post the video: %s", status.FailReason)
+		}
+		if time.Now().After(deadline) {
+			return "", nil, fmt.Errorf("tiktok still processing the video after %s, status %s", tiktokProcessingTimeout, status.Status)
+		}
+		select {
+		case <-ctx.Done():
+			return "", nil, ctx.Err()
+		case <-time.After(tiktokPollInterval):
+		}
+	}
+}
+
+// apiRequest posts the body to the content posting API and decodes the data
+// of the answer in result.
+func (s *TikTokUploadActionService) apiRequest(ctx context.Context, accessToken, endpoint string, body map[string]interface{}, result interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("error marshaling request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tiktokAPIBaseURL+endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error executing request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var answer tiktokResponse
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return fmt.Errorf("tiktok API error (HTTP %d)", resp.StatusCode)
+	}
+	if answer.Error.Code != "" && answer.Error.Code != "ok" {
+		return fmt.Errorf("tiktok API error: %s (Code: %s, Log ID: %s)", answer.Error.Message, answer.Error.Code, answer.Error.LogID)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("tiktok API error (HTTP %d)", resp.StatusCode)
+	}
+	if err := json.Unmarshal(answer.Data, result); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
+
+// findTikTokContent returns the video and the caption of the required steps.
+func (s *TikTokUploadActionService) findTikTokContent(step *pipeline_type.PipelineStep, pipelineContext *pipeline_type.Context) (*pipeline_type.FileInfo, string, error) {
+	var video *pipeline_type.FileInfo
+	var captions []string
+	for _, requiredStep := range strings.Split(step.RequiredSteps, "\r\n") {
+		requiredStep = strings.TrimSpace(requiredStep)
+		if requiredStep == "" {
+			continue
+		}
+
+		if files, err := pipelineContext.GetFileList(requiredStep); err == nil && describesMedia(files) {
+			for i := range files {
+				if video == nil && strings.HasPrefix(files[i].MimeType, "video/") {
+					video = &files[i]
+				}
+			}
+			continue
+		}
+
+		stepOutput, err := pipelineContext.GetString(requiredStep)
+		if err != nil {
+			return nil, "", fmt.Errorf("error reading TikTok content: %w", err)
+		}
+		var data map[string]interface{}
+		if err := json.Unmarshal([]byte(cleanJsonContent(stepOutput)), &data); err != nil {
+			captions = append(captions, strings.TrimSpace(stepOutput))
+			continue
+		}
+		// The tiktok platform of a social media step
+		if platforms, ok := data["platforms"].(map[string]interface{}); ok {
+			if tiktok, ok := platforms["tiktok"].(map[string]interface{}); ok {
+				data = tiktok
+			}
+		}
+		caption := getStringValue(data, "caption", getStringValue(data, "title", getStringValue(data, "text", "")))
+		if caption != "" {
+			captions = append(captions, caption)
+		}
+		if videoURL := getStringValue(data, "video_url", ""); videoURL != "" && video == nil {
+			video = &pipeline_type.FileInfo{URL: videoURL, MimeType: "video/mp4"}
+		}
+	}
+
+	if video == nil {
+		return nil, "", fmt.Errorf("no video to upload to TikTok")
+	}
+	return video, strings.Join(captions, "\n\n"), nil
+}
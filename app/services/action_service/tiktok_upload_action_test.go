@@ -0,0 +1,229 @@
+package action_service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+func TestTikTokChunks(t *testing.T) {
+	tests := []struct {
+		size      int64
+		chunkSize int64
+		count     int64
+	}{
+		{size: 1 << 20, chunkSize: 1 << 20, count: 1},
+		{size: tiktokChunkSize, chunkSize: tiktokChunkSize, count: 1},
+		{size: tiktokChunkSize + 1, chunkSize: tiktokChunkSize, count: 1},
+		{size: 2*tiktokChunkSize + 5, chunkSize: tiktokChunkSize, count: 2},
+		{size: 3 * tiktokChunkSize, chunkSize: tiktokChunkSize, count: 3},
+	}
+	for _, tt := range tests {
+		if chunkSize, count := tiktokChunks(tt.size); chunkSize != tt.chunkSize || count != tt.count {
+			t.Errorf("tiktokChunks(%d) = %d, %d, want %d, %d", tt.size, chunkSize, count, tt.chunkSize, tt.count)
+		}
+	}
+}
+
+// tiktokServer fakes the content posting API and the upload URL. The publish
+// status goes through the statuses in turn.
+type tiktokServer struct {
+	mu       sync.Mutex
+	privacy  []string
+	statuses []string
+	init     map[string]interface{}
+	initPath string
+	ranges   []string
+	uploaded int
+}
+
+func (f *tiktokServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Host == "open-upload.tiktokapis.com" {
+		data, _ := io.ReadAll(r.Body)
+		f.ranges = append(f.ranges, r.Header.Get("Content-Range"))
+		f.uploaded += len(data)
+		w.WriteHeader(http.StatusPartialContent)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":{"code":"access_token_invalid","message":"The access token is invalid","log_id":"log1"}}`))
+		return
+	}
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	var data interface{}
+	switch r.URL.Path {
+	case "/v2/post/publish/creator_info/query/":
+		data = map[string]interface{}{"privacy_level_options": f.privacy}
+	case "/v2/post/publish/video/init/", "/v2/post/publish/inbox/video/init/":
+		f.initPath, f.init = r.URL.Path, body
+		data = map[string]string{"publish_id": "pub1", "upload_url": "https://open-upload.tiktokapis.com/video/?upload_id=1"}
+	case "/v2/post/publish/status/fetch/":
+		status := f.statuses[0]
+		if len(f.statuses) > 1 {
+			f.statuses = f.statuses[1:]
+		}
+		data = map[string]interface{}{"status": status, "fail_reason": "frame_rate_check_failed", "publicaly_available_post_id": []int64{7001}}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data, "error": map[string]string{"code": "ok"}})
+}
+
+// executeTikTok runs the action on the outputs, with its requests sent to the
+// server, and returns the decoded step output.
+func executeTikTok(t *testing.T, config map[string]interface{}, outputs map[string]interface{}, server *tiktokServer) (map[string]interface{}, error) {
+	originalInterval := tiktokPollInterval
+	tiktokPollInterval = time.Millisecond
+	t.Cleanup(func() { tiktokPollInterval = originalInterval })
+
+	pipelineContext := pipeline_type.NewContext()
+	var required []string
+	for key, value := range outputs {
+		pipelineContext.SetStepOutput(key, value)
+		required = append(required, key)
+	}
+	s := NewTikTokUploadActionService(slog.Default())
+	s.httpClient = redirectClient(t, server)
+	config["access_token"] = "token"
+	step := &pipeline_type.PipelineStep{
+		ID:            "tiktok",
+		RequiredSteps: strings.Join(required, "\r\n"),
+		ActionDetails: &pipeline_type.ActionDetails{Configuration: config},
+	}
+	output, err := s.Execute(context.Background(), "", pipelineContext, step)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		t.Fatalf("invalid output %q: %v", output, err)
+	}
+	return result, nil
+}
+
+func TestTikTokDirectPostUploadsChunks(t *testing.T) {
+	size := 2*tiktokChunkSize + 5
+	video := writeMediaFile(t, "video.mp4", size)
+	server := &tiktokServer{
+		privacy:  []string{"PUBLIC_TO_EVERYONE", "SELF_ONLY"},
+		statuses: []string{"PROCESSING_UPLOAD", "PROCESSING_DOWNLOAD", "PUBLISH_COMPLETE"},
+	}
+	result, err := executeTikTok(t, map[string]interface{}{"privacy_level": "PUBLIC_TO_EVERYONE", "cover_timestamp_ms": 1500}, map[string]interface{}{
+		"video":   `[{"uri":"` + video + `","mime_type":"video/mp4"}]`,
+		"caption": "```json\n{\"platforms\":{\"tiktok\":{\"caption\":\"Watch this #ai\"}}}\n```",
+	}, server)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wantRanges := []string{"bytes 0-10485759/20971525", "bytes 10485760-20971524/20971525"}
+	if !reflect.DeepEqual(server.ranges, wantRanges) || server.uploaded != size {
+		t.Errorf("got ranges %v for %d bytes, want %v", server.ranges, server.uploaded, wantRanges)
+	}
+	source, _ := server.init["source_info"].(map[string]interface{})
+	post, _ := server.init["post_info"].(map[string]interface{})
+	if server.initPath != "/v2/post/publish/video/init/" || source["source"] != "FILE_UPLOAD" ||
+		source["total_chunk_count"] != float64(2) || source["chunk_size"] != float64(tiktokChunkSize) {
+		t.Errorf("unexpected init %s %v", server.initPath, server.init)
+	}
+	if post["title"] != "Watch this #ai" || post["privacy_level"] != "PUBLIC_TO_EVERYONE" || post["is_aigc"] != true || post["video_cover_timestamp_ms"] != float64(1500) {
+		t.Errorf("unexpected post info %v", post)
+	}
+	if result["status"] != "PUBLISH_COMPLETE" || result["publish_id"] != "pub1" || !reflect.DeepEqual(result["post_ids"], []interface{}{float64(7001)}) {
+		t.Errorf("unexpected result %v", result)
+	}
+}
+
+func TestTikTokInboxPullFromURL(t *testing.T) {
+	server := &tiktokServer{statuses: []string{"PROCESSING_DOWNLOAD", "SEND_TO_USER_INBOX"}}
+	result, err := executeTikTok(t, map[string]interface{}{"mode": TikTokInbox}, map[string]interface{}{
+		"post": `{"text":"Draft caption","video_url":"https://media.example.com/video.mp4"}`,
+	}, server)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	source, _ := server.init["source_info"].(map[string]interface{})
+	if server.initPath != "/v2/post/publish/inbox/video/init/" || source["source"] != "PULL_FROM_URL" ||
+		source["video_url"] != "https://media.example.com/video.mp4" || server.init["post_info"] != nil {
+		t.Errorf("unexpected init %s %v", server.initPath, server.init)
+	}
+	if len(server.ranges) != 0 {
+		t.Errorf("expected nothing uploaded, got %v", server.ranges)
+	}
+	if result["status"] != "SEND_TO_USER_INBOX" || result["source"] != "PULL_FROM_URL" || result["caption"] != "Draft caption" {
+		t.Errorf("unexpected result %v", result)
+	}
+}
+
+func TestTikTokErrors(t *testing.T) {
+	video := writeMediaFile(t, "video.mp4", 100)
+	videoOutput := `[{"uri":"` + video + `","mime_type":"video/mp4"}]`
+
+	tests := []struct {
+		name    string
+		config  map[string]interface{}
+		outputs map[string]interface{}
+		server  *tiktokServer
+		wantErr string
+	}{
+		{
+			name:    "privacy level not available",
+			config:  map[string]interface{}{"privacy_level": "PUBLIC_TO_EVERYONE"},
+			outputs: map[string]interface{}{"video": videoOutput},
+			server:  &tiktokServer{privacy: []string{"SELF_ONLY"}},
+			wantErr: "privacy level PUBLIC_TO_EVERYONE not available to the creator, options: SELF_ONLY",
+		},
+		{
+			name:    "publish failed",
+			config:  map[string]interface{}{},
+			outputs: map[string]interface{}{"video": videoOutput},
+			server:  &tiktokServer{privacy: []string{"SELF_ONLY"}, statuses: []string{"PROCESSING_UPLOAD", "FAILED"}},
+			wantErr: "tiktok could not post the video: frame_rate_check_failed",
+		},
+		{
+			name:    "no video",
+			config:  map[string]interface{}{},
+			outputs: map[string]interface{}{"caption": "Only text"},
+			server:  &tiktokServer{},
+			wantErr: "no video to upload to TikTok",
+		},
+		{
+			name:    "unknown mode",
+			config:  map[string]interface{}{"mode": "draft"},
+			outputs: map[string]interface{}{"video": videoOutput},
+			server:  &tiktokServer{},
+			wantErr: `unknown TikTok posting mode "draft"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := executeTikTok(t, tt.config, tt.outputs, tt.server)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestTikTokAPIError(t *testing.T) {
+	s := NewTikTokUploadActionService(slog.Default())
+	s.httpClient = redirectClient(t, &tiktokServer{})
+
+	var info json.RawMessage
+	err := s.apiRequest(context.Background(), "expired", "/post/publish/creator_info/query/", map[string]interface{}{}, &info)
+	if err == nil || err.Error() != "tiktok API error: The access token is invalid (Code: access_token_invalid, Log ID: log1)" {
+		t.Errorf("expected the API error, got %v", err)
+	}
+}
@@ -43,21 +43,13 @@ func (s *TweetDataEnricherService) Execute(ctx context.Context, actionConfig str
 	var tweetSearchData, crisisAnalysis map[string]interface{}
 
 	// Get tweet search content
-	tweetContent, ok := pipelineContext.StepOutputs["tweeter_search_content"].(string)
-	if !ok {
-		return "", fmt.Errorf("tweet search content not found in context")
-	}
-	if err := json.Unmarshal([]byte(tweetContent), &tweetSearchData); err != nil {
-		return "", fmt.Errorf("error parsing tweet search data: %w", err)
+	if err := pipelineContext.GetJSON("tweeter_search_content", &tweetSearchData); err != nil {
+		return "", fmt.Errorf("error reading tweet search data: %w", err)
 	}
 
 	// Get analysis result
-	analysisContent, ok := pipelineContext.StepOutputs["analysis_result"].(string)
-	if !ok {
-		return "", fmt.Errorf("analysis result not found in context")
-	}
-	if err := json.Unmarshal([]byte(analysisContent), &crisisAnalysis); err != nil {
-		return "", fmt.Errorf("error parsing crisis analysis data: %w", err)
+	if err := pipelineContext.GetJSON("analysis_result", &crisisAnalysis); err != nil {
+		return "", fmt.Errorf("error reading crisis analysis data: %w", err)
 	}
 
 	// Create high priority tweets lookup
@@ -184,4 +176,8 @@ func extractEnricherConfig(config map[string]interface{}) (*EnricherConfig, erro
 	}
 
 	return ec, nil
-}
\ No newline at end of file
+}
+// ExecuteSandbox runs the action for real, it only combines outputs of the context.
+func (s *TweetDataEnricherService) ExecuteSandbox(ctx context.Context, actionConfig string, pipelineContext *pipeline_type.Context, step *pipeline_type.PipelineStep) (string, error) {
+	return s.Execute(ctx, actionConfig, pipelineContext, step)
+}
@@ -0,0 +1,328 @@
+package action_service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+const (
+	twitterMediaUploadURL   = "https://upload.twitter.com/1.1/media/upload.json"
+	twitterMediaMetadataURL = "https://upload.twitter.com/1.1/media/metadata/create.json"
+	// twitterMediaChunkSize stays under the 5 MB limit of an APPEND
+	twitterMediaChunkSize = 4 << 20
+	// maxTweetImages is how many images a tweet carries, a video or GIF
+	// comes alone
+	maxTweetImages = 4
+	// twitterMediaTimeout bounds the processing of an uploaded video
+	twitterMediaTimeout = 10 * time.Minute
+)
+
+// twitterMediaCheckInterval is the wait between status checks of a media
+// when Twitter doesn't say how long to wait.
+var twitterMediaCheckInterval = 5 * time.Second
+
+// twitterMediaLimits are the largest files of each media category.
+var twitterMediaLimits = map[string]int64{
+	"tweet_image": 5 << 20,
+	"tweet_gif":   15 << 20,
+	"tweet_video": 512 << 20,
+}
+
+// tweetMedia picks the media a tweet can carry: the first video or GIF, or
+// else up to four images.
+func tweetMedia(files []pipeline_type.FileInfo) []pipeline_type.FileInfo {
+	var images []pipeline_type.FileInfo
+	for _, file := range files {
+		if category := twitterMediaCategory(file.MimeType); category != "tweet_image" {
+			return []pipeline_type.FileInfo{file}
+		}
+		if len(images) < maxTweetImages {
+			images = append(images, file)
+		}
+	}
+	return images
+}
+
+func twitterMediaCategory(mimeType string) string {
+	switch {
+	case mimeType == "image/gif":
+		return "tweet_gif"
+	case strings.HasPrefix(mimeType, "video/"):
+		return "tweet_video"
+	default:
+		return "tweet_image"
+	}
+}
+
+// uploadTweetMedia uploads a file with the chunked media upload, waits for
+// videos to be processed and returns the media ID.
+func (s *PostTweetActionService) uploadTweetMedia(ctx context.Context, httpClient *http.Client, file pipeline_type.FileInfo, altText string) (string, error) {
+	content, size, cleanup, err := openTweetMedia(ctx, file)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	category := twitterMediaCategory(file.MimeType)
+	if size > twitterMediaLimits[category] {
+		return "", fmt.Errorf("%s is %d MB, over the %d MB limit of Twitter", attachmentName(file), size>>20, twitterMediaLimits[category]>>20)
+	}
+
+	var initialized struct {
+		MediaID string `json:"media_id_string"`
+	}
+	err = s.mediaRequest(ctx, httpClient, http.MethodPost, url.Values{
+		"command":        {"INIT"},
+		"total_bytes":    {strconv.FormatInt(size, 10)},
+		"media_type":     {file.MimeType},
+		"media_category": {category},
+	}, &initialized)
+	if err != nil {
+		return "", fmt.Errorf("error initializing media upload: %w", err)
+	}
+	mediaID := initialized.MediaID
+
+	buffer := make([]byte, twitterMediaChunkSize)
+	for segment := 0; ; segment++ {
+		n, err := io.ReadFull(content, buffer)
+		if n > 0 {
+			if err := s.appendMedia(ctx, httpClient, mediaID, segment, buffer[:n]); err != nil {
+				return "", fmt.Errorf("error uploading media chunk %d: %w", segment, err)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("error reading media: %w", err)
+		}
+	}
+
+	var status twitterMediaStatus
+	if err := s.mediaRequest(ctx, httpClient, http.MethodPost, url.Values{"command": {"FINALIZE"}, "media_id": {mediaID}}, &status); err != nil {
+		return "", fmt.Errorf("error finalizing media upload: %w", err)
+	}
+	if err := s.waitForMedia(ctx, httpClient, mediaID, status.ProcessingInfo); err != nil {
+		return "", err
+	}
+
+	if altText != "" && category != "tweet_video" {
+		if err := s.setMediaAltText(ctx, httpClient, mediaID, altText); err != nil {
+			// The tweet is still worth posting without it
+			s.logger.WarnContext(ctx, "Failed to set media alt text",
+				slog.String("media_id", mediaID),
+				slog.String("error", err.Error()))
+		}
+	}
+
+	s.logger.InfoContext(ctx, "Uploaded tweet media",
+		slog.String("media_id", mediaID),
+		slog.String("category", category),
+		slog.Int64("size", size))
+	return mediaID, nil
+}
+
+type twitterMediaStatus struct {
+	ProcessingInfo *twitterProcessingInfo `json:"processing_info"`
+}
+
+type twitterProcessingInfo struct {
+	State          string `json:"state"`
+	CheckAfterSecs int    `json:"check_after_secs"`
+	Error          *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// waitForMedia polls the processing of a media until it succeeds, as Twitter
+// asks for videos and GIFs. Images come without processing info.
+func (s *PostTweetActionService) waitForMedia(ctx context.Context, httpClient *http.Client, mediaID string, info *twitterProcessingInfo) error {
+	ctx, cancel := context.WithTimeout(ctx, twitterMediaTimeout)
+	defer cancel()
+
+	status := twitterMediaStatus{ProcessingInfo: info}
+	for status.ProcessingInfo != nil {
+		switch status.ProcessingInfo.State {
+		case "succeeded":
+			return nil
+		case "failed":
+			message := "unknown error"
+			if status.ProcessingInfo.Error != nil {
+				message = status.ProcessingInfo.Error.Message
+			}
+			return fmt.Errorf("twitter failed to process media %s: %s", mediaID, message)
+		}
+
+		wait := time.Duration(status.ProcessingInfo.CheckAfterSecs) * time.Second
+		if wait <= 0 {
+			wait = twitterMediaCheckInterval
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("media %s still processing: %w", mediaID, ctx.Err())
+		case <-time.After(wait):
+		}
+
+		status = twitterMediaStatus{}
+		if err := s.mediaRequest(ctx, httpClient, http.MethodGet, url.Values{"command": {"STATUS"}, "media_id": {mediaID}}, &status); err != nil {
+			return fmt.Errorf("error checking media status: %w", err)
+		}
+	}
+	return nil
+}
+
+// appendMedia uploads a chunk of a media.
+func (s *PostTweetActionService) appendMedia(ctx context.Context, httpClient *http.Client, mediaID string, segment int, chunk []byte) error {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("command", "APPEND")
+	writer.WriteField("media_id", mediaID)
+	writer.WriteField("segment_index", strconv.Itoa(segment))
+	part, err := writer.CreateFormFile("media", "chunk")
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(chunk); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, twitterMediaUploadURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+func (s *PostTweetActionService) setMediaAltText(ctx context.Context, httpClient *http.Client, mediaID, altText string) error {
+	if runes := []rune(altText); len(runes) > 1000 {
+		altText = string(runes[:1000])
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"media_id": mediaID,
+		"alt_text": map[string]string{"text": altText},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, twitterMediaMetadataURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// mediaRequest sends a command of the media upload, form encoded so the
+// OAuth signature covers its parameters, and decodes the answer.
+func (s *PostTweetActionService) mediaRequest(ctx context.Context, httpClient *http.Client, method string, params url.Values, result interface{}) error {
+	var req *http.Request
+	var err error
+	if method == http.MethodGet {
+		req, err = http.NewRequestWithContext(ctx, method, twitterMediaUploadURL+"?"+params.Encode(), nil)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, method, twitterMediaUploadURL, strings.NewReader(params.Encode()))
+		if req != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	return json.Unmarshal(body, result)
+}
+
+// openTweetMedia opens the local file, or downloads it from its URL to a
+// temporary file, as the upload needs its size first.
+func openTweetMedia(ctx context.Context, file pipeline_type.FileInfo) (io.Reader, int64, func(), error) {
+	if f, err := os.Open(file.URI); err == nil {
+		stat, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, 0, nil, fmt.Errorf("error reading media file: %w", err)
+		}
+		return f, stat.Size(), func() { f.Close() }, nil
+	}
+	if file.URL == "" {
+		return nil, 0, nil, fmt.Errorf("media %s is not on this host and has no URL", file.URI)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, file.URL, nil)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("error downloading media: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, nil, fmt.Errorf("error downloading media: status %d", resp.StatusCode)
+	}
+	tmp, err := os.CreateTemp("", ".tweet-media-*")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+	size, err := io.Copy(tmp, io.LimitReader(resp.Body, twitterMediaLimits["tweet_video"]+1))
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		cleanup()
+		return nil, 0, nil, fmt.Errorf("error downloading media: %w", err)
+	}
+	return tmp, size, cleanup, nil
+}
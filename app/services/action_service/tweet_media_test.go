@@ -0,0 +1,225 @@
+package action_service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+func TestTweetMedia(t *testing.T) {
+	image := func(name string) pipeline_type.FileInfo {
+		return pipeline_type.FileInfo{URI: name, MimeType: "image/png"}
+	}
+	video := pipeline_type.FileInfo{URI: "clip.mp4", MimeType: "video/mp4"}
+	gif := pipeline_type.FileInfo{URI: "loop.gif", MimeType: "image/gif"}
+
+	tests := []struct {
+		name  string
+		files []pipeline_type.FileInfo
+		want  []string
+	}{
+		{name: "no file", files: nil, want: nil},
+		{name: "images", files: []pipeline_type.FileInfo{image("a"), image("b")}, want: []string{"a", "b"}},
+		{name: "up to four images", files: []pipeline_type.FileInfo{image("a"), image("b"), image("c"), image("d"), image("e")}, want: []string{"a", "b", "c", "d"}},
+		{name: "video alone", files: []pipeline_type.FileInfo{image("a"), video, image("b")}, want: []string{"clip.mp4"}},
+		{name: "GIF alone", files: []pipeline_type.FileInfo{gif, video}, want: []string{"loop.gif"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, file := range tweetMedia(tt.files) {
+				got = append(got, file.URI)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// twitterUploadServer records the media upload commands, answering STATUS
+// with the processing states in turn.
+type twitterUploadServer struct {
+	mu       sync.Mutex
+	commands []string
+	segments map[string]int
+	init     map[string]string
+	altText  string
+	states   []string
+}
+
+func (u *twitterUploadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if r.Host != "upload.twitter.com" {
+		http.Error(w, "unexpected host "+r.Host, http.StatusBadGateway)
+		return
+	}
+	if r.URL.Path == "/1.1/media/metadata/create.json" {
+		var payload struct {
+			AltText struct {
+				Text string `json:"text"`
+			} `json:"alt_text"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		u.altText = payload.AltText.Text
+		return
+	}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		r.ParseMultipartForm(8 << 20)
+		file, _, _ := r.FormFile("media")
+		data, _ := io.ReadAll(file)
+		u.commands = append(u.commands, r.FormValue("command"))
+		u.segments[r.FormValue("segment_index")] = len(data)
+		return
+	}
+	r.ParseForm()
+	command := r.Form.Get("command")
+	u.commands = append(u.commands, command)
+	switch command {
+	case "INIT":
+		u.init = map[string]string{"total_bytes": r.Form.Get("total_bytes"), "media_category": r.Form.Get("media_category")}
+		w.Write([]byte(`{"media_id_string":"m1"}`))
+	case "FINALIZE", "STATUS":
+		if len(u.states) == 0 {
+			w.Write([]byte(`{"media_id_string":"m1"}`))
+			return
+		}
+		state := u.states[0]
+		u.states = u.states[1:]
+		if state == "failed" {
+			w.Write([]byte(`{"processing_info":{"state":"failed","error":{"message":"InvalidMedia"}}}`))
+			return
+		}
+		w.Write([]byte(`{"processing_info":{"state":"` + state + `"}}`))
+	}
+}
+
+func writeMediaFile(t *testing.T, name string, size int) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, bytes.Repeat([]byte("x"), size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestUploadTweetMediaChunks(t *testing.T) {
+	original := twitterMediaCheckInterval
+	twitterMediaCheckInterval = time.Millisecond
+	defer func() { twitterMediaCheckInterval = original }()
+
+	size := 2*twitterMediaChunkSize + 100
+	file := pipeline_type.FileInfo{URI: writeMediaFile(t, "clip.mp4", size), MimeType: "video/mp4"}
+	upload := &twitterUploadServer{segments: map[string]int{}, states: []string{"pending", "in_progress", "succeeded"}}
+
+	s := NewPostTweetActionService(slog.Default())
+	mediaID, err := s.uploadTweetMedia(context.Background(), redirectClient(t, upload), file, "A clip")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mediaID != "m1" {
+		t.Errorf("unexpected media ID %q", mediaID)
+	}
+	wantCommands := []string{"INIT", "APPEND", "APPEND", "APPEND", "FINALIZE", "STATUS", "STATUS"}
+	if !reflect.DeepEqual(upload.commands, wantCommands) {
+		t.Errorf("got commands %v, want %v", upload.commands, wantCommands)
+	}
+	wantSegments := map[string]int{"0": twitterMediaChunkSize, "1": twitterMediaChunkSize, "2": 100}
+	if !reflect.DeepEqual(upload.segments, wantSegments) {
+		t.Errorf("got segments %v, want %v", upload.segments, wantSegments)
+	}
+	if upload.init["media_category"] != "tweet_video" || upload.init["total_bytes"] != "8388708" {
+		t.Errorf("unexpected INIT %v", upload.init)
+	}
+	// Videos take no alt text
+	if upload.altText != "" {
+		t.Errorf("unexpected alt text %q", upload.altText)
+	}
+}
+
+func TestUploadTweetImage(t *testing.T) {
+	file := pipeline_type.FileInfo{URI: writeMediaFile(t, "photo.png", 1000), MimeType: "image/png"}
+	upload := &twitterUploadServer{segments: map[string]int{}}
+
+	s := NewPostTweetActionService(slog.Default())
+	if _, err := s.uploadTweetMedia(context.Background(), redirectClient(t, upload), file, "A photo"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(upload.commands, []string{"INIT", "APPEND", "FINALIZE"}) || upload.altText != "A photo" {
+		t.Errorf("unexpected upload %v with alt text %q", upload.commands, upload.altText)
+	}
+}
+
+func TestUploadTweetMediaOverLimit(t *testing.T) {
+	file := pipeline_type.FileInfo{URI: writeMediaFile(t, "photo.png", 5<<20+1), MimeType: "image/png", Filename: "photo.png"}
+	upload := &twitterUploadServer{segments: map[string]int{}}
+
+	s := NewPostTweetActionService(slog.Default())
+	_, err := s.uploadTweetMedia(context.Background(), redirectClient(t, upload), file, "")
+	if err == nil || !strings.Contains(err.Error(), "photo.png is 5 MB, over the 5 MB limit") || len(upload.commands) != 0 {
+		t.Errorf("expected the file refused before the upload, got %v after %v", err, upload.commands)
+	}
+}
+
+func TestWaitForMedia(t *testing.T) {
+	original := twitterMediaCheckInterval
+	twitterMediaCheckInterval = time.Millisecond
+	defer func() { twitterMediaCheckInterval = original }()
+
+	tests := []struct {
+		name    string
+		info    *twitterProcessingInfo
+		states  []string
+		timeout time.Duration
+		checks  int
+		wantErr string
+	}{
+		{name: "no processing", info: nil},
+		{name: "already succeeded", info: &twitterProcessingInfo{State: "succeeded"}},
+		{name: "succeeds after checks", info: &twitterProcessingInfo{State: "pending"}, states: []string{"in_progress", "succeeded"}, checks: 2},
+		{name: "fails", info: &twitterProcessingInfo{State: "in_progress"}, states: []string{"failed"}, checks: 1, wantErr: "twitter failed to process media m1: InvalidMedia"},
+		{name: "still processing", info: &twitterProcessingInfo{State: "in_progress"}, states: []string{"in_progress", "in_progress", "in_progress"}, timeout: 10 * time.Millisecond, wantErr: "media m1 still processing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.timeout > 0 {
+				// Checks answer slower than the timeout
+				twitterMediaCheckInterval = 20 * time.Millisecond
+				defer func() { twitterMediaCheckInterval = time.Millisecond }()
+			}
+			upload := &twitterUploadServer{segments: map[string]int{}, states: tt.states}
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			s := NewPostTweetActionService(slog.Default())
+			err := s.waitForMedia(ctx, redirectClient(t, upload), "m1", tt.info)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.timeout == 0 && len(upload.commands) != tt.checks {
+				t.Errorf("expected %d status checks, got %v", tt.checks, upload.commands)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package action_service
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// tweetURLLength is the weight of any URL, shortened to t.co links
+	tweetURLLength = 23
+	// defaultMaxThreadLength bounds the tweets of a thread
+	defaultMaxThreadLength = 25
+)
+
+var (
+	tweetURL    = regexp.MustCompile(`https?://[^\s]*[^\s.,!?;:)\]"']`)
+	threadToken = regexp.MustCompile(`\s+|\S+`)
+)
+
+// tweetLength is the length of a text as Twitter counts it: URLs weigh 23,
+// the characters of Latin and common punctuation ranges 1, and the others,
+// such as CJK or emoji, 2. Emoji sequences are counted per code point, which
+// only overestimates them.
+func tweetLength(text string) int {
+	length := 0
+	text = tweetURL.ReplaceAllStringFunc(text, func(string) string {
+		length += tweetURLLength
+		return ""
+	})
+	for _, r := range text {
+		switch {
+		case r <= 0x10FF, r >= 0x2000 && r <= 0x200D, r >= 0x2010 && r <= 0x201F, r >= 0x2032 && r <= 0x2037:
+			length++
+		default:
+			length += 2
+		}
+	}
+	return length
+}
+
+// threadWord is a word of a thread with the whitespace before it, reduced to
+// a space, a line break or a paragraph break.
+type threadWord struct {
+	sep  string
+	text string
+}
+
+func threadWords(text string) []threadWord {
+	var words []threadWord
+	sep := ""
+	for _, token := range threadToken.FindAllString(text, -1) {
+		if strings.TrimSpace(token) == "" {
+			switch strings.Count(token, "\n") {
+			case 0:
+				sep = " "
+			case 1:
+				sep = "\n"
+			default:
+				sep = "\n\n"
+			}
+			continue
+		}
+		words = append(words, threadWord{sep: sep, text: token})
+		sep = ""
+	}
+	return words
+}
+
+func renderWords(words []threadWord) string {
+	var b strings.Builder
+	for i, word := range words {
+		if i > 0 {
+			b.WriteString(word.sep)
+		}
+		b.WriteString(word.text)
+	}
+	return b.String()
+}
+
+// splitThread packs the words of a text into tweets of at most budget,
+// breaking after a sentence or a line when that keeps the tweet half full.
+func splitThread(text string, budget int) []string {
+	var tweets []string
+	var current []threadWord
+	for _, word := range threadWords(text) {
+		for _, piece := range fitWord(word, budget) {
+			for {
+				candidate := append(append([]threadWord(nil), current...), piece)
+				if len(current) == 0 || tweetLength(renderWords(candidate)) <= budget {
+					current = candidate
+					break
+				}
+				cut := threadBreak(current, budget)
+				tweets = append(tweets, renderWords(current[:cut]))
+				current = current[cut:]
+			}
+		}
+	}
+	if len(current) > 0 {
+		tweets = append(tweets, renderWords(current))
+	}
+	return tweets
+}
+
+// threadBreak returns where to end the tweet of the words: after the last
+// sentence or line keeping it at least half full, or after all of them.
+func threadBreak(words []threadWord, budget int) int {
+	for i := len(words) - 1; i > 0; i-- {
+		if tweetLength(renderWords(words[:i])) < budget/2 {
+			break
+		}
+		if strings.Contains(words[i].sep, "\n") || endsSentence(words[i-1].text) {
+			return i
+		}
+	}
+	return len(words)
+}
+
+func endsSentence(word string) bool {
+	word = strings.TrimRight(word, `"')]»”’`)
+	return strings.HasSuffix(word, ".") || strings.HasSuffix(word, "!") ||
+		strings.HasSuffix(word, "?") || strings.HasSuffix(word, "…")
+}
+
+// fitWord cuts a word longer than a tweet into pieces that fit.
+func fitWord(word threadWord, budget int) []threadWord {
+	if tweetLength(word.text) <= budget {
+		return []threadWord{word}
+	}
+	var pieces []threadWord
+	var current []rune
+	for _, r := range word.text {
+		if len(current) > 0 && tweetLength(string(append(current, r))) > budget {
+			pieces = append(pieces, threadWord{sep: word.sep, text: string(current)})
+			word.sep = " "
+			current = nil
+		}
+		current = append(current, r)
+	}
+	return append(pieces, threadWord{sep: word.sep, text: string(current)})
+}
+
+// buildThread splits the parts of a thread into tweets of at most limit,
+// numbered " 1/3" when numbered, the numbers taking room from the text.
+func buildThread(parts []string, limit, maxTweets int, numbered bool) ([]string, error) {
+	for digits := 1; ; digits++ {
+		budget := limit
+		if numbered {
+			budget -= len(" /") + 2*digits
+		}
+		var tweets []string
+		for _, part := range parts {
+			tweets = append(tweets, splitThread(strings.TrimSpace(part), budget)...)
+		}
+		if len(tweets) == 0 {
+			return nil, fmt.Errorf("tweet content is empty")
+		}
+		if numbered && len(strconv.Itoa(len(tweets))) > digits {
+			continue
+		}
+		if len(tweets) > maxTweets {
+			return nil, fmt.Errorf("thread of %d tweets exceeds the maximum of %d", len(tweets), maxTweets)
+		}
+		if numbered && len(tweets) > 1 {
+			for i := range tweets {
+				tweets[i] = fmt.Sprintf("%s %d/%d", tweets[i], i+1, len(tweets))
+			}
+		}
+		return tweets, nil
+	}
+}
@@ -0,0 +1,116 @@
+package action_service
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTweetLength(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"hello", 5},
+		{"https://example.com/a/very/long/path/that/twitter/shortens/anyway", tweetURLLength},
+		// The final period isn't part of the link
+		{"see https://example.com.", 4 + tweetURLLength + 1},
+		{"café — “quoted”", 15},
+		{"日本語", 6},
+		{"ok 👍", 5},
+	}
+	for _, tt := range tests {
+		if got := tweetLength(tt.text); got != tt.want {
+			t.Errorf("tweetLength(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+// words returns n distinct words of five characters.
+func words(n int) string {
+	list := make([]string, n)
+	for i := range list {
+		list[i] = fmt.Sprintf("w%04d", i)
+	}
+	return strings.Join(list, " ")
+}
+
+func TestSplitThread(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		budget int
+		want   []string
+	}{
+		{"fits", "one two three", 20, []string{"one two three"}},
+		{"breaks between words", "one two three four", 9, []string{"one two", "three", "four"}},
+		{"breaks after a sentence", "First one is here. Then a second", 25, []string{"First one is here.", "Then a second"}},
+		// Unless the tweet would be less than half full
+		{"keeps a short sentence going", "First one. Then a second sentence", 25, []string{"First one. Then a second", "sentence"}},
+		{"breaks at a paragraph", "Intro words here\n\nSecond paragraph", 25, []string{"Intro words here", "Second paragraph"}},
+		{"cuts a word longer than a tweet", "abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+	}
+	for _, tt := range tests {
+		got := splitThread(tt.text, tt.budget)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+		for _, tweet := range got {
+			if tweetLength(tweet) > tt.budget {
+				t.Errorf("%s: %q exceeds %d", tt.name, tweet, tt.budget)
+			}
+		}
+	}
+}
+
+func TestBuildThread(t *testing.T) {
+	// 46 words of 5 characters and their spaces weigh 275, 279 with "end"
+	nearlyFull := words(46) + " end"
+	link := "https://example.com/" + strings.Repeat("x", 200)
+
+	tests := []struct {
+		name      string
+		parts     []string
+		maxTweets int
+		numbered  bool
+		count     int
+		err       string
+	}{
+		{"single tweet isn't numbered", []string{"short"}, 25, true, 1, ""},
+		{"fits unnumbered", []string{nearlyFull}, 25, false, 1, ""},
+		{"numbering pushes it over", []string{nearlyFull}, 25, true, 2, ""},
+		{"a part per tweet at least", []string{"one", "two", "three"}, 25, true, 3, ""},
+		{"two-digit numbering", []string{words(500)}, 25, true, 12, ""},
+		{"URL near the boundary", []string{words(42) + " " + link}, 25, false, 1, ""},
+		{"URL past the boundary", []string{words(46) + " " + link}, 25, false, 2, ""},
+		{"too many tweets", []string{words(500)}, 5, true, 0, "exceeds the maximum of 5"},
+		{"empty", []string{"  "}, 25, true, 0, "empty"},
+	}
+	for _, tt := range tests {
+		tweets, err := buildThread(tt.parts, maxTweetLength, tt.maxTweets, tt.numbered)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if len(tweets) != tt.count {
+			t.Errorf("%s: got %d tweets, want %d: %q", tt.name, len(tweets), tt.count, tweets)
+		}
+		for i, tweet := range tweets {
+			if tweetLength(tweet) > maxTweetLength {
+				t.Errorf("%s: tweet %d weighs %d: %q", tt.name, i+1, tweetLength(tweet), tweet)
+			}
+			if tt.numbered && len(tweets) > 1 && !strings.HasSuffix(tweet, fmt.Sprintf(" %d/%d", i+1, len(tweets))) {
+				t.Errorf("%s: tweet %d isn't numbered: %q", tt.name, i+1, tweet)
+			}
+		}
+		if strings.Contains(strings.Join(tt.parts, " "), link) && !strings.Contains(tweets[len(tweets)-1], link) {
+			t.Errorf("%s: the link was split: %q", tt.name, tweets)
+		}
+	}
+}
@@ -8,7 +8,6 @@ import (
     "encoding/json"
     "fmt"
     "net/http"
-    "time"
     "log/slog"
 )
 
@@ -19,36 +18,21 @@ type AnthropicService struct {
 
 func NewAnthropicService(logger *slog.Logger) *AnthropicService {
     return &AnthropicService{
-        httpClient: &http.Client{Timeout: 120 * time.Second},
+        httpClient: newHTTPClient("anthropic", 0),
         logger:     logger,
     }
 }
 
+// CallLLM sends the prompt to the messages API. The transport retries the
+// rate limited and failed calls.
 func (s *AnthropicService) CallLLM(ctx context.Context, config map[string]interface{}, prompt string) (string, error) {
-    maxRetries := 3
-    retryDelay := 5 * time.Second
-
-    for attempt := 1; attempt <= maxRetries; attempt++ {
-        response, err := s.callAnthropic(ctx, config, prompt)
-        if err == nil {
-            return response, nil
-        }
-
-        if attempt == maxRetries {
-            s.logger.Error("Error calling Anthropic API after multiple attempts",
-                slog.Int("attempts", maxRetries),
-                slog.String("error", err.Error()))
-            return "", fmt.Errorf("failed to call Anthropic API after %d attempts: %w", maxRetries, err)
-        }
-
-        s.logger.Warn("Attempt failed, retrying",
-            slog.Int("attempt", attempt),
-            slog.Duration("retryDelay", retryDelay),
+    response, err := s.callAnthropic(ctx, config, prompt)
+    if err != nil {
+        s.logger.ErrorContext(ctx, "Error calling Anthropic API",
             slog.String("error", err.Error()))
-        time.Sleep(retryDelay)
+        return "", fmt.Errorf("failed to call Anthropic API: %w", err)
     }
-
-    return "", fmt.Errorf("failed to call Anthropic API after exhausting all retry attempts")
+    return response, nil
 }
 
 func (s *AnthropicService) callAnthropic(ctx context.Context, config map[string]interface{}, prompt string) (string, error) {
@@ -74,13 +58,15 @@ func (s *AnthropicService) callAnthropic(ctx context.Context, config map[string]
 
     maxTokensInt := int(safeParseFloat(maxTokens, 1000))
 
-    requestBody, err := json.Marshal(map[string]interface{}{
+    payload := map[string]interface{}{
         "model": modelName,
         "messages": []map[string]string{
             {"role": "user", "content": prompt},
         },
         "max_tokens": maxTokensInt,
-    })
+    }
+    setAnthropicSampling(payload, Parameters(config))
+    requestBody, err := json.Marshal(payload)
     if err != nil {
         return "", fmt.Errorf("error marshaling request body: %w", err)
     }
@@ -122,3 +108,17 @@ func (s *AnthropicService) callAnthropic(ctx context.Context, config map[string]
 
     return text, nil
 }
+
+// setAnthropicSampling copies the temperature, top_p and top_k parameters to
+// the request body, the API takes no seed. The models refuse top_p with a
+// temperature, the temperature wins.
+func setAnthropicSampling(body map[string]interface{}, params map[string]interface{}) {
+    if temperature, ok := params["temperature"]; ok {
+        body["temperature"] = safeParseFloat(temperature, 1.0)
+    } else if topP, ok := params["top_p"]; ok {
+        body["top_p"] = safeParseFloat(topP, 1.0)
+    }
+    if topK, ok := params["top_k"]; ok {
+        body["top_k"] = int(safeParseFloat(topK, 0))
+    }
+}
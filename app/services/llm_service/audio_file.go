@@ -0,0 +1,70 @@
+package llm_service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// audioMimeTypes are the MIME types of the audio formats of the TTS services.
+var audioMimeTypes = map[string]string{
+	"mp3":  "audio/mpeg",
+	"opus": "audio/opus",
+	"aac":  "audio/aac",
+	"flac": "audio/flac",
+	"wav":  "audio/wav",
+	"pcm":  "audio/pcm",
+}
+
+// saveAudioFile stores the audio of a TTS service under storage/pipeline/audio
+// and returns the AudioFileResponse JSON the steps output.
+func saveAudioFile(audio io.Reader, prefix, format string, voice *VoiceInfo) (string, error) {
+	month := time.Now().Format("2006-01")
+	directory := filepath.Join("storage", "pipeline", "audio", month)
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	filename := fmt.Sprintf("%s_%d.%s", prefix, time.Now().UnixNano(), format)
+	path := filepath.Join(directory, filename)
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create audio file: %w", err)
+	}
+	defer file.Close()
+
+	// Copy audio data to file, hashing it on the way
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(file, hash), audio)
+	if err != nil {
+		file.Close()
+		os.Remove(path) // Clean up on error
+		return "", fmt.Errorf("failed to write audio data: %w", err)
+	}
+
+	mimeType, ok := audioMimeTypes[format]
+	if !ok {
+		mimeType = "audio/" + format
+	}
+	response := AudioFileResponse{
+		FileID:    fmt.Sprintf("%d", time.Now().UnixNano()),
+		URI:       path,
+		URL:       fmt.Sprintf("/storage/pipeline/audio/%s/%s", month, filename),
+		MimeType:  mimeType,
+		Filename:  filename,
+		Size:      written,
+		Timestamp: time.Now().Unix(),
+		SHA256:    hex.EncodeToString(hash.Sum(nil)),
+		Voice:     voice,
+	}
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return string(jsonResponse), nil
+}
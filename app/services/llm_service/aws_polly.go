@@ -2,13 +2,20 @@ package llm_service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -16,8 +23,21 @@ import (
 	"github.com/aws/aws-sdk-go/service/polly"
 )
 
+// pollyMaxChars is the number of billed characters SynthesizeSpeech accepts
+// per request, longer texts are synthesized in chunks.
+const pollyMaxChars = 3000
+
+// pollyEngines are the engines the steps may choose.
+var pollyEngines = map[string]bool{
+	polly.EngineStandard:   true,
+	polly.EngineNeural:     true,
+	polly.EngineLongForm:   true,
+	polly.EngineGenerative: true,
+}
+
 type AWSPollyService struct {
-	logger *slog.Logger
+	httpClient *http.Client
+	logger     *slog.Logger
 }
 
 // Audio file response structure to match what Drupal expects
@@ -29,40 +49,28 @@ type PollyAudioFileResponse struct {
 	Filename  string `json:"filename"`
 	Size      int64  `json:"size"`
 	Timestamp int64  `json:"timestamp"`
+	SHA256    string `json:"sha256"`
+	// Voice the audio was generated with
+	Voice *VoiceInfo `json:"voice,omitempty"`
 }
 
 func NewAWSPollyService(logger *slog.Logger) *AWSPollyService {
 	return &AWSPollyService{
-		logger: logger,
+		httpClient: newHTTPClient("aws_polly", 0),
+		logger:     logger,
 	}
 }
 
+// CallLLM synthesizes the prompt. The SDK retries the throttled and failed
+// calls.
 func (s *AWSPollyService) CallLLM(ctx context.Context, config map[string]interface{}, prompt string) (string, error) {
-	maxRetries := 3
-	retryDelay := 5 * time.Second
-
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		response, err := s.callAWSPolly(ctx, config, prompt)
-		if err == nil {
-			return response, nil
-		}
-
-		if attempt == maxRetries {
-			s.logger.Error("Error calling AWS Polly API after multiple attempts",
-				slog.Int("attempts", maxRetries),
-				slog.String("error", err.Error()))
-			return "", fmt.Errorf("failed to call AWS Polly API after %d attempts: %w", maxRetries, err)
-		}
-
-		s.logger.Warn("Attempt failed, retrying",
-			slog.Int("attempt", attempt),
-			slog.Duration("retry_delay", retryDelay),
+	response, err := s.callAWSPolly(ctx, config, prompt)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Error calling AWS Polly API",
 			slog.String("error", err.Error()))
-
-		time.Sleep(retryDelay)
+		return "", fmt.Errorf("failed to call AWS Polly API: %w", err)
 	}
-
-	return "", fmt.Errorf("failed to call AWS Polly API after exhausting all retry attempts")
+	return response, nil
 }
 
 func (s *AWSPollyService) callAWSPolly(ctx context.Context, config map[string]interface{}, prompt string) (string, error) {
@@ -85,15 +93,40 @@ func (s *AWSPollyService) callAWSPolly(ctx context.Context, config map[string]in
 
 	// Get required parameters with fallbacks
 	region := getStringParam(params, "region", "us-west-2")
-	voiceId := getStringParam(params, "voice_id", "Joanna")
+	voiceId := getStringParam(params, "voice_id", "")
+	languageCode := getStringParam(params, "language_code", "")
 	outputFormat := getStringParam(params, "output_format", "mp3")
 	sampleRate := getStringParam(params, "sample_rate", "22050")
-	engine := getStringParam(params, "engine", "standard")
+	engine := getStringParam(params, "engine", polly.EngineStandard)
+	if !pollyEngines[engine] {
+		return "", fmt.Errorf("unsupported Polly engine %q", engine)
+	}
+
+	// SSML is validated before any call, Polly's errors don't locate the problem
+	textType := getStringParam(params, "text_type", "")
+	if textType == "" {
+		textType = polly.TextTypeText
+		if strings.HasPrefix(strings.TrimSpace(prompt), "<speak") {
+			textType = polly.TextTypeSsml
+		}
+	}
+	if textType == polly.TextTypeSsml {
+		if err := validateSSML(prompt); err != nil {
+			return "", err
+		}
+	}
+	chunks, err := chunkPollyText(prompt, textType == polly.TextTypeSsml, pollyMaxChars)
+	if err != nil {
+		return "", err
+	}
 
 	// Create AWS session
 	sess, err := session.NewSession(&aws.Config{
 		Region:      aws.String(region),
 		Credentials: credentials.NewStaticCredentials(apiKey, apiSecret, ""),
+		// The SDK retries throttled calls itself, its request bodies can't be
+		// replayed by the transport, which only times out and circuit breaks
+		HTTPClient: s.httpClient,
 	})
 	if err != nil {
 		return "", fmt.Errorf("failed to create AWS session: %w", err)
@@ -102,21 +135,15 @@ func (s *AWSPollyService) callAWSPolly(ctx context.Context, config map[string]in
 	// Create Polly client
 	pollyClient := polly.New(sess)
 
-	// Create synthesize speech input
-	input := &polly.SynthesizeSpeechInput{
-		Text:         aws.String(prompt),
-		OutputFormat: aws.String(outputFormat),
-		VoiceId:      aws.String(voiceId),
-		Engine:       aws.String(engine),
-		SampleRate:   aws.String(sampleRate),
-	}
-
-	// Call SynthesizeSpeech API
-	output, err := pollyClient.SynthesizeSpeechWithContext(ctx, input)
-	if err != nil {
-		return "", fmt.Errorf("error calling AWS Polly SynthesizeSpeech: %w", err)
+	// Without a voice, the first voice of the engine speaking the language
+	voiceName := ""
+	if voiceId == "" {
+		if languageCode == "" {
+			voiceId = "Joanna"
+		} else if voiceId, voiceName, err = s.pickVoice(ctx, pollyClient, engine, languageCode, getStringParam(params, "gender", "")); err != nil {
+			return "", err
+		}
 	}
-	defer output.AudioStream.Close()
 
 	// Create directory structure
 	directory := filepath.Join("storage", "pipeline", "audio", time.Now().Format("2006-01"))
@@ -135,11 +162,37 @@ func (s *AWSPollyService) callAWSPolly(ctx context.Context, config map[string]in
 	}
 	defer file.Close()
 
-	// Copy audio data to file
-	written, err := io.Copy(file, output.AudioStream)
-	if err != nil {
-		os.Remove(filepath) // Clean up on error
-		return "", fmt.Errorf("failed to write audio data: %w", err)
+	// Synthesize the chunks one after the other, appending their audio to the
+	// file: the mp3, ogg and pcm streams of Polly play back concatenated
+	hash := sha256.New()
+	var written int64
+	for i, chunk := range chunks {
+		input := &polly.SynthesizeSpeechInput{
+			Text:         aws.String(chunk),
+			TextType:     aws.String(textType),
+			OutputFormat: aws.String(outputFormat),
+			VoiceId:      aws.String(voiceId),
+			Engine:       aws.String(engine),
+			SampleRate:   aws.String(sampleRate),
+		}
+		if languageCode != "" {
+			input.LanguageCode = aws.String(languageCode)
+		}
+
+		output, err := pollyClient.SynthesizeSpeechWithContext(ctx, input)
+		if err != nil {
+			file.Close()
+			os.Remove(filepath) // Clean up on error
+			return "", fmt.Errorf("error calling AWS Polly SynthesizeSpeech for chunk %d/%d: %w", i+1, len(chunks), err)
+		}
+		n, err := io.Copy(io.MultiWriter(file, hash), output.AudioStream)
+		output.AudioStream.Close()
+		if err != nil {
+			file.Close()
+			os.Remove(filepath) // Clean up on error
+			return "", fmt.Errorf("failed to write audio data: %w", err)
+		}
+		written += n
 	}
 
 	// Prepare response
@@ -151,6 +204,14 @@ func (s *AWSPollyService) callAWSPolly(ctx context.Context, config map[string]in
 		Filename:  filename,
 		Size:      written,
 		Timestamp: time.Now().Unix(),
+		SHA256:    hex.EncodeToString(hash.Sum(nil)),
+		Voice: &VoiceInfo{
+			Provider: "aws_polly",
+			ID:       voiceId,
+			Name:     voiceName,
+			Model:    engine,
+			Language: languageCode,
+		},
 	}
 
 	// Convert to JSON
@@ -168,4 +229,266 @@ func getStringParam(params map[string]interface{}, key, defaultValue string) str
 		return val
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+// pickVoice returns the first voice of the engine speaking the language, of
+// the gender when one is given.
+func (s *AWSPollyService) pickVoice(ctx context.Context, client *polly.Polly, engine, languageCode, gender string) (string, string, error) {
+	output, err := client.DescribeVoicesWithContext(ctx, &polly.DescribeVoicesInput{
+		Engine:       aws.String(engine),
+		LanguageCode: aws.String(languageCode),
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("error listing the Polly voices: %w", err)
+	}
+	for _, voice := range output.Voices {
+		if gender == "" || strings.EqualFold(aws.StringValue(voice.Gender), gender) {
+			return aws.StringValue(voice.Id), aws.StringValue(voice.Name), nil
+		}
+	}
+	return "", "", fmt.Errorf("no %s Polly voice for language %s", engine, languageCode)
+}
+
+// validateSSML checks the SSML is well-formed XML with a speak root.
+func validateSSML(ssml string) error {
+	decoder := xml.NewDecoder(strings.NewReader(ssml))
+	depth := 0
+	root := ""
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid SSML: %w", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				if root != "" {
+					return fmt.Errorf("invalid SSML: more than one root element")
+				}
+				root = t.Name.Local
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			if depth == 0 && strings.TrimSpace(string(t)) != "" {
+				return fmt.Errorf("invalid SSML: text outside the speak element")
+			}
+		}
+	}
+	if root != "speak" {
+		return fmt.Errorf("invalid SSML: the root element must be speak")
+	}
+	return nil
+}
+
+// speakStartTag finds the speak element, after a possible XML declaration.
+var speakStartTag = regexp.MustCompile(`<speak(\s[^>]*)?>`)
+
+// Ranks of the places a text can be cut at, the best one fitting in a chunk
+// is chosen.
+const (
+	cutAnywhere = iota + 1
+	cutAtSpace
+	cutAtSentence
+)
+
+// cutPoint is a place between two characters of the text, outside any tag or
+// entity, and the start tags of the SSML elements open there.
+type cutPoint struct {
+	valid bool
+	rank  int
+	open  []string
+}
+
+// chunkPollyText splits a text longer than max characters at sentence ends,
+// or at spaces for overlong sentences. SSML is preferably split between its p
+// and s elements and after its breaks. The elements open where it is cut are
+// closed at the end of the chunk and opened again at the start of the next,
+// each chunk being wrapped in the speak element of the original, the tags not
+// being billed but counted against the limit anyway.
+func chunkPollyText(text string, ssml bool, max int) ([]string, error) {
+	if len([]rune(text)) <= max {
+		return []string{text}, nil
+	}
+	inner, speakOpen, speakClose := text, "", ""
+	if ssml {
+		trimmed := strings.TrimSpace(text)
+		start := speakStartTag.FindStringIndex(trimmed)
+		end := strings.LastIndex(trimmed, "</speak>")
+		if start == nil || end < start[1] {
+			return nil, fmt.Errorf("invalid SSML: no speak element")
+		}
+		speakOpen, speakClose = trimmed[start[0]:start[1]], "</speak>"
+		inner = trimmed[start[1]:end]
+	}
+
+	runes := []rune(inner)
+	points := cutPoints(runes, ssml)
+	wrapper := len([]rune(speakOpen)) + len([]rune(speakClose))
+
+	var chunks []string
+	start := skipSpaces(runes, 0)
+	for start < len(runes) {
+		reopen := strings.Join(points[start].open, "")
+		overhead := wrapper + len([]rune(reopen))
+		best := -1
+		for pos := start + 1; pos <= len(runes) && overhead+pos-start <= max; pos++ {
+			point := points[pos]
+			if !point.valid || overhead+pos-start+closingLength(point.open) > max {
+				continue
+			}
+			if pos == len(runes) || best < 0 || point.rank >= points[best].rank {
+				best = pos
+			}
+		}
+		if best < 0 {
+			return nil, fmt.Errorf("cannot split the text into chunks of %d characters", max)
+		}
+
+		body := strings.TrimSpace(string(runes[start:best]))
+		if ssml && hasSpokenText(body) {
+			chunk := speakOpen + reopen + body + closingTags(points[best].open) + speakClose
+			if err := validateSSML(chunk); err != nil {
+				return nil, fmt.Errorf("chunk %d: %w", len(chunks)+1, err)
+			}
+			chunks = append(chunks, chunk)
+		} else if !ssml && body != "" {
+			chunks = append(chunks, body)
+		}
+		start = skipSpaces(runes, best)
+	}
+	return chunks, nil
+}
+
+// cutPoints ranks every place of the runes: at a space after a sentence end,
+// around the p, s and break elements of SSML, at another space, anywhere
+// else. The places inside a tag or an entity are not valid.
+func cutPoints(runes []rune, ssml bool) []cutPoint {
+	points := make([]cutPoint, len(runes)+1)
+	var open []string
+	mark := func(pos, rank int) {
+		if !points[pos].valid || rank > points[pos].rank {
+			points[pos] = cutPoint{valid: true, rank: rank, open: open}
+		}
+	}
+
+	inEntity := false
+	for i := 0; i < len(runes); i++ {
+		if ssml && runes[i] == '<' {
+			end := tagEnd(runes, i)
+			tag := string(runes[i : end+1])
+			name := tagName(tag)
+			closing := strings.HasPrefix(tag, "</")
+			paragraph := name == "p" || name == "s"
+
+			if paragraph && !closing {
+				mark(i, cutAtSentence)
+			} else {
+				mark(i, cutAnywhere)
+			}
+			switch {
+			case closing:
+				if len(open) > 0 {
+					open = open[:len(open)-1]
+				}
+			case strings.HasPrefix(tag, "<!"), strings.HasPrefix(tag, "<?"), strings.HasSuffix(tag, "/>"):
+			default:
+				// A copy, the earlier points keep their own stack
+				open = append(open[:len(open):len(open)], tag)
+			}
+			if (paragraph && closing) || name == "break" {
+				mark(end+1, cutAtSentence)
+			} else {
+				mark(end+1, cutAnywhere)
+			}
+			i = end
+			continue
+		}
+
+		rank := cutAnywhere
+		if unicode.IsSpace(runes[i]) {
+			rank = cutAtSpace
+			if i > 0 && strings.ContainsRune(".!?", runes[i-1]) {
+				rank = cutAtSentence
+			}
+		}
+		if !inEntity {
+			mark(i, rank)
+		}
+		if ssml && runes[i] == '&' {
+			inEntity = true
+		} else if runes[i] == ';' || unicode.IsSpace(runes[i]) {
+			inEntity = false
+		}
+	}
+	mark(len(runes), cutAtSentence)
+	return points
+}
+
+// tagEnd returns the index of the > closing the tag starting at i, quoted
+// attribute values may hold one.
+func tagEnd(runes []rune, i int) int {
+	var quote rune
+	for j := i + 1; j < len(runes); j++ {
+		switch {
+		case quote != 0:
+			if runes[j] == quote {
+				quote = 0
+			}
+		case runes[j] == '"' || runes[j] == '\'':
+			quote = runes[j]
+		case runes[j] == '>':
+			return j
+		}
+	}
+	return len(runes) - 1
+}
+
+func tagName(tag string) string {
+	name := strings.TrimLeft(tag, "</!?")
+	if i := strings.IndexAny(name, " \t\r\n/>"); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+func closingLength(open []string) int {
+	return len([]rune(closingTags(open)))
+}
+
+// closingTags closes the open elements, innermost first.
+func closingTags(open []string) string {
+	var b strings.Builder
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString("</" + tagName(open[i]) + ">")
+	}
+	return b.String()
+}
+
+func skipSpaces(runes []rune, i int) int {
+	for i < len(runes) && unicode.IsSpace(runes[i]) {
+		i++
+	}
+	return i
+}
+
+// hasSpokenText reports whether SSML has text outside its tags, a chunk made
+// of tags only is not worth a call.
+func hasSpokenText(ssml string) bool {
+	inTag := false
+	for _, r := range ssml {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>':
+			inTag = false
+		case !inTag && !unicode.IsSpace(r):
+			return true
+		}
+	}
+	return false
+}
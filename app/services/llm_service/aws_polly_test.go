@@ -0,0 +1,152 @@
+package llm_service
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var ssmlTags = regexp.MustCompile(`<[^>]*>`)
+
+// spokenText is the text of SSML without its tags, spaces normalized.
+func spokenText(s string) string {
+	return strings.Join(strings.Fields(ssmlTags.ReplaceAllString(s, " ")), " ")
+}
+
+func TestChunkPollyText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		ssml bool
+		max  int
+		want []string
+	}{
+		{
+			name: "short text",
+			text: "Hello there.",
+			max:  100,
+			want: []string{"Hello there."},
+		},
+		{
+			name: "plain text at sentence ends",
+			text: "One two. Three four. Five six seven.",
+			max:  20,
+			want: []string{"One two. Three four.", "Five six seven."},
+		},
+		{
+			name: "overlong sentence at spaces",
+			text: "one two three four five six",
+			max:  10,
+			want: []string{"one two", "three four", "five six"},
+		},
+		{
+			name: "multi-byte text",
+			text: "Ça été très éprouvant. Où êtes-vous allés ?",
+			max:  25,
+			want: []string{"Ça été très éprouvant.", "Où êtes-vous allés ?"},
+		},
+		{
+			name: "SSML wrapped in one element",
+			text: `<speak><prosody rate="90%">First sentence here. Second sentence here.</prosody></speak>`,
+			ssml: true,
+			max:  70,
+			want: []string{
+				`<speak><prosody rate="90%">First sentence here.</prosody></speak>`,
+				`<speak><prosody rate="90%">Second sentence here.</prosody></speak>`,
+			},
+		},
+		{
+			name: "SSML between nested s elements",
+			text: `<speak xml:lang="fr-FR"><p><s>Première phrase.</s><s>Deuxième phrase.</s></p></speak>`,
+			ssml: true,
+			max:  70,
+			want: []string{
+				`<speak xml:lang="fr-FR"><p><s>Première phrase.</s></p></speak>`,
+				`<speak xml:lang="fr-FR"><p><s>Deuxième phrase.</s></p></speak>`,
+			},
+		},
+		{
+			name: "SSML after a break",
+			text: `<speak>Hello there<break time="1s"/>general Kenobi</speak>`,
+			ssml: true,
+			max:  45,
+			want: []string{
+				`<speak>Hello there<break time="1s"/></speak>`,
+				`<speak>general Kenobi</speak>`,
+			},
+		},
+		{
+			name: "SSML with an XML declaration",
+			text: `<?xml version="1.0"?><speak version="1.1">First part. Second part.</speak>`,
+			ssml: true,
+			max:  45,
+			want: []string{
+				`<speak version="1.1">First part.</speak>`,
+				`<speak version="1.1">Second part.</speak>`,
+			},
+		},
+		{
+			name: "SSML entity kept whole",
+			text: `<speak>Fish&amp;chips</speak>`,
+			ssml: true,
+			max:  23,
+			want: []string{
+				`<speak>Fish</speak>`,
+				`<speak>&amp;chi</speak>`,
+				`<speak>ps</speak>`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		got, err := chunkPollyText(tt.text, tt.ssml, tt.max)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestChunkPollyTextLongSSML(t *testing.T) {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?><speak><prosody rate="95%"><p>`)
+	for i := 0; i < 400; i++ {
+		b.WriteString(`<s>Voilà une phrase, avec <emphasis level="strong">de l'emphase</emphasis> &amp; une pause.</s><break time="300ms"/> `)
+	}
+	b.WriteString(`</p></prosody></speak>`)
+	text := b.String()
+
+	chunks, err := chunkPollyText(text, true, pollyMaxChars)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("expected several chunks, got %d", len(chunks))
+	}
+	var spoken []string
+	for i, chunk := range chunks {
+		if n := len([]rune(chunk)); n > pollyMaxChars {
+			t.Errorf("chunk %d is %d characters long", i, n)
+		}
+		if err := validateSSML(chunk); err != nil {
+			t.Errorf("chunk %d: %v", i, err)
+		}
+		if !strings.HasPrefix(chunk, `<speak><prosody rate="95%"><p>`) || !strings.HasSuffix(chunk, `</p></prosody></speak>`) {
+			t.Errorf("chunk %d is not wrapped in the open elements: %.60s...", i, chunk)
+		}
+		spoken = append(spoken, spokenText(chunk))
+	}
+	if got, want := strings.Join(spoken, " "), spokenText(text); got != want {
+		t.Errorf("the chunks do not say the text")
+	}
+}
+
+func TestChunkPollyTextTooSmall(t *testing.T) {
+	_, err := chunkPollyText(`<speak><prosody rate="90%">Some words to say</prosody></speak>`, true, 40)
+	if err == nil || !strings.Contains(err.Error(), "cannot split") {
+		t.Fatalf("expected an error, got %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package llm_service
+
+import "context"
+
+// ChatCaller is implemented by the services taking a conversation, system
+// instructions and prior turns, rather than a single prompt.
+type ChatCaller interface {
+	CallChat(ctx context.Context, config map[string]interface{}, messages []Message) (string, error)
+}
+
+// CallChat sends the conversation to the chat completions API.
+func (s *OpenAIService) CallChat(ctx context.Context, config map[string]interface{}, messages []Message) (string, error) {
+	return chatContent(s.CallWithTools(ctx, config, messages, nil))
+}
+
+// CallChat sends the conversation to the chat completions API.
+func (s *GroqService) CallChat(ctx context.Context, config map[string]interface{}, messages []Message) (string, error) {
+	return chatContent(s.CallWithTools(ctx, config, messages, nil))
+}
+
+// CallChat sends the conversation to the chat completions API.
+func (s *OpenRouterService) CallChat(ctx context.Context, config map[string]interface{}, messages []Message) (string, error) {
+	return chatContent(s.CallWithTools(ctx, config, messages, nil))
+}
+
+// CallChat sends the conversation to the messages API.
+func (s *AnthropicService) CallChat(ctx context.Context, config map[string]interface{}, messages []Message) (string, error) {
+	return chatContent(s.CallWithTools(ctx, config, messages, nil))
+}
+
+func chatContent(response *ToolResponse, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	return response.Content, nil
+}
@@ -0,0 +1,198 @@
+package llm_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// ErrInvalidCredentials is returned when a provider rejects an API key.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// CredentialValidator is implemented by the services able to check an API key
+// without spending tokens, for the readiness probe.
+type CredentialValidator interface {
+	ValidateCredentials(ctx context.Context, config map[string]interface{}) error
+}
+
+// credentialStore remembers the last credentials each service was called with.
+type credentialStore struct {
+	sync.RWMutex
+	configs map[string]map[string]interface{}
+}
+
+// Credentials holds the credentials seen by the services. The API keys come
+// with the pipelines from Drupal, so they are only known once a step ran.
+var Credentials = &credentialStore{configs: make(map[string]map[string]interface{})}
+
+// Remember records the credentials of a service configuration.
+func (s *credentialStore) Remember(service string, config map[string]interface{}) {
+	apiKey, _ := config["api_key"].(string)
+	if service == "" || apiKey == "" {
+		return
+	}
+	apiURL, _ := config["api_url"].(string)
+	s.Lock()
+	s.configs[service] = map[string]interface{}{"api_key": apiKey, "api_url": apiURL}
+	s.Unlock()
+}
+
+// Configs returns the remembered credentials keyed by service.
+func (s *credentialStore) Configs() map[string]map[string]interface{} {
+	s.RLock()
+	defer s.RUnlock()
+	configs := make(map[string]map[string]interface{}, len(s.configs))
+	for service, config := range s.configs {
+		configs[service] = config
+	}
+	return configs
+}
+
+// apiBase returns the scheme and host of the configured API URL, or fallback.
+func apiBase(config map[string]interface{}, fallback string) string {
+	apiURL, _ := config["api_url"].(string)
+	u, err := url.Parse(apiURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fallback
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// checkCredentials sends a request listing something cheap with the key,
+// such as the models, and maps the rejections to ErrInvalidCredentials.
+func checkCredentials(ctx context.Context, client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		// The URL may carry the key
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%w: status %d", ErrInvalidCredentials, resp.StatusCode)
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func credentialRequest(rawURL string, headers map[string]string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+// ValidateCredentials lists the models with the key.
+func (s *OpenAIService) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	apiKey, _ := config["api_key"].(string)
+	req, err := credentialRequest(apiBase(config, "https://api.openai.com")+"/v1/models", map[string]string{"Authorization": "Bearer " + apiKey})
+	if err != nil {
+		return err
+	}
+	return checkCredentials(ctx, s.httpClient, req)
+}
+
+// ValidateCredentials lists the models with the key.
+func (s *OpenAIImageService) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	apiKey, _ := config["api_key"].(string)
+	req, err := credentialRequest(apiBase(config, "https://api.openai.com")+"/v1/models", map[string]string{"Authorization": "Bearer " + apiKey})
+	if err != nil {
+		return err
+	}
+	return checkCredentials(ctx, s.httpClient, req)
+}
+
+// ValidateCredentials lists the models with the key.
+func (s *OpenAITTSService) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	apiKey, _ := config["api_key"].(string)
+	req, err := credentialRequest(apiBase(config, "https://api.openai.com")+"/v1/models", map[string]string{"Authorization": "Bearer " + apiKey})
+	if err != nil {
+		return err
+	}
+	return checkCredentials(ctx, s.httpClient, req)
+}
+
+// ValidateCredentials reads the account of the key.
+func (s *StabilityImageService) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	apiKey, _ := config["api_key"].(string)
+	req, err := credentialRequest(apiBase(config, StabilityDefaultURL)+"/v1/user/account", map[string]string{"Authorization": "Bearer " + apiKey})
+	if err != nil {
+		return err
+	}
+	return checkCredentials(ctx, s.httpClient, req)
+}
+
+// ValidateCredentials reads the account of the key.
+func (s *ReplicateService) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	apiKey, _ := config["api_key"].(string)
+	req, err := credentialRequest(apiBase(config, ReplicateDefaultURL)+"/v1/account", map[string]string{"Authorization": "Bearer " + apiKey})
+	if err != nil {
+		return err
+	}
+	return checkCredentials(ctx, s.httpClient, req)
+}
+
+// ValidateCredentials lists the models with the key.
+func (s *AnthropicService) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	apiKey, _ := config["api_key"].(string)
+	req, err := credentialRequest(apiBase(config, "https://api.anthropic.com")+"/v1/models", map[string]string{
+		"x-api-key":         apiKey,
+		"anthropic-version": "2023-06-01",
+	})
+	if err != nil {
+		return err
+	}
+	return checkCredentials(ctx, s.httpClient, req)
+}
+
+// ValidateCredentials lists the models with the key.
+func (s *GeminiService) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	apiKey, _ := config["api_key"].(string)
+	req, err := credentialRequest(apiBase(config, "https://generativelanguage.googleapis.com")+"/v1beta/models?key="+url.QueryEscape(apiKey), nil)
+	if err != nil {
+		return err
+	}
+	return checkCredentials(ctx, s.httpClient, req)
+}
+
+// ValidateCredentials reads the account of the key.
+func (s *ElevenLabsService) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	apiKey, _ := config["api_key"].(string)
+	req, err := credentialRequest(apiBase(config, "https://api.elevenlabs.io")+"/v1/user", map[string]string{"xi-api-key": apiKey})
+	if err != nil {
+		return err
+	}
+	return checkCredentials(ctx, s.httpClient, req)
+}
+
+// ValidateCredentials lists the models with the key.
+func (s *GroqService) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	apiKey, _ := config["api_key"].(string)
+	req, err := credentialRequest(apiBase(config, "https://api.groq.com")+"/openai/v1/models", map[string]string{"Authorization": "Bearer " + apiKey})
+	if err != nil {
+		return err
+	}
+	return checkCredentials(ctx, s.httpClient, req)
+}
+
+// ValidateCredentials reads the key, which needs no credit.
+func (s *OpenRouterService) ValidateCredentials(ctx context.Context, config map[string]interface{}) error {
+	apiKey, _ := config["api_key"].(string)
+	req, err := credentialRequest(apiBase(config, "https://openrouter.ai")+"/api/v1/key", map[string]string{"Authorization": "Bearer " + apiKey})
+	if err != nil {
+		return err
+	}
+	return checkCredentials(ctx, s.httpClient, req)
+}
@@ -8,22 +8,56 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
-	"os"
-	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
 )
 
+// ElevenLabsDefaultModel is used by the steps configuring no model.
+const ElevenLabsDefaultModel = "eleven_multilingual_v2"
+
+// elevenLabsVoicesTTL is how long the voice list of an account is cached.
+const elevenLabsVoicesTTL = time.Hour
+
 type ElevenLabsService struct {
 	httpClient *http.Client
 	logger     *slog.Logger
+
+	mu     sync.Mutex
+	voices map[string]elevenLabsVoiceList // by API key
+}
+
+// elevenLabsVoiceList caches the voices of an account, to resolve voice
+// names and describe the voices used.
+type elevenLabsVoiceList struct {
+	voices    []elevenLabsVoice
+	fetchedAt time.Time
+}
+
+type elevenLabsVoice struct {
+	VoiceID string            `json:"voice_id"`
+	Name    string            `json:"name"`
+	Labels  map[string]string `json:"labels"`
 }
 
 // Voice settings structure matching the Drupal configuration
 type VoiceSettings struct {
-	Stability       float64 `json:"stability"`
-	SimilarityBoost float64 `json:"similarity_boost"`
-	Style           float64 `json:"style"`
-	UseSpeakerBoost bool    `json:"use_speaker_boost"`
+	Stability       float64  `json:"stability"`
+	SimilarityBoost float64  `json:"similarity_boost"`
+	Style           float64  `json:"style"`
+	UseSpeakerBoost bool     `json:"use_speaker_boost"`
+	Speed           *float64 `json:"speed,omitempty"`
+}
+
+// VoiceInfo describes the voice an audio file was generated with.
+type VoiceInfo struct {
+	Provider string      `json:"provider"`
+	ID       string      `json:"id"`
+	Name     string      `json:"name,omitempty"`
+	Model    string      `json:"model,omitempty"`
+	Language string      `json:"language,omitempty"`
+	Settings interface{} `json:"settings,omitempty"`
 }
 
 // Audio file response structure
@@ -35,61 +69,50 @@ type AudioFileResponse struct {
 	Filename  string `json:"filename"`
 	Size      int64  `json:"size"`
 	Timestamp int64  `json:"timestamp"`
+	SHA256    string `json:"sha256"`
+	// Voice the audio was generated with
+	Voice *VoiceInfo `json:"voice,omitempty"`
 }
 
 func NewElevenLabsService(logger *slog.Logger) *ElevenLabsService {
 	return &ElevenLabsService{
-		httpClient: &http.Client{Timeout: 120 * time.Second},
+		httpClient: newHTTPClient("elevenlabs", 0),
 		logger:     logger,
+		voices:     make(map[string]elevenLabsVoiceList),
 	}
 }
 
+// CallLLM converts the prompt to speech. The transport retries the rate
+// limited and failed calls.
 func (s *ElevenLabsService) CallLLM(ctx context.Context, config map[string]interface{}, prompt string) (string, error) {
-	maxRetries := 3
-	retryDelay := 5 * time.Second
-
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		response, err := s.callElevenLabs(ctx, config, prompt)
-		if err == nil {
-			return response, nil
-		}
+	response, err := s.callElevenLabs(ctx, config, prompt)
+	if err == nil {
+		return response, nil
+	}
 
-		// Check if error contains ElevenLabs error details
-		if httpErr, ok := err.(*ElevenLabsHttpError); ok {
-			if httpErr.StatusCode == 429 {
-				s.logger.Error("ElevenLabs API quota exceeded",
-					slog.String("error_type", httpErr.ErrorType),
-					slog.String("error_message", httpErr.Message),
-					slog.String("model", config["model_name"].(string)),
-					slog.Int("status_code", httpErr.StatusCode))
-				return "", fmt.Errorf("ElevenLabs quota exceeded: %s (Type: %s)", httpErr.Message, httpErr.ErrorType)
-			}
-
-			s.logger.Error("ElevenLabs API error",
-				slog.Int("attempt", attempt),
-				slog.Int("status_code", httpErr.StatusCode),
+	modelName, _ := config["model_name"].(string)
+	// Check if error contains ElevenLabs error details
+	if httpErr, ok := err.(*ElevenLabsHttpError); ok {
+		if httpErr.StatusCode == 429 {
+			s.logger.ErrorContext(ctx, "ElevenLabs API quota exceeded",
 				slog.String("error_type", httpErr.ErrorType),
 				slog.String("error_message", httpErr.Message),
-				slog.String("raw_body", httpErr.RawBody))
+				slog.String("model", modelName),
+				slog.Int("status_code", httpErr.StatusCode))
+			return "", fmt.Errorf("ElevenLabs quota exceeded: %s (Type: %s)", httpErr.Message, httpErr.ErrorType)
 		}
 
-		if attempt == maxRetries {
-			s.logger.Error("Error calling ElevenLabs API after multiple attempts",
-				slog.Int("attempts", maxRetries),
-				slog.String("error", err.Error()),
-				slog.String("model", config["model_name"].(string)))
-			return "", fmt.Errorf("failed to call ElevenLabs API after %d attempts: %w", maxRetries, err)
-		}
-
-		s.logger.Warn("Attempt failed, retrying",
-			slog.Int("attempt", attempt),
-			slog.Duration("retry_delay", retryDelay),
-			slog.String("error", err.Error()))
-
-		time.Sleep(retryDelay)
+		s.logger.ErrorContext(ctx, "ElevenLabs API error",
+			slog.Int("status_code", httpErr.StatusCode),
+			slog.String("error_type", httpErr.ErrorType),
+			slog.String("error_message", httpErr.Message),
+			slog.String("raw_body", httpErr.RawBody))
 	}
 
-	return "", fmt.Errorf("failed to call ElevenLabs API after exhausting all retry attempts")
+	s.logger.ErrorContext(ctx, "Error calling ElevenLabs API",
+		slog.String("error", err.Error()),
+		slog.String("model", modelName))
+	return "", fmt.Errorf("failed to call ElevenLabs API: %w", err)
 }
 
 func (s *ElevenLabsService) callElevenLabs(ctx context.Context, config map[string]interface{}, prompt string) (string, error) {
@@ -104,35 +127,52 @@ func (s *ElevenLabsService) callElevenLabs(ctx context.Context, config map[strin
 		return "", fmt.Errorf("api_key not found in config")
 	}
 
-	modelName, ok := config["model_name"].(string)
-	if !ok {
-		return "", fmt.Errorf("model_name not found in config")
-	}
-
 	params, ok := config["parameters"].(map[string]interface{})
 	if !ok {
 		return "", fmt.Errorf("parameters not found in config")
 	}
 
-	voiceID, ok := params["voice_id"].(string)
-	if !ok {
-		return "", fmt.Errorf("voice_id not found in parameters")
+	modelName, _ := config["model_name"].(string)
+	if model, ok := params["model_id"].(string); ok && model != "" {
+		modelName = model
+	}
+	if modelName == "" {
+		modelName = ElevenLabsDefaultModel
 	}
 
-	// Extract voice settings
+	// The voice is chosen by ID, or by name among the voices of the account
+	voice, err := s.resolveVoice(ctx, apiURL, apiKey, params)
+	if err != nil {
+		return "", err
+	}
+	voiceID := voice.VoiceID
+
+	// Extract voice settings, bounded to the ranges the API accepts
 	voiceSettings := VoiceSettings{
-		Stability:       getFloat64(params, "stability", 0.5),
-		SimilarityBoost: getFloat64(params, "similarity_boost", 0.75),
-		Style:           getFloat64(params, "style", 0),
+		Stability:       clamp(getFloat64(params, "stability", 0.5), 0, 1),
+		SimilarityBoost: clamp(getFloat64(params, "similarity_boost", 0.75), 0, 1),
+		Style:           clamp(getFloat64(params, "style", 0), 0, 1),
 		UseSpeakerBoost: getBool(params, "use_speaker_boost", true),
 	}
+	if _, ok := params["speed"]; ok {
+		speed := clamp(getFloat64(params, "speed", 1), 0.7, 1.2)
+		voiceSettings.Speed = &speed
+	}
 
 	// Prepare request body
-	requestBody, err := json.Marshal(map[string]interface{}{
-		"text":      prompt,
-		"model_id":  modelName,
+	payload := map[string]interface{}{
+		"text":           elevenLabsText(prompt, getBool(params, "ssml", false)),
+		"model_id":       modelName,
 		"voice_settings": voiceSettings,
-	})
+	}
+	language, _ := params["language_code"].(string)
+	if language != "" {
+		payload["language_code"] = language
+	}
+	if locators := pronunciationDictionaries(params["pronunciation_dictionaries"]); len(locators) > 0 {
+		payload["pronunciation_dictionary_locators"] = locators
+	}
+	requestBody, err := json.Marshal(payload)
 	if err != nil {
 		return "", fmt.Errorf("error marshaling request body: %w", err)
 	}
@@ -162,57 +202,134 @@ func (s *ElevenLabsService) callElevenLabs(ctx context.Context, config map[strin
 	}
 
 	// Process successful response
-	return s.processAudioResponse(resp)
+	return s.processAudioResponse(resp, &VoiceInfo{
+		Provider: "elevenlabs",
+		ID:       voiceID,
+		Name:     voice.Name,
+		Model:    modelName,
+		Language: language,
+		Settings: voiceSettings,
+	})
 }
 
-func (s *ElevenLabsService) processAudioResponse(resp *http.Response) (string, error) {
-	// Create directory structure
-	directory := filepath.Join("storage", "pipeline", "audio", time.Now().Format("2006-01"))
-	if err := os.MkdirAll(directory, 0755); err != nil {
-		return "", fmt.Errorf("failed to create directory: %w", err)
+// resolveVoice returns the voice_id parameter, or the voice of the account
+// named voice_name. Both are looked up in the voice list for their metadata,
+// a failed lookup only costs the voice name when the ID is configured.
+func (s *ElevenLabsService) resolveVoice(ctx context.Context, apiURL, apiKey string, params map[string]interface{}) (elevenLabsVoice, error) {
+	voiceID, _ := params["voice_id"].(string)
+	voiceName, _ := params["voice_name"].(string)
+	if voiceID == "" && voiceName == "" {
+		return elevenLabsVoice{}, fmt.Errorf("voice_id or voice_name not found in parameters")
 	}
 
-	// Generate unique filename
-	filename := fmt.Sprintf("tts_%d.mp3", time.Now().UnixNano())
-	filepath := filepath.Join(directory, filename)
-
-	// Create file
-	file, err := os.Create(filepath)
+	voices, err := s.listVoices(ctx, apiURL, apiKey)
 	if err != nil {
-		return "", fmt.Errorf("failed to create audio file: %w", err)
+		if voiceID != "" {
+			s.logger.WarnContext(ctx, "Could not list the ElevenLabs voices", slog.String("error", err.Error()))
+			return elevenLabsVoice{VoiceID: voiceID}, nil
+		}
+		return elevenLabsVoice{}, fmt.Errorf("error resolving voice %q: %w", voiceName, err)
 	}
-	defer file.Close()
+	for _, v := range voices {
+		if (voiceID != "" && v.VoiceID == voiceID) || (voiceID == "" && strings.EqualFold(v.Name, voiceName)) {
+			return v, nil
+		}
+	}
+	if voiceID != "" {
+		return elevenLabsVoice{VoiceID: voiceID}, nil
+	}
+	return elevenLabsVoice{}, fmt.Errorf("no ElevenLabs voice named %q", voiceName)
+}
 
-	// Copy audio data to file
-	written, err := io.Copy(file, resp.Body)
-	if err != nil {
-		os.Remove(filepath) // Clean up on error
-		return "", fmt.Errorf("failed to write audio data: %w", err)
+// listVoices returns the voices of the account, cached for an hour.
+func (s *ElevenLabsService) listVoices(ctx context.Context, apiURL, apiKey string) ([]elevenLabsVoice, error) {
+	s.mu.Lock()
+	cached, ok := s.voices[apiKey]
+	s.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < elevenLabsVoicesTTL {
+		return cached.voices, nil
 	}
 
-	// Prepare response
-	_, err = file.Stat()
+	// The text-to-speech URL is configured, the voices are next to it
+	base := strings.TrimSuffix(strings.TrimSuffix(apiURL, "/"), "/text-to-speech")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/voices", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("xi-api-key", apiKey)
+	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to get file info: %w", err)
+		return nil, fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, s.handleErrorResponse(resp)
 	}
+	var list struct {
+		Voices []elevenLabsVoice `json:"voices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("error decoding the voice list: %w", err)
+	}
+
+	s.mu.Lock()
+	s.voices[apiKey] = elevenLabsVoiceList{voices: list.Voices, fetchedAt: time.Now()}
+	s.mu.Unlock()
+	return list.Voices, nil
+}
 
-	response := AudioFileResponse{
-		FileID:    fmt.Sprintf("%d", time.Now().UnixNano()),
-		URI:       filepath,
-		URL:       fmt.Sprintf("/storage/pipeline/audio/%s/%s", time.Now().Format("2006-01"), filename),
-		MimeType:  "audio/mpeg",
-		Filename:  filename,
-		Size:      written,
-		Timestamp: time.Now().Unix(),
+var (
+	ssmlSubPattern = regexp.MustCompile(`(?s)<sub\s+alias="([^"]*)"\s*>.*?</sub>`)
+	ssmlTagPattern = regexp.MustCompile(`</?([a-zA-Z:]+)[^>]*>`)
+)
+
+// elevenLabsText prepares SSML for the API, which reads break and phoneme
+// tags but no speak wrapper. Substitutions are replaced by their alias and
+// the other tags dropped, keeping their text. Text starting with <speak> is
+// taken as SSML without the ssml parameter.
+func elevenLabsText(text string, ssml bool) string {
+	if !ssml && !strings.HasPrefix(strings.TrimSpace(text), "<speak") {
+		return text
 	}
+	text = ssmlSubPattern.ReplaceAllString(text, "$1")
+	text = ssmlTagPattern.ReplaceAllStringFunc(text, func(tag string) string {
+		name := strings.ToLower(ssmlTagPattern.FindStringSubmatch(tag)[1])
+		if name == "break" || name == "phoneme" {
+			return tag
+		}
+		return ""
+	})
+	return strings.TrimSpace(text)
+}
 
-	// Convert to JSON
-	jsonResponse, err := json.Marshal(response)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal response: %w", err)
+// pronunciationDictionaries reads the pronunciation_dictionaries parameter,
+// objects with an id and a version_id or "id:version_id" strings.
+func pronunciationDictionaries(value interface{}) []map[string]string {
+	items, _ := value.([]interface{})
+	locators := make([]map[string]string, 0, len(items))
+	for _, item := range items {
+		var id, version string
+		switch v := item.(type) {
+		case string:
+			id, version, _ = strings.Cut(v, ":")
+		case map[string]interface{}:
+			id, _ = v["id"].(string)
+			version, _ = v["version_id"].(string)
+		}
+		if id == "" {
+			continue
+		}
+		locator := map[string]string{"pronunciation_dictionary_id": id}
+		if version != "" {
+			locator["version_id"] = version
+		}
+		locators = append(locators, locator)
 	}
+	return locators
+}
 
-	return string(jsonResponse), nil
+func (s *ElevenLabsService) processAudioResponse(resp *http.Response, voice *VoiceInfo) (string, error) {
+	return saveAudioFile(resp.Body, "tts", "mp3", voice)
 }
 
 func (s *ElevenLabsService) handleErrorResponse(resp *http.Response) error {
@@ -252,12 +369,22 @@ func (s *ElevenLabsService) handleErrorResponse(resp *http.Response) error {
 
 // Helper functions
 func getFloat64(params map[string]interface{}, key string, defaultValue float64) float64 {
-	if val, ok := params[key].(float64); ok {
-		return val
+	if val, ok := params[key]; ok {
+		return safeParseFloat(val, defaultValue)
 	}
 	return defaultValue
 }
 
+func clamp(value, min, max float64) float64 {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
+
 func getBool(params map[string]interface{}, key string, defaultValue bool) bool {
 	if val, ok := params[key].(bool); ok {
 		return val
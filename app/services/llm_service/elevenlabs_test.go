@@ -0,0 +1,208 @@
+package llm_service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestElevenLabsText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		ssml bool
+		want string
+	}{
+		{name: "plain text", text: "Hello <b>there</b>", want: "Hello <b>there</b>"},
+		{
+			name: "speak wrapper detected",
+			text: `<speak>Hello <break time="1s"/> world</speak>`,
+			want: `Hello <break time="1s"/> world`,
+		},
+		{
+			name: "substitutions and phonemes",
+			text: `<sub alias="World Wide Web">WWW</sub> <phoneme alphabet="ipa" ph="təˈmeɪtoʊ">tomato</phoneme> <emphasis>now</emphasis>`,
+			ssml: true,
+			want: `World Wide Web <phoneme alphabet="ipa" ph="təˈmeɪtoʊ">tomato</phoneme> now`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := elevenLabsText(tt.text, tt.ssml); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPronunciationDictionaries(t *testing.T) {
+	got := pronunciationDictionaries([]interface{}{
+		"dict1:v1",
+		"dict2",
+		map[string]interface{}{"id": "dict3", "version_id": "v3"},
+		map[string]interface{}{"version_id": "orphan"},
+		float64(4),
+	})
+	want := []map[string]string{
+		{"pronunciation_dictionary_id": "dict1", "version_id": "v1"},
+		{"pronunciation_dictionary_id": "dict2"},
+		{"pronunciation_dictionary_id": "dict3", "version_id": "v3"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// elevenLabsServer serves a voice list and the text-to-speech endpoint,
+// recording the request bodies. The voice list fails with listStatus when it
+// isn't 200.
+func elevenLabsServer(t *testing.T, listStatus int) (*httptest.Server, *int32, *map[string]interface{}) {
+	var lists int32
+	var payload map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("xi-api-key") != "key" {
+			t.Errorf("missing API key on %s", r.URL.Path)
+		}
+		if r.URL.Path == "/v1/voices" {
+			atomic.AddInt32(&lists, 1)
+			if listStatus != http.StatusOK {
+				w.WriteHeader(listStatus)
+				w.Write([]byte(`{"detail":{"status":"invalid_api_key","message":"Invalid API key"}}`))
+				return
+			}
+			w.Write([]byte(`{"voices":[{"voice_id":"v-rachel","name":"Rachel"},{"voice_id":"v-adam","name":"Adam"}]}`))
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write([]byte("mp3 audio"))
+	}))
+	t.Cleanup(server.Close)
+	return server, &lists, &payload
+}
+
+func TestElevenLabsSpeech(t *testing.T) {
+	inTempDir(t)
+	server, lists, payload := elevenLabsServer(t, http.StatusOK)
+	s := NewElevenLabsService(slog.Default())
+
+	config := map[string]interface{}{
+		"api_url": server.URL + "/v1/text-to-speech",
+		"api_key": "key",
+		"parameters": map[string]interface{}{
+			"voice_name":                 "rachel",
+			"stability":                  "1.5",
+			"speed":                      float64(2),
+			"language_code":              "fr",
+			"pronunciation_dictionaries": []interface{}{"dict1:v1"},
+		},
+	}
+	got, err := s.CallLLM(context.Background(), config, "<speak>Bonjour</speak>")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var file AudioFileResponse
+	json.Unmarshal([]byte(got), &file)
+	if file.MimeType != "audio/mpeg" || file.Size != 9 || file.Voice == nil ||
+		file.Voice.ID != "v-rachel" || file.Voice.Name != "Rachel" || file.Voice.Model != ElevenLabsDefaultModel || file.Voice.Language != "fr" {
+		t.Errorf("unexpected audio file %+v", file)
+	}
+	if data, err := os.ReadFile(file.URI); err != nil || string(data) != "mp3 audio" {
+		t.Errorf("expected the audio saved, got %q and %v", data, err)
+	}
+
+	settings, _ := (*payload)["voice_settings"].(map[string]interface{})
+	if (*payload)["text"] != "Bonjour" || (*payload)["language_code"] != "fr" ||
+		settings["stability"] != float64(1) || settings["speed"] != 1.2 || settings["similarity_boost"] != 0.75 {
+		t.Errorf("unexpected payload %v", *payload)
+	}
+	if locators, _ := (*payload)["pronunciation_dictionary_locators"].([]interface{}); len(locators) != 1 {
+		t.Errorf("expected the dictionary locator, got %v", (*payload)["pronunciation_dictionary_locators"])
+	}
+
+	// The voice list is cached
+	if _, err := s.CallLLM(context.Background(), config, "Encore"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if atomic.LoadInt32(lists) != 1 {
+		t.Errorf("expected the voices listed once, got %d", *lists)
+	}
+}
+
+func TestElevenLabsResolveVoice(t *testing.T) {
+	tests := []struct {
+		name       string
+		listStatus int
+		params     map[string]interface{}
+		want       elevenLabsVoice
+		wantErr    string
+	}{
+		{name: "by ID", listStatus: http.StatusOK, params: map[string]interface{}{"voice_id": "v-adam"}, want: elevenLabsVoice{VoiceID: "v-adam", Name: "Adam"}},
+		{name: "unlisted ID", listStatus: http.StatusOK, params: map[string]interface{}{"voice_id": "v-custom"}, want: elevenLabsVoice{VoiceID: "v-custom"}},
+		{name: "ID without the list", listStatus: http.StatusUnauthorized, params: map[string]interface{}{"voice_id": "v-adam"}, want: elevenLabsVoice{VoiceID: "v-adam"}},
+		{name: "name without the list", listStatus: http.StatusUnauthorized, params: map[string]interface{}{"voice_name": "Adam"}, wantErr: "Invalid API key"},
+		{name: "unknown name", listStatus: http.StatusOK, params: map[string]interface{}{"voice_name": "Nobody"}, wantErr: `no ElevenLabs voice named "Nobody"`},
+		{name: "no voice", listStatus: http.StatusOK, params: map[string]interface{}{}, wantErr: "voice_id or voice_name not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _, _ := elevenLabsServer(t, tt.listStatus)
+			s := NewElevenLabsService(slog.Default())
+			got, err := s.resolveVoice(context.Background(), server.URL+"/v1/text-to-speech/", "key", tt.params)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.VoiceID != tt.want.VoiceID || got.Name != tt.want.Name {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestElevenLabsErrorResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want ElevenLabsHttpError
+	}{
+		{
+			name: "detail",
+			body: `{"detail":{"status":"quota_exceeded","message":"Quota exceeded"}}`,
+			want: ElevenLabsHttpError{StatusCode: 429, Message: "Quota exceeded", ErrorType: "quota_exceeded"},
+		},
+		{
+			name: "not JSON",
+			body: "Bad Gateway",
+			want: ElevenLabsHttpError{StatusCode: 429, Message: "Bad Gateway", ErrorType: "unknown"},
+		},
+	}
+	s := NewElevenLabsService(slog.Default())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.handleErrorResponse(&http.Response{StatusCode: 429, Body: io.NopCloser(strings.NewReader(tt.body))})
+			var httpErr *ElevenLabsHttpError
+			if !errors.As(err, &httpErr) {
+				t.Fatalf("expected an ElevenLabsHttpError, got %v", err)
+			}
+			if httpErr.StatusCode != tt.want.StatusCode || httpErr.Message != tt.want.Message || httpErr.ErrorType != tt.want.ErrorType || httpErr.RawBody != tt.body {
+				t.Errorf("got %+v, want %+v", httpErr, tt.want)
+			}
+		})
+	}
+}
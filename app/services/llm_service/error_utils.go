@@ -21,10 +21,21 @@ type OpenAIHttpError struct {
     Message    string
     ErrorType  string
     RawBody    string
+    // Provider of an OpenAI compatible API, OpenAI when empty
+    Provider   string
 }
 
 func (e *OpenAIHttpError) Error() string {
-    return fmt.Sprintf("OpenAI API error (HTTP %d): %s (Type: %s)", e.StatusCode, e.Message, e.ErrorType)
+    provider := e.Provider
+    if provider == "" {
+        provider = "OpenAI"
+    }
+    return fmt.Sprintf("%s API error (HTTP %d): %s (Type: %s)", provider, e.StatusCode, e.Message, e.ErrorType)
+}
+
+// ProviderResponse returns the body OpenAI answered with.
+func (e *OpenAIHttpError) ProviderResponse() string {
+    return e.RawBody
 }
 
 // extractOpenAIErrorDetails extracts error information from OpenAI API responses
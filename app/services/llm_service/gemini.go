@@ -3,6 +3,7 @@ package llm_service
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -14,6 +15,7 @@ import (
 	"strings"
 	"time"
     envConfig "github.com/serisow/lesocle/config"
+    "github.com/serisow/lesocle/signedurl"
 )
 
 type GeminiService struct {
@@ -23,15 +25,14 @@ type GeminiService struct {
 
 func NewGeminiService(logger *slog.Logger) *GeminiService {
     return &GeminiService{
-        httpClient: &http.Client{Timeout: 120 * time.Second},
+        httpClient: newHTTPClient("gemini", 0),
         logger:     logger,
     }
 }
 
+// CallLLM generates text, or an image with the image models. The transport
+// retries the rate limited and failed calls.
 func (s *GeminiService) CallLLM(ctx context.Context, config map[string]interface{}, prompt string) (string, error) {
-    maxRetries := 3
-    retryDelay := 5 * time.Second
-
     // Check if this is an image generation request based on model name
     modelName, ok := config["model_name"].(string)
     if !ok {
@@ -42,38 +43,41 @@ func (s *GeminiService) CallLLM(ctx context.Context, config map[string]interface
     isImageRequest := strings.Contains(strings.ToLower(modelName), "image") || 
                       modelName == "gemini-2.0-flash-exp-image-generation"
 
-    for attempt := 1; attempt <= maxRetries; attempt++ {
-        var response string
-        var err error
-
-        if isImageRequest {
-            response, err = s.callGeminiImageGeneration(ctx, config, prompt)
-        } else {
-            response, err = s.callGemini(ctx, config, prompt)
-        }
-
-        if err == nil {
-            return response, nil
-        }
+    var response string
+    var err error
+    if isImageRequest {
+        response, err = s.callGeminiImageGeneration(ctx, config, prompt)
+    } else {
+        response, err = s.callGemini(ctx, config, prompt)
+    }
+    if err != nil {
+        s.logger.ErrorContext(ctx, "Error calling Gemini API",
+            slog.String("error", err.Error()),
+            slog.String("model", modelName))
+        return "", fmt.Errorf("failed to call Gemini API: %w", err)
+    }
+    return response, nil
+}
 
-        if attempt == maxRetries {
-            s.logger.Error("Error calling Gemini API after multiple attempts",
-                slog.Int("attempts", maxRetries),
-                slog.String("error",err.Error()))
-            return "", fmt.Errorf("failed to call Gemini API after %d attempts: %w", maxRetries, err)
-        }
+func (s *GeminiService) callGemini(ctx context.Context, config map[string]interface{}, prompt string) (string, error) {
+    return s.generateText(ctx, config, []Message{{Role: RoleUser, Content: prompt}})
+}
 
-        s.logger.Warn("Attempt failed, retrying",
-            slog.Int("attempt", attempt),
-            slog.Duration("retryDelay", retryDelay),
-            slog.String("error", err.Error()))
-        time.Sleep(retryDelay)
+// CallChat sends the conversation, the system messages as the system
+// instruction.
+func (s *GeminiService) CallChat(ctx context.Context, config map[string]interface{}, messages []Message) (string, error) {
+    response, err := s.generateText(ctx, config, messages)
+    if err != nil {
+        modelName, _ := config["model_name"].(string)
+        s.logger.ErrorContext(ctx, "Error calling Gemini API",
+            slog.String("error", err.Error()),
+            slog.String("model", modelName))
+        return "", fmt.Errorf("failed to call Gemini API: %w", err)
     }
-
-    return "", fmt.Errorf("failed to call Gemini API after exhausting all retry attempts")
+    return response, nil
 }
 
-func (s *GeminiService) callGemini(ctx context.Context, config map[string]interface{}, prompt string) (string, error) {
+func (s *GeminiService) generateText(ctx context.Context, config map[string]interface{}, messages []Message) (string, error) {
     apiURL, ok := config["api_url"].(string)
     if !ok {
         return "", fmt.Errorf("api_url not found in config")
@@ -86,28 +90,27 @@ func (s *GeminiService) callGemini(ctx context.Context, config map[string]interf
 
     url := fmt.Sprintf("%s?key=%s", apiURL, apiKey)
 
-    params, ok := config["parameters"].(map[string]interface{})
-    if !ok {
-        params = make(map[string]interface{})
-    }
+    params := Parameters(config)
 
+    system, contents := geminiContents(messages)
     payload := map[string]interface{}{
-        "contents": []map[string]interface{}{
-            {
-                "role": "user",
-                "parts": []map[string]string{
-                    {"text": prompt},
-                },
-            },
-        },
+        "contents": contents,
         "generationConfig": map[string]interface{}{
             "temperature":      safeParseFloat(params["temperature"], 1.0),
             "topK":             safeParseFloat(params["top_k"], 40),
             "topP":             safeParseFloat(params["top_p"], 0.95),
             "maxOutputTokens":  safeParseFloat(params["max_tokens"], 8192.0),
-            "responseMimeType": "text/plain",
+            "responseMimeType": geminiMimeType(config),
         },
     }
+    if seed, ok := params["seed"]; ok {
+        payload["generationConfig"].(map[string]interface{})["seed"] = int64(safeParseFloat(seed, 0))
+    }
+    if system != "" {
+        payload["systemInstruction"] = map[string]interface{}{
+            "parts": []map[string]string{{"text": system}},
+        }
+    }
 
     requestBody, err := json.Marshal(payload)
     if err != nil {
@@ -169,7 +172,7 @@ func (s *GeminiService) callGeminiImageGeneration(ctx context.Context, config ma
     apiURL, ok := config["api_url"].(string)
     if !ok || !strings.Contains(apiURL, correctModelName) {
         apiURL = correctAPIURL
-        s.logger.Info("Using correct Gemini image API URL", 
+        s.logger.InfoContext(ctx, "Using correct Gemini image API URL", 
             slog.String("api_url", apiURL))
     }
 
@@ -226,7 +229,7 @@ func (s *GeminiService) callGeminiImageGeneration(ctx context.Context, config ma
             "topK":             safeParseFloat(params["top_k"], 40),
             "topP":             safeParseFloat(params["top_p"], 0.95),
             "maxOutputTokens":  safeParseFloat(params["max_tokens"], 8192.0),
-            "responseMimeType": "text/plain",
+            "responseMimeType": geminiMimeType(config),
             "responseModalities": []string{"image", "text"},
         },
     }
@@ -265,7 +268,7 @@ func (s *GeminiService) callGeminiImageGeneration(ctx context.Context, config ma
         // Check if we got a text response instead
         textResponse, textErr := s.extractTextFromResponse(result)
         if textErr == nil {
-            s.logger.Warn("Gemini returned text instead of an image",
+            s.logger.WarnContext(ctx, "Gemini returned text instead of an image",
                 slog.String("text", textResponse[:min(200, len(textResponse))]))
             
             // Return error information in the same format as we'd return an image
@@ -459,7 +462,7 @@ func (s *GeminiService) downloadAndSaveImage(ctx context.Context, imageData stri
     cfg := envConfig.Load()
     
     // Create absolute download URL using the same fileID
-    absoluteDownloadURL := fmt.Sprintf("%s/api/images/%d", cfg.ServiceBaseURL, fileID)
+    absoluteDownloadURL := signedurl.Sign(fmt.Sprintf("%s/api/images/%d", cfg.ServiceBaseURL, fileID))
     
     // Get model name from config
     modelName, _ := config["model_name"].(string)
@@ -473,6 +476,7 @@ func (s *GeminiService) downloadAndSaveImage(ctx context.Context, imageData stri
         "filename": filename,
         "size": fileInfo.Size(),
         "timestamp": time.Now().Unix(),
+        "sha256": fmt.Sprintf("%x", sha256.Sum256(imageBytes)),
         "model_name": modelName,
         "service": "gemini",
     }
@@ -483,4 +487,40 @@ func (s *GeminiService) downloadAndSaveImage(ctx context.Context, imageData stri
     }
 
     return string(resultJSON), nil
-}
\ No newline at end of file
+}
+
+// geminiMimeType asks for JSON when the step expects an answer matching a
+// response schema.
+func geminiMimeType(config map[string]interface{}) string {
+    if _, ok := config[ResponseSchemaKey].(map[string]interface{}); ok {
+        return "application/json"
+    }
+    return "text/plain"
+}
+
+// geminiContents converts the messages to Gemini contents, where the
+// assistant is the "model" and turns of the same role are merged.
+func geminiContents(messages []Message) (string, []map[string]interface{}) {
+    var system string
+    var contents []map[string]interface{}
+    for _, m := range messages {
+        if m.Role == RoleSystem {
+            if system != "" {
+                system += "\n\n"
+            }
+            system += m.Content
+            continue
+        }
+        role := "user"
+        if m.Role == RoleAssistant {
+            role = "model"
+        }
+        part := map[string]string{"text": m.Content}
+        if last := len(contents) - 1; last >= 0 && contents[last]["role"] == role {
+            contents[last]["parts"] = append(contents[last]["parts"].([]map[string]string), part)
+            continue
+        }
+        contents = append(contents, map[string]interface{}{"role": role, "parts": []map[string]string{part}})
+    }
+    return system, contents
+}
@@ -0,0 +1,53 @@
+package llm_service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// GroqDefaultURL is the chat completions endpoint of Groq, used when the
+// step configures no api_url.
+const GroqDefaultURL = "https://api.groq.com/openai/v1/chat/completions"
+
+// GroqService calls the OpenAI compatible API of Groq. Its latency suits short
+// copy such as social posts.
+type GroqService struct {
+	httpClient *http.Client
+	logger     *slog.Logger
+}
+
+func NewGroqService(logger *slog.Logger) *GroqService {
+	return &GroqService{
+		// Groq answers in a few seconds, a stuck call shouldn't hold the step
+		httpClient: newHTTPClient("groq", 60*time.Second),
+		logger:     logger,
+	}
+}
+
+func (s *GroqService) CallLLM(ctx context.Context, config map[string]interface{}, prompt string) (string, error) {
+	apiKey, ok := config["api_key"].(string)
+	if !ok {
+		return "", fmt.Errorf("api_key not found in config")
+	}
+	modelName, ok := config["model_name"].(string)
+	if !ok {
+		return "", fmt.Errorf("model_name not found in config")
+	}
+	apiURL, _ := config["api_url"].(string)
+	if apiURL == "" {
+		apiURL = GroqDefaultURL
+	}
+
+	body := chatCompletionBody(config, modelName, prompt)
+	response, err := chatCompletion(ctx, s.httpClient, "Groq", apiURL, map[string]string{"Authorization": "Bearer " + apiKey}, body)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Error calling Groq API",
+			slog.String("error", err.Error()),
+			slog.String("model", modelName))
+		return "", fmt.Errorf("failed to call Groq API: %w", err)
+	}
+	return response, nil
+}
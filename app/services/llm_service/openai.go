@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"time"
 
 	 "log/slog"
 )
@@ -20,58 +19,42 @@ type OpenAIService struct {
 
 func NewOpenAIService(logger *slog.Logger) *OpenAIService {
     return &OpenAIService{
-        httpClient: &http.Client{Timeout: 120 * time.Second},
+        httpClient: newHTTPClient("openai", 0),
         logger:     logger,
     }
 }
 
+// CallLLM sends the prompt to the chat completions API. The transport retries
+// the rate limited and failed calls.
 func (s *OpenAIService) CallLLM(ctx context.Context, config map[string]interface{}, prompt string) (string, error) {
-    maxRetries := 3
-    retryDelay := 5 * time.Second
-
-    for attempt := 1; attempt <= maxRetries; attempt++ {
-
-        response, err := s.callOpenAI(ctx, config, prompt)
-        if err == nil {
-            return response, nil
-        }
+    response, err := s.callOpenAI(ctx, config, prompt)
+    if err == nil {
+        return response, nil
+    }
 
-        // Check if error contains OpenAI error details
-        if httpErr, ok := err.(*OpenAIHttpError); ok {
-            if httpErr.StatusCode == 429 {
-                s.logger.Error("OpenAI API quota exceeded",
-                    slog.String("error_type", httpErr.ErrorType),
-                    slog.String("error_message", httpErr.Message),
-                    slog.String("model", config["model_name"].(string)),
-                    slog.Int("status_code", httpErr.StatusCode))
-                return "", fmt.Errorf("OpenAI quota exceeded: %s (Type: %s)", httpErr.Message, httpErr.ErrorType)
-            }
-
-            s.logger.Error("OpenAI API error",
-                slog.Int("attempt", attempt),
-                slog.Int("status_code", httpErr.StatusCode),
+    modelName, _ := config["model_name"].(string)
+    // Check if error contains OpenAI error details
+    if httpErr, ok := err.(*OpenAIHttpError); ok {
+        if httpErr.StatusCode == 429 {
+            s.logger.ErrorContext(ctx, "OpenAI API quota exceeded",
                 slog.String("error_type", httpErr.ErrorType),
                 slog.String("error_message", httpErr.Message),
-                slog.String("raw_body", httpErr.RawBody))
+                slog.String("model", modelName),
+                slog.Int("status_code", httpErr.StatusCode))
+            return "", fmt.Errorf("OpenAI quota exceeded: %s (Type: %s)", httpErr.Message, httpErr.ErrorType)
         }
 
-        if attempt == maxRetries {
-            s.logger.Error("Error calling OpenAI API after multiple attempts",
-                slog.Int("attempts", maxRetries),
-                slog.String("error", err.Error()),
-                slog.String("model", config["model_name"].(string)))
-            return "", fmt.Errorf("failed to call OpenAI API after %d attempts: %w", maxRetries, err)
-        }
-
-        s.logger.Warn("Attempt failed, retrying",
-            slog.Int("attempt", attempt),
-            slog.Duration("retry_delay", retryDelay),
-            slog.String("error", err.Error()))
-
-        time.Sleep(retryDelay)
+        s.logger.ErrorContext(ctx, "OpenAI API error",
+            slog.Int("status_code", httpErr.StatusCode),
+            slog.String("error_type", httpErr.ErrorType),
+            slog.String("error_message", httpErr.Message),
+            slog.String("raw_body", httpErr.RawBody))
     }
 
-    return "", fmt.Errorf("failed to call OpenAI API after exhausting all retry attempts")
+    s.logger.ErrorContext(ctx, "Error calling OpenAI API",
+        slog.String("error", err.Error()),
+        slog.String("model", modelName))
+    return "", fmt.Errorf("failed to call OpenAI API: %w", err)
 }
 
 func (s *OpenAIService) callOpenAI(ctx context.Context, config map[string]interface{}, prompt string) (string, error) {
@@ -95,10 +78,15 @@ func (s *OpenAIService) callOpenAI(ctx context.Context, config map[string]interf
         {"role": "user", "content": prompt},
     }
 
-    requestBody, err := json.Marshal(map[string]interface{}{
+    payload := map[string]interface{}{
         "model":    modelName,
         "messages": messages,
-    })
+    }
+    setSampling(payload, Parameters(config))
+    if format := responseFormat(config); format != nil {
+        payload["response_format"] = format
+    }
+    requestBody, err := json.Marshal(payload)
     if err != nil {
         return "", fmt.Errorf("error marshaling request body: %w", err)
     }
@@ -0,0 +1,117 @@
+package llm_service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// chatCompletion calls the chat completions endpoint of an OpenAI compatible
+// API and returns the content of the first choice. Error responses are
+// returned as an *OpenAIHttpError of the provider.
+func chatCompletion(ctx context.Context, client *http.Client, provider, apiURL string, headers map[string]string, body map[string]interface{}) (string, error) {
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := postJSON(ctx, client, provider, apiURL, headers, body, &result); err != nil {
+		return "", err
+	}
+	if len(result.Choices) == 0 {
+		return "", fmt.Errorf("unexpected response format from %s API", provider)
+	}
+	return result.Choices[0].Message.Content, nil
+}
+
+// postJSON posts body and decodes the response into result. Error responses,
+// whose error object follows the OpenAI format at most providers, are
+// returned as an *OpenAIHttpError of the provider.
+func postJSON(ctx context.Context, client *http.Client, provider, apiURL string, headers map[string]string, body map[string]interface{}, result interface{}) error {
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("error marshaling request body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		rawBody, apiErr := extractOpenAIErrorDetails(resp)
+		httpErr := &OpenAIHttpError{
+			StatusCode: resp.StatusCode,
+			RawBody:    rawBody,
+			Message:    "Unknown error",
+			ErrorType:  "unknown",
+			Provider:   provider,
+		}
+		if apiErr != nil {
+			httpErr.Message = apiErr.Error.Message
+			httpErr.ErrorType = apiErr.Error.Type
+		}
+		return httpErr
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
+
+// chatCompletionBody builds the request body of a prompt, with the optional
+// sampling and max_tokens parameters of the step.
+func chatCompletionBody(config map[string]interface{}, modelName, prompt string) map[string]interface{} {
+	body := map[string]interface{}{
+		"model": modelName,
+		"messages": []map[string]string{
+			{"role": "user", "content": prompt},
+		},
+	}
+	params := Parameters(config)
+	setSampling(body, params)
+	if maxTokens, ok := params["max_tokens"]; ok {
+		if n := int(safeParseFloat(maxTokens, 0)); n > 0 {
+			body["max_tokens"] = n
+		}
+	}
+	if format := responseFormat(config); format != nil {
+		body["response_format"] = format
+	}
+	return body
+}
+
+// ResponseSchemaKey is the config key under which the LLM step passes the
+// JSON schema its answer must match.
+const ResponseSchemaKey = "response_schema"
+
+// responseFormat returns the response_format asking for an answer matching
+// the response schema of the config, nil without one.
+func responseFormat(config map[string]interface{}) map[string]interface{} {
+	schema, ok := config[ResponseSchemaKey].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return map[string]interface{}{
+		"type": "json_schema",
+		"json_schema": map[string]interface{}{
+			"name":   "response",
+			"schema": schema,
+		},
+	}
+}
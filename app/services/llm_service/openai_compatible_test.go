@@ -0,0 +1,130 @@
+package llm_service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChatCompletionProviders(t *testing.T) {
+	tests := []struct {
+		name     string
+		service  LLMService
+		config   map[string]interface{}
+		status   int
+		response string
+		want     string
+		wantErr  string
+		check    func(t *testing.T, r *http.Request, body map[string]interface{})
+	}{
+		{
+			name:     "groq success",
+			service:  NewGroqService(slog.Default()),
+			config:   map[string]interface{}{"parameters": map[string]interface{}{"max_tokens": "50"}},
+			status:   http.StatusOK,
+			response: `{"choices":[{"message":{"content":"Hello from Groq"}}]}`,
+			want:     "Hello from Groq",
+			check: func(t *testing.T, r *http.Request, body map[string]interface{}) {
+				if r.Header.Get("Authorization") != "Bearer key" {
+					t.Errorf("unexpected authorization %q", r.Header.Get("Authorization"))
+				}
+				if body["model"] != "test-model" || body["max_tokens"] != float64(50) {
+					t.Errorf("unexpected body %v", body)
+				}
+			},
+		},
+		{
+			name:    "openrouter success with fallbacks",
+			service: NewOpenRouterService(slog.Default()),
+			config: map[string]interface{}{
+				"site_url":   "https://example.com",
+				"parameters": map[string]interface{}{"fallback_models": "other-model"},
+			},
+			status:   http.StatusOK,
+			response: `{"choices":[{"message":{"content":"Hello from OpenRouter"}}]}`,
+			want:     "Hello from OpenRouter",
+			check: func(t *testing.T, r *http.Request, body map[string]interface{}) {
+				if r.Header.Get("HTTP-Referer") != "https://example.com" || r.Header.Get("X-Title") != "Lesocle" {
+					t.Errorf("unexpected headers %v", r.Header)
+				}
+				models, _ := body["models"].([]interface{})
+				if len(models) != 2 || models[0] != "test-model" || models[1] != "other-model" {
+					t.Errorf("unexpected models %v", body["models"])
+				}
+			},
+		},
+		{
+			name:     "groq error body",
+			service:  NewGroqService(slog.Default()),
+			status:   http.StatusUnauthorized,
+			response: `{"error":{"message":"Invalid API Key","type":"invalid_request_error"}}`,
+			wantErr:  "Invalid API Key",
+		},
+		{
+			name:     "openrouter error body",
+			service:  NewOpenRouterService(slog.Default()),
+			status:   http.StatusBadRequest,
+			response: `{"error":{"message":"model not found","type":"invalid_request_error"}}`,
+			wantErr:  "model not found",
+		},
+		{
+			name:     "groq empty choices",
+			service:  NewGroqService(slog.Default()),
+			status:   http.StatusOK,
+			response: `{"choices":[]}`,
+			wantErr:  "unexpected response format from Groq API",
+		},
+		{
+			name:     "openrouter empty choices",
+			service:  NewOpenRouterService(slog.Default()),
+			status:   http.StatusOK,
+			response: `{}`,
+			wantErr:  "unexpected response format from OpenRouter API",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]interface{}
+				json.NewDecoder(r.Body).Decode(&body)
+				if tt.check != nil {
+					tt.check(t, r, body)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			config := map[string]interface{}{"api_key": "key", "model_name": "test-model", "api_url": server.URL}
+			for k, v := range tt.config {
+				config[k] = v
+			}
+			got, err := tt.service.CallLLM(context.Background(), config, "Say hello")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				if tt.status != http.StatusOK {
+					var httpErr *OpenAIHttpError
+					if !errors.As(err, &httpErr) || httpErr.StatusCode != tt.status {
+						t.Errorf("expected an OpenAIHttpError with status %d, got %v", tt.status, err)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
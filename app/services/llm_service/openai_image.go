@@ -18,58 +18,56 @@ type OpenAIImageService struct {
 
 func NewOpenAIImageService(logger *slog.Logger) *OpenAIImageService {
     return &OpenAIImageService{
-        httpClient: &http.Client{Timeout: 4800 * time.Second}, // 80 minutes timeout as per PHP version
+        httpClient: newHTTPClient("openai_image", 4800*time.Second), // 80 minutes timeout as per PHP version
         logger:     logger,
     }
 }
 
+// CallLLM generates an image from the prompt, or with the edit and variation
+// modes of the mode parameter reworks the input image. The transport retries
+// the rate limited and failed calls.
 func (s *OpenAIImageService) CallLLM(ctx context.Context, config map[string]interface{}, prompt string) (string, error) {
-    maxRetries := 3
-    retryDelay := 5 * time.Second
-
-    for attempt := 1; attempt <= maxRetries; attempt++ {
-        response, err := s.callOpenAIImage(ctx, config, prompt)
-        if err == nil {
-            return response, nil
-        }
+    params, _ := config["parameters"].(map[string]interface{})
+    mode, _ := params["mode"].(string)
+    var response string
+    var err error
+    switch mode {
+    case "", ImageModeGenerate:
+        response, err = s.callOpenAIImage(ctx, config, prompt)
+    case ImageModeEdit, ImageModeVariation:
+        response, err = s.callOpenAIImageEdit(ctx, config, prompt, mode)
+    default:
+        return "", fmt.Errorf("unknown OpenAI image mode %q", mode)
+    }
+    if err == nil {
+        return response, nil
+    }
 
-        // Check if error contains OpenAI error details
-        if httpErr, ok := err.(*OpenAIHttpError); ok {
-            if httpErr.StatusCode == 429 {
-                s.logger.Error("OpenAI Image API quota exceeded",
-                    slog.String("error_type", httpErr.ErrorType),
-                    slog.String("error_message", httpErr.Message),
-                    slog.String("model", config["model_name"].(string)),
-                    slog.String("image_size", config["image_size"].(string)),
-                    slog.Int("status_code", httpErr.StatusCode))
-                return "", fmt.Errorf("OpenAI Image quota exceeded: %s (Type: %s)", httpErr.Message, httpErr.ErrorType)
-            }
-
-            s.logger.Error("OpenAI Image API error",
-                slog.Int("attempt", attempt),
-                slog.Int("status_code", httpErr.StatusCode),
+    modelName, _ := config["model_name"].(string)
+    // Check if error contains OpenAI error details
+    if httpErr, ok := err.(*OpenAIHttpError); ok {
+        if httpErr.StatusCode == 429 {
+            imageSize, _ := config["image_size"].(string)
+            s.logger.ErrorContext(ctx, "OpenAI Image API quota exceeded",
                 slog.String("error_type", httpErr.ErrorType),
                 slog.String("error_message", httpErr.Message),
-                slog.String("raw_body", httpErr.RawBody))
+                slog.String("model", modelName),
+                slog.String("image_size", imageSize),
+                slog.Int("status_code", httpErr.StatusCode))
+            return "", fmt.Errorf("OpenAI Image quota exceeded: %s (Type: %s)", httpErr.Message, httpErr.ErrorType)
         }
 
-        if attempt == maxRetries {
-            s.logger.Error("Error calling OpenAI Image API after multiple attempts",
-                slog.Int("attempts", maxRetries),
-                slog.String("error", err.Error()),
-                slog.String("model", config["model_name"].(string)))
-            return "", fmt.Errorf("failed to call OpenAI Image API after %d attempts: %w", maxRetries, err)
-        }
-
-        s.logger.Warn("Attempt failed, retrying",
-            slog.Int("attempt", attempt),
-            slog.Duration("retry_delay", retryDelay),
-            slog.String("error", err.Error()))
-
-        time.Sleep(retryDelay)
+        s.logger.ErrorContext(ctx, "OpenAI Image API error",
+            slog.Int("status_code", httpErr.StatusCode),
+            slog.String("error_type", httpErr.ErrorType),
+            slog.String("error_message", httpErr.Message),
+            slog.String("raw_body", httpErr.RawBody))
     }
 
-    return "", fmt.Errorf("failed to call OpenAI Image API after exhausting all retry attempts")
+    s.logger.ErrorContext(ctx, "Error calling OpenAI Image API",
+        slog.String("error", err.Error()),
+        slog.String("model", modelName))
+    return "", fmt.Errorf("failed to call OpenAI Image API: %w", err)
 }
 
 func (s *OpenAIImageService) callOpenAIImage(ctx context.Context, config map[string]interface{}, prompt string) (string, error) {
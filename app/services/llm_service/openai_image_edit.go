@@ -0,0 +1,286 @@
+package llm_service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	envConfig "github.com/serisow/lesocle/config"
+	"github.com/serisow/lesocle/signedurl"
+)
+
+// Config keys of the files the LLM step resolves from step outputs for the
+// services, a local path or a URL.
+const (
+	InputImageKey = "input_image"
+	InputMaskKey  = "input_mask"
+)
+
+// Image modes of the OpenAI image service.
+const (
+	ImageModeGenerate  = "generate"
+	ImageModeEdit      = "edit"
+	ImageModeVariation = "variation"
+)
+
+// callOpenAIImageEdit edits the input image, the region of the mask or of
+// the mask_region parameter only, or makes a variation of it.
+func (s *OpenAIImageService) callOpenAIImageEdit(ctx context.Context, config map[string]interface{}, prompt, mode string) (string, error) {
+	apiKey, ok := config["api_key"].(string)
+	if !ok {
+		return "", fmt.Errorf("api_key not found in config")
+	}
+	location, _ := config[InputImageKey].(string)
+	if location == "" {
+		return "", fmt.Errorf("the %s mode needs an input image, set the image_from parameter", mode)
+	}
+	params, _ := config["parameters"].(map[string]interface{})
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+
+	imageData, err := s.readImage(ctx, location)
+	if err != nil {
+		return "", fmt.Errorf("error reading the input image: %w", err)
+	}
+	imageData, bounds, err := toPNG(imageData)
+	if err != nil {
+		return "", fmt.Errorf("invalid input image: %w", err)
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	if err := writeFormFile(writer, "image", "image.png", imageData); err != nil {
+		return "", err
+	}
+	fields := map[string]string{"n": "1"}
+	if modelName, _ := config["model_name"].(string); modelName != "" {
+		fields["model"] = modelName
+	}
+	if size, ok := config["image_size"].(string); ok && size != "" {
+		fields["size"] = size
+	}
+	// gpt-image-1 always answers in base64 and refuses the parameter
+	if model := fields["model"]; !strings.HasPrefix(model, "gpt-image") {
+		fields["response_format"] = "url"
+	}
+
+	endpoint := "/variations"
+	if mode == ImageModeEdit {
+		endpoint = "/edits"
+		fields["prompt"] = prompt
+		mask, err := s.editMask(ctx, config, params, bounds)
+		if err != nil {
+			return "", err
+		}
+		if mask != nil {
+			if err := writeFormFile(writer, "mask", "mask.png", mask); err != nil {
+				return "", err
+			}
+		}
+	}
+	for name, value := range fields {
+		if err := writer.WriteField(name, value); err != nil {
+			return "", fmt.Errorf("error writing form field %s: %w", name, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return "", fmt.Errorf("error writing form: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, imageEndpoint(config, endpoint), bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		rawBody, openAIErr := extractOpenAIErrorDetails(resp)
+		httpErr := &OpenAIHttpError{StatusCode: resp.StatusCode, RawBody: rawBody, Message: "Unknown error", ErrorType: "unknown"}
+		if openAIErr != nil {
+			httpErr.Message = openAIErr.Error.Message
+			httpErr.ErrorType = openAIErr.Error.Type
+		}
+		return "", httpErr
+	}
+
+	var result struct {
+		Data []struct {
+			URL     string `json:"url"`
+			B64JSON string `json:"b64_json"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("error unmarshaling response: %w", err)
+	}
+	if len(result.Data) == 0 {
+		return "", fmt.Errorf("unexpected response format from OpenAI Image API")
+	}
+	if result.Data[0].URL != "" {
+		return result.Data[0].URL, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(result.Data[0].B64JSON)
+	if err != nil {
+		return "", fmt.Errorf("error decoding base64 image: %w", err)
+	}
+	modelName, _ := config["model_name"].(string)
+	return saveOpenAIImage(data, modelName)
+}
+
+// imageEndpoint returns the URL of an images endpoint, next to the
+// generations endpoint configured as api_url.
+func imageEndpoint(config map[string]interface{}, endpoint string) string {
+	apiURL, _ := config["api_url"].(string)
+	if strings.HasSuffix(apiURL, "/generations") {
+		return strings.TrimSuffix(apiURL, "/generations") + endpoint
+	}
+	return apiBase(config, "https://api.openai.com") + "/v1/images" + endpoint
+}
+
+// editMask returns the mask of an edit: the input mask, or one making the
+// mask_region parameter transparent, nil to let the model edit it all.
+func (s *OpenAIImageService) editMask(ctx context.Context, config, params map[string]interface{}, bounds image.Rectangle) ([]byte, error) {
+	if location, _ := config[InputMaskKey].(string); location != "" {
+		data, err := s.readImage(ctx, location)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the mask: %w", err)
+		}
+		data, _, err = toPNG(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mask: %w", err)
+		}
+		return data, nil
+	}
+	region, ok := params["mask_region"].(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	return regionMask(bounds, region)
+}
+
+// regionMask draws an opaque mask of the image size with the region, in
+// pixels or in fractions of the size when all its values are up to 1,
+// transparent.
+func regionMask(bounds image.Rectangle, region map[string]interface{}) ([]byte, error) {
+	x, y := getFloat64(region, "x", 0), getFloat64(region, "y", 0)
+	w, h := getFloat64(region, "width", 0), getFloat64(region, "height", 0)
+	if w <= 0 || h <= 0 {
+		return nil, fmt.Errorf("mask_region needs a width and a height")
+	}
+	if x <= 1 && y <= 1 && w <= 1 && h <= 1 {
+		x, w = x*float64(bounds.Dx()), w*float64(bounds.Dx())
+		y, h = y*float64(bounds.Dy()), h*float64(bounds.Dy())
+	}
+
+	mask := image.NewNRGBA(bounds)
+	draw.Draw(mask, bounds, image.NewUniform(color.NRGBA{A: 255}), image.Point{}, draw.Src)
+	hole := image.Rect(int(x), int(y), int(x+w), int(y+h)).Add(bounds.Min).Intersect(bounds)
+	draw.Draw(mask, hole, image.Transparent, image.Point{}, draw.Src)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, mask); err != nil {
+		return nil, fmt.Errorf("error encoding the mask: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// readImage reads an image from a URL or a local path.
+func (s *OpenAIImageService) readImage(ctx context.Context, location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return os.ReadFile(location)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download status %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// toPNG returns the image as PNG, the format of the edit endpoints, with its
+// bounds.
+func toPNG(data []byte) ([]byte, image.Rectangle, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, image.Rectangle{}, err
+	}
+	if format == "png" {
+		return data, img.Bounds(), nil
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, image.Rectangle{}, err
+	}
+	return buf.Bytes(), img.Bounds(), nil
+}
+
+func writeFormFile(writer *multipart.Writer, field, filename string, data []byte) error {
+	part, err := writer.CreateFormFile(field, filename)
+	if err != nil {
+		return fmt.Errorf("error creating form file %s: %w", field, err)
+	}
+	if _, err := part.Write(data); err != nil {
+		return fmt.Errorf("error writing form file %s: %w", field, err)
+	}
+	return nil
+}
+
+// saveOpenAIImage stores an image returned in base64 where the image route
+// serves it and returns its file info JSON.
+func saveOpenAIImage(data []byte, modelName string) (string, error) {
+	directory := filepath.Join("storage", "pipeline", "images", time.Now().Format("2006-01"))
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	fileID := time.Now().UnixNano()
+	filename := fmt.Sprintf("openai_img_%d.png", fileID)
+	outputPath := filepath.Join(directory, filename)
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write image data: %w", err)
+	}
+	result := map[string]interface{}{
+		"file_id":    fileID,
+		"uri":        outputPath,
+		"url":        signedurl.Sign(fmt.Sprintf("%s/api/images/%d", envConfig.Load().ServiceBaseURL, fileID)),
+		"mime_type":  "image/png",
+		"filename":   filename,
+		"size":       len(data),
+		"timestamp":  time.Now().Unix(),
+		"sha256":     fmt.Sprintf("%x", sha256.Sum256(data)),
+		"model_name": modelName,
+		"service":    "openai_image",
+	}
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling result: %w", err)
+	}
+	return string(resultJSON), nil
+}
@@ -0,0 +1,266 @@
+package llm_service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testImage encodes a 100x50 image with the encoder.
+func testImage(t *testing.T, encode func(io.Writer, image.Image) error) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 50))
+	for x := 0; x < 100; x++ {
+		for y := 0; y < 50; y++ {
+			img.Set(x, y, color.RGBA{R: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(w io.Writer, img image.Image) error { return jpeg.Encode(w, img, nil) }
+
+func TestImageEndpoint(t *testing.T) {
+	tests := []struct {
+		apiURL string
+		want   string
+	}{
+		{"", "https://api.openai.com/v1/images/edits"},
+		{"https://proxy.example.com/v1/images/generations", "https://proxy.example.com/v1/images/edits"},
+		{"https://proxy.example.com/openai", "https://proxy.example.com/v1/images/edits"},
+	}
+	for _, tt := range tests {
+		if got := imageEndpoint(map[string]interface{}{"api_url": tt.apiURL}, "/edits"); got != tt.want {
+			t.Errorf("imageEndpoint(%q) = %q, want %q", tt.apiURL, got, tt.want)
+		}
+	}
+}
+
+func TestRegionMask(t *testing.T) {
+	bounds := image.Rect(0, 0, 100, 50)
+	tests := []struct {
+		name        string
+		region      map[string]interface{}
+		transparent []image.Point
+		opaque      []image.Point
+		wantErr     bool
+	}{
+		{
+			name:        "pixels",
+			region:      map[string]interface{}{"x": float64(10), "y": float64(10), "width": float64(20), "height": float64(5)},
+			transparent: []image.Point{{10, 10}, {29, 14}},
+			opaque:      []image.Point{{9, 10}, {30, 14}, {10, 15}},
+		},
+		{
+			name:        "fractions",
+			region:      map[string]interface{}{"x": 0.5, "y": 0, "width": 0.5, "height": 1},
+			transparent: []image.Point{{50, 0}, {99, 49}},
+			opaque:      []image.Point{{49, 0}},
+		},
+		{
+			name:        "clipped to the image",
+			region:      map[string]interface{}{"x": float64(90), "y": float64(40), "width": float64(50), "height": float64(50)},
+			transparent: []image.Point{{99, 49}},
+			opaque:      []image.Point{{89, 39}},
+		},
+		{name: "no size", region: map[string]interface{}{"x": float64(10)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := regionMask(bounds, tt.region)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			mask, err := png.Decode(bytes.NewReader(data))
+			if err != nil || mask.Bounds() != bounds {
+				t.Fatalf("expected a PNG of the image size, got %v and %v", mask, err)
+			}
+			for _, p := range tt.transparent {
+				if _, _, _, a := mask.At(p.X, p.Y).RGBA(); a != 0 {
+					t.Errorf("expected %v transparent", p)
+				}
+			}
+			for _, p := range tt.opaque {
+				if _, _, _, a := mask.At(p.X, p.Y).RGBA(); a != 0xffff {
+					t.Errorf("expected %v opaque", p)
+				}
+			}
+		})
+	}
+}
+
+func TestToPNG(t *testing.T) {
+	pngData := testImage(t, png.Encode)
+	got, bounds, err := toPNG(pngData)
+	if err != nil || !bytes.Equal(got, pngData) || bounds.Dx() != 100 {
+		t.Errorf("expected the PNG kept, got %v", err)
+	}
+
+	got, bounds, err = toPNG(testImage(t, encodeJPEG))
+	if err != nil || bounds.Dx() != 100 || bounds.Dy() != 50 {
+		t.Fatalf("unexpected conversion: %v %v", bounds, err)
+	}
+	if _, format, err := image.Decode(bytes.NewReader(got)); err != nil || format != "png" {
+		t.Errorf("expected a PNG, got %q and %v", format, err)
+	}
+
+	if _, _, err := toPNG([]byte("not an image")); err == nil {
+		t.Error("expected an error for data that isn't an image")
+	}
+}
+
+// imageEditRequest is what the edit server received.
+type imageEditRequest struct {
+	path   string
+	fields map[string]string
+	files  map[string][]byte
+}
+
+func imageEditServer(t *testing.T, response string) (*httptest.Server, *imageEditRequest) {
+	received := &imageEditRequest{fields: map[string]string{}, files: map[string][]byte{}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/input.jpg" {
+			w.Write(testImage(t, encodeJPEG))
+			return
+		}
+		received.path = r.URL.Path
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("expected a multipart form: %v", err)
+		}
+		for name, values := range r.MultipartForm.Value {
+			received.fields[name] = values[0]
+		}
+		for name, headers := range r.MultipartForm.File {
+			f, _ := headers[0].Open()
+			received.files[name], _ = io.ReadAll(f)
+			f.Close()
+		}
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server, received
+}
+
+func TestOpenAIImageEdit(t *testing.T) {
+	server, received := imageEditServer(t, `{"data":[{"url":"https://images.example.com/edited.png"}]}`)
+	input := filepath.Join(t.TempDir(), "input.png")
+	os.WriteFile(input, testImage(t, png.Encode), 0644)
+
+	config := map[string]interface{}{
+		"api_key":     "key",
+		"api_url":     server.URL + "/v1/images/generations",
+		"model_name":  "dall-e-2",
+		"image_size":  "512x512",
+		InputImageKey: input,
+		"parameters": map[string]interface{}{
+			"mode":        ImageModeEdit,
+			"mask_region": map[string]interface{}{"x": 0.0, "y": 0.0, "width": 0.5, "height": 0.5},
+		},
+	}
+	got, err := NewOpenAIImageService(slog.Default()).CallLLM(context.Background(), config, "Add a hat")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "https://images.example.com/edited.png" {
+		t.Errorf("expected the image URL, got %q", got)
+	}
+	if received.path != "/v1/images/edits" || received.fields["prompt"] != "Add a hat" || received.fields["model"] != "dall-e-2" ||
+		received.fields["size"] != "512x512" || received.fields["response_format"] != "url" {
+		t.Errorf("unexpected request %s %v", received.path, received.fields)
+	}
+	mask, err := png.Decode(bytes.NewReader(received.files["mask"]))
+	if err != nil {
+		t.Fatalf("expected a mask: %v", err)
+	}
+	if _, _, _, a := mask.At(10, 10).RGBA(); a != 0 {
+		t.Error("expected the region transparent in the mask")
+	}
+	if len(received.files["image"]) == 0 {
+		t.Error("expected the image sent")
+	}
+}
+
+func TestOpenAIImageVariation(t *testing.T) {
+	inTempDir(t)
+	server, received := imageEditServer(t, `{"data":[{"b64_json":"`+base64.StdEncoding.EncodeToString([]byte("variation"))+`"}]}`)
+
+	config := map[string]interface{}{
+		"api_key":     "key",
+		"api_url":     server.URL + "/v1/images/generations",
+		"model_name":  "gpt-image-1",
+		InputImageKey: server.URL + "/input.jpg",
+		"parameters":  map[string]interface{}{"mode": ImageModeVariation},
+	}
+	got, err := NewOpenAIImageService(slog.Default()).CallLLM(context.Background(), config, "ignored")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if received.path != "/v1/images/variations" || received.fields["prompt"] != "" || received.fields["response_format"] != "" {
+		t.Errorf("unexpected request %s %v", received.path, received.fields)
+	}
+	if _, format, err := image.Decode(bytes.NewReader(received.files["image"])); err != nil || format != "png" {
+		t.Errorf("expected the JPEG input sent as PNG, got %q and %v", format, err)
+	}
+
+	var file map[string]interface{}
+	json.Unmarshal([]byte(got), &file)
+	if data, _ := os.ReadFile(file["uri"].(string)); string(data) != "variation" || file["model_name"] != "gpt-image-1" {
+		t.Errorf("expected the base64 image saved, got %v", file)
+	}
+}
+
+func TestOpenAIImageEditErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"message":"Invalid mask","type":"invalid_request_error"}}`))
+	}))
+	defer server.Close()
+	input := filepath.Join(t.TempDir(), "input.png")
+	os.WriteFile(input, testImage(t, png.Encode), 0644)
+
+	tests := []struct {
+		name    string
+		image   string
+		wantErr string
+	}{
+		{name: "no input image", wantErr: "needs an input image"},
+		{name: "missing file", image: filepath.Join(t.TempDir(), "missing.png"), wantErr: "error reading the input image"},
+		{name: "API error", image: input, wantErr: "Invalid mask"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := map[string]interface{}{
+				"api_key":     "key",
+				"api_url":     server.URL + "/v1/images/generations",
+				InputImageKey: tt.image,
+				"parameters":  map[string]interface{}{"mode": ImageModeEdit},
+			}
+			_, err := NewOpenAIImageService(slog.Default()).CallLLM(context.Background(), config, "Add a hat")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package llm_service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAITTSDefaultURL is the speech endpoint of OpenAI, used when the step
+// configures no api_url.
+const OpenAITTSDefaultURL = "https://api.openai.com/v1/audio/speech"
+
+// openAITTSMaxChars is the input limit of a speech request, longer texts are
+// synthesized in chunks.
+const openAITTSMaxChars = 4096
+
+// openAITTSChunkableFormats are the formats whose chunks play back
+// concatenated, the others have headers.
+var openAITTSChunkableFormats = map[string]bool{"mp3": true, "aac": true, "pcm": true}
+
+// OpenAITTSService converts text to speech with OpenAI. Its output is the
+// audio file info of the ElevenLabs and Polly services.
+type OpenAITTSService struct {
+	httpClient *http.Client
+	logger     *slog.Logger
+}
+
+func NewOpenAITTSService(logger *slog.Logger) *OpenAITTSService {
+	return &OpenAITTSService{
+		httpClient: newHTTPClient("openai_tts", 5*time.Minute),
+		logger:     logger,
+	}
+}
+
+// CallLLM converts the prompt to speech. The parameters are voice (alloy by
+// default), response_format (mp3 by default), speed (0.25 to 4) and, for the
+// gpt-4o TTS models, instructions on the tone.
+func (s *OpenAITTSService) CallLLM(ctx context.Context, config map[string]interface{}, prompt string) (string, error) {
+	response, err := s.callOpenAITTS(ctx, config, prompt)
+	if err != nil {
+		modelName, _ := config["model_name"].(string)
+		s.logger.ErrorContext(ctx, "Error calling OpenAI speech API",
+			slog.String("error", err.Error()),
+			slog.String("model", modelName))
+		return "", fmt.Errorf("failed to call OpenAI speech API: %w", err)
+	}
+	return response, nil
+}
+
+func (s *OpenAITTSService) callOpenAITTS(ctx context.Context, config map[string]interface{}, prompt string) (string, error) {
+	apiKey, ok := config["api_key"].(string)
+	if !ok {
+		return "", fmt.Errorf("api_key not found in config")
+	}
+	apiURL, _ := config["api_url"].(string)
+	if apiURL == "" {
+		apiURL = OpenAITTSDefaultURL
+	}
+	modelName, _ := config["model_name"].(string)
+	if modelName == "" {
+		modelName = "tts-1"
+	}
+	params, _ := config["parameters"].(map[string]interface{})
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	voice := getStringParam(params, "voice", "alloy")
+	format := getStringParam(params, "response_format", "mp3")
+	if _, ok := audioMimeTypes[format]; !ok {
+		return "", fmt.Errorf("unsupported response_format %q", format)
+	}
+
+	prompt = strings.TrimSpace(prompt)
+	if prompt == "" {
+		return "", fmt.Errorf("no text to convert to speech")
+	}
+	chunks := []string{prompt}
+	if len([]rune(prompt)) > openAITTSMaxChars {
+		if !openAITTSChunkableFormats[format] {
+			return "", fmt.Errorf("the text is over %d characters, which needs the mp3, aac or pcm format", openAITTSMaxChars)
+		}
+		var err error
+		if chunks, err = chunkPollyText(prompt, false, openAITTSMaxChars); err != nil {
+			return "", err
+		}
+	}
+
+	payload := map[string]interface{}{
+		"model":           modelName,
+		"voice":           voice,
+		"response_format": format,
+	}
+	settings := map[string]interface{}{}
+	if _, ok := params["speed"]; ok {
+		speed := clamp(getFloat64(params, "speed", 1), 0.25, 4)
+		payload["speed"] = speed
+		settings["speed"] = speed
+	}
+	if instructions := getStringParam(params, "instructions", ""); instructions != "" {
+		payload["instructions"] = instructions
+		settings["instructions"] = instructions
+	}
+
+	// The chunks are synthesized in order and their audio concatenated
+	var audio bytes.Buffer
+	for i, chunk := range chunks {
+		payload["input"] = chunk
+		if err := s.synthesize(ctx, apiURL, apiKey, payload, &audio); err != nil {
+			if len(chunks) > 1 {
+				return "", fmt.Errorf("chunk %d/%d: %w", i+1, len(chunks), err)
+			}
+			return "", err
+		}
+	}
+
+	info := &VoiceInfo{Provider: "openai_tts", ID: voice, Name: voice, Model: modelName}
+	if len(settings) > 0 {
+		info.Settings = settings
+	}
+	return saveAudioFile(&audio, "openai_tts", format, info)
+}
+
+// synthesize posts a speech request and appends the audio to w.
+func (s *OpenAITTSService) synthesize(ctx context.Context, apiURL, apiKey string, payload map[string]interface{}, w io.Writer) error {
+	requestBody, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshaling request body: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(requestBody))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		rawBody, openAIErr := extractOpenAIErrorDetails(resp)
+		httpErr := &OpenAIHttpError{StatusCode: resp.StatusCode, RawBody: rawBody}
+		if openAIErr != nil {
+			httpErr.Message = openAIErr.Error.Message
+			httpErr.ErrorType = openAIErr.Error.Type
+		} else {
+			httpErr.Message = "Unknown error"
+			httpErr.ErrorType = "unknown"
+		}
+		return httpErr
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("error reading audio: %w", err)
+	}
+	return nil
+}
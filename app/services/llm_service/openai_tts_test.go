@@ -0,0 +1,128 @@
+package llm_service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// openAITTSServer answers each speech request with its input length as
+// audio, recording the payloads.
+func openAITTSServer(t *testing.T) (*httptest.Server, *[]map[string]interface{}) {
+	var payloads []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"message":"Incorrect API key","type":"invalid_request_error"}}`))
+			return
+		}
+		var payload map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		payloads = append(payloads, payload)
+		w.Write([]byte("[" + payload["input"].(string)[:1] + "]"))
+	}))
+	t.Cleanup(server.Close)
+	return server, &payloads
+}
+
+func TestOpenAITTSSpeech(t *testing.T) {
+	inTempDir(t)
+	server, payloads := openAITTSServer(t)
+
+	config := map[string]interface{}{
+		"api_key":    "key",
+		"api_url":    server.URL,
+		"model_name": "gpt-4o-mini-tts",
+		"parameters": map[string]interface{}{"voice": "nova", "speed": "9", "instructions": "Cheerful"},
+	}
+	got, err := NewOpenAITTSService(slog.Default()).CallLLM(context.Background(), config, "  Hello there.  ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var file AudioFileResponse
+	json.Unmarshal([]byte(got), &file)
+	if file.MimeType != "audio/mpeg" || file.Voice == nil || file.Voice.ID != "nova" || file.Voice.Model != "gpt-4o-mini-tts" {
+		t.Errorf("unexpected audio file %+v", file)
+	}
+	if data, _ := os.ReadFile(file.URI); string(data) != "[H]" {
+		t.Errorf("expected the audio saved, got %q", data)
+	}
+	if len(*payloads) != 1 {
+		t.Fatalf("expected a single request, got %d", len(*payloads))
+	}
+	payload := (*payloads)[0]
+	if payload["input"] != "Hello there." || payload["speed"] != float64(4) || payload["instructions"] != "Cheerful" || payload["response_format"] != "mp3" {
+		t.Errorf("unexpected payload %v", payload)
+	}
+}
+
+func TestOpenAITTSChunksLongText(t *testing.T) {
+	inTempDir(t)
+	server, payloads := openAITTSServer(t)
+
+	sentence := strings.Repeat("word ", 99) + "end. "
+	text := "A" + strings.Repeat(sentence, 9) + "Z" + strings.Repeat(sentence, 9)
+	config := map[string]interface{}{"api_key": "key", "api_url": server.URL}
+	got, err := NewOpenAITTSService(slog.Default()).CallLLM(context.Background(), config, text)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*payloads) < 2 {
+		t.Fatalf("expected the text synthesized in chunks, got %d requests", len(*payloads))
+	}
+	var chunks []string
+	for _, payload := range *payloads {
+		input := payload["input"].(string)
+		if len([]rune(input)) > openAITTSMaxChars {
+			t.Errorf("chunk of %d characters", len([]rune(input)))
+		}
+		chunks = append(chunks, input)
+	}
+	if strings.Join(strings.Fields(strings.Join(chunks, " ")), " ") != strings.Join(strings.Fields(text), " ") {
+		t.Error("expected the chunks to cover the text in order")
+	}
+
+	var file AudioFileResponse
+	json.Unmarshal([]byte(got), &file)
+	if data, _ := os.ReadFile(file.URI); !strings.HasPrefix(string(data), "[A]") || int(file.Size) != 3*len(*payloads) {
+		t.Errorf("expected the chunk audio concatenated, got %q", data)
+	}
+}
+
+func TestOpenAITTSErrors(t *testing.T) {
+	server, _ := openAITTSServer(t)
+	long := strings.Repeat("word ", openAITTSMaxChars)
+
+	tests := []struct {
+		name    string
+		apiKey  string
+		params  map[string]interface{}
+		text    string
+		wantErr string
+	}{
+		{name: "API error", apiKey: "wrong", text: "Hello", wantErr: "Incorrect API key"},
+		{name: "format", apiKey: "key", params: map[string]interface{}{"response_format": "midi"}, text: "Hello", wantErr: `unsupported response_format "midi"`},
+		{name: "empty text", apiKey: "key", text: "   ", wantErr: "no text"},
+		{name: "long text in a format with headers", apiKey: "key", params: map[string]interface{}{"response_format": "wav"}, text: long, wantErr: "needs the mp3, aac or pcm format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := map[string]interface{}{"api_key": tt.apiKey, "api_url": server.URL, "parameters": tt.params}
+			_, err := NewOpenAITTSService(slog.Default()).CallLLM(context.Background(), config, tt.text)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+			var httpErr *OpenAIHttpError
+			if tt.name == "API error" && (!errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusUnauthorized) {
+				t.Errorf("expected an OpenAIHttpError, got %v", err)
+			}
+		})
+	}
+}
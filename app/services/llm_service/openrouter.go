@@ -0,0 +1,88 @@
+package llm_service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// OpenRouterDefaultURL is the chat completions endpoint of OpenRouter, used
+// when the step configures no api_url.
+const OpenRouterDefaultURL = "https://openrouter.ai/api/v1/chat/completions"
+
+// OpenRouterService calls the models of many providers with a single
+// OpenRouter key. The model_name of the step is the OpenRouter model ID such
+// as "anthropic/claude-3.5-sonnet", the optional "fallback_models" parameter
+// lists the models OpenRouter tries when it is unavailable.
+type OpenRouterService struct {
+	httpClient *http.Client
+	logger     *slog.Logger
+}
+
+func NewOpenRouterService(logger *slog.Logger) *OpenRouterService {
+	return &OpenRouterService{
+		httpClient: newHTTPClient("openrouter", 0),
+		logger:     logger,
+	}
+}
+
+func (s *OpenRouterService) CallLLM(ctx context.Context, config map[string]interface{}, prompt string) (string, error) {
+	apiKey, ok := config["api_key"].(string)
+	if !ok {
+		return "", fmt.Errorf("api_key not found in config")
+	}
+	modelName, ok := config["model_name"].(string)
+	if !ok {
+		return "", fmt.Errorf("model_name not found in config")
+	}
+	apiURL, _ := config["api_url"].(string)
+	if apiURL == "" {
+		apiURL = OpenRouterDefaultURL
+	}
+
+	body := chatCompletionBody(config, modelName, prompt)
+	if fallbacks := openRouterFallbacks(config); len(fallbacks) > 0 {
+		body["models"] = append([]string{modelName}, fallbacks...)
+	}
+	headers := map[string]string{
+		"Authorization": "Bearer " + apiKey,
+		// Attribution of the requests on the OpenRouter dashboard
+		"X-Title": "Lesocle",
+	}
+	if siteURL, _ := config["site_url"].(string); siteURL != "" {
+		headers["HTTP-Referer"] = siteURL
+	}
+
+	response, err := chatCompletion(ctx, s.httpClient, "OpenRouter", apiURL, headers, body)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Error calling OpenRouter API",
+			slog.String("error", err.Error()),
+			slog.String("model", modelName))
+		return "", fmt.Errorf("failed to call OpenRouter API: %w", err)
+	}
+	return response, nil
+}
+
+// openRouterFallbacks reads the fallback_models parameter, a list or a comma
+// separated string.
+func openRouterFallbacks(config map[string]interface{}) []string {
+	params, _ := config["parameters"].(map[string]interface{})
+	var models []string
+	switch v := params["fallback_models"].(type) {
+	case []interface{}:
+		for _, m := range v {
+			if model, ok := m.(string); ok && strings.TrimSpace(model) != "" {
+				models = append(models, strings.TrimSpace(model))
+			}
+		}
+	case string:
+		for _, model := range strings.Split(v, ",") {
+			if model = strings.TrimSpace(model); model != "" {
+				models = append(models, model)
+			}
+		}
+	}
+	return models
+}
@@ -0,0 +1,389 @@
+package llm_service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	envConfig "github.com/serisow/lesocle/config"
+	"github.com/serisow/lesocle/signedurl"
+)
+
+// ReplicateDefaultURL is the base URL of the Replicate API, used when the step
+// configures no api_url.
+const ReplicateDefaultURL = "https://api.replicate.com"
+
+// Replicate prediction statuses.
+const (
+	replicateSucceeded = "succeeded"
+	replicateFailed    = "failed"
+	replicateCanceled  = "canceled"
+)
+
+// ReplicateService runs any model hosted on Replicate. The model_name is
+// "owner/name" for the official models or "owner/name:version". The file
+// outputs (images, videos, audio) are downloaded and returned as file info,
+// the others as text or JSON.
+type ReplicateService struct {
+	httpClient *http.Client
+	logger     *slog.Logger
+}
+
+func NewReplicateService(logger *slog.Logger) *ReplicateService {
+	return &ReplicateService{
+		// Predictions are polled, a single call is short but downloads are big
+		httpClient: newHTTPClient("replicate", 10*time.Minute),
+		logger:     logger,
+	}
+}
+
+// replicatePrediction is the state of a prediction.
+type replicatePrediction struct {
+	ID     string          `json:"id"`
+	Status string          `json:"status"`
+	Output json.RawMessage `json:"output"`
+	Error  interface{}     `json:"error"`
+	URLs   struct {
+		Get    string `json:"get"`
+		Cancel string `json:"cancel"`
+	} `json:"urls"`
+}
+
+// CallLLM runs the model on the prompt. The parameters are:
+//   - input: the model input, its string values may embed {prompt}
+//   - prompt_field: the input the prompt goes to when no value embeds it,
+//     "prompt" by default
+//   - input_types: the type (integer, number, boolean, string or json) of
+//     inputs configured as strings
+//   - poll_interval and timeout: in seconds, 2 and 600 by default
+func (s *ReplicateService) CallLLM(ctx context.Context, config map[string]interface{}, prompt string) (string, error) {
+	modelName, _ := config["model_name"].(string)
+	response, err := s.callReplicate(ctx, config, modelName, prompt)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Error calling Replicate API",
+			slog.String("error", err.Error()),
+			slog.String("model", modelName))
+		return "", fmt.Errorf("failed to call Replicate API: %w", err)
+	}
+	return response, nil
+}
+
+func (s *ReplicateService) callReplicate(ctx context.Context, config map[string]interface{}, modelName, prompt string) (string, error) {
+	apiKey, ok := config["api_key"].(string)
+	if !ok {
+		return "", fmt.Errorf("api_key not found in config")
+	}
+	if modelName == "" {
+		return "", fmt.Errorf("model_name not found in config")
+	}
+	baseURL, _ := config["api_url"].(string)
+	if baseURL == "" {
+		baseURL = ReplicateDefaultURL
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	params, _ := config["parameters"].(map[string]interface{})
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+
+	input, err := replicateInput(params, prompt)
+	if err != nil {
+		return "", err
+	}
+	model, version, _ := strings.Cut(modelName, ":")
+	createURL := baseURL + "/v1/models/" + model + "/predictions"
+	body := map[string]interface{}{"input": input}
+	if version != "" {
+		createURL = baseURL + "/v1/predictions"
+		body["version"] = version
+	}
+
+	var prediction replicatePrediction
+	if err := s.request(ctx, http.MethodPost, createURL, apiKey, body, &prediction); err != nil {
+		return "", err
+	}
+
+	interval := time.Duration(getFloat64(params, "poll_interval", 2) * float64(time.Second))
+	timeout := time.Duration(getFloat64(params, "timeout", 600) * float64(time.Second))
+	deadline := time.Now().Add(timeout)
+	for !replicateDone(prediction.Status) {
+		if time.Now().After(deadline) {
+			s.cancel(prediction.URLs.Cancel, apiKey)
+			return "", fmt.Errorf("prediction %s still %s after %s", prediction.ID, prediction.Status, timeout)
+		}
+		select {
+		case <-ctx.Done():
+			s.cancel(prediction.URLs.Cancel, apiKey)
+			return "", ctx.Err()
+		case <-time.After(interval):
+		}
+		if err := s.request(ctx, http.MethodGet, prediction.URLs.Get, apiKey, nil, &prediction); err != nil {
+			if ctx.Err() != nil {
+				s.cancel(prediction.URLs.Cancel, apiKey)
+			}
+			return "", err
+		}
+	}
+	if prediction.Status != replicateSucceeded {
+		return "", fmt.Errorf("prediction %s %s: %v", prediction.ID, prediction.Status, prediction.Error)
+	}
+	return s.output(ctx, prediction, modelName)
+}
+
+func replicateDone(status string) bool {
+	return status == replicateSucceeded || status == replicateFailed || status == replicateCanceled
+}
+
+// replicateInput builds the model input from the input parameter, the
+// prompt and the input types.
+func replicateInput(params map[string]interface{}, prompt string) (map[string]interface{}, error) {
+	configured, _ := params["input"].(map[string]interface{})
+	types, _ := params["input_types"].(map[string]interface{})
+	input := make(map[string]interface{}, len(configured)+1)
+	placed := false
+	for name, value := range configured {
+		if s, ok := value.(string); ok {
+			if strings.Contains(s, "{prompt}") {
+				placed = true
+				value = strings.ReplaceAll(s, "{prompt}", prompt)
+			}
+		}
+		typ, _ := types[name].(string)
+		converted, err := convertReplicateInput(value, typ)
+		if err != nil {
+			return nil, fmt.Errorf("input %s: %w", name, err)
+		}
+		input[name] = converted
+	}
+	if !placed {
+		input[getStringParam(params, "prompt_field", "prompt")] = prompt
+	}
+	return input, nil
+}
+
+// convertReplicateInput converts an input configured as a string to its type.
+func convertReplicateInput(value interface{}, typ string) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok || typ == "" || typ == "string" {
+		return value, nil
+	}
+	s = strings.TrimSpace(s)
+	switch typ {
+	case "integer":
+		return strconv.ParseInt(s, 10, 64)
+	case "number":
+		return strconv.ParseFloat(s, 64)
+	case "boolean":
+		return strconv.ParseBool(s)
+	case "json":
+		var v interface{}
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("unknown input type %q", typ)
+}
+
+// output renders the output of a prediction: the files it links to are
+// downloaded and returned as file info, a list of them as a JSON array, text
+// streamed as a list of tokens is joined and anything else is JSON.
+func (s *ReplicateService) output(ctx context.Context, prediction replicatePrediction, modelName string) (string, error) {
+	var output interface{}
+	if err := json.Unmarshal(prediction.Output, &output); err != nil {
+		return "", fmt.Errorf("error unmarshaling output: %w", err)
+	}
+
+	var urls []string
+	switch v := output.(type) {
+	case string:
+		if !isHTTPURL(v) {
+			return v, nil
+		}
+		urls = []string{v}
+	case []interface{}:
+		var text strings.Builder
+		for _, item := range v {
+			str, ok := item.(string)
+			if !ok {
+				return string(prediction.Output), nil
+			}
+			if isHTTPURL(str) {
+				urls = append(urls, str)
+			} else {
+				text.WriteString(str)
+			}
+		}
+		if len(urls) == 0 {
+			return text.String(), nil
+		}
+	default:
+		return string(prediction.Output), nil
+	}
+
+	files := make([]map[string]interface{}, 0, len(urls))
+	for _, u := range urls {
+		file, err := s.download(ctx, u, prediction.ID, modelName)
+		if err != nil {
+			return "", err
+		}
+		files = append(files, file)
+	}
+	var result interface{} = files
+	if len(files) == 1 {
+		result = files[0]
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling result: %w", err)
+	}
+	return string(data), nil
+}
+
+func isHTTPURL(s string) bool {
+	return strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "http://")
+}
+
+// download stores an output file with the media of its kind: images where the
+// image route serves them, videos and audio in their own directories.
+func (s *ReplicateService) download(ctx context.Context, fileURL, predictionID, modelName string) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating download request: %w", err)
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading output: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error downloading output, status: %d", resp.StatusCode)
+	}
+
+	mimeType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	ext := strings.TrimPrefix(path.Ext(path.Base(req.URL.Path)), ".")
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		mimeType = mime.TypeByExtension("." + ext)
+	}
+	if ext == "" {
+		if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+			ext = strings.TrimPrefix(exts[0], ".")
+		}
+	}
+	kind, prefix := "files", "replicate"
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		kind, prefix = "images", "replicate_img"
+	case strings.HasPrefix(mimeType, "video/"):
+		kind = "videos"
+	case strings.HasPrefix(mimeType, "audio/"):
+		kind = "audio"
+	}
+
+	directory := filepath.Join("storage", "pipeline", kind, time.Now().Format("2006-01"))
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	fileID := time.Now().UnixNano()
+	filename := fmt.Sprintf("%s_%d.%s", prefix, fileID, ext)
+	outputPath := filepath.Join(directory, filename)
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer file.Close()
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(file, hash), resp.Body)
+	if err != nil {
+		file.Close()
+		os.Remove(outputPath) // Clean up on error
+		return nil, fmt.Errorf("failed to write output: %w", err)
+	}
+
+	url := fmt.Sprintf("/storage/pipeline/%s/%s/%s", kind, time.Now().Format("2006-01"), filename)
+	if kind == "images" {
+		url = signedurl.Sign(fmt.Sprintf("%s/api/images/%d", envConfig.Load().ServiceBaseURL, fileID))
+	}
+	return map[string]interface{}{
+		"file_id":       fileID,
+		"uri":           outputPath,
+		"url":           url,
+		"mime_type":     mimeType,
+		"filename":      filename,
+		"size":          written,
+		"timestamp":     time.Now().Unix(),
+		"sha256":        fmt.Sprintf("%x", hash.Sum(nil)),
+		"model_name":    modelName,
+		"service":       "replicate",
+		"prediction_id": predictionID,
+	}, nil
+}
+
+// request calls the API, decoding the JSON answer into result.
+func (s *ReplicateService) request(ctx context.Context, method, url, apiKey string, body interface{}, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("error marshaling request body: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response body: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr struct {
+			Detail string `json:"detail"`
+		}
+		json.Unmarshal(data, &apiErr)
+		if apiErr.Detail == "" {
+			apiErr.Detail = string(data)
+		}
+		return fmt.Errorf("Replicate API error (HTTP %d): %s", resp.StatusCode, apiErr.Detail)
+	}
+	if err := json.Unmarshal(data, result); err != nil {
+		return fmt.Errorf("error unmarshaling response: %w", err)
+	}
+	return nil
+}
+
+// cancel stops a prediction the step gave up on, so it isn't billed further.
+func (s *ReplicateService) cancel(cancelURL, apiKey string) {
+	if cancelURL == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var prediction replicatePrediction
+	if err := s.request(ctx, http.MethodPost, cancelURL, apiKey, map[string]interface{}{}, &prediction); err != nil {
+		s.logger.Warn("Failed to cancel Replicate prediction", slog.String("error", err.Error()))
+	}
+}
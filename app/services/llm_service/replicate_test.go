@@ -0,0 +1,314 @@
+package llm_service
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// inTempDir runs the test in a temporary directory, where the services store
+// the files they download.
+func inTempDir(t *testing.T) string {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+func TestReplicateInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  map[string]interface{}
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name:   "prompt field by default",
+			params: map[string]interface{}{},
+			want:   map[string]interface{}{"prompt": "a cat"},
+		},
+		{
+			name:   "configured prompt field",
+			params: map[string]interface{}{"prompt_field": "text"},
+			want:   map[string]interface{}{"text": "a cat"},
+		},
+		{
+			name: "prompt embedded in an input",
+			params: map[string]interface{}{
+				"input": map[string]interface{}{"caption": "Photo of {prompt}, {prompt}", "steps": float64(20)},
+			},
+			want: map[string]interface{}{"caption": "Photo of a cat, a cat", "steps": float64(20)},
+		},
+		{
+			name: "typed inputs",
+			params: map[string]interface{}{
+				"input": map[string]interface{}{
+					"num_outputs": " 2 ",
+					"guidance":    "7.5",
+					"upscale":     "true",
+					"size":        `{"width":512}`,
+					"style":       "photo",
+				},
+				"input_types": map[string]interface{}{
+					"num_outputs": "integer",
+					"guidance":    "number",
+					"upscale":     "boolean",
+					"size":        "json",
+					"style":       "string",
+				},
+			},
+			want: map[string]interface{}{
+				"num_outputs": int64(2),
+				"guidance":    7.5,
+				"upscale":     true,
+				"size":        map[string]interface{}{"width": float64(512)},
+				"style":       "photo",
+				"prompt":      "a cat",
+			},
+		},
+		{
+			name: "invalid integer",
+			params: map[string]interface{}{
+				"input":       map[string]interface{}{"num_outputs": "two"},
+				"input_types": map[string]interface{}{"num_outputs": "integer"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown type",
+			params: map[string]interface{}{
+				"input":       map[string]interface{}{"seed": "1"},
+				"input_types": map[string]interface{}{"seed": "uint"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := replicateInput(tt.params, "a cat")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertReplicateInputKeepsNonStrings(t *testing.T) {
+	got, err := convertReplicateInput(float64(3), "integer")
+	if err != nil || got != float64(3) {
+		t.Errorf("expected the number kept, got %v and %v", got, err)
+	}
+}
+
+// replicateServer serves a prediction that is processing for the first
+// polls, then has the final status and output. It counts the polls and
+// the cancels.
+type replicateServer struct {
+	*httptest.Server
+	processing int32
+	final      string
+	output     string
+	polls      int32
+	cancels    int32
+	created    map[string]interface{}
+	createPath string
+}
+
+func newReplicateServer(t *testing.T, processing int32, final, output string) *replicateServer {
+	rs := &replicateServer{processing: processing, final: final, output: output}
+	rs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" {
+			http.Error(w, `{"detail":"Unauthenticated"}`, http.StatusUnauthorized)
+			return
+		}
+		status, output := "processing", "null"
+		switch {
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/cancel"):
+			atomic.AddInt32(&rs.cancels, 1)
+			status = "canceled"
+		case r.Method == http.MethodPost:
+			rs.createPath = r.URL.Path
+			json.NewDecoder(r.Body).Decode(&rs.created)
+			status = "starting"
+		case atomic.AddInt32(&rs.polls, 1) > rs.processing:
+			status, output = rs.final, rs.output
+		}
+		w.Write([]byte(`{"id":"p1","status":"` + status + `","output":` + output + `,"error":null,` +
+			`"urls":{"get":"` + rs.URL + `/v1/predictions/p1","cancel":"` + rs.URL + `/v1/predictions/p1/cancel"}}`))
+	}))
+	t.Cleanup(rs.Close)
+	return rs
+}
+
+func replicateConfig(url, model string, params map[string]interface{}) map[string]interface{} {
+	params["poll_interval"] = "0.001"
+	return map[string]interface{}{"api_key": "key", "api_url": url, "model_name": model, "parameters": params}
+}
+
+func TestReplicatePolling(t *testing.T) {
+	server := newReplicateServer(t, 2, replicateSucceeded, `["Hello", " world"]`)
+	s := NewReplicateService(slog.Default())
+
+	got, err := s.CallLLM(context.Background(), replicateConfig(server.URL, "meta/llama-3", map[string]interface{}{}), "Say hello")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "Hello world" {
+		t.Errorf("expected the streamed tokens joined, got %q", got)
+	}
+	if server.createPath != "/v1/models/meta/llama-3/predictions" || server.polls != 3 {
+		t.Errorf("unexpected create path %q after %d polls", server.createPath, server.polls)
+	}
+	if input, _ := server.created["input"].(map[string]interface{}); input["prompt"] != "Say hello" {
+		t.Errorf("unexpected input %v", server.created)
+	}
+}
+
+func TestReplicatePinnedVersion(t *testing.T) {
+	server := newReplicateServer(t, 0, replicateSucceeded, `"done"`)
+	s := NewReplicateService(slog.Default())
+
+	if _, err := s.CallLLM(context.Background(), replicateConfig(server.URL, "owner/model:abc123", map[string]interface{}{}), "go"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if server.createPath != "/v1/predictions" || server.created["version"] != "abc123" {
+		t.Errorf("expected the version created at /v1/predictions, got %q %v", server.createPath, server.created)
+	}
+}
+
+func TestReplicateFailedPrediction(t *testing.T) {
+	server := newReplicateServer(t, 0, replicateFailed, "null")
+	s := NewReplicateService(slog.Default())
+
+	_, err := s.CallLLM(context.Background(), replicateConfig(server.URL, "owner/model", map[string]interface{}{}), "go")
+	if err == nil || !strings.Contains(err.Error(), "prediction p1 failed") {
+		t.Errorf("expected the failure reported, got %v", err)
+	}
+}
+
+func TestReplicateTimeoutCancelsPrediction(t *testing.T) {
+	server := newReplicateServer(t, 1<<30, replicateSucceeded, "null")
+	s := NewReplicateService(slog.Default())
+
+	_, err := s.CallLLM(context.Background(), replicateConfig(server.URL, "owner/model", map[string]interface{}{"timeout": "0.05"}), "go")
+	if err == nil || !strings.Contains(err.Error(), "still processing") {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+	if atomic.LoadInt32(&server.cancels) != 1 {
+		t.Errorf("expected the prediction canceled, got %d cancels", server.cancels)
+	}
+}
+
+func TestReplicateContextCancelCancelsPrediction(t *testing.T) {
+	server := newReplicateServer(t, 1<<30, replicateSucceeded, "null")
+	s := NewReplicateService(slog.Default())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := s.CallLLM(ctx, replicateConfig(server.URL, "owner/model", map[string]interface{}{"poll_interval": "0.01"}), "go")
+	if err == nil || ctx.Err() == nil {
+		t.Fatalf("expected the call to stop with its context, got %v", err)
+	}
+	if atomic.LoadInt32(&server.cancels) != 1 {
+		t.Errorf("expected the prediction canceled, got %d cancels", server.cancels)
+	}
+}
+
+func TestReplicateOutput(t *testing.T) {
+	inTempDir(t)
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/out.png":
+			w.Header().Set("Content-Type", "image/png")
+		case "/out.mp4":
+			w.Header().Set("Content-Type", "application/octet-stream")
+		case "/missing.wav":
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("data"))
+	}))
+	defer files.Close()
+
+	tests := []struct {
+		name    string
+		output  string
+		want    string
+		kinds   []string
+		wantErr bool
+	}{
+		{name: "text", output: `"Hello"`, want: "Hello"},
+		{name: "streamed tokens", output: `["Hel", "lo"]`, want: "Hello"},
+		{name: "object", output: `{"score":0.9}`, want: `{"score":0.9}`},
+		{name: "list of objects", output: `[{"label":"cat"}]`, want: `[{"label":"cat"}]`},
+		{name: "image", output: `"` + files.URL + `/out.png"`, kinds: []string{"image/png"}},
+		{name: "files", output: `["` + files.URL + `/out.png", "` + files.URL + `/out.mp4"]`, kinds: []string{"image/png", "video/mp4"}},
+		{name: "missing file", output: `"` + files.URL + `/missing.wav"`, wantErr: true},
+	}
+
+	s := NewReplicateService(slog.Default())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.output(context.Background(), replicatePrediction{ID: "p1", Output: json.RawMessage(tt.output)}, "owner/model")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.kinds == nil {
+				if got != tt.want {
+					t.Errorf("got %q, want %q", got, tt.want)
+				}
+				return
+			}
+
+			var result []map[string]interface{}
+			if len(tt.kinds) == 1 {
+				var file map[string]interface{}
+				json.Unmarshal([]byte(got), &file)
+				result = append(result, file)
+			} else {
+				json.Unmarshal([]byte(got), &result)
+			}
+			if len(result) != len(tt.kinds) {
+				t.Fatalf("expected %d files, got %s", len(tt.kinds), got)
+			}
+			for i, file := range result {
+				if file["mime_type"] != tt.kinds[i] || file["prediction_id"] != "p1" || file["size"] != float64(4) {
+					t.Errorf("unexpected file %v", file)
+				}
+				if _, err := os.Stat(file["uri"].(string)); err != nil {
+					t.Errorf("expected the file downloaded: %v", err)
+				}
+			}
+		})
+	}
+}
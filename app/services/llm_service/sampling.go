@@ -0,0 +1,91 @@
+package llm_service
+
+import "fmt"
+
+// SamplingPresetKey is the parameter choosing a sampling preset.
+const SamplingPresetKey = "preset"
+
+// DeterministicSeed is the seed of the deterministic preset.
+const DeterministicSeed = 42
+
+// samplingPresets are the sampling parameters of the presets. The
+// deterministic one makes regression runs of a prompt comparable: greedy
+// sampling and, for the services taking one, a fixed seed.
+var samplingPresets = map[string]map[string]interface{}{
+	"deterministic": {"temperature": 0.0, "top_p": 1.0, "top_k": 1.0, "seed": float64(DeterministicSeed)},
+	"balanced":      {"temperature": 0.7},
+	"creative":      {"temperature": 1.0, "top_p": 0.95},
+}
+
+// samplingKeys are the sampling parameters the services send.
+var samplingKeys = map[string][]string{
+	"openai":     {"temperature", "top_p", "seed"},
+	"groq":       {"temperature", "top_p", "seed"},
+	"openrouter": {"temperature", "top_p", "seed"},
+	"gemini":     {"temperature", "top_p", "top_k", "seed"},
+	"anthropic":  {"temperature", "top_p", "top_k"},
+}
+
+// geminiSamplingDefaults are sent by the Gemini service when the step sets
+// no value.
+var geminiSamplingDefaults = map[string]float64{"temperature": 1.0, "top_k": 40, "top_p": 0.95}
+
+// Parameters returns the parameters of the config with its preset applied,
+// the parameters set explicitly taking precedence over the preset.
+func Parameters(config map[string]interface{}) map[string]interface{} {
+	params, _ := config["parameters"].(map[string]interface{})
+	preset, _ := params[SamplingPresetKey].(string)
+	values, ok := samplingPresets[preset]
+	if !ok {
+		return params
+	}
+	merged := make(map[string]interface{}, len(params)+len(values))
+	for k, v := range values {
+		merged[k] = v
+	}
+	for k, v := range params {
+		merged[k] = v
+	}
+	return merged
+}
+
+// SamplingParameters returns the sampling parameters a step sends to the
+// service, to record them with its result, or an error for an unknown
+// preset.
+func SamplingParameters(serviceName string, config map[string]interface{}) (map[string]interface{}, error) {
+	params, _ := config["parameters"].(map[string]interface{})
+	preset, _ := params[SamplingPresetKey].(string)
+	if _, ok := samplingPresets[preset]; preset != "" && !ok {
+		return nil, fmt.Errorf("unknown sampling preset %q", preset)
+	}
+	effective := Parameters(config)
+	sampling := make(map[string]interface{})
+	for _, key := range samplingKeys[serviceName] {
+		if v, ok := effective[key]; ok {
+			sampling[key] = safeParseFloat(v, 0)
+		} else if v, ok := geminiSamplingDefaults[key]; ok && serviceName == "gemini" {
+			sampling[key] = v
+		}
+	}
+	if _, ok := sampling["temperature"]; ok && serviceName == "anthropic" {
+		delete(sampling, "top_p")
+	}
+	if preset != "" {
+		sampling[SamplingPresetKey] = preset
+	}
+	return sampling, nil
+}
+
+// setSampling copies the temperature, top_p and seed parameters to an OpenAI
+// compatible request body.
+func setSampling(body map[string]interface{}, params map[string]interface{}) {
+	if temperature, ok := params["temperature"]; ok {
+		body["temperature"] = safeParseFloat(temperature, 1.0)
+	}
+	if topP, ok := params["top_p"]; ok {
+		body["top_p"] = safeParseFloat(topP, 1.0)
+	}
+	if seed, ok := params["seed"]; ok {
+		body["seed"] = int64(safeParseFloat(seed, 0))
+	}
+}
@@ -0,0 +1,325 @@
+package llm_service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	envConfig "github.com/serisow/lesocle/config"
+	"github.com/serisow/lesocle/signedurl"
+)
+
+// StabilityDefaultURL is the base URL of the Stability AI API, used when the
+// step configures no api_url.
+const StabilityDefaultURL = "https://api.stability.ai"
+
+// StabilityDefaultModel is used by the steps configuring no model.
+const StabilityDefaultModel = "stable-image-core"
+
+// stabilityAspectRatios are the aspect ratios of the Stable Image API, 9:16
+// being the one of vertical video slides.
+var stabilityAspectRatios = map[string]bool{
+	"16:9": true, "1:1": true, "21:9": true, "2:3": true, "3:2": true,
+	"4:5": true, "5:4": true, "9:16": true, "9:21": true,
+}
+
+// sdxlDimensions are the sizes SDXL was trained on, the aspect ratio is
+// mapped to the closest one.
+var sdxlDimensions = [][2]int{
+	{1024, 1024}, {1152, 896}, {896, 1152}, {1216, 832}, {832, 1216},
+	{1344, 768}, {768, 1344}, {1536, 640}, {640, 1536},
+}
+
+// StabilityImageService generates images with Stability AI, the Stable Image
+// models (stable-image-core, stable-image-ultra, sd3.5-*) through the v2beta
+// API and SDXL through the v1 API. Its output is the image file info of the
+// Gemini image generation.
+type StabilityImageService struct {
+	httpClient *http.Client
+	logger     *slog.Logger
+}
+
+func NewStabilityImageService(logger *slog.Logger) *StabilityImageService {
+	return &StabilityImageService{
+		httpClient: newHTTPClient("stability_image", 5*time.Minute),
+		logger:     logger,
+	}
+}
+
+// stabilityImage is a generated image and the seed it was generated with.
+type stabilityImage struct {
+	data   []byte
+	seed   int64
+	format string
+}
+
+// CallLLM generates an image of the prompt. The parameters are
+// negative_prompt, seed, aspect_ratio (1:1 by default), output_format (png,
+// jpeg or webp) and style_preset.
+func (s *StabilityImageService) CallLLM(ctx context.Context, config map[string]interface{}, prompt string) (string, error) {
+	modelName, _ := config["model_name"].(string)
+	if modelName == "" {
+		modelName = StabilityDefaultModel
+	}
+	image, err := s.generate(ctx, config, modelName, prompt)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Error calling Stability AI API",
+			slog.String("error", err.Error()),
+			slog.String("model", modelName))
+		return "", fmt.Errorf("failed to call Stability AI API: %w", err)
+	}
+	return saveGeneratedImage(image, modelName)
+}
+
+func (s *StabilityImageService) generate(ctx context.Context, config map[string]interface{}, modelName, prompt string) (*stabilityImage, error) {
+	apiKey, ok := config["api_key"].(string)
+	if !ok {
+		return nil, fmt.Errorf("api_key not found in config")
+	}
+	baseURL, _ := config["api_url"].(string)
+	if baseURL == "" {
+		baseURL = StabilityDefaultURL
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	params, _ := config["parameters"].(map[string]interface{})
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+
+	aspectRatio := getStringParam(params, "aspect_ratio", "1:1")
+	if !stabilityAspectRatios[aspectRatio] {
+		return nil, fmt.Errorf("unsupported aspect_ratio %q", aspectRatio)
+	}
+	format := getStringParam(params, "output_format", "png")
+	if format != "png" && format != "jpeg" && format != "webp" {
+		return nil, fmt.Errorf("unsupported output_format %q", format)
+	}
+	var seed int64
+	if _, ok := params["seed"]; ok {
+		seed = int64(getFloat64(params, "seed", 0))
+	}
+
+	if strings.HasPrefix(modelName, "stable-diffusion-xl") {
+		// The v1 API answers in PNG only
+		return s.generateSDXL(ctx, baseURL, apiKey, modelName, prompt, params, aspectRatio, seed)
+	}
+	return s.generateStableImage(ctx, baseURL, apiKey, modelName, prompt, params, aspectRatio, format, seed)
+}
+
+// generateStableImage calls the v2beta endpoint of the model family.
+func (s *StabilityImageService) generateStableImage(ctx context.Context, baseURL, apiKey, modelName, prompt string, params map[string]interface{}, aspectRatio, format string, seed int64) (*stabilityImage, error) {
+	fields := map[string]string{
+		"prompt":        prompt,
+		"aspect_ratio":  aspectRatio,
+		"output_format": format,
+	}
+	var endpoint string
+	switch {
+	case modelName == "stable-image-ultra":
+		endpoint = "ultra"
+	case modelName == "stable-image-core":
+		endpoint = "core"
+	case strings.HasPrefix(modelName, "sd3"):
+		endpoint = "sd3"
+		fields["model"] = modelName
+	default:
+		return nil, fmt.Errorf("unknown Stability AI model %q", modelName)
+	}
+	if negative := getStringParam(params, "negative_prompt", ""); negative != "" {
+		fields["negative_prompt"] = negative
+	}
+	if seed > 0 {
+		fields["seed"] = strconv.FormatInt(seed, 10)
+	}
+	if preset := getStringParam(params, "style_preset", ""); preset != "" && endpoint == "core" {
+		fields["style_preset"] = preset
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if err := writer.WriteField(name, value); err != nil {
+			return nil, fmt.Errorf("error writing form field %s: %w", name, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("error writing form: %w", err)
+	}
+
+	var result struct {
+		Image        string `json:"image"`
+		Seed         int64  `json:"seed"`
+		FinishReason string `json:"finish_reason"`
+	}
+	url := baseURL + "/v2beta/stable-image/generate/" + endpoint
+	if err := s.post(ctx, url, apiKey, writer.FormDataContentType(), body.Bytes(), &result); err != nil {
+		return nil, err
+	}
+	return decodeStabilityImage(result.Image, result.Seed, result.FinishReason, format)
+}
+
+// generateSDXL calls the v1 text-to-image endpoint of the engine, the
+// negative prompt being a negatively weighted text prompt.
+func (s *StabilityImageService) generateSDXL(ctx context.Context, baseURL, apiKey, engine, prompt string, params map[string]interface{}, aspectRatio string, seed int64) (*stabilityImage, error) {
+	width, height := sdxlSize(aspectRatio)
+	textPrompts := []map[string]interface{}{{"text": prompt, "weight": 1}}
+	if negative := getStringParam(params, "negative_prompt", ""); negative != "" {
+		textPrompts = append(textPrompts, map[string]interface{}{"text": negative, "weight": -1})
+	}
+	payload := map[string]interface{}{
+		"text_prompts": textPrompts,
+		"width":        width,
+		"height":       height,
+		"samples":      1,
+		"seed":         seed,
+	}
+	if preset := getStringParam(params, "style_preset", ""); preset != "" {
+		payload["style_preset"] = preset
+	}
+	requestBody, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request body: %w", err)
+	}
+
+	var result struct {
+		Artifacts []struct {
+			Base64       string `json:"base64"`
+			Seed         int64  `json:"seed"`
+			FinishReason string `json:"finishReason"`
+		} `json:"artifacts"`
+	}
+	url := fmt.Sprintf("%s/v1/generation/%s/text-to-image", baseURL, engine)
+	if err := s.post(ctx, url, apiKey, "application/json", requestBody, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Artifacts) == 0 {
+		return nil, fmt.Errorf("no image in the Stability AI response")
+	}
+	artifact := result.Artifacts[0]
+	return decodeStabilityImage(artifact.Base64, artifact.Seed, artifact.FinishReason, "png")
+}
+
+// post sends a generation request and decodes its JSON answer.
+func (s *StabilityImageService) post(ctx context.Context, url, apiKey, contentType string, body []byte, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Name    string   `json:"name"`
+			Message string   `json:"message"`
+			Errors  []string `json:"errors"`
+		}
+		json.Unmarshal(data, &apiErr)
+		message := apiErr.Message
+		if len(apiErr.Errors) > 0 {
+			message = strings.Join(apiErr.Errors, "; ")
+		}
+		if message == "" {
+			message = string(data)
+		}
+		return fmt.Errorf("Stability AI API error (HTTP %d): %s", resp.StatusCode, message)
+	}
+	if err := json.Unmarshal(data, result); err != nil {
+		return fmt.Errorf("error unmarshaling response: %w", err)
+	}
+	return nil
+}
+
+// decodeStabilityImage decodes the base64 image of a response, refusing the
+// ones the content filter blurred.
+func decodeStabilityImage(encoded string, seed int64, finishReason, format string) (*stabilityImage, error) {
+	if finishReason == "CONTENT_FILTERED" {
+		return nil, fmt.Errorf("the image was blocked by the Stability AI content filter")
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding base64 image: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no image in the Stability AI response")
+	}
+	return &stabilityImage{data: data, seed: seed, format: format}, nil
+}
+
+// sdxlSize returns the SDXL size closest to the aspect ratio.
+func sdxlSize(aspectRatio string) (int, int) {
+	w, h, _ := strings.Cut(aspectRatio, ":")
+	ratioW, _ := strconv.ParseFloat(w, 64)
+	ratioH, _ := strconv.ParseFloat(h, 64)
+	if ratioW <= 0 || ratioH <= 0 {
+		return 1024, 1024
+	}
+	ratio := ratioW / ratioH
+	best := sdxlDimensions[0]
+	for _, d := range sdxlDimensions[1:] {
+		if math.Abs(float64(d[0])/float64(d[1])-ratio) < math.Abs(float64(best[0])/float64(best[1])-ratio) {
+			best = d
+		}
+	}
+	return best[0], best[1]
+}
+
+// saveGeneratedImage stores the image under storage/pipeline/images, where
+// the image route serves it, and returns its file info JSON.
+func saveGeneratedImage(image *stabilityImage, modelName string) (string, error) {
+	directory := filepath.Join("storage", "pipeline", "images", time.Now().Format("2006-01"))
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	fileID := time.Now().UnixNano()
+	filename := fmt.Sprintf("stability_img_%d.%s", fileID, image.format)
+	outputPath := filepath.Join(directory, filename)
+	if err := os.WriteFile(outputPath, image.data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write image data: %w", err)
+	}
+
+	cfg := envConfig.Load()
+	result := map[string]interface{}{
+		"file_id":    fileID,
+		"uri":        outputPath,
+		"url":        signedurl.Sign(fmt.Sprintf("%s/api/images/%d", cfg.ServiceBaseURL, fileID)),
+		"mime_type":  "image/" + image.format,
+		"filename":   filename,
+		"size":       len(image.data),
+		"timestamp":  time.Now().Unix(),
+		"sha256":     fmt.Sprintf("%x", sha256.Sum256(image.data)),
+		"model_name": modelName,
+		"service":    "stability_image",
+		// The seed reproduces the image, e.g. to regenerate a slide
+		"seed": image.seed,
+	}
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling result: %w", err)
+	}
+	return string(resultJSON), nil
+}
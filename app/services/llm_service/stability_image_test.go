@@ -0,0 +1,187 @@
+package llm_service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSDXLSize(t *testing.T) {
+	tests := []struct {
+		aspectRatio string
+		width       int
+		height      int
+	}{
+		{"1:1", 1024, 1024},
+		{"16:9", 1344, 768},
+		{"9:16", 768, 1344},
+		{"21:9", 1536, 640},
+		{"4:5", 896, 1152},
+		{"invalid", 1024, 1024},
+	}
+	for _, tt := range tests {
+		if w, h := sdxlSize(tt.aspectRatio); w != tt.width || h != tt.height {
+			t.Errorf("sdxlSize(%q) = %dx%d, want %dx%d", tt.aspectRatio, w, h, tt.width, tt.height)
+		}
+	}
+}
+
+func TestDecodeStabilityImage(t *testing.T) {
+	tests := []struct {
+		name         string
+		encoded      string
+		finishReason string
+		wantErr      string
+	}{
+		{name: "image", encoded: base64.StdEncoding.EncodeToString([]byte("png")), finishReason: "SUCCESS"},
+		{name: "filtered", encoded: base64.StdEncoding.EncodeToString([]byte("png")), finishReason: "CONTENT_FILTERED", wantErr: "content filter"},
+		{name: "invalid base64", encoded: "not base64!", wantErr: "decoding base64"},
+		{name: "empty", encoded: "", wantErr: "no image"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image, err := decodeStabilityImage(tt.encoded, 7, tt.finishReason, "png")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil || string(image.data) != "png" || image.seed != 7 {
+				t.Errorf("unexpected image %+v, error %v", image, err)
+			}
+		})
+	}
+}
+
+func TestStabilityImageGeneration(t *testing.T) {
+	inTempDir(t)
+	image := base64.StdEncoding.EncodeToString([]byte("image"))
+
+	tests := []struct {
+		name   string
+		model  string
+		params map[string]interface{}
+		path   string
+		check  func(t *testing.T, r *http.Request)
+	}{
+		{
+			name:   "core",
+			model:  "",
+			params: map[string]interface{}{"negative_prompt": "blur", "seed": float64(42), "style_preset": "anime", "output_format": "webp"},
+			path:   "/v2beta/stable-image/generate/core",
+			check: func(t *testing.T, r *http.Request) {
+				if err := r.ParseMultipartForm(1 << 20); err != nil {
+					t.Fatalf("expected a multipart form: %v", err)
+				}
+				if r.FormValue("prompt") != "a lighthouse" || r.FormValue("negative_prompt") != "blur" ||
+					r.FormValue("seed") != "42" || r.FormValue("style_preset") != "anime" || r.FormValue("output_format") != "webp" {
+					t.Errorf("unexpected form %v", r.MultipartForm.Value)
+				}
+			},
+		},
+		{
+			name:   "sd3 without style preset",
+			model:  "sd3.5-large",
+			params: map[string]interface{}{"aspect_ratio": "9:16", "style_preset": "anime"},
+			path:   "/v2beta/stable-image/generate/sd3",
+			check: func(t *testing.T, r *http.Request) {
+				r.ParseMultipartForm(1 << 20)
+				if r.FormValue("model") != "sd3.5-large" || r.FormValue("aspect_ratio") != "9:16" || r.FormValue("style_preset") != "" {
+					t.Errorf("unexpected form %v", r.MultipartForm.Value)
+				}
+			},
+		},
+		{
+			name:   "sdxl",
+			model:  "stable-diffusion-xl-1024-v1-0",
+			params: map[string]interface{}{"aspect_ratio": "16:9", "negative_prompt": "blur"},
+			path:   "/v1/generation/stable-diffusion-xl-1024-v1-0/text-to-image",
+			check: func(t *testing.T, r *http.Request) {
+				var body struct {
+					TextPrompts []struct {
+						Text   string  `json:"text"`
+						Weight float64 `json:"weight"`
+					} `json:"text_prompts"`
+					Width  int `json:"width"`
+					Height int `json:"height"`
+				}
+				json.NewDecoder(r.Body).Decode(&body)
+				if body.Width != 1344 || body.Height != 768 || len(body.TextPrompts) != 2 || body.TextPrompts[1].Weight != -1 {
+					t.Errorf("unexpected body %+v", body)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != tt.path || r.Header.Get("Authorization") != "Bearer key" {
+					t.Errorf("unexpected request %s with %q", r.URL.Path, r.Header.Get("Authorization"))
+				}
+				tt.check(t, r)
+				if strings.HasPrefix(r.URL.Path, "/v1/") {
+					json.NewEncoder(w).Encode(map[string]interface{}{
+						"artifacts": []map[string]interface{}{{"base64": image, "seed": 9, "finishReason": "SUCCESS"}},
+					})
+					return
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{"image": image, "seed": 9, "finish_reason": "SUCCESS"})
+			}))
+			defer server.Close()
+
+			config := map[string]interface{}{"api_key": "key", "api_url": server.URL, "parameters": tt.params}
+			if tt.model != "" {
+				config["model_name"] = tt.model
+			}
+			got, err := NewStabilityImageService(slog.Default()).CallLLM(context.Background(), config, "a lighthouse")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var file map[string]interface{}
+			json.Unmarshal([]byte(got), &file)
+			if file["seed"] != float64(9) || file["service"] != "stability_image" || file["size"] != float64(5) {
+				t.Errorf("unexpected file info %v", file)
+			}
+			if data, err := os.ReadFile(file["uri"].(string)); err != nil || string(data) != "image" {
+				t.Errorf("expected the image saved, got %q and %v", data, err)
+			}
+		})
+	}
+}
+
+func TestStabilityImageErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"name":"bad_request","errors":["prompt: too long","seed: invalid"]}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		model   string
+		params  map[string]interface{}
+		wantErr string
+	}{
+		{name: "API error", params: map[string]interface{}{}, wantErr: "HTTP 400): prompt: too long; seed: invalid"},
+		{name: "aspect ratio", params: map[string]interface{}{"aspect_ratio": "7:3"}, wantErr: "unsupported aspect_ratio"},
+		{name: "output format", params: map[string]interface{}{"output_format": "gif"}, wantErr: "unsupported output_format"},
+		{name: "unknown model", model: "dall-e", params: map[string]interface{}{}, wantErr: "unknown Stability AI model"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := map[string]interface{}{"api_key": "key", "api_url": server.URL, "model_name": tt.model, "parameters": tt.params}
+			_, err := NewStabilityImageService(slog.Default()).CallLLM(context.Background(), config, "a lighthouse")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package llm_service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Message roles.
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	// RoleTool messages are the results of tool calls
+	RoleTool = "tool"
+)
+
+// Message is a turn of a conversation with a model.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// The calls of an assistant message
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// The call a tool message answers
+	ToolCallID string `json:"tool_call_id,omitempty"`
+}
+
+// Tool is a function the model may call, its parameters being a JSON schema.
+type Tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+// ToolCall is a call of a tool by the model.
+type ToolCall struct {
+	ID        string                 `json:"id"`
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// ToolResponse is the answer of the model, tool calls or its final content.
+type ToolResponse struct {
+	Content   string
+	ToolCalls []ToolCall
+}
+
+// ToolCaller is implemented by the services whose models can call tools.
+type ToolCaller interface {
+	CallWithTools(ctx context.Context, config map[string]interface{}, messages []Message, tools []Tool) (*ToolResponse, error)
+}
+
+// openAIToolMessages converts the messages to the chat completions format.
+func openAIToolMessages(messages []Message) []map[string]interface{} {
+	converted := make([]map[string]interface{}, 0, len(messages))
+	for _, m := range messages {
+		message := map[string]interface{}{"role": m.Role, "content": m.Content}
+		if len(m.ToolCalls) > 0 {
+			calls := make([]map[string]interface{}, 0, len(m.ToolCalls))
+			for _, call := range m.ToolCalls {
+				arguments, _ := json.Marshal(call.Arguments)
+				calls = append(calls, map[string]interface{}{
+					"id":       call.ID,
+					"type":     "function",
+					"function": map[string]interface{}{"name": call.Name, "arguments": string(arguments)},
+				})
+			}
+			message["tool_calls"] = calls
+		}
+		if m.ToolCallID != "" {
+			message["tool_call_id"] = m.ToolCallID
+		}
+		converted = append(converted, message)
+	}
+	return converted
+}
+
+// openAITools converts the tools to the chat completions format.
+func openAITools(tools []Tool) []map[string]interface{} {
+	converted := make([]map[string]interface{}, 0, len(tools))
+	for _, tool := range tools {
+		parameters := tool.Parameters
+		if parameters == nil {
+			parameters = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		converted = append(converted, map[string]interface{}{
+			"type": "function",
+			"function": map[string]interface{}{
+				"name":        tool.Name,
+				"description": tool.Description,
+				"parameters":  parameters,
+			},
+		})
+	}
+	return converted
+}
+
+// chatCompletionWithTools calls an OpenAI compatible chat completions API
+// with tools.
+func chatCompletionWithTools(ctx context.Context, client *http.Client, provider, apiURL string, headers map[string]string, body map[string]interface{}) (*ToolResponse, error) {
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content   string `json:"content"`
+				ToolCalls []struct {
+					ID       string `json:"id"`
+					Function struct {
+						Name      string `json:"name"`
+						Arguments string `json:"arguments"`
+					} `json:"function"`
+				} `json:"tool_calls"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := postJSON(ctx, client, provider, apiURL, headers, body, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Choices) == 0 {
+		return nil, fmt.Errorf("unexpected response format from %s API", provider)
+	}
+
+	message := result.Choices[0].Message
+	response := &ToolResponse{Content: message.Content}
+	for _, call := range message.ToolCalls {
+		var arguments map[string]interface{}
+		if call.Function.Arguments != "" {
+			if err := json.Unmarshal([]byte(call.Function.Arguments), &arguments); err != nil {
+				return nil, fmt.Errorf("invalid arguments of the %s tool call: %w", call.Function.Name, err)
+			}
+		}
+		response.ToolCalls = append(response.ToolCalls, ToolCall{ID: call.ID, Name: call.Function.Name, Arguments: arguments})
+	}
+	return response, nil
+}
+
+// openAIToolBody builds the request body of a conversation with tools.
+func openAIToolBody(config map[string]interface{}, messages []Message, tools []Tool) (map[string]interface{}, error) {
+	modelName, ok := config["model_name"].(string)
+	if !ok {
+		return nil, fmt.Errorf("model_name not found in config")
+	}
+	body := chatCompletionBody(config, modelName, "")
+	body["messages"] = openAIToolMessages(messages)
+	if len(tools) > 0 {
+		body["tools"] = openAITools(tools)
+	}
+	return body, nil
+}
+
+// CallWithTools sends the conversation to the chat completions API.
+func (s *OpenAIService) CallWithTools(ctx context.Context, config map[string]interface{}, messages []Message, tools []Tool) (*ToolResponse, error) {
+	apiURL, ok := config["api_url"].(string)
+	if !ok {
+		return nil, fmt.Errorf("api_url not found in config")
+	}
+	apiKey, ok := config["api_key"].(string)
+	if !ok {
+		return nil, fmt.Errorf("api_key not found in config")
+	}
+	body, err := openAIToolBody(config, messages, tools)
+	if err != nil {
+		return nil, err
+	}
+	return chatCompletionWithTools(ctx, s.httpClient, "OpenAI", apiURL, map[string]string{"Authorization": "Bearer " + apiKey}, body)
+}
+
+// CallWithTools sends the conversation to the chat completions API.
+func (s *GroqService) CallWithTools(ctx context.Context, config map[string]interface{}, messages []Message, tools []Tool) (*ToolResponse, error) {
+	apiKey, ok := config["api_key"].(string)
+	if !ok {
+		return nil, fmt.Errorf("api_key not found in config")
+	}
+	apiURL, _ := config["api_url"].(string)
+	if apiURL == "" {
+		apiURL = GroqDefaultURL
+	}
+	body, err := openAIToolBody(config, messages, tools)
+	if err != nil {
+		return nil, err
+	}
+	return chatCompletionWithTools(ctx, s.httpClient, "Groq", apiURL, map[string]string{"Authorization": "Bearer " + apiKey}, body)
+}
+
+// CallWithTools sends the conversation to the chat completions API.
+func (s *OpenRouterService) CallWithTools(ctx context.Context, config map[string]interface{}, messages []Message, tools []Tool) (*ToolResponse, error) {
+	apiKey, ok := config["api_key"].(string)
+	if !ok {
+		return nil, fmt.Errorf("api_key not found in config")
+	}
+	apiURL, _ := config["api_url"].(string)
+	if apiURL == "" {
+		apiURL = OpenRouterDefaultURL
+	}
+	body, err := openAIToolBody(config, messages, tools)
+	if err != nil {
+		return nil, err
+	}
+	return chatCompletionWithTools(ctx, s.httpClient, "OpenRouter", apiURL, map[string]string{"Authorization": "Bearer " + apiKey, "X-Title": "Lesocle"}, body)
+}
+
+// CallWithTools sends the conversation to the messages API. System messages
+// become the system prompt and consecutive tool results a single user turn.
+func (s *AnthropicService) CallWithTools(ctx context.Context, config map[string]interface{}, messages []Message, tools []Tool) (*ToolResponse, error) {
+	apiURL, ok := config["api_url"].(string)
+	if !ok {
+		return nil, fmt.Errorf("api_url not found in config")
+	}
+	apiKey, ok := config["api_key"].(string)
+	if !ok {
+		return nil, fmt.Errorf("api_key not found in config")
+	}
+	modelName, ok := config["model_name"].(string)
+	if !ok {
+		return nil, fmt.Errorf("model_name not found in config")
+	}
+	params := Parameters(config)
+
+	body := map[string]interface{}{
+		"model":      modelName,
+		"max_tokens": int(safeParseFloat(params["max_tokens"], 1000)),
+	}
+	setAnthropicSampling(body, params)
+	system, converted := anthropicMessages(messages)
+	body["messages"] = converted
+	if system != "" {
+		body["system"] = system
+	}
+	if len(tools) > 0 {
+		anthropicTools := make([]map[string]interface{}, 0, len(tools))
+		for _, tool := range tools {
+			schema := tool.Parameters
+			if schema == nil {
+				schema = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+			}
+			anthropicTools = append(anthropicTools, map[string]interface{}{
+				"name":         tool.Name,
+				"description":  tool.Description,
+				"input_schema": schema,
+			})
+		}
+		body["tools"] = anthropicTools
+	}
+
+	var result struct {
+		Content []struct {
+			Type  string                 `json:"type"`
+			Text  string                 `json:"text"`
+			ID    string                 `json:"id"`
+			Name  string                 `json:"name"`
+			Input map[string]interface{} `json:"input"`
+		} `json:"content"`
+	}
+	headers := map[string]string{"x-api-key": apiKey, "anthropic-version": "2023-06-01"}
+	if err := postJSON(ctx, s.httpClient, "Anthropic", apiURL, headers, body, &result); err != nil {
+		return nil, err
+	}
+
+	response := &ToolResponse{}
+	for _, block := range result.Content {
+		switch block.Type {
+		case "text":
+			response.Content += block.Text
+		case "tool_use":
+			response.ToolCalls = append(response.ToolCalls, ToolCall{ID: block.ID, Name: block.Name, Arguments: block.Input})
+		}
+	}
+	return response, nil
+}
+
+// anthropicMessages converts the messages to the messages API format.
+func anthropicMessages(messages []Message) (string, []map[string]interface{}) {
+	var system string
+	var converted []map[string]interface{}
+	for _, m := range messages {
+		switch {
+		case m.Role == RoleSystem:
+			if system != "" {
+				system += "\n\n"
+			}
+			system += m.Content
+		case m.Role == RoleTool:
+			result := map[string]interface{}{"type": "tool_result", "tool_use_id": m.ToolCallID, "content": m.Content}
+			// The results of the calls of a turn go in one user message
+			if last := len(converted) - 1; last >= 0 && converted[last]["role"] == RoleUser {
+				if blocks, ok := converted[last]["content"].([]map[string]interface{}); ok {
+					converted[last]["content"] = append(blocks, result)
+					continue
+				}
+			}
+			converted = append(converted, map[string]interface{}{"role": RoleUser, "content": []map[string]interface{}{result}})
+		case len(m.ToolCalls) > 0:
+			var blocks []map[string]interface{}
+			if m.Content != "" {
+				blocks = append(blocks, map[string]interface{}{"type": "text", "text": m.Content})
+			}
+			for _, call := range m.ToolCalls {
+				input := call.Arguments
+				if input == nil {
+					input = map[string]interface{}{}
+				}
+				blocks = append(blocks, map[string]interface{}{"type": "tool_use", "id": call.ID, "name": call.Name, "input": input})
+			}
+			converted = append(converted, map[string]interface{}{"role": RoleAssistant, "content": blocks})
+		default:
+			// The roles must alternate, consecutive turns of a role are merged
+			if last := len(converted) - 1; last >= 0 && converted[last]["role"] == m.Role {
+				if content, ok := converted[last]["content"].(string); ok {
+					converted[last]["content"] = content + "\n\n" + m.Content
+					continue
+				}
+			}
+			converted = append(converted, map[string]interface{}{"role": m.Role, "content": m.Content})
+		}
+	}
+	return system, converted
+}
@@ -0,0 +1,266 @@
+package llm_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/serisow/lesocle/httputil"
+)
+
+// ErrCircuitOpen is returned without calling the provider while its circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// TransportConfig configures the HTTP calls of the services.
+type TransportConfig struct {
+	// Retries after the first attempt of retryable failures: network errors,
+	// 429 and 5xx responses
+	MaxRetries int
+	// BaseDelay is doubled on each retry, up to MaxDelay. A longer
+	// Retry-After is honored up to MaxDelay, beyond it the response is
+	// returned as is.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Timeout of an attempt, including reading the response
+	Timeout time.Duration
+	// BreakerThreshold consecutive failures open the breaker of the provider
+	// for BreakerCooldown, then a single call probes it. 0 disables it.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// DefaultTransportConfig is the configuration of the services.
+var DefaultTransportConfig = TransportConfig{
+	MaxRetries:       3,
+	BaseDelay:        2 * time.Second,
+	MaxDelay:         60 * time.Second,
+	Timeout:          120 * time.Second,
+	BreakerThreshold: 5,
+	BreakerCooldown:  60 * time.Second,
+}
+
+var (
+	transportMutex sync.RWMutex
+	transport      = DefaultTransportConfig
+)
+
+// ConfigureTransport replaces the configuration of the services. It applies
+// to the calls made afterwards.
+func ConfigureTransport(cfg TransportConfig) {
+	transportMutex.Lock()
+	defer transportMutex.Unlock()
+	transport = cfg
+}
+
+func transportConfig() TransportConfig {
+	transportMutex.RLock()
+	defer transportMutex.RUnlock()
+	return transport
+}
+
+// newHTTPClient returns the client of a provider, retrying and circuit
+// breaking through ResilientTransport. A zero timeout uses the configured
+// one, image generation needs longer.
+func newHTTPClient(provider string, timeout time.Duration) *http.Client {
+	return &http.Client{Transport: &ResilientTransport{Provider: provider, Timeout: timeout}}
+}
+
+// ResilientTransport retries the failed calls of a provider with backoff and
+// stops calling it while it keeps failing. Requests with a body are only
+// retried when it can be replayed, which http.NewRequest ensures for byte
+// buffers and readers.
+type ResilientTransport struct {
+	Provider string
+	// Timeout of an attempt, the configured one when zero
+	Timeout time.Duration
+	// Base is the transport the attempts go through, http.DefaultTransport
+	// when nil
+	Base http.RoundTripper
+}
+
+func (t *ResilientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	cfg := transportConfig()
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	timeout := t.Timeout
+	if timeout == 0 {
+		timeout = cfg.Timeout
+	}
+	breaker := breakerFor(t.Provider)
+
+	delay := cfg.BaseDelay
+	for attempt := 0; ; attempt++ {
+		if err := breaker.allow(cfg); err != nil {
+			return nil, err
+		}
+		// Each attempt sends a copy, a RoundTripper must not modify the
+		// caller's request
+		attemptReq := req.Clone(req.Context())
+		if attempt > 0 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("replaying the request body: %w", err)
+			}
+			attemptReq.Body = body
+		}
+
+		resp, err := t.attempt(base, attemptReq, timeout)
+		failed := err != nil || resp.StatusCode >= 500
+		breaker.record(cfg, failed)
+
+		retryable := failed || resp.StatusCode == http.StatusTooManyRequests
+		canReplay := req.Body == nil || req.GetBody != nil
+		if !retryable || attempt >= cfg.MaxRetries || !canReplay || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		wait := delay
+		if resp != nil {
+			if after, ok := httputil.ParseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				if after > cfg.MaxDelay {
+					// Waiting this long is the caller's decision
+					return resp, nil
+				}
+				wait = after
+			}
+			// The connection is only reused once the body is drained
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		// Jitter keeps the executions from retrying in lockstep
+		wait += time.Duration(rand.Int63n(int64(wait)/4 + 1))
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+		if delay *= 2; delay > cfg.MaxDelay {
+			delay = cfg.MaxDelay
+		}
+	}
+}
+
+// attempt sends the request with the attempt timeout, which keeps running
+// while the caller reads the body.
+func (t *ResilientTransport) attempt(base http.RoundTripper, req *http.Request, timeout time.Duration) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	resp, err := base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// Breaker states.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// breaker counts the consecutive failures of a provider.
+type breaker struct {
+	mutex    sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+var breakers = struct {
+	sync.Mutex
+	byProvider map[string]*breaker
+}{byProvider: make(map[string]*breaker)}
+
+func breakerFor(provider string) *breaker {
+	breakers.Lock()
+	defer breakers.Unlock()
+	b, ok := breakers.byProvider[provider]
+	if !ok {
+		b = &breaker{}
+		breakers.byProvider[provider] = b
+	}
+	return b
+}
+
+// allow lets a call through unless the breaker is open. Once the cooldown
+// passed, one call at a time probes the provider.
+func (b *breaker) allow(cfg TransportConfig) error {
+	if cfg.BreakerThreshold <= 0 {
+		return nil
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.failures < cfg.BreakerThreshold {
+		return nil
+	}
+	if remaining := cfg.BreakerCooldown - time.Since(b.openedAt); remaining > 0 {
+		return fmt.Errorf("%w after %d consecutive failures, retry in %s", ErrCircuitOpen, b.failures, remaining.Round(time.Second))
+	}
+	if b.probing {
+		return fmt.Errorf("%w after %d consecutive failures, a call is probing the provider", ErrCircuitOpen, b.failures)
+	}
+	b.probing = true
+	return nil
+}
+
+func (b *breaker) record(cfg TransportConfig, failed bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if cfg.BreakerThreshold > 0 && b.failures >= cfg.BreakerThreshold {
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *breaker) state(cfg TransportConfig) string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch {
+	case cfg.BreakerThreshold <= 0 || b.failures < cfg.BreakerThreshold:
+		return BreakerClosed
+	case time.Since(b.openedAt) < cfg.BreakerCooldown:
+		return BreakerOpen
+	default:
+		return BreakerHalfOpen
+	}
+}
+
+// BreakerStates returns the state of the circuit breaker of each provider
+// called so far.
+func BreakerStates() map[string]string {
+	cfg := transportConfig()
+	breakers.Lock()
+	defer breakers.Unlock()
+	states := make(map[string]string, len(breakers.byProvider))
+	for provider, b := range breakers.byProvider {
+		states[provider] = b.state(cfg)
+	}
+	return states
+}
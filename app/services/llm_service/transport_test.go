@@ -0,0 +1,201 @@
+package llm_service
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// useTransportConfig configures the transport for a test, with delays short
+// enough to retry quickly.
+func useTransportConfig(t *testing.T, cfg TransportConfig) {
+	previous := transportConfig()
+	ConfigureTransport(cfg)
+	t.Cleanup(func() { ConfigureTransport(previous) })
+}
+
+func fastTransportConfig() TransportConfig {
+	return TransportConfig{
+		MaxRetries: 3,
+		BaseDelay:  time.Millisecond,
+		MaxDelay:   2 * time.Second,
+		Timeout:    5 * time.Second,
+	}
+}
+
+// sequenceServer answers with the statuses in turn, then 200, and records
+// the bodies it received.
+func sequenceServer(t *testing.T, statuses []int, header http.Header) (*httptest.Server, *int32, *[]string) {
+	var calls int32
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if int(n) <= len(statuses) {
+			for key, values := range header {
+				w.Header()[key] = values
+			}
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls, &bodies
+}
+
+func TestResilientTransportRetries(t *testing.T) {
+	useTransportConfig(t, fastTransportConfig())
+	server, calls, bodies := sequenceServer(t, []int{http.StatusTooManyRequests, http.StatusServiceUnavailable}, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(`{"prompt":"hi"}`))
+	originalBody := req.Body
+	resp, err := (&ResilientTransport{Provider: "test-retries"}).RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || *calls != 3 {
+		t.Errorf("expected 200 after 3 calls, got %d after %d", resp.StatusCode, *calls)
+	}
+	for i, body := range *bodies {
+		if body != `{"prompt":"hi"}` {
+			t.Errorf("attempt %d sent body %q", i+1, body)
+		}
+	}
+	if req.Body != originalBody {
+		t.Error("expected the caller's request to be left untouched")
+	}
+}
+
+func TestResilientTransportDoesNotRetryClientErrors(t *testing.T) {
+	useTransportConfig(t, fastTransportConfig())
+	server, calls, _ := sequenceServer(t, []int{http.StatusBadRequest}, nil)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := (&ResilientTransport{Provider: "test-4xx"}).RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || *calls != 1 {
+		t.Errorf("expected the 400 after 1 call, got %d after %d", resp.StatusCode, *calls)
+	}
+}
+
+func TestResilientTransportRetryAfter(t *testing.T) {
+	useTransportConfig(t, fastTransportConfig())
+
+	server, calls, _ := sequenceServer(t, []int{http.StatusTooManyRequests}, http.Header{"Retry-After": {"1"}})
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	start := time.Now()
+	resp, err := (&ResilientTransport{Provider: "test-retry-after"}).RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || *calls != 2 {
+		t.Errorf("expected 200 after 2 calls, got %d after %d", resp.StatusCode, *calls)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("expected to wait the Retry-After second, waited %s", elapsed)
+	}
+
+	// Beyond MaxDelay, the response is the caller's to handle
+	server, calls, _ = sequenceServer(t, []int{http.StatusTooManyRequests}, http.Header{"Retry-After": {"120"}})
+	req, _ = http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err = (&ResilientTransport{Provider: "test-retry-after-long"}).RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || *calls != 1 {
+		t.Errorf("expected the 429 after 1 call, got %d after %d", resp.StatusCode, *calls)
+	}
+}
+
+func TestResilientTransportNonReplayableBody(t *testing.T) {
+	useTransportConfig(t, fastTransportConfig())
+	server, calls, _ := sequenceServer(t, []int{http.StatusServiceUnavailable}, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL, io.NopCloser(strings.NewReader("stream")))
+	if req.GetBody != nil {
+		t.Fatal("expected a request body that can't be replayed")
+	}
+	resp, err := (&ResilientTransport{Provider: "test-stream"}).RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || *calls != 1 {
+		t.Errorf("expected the 503 after 1 call, got %d after %d", resp.StatusCode, *calls)
+	}
+}
+
+func TestResilientTransportBreaker(t *testing.T) {
+	cfg := fastTransportConfig()
+	cfg.MaxRetries = 0
+	cfg.BreakerThreshold = 2
+	cfg.BreakerCooldown = 100 * time.Millisecond
+	useTransportConfig(t, cfg)
+
+	var failing atomic.Bool
+	failing.Store(true)
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	transport := &ResilientTransport{Provider: "test-breaker"}
+	call := func() (*http.Response, error) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := transport.RoundTrip(req)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return resp, err
+	}
+	state := func() string { return BreakerStates()["test-breaker"] }
+
+	call()
+	if state() != BreakerClosed {
+		t.Errorf("expected closed below the threshold, got %s", state())
+	}
+	call()
+	if state() != BreakerOpen {
+		t.Fatalf("expected open at the threshold, got %s", state())
+	}
+	if _, err := call(); !errors.Is(err, ErrCircuitOpen) || calls != 2 {
+		t.Errorf("expected ErrCircuitOpen without calling the provider, got %v after %d calls", err, calls)
+	}
+
+	time.Sleep(cfg.BreakerCooldown)
+	if state() != BreakerHalfOpen {
+		t.Fatalf("expected half open after the cooldown, got %s", state())
+	}
+	// A failed probe opens it again
+	call()
+	if state() != BreakerOpen {
+		t.Fatalf("expected open after a failed probe, got %s", state())
+	}
+
+	time.Sleep(cfg.BreakerCooldown)
+	failing.Store(false)
+	if resp, err := call(); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the probe to go through, got %v", err)
+	}
+	if state() != BreakerClosed {
+		t.Errorf("expected closed after a successful probe, got %s", state())
+	}
+}
@@ -0,0 +1,67 @@
+// Package signedurl signs the URLs of the files the service hands out, such
+// as generated images and spilled step outputs. Their routes are public: the
+// parties fetching them, Instagram, Facebook or Drupal, hold no API
+// credentials, the signature and its expiry stand in for them.
+package signedurl
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var (
+	// Key is the HMAC key of the signatures. URLs are not signed, and the
+	// files are served to anyone, when it is empty.
+	Key []byte
+	// TTL is how long a signed URL can be fetched.
+	TTL = 7 * 24 * time.Hour
+
+	now = time.Now
+)
+
+const (
+	expiresParam   = "expires"
+	signatureParam = "signature"
+)
+
+// Sign adds an expiry and the signature of the path to a URL.
+func Sign(rawURL string) string {
+	if len(Key) == 0 {
+		return rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	expires := now().Add(TTL).Unix()
+	query := u.Query()
+	query.Set(expiresParam, strconv.FormatInt(expires, 10))
+	query.Set(signatureParam, signature(u.Path, expires))
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// Valid reports whether a request is for a signed URL that has not expired.
+func Valid(r *http.Request) bool {
+	if len(Key) == 0 {
+		return true
+	}
+	query := r.URL.Query()
+	expires, err := strconv.ParseInt(query.Get(expiresParam), 10, 64)
+	if err != nil || now().Unix() > expires {
+		return false
+	}
+	expected := signature(r.URL.Path, expires)
+	return hmac.Equal([]byte(query.Get(signatureParam)), []byte(expected))
+}
+
+func signature(path string, expires int64) string {
+	mac := hmac.New(sha256.New, Key)
+	mac.Write([]byte(path + "." + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,54 @@
+package signedurl
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	Key = []byte("secret")
+	t.Cleanup(func() { Key = nil; now = time.Now })
+	now = func() time.Time { return time.Unix(1000, 0) }
+
+	signed := Sign("https://lesocle.test/api/images/42")
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/api/images/42" || u.Query().Get(expiresParam) != "605800" || u.Query().Get(signatureParam) == "" {
+		t.Fatalf("unexpected signed URL %s", signed)
+	}
+
+	tampered := *u
+	tampered.Path = "/api/images/43"
+	tests := []struct {
+		name  string
+		url   string
+		at    time.Time
+		valid bool
+	}{
+		{"signed", signed, time.Unix(2000, 0), true},
+		{"expired", signed, time.Unix(605801, 0), false},
+		{"other file", tampered.String(), time.Unix(2000, 0), false},
+		{"unsigned", "https://lesocle.test/api/images/42", time.Unix(2000, 0), false},
+		{"expiry pushed back", "https://lesocle.test/api/images/42?expires=999999&signature=" + u.Query().Get(signatureParam), time.Unix(2000, 0), false},
+	}
+	for _, tt := range tests {
+		now = func() time.Time { return tt.at }
+		if got := Valid(httptest.NewRequest("GET", tt.url, nil)); got != tt.valid {
+			t.Errorf("%s: valid = %v, want %v", tt.name, got, tt.valid)
+		}
+	}
+}
+
+func TestSignWithoutKey(t *testing.T) {
+	Key = nil
+	if got := Sign("https://lesocle.test/api/images/42"); got != "https://lesocle.test/api/images/42" {
+		t.Errorf("expected the URL unchanged, got %s", got)
+	}
+	if !Valid(httptest.NewRequest("GET", "/api/images/42", nil)) {
+		t.Error("expected unsigned URLs to be valid without a key")
+	}
+}
@@ -0,0 +1,196 @@
+package sla
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+const (
+	// AlertDurationExceeded is raised when a run is still going past its max duration.
+	AlertDurationExceeded = "duration_exceeded"
+	// AlertMissedStart is raised when a scheduled run didn't start within its window.
+	AlertMissedStart = "missed_start"
+)
+
+// Alert is an SLA breach.
+type Alert struct {
+	PipelineID  string    `json:"pipeline_id"`
+	ExecutionID string    `json:"execution_id,omitempty"`
+	Type        string    `json:"type"`
+	Message     string    `json:"message"`
+	At          time.Time `json:"at"`
+}
+
+// Notifier delivers alerts.
+type Notifier func(Alert)
+
+// LogNotifier writes alerts to the service log.
+func LogNotifier(a Alert) {
+	log.Printf("SLA alert for pipeline %s: %s", a.PipelineID, a.Message)
+}
+
+// WebhookNotifier logs alerts and posts them as JSON to url.
+func WebhookNotifier(url string) Notifier {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return func(a Alert) {
+		LogNotifier(a)
+
+		body, err := json.Marshal(a)
+		if err != nil {
+			log.Printf("Error marshaling SLA alert: %v", err)
+			return
+		}
+		resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Printf("Error sending SLA alert: %v", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("SLA alert webhook returned status %d", resp.StatusCode)
+		}
+	}
+}
+
+// Compliance summarizes how a pipeline met its SLA.
+type Compliance struct {
+	PipelineID     string  `json:"pipeline_id"`
+	Runs           int     `json:"runs"`
+	OnTime         int     `json:"on_time"`
+	Late           int     `json:"late"`
+	MissedStarts   int     `json:"missed_starts"`
+	ComplianceRate float64 `json:"compliance_rate"`
+	LastBreach     string  `json:"last_breach,omitempty"`
+}
+
+// Tracker records SLA compliance and raises alerts.
+type Tracker struct {
+	sync.Mutex
+	notify     Notifier
+	compliance map[string]*Compliance
+	// missed remembers the scheduled times already reported as missed
+	missed map[string]int64
+}
+
+// Default is the tracker used by the scheduler.
+var Default = NewTracker(LogNotifier)
+
+// NewTracker creates a tracker sending its alerts to notify.
+func NewTracker(notify Notifier) *Tracker {
+	return &Tracker{
+		notify:     notify,
+		compliance: make(map[string]*Compliance),
+		missed:     make(map[string]int64),
+	}
+}
+
+// SetNotifier replaces the alert delivery of the tracker.
+func (t *Tracker) SetNotifier(notify Notifier) {
+	t.Lock()
+	defer t.Unlock()
+	t.notify = notify
+}
+
+func (t *Tracker) get(pipelineID string) *Compliance {
+	c, ok := t.compliance[pipelineID]
+	if !ok {
+		c = &Compliance{PipelineID: pipelineID}
+		t.compliance[pipelineID] = c
+	}
+	return c
+}
+
+func (t *Tracker) alert(a Alert) {
+	t.Lock()
+	notify := t.notify
+	t.Unlock()
+	if notify != nil {
+		notify(a)
+	}
+}
+
+// Watch starts timing a run. It raises an alert as soon as the run exceeds its
+// max duration, the returned function must be called when the run ends.
+func (t *Tracker) Watch(pipelineID, executionID string, cfg *pipeline_type.SLAConfig) func() {
+	if cfg == nil || cfg.MaxDuration <= 0 {
+		return func() {}
+	}
+
+	start := time.Now()
+	maxDuration := time.Duration(cfg.MaxDuration) * time.Second
+	timer := time.AfterFunc(maxDuration, func() {
+		t.alert(Alert{
+			PipelineID:  pipelineID,
+			ExecutionID: executionID,
+			Type:        AlertDurationExceeded,
+			Message:     fmt.Sprintf("execution %s is still running after its SLA of %v", executionID, maxDuration),
+			At:          time.Now(),
+		})
+	})
+
+	return func() {
+		timer.Stop()
+		t.recordRun(pipelineID, time.Since(start) <= maxDuration)
+	}
+}
+
+func (t *Tracker) recordRun(pipelineID string, onTime bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	c := t.get(pipelineID)
+	c.Runs++
+	if onTime {
+		c.OnTime++
+	} else {
+		c.Late++
+		c.LastBreach = time.Now().UTC().Format(time.RFC3339)
+	}
+}
+
+// MissedStart reports a scheduled run that didn't start within its window.
+// Each scheduled time is only reported once.
+func (t *Tracker) MissedStart(pipelineID string, scheduledAt time.Time, window time.Duration) {
+	t.Lock()
+	if t.missed[pipelineID] == scheduledAt.Unix() {
+		t.Unlock()
+		return
+	}
+	t.missed[pipelineID] = scheduledAt.Unix()
+	c := t.get(pipelineID)
+	c.MissedStarts++
+	c.LastBreach = time.Now().UTC().Format(time.RFC3339)
+	t.Unlock()
+
+	t.alert(Alert{
+		PipelineID: pipelineID,
+		Type:       AlertMissedStart,
+		Message:    fmt.Sprintf("run scheduled at %s did not start within %v", scheduledAt.Format(time.RFC3339), window),
+		At:         time.Now(),
+	})
+}
+
+// Report returns the compliance of every tracked pipeline, sorted by pipeline ID.
+func (t *Tracker) Report() []Compliance {
+	t.Lock()
+	defer t.Unlock()
+
+	report := make([]Compliance, 0, len(t.compliance))
+	for _, c := range t.compliance {
+		entry := *c
+		if total := entry.Runs + entry.MissedStarts; total > 0 {
+			entry.ComplianceRate = float64(entry.OnTime) / float64(total)
+		}
+		report = append(report, entry)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].PipelineID < report[j].PipelineID })
+	return report
+}
@@ -0,0 +1,53 @@
+package sla
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/serisow/lesocle/pipeline_type"
+)
+
+func TestWatchRecordsOnTimeRun(t *testing.T) {
+	var mu sync.Mutex
+	var alerts []Alert
+	tracker := NewTracker(func(a Alert) {
+		mu.Lock()
+		alerts = append(alerts, a)
+		mu.Unlock()
+	})
+
+	done := tracker.Watch("p1", "exec-1", &pipeline_type.SLAConfig{MaxDuration: 1})
+	done()
+
+	mu.Lock()
+	if len(alerts) != 0 {
+		t.Errorf("expected no alert for an on-time run, got %v", alerts)
+	}
+	mu.Unlock()
+
+	report := tracker.Report()
+	if len(report) != 1 || report[0].OnTime != 1 || report[0].ComplianceRate != 1 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
+
+func TestMissedStartReportedOnce(t *testing.T) {
+	count := 0
+	tracker := NewTracker(func(a Alert) {
+		if a.Type == AlertMissedStart {
+			count++
+		}
+	})
+
+	scheduledAt := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	tracker.MissedStart("p1", scheduledAt, 10*time.Minute)
+	tracker.MissedStart("p1", scheduledAt, 10*time.Minute)
+
+	if count != 1 {
+		t.Errorf("expected one alert, got %d", count)
+	}
+	if report := tracker.Report(); report[0].MissedStarts != 1 || report[0].ComplianceRate != 0 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
@@ -0,0 +1,207 @@
+package stream_upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultChunkSize is the size of each request of a resumable upload. The
+	// Google APIs require a multiple of 256 KiB.
+	DefaultChunkSize = 8 * 1024 * 1024
+	chunkAlignment   = 256 * 1024
+
+	defaultMaxRetries = 5
+)
+
+// retryBaseDelay is the wait before the first retry, it doubles on each one.
+var retryBaseDelay = 1 * time.Second
+
+// ErrUploadFailed is returned when the destination rejected the upload.
+var ErrUploadFailed = errors.New("upload failed")
+
+// ResumableUpload sends a file to an upload session in chunks, each a PUT
+// with a Content-Range, straight from disk. It follows the resumable upload
+// protocol of YouTube and Google Drive: the session answers 308 with the Range
+// it stored, and after a network error or a 5xx it is asked how much it
+// received so the upload continues from there. Sessions answering 206 to each
+// chunk, such as the TikTok upload URL, are supported with ResendFailedChunk.
+type ResumableUpload struct {
+	Client *http.Client
+	// SessionURL is the upload URL returned when the session was created.
+	SessionURL string
+	ChunkSize  int64
+	// MergeLastChunk sends the remainder of the file with the last full chunk
+	// rather than as a short chunk of its own.
+	MergeLastChunk bool
+	// ResendFailedChunk sends a failed chunk again rather than asking the
+	// session for its status, for sessions that can't tell it.
+	ResendFailedChunk bool
+	ContentType       string
+	MaxRetries        int
+	Progress          ProgressFunc
+}
+
+// Upload sends the file at path and returns the final response of the
+// destination, whose body the caller must close.
+func (u *ResumableUpload) Upload(ctx context.Context, path string) (*http.Response, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat upload file: %w", err)
+	}
+	return u.UploadFrom(ctx, file, info.Size())
+}
+
+// UploadFrom sends the total bytes of file, read chunk by chunk, and returns
+// the final response of the destination, whose body the caller must close.
+func (u *ResumableUpload) UploadFrom(ctx context.Context, file io.ReaderAt, total int64) (*http.Response, error) {
+	client := u.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	chunkSize := u.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	if chunkSize > chunkAlignment {
+		chunkSize -= chunkSize % chunkAlignment
+	}
+	maxRetries := u.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultMaxRetries
+	}
+
+	var offset int64
+	retries := 0
+	for {
+		length := u.chunkLength(offset, chunkSize, total)
+		resp, err := u.sendChunk(ctx, client, file, offset, length, total)
+		if err == nil {
+			switch {
+			case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated:
+				u.report(total, total)
+				return resp, nil
+			case resp.StatusCode == http.StatusPartialContent:
+				// The chunk was stored
+				offset += length
+				retries = 0
+				u.report(offset, total)
+				if offset >= total {
+					return resp, nil
+				}
+				resp.Body.Close()
+				continue
+			case resp.StatusCode == http.StatusPermanentRedirect:
+				// 308 Resume Incomplete, the Range header tells what was stored
+				resp.Body.Close()
+				offset = nextOffset(resp)
+				retries = 0
+				u.report(offset, total)
+				continue
+			case resp.StatusCode < 500:
+				body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+				resp.Body.Close()
+				return nil, fmt.Errorf("%w: status %d: %s", ErrUploadFailed, resp.StatusCode, strings.TrimSpace(string(body)))
+			}
+			resp.Body.Close()
+			err = fmt.Errorf("status %d", resp.StatusCode)
+		}
+
+		if retries >= maxRetries {
+			return nil, fmt.Errorf("%w after %d retries: %v", ErrUploadFailed, retries, err)
+		}
+		retries++
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(retryBaseDelay * time.Duration(1<<(retries-1))):
+		}
+
+		if u.ResendFailedChunk {
+			continue
+		}
+
+		// Ask the session where to resume
+		resp, statusErr := u.queryStatus(ctx, client, total)
+		if statusErr != nil {
+			continue
+		}
+		if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
+			u.report(total, total)
+			return resp, nil
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusPermanentRedirect {
+			offset = nextOffset(resp)
+		}
+	}
+}
+
+// chunkLength returns the length of the chunk starting at offset.
+func (u *ResumableUpload) chunkLength(offset, chunkSize, total int64) int64 {
+	if u.MergeLastChunk && total-offset < 2*chunkSize {
+		return total - offset
+	}
+	return min(chunkSize, total-offset)
+}
+
+func (u *ResumableUpload) sendChunk(ctx context.Context, client *http.Client, file io.ReaderAt, offset, length, total int64) (*http.Response, error) {
+	body := io.NewSectionReader(file, offset, length)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.SessionURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = length
+	if u.ContentType != "" {
+		req.Header.Set("Content-Type", u.ContentType)
+	}
+	if total == 0 {
+		req.Header.Set("Content-Range", "bytes */0")
+	} else {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, total))
+	}
+	return client.Do(req)
+}
+
+func (u *ResumableUpload) queryStatus(ctx context.Context, client *http.Client, total int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.SessionURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", total))
+	return client.Do(req)
+}
+
+func (u *ResumableUpload) report(sent, total int64) {
+	if u.Progress != nil {
+		u.Progress(sent, total)
+	}
+}
+
+// nextOffset reads the "Range: bytes=0-N" header of a 308 response. Without it
+// the session received nothing yet.
+func nextOffset(resp *http.Response) int64 {
+	r := resp.Header.Get("Range")
+	_, last, ok := strings.Cut(strings.TrimPrefix(r, "bytes="), "-")
+	if !ok {
+		return 0
+	}
+	n, err := strconv.ParseInt(last, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n + 1
+}
@@ -0,0 +1,153 @@
+package stream_upload
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// resumableServer stores the chunks it receives and fails the request of the
+// chunk starting at failAt once.
+type resumableServer struct {
+	mutex    sync.Mutex
+	received bytes.Buffer
+	failAt   int64
+	failed   bool
+}
+
+func (s *resumableServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	contentRange := strings.TrimPrefix(r.Header.Get("Content-Range"), "bytes ")
+	span, totalStr, _ := strings.Cut(contentRange, "/")
+	total, _ := strconv.ParseInt(totalStr, 10, 64)
+
+	if span != "*" {
+		start, _ := strconv.ParseInt(strings.Split(span, "-")[0], 10, 64)
+		if start == s.failAt && !s.failed {
+			s.failed = true
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if start != int64(s.received.Len()) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		io.Copy(&s.received, r.Body)
+	}
+
+	if int64(s.received.Len()) == total {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"id":"video-1"}`)
+		return
+	}
+	if s.received.Len() > 0 {
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", s.received.Len()-1))
+	}
+	w.WriteHeader(http.StatusPermanentRedirect)
+}
+
+func TestResumableUploadResumesAfterFailure(t *testing.T) {
+	originalDelay := retryBaseDelay
+	retryBaseDelay = time.Millisecond
+	defer func() { retryBaseDelay = originalDelay }()
+
+	content := bytes.Repeat([]byte("0123456789"), 10)
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := &resumableServer{failAt: 40}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	var lastSent int64
+	upload := &ResumableUpload{
+		SessionURL: ts.URL,
+		ChunkSize:  20,
+		Progress:   func(sent, total int64) { lastSent = sent },
+	}
+	resp, err := upload.Upload(context.Background(), path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if !server.failed {
+		t.Error("expected the server to fail a chunk")
+	}
+	if !bytes.Equal(server.received.Bytes(), content) {
+		t.Errorf("received %q, want %q", server.received.String(), content)
+	}
+	if lastSent != int64(len(content)) {
+		t.Errorf("expected final progress %d, got %d", len(content), lastSent)
+	}
+}
+
+func TestResumableUploadStopsOnClientError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "quota exceeded", http.StatusForbidden)
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	os.WriteFile(path, []byte("data"), 0644)
+
+	_, err := (&ResumableUpload{SessionURL: ts.URL}).Upload(context.Background(), path)
+	if err == nil || !strings.Contains(err.Error(), "status 403") {
+		t.Errorf("expected a 403 error, got %v", err)
+	}
+}
+
+func TestResumableUploadResendsFailedChunk(t *testing.T) {
+	originalDelay := retryBaseDelay
+	retryBaseDelay = time.Millisecond
+	defer func() { retryBaseDelay = originalDelay }()
+
+	content := bytes.Repeat([]byte("0123456789"), 5)
+	var mutex sync.Mutex
+	var ranges []string
+	var received bytes.Buffer
+	failed := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		ranges = append(ranges, r.Header.Get("Content-Range"))
+		if r.Header.Get("Content-Range") == "bytes 20-49/50" && !failed {
+			failed = true
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		io.Copy(&received, r.Body)
+		w.WriteHeader(http.StatusPartialContent)
+	}))
+	defer ts.Close()
+
+	upload := &ResumableUpload{SessionURL: ts.URL, ChunkSize: 20, MergeLastChunk: true, ResendFailedChunk: true}
+	resp, err := upload.UploadFrom(context.Background(), bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	// The last chunk holds the remainder and is sent again as is
+	want := []string{"bytes 0-19/50", "bytes 20-49/50", "bytes 20-49/50"}
+	if strings.Join(ranges, ",") != strings.Join(want, ",") {
+		t.Errorf("got ranges %v, want %v", ranges, want)
+	}
+	if !bytes.Equal(received.Bytes(), content) {
+		t.Errorf("received %q, want %q", received.String(), content)
+	}
+}
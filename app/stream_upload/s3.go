@@ -0,0 +1,50 @@
+package stream_upload
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// S3PartSize is the part size of multipart uploads, memory use is bounded by
+// the part size times the upload concurrency.
+const S3PartSize = 16 * 1024 * 1024
+
+// UploadToS3 streams the file at path to the bucket and key of input, whose
+// other fields such as the content type or ACL apply to the object.
+func UploadToS3(ctx context.Context, client s3iface.S3API, input *s3manager.UploadInput, path string, progress ProgressFunc) (*s3manager.UploadOutput, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat upload file: %w", err)
+	}
+	output, err := UploadStreamToS3(ctx, client, input, file, info.Size(), progress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload %s to S3: %w", path, err)
+	}
+	return output, nil
+}
+
+// UploadStreamToS3 streams body, of size bytes or -1 when unknown, to the
+// bucket and key of input as a multipart upload. Failed parts are retried by
+// the SDK, only the part is sent again, and the upload is aborted when a part
+// keeps failing so no orphan parts are billed.
+func UploadStreamToS3(ctx context.Context, client s3iface.S3API, input *s3manager.UploadInput, body io.Reader, size int64, progress ProgressFunc) (*s3manager.UploadOutput, error) {
+	uploader := s3manager.NewUploaderWithClient(client, func(u *s3manager.Uploader) {
+		u.PartSize = S3PartSize
+		u.Concurrency = 2
+	})
+
+	streamed := *input
+	streamed.Body = &progressReader{reader: body, total: size, progress: progress}
+	return uploader.UploadWithContext(ctx, &streamed)
+}
@@ -0,0 +1,67 @@
+// Package stream_upload sends large artifacts to remote destinations straight
+// from disk, in chunks, so a video never has to fit in memory. Uploads report
+// their progress to the execution log and resume after transient failures.
+package stream_upload
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/serisow/lesocle/logging"
+)
+
+// ProgressFunc is called as bytes are sent, with the total size of the file.
+type ProgressFunc func(sent, total int64)
+
+// LogProgress returns a ProgressFunc writing a line to the execution log of
+// ctx every 10%. It does nothing outside an execution.
+func LogProgress(ctx context.Context, name string) ProgressFunc {
+	executionID, stepID, ok := logging.ExecutionLogScope(ctx)
+	if !ok {
+		return nil
+	}
+	var mutex sync.Mutex
+	lastDecile := int64(-1)
+	return func(sent, total int64) {
+		if total <= 0 {
+			return
+		}
+		decile := sent * 10 / total
+		mutex.Lock()
+		if decile == lastDecile {
+			mutex.Unlock()
+			return
+		}
+		lastDecile = decile
+		mutex.Unlock()
+		logging.ExecutionLogs.Append(logging.ExecutionLogLine{
+			ExecutionID: executionID,
+			StepID:      stepID,
+			Level:       "INFO",
+			Message:     fmt.Sprintf("upload %s: %d%% (%d/%d bytes)", name, decile*10, sent, total),
+		})
+	}
+}
+
+// progressReader reports the bytes read through it.
+type progressReader struct {
+	reader   io.Reader
+	mutex    sync.Mutex
+	sent     int64
+	total    int64
+	progress ProgressFunc
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 && r.progress != nil {
+		r.mutex.Lock()
+		r.sent += int64(n)
+		sent := r.sent
+		r.mutex.Unlock()
+		r.progress(sent, r.total)
+	}
+	return n, err
+}
@@ -0,0 +1,163 @@
+package tokenizer
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// piecePattern splits text into the pieces tokens never cross, as the
+// cl100k_base pattern does. RE2 has no lookahead so the `\s+(?!\S)`
+// alternative is emulated by splitPieces.
+var piecePattern = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`)
+
+// splitPieces returns the pieces of text.
+func splitPieces(text string) []string {
+	var pieces []string
+	for len(text) > 0 {
+		loc := piecePattern.FindStringIndex(text)
+		if loc == nil || loc[1] == 0 {
+			// Not expected, the last alternative matches any whitespace
+			pieces = append(pieces, text)
+			break
+		}
+		end := loc[1]
+		piece := text[:end]
+		// Whitespace before a word leaves its last character to the word
+		if end < len(text) && isSpaces(piece) && !strings.ContainsAny(piece, "\r\n") {
+			if _, size := utf8.DecodeLastRuneInString(piece); size < len(piece) {
+				end -= size
+				piece = text[:end]
+			}
+		}
+		pieces = append(pieces, piece)
+		text = text[end:]
+	}
+	return pieces
+}
+
+func isSpaces(s string) bool {
+	for _, r := range s {
+		if !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// BPE is a byte pair encoding such as cl100k_base.
+type BPE struct {
+	name  string
+	ranks map[string]int
+}
+
+// NewBPE creates an encoding from the ranks of its tokens.
+func NewBPE(name string, ranks map[string]int) *BPE {
+	return &BPE{name: name, ranks: ranks}
+}
+
+func (b *BPE) Name() string { return b.name }
+
+func (b *BPE) Count(text string) int {
+	n := 0
+	for _, piece := range splitPieces(text) {
+		n += len(b.encodePiece(piece))
+	}
+	return n
+}
+
+func (b *BPE) Truncate(text string, maxTokens int) string {
+	var out strings.Builder
+	n := 0
+	for _, piece := range splitPieces(text) {
+		for _, token := range b.encodePiece(piece) {
+			if n == maxTokens {
+				return trimInvalidUTF8(out.String())
+			}
+			out.WriteString(token)
+			n++
+		}
+	}
+	return out.String()
+}
+
+// encodePiece merges the bytes of a piece, lowest ranked pair first.
+func (b *BPE) encodePiece(piece string) []string {
+	if _, ok := b.ranks[piece]; ok {
+		return []string{piece}
+	}
+	parts := make([]string, len(piece))
+	for i := 0; i < len(piece); i++ {
+		parts[i] = piece[i : i+1]
+	}
+	for len(parts) > 1 {
+		best, bestRank := -1, 0
+		for i := 0; i < len(parts)-1; i++ {
+			if rank, ok := b.ranks[parts[i]+parts[i+1]]; ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts[best] += parts[best+1]
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+	return parts
+}
+
+// trimInvalidUTF8 drops the bytes of a character cut by a token boundary.
+func trimInvalidUTF8(s string) string {
+	for i := 0; i < utf8.UTFMax && !utf8.ValidString(s); i++ {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// Heuristic estimates tokens from the pieces: a token per five characters of
+// alphabetic text and per character of CJK text, close enough for the models
+// whose tokenizer isn't public.
+var Heuristic Tokenizer = heuristic{}
+
+type heuristic struct{}
+
+func (heuristic) Name() string { return "heuristic" }
+
+func (heuristic) Count(text string) int {
+	n := 0
+	for _, piece := range splitPieces(text) {
+		n += pieceTokens(piece)
+	}
+	return n
+}
+
+func (heuristic) Truncate(text string, maxTokens int) string {
+	n, end := 0, 0
+	for _, piece := range splitPieces(text) {
+		if n+pieceTokens(piece) > maxTokens {
+			break
+		}
+		n += pieceTokens(piece)
+		end += len(piece)
+	}
+	return text[:end]
+}
+
+func pieceTokens(piece string) int {
+	n, wide := 0, 0
+	for i, r := range piece {
+		switch {
+		case r >= 0x3000:
+			wide++
+		case i == 0 && r == ' ':
+			// Spaces are merged with the following word
+		default:
+			n++
+		}
+	}
+	if tokens := wide + (n+2)/5; tokens > 0 {
+		return tokens
+	}
+	return 1
+}
@@ -0,0 +1,41 @@
+package tokenizer
+
+import "strings"
+
+// contextWindows are the context windows of the models in tokens, keyed by
+// model name prefix like the prices.
+var contextWindows = map[string]int{
+	"gpt-4o":           128000,
+	"gpt-4-turbo":      128000,
+	"gpt-4":            8192,
+	"gpt-3.5-turbo":    16385,
+	"o1":               200000,
+	"o1-mini":          128000,
+	"claude-3":         200000,
+	"claude-3-5":       200000,
+	"gemini-1.5-pro":   2000000,
+	"gemini-1.5-flash": 1000000,
+	"gemini-2.0":       1000000,
+	"gemini-pro":       32760,
+	"llama-3.1":        128000,
+	"llama-3.3":        128000,
+	"llama3":           8192,
+	"mixtral-8x7b":     32768,
+	"gemma2":           8192,
+}
+
+// ContextWindow returns the context window of a model in tokens, 0 when it
+// is unknown. OpenRouter names ("vendor/model") are looked up by model.
+func ContextWindow(model string) int {
+	model = strings.ToLower(model)
+	if _, name, ok := strings.Cut(model, "/"); ok {
+		model = name
+	}
+	best, window := "", 0
+	for prefix, size := range contextWindows {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best, window = prefix, size
+		}
+	}
+	return window
+}
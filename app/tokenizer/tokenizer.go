@@ -0,0 +1,120 @@
+// Package tokenizer counts the tokens of prompts the way the providers bill
+// them. OpenAI models are counted with their BPE encoding when its
+// tiktoken file is available, the other models with an estimate.
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Tokenizer counts and truncates text in tokens.
+type Tokenizer interface {
+	// Name of the encoding, recorded with the counts
+	Name() string
+	Count(text string) int
+	// Truncate returns the longest prefix of text of at most maxTokens tokens.
+	Truncate(text string, maxTokens int) string
+}
+
+// Encodings are the tiktoken files Load reads, by encoding name.
+var Encodings = []string{"cl100k_base", "o200k_base"}
+
+var (
+	mutex     sync.RWMutex
+	encodings = make(map[string]*BPE)
+)
+
+// Load reads the <encoding>.tiktoken files of dir, as distributed by OpenAI.
+// Missing files are skipped, the models using them are then estimated.
+func Load(dir string) ([]string, error) {
+	var loaded []string
+	for _, name := range Encodings {
+		path := filepath.Join(dir, name+".tiktoken")
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return loaded, fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		ranks, err := readRanks(file)
+		file.Close()
+		if err != nil {
+			return loaded, fmt.Errorf("invalid encoding file %s: %w", path, err)
+		}
+		Register(NewBPE(name, ranks))
+		loaded = append(loaded, name)
+	}
+	return loaded, nil
+}
+
+// Register makes an encoding available to ForModel.
+func Register(b *BPE) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	encodings[b.Name()] = b
+}
+
+// ForModel returns the tokenizer of a model of an LLM service, the estimate
+// when its encoding isn't loaded or isn't public.
+func ForModel(service, model string) Tokenizer {
+	model = strings.ToLower(model)
+	// OpenRouter names the OpenAI models "openai/<model>"
+	if vendor, name, ok := strings.Cut(model, "/"); ok {
+		if vendor != "openai" {
+			return Heuristic
+		}
+		service, model = "openai", name
+	}
+	if service != "openai" && service != "openrouter" {
+		return Heuristic
+	}
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if b, ok := encodings[openAIEncoding(model)]; ok {
+		return b
+	}
+	return Heuristic
+}
+
+// openAIEncoding returns the encoding of an OpenAI model.
+func openAIEncoding(model string) string {
+	for _, prefix := range []string{"gpt-4o", "gpt-4.1", "gpt-4.5", "chatgpt-4o", "o1", "o3", "o4"} {
+		if strings.HasPrefix(model, prefix) {
+			return "o200k_base"
+		}
+	}
+	return "cl100k_base"
+}
+
+// readRanks reads the "<base64 token> <rank>" lines of a tiktoken file.
+func readRanks(file *os.File) (map[string]int, error) {
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected a token and a rank", line)
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		ranks[string(token)] = rank
+	}
+	return ranks, scanner.Err()
+}
@@ -0,0 +1,78 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitPieces(t *testing.T) {
+	got := splitPieces("Hello world, it's 2024!\n\n  Bye")
+	want := []string{"Hello", " world", ",", " it", "'s", " ", "202", "4", "!\n\n", " ", " Bye"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestBPEMergesLowestRankFirst(t *testing.T) {
+	ranks := map[string]int{}
+	for i := 0; i < 256; i++ {
+		ranks[string([]byte{byte(i)})] = i
+	}
+	ranks["lo"] = 256
+	ranks["low"] = 257
+	ranks[" low"] = 258
+	ranks["er"] = 259
+	dir := t.TempDir()
+	var lines []string
+	for token, rank := range ranks {
+		lines = append(lines, fmt.Sprintf("%s %d", base64.StdEncoding.EncodeToString([]byte(token)), rank))
+	}
+	os.WriteFile(filepath.Join(dir, "cl100k_base.tiktoken"), []byte(strings.Join(lines, "\n")), 0644)
+
+	loaded, err := Load(dir)
+	if err != nil || len(loaded) != 1 {
+		t.Fatalf("expected cl100k_base to load, got %v %v", loaded, err)
+	}
+	defer func() {
+		mutex.Lock()
+		delete(encodings, "cl100k_base")
+		mutex.Unlock()
+	}()
+
+	tok := ForModel("openai", "gpt-4-turbo")
+	if tok.Name() != "cl100k_base" {
+		t.Fatalf("expected cl100k_base, got %s", tok.Name())
+	}
+	// " low" is a token, "lower" merges into "low" "er"
+	if n := tok.Count("lower low"); n != 3 {
+		t.Errorf("expected 3 tokens, got %d", n)
+	}
+	if got := tok.Truncate("lower low", 2); got != "lower" {
+		t.Errorf("expected the first two tokens, got %q", got)
+	}
+
+	if ForModel("openai", "gpt-4o").Name() != "heuristic" {
+		t.Error("o200k_base isn't loaded, gpt-4o should be estimated")
+	}
+	if ForModel("openrouter", "openai/gpt-4").Name() != "cl100k_base" {
+		t.Error("OpenAI models routed through OpenRouter should use their encoding")
+	}
+	if ForModel("anthropic", "claude-3-5-sonnet").Name() != "heuristic" {
+		t.Error("Anthropic models should be estimated")
+	}
+}
+
+func TestHeuristicTruncatesOnPieces(t *testing.T) {
+	text := "one two three four"
+	if n := Heuristic.Count(text); n != 4 {
+		t.Errorf("expected 4 tokens, got %d", n)
+	}
+	if got := Heuristic.Truncate(text, 2); got != "one two" {
+		t.Errorf("expected %q, got %q", "one two", got)
+	}
+}
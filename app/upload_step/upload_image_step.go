@@ -2,6 +2,8 @@ package upload_step
 
 import (
     "context"
+    "crypto/sha256"
+    "encoding/hex"
     "encoding/json"
     "fmt"
     "io"
@@ -28,6 +30,7 @@ type FileInfo struct {
     Filename  string `json:"filename"`
     Size      int64  `json:"size"`
     Timestamp int64  `json:"timestamp"`
+    SHA256    string `json:"sha256"`
 }
 
 func (s *UploadImageStepImpl) Execute(ctx context.Context, pipelineContext *pipeline_type.Context) error {
@@ -53,7 +56,7 @@ func (s *UploadImageStepImpl) Execute(ctx context.Context, pipelineContext *pipe
         slog.String("mime", config.FileMime))
 
     // Download the image to a local file
-    localFilePath, err := s.downloadImage(ctx, config)
+    localFilePath, checksum, err := s.downloadImage(ctx, config)
     if err != nil {
         return fmt.Errorf("failed to download image: %w", err)
     }
@@ -73,6 +76,7 @@ func (s *UploadImageStepImpl) Execute(ctx context.Context, pipelineContext *pipe
         Filename:  config.FileName,
         Size:      fileInfo.Size(),
         Timestamp: time.Now().Unix(),
+        SHA256:    checksum,
     }
 
     // Convert to JSON string for consistent output format
@@ -91,11 +95,12 @@ func (s *UploadImageStepImpl) Execute(ctx context.Context, pipelineContext *pipe
     return nil
 }
 
-func (s *UploadImageStepImpl) downloadImage(ctx context.Context, config *pipeline_type.UploadImageConfig) (string, error) {
+// downloadImage saves the image locally and returns its path and SHA-256.
+func (s *UploadImageStepImpl) downloadImage(ctx context.Context, config *pipeline_type.UploadImageConfig) (string, string, error) {
     // Create directory for downloaded images
     dir := filepath.Join("storage", "pipeline", "images", time.Now().Format("2006-01"))
     if err := os.MkdirAll(dir, 0755); err != nil {
-        return "", fmt.Errorf("failed to create directory: %w", err)
+        return "", "", fmt.Errorf("failed to create directory: %w", err)
     }
 
     // Generate filename for the downloaded image
@@ -117,36 +122,37 @@ func (s *UploadImageStepImpl) downloadImage(ctx context.Context, config *pipelin
 
     req, err := http.NewRequestWithContext(ctx, "GET", config.FileURL, nil)
     if err != nil {
-        return "", fmt.Errorf("failed to create request: %w", err)
+        return "", "", fmt.Errorf("failed to create request: %w", err)
     }
 
     resp, err := client.Do(req)
     if err != nil {
-        return "", fmt.Errorf("failed to download image: %w", err)
+        return "", "", fmt.Errorf("failed to download image: %w", err)
     }
     defer resp.Body.Close()
 
     if resp.StatusCode != http.StatusOK {
-        return "", fmt.Errorf("failed to download image, status: %d", resp.StatusCode)
+        return "", "", fmt.Errorf("failed to download image, status: %d", resp.StatusCode)
     }
 
     // Create output file
     file, err := os.Create(outputPath)
     if err != nil {
-        return "", fmt.Errorf("failed to create output file: %w", err)
+        return "", "", fmt.Errorf("failed to create output file: %w", err)
     }
     defer file.Close()
 
-    // Copy the content
-    _, err = io.Copy(file, resp.Body)
+    // Copy the content, hashing it on the way
+    hash := sha256.New()
+    _, err = io.Copy(io.MultiWriter(file, hash), resp.Body)
     if err != nil {
-        return "", fmt.Errorf("failed to save image data: %w", err)
+        return "", "", fmt.Errorf("failed to save image data: %w", err)
     }
 
     s.Logger.Info("Successfully downloaded image", slog.String("path", outputPath))
-    return outputPath, nil
+    return outputPath, hex.EncodeToString(hash.Sum(nil)), nil
 }
 
 func (s *UploadImageStepImpl) GetType() string {
-    return "upload_image_step"
+    return "image_asset_step"
 }
\ No newline at end of file